@@ -0,0 +1,158 @@
+// Command keysetgen generates and maintains the encrypted keysets used as
+// CryptoConfig.KeysetData.
+//
+//	keysetgen kek
+//	keysetgen generate  -kek-uri URI [-kek-ad AD] [-type TYPE]
+//	keysetgen rotate    -kek-uri URI [-kek-ad AD] -keyset DATA
+//	keysetgen reencrypt -kek-uri URI [-kek-ad AD] -keyset DATA -new-kek-uri URI [-new-kek-ad AD]
+//	keysetgen info      -kek-uri URI [-kek-ad AD] -keyset DATA
+//	keysetgen public    -kek-uri URI [-kek-ad AD] -keyset DATA
+//
+// kek prints a new caas-kms:// KEK URI for local development. The -type of
+// generate is one of aead (default, CryptoConfig.KeysetData), deterministic,
+// streaming, ed25519, ecdsa-p256, hmac-sha256, hpke-x25519 or ecies-p256.
+// public prints the public keyset of a signature or hybrid keyset, to be
+// shared with partners. The keyset is read from stdin when -keyset
+// is "-". Managed KMS clients are configured from the environment,
+// see the awskms, gcpkms, azurekms and vaulttransit packages. The command is
+// a module of its own, like the gcpkms and azurekms clients, so that their
+// cloud SDKs are not dependencies of the services.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/achuala/go-svc-extn/pkg/crypto/encdec"
+	"github.com/achuala/go-svc-extn/pkg/crypto/encdec/awskms"
+	"github.com/achuala/go-svc-extn/pkg/crypto/encdec/azurekms"
+	"github.com/achuala/go-svc-extn/pkg/crypto/encdec/gcpkms"
+	"github.com/achuala/go-svc-extn/pkg/crypto/encdec/vaulttransit"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "keysetgen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing command, one of kek, generate, rotate, reencrypt, info or public")
+	}
+	command := args[0]
+	if command == "kek" {
+		uri, err := encdec.NewKeyURI()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, uri)
+		return nil
+	}
+
+	fs := flag.NewFlagSet(command, flag.ContinueOnError)
+	kekUri := fs.String("kek-uri", "", "URI of the key encryption key")
+	kekAd := fs.String("kek-ad", "", "associated data of the keyset encryption")
+	keySetData := fs.String("keyset", "", "encrypted keyset, - reads it from stdin")
+	newKekUri := fs.String("new-kek-uri", "", "URI of the new key encryption key (reencrypt)")
+	newKekAd := fs.String("new-kek-ad", "", "associated data of the new keyset encryption (reencrypt)")
+	keysetType := fs.String("type", "aead", "keyset type: aead, deterministic, streaming, ed25519, ecdsa-p256, hmac-sha256, hpke-x25519 or ecies-p256 (generate)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *kekUri == "" {
+		return fmt.Errorf("-kek-uri is required")
+	}
+	if err := registerKMSClient(*kekUri); err != nil {
+		return err
+	}
+	if command != "generate" {
+		if *keySetData == "-" {
+			line, err := bufio.NewReader(stdin).ReadString('\n')
+			if err != nil && err != io.EOF {
+				return err
+			}
+			*keySetData = strings.TrimSpace(line)
+		}
+		if *keySetData == "" {
+			return fmt.Errorf("-keyset is required")
+		}
+	}
+
+	var (
+		out string
+		err error
+	)
+	switch command {
+	case "generate":
+		switch *keysetType {
+		case "aead":
+			out, err = encdec.NewKeyset(*kekUri, []byte(*kekAd))
+		case "deterministic":
+			out, err = encdec.NewDeterministicKeyset(*kekUri, []byte(*kekAd))
+		case "streaming":
+			out, err = encdec.NewStreamingKeyset(*kekUri, []byte(*kekAd))
+		case encdec.SignatureEd25519, encdec.SignatureECDSAP256:
+			out, err = encdec.NewSignatureKeyset(*keysetType, *kekUri, []byte(*kekAd))
+		case encdec.HybridHPKEX25519, encdec.HybridECIESP256:
+			out, err = encdec.NewHybridKeyset(*keysetType, *kekUri, []byte(*kekAd))
+		case "hmac-sha256":
+			out, err = encdec.NewMACKeyset(*kekUri, []byte(*kekAd))
+		default:
+			return fmt.Errorf("unknown keyset type %s", *keysetType)
+		}
+	case "rotate":
+		out, err = encdec.RotateKeyset(*keySetData, *kekUri, []byte(*kekAd))
+	case "reencrypt":
+		if *newKekUri == "" {
+			return fmt.Errorf("-new-kek-uri is required")
+		}
+		if err := registerKMSClient(*newKekUri); err != nil {
+			return err
+		}
+		out, err = encdec.ReencryptKeyset(*keySetData, *kekUri, []byte(*kekAd), *newKekUri, []byte(*newKekAd))
+	case "public":
+		out, err = encdec.ExportPublicKeyset(*keySetData, *kekUri, []byte(*kekAd))
+	case "info":
+		info, err := encdec.KeysetInfo(*keySetData, *kekUri, []byte(*kekAd))
+		if err != nil {
+			return err
+		}
+		for _, key := range info.GetKeyInfo() {
+			primary := ""
+			if key.GetKeyId() == info.GetPrimaryKeyId() {
+				primary = " primary"
+			}
+			fmt.Fprintf(stdout, "%d %s %s %s%s\n", key.GetKeyId(), key.GetTypeUrl(), key.GetStatus(), key.GetOutputPrefixType(), primary)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown command %s", command)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, out)
+	return nil
+}
+
+// registerKMSClient registers the managed KMS client of the KEK URI, caas-kms
+// URIs are handled by encdec itself.
+func registerKMSClient(kekUri string) error {
+	switch {
+	case strings.HasPrefix(kekUri, awskms.Prefix):
+		return awskms.Register(awskms.Prefix, &awskms.Config{})
+	case strings.HasPrefix(kekUri, gcpkms.Prefix):
+		return gcpkms.Register(gcpkms.Prefix, &gcpkms.Config{})
+	case strings.HasPrefix(kekUri, azurekms.Prefix):
+		return azurekms.Register(azurekms.Prefix, &azurekms.Config{})
+	case strings.HasPrefix(kekUri, vaulttransit.Prefix):
+		return vaulttransit.Register(vaulttransit.Prefix, &vaulttransit.Config{})
+	}
+	return nil
+}
@@ -38,6 +38,9 @@ type Sensitive struct {
 	// Indicates the field is a PII, field with this option will
 	// expect the data to be encrypted and not logged in plain text
 	Pii bool `protobuf:"varint,5,opt,name=pii,proto3" json:"pii,omitempty"`
+	// Configures how the field is masked when mask is set, by default
+	// the last 4 characters are kept
+	Masking *Masking `protobuf:"bytes,6,opt,name=masking,proto3" json:"masking,omitempty"`
 }
 
 func (x *Sensitive) Reset() {
@@ -112,6 +115,13 @@ func (x *Sensitive) GetPii() bool {
 	return false
 }
 
+func (x *Sensitive) GetMasking() *Masking {
+	if x != nil {
+		return x.Masking
+	}
+	return nil
+}
+
 type isSensitive_LogAction interface {
 	isSensitive_LogAction()
 }
@@ -127,7 +137,8 @@ type Sensitive_Mask struct {
 }
 
 type Sensitive_Obfuscate struct {
-	// Indicates to obfuscate the data while logging
+	// Indicates to obfuscate the data while logging, the value is
+	// replaced with a keyed hash so that equal values can be correlated
 	Obfuscate bool `protobuf:"varint,3,opt,name=obfuscate,proto3,oneof"` // Indicates whether data is PII or not
 }
 
@@ -137,6 +148,93 @@ func (*Sensitive_Mask) isSensitive_LogAction() {}
 
 func (*Sensitive_Obfuscate) isSensitive_LogAction() {}
 
+// Masking selects the masking of a field, e.g.
+// [(options.sensitive) = {mask: true, masking: {keep_first: 6, keep_last: 4}}]
+// The first of name, token and email which is set is applied, otherwise
+// keep_first and keep_last.
+type Masking struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Number of leading characters kept in clear
+	KeepFirst uint32 `protobuf:"varint,1,opt,name=keep_first,json=keepFirst,proto3" json:"keep_first,omitempty"`
+	// Number of trailing characters kept in clear
+	KeepLast uint32 `protobuf:"varint,2,opt,name=keep_last,json=keepLast,proto3" json:"keep_last,omitempty"`
+	// Replaces the whole value with the token, e.g. [PHONE]
+	Token string `protobuf:"bytes,3,opt,name=token,proto3" json:"token,omitempty"`
+	// Masks the local part of an email address and keeps the domain
+	Email bool `protobuf:"varint,4,opt,name=email,proto3" json:"email,omitempty"`
+	// Name of a mask function of the logging middleware, either built in
+	// (pan, email, phone) or registered with WithMaskFunc
+	Name string `protobuf:"bytes,5,opt,name=name,proto3" json:"name,omitempty"`
+}
+
+func (x *Masking) Reset() {
+	*x = Masking{}
+	mi := &file_options_log_options_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Masking) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Masking) ProtoMessage() {}
+
+func (x *Masking) ProtoReflect() protoreflect.Message {
+	mi := &file_options_log_options_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Masking.ProtoReflect.Descriptor instead.
+func (*Masking) Descriptor() ([]byte, []int) {
+	return file_options_log_options_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Masking) GetKeepFirst() uint32 {
+	if x != nil {
+		return x.KeepFirst
+	}
+	return 0
+}
+
+func (x *Masking) GetKeepLast() uint32 {
+	if x != nil {
+		return x.KeepLast
+	}
+	return 0
+}
+
+func (x *Masking) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+func (x *Masking) GetEmail() bool {
+	if x != nil {
+		return x.Email
+	}
+	return false
+}
+
+func (x *Masking) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
 var file_options_log_options_proto_extTypes = []protoimpl.ExtensionInfo{
 	{
 		ExtendedType:  (*descriptorpb.FieldOptions)(nil),
@@ -146,6 +244,22 @@ var file_options_log_options_proto_extTypes = []protoimpl.ExtensionInfo{
 		Tag:           "bytes,50003,opt,name=sensitive",
 		Filename:      "options/log_options.proto",
 	},
+	{
+		ExtendedType:  (*descriptorpb.MessageOptions)(nil),
+		ExtensionType: (*Sensitive)(nil),
+		Field:         50003,
+		Name:          "options.sensitive_message",
+		Tag:           "bytes,50003,opt,name=sensitive_message",
+		Filename:      "options/log_options.proto",
+	},
+	{
+		ExtendedType:  (*descriptorpb.OneofOptions)(nil),
+		ExtensionType: (*Sensitive)(nil),
+		Field:         50003,
+		Name:          "options.sensitive_oneof",
+		Tag:           "bytes,50003,opt,name=sensitive_oneof",
+		Filename:      "options/log_options.proto",
+	},
 }
 
 // Extension fields to descriptorpb.FieldOptions.
@@ -155,17 +269,48 @@ var (
 	// display by tools aware of this annotation. Note that that this has no effect on standard
 	// Protobuf functions such as `TextFormat::PrintToString`.
 	//
-	// # For example this to be used as below
+	// For example this to be used as below
 	//
-	//	message SensitiveTestData {
-	//	   string name = 1 [(options.sensitive).mask = true];
-	//	   string secret = 2 [(options.sensitive).encrypt = true];
-	//	 }
+	// message SensitiveTestData {
+	//    string name = 1 [(options.sensitive).mask = true];
+	//    string secret = 2 [(options.sensitive).encrypt = true];
+	//  }
 	//
 	// optional options.Sensitive sensitive = 50003;
 	E_Sensitive = &file_options_log_options_proto_extTypes[0]
 )
 
+// Extension fields to descriptorpb.MessageOptions.
+var (
+	// `sensitive_message` applies to every field holding the message, as if each of
+	// them was annotated with `sensitive`, and to the message itself when it is logged,
+	// so that its fields don't need to be annotated individually.
+	//
+	// message CardDetails {
+	//    option (options.sensitive_message).redact = true;
+	//    string pan = 1;
+	//    string cvv = 2;
+	//  }
+	//
+	// optional options.Sensitive sensitive_message = 50003;
+	E_SensitiveMessage = &file_options_log_options_proto_extTypes[1]
+)
+
+// Extension fields to descriptorpb.OneofOptions.
+var (
+	// `sensitive_oneof` applies to the fields of the oneof which are not annotated
+	// with `sensitive` themselves.
+	//
+	// oneof credential {
+	//    option (options.sensitive_oneof).redact = true;
+	//    string password = 1;
+	//    string token = 2;
+	//  }
+	//
+	// optional options.Sensitive sensitive_oneof = 50003;
+	E_SensitiveOneof = &file_options_log_options_proto_extTypes[2]
+)
+
 var File_options_log_options_proto protoreflect.FileDescriptor
 
 var file_options_log_options_proto_rawDesc = []byte{
@@ -173,7 +318,7 @@ var file_options_log_options_proto_rawDesc = []byte{
 	0x74, 0x69, 0x6f, 0x6e, 0x73, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x07, 0x6f, 0x70, 0x74,
 	0x69, 0x6f, 0x6e, 0x73, 0x1a, 0x20, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f,
 	0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x64, 0x65, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x6f, 0x72,
-	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x95, 0x01, 0x0a, 0x09, 0x53, 0x65, 0x6e, 0x73, 0x69,
+	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0xc1, 0x01, 0x0a, 0x09, 0x53, 0x65, 0x6e, 0x73, 0x69,
 	0x74, 0x69, 0x76, 0x65, 0x12, 0x18, 0x0a, 0x06, 0x72, 0x65, 0x64, 0x61, 0x63, 0x74, 0x18, 0x01,
 	0x20, 0x01, 0x28, 0x08, 0x48, 0x00, 0x52, 0x06, 0x72, 0x65, 0x64, 0x61, 0x63, 0x74, 0x12, 0x14,
 	0x0a, 0x04, 0x6d, 0x61, 0x73, 0x6b, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x48, 0x00, 0x52, 0x04,
@@ -182,21 +327,45 @@ var file_options_log_options_proto_rawDesc = []byte{
 	0x63, 0x61, 0x74, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x65, 0x6e, 0x63, 0x72, 0x79, 0x70, 0x74, 0x18,
 	0x04, 0x20, 0x01, 0x28, 0x08, 0x52, 0x07, 0x65, 0x6e, 0x63, 0x72, 0x79, 0x70, 0x74, 0x12, 0x10,
 	0x0a, 0x03, 0x70, 0x69, 0x69, 0x18, 0x05, 0x20, 0x01, 0x28, 0x08, 0x52, 0x03, 0x70, 0x69, 0x69,
-	0x42, 0x0c, 0x0a, 0x0a, 0x6c, 0x6f, 0x67, 0x5f, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x3a, 0x51,
-	0x0a, 0x09, 0x73, 0x65, 0x6e, 0x73, 0x69, 0x74, 0x69, 0x76, 0x65, 0x12, 0x1d, 0x2e, 0x67, 0x6f,
-	0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x46, 0x69,
-	0x65, 0x6c, 0x64, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0xd3, 0x86, 0x03, 0x20, 0x01,
-	0x28, 0x0b, 0x32, 0x12, 0x2e, 0x6f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x2e, 0x53, 0x65, 0x6e,
-	0x73, 0x69, 0x74, 0x69, 0x76, 0x65, 0x52, 0x09, 0x73, 0x65, 0x6e, 0x73, 0x69, 0x74, 0x69, 0x76,
-	0x65, 0x42, 0x80, 0x01, 0x0a, 0x0b, 0x63, 0x6f, 0x6d, 0x2e, 0x6f, 0x70, 0x74, 0x69, 0x6f, 0x6e,
-	0x73, 0x42, 0x0f, 0x4c, 0x6f, 0x67, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x50, 0x72, 0x6f,
-	0x74, 0x6f, 0x50, 0x01, 0x5a, 0x24, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d,
-	0x2f, 0x61, 0x63, 0x68, 0x75, 0x61, 0x6c, 0x61, 0x2f, 0x67, 0x6f, 0x73, 0x76, 0x63, 0x65, 0x78,
-	0x74, 0x6e, 0x2f, 0x6f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0xa2, 0x02, 0x03, 0x4f, 0x58, 0x58,
-	0xaa, 0x02, 0x07, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0xca, 0x02, 0x07, 0x4f, 0x70, 0x74,
-	0x69, 0x6f, 0x6e, 0x73, 0xe2, 0x02, 0x13, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x5c, 0x47,
-	0x50, 0x42, 0x4d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0xea, 0x02, 0x07, 0x4f, 0x70, 0x74,
-	0x69, 0x6f, 0x6e, 0x73, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x12, 0x2a, 0x0a, 0x07, 0x6d, 0x61, 0x73, 0x6b, 0x69, 0x6e, 0x67, 0x18, 0x06, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x10, 0x2e, 0x6f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x2e, 0x4d, 0x61, 0x73, 0x6b,
+	0x69, 0x6e, 0x67, 0x52, 0x07, 0x6d, 0x61, 0x73, 0x6b, 0x69, 0x6e, 0x67, 0x42, 0x0c, 0x0a, 0x0a,
+	0x6c, 0x6f, 0x67, 0x5f, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x22, 0x85, 0x01, 0x0a, 0x07, 0x4d,
+	0x61, 0x73, 0x6b, 0x69, 0x6e, 0x67, 0x12, 0x1d, 0x0a, 0x0a, 0x6b, 0x65, 0x65, 0x70, 0x5f, 0x66,
+	0x69, 0x72, 0x73, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x09, 0x6b, 0x65, 0x65, 0x70,
+	0x46, 0x69, 0x72, 0x73, 0x74, 0x12, 0x1b, 0x0a, 0x09, 0x6b, 0x65, 0x65, 0x70, 0x5f, 0x6c, 0x61,
+	0x73, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x08, 0x6b, 0x65, 0x65, 0x70, 0x4c, 0x61,
+	0x73, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x74, 0x6f, 0x6b, 0x65, 0x6e, 0x18, 0x03, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x05, 0x74, 0x6f, 0x6b, 0x65, 0x6e, 0x12, 0x14, 0x0a, 0x05, 0x65, 0x6d, 0x61, 0x69,
+	0x6c, 0x18, 0x04, 0x20, 0x01, 0x28, 0x08, 0x52, 0x05, 0x65, 0x6d, 0x61, 0x69, 0x6c, 0x12, 0x12,
+	0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61,
+	0x6d, 0x65, 0x3a, 0x51, 0x0a, 0x09, 0x73, 0x65, 0x6e, 0x73, 0x69, 0x74, 0x69, 0x76, 0x65, 0x12,
+	0x1d, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75,
+	0x66, 0x2e, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0xd3,
+	0x86, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x6f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73,
+	0x2e, 0x53, 0x65, 0x6e, 0x73, 0x69, 0x74, 0x69, 0x76, 0x65, 0x52, 0x09, 0x73, 0x65, 0x6e, 0x73,
+	0x69, 0x74, 0x69, 0x76, 0x65, 0x3a, 0x62, 0x0a, 0x11, 0x73, 0x65, 0x6e, 0x73, 0x69, 0x74, 0x69,
+	0x76, 0x65, 0x5f, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x1f, 0x2e, 0x67, 0x6f, 0x6f,
+	0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x4d, 0x65, 0x73,
+	0x73, 0x61, 0x67, 0x65, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0xd3, 0x86, 0x03, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x6f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x2e, 0x53, 0x65,
+	0x6e, 0x73, 0x69, 0x74, 0x69, 0x76, 0x65, 0x52, 0x10, 0x73, 0x65, 0x6e, 0x73, 0x69, 0x74, 0x69,
+	0x76, 0x65, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x3a, 0x5c, 0x0a, 0x0f, 0x73, 0x65, 0x6e,
+	0x73, 0x69, 0x74, 0x69, 0x76, 0x65, 0x5f, 0x6f, 0x6e, 0x65, 0x6f, 0x66, 0x12, 0x1d, 0x2e, 0x67,
+	0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x4f,
+	0x6e, 0x65, 0x6f, 0x66, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0xd3, 0x86, 0x03, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x6f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x2e, 0x53, 0x65,
+	0x6e, 0x73, 0x69, 0x74, 0x69, 0x76, 0x65, 0x52, 0x0e, 0x73, 0x65, 0x6e, 0x73, 0x69, 0x74, 0x69,
+	0x76, 0x65, 0x4f, 0x6e, 0x65, 0x6f, 0x66, 0x42, 0x80, 0x01, 0x0a, 0x0b, 0x63, 0x6f, 0x6d, 0x2e,
+	0x6f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x42, 0x0f, 0x4c, 0x6f, 0x67, 0x4f, 0x70, 0x74, 0x69,
+	0x6f, 0x6e, 0x73, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x50, 0x01, 0x5a, 0x24, 0x67, 0x69, 0x74, 0x68,
+	0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x61, 0x63, 0x68, 0x75, 0x61, 0x6c, 0x61, 0x2f, 0x67,
+	0x6f, 0x73, 0x76, 0x63, 0x65, 0x78, 0x74, 0x6e, 0x2f, 0x6f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73,
+	0xa2, 0x02, 0x03, 0x4f, 0x58, 0x58, 0xaa, 0x02, 0x07, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73,
+	0xca, 0x02, 0x07, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0xe2, 0x02, 0x13, 0x4f, 0x70, 0x74,
+	0x69, 0x6f, 0x6e, 0x73, 0x5c, 0x47, 0x50, 0x42, 0x4d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61,
+	0xea, 0x02, 0x07, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x33,
 }
 
 var (
@@ -211,19 +380,27 @@ func file_options_log_options_proto_rawDescGZIP() []byte {
 	return file_options_log_options_proto_rawDescData
 }
 
-var file_options_log_options_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_options_log_options_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
 var file_options_log_options_proto_goTypes = []any{
-	(*Sensitive)(nil),                 // 0: options.Sensitive
-	(*descriptorpb.FieldOptions)(nil), // 1: google.protobuf.FieldOptions
+	(*Sensitive)(nil),                   // 0: options.Sensitive
+	(*Masking)(nil),                     // 1: options.Masking
+	(*descriptorpb.FieldOptions)(nil),   // 2: google.protobuf.FieldOptions
+	(*descriptorpb.MessageOptions)(nil), // 3: google.protobuf.MessageOptions
+	(*descriptorpb.OneofOptions)(nil),   // 4: google.protobuf.OneofOptions
 }
 var file_options_log_options_proto_depIdxs = []int32{
-	1, // 0: options.sensitive:extendee -> google.protobuf.FieldOptions
-	0, // 1: options.sensitive:type_name -> options.Sensitive
-	2, // [2:2] is the sub-list for method output_type
-	2, // [2:2] is the sub-list for method input_type
-	1, // [1:2] is the sub-list for extension type_name
-	0, // [0:1] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	1, // 0: options.Sensitive.masking:type_name -> options.Masking
+	2, // 1: options.sensitive:extendee -> google.protobuf.FieldOptions
+	3, // 2: options.sensitive_message:extendee -> google.protobuf.MessageOptions
+	4, // 3: options.sensitive_oneof:extendee -> google.protobuf.OneofOptions
+	0, // 4: options.sensitive:type_name -> options.Sensitive
+	0, // 5: options.sensitive_message:type_name -> options.Sensitive
+	0, // 6: options.sensitive_oneof:type_name -> options.Sensitive
+	7, // [7:7] is the sub-list for method output_type
+	7, // [7:7] is the sub-list for method input_type
+	4, // [4:7] is the sub-list for extension type_name
+	1, // [1:4] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
 }
 
 func init() { file_options_log_options_proto_init() }
@@ -242,8 +419,8 @@ func file_options_log_options_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_options_log_options_proto_rawDesc,
 			NumEnums:      0,
-			NumMessages:   1,
-			NumExtensions: 1,
+			NumMessages:   2,
+			NumExtensions: 3,
 			NumServices:   0,
 		},
 		GoTypes:           file_options_log_options_proto_goTypes,
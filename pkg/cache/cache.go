@@ -22,6 +22,33 @@ type Cache interface {
 	SetWithTTL(ctx context.Context, key string, value string, ttl time.Duration) error
 }
 
+// Counter is implemented by caches which support atomic counters.
+type Counter interface {
+	// Increments the counter for the given key and returns the new value.
+	// The TTL is applied when the counter is created and is not extended
+	// by later increments.
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+}
+
+// Locker is implemented by caches which can set a key only when it is absent,
+// e.g. to claim a lock or to detect duplicates.
+type Locker interface {
+	// Sets the value for the given key with a TTL unless the key exists.
+	// It returns true when the value was set.
+	SetNX(ctx context.Context, key string, value string, ttl time.Duration) (bool, error)
+	// Deletes the key when it holds the value, atomically, e.g. to release a
+	// lock claimed with SetNX without releasing the lock of another owner
+	// once the TTL expired. It returns true when the key was deleted.
+	Unlock(ctx context.Context, key string, value string) (bool, error)
+}
+
+var (
+	_ Counter = (*LocalCacheRistretto)(nil)
+	_ Counter = (*RemoteCacheValkey)(nil)
+	_ Locker  = (*LocalCacheRistretto)(nil)
+	_ Locker  = (*RemoteCacheValkey)(nil)
+)
+
 // CacheConfig is the configuration for the cache.
 type CacheConfig struct {
 	// local/remote, default is local
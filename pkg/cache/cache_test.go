@@ -81,3 +81,80 @@ func TestRemoteCache(t *testing.T) {
 	_, ok = remoteCache.Get(ctx, key)
 	assert.False(t, ok)
 }
+
+func TestLocalCacheCounter(t *testing.T) {
+	c, err, cleanup := cache.NewLocalCacheRistretto(&cache.CacheConfig{Mode: "local"})
+	assert.NoError(t, err)
+	defer cleanup()
+
+	ctx := context.Background()
+	for i := int64(1); i <= 3; i++ {
+		n, err := c.Incr(ctx, "counter", 50*time.Millisecond)
+		assert.NoError(t, err)
+		assert.Equal(t, i, n)
+	}
+	time.Sleep(60 * time.Millisecond)
+	n, err := c.Incr(ctx, "counter", 50*time.Millisecond)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+}
+
+func TestLocalCacheSetNX(t *testing.T) {
+	c, err, cleanup := cache.NewLocalCacheRistretto(&cache.CacheConfig{Mode: "local"})
+	assert.NoError(t, err)
+	defer cleanup()
+
+	ctx := context.Background()
+	ok, err := c.SetNX(ctx, "lock", "owner1", 50*time.Millisecond)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = c.SetNX(ctx, "lock", "owner2", 50*time.Millisecond)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	value, found := c.Get(ctx, "lock")
+	assert.True(t, found)
+	assert.Equal(t, "owner1", value)
+
+	assert.NoError(t, c.Delete(ctx, "lock"))
+	ok, err = c.SetNX(ctx, "lock", "owner2", 50*time.Millisecond)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	time.Sleep(60 * time.Millisecond)
+	ok, err = c.SetNX(ctx, "lock", "owner3", 50*time.Millisecond)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestLocalCacheUnlock(t *testing.T) {
+	c, err, cleanup := cache.NewLocalCacheRistretto(&cache.CacheConfig{Mode: "local"})
+	assert.NoError(t, err)
+	defer cleanup()
+
+	ctx := context.Background()
+	ok, err := c.SetNX(ctx, "lock", "owner1", 50*time.Millisecond)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = c.Unlock(ctx, "lock", "owner2")
+	assert.NoError(t, err)
+	assert.False(t, ok, "released the lock of another owner")
+	ok, err = c.Unlock(ctx, "lock", "owner1")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	_, found := c.Get(ctx, "lock")
+	assert.False(t, found)
+
+	// the expired lock of owner2 is not released once owner3 claimed it
+	ok, err = c.SetNX(ctx, "lock", "owner2", 20*time.Millisecond)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	time.Sleep(30 * time.Millisecond)
+	ok, err = c.SetNX(ctx, "lock", "owner3", time.Second)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = c.Unlock(ctx, "lock", "owner2")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	value, found := c.Get(ctx, "lock")
+	assert.True(t, found)
+	assert.Equal(t, "owner3", value)
+}
@@ -2,6 +2,7 @@ package cache
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/dgraph-io/ristretto"
@@ -12,6 +13,22 @@ import (
 type LocalCacheRistretto struct {
 	cache *ristretto.Cache
 	ttl   time.Duration
+	// counters and locks are kept outside of ristretto as its writes are
+	// buffered
+	counterMu sync.Mutex
+	counters  map[string]*localCounter
+	incrs     uint64
+	locks     map[string]*localLock
+}
+
+type localLock struct {
+	value     string
+	expiresAt time.Time
+}
+
+type localCounter struct {
+	value     int64
+	expiresAt time.Time
 }
 
 // NewLocalCacheRistretto creates a new instance of LocalCacheRistretto.
@@ -28,12 +45,15 @@ func NewLocalCacheRistretto(cacheCfg *CacheConfig) (*LocalCacheRistretto, error,
 	cleanup := func() {
 		cache.Close()
 	}
-	return &LocalCacheRistretto{cache: cache, ttl: cacheCfg.DefaultTTL}, nil, cleanup
+	return &LocalCacheRistretto{cache: cache, ttl: cacheCfg.DefaultTTL, counters: make(map[string]*localCounter), locks: make(map[string]*localLock)}, nil, cleanup
 }
 
 // Get retrieves a value from the cache for the given key.
 // It returns the value and a boolean indicating whether the key was found.
 func (c *LocalCacheRistretto) Get(ctx context.Context, key string) (string, bool) {
+	if v, found := c.getLock(key); found {
+		return v, true
+	}
 	v, found := c.cache.Get(key)
 	if !found {
 		return "", false
@@ -48,24 +68,141 @@ func (c *LocalCacheRistretto) Set(ctx context.Context, key string, value string)
 		return c.SetWithTTL(ctx, key, value, c.ttl)
 	}
 	c.cache.Set(key, value, 1) // Assuming the cost is 1 for simplicity.
+	c.releaseLock(key)
 	return nil
 }
 
 // SetWithTTL stores a value in the cache for the given key with a specified TTL.
 func (c *LocalCacheRistretto) SetWithTTL(ctx context.Context, key string, value string, ttl time.Duration) error {
 	c.cache.SetWithTTL(key, value, 1, ttl) // Assuming the cost is 1 for simplicity.
+	c.releaseLock(key)
 	return nil
 }
 
 // Expire removes the key from the cache.
 // Note: Ristretto doesn't support updating TTL, so we simply delete the key.
 func (c *LocalCacheRistretto) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	c.deleteLock(key)
 	c.cache.Del(key)
 	return nil
 }
 
 // Delete removes the key from the cache.
 func (c *LocalCacheRistretto) Delete(ctx context.Context, key string) error {
+	c.deleteLock(key)
 	c.cache.Del(key)
 	return nil
 }
+
+// Incr increments the counter for the given key and returns the new value.
+func (c *LocalCacheRistretto) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	now := time.Now()
+	c.counterMu.Lock()
+	defer c.counterMu.Unlock()
+
+	c.purge(now)
+
+	counter, ok := c.counters[key]
+	if !ok || (!counter.expiresAt.IsZero() && !now.Before(counter.expiresAt)) {
+		counter = &localCounter{}
+		if ttl > 0 {
+			counter.expiresAt = now.Add(ttl)
+		}
+		c.counters[key] = counter
+	}
+	counter.value++
+	return counter.value, nil
+}
+
+// SetNX sets the value for the given key with a TTL unless the key exists.
+// The value is held outside of ristretto until it expires or is deleted, so
+// that a concurrent SetNX sees it immediately.
+func (c *LocalCacheRistretto) SetNX(ctx context.Context, key string, value string, ttl time.Duration) (bool, error) {
+	if _, found := c.Get(ctx, key); found {
+		return false, nil
+	}
+	now := time.Now()
+	c.counterMu.Lock()
+	defer c.counterMu.Unlock()
+	c.purge(now)
+	if lock, ok := c.locks[key]; ok && (lock.expiresAt.IsZero() || now.Before(lock.expiresAt)) {
+		return false, nil
+	}
+	lock := &localLock{value: value}
+	if ttl > 0 {
+		lock.expiresAt = now.Add(ttl)
+	}
+	c.locks[key] = lock
+	return true, nil
+}
+
+// Unlock deletes the key when it holds the value, the values of SetNX are
+// compared and deleted under the lock of the counters.
+func (c *LocalCacheRistretto) Unlock(ctx context.Context, key string, value string) (bool, error) {
+	c.counterMu.Lock()
+	defer c.counterMu.Unlock()
+	if lock, ok := c.locks[key]; ok {
+		if lock.value != value || (!lock.expiresAt.IsZero() && !time.Now().Before(lock.expiresAt)) {
+			return false, nil
+		}
+		delete(c.locks, key)
+		c.cache.Del(key)
+		return true, nil
+	}
+	if v, found := c.cache.Get(key); !found || v != value {
+		return false, nil
+	}
+	c.cache.Del(key)
+	return true, nil
+}
+
+// purge removes the expired counters and locks from time to time, the caller
+// holds counterMu.
+func (c *LocalCacheRistretto) purge(now time.Time) {
+	c.incrs++
+	if c.incrs%1024 != 0 {
+		return
+	}
+	for k, v := range c.counters {
+		if !v.expiresAt.IsZero() && !now.Before(v.expiresAt) {
+			delete(c.counters, k)
+		}
+	}
+	for k, v := range c.locks {
+		if !v.expiresAt.IsZero() && !now.Before(v.expiresAt) {
+			delete(c.locks, k)
+		}
+	}
+}
+
+func (c *LocalCacheRistretto) getLock(key string) (string, bool) {
+	c.counterMu.Lock()
+	defer c.counterMu.Unlock()
+	lock, ok := c.locks[key]
+	if !ok {
+		return "", false
+	}
+	if !lock.expiresAt.IsZero() && !time.Now().Before(lock.expiresAt) {
+		delete(c.locks, key)
+		return "", false
+	}
+	return lock.value, true
+}
+
+// releaseLock replaces the value set by SetNX once the buffered write of the
+// new value is visible, so that the key is never seen as absent.
+func (c *LocalCacheRistretto) releaseLock(key string) {
+	c.counterMu.Lock()
+	_, ok := c.locks[key]
+	c.counterMu.Unlock()
+	if ok {
+		c.cache.Wait()
+		c.deleteLock(key)
+	}
+}
+
+func (c *LocalCacheRistretto) deleteLock(key string) {
+	c.counterMu.Lock()
+	defer c.counterMu.Unlock()
+	delete(c.locks, key)
+}
@@ -9,6 +9,10 @@ import (
 )
 
 var (
+	// unlockScript deletes the key only when it holds the value, in a
+	// single round trip so that no other owner claims it in between.
+	unlockScript = valkey.NewLuaScript(`if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) else return 0 end`)
+
 	vkClientOnce sync.Once
 	vkClient     valkey.Client
 	vkClientErr  error
@@ -91,3 +95,48 @@ func (c *RemoteCacheValkey) Delete(ctx context.Context, key string) error {
 	cmd := vkClient.B().Del().Key(c.makeKey(key)).Build()
 	return vkClient.Do(ctx, cmd).Error()
 }
+
+// Incr increments the counter for the given key and returns the new value.
+// The expiry is only set when the key has none, so that the counter window is
+// not extended by later increments.
+func (c *RemoteCacheValkey) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	k := c.makeKey(key)
+	cmds := valkey.Commands{vkClient.B().Incr().Key(k).Build()}
+	if ttl > 0 {
+		// PEXPIRE keeps the sub-second windows, EXPIRE 0 would delete the counter
+		cmds = append(cmds, vkClient.B().Pexpire().Key(k).Milliseconds(max(ttl, time.Millisecond).Milliseconds()).Nx().Build())
+	}
+	results := vkClient.DoMulti(ctx, cmds...)
+	for _, r := range results[1:] {
+		if err := r.Error(); err != nil {
+			return 0, err
+		}
+	}
+	return results[0].AsInt64()
+}
+
+// SetNX sets the value for the given key with a TTL unless the key exists.
+// A zero TTL sets the key without expiry.
+func (c *RemoteCacheValkey) SetNX(ctx context.Context, key string, value string, ttl time.Duration) (bool, error) {
+	set := vkClient.B().Set().Key(c.makeKey(key)).Value(value).Nx()
+	cmd := set.Build()
+	if ttl > 0 {
+		// PX keeps the sub-second TTLs, which EX rounds down to an invalid 0
+		cmd = set.Px(max(ttl, time.Millisecond)).Build()
+	}
+	err := vkClient.Do(ctx, cmd).Error()
+	if valkey.IsValkeyNil(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Unlock deletes the key when it holds the value, with a Lua script comparing
+// and deleting it atomically.
+func (c *RemoteCacheValkey) Unlock(ctx context.Context, key string, value string) (bool, error) {
+	deleted, err := unlockScript.Exec(ctx, vkClient, []string{c.makeKey(key)}, []string{value}).AsInt64()
+	if err != nil {
+		return false, err
+	}
+	return deleted == 1, nil
+}
@@ -0,0 +1,43 @@
+package crypto
+
+import "context"
+
+// SandboxHeader is the signed header flagging test traffic, e.g. sandbox=true.
+const SandboxHeader = "sandbox"
+
+type accessKeyContextKey struct{}
+
+type sandboxContextKey struct{}
+
+// NewAccessKeyContext returns a context carrying the verified access key. The
+// secrets are removed so that they do not leak to the handlers.
+func NewAccessKeyContext(ctx context.Context, key *APIAccessKey) context.Context {
+	redacted := *key
+	redacted.Secret = ""
+	redacted.Secrets = nil
+	return context.WithValue(ctx, accessKeyContextKey{}, &redacted)
+}
+
+// AccessKeyFromContext returns the access key of the verified request, as set
+// by the signature verification middleware.
+func AccessKeyFromContext(ctx context.Context) (*APIAccessKey, bool) {
+	key, ok := ctx.Value(accessKeyContextKey{}).(*APIAccessKey)
+	return key, ok
+}
+
+// IsSandboxFlag reports whether the value of the sandbox signed header enables
+// the sandbox.
+func IsSandboxFlag(v string) bool {
+	return v == "true" || v == "1"
+}
+
+// NewSandboxContext returns a context marking the request as test traffic.
+func NewSandboxContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sandboxContextKey{}, true)
+}
+
+// IsSandbox reports whether the request is test traffic.
+func IsSandbox(ctx context.Context) bool {
+	sandbox, _ := ctx.Value(sandboxContextKey{}).(bool)
+	return sandbox
+}
@@ -0,0 +1,149 @@
+package crypto
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultRotationOverlap is how long the previous secret stays valid after a rotation.
+const DefaultRotationOverlap = 24 * time.Hour
+
+// MultiSecretProvider is implemented by secret providers which can return
+// several valid secrets for an access key, e.g. during a rotation.
+type MultiSecretProvider interface {
+	// GetAccessSecrets returns the valid secrets of the access key, newest first.
+	GetAccessSecrets(accessKeyId string) ([]string, error)
+}
+
+// APIAccessKeySecret is a version of an access key secret as stored in the
+// api_access_key_secrets table.
+type APIAccessKeySecret struct {
+	KeyId     string     `gorm:"column:key_id;primaryKey"`
+	Version   int        `gorm:"column:version;primaryKey"`
+	Secret    string     `gorm:"column:secret"`
+	CreatedAt time.Time  `gorm:"column:created_at"`
+	ExpiresAt *time.Time `gorm:"column:expires_at"`
+}
+
+func (APIAccessKeySecret) TableName() string {
+	return "api_access_key_secrets"
+}
+
+// IsExpiredAt returns true if the secret version has expired at the given time.
+func (s *APIAccessKeySecret) IsExpiredAt(t time.Time) bool {
+	return s.ExpiresAt != nil && !t.Before(*s.ExpiresAt)
+}
+
+// ActiveSecrets returns the secrets which have not expired at the given time,
+// newest version first.
+func (k *APIAccessKey) ActiveSecrets(t time.Time) []string {
+	versions := k.ActiveSecretVersions(t)
+	secrets := make([]string, len(versions))
+	for i, s := range versions {
+		secrets[i] = s.Secret
+	}
+	return secrets
+}
+
+// ActiveSecretVersions returns the secret versions which have not expired at
+// the given time, newest first. Keys which have never been rotated have no
+// versions and only the secret column is returned, as version 0.
+func (k *APIAccessKey) ActiveSecretVersions(t time.Time) []APIAccessKeySecret {
+	if k == nil {
+		return nil
+	}
+	if len(k.Secrets) == 0 {
+		if k.Secret == "" {
+			return nil
+		}
+		return []APIAccessKeySecret{{KeyId: k.KeyId, Secret: k.Secret}}
+	}
+
+	versions := make([]APIAccessKeySecret, 0, len(k.Secrets))
+	for _, s := range k.Secrets {
+		if s.Secret != "" && !s.IsExpiredAt(t) {
+			versions = append(versions, s)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version > versions[j].Version })
+	return versions
+}
+
+// GetAccessSecrets returns all the non expired secret versions of the access key.
+func (p *DbAccessSecretProvider) GetAccessSecrets(accessKeyId string) ([]string, error) {
+	key, err := p.GetAccessKey(accessKeyId)
+	if err != nil {
+		return nil, err
+	}
+	return key.ActiveSecrets(time.Now()), nil
+}
+
+// RotateAccessKey generates a new secret for the access key. The previous
+// secrets remain valid for the rotation overlap so that clients can switch to
+// the new secret without downtime. The secret versions are stored in the
+// api_access_key_secrets table, see MigrateAccessKeys.
+func (p *DbAccessSecretProvider) RotateAccessKey(ctx context.Context, keyId string) (*APIAccessKeySecret, error) {
+	secret, err := GenerateAccessSecret()
+	if err != nil {
+		return nil, err
+	}
+	overlap := p.RotationOverlap
+	if overlap <= 0 {
+		overlap = DefaultRotationOverlap
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(overlap)
+	rotated := &APIAccessKeySecret{KeyId: keyId, Secret: secret, CreatedAt: now}
+	err = p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var key APIAccessKey
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Secrets").
+			Where("key_id = ?", keyId).Take(&key).Error; err != nil {
+			return err
+		}
+
+		latest := 0
+		for _, s := range key.Secrets {
+			latest = max(latest, s.Version)
+		}
+		if len(key.Secrets) == 0 && key.Secret != "" {
+			// keep the legacy secret valid during the overlap
+			latest = 1
+			legacy := &APIAccessKeySecret{KeyId: keyId, Version: latest, Secret: key.Secret, CreatedAt: now, ExpiresAt: &expiresAt}
+			if err := tx.Create(legacy).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&APIAccessKeySecret{}).
+			Where("key_id = ? AND (expires_at IS NULL OR expires_at > ?)", keyId, expiresAt).
+			Update("expires_at", expiresAt).Error; err != nil {
+			return err
+		}
+
+		rotated.Version = latest + 1
+		if err := tx.Create(rotated).Error; err != nil {
+			return err
+		}
+		// the secret column always holds the current secret for v1 readers
+		return tx.Model(&APIAccessKey{}).Where("key_id = ?", keyId).Update("secret", secret).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rotated, nil
+}
+
+// GenerateAccessSecret returns a new 256 bit hex encoded access secret.
+func GenerateAccessSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,106 @@
+package crypto
+
+import (
+	stdcrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"strings"
+)
+
+// Asymmetric signature algorithms. The client signs CanonicalStringToSign with
+// its private key and the server verifies it with the registered public key,
+// so no shared secret has to be distributed to partners.
+const (
+	SignatureAlgorithmEd25519   = "ED25519"
+	SignatureAlgorithmEcdsaP256 = "ECDSA-P256-SHA256"
+)
+
+var ErrInvalidPublicKey = errors.New("INVALID_PUBLIC_KEY")
+
+// SignCanonicalRequest signs the canonical request with an Ed25519 or ECDSA
+// P-256 private key and returns the hex encoded signature for the signature
+// token of the Authorization header.
+func SignCanonicalRequest(privateKey stdcrypto.Signer, payload string, headers map[string]string, req *CanonicalRequest, signedHeaders []string) (string, error) {
+	var algorithm string
+	switch k := privateKey.(type) {
+	case ed25519.PrivateKey:
+		algorithm = SignatureAlgorithmEd25519
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return "", ErrUnsupportedSignatureAlgorithm
+		}
+		algorithm = SignatureAlgorithmEcdsaP256
+	default:
+		return "", ErrUnsupportedSignatureAlgorithm
+	}
+
+	stringToSign := CanonicalStringToSign(algorithm, payload, headers, req, signedHeaders)
+	var (
+		signature []byte
+		err       error
+	)
+	if algorithm == SignatureAlgorithmEd25519 {
+		signature, err = privateKey.Sign(rand.Reader, []byte(stringToSign), stdcrypto.Hash(0))
+	} else {
+		digest := sha256.Sum256([]byte(stringToSign))
+		signature, err = privateKey.Sign(rand.Reader, digest[:], stdcrypto.SHA256)
+	}
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(signature), nil
+}
+
+// ParsePublicKey parses a PEM encoded PKIX public key, or a base64 encoded raw
+// Ed25519 public key, as registered for an access key.
+func ParsePublicKey(encoded string) (stdcrypto.PublicKey, error) {
+	encoded = strings.TrimSpace(encoded)
+	if block, _ := pem.Decode([]byte(encoded)); block != nil {
+		if block.Type != "PUBLIC KEY" {
+			return nil, ErrInvalidPublicKey
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, ErrInvalidPublicKey
+		}
+		return key, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(raw) != ed25519.PublicKeySize {
+		return nil, ErrInvalidPublicKey
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// verifyAsymmetricSignature verifies the hex encoded signature of the string
+// to sign with the encoded public key. The key type must match the algorithm.
+func verifyAsymmetricSignature(algorithm, encodedPublicKey, stringToSign, signature string) bool {
+	sig, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	key, err := ParsePublicKey(encodedPublicKey)
+	if err != nil {
+		return false
+	}
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		return algorithm == SignatureAlgorithmEd25519 && ed25519.Verify(k, []byte(stringToSign), sig)
+	case *ecdsa.PublicKey:
+		if algorithm != SignatureAlgorithmEcdsaP256 || k.Curve != elliptic.P256() {
+			return false
+		}
+		digest := sha256.Sum256([]byte(stringToSign))
+		return ecdsa.VerifyASN1(k, digest[:], sig)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,191 @@
+package crypto
+
+import (
+	"errors"
+	"strings"
+)
+
+// Limits of the signature headers, longer headers are rejected before parsing.
+const (
+	MaxSignatureHeaderLength = 4096
+	MaxSignedHeadersLength   = 4096
+	maxAccessKeyIdLength     = 128
+	maxHeaderFields          = 32
+)
+
+var (
+	ErrMalformedSignatureHeader = errors.New("MALFORMED_SIGNATURE_HEADER")
+	ErrMalformedSignedHeaders   = errors.New("MALFORMED_SIGNED_HEADERS")
+)
+
+// ParseSignatureHeader parses the Authorization header of a signed request.
+// format: creds=access-key:<access key id>[\n<key>:<value>...]/signature=<signature>[/alg=<algorithm>][/hdrs=<name>;<name>...]
+//
+// The grammar is strict: every token must appear at most once, unknown tokens
+// are rejected, the access key id is limited to [A-Za-z0-9._-] and the
+// signature must be lower case hex of the length produced by the algorithm.
+func ParseSignatureHeader(tokenHeader string) (*SignatureHeader, error) {
+	if len(tokenHeader) > MaxSignatureHeaderLength {
+		return nil, ErrMalformedSignatureHeader
+	}
+	tokens, err := parseFields(tokenHeader, "/", "=", true)
+	if err != nil {
+		return nil, ErrMalformedSignatureHeader
+	}
+	for name := range tokens {
+		switch name {
+		case "creds", "signature", "alg", "hdrs":
+		default:
+			return nil, ErrMalformedSignatureHeader
+		}
+	}
+
+	var credentials map[string]string
+	if creds, ok := tokens["creds"]; ok {
+		if credentials, err = parseFields(creds, "\n", ":", false); err != nil {
+			return nil, ErrMalformedSignatureHeader
+		}
+	}
+
+	header := &SignatureHeader{
+		AccessKeyId: credentials["access-key"],
+		Signature:   tokens["signature"],
+		Algorithm:   tokens["alg"],
+		Credentials: credentials,
+	}
+	if header.AccessKeyId == "" {
+		return nil, ErrMissingAccessKey
+	}
+	if header.Signature == "" {
+		return nil, ErrMissingSignature
+	}
+	if !isAccessKeyId(header.AccessKeyId) {
+		return nil, ErrMalformedSignatureHeader
+	}
+	if header.Algorithm == "" {
+		header.Algorithm = SignatureAlgorithmV1
+	}
+	if !isValidSignature(header.Algorithm, header.Signature) {
+		return nil, ErrMalformedSignatureHeader
+	}
+	if hdrs, ok := tokens["hdrs"]; ok {
+		names := strings.Split(hdrs, ";")
+		if len(names) > maxHeaderFields {
+			return nil, ErrMalformedSignatureHeader
+		}
+		seen := make(map[string]struct{}, len(names))
+		for _, name := range names {
+			lower := strings.ToLower(name)
+			if _, dup := seen[lower]; dup || !isFieldName(name) {
+				return nil, ErrMalformedSignatureHeader
+			}
+			seen[lower] = struct{}{}
+		}
+		header.SignedHeaders = names
+	}
+	return header, nil
+}
+
+// ParseSignedHeaders parses the signed headers of a request.
+// format: ts=<timestamp>/api=<api name>/ver=<api version>[/<key>=<value>...]
+//
+// ts, api and ver are required and every key must appear at most once.
+func ParseSignedHeaders(securityHeader string) (map[string]string, error) {
+	if len(securityHeader) > MaxSignedHeadersLength {
+		return nil, ErrMalformedSignedHeaders
+	}
+	headers, err := parseFields(securityHeader, "/", "=", false)
+	if err != nil {
+		return nil, ErrMalformedSignedHeaders
+	}
+	for _, required := range []string{"ts", "api", "ver"} {
+		if headers[required] == "" {
+			return nil, ErrMalformedSignedHeaders
+		}
+	}
+	return headers, nil
+}
+
+// parseFields splits s into at most maxHeaderFields key value pairs. Keys must
+// be field names and unique, values must not contain control characters other
+// than line feeds when allowNewline is set.
+func parseFields(s, pairSep, kvSep string, allowNewline bool) (map[string]string, error) {
+	pairs := strings.Split(s, pairSep)
+	if len(pairs) > maxHeaderFields {
+		return nil, errors.New("too many fields")
+	}
+	result := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, kvSep)
+		if !ok || !isFieldName(key) {
+			return nil, errors.New("malformed field")
+		}
+		if _, dup := result[key]; dup {
+			return nil, errors.New("duplicate field")
+		}
+		for i := 0; i < len(value); i++ {
+			c := value[i]
+			if (c < 0x20 && !(allowNewline && c == '\n')) || c == 0x7f {
+				return nil, errors.New("control character in field")
+			}
+		}
+		result[key] = value
+	}
+	return result, nil
+}
+
+// isFieldName reports whether s is a non empty token of letters, digits and dashes.
+func isFieldName(s string) bool {
+	if s == "" || len(s) > 64 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+func isAccessKeyId(s string) bool {
+	if len(s) > maxAccessKeyIdLength {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// isValidSignature checks the signature is lower case hex of the length
+// produced by the algorithm.
+func isValidSignature(algorithm, signature string) bool {
+	switch algorithm {
+	case SignatureAlgorithmV1, SignatureAlgorithmV2:
+		if len(signature) != 64 {
+			return false
+		}
+	case SignatureAlgorithmEd25519:
+		if len(signature) != 128 {
+			return false
+		}
+	case SignatureAlgorithmEcdsaP256:
+		// ASN.1 DER encoded, at most 72 bytes
+		if len(signature) < 16 || len(signature) > 144 || len(signature)%2 != 0 {
+			return false
+		}
+	default:
+		return false
+	}
+	for i := 0; i < len(signature); i++ {
+		c := signature[i]
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,141 @@
+package crypto
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testSignature = strings.Repeat("ab", 32)
+
+func TestParseSignatureHeaderStrict(t *testing.T) {
+	sh, err := ParseSignatureHeader("creds=access-key:AK1\nrole:partner/signature=" + testSignature + "/alg=HMAC-SHA256-V2/hdrs=content-type;host")
+	require.NoError(t, err)
+	assert.Equal(t, "AK1", sh.AccessKeyId)
+	assert.Equal(t, "partner", sh.Credentials["role"])
+	assert.Equal(t, []string{"content-type", "host"}, sh.SignedHeaders)
+
+	for name, header := range map[string]string{
+		"too long":             "creds=access-key:AK1/signature=" + testSignature + "/alg=" + strings.Repeat("x", MaxSignatureHeaderLength),
+		"duplicate token":      "creds=access-key:AK1/signature=" + testSignature + "/signature=" + testSignature,
+		"duplicate credential": "creds=access-key:AK1\naccess-key:AK2/signature=" + testSignature,
+		"unknown token":        "creds=access-key:AK1/signature=" + testSignature + "/extra=1",
+		"empty token":          "creds=access-key:AK1//signature=" + testSignature,
+		"token without value":  "creds=access-key:AK1/signature",
+		"unknown algorithm":    "creds=access-key:AK1/signature=" + testSignature + "/alg=MD5",
+		"upper case signature": "creds=access-key:AK1/signature=" + strings.ToUpper(testSignature),
+		"short signature":      "creds=access-key:AK1/signature=" + testSignature[:62],
+		"non hex signature":    "creds=access-key:AK1/signature=" + strings.Repeat("zz", 32),
+		"ed25519 length":       "creds=access-key:AK1/signature=" + testSignature + "/alg=ED25519",
+		"access key charset":   "creds=access-key:AK 1/signature=" + testSignature,
+		"access key length":    "creds=access-key:" + strings.Repeat("a", 129) + "/signature=" + testSignature,
+		"control character":    "creds=access-key:AK1\nrole:a\x00b/signature=" + testSignature,
+		"newline in signature": "creds=access-key:AK1/signature=" + testSignature + "\n",
+		"duplicate hdrs":       "creds=access-key:AK1/signature=" + testSignature + "/hdrs=host;Host",
+		"empty hdrs name":      "creds=access-key:AK1/signature=" + testSignature + "/hdrs=host;",
+	} {
+		_, err := ParseSignatureHeader(header)
+		assert.ErrorIs(t, err, ErrMalformedSignatureHeader, name)
+	}
+}
+
+func TestParseSignedHeadersStrict(t *testing.T) {
+	headers, err := ParseSignedHeaders("ts=20240101T000000Z/api=payments/ver=v1/chnl=web")
+	require.NoError(t, err)
+	assert.Equal(t, "web", headers["chnl"])
+
+	for name, header := range map[string]string{
+		"missing ts":        "api=payments/ver=v1",
+		"missing api":       "ts=20240101T000000Z/ver=v1",
+		"duplicate key":     "ts=20240101T000000Z/api=payments/ver=v1/api=refunds",
+		"control character": "ts=20240101T000000Z/api=pay\nments/ver=v1",
+		"empty field":       "ts=20240101T000000Z//api=payments/ver=v1",
+		"too many fields":   "ts=1/api=a/ver=v" + strings.Repeat("/k=v", maxHeaderFields),
+		"too long":          "ts=1/api=a/ver=" + strings.Repeat("v", MaxSignedHeadersLength),
+	} {
+		_, err := ParseSignedHeaders(header)
+		assert.ErrorIs(t, err, ErrMalformedSignedHeaders, name)
+	}
+}
+
+func TestVerifySignatureRejectsTampering(t *testing.T) {
+	provider := staticSecretProvider{"AK1": "secret1"}
+	securityHeader := "ts=20240101T000000Z/api=payments/ver=v1/chnl=web/usrid=u1"
+	payload := `{"amount":100}`
+	signature := ComputeSignature("secret1", payload, mustParseSignedHeaders(t, securityHeader))
+
+	// every signed header takes part in the signature
+	for _, tampered := range []string{
+		"ts=20240101T000001Z/api=payments/ver=v1/chnl=web/usrid=u1",
+		"ts=20240101T000000Z/api=refunds/ver=v1/chnl=web/usrid=u1",
+		"ts=20240101T000000Z/api=payments/ver=v2/chnl=web/usrid=u1",
+		"ts=20240101T000000Z/api=payments/ver=v1/chnl=app/usrid=u1",
+		"ts=20240101T000000Z/api=payments/ver=v1/chnl=web/usrid=u2",
+	} {
+		err := VerifySignature("creds=access-key:AK1/signature="+signature, tampered, payload, provider)
+		assert.ErrorIs(t, err, ErrSignatureMismatch, tampered)
+	}
+
+	// flipping any signature character is detected
+	for i := 0; i < len(signature); i++ {
+		b := []byte(signature)
+		if b[i] == '0' {
+			b[i] = '1'
+		} else {
+			b[i] = '0'
+		}
+		err := VerifySignature("creds=access-key:AK1/signature="+string(b), securityHeader, payload, provider)
+		assert.ErrorIs(t, err, ErrSignatureMismatch)
+	}
+
+	// unknown keys have no secret and never verify
+	err := VerifySignature("creds=access-key:AK2/signature="+signature, securityHeader, payload, provider)
+	assert.ErrorIs(t, err, ErrSignatureMismatch)
+}
+
+func FuzzParseSignatureHeader(f *testing.F) {
+	f.Add("creds=access-key:AK1/signature=" + testSignature)
+	f.Add("creds=access-key:AK1\nrole:partner/signature=" + testSignature + "/alg=HMAC-SHA256-V2/hdrs=host")
+	f.Add("creds=access-key:AK1/signature=" + strings.Repeat("ab", 64) + "/alg=ED25519")
+	f.Add("creds=/signature=/")
+	f.Fuzz(func(t *testing.T, header string) {
+		sh, err := ParseSignatureHeader(header)
+		if err != nil {
+			return
+		}
+		if len(header) > MaxSignatureHeaderLength {
+			t.Fatalf("accepted header of %d bytes", len(header))
+		}
+		if !isAccessKeyId(sh.AccessKeyId) || sh.AccessKeyId == "" {
+			t.Fatalf("accepted access key id %q", sh.AccessKeyId)
+		}
+		if !isValidSignature(sh.Algorithm, sh.Signature) {
+			t.Fatalf("accepted signature %q for %s", sh.Signature, sh.Algorithm)
+		}
+		if len(sh.SignedHeaders) > maxHeaderFields {
+			t.Fatalf("accepted %d signed headers", len(sh.SignedHeaders))
+		}
+	})
+}
+
+func FuzzParseSignedHeaders(f *testing.F) {
+	f.Add("ts=20240101T000000Z/api=payments/ver=v1/chnl=web/usrid=u1")
+	f.Add("ts=1/api=a/ver=v/nonce=n")
+	f.Add("ts==/api=/ver")
+	f.Fuzz(func(t *testing.T, header string) {
+		headers, err := ParseSignedHeaders(header)
+		if err != nil {
+			return
+		}
+		if len(headers) > maxHeaderFields {
+			t.Fatalf("accepted %d fields", len(headers))
+		}
+		for k, v := range headers {
+			if !isFieldName(k) || strings.ContainsAny(v, "/\n\r\x00") {
+				t.Fatalf("accepted field %q=%q", k, v)
+			}
+		}
+	})
+}
@@ -5,11 +5,25 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
-	"strings"
+	"sync"
+	"time"
 
 	"gorm.io/gorm"
 )
 
+var (
+	ErrSignatureMismatch = errors.New("SIGNATURE_MISMATCH")
+	ErrMissingAccessKey  = errors.New("MISSING_ACCESS_KEY")
+	ErrMissingSignature  = errors.New("MISSING_SIGNATURE")
+)
+
+// Access key statuses
+const (
+	AccessKeyStatusActive   = "ACTIVE"
+	AccessKeyStatusDisabled = "DISABLED"
+	AccessKeyStatusRevoked  = "REVOKED"
+)
+
 // AccessSecretProvider is an interface for retrieving access secrets.
 // Implementations of this interface should provide a method to get an access secret
 // given an access key ID.
@@ -17,33 +31,134 @@ type AccessSecretProvider interface {
 	GetAccessSecret(accessKeyId string) (string, error)
 }
 
+// AccessKeyProvider is implemented by secret providers which also know the
+// status and validity of the access keys.
+type AccessKeyProvider interface {
+	GetAccessKey(accessKeyId string) (*APIAccessKey, error)
+}
+
+// APIAccessKey is an API access key as stored in the api_access_keys table.
+type APIAccessKey struct {
+	KeyId           string `gorm:"column:key_id;primaryKey"`
+	InstitutionId   string `gorm:"column:institution_id;index"`
+	ApplicationName string `gorm:"column:application_name"`
+	// Secret is the shared HMAC secret, or the public key of partners using
+	// the asymmetric signature algorithms.
+	Secret    string     `gorm:"column:secret"`
+	Status    string     `gorm:"column:status"`
+	ValidFrom *time.Time `gorm:"column:valid_from"`
+	ValidTo   *time.Time `gorm:"column:valid_to"`
+	CreatedAt time.Time  `gorm:"column:created_at"`
+	UpdatedAt time.Time  `gorm:"column:updated_at"`
+	// RequestsPerMinute and RequestsPerDay are the quotas of the key, zero
+	// uses the QuotaLimiter defaults.
+	RequestsPerMinute int64 `gorm:"column:requests_per_minute"`
+	RequestsPerDay    int64 `gorm:"column:requests_per_day"`
+	// TestEnabled marks a sandbox key, it is only accepted on requests
+	// carrying the sandbox flag in the signed headers.
+	TestEnabled bool `gorm:"column:test_enabled"`
+	// KeyType is the kind of secret of the key, AccessKeyTypeHmac or
+	// AccessKeyTypePublicKey, and restricts the accepted signature algorithms.
+	// Keys without a type are HMAC keys unless their secret is a PEM encoded
+	// public key, see SecretKeyType.
+	KeyType string `gorm:"column:key_type"`
+	// Secrets are the versioned secrets of the key, see RotateAccessKey.
+	Secrets []APIAccessKeySecret `gorm:"foreignKey:KeyId;references:KeyId"`
+}
+
+func (APIAccessKey) TableName() string {
+	return "api_access_keys"
+}
+
+// IsValid returns true if the key is active and within its validity period.
+func (k *APIAccessKey) IsValid() bool {
+	return k.IsValidAt(time.Now())
+}
+
+// IsValidAt returns true if the key is active and within its validity period at the given time.
+// Keys without a status are treated as active.
+func (k *APIAccessKey) IsValidAt(t time.Time) bool {
+	if len(k.ActiveSecrets(t)) == 0 {
+		return false
+	}
+	if k.Status != "" && k.Status != AccessKeyStatusActive {
+		return false
+	}
+	if k.ValidFrom != nil && t.Before(*k.ValidFrom) {
+		return false
+	}
+	if k.ValidTo != nil && !t.Before(*k.ValidTo) {
+		return false
+	}
+	return true
+}
+
+// SignatureHeader is the parsed Authorization header of a signed request.
+type SignatureHeader struct {
+	AccessKeyId string
+	Signature   string
+	// Algorithm is the signature algorithm, SignatureAlgorithmV1 when the
+	// header has no alg token.
+	Algorithm string
+	// SignedHeaders are the HTTP header names covered by a v2 signature.
+	SignedHeaders []string
+	// Credentials holds all the key value pairs of the creds token.
+	Credentials map[string]string
+}
+
+// DbAccessSecretProvider reads the access keys from the database on every
+// call, wrap it with NewCachedAccessSecretProvider to cache them.
 type DbAccessSecretProvider struct {
-	db         *gorm.DB
-	accessKeys map[string]string
+	db *gorm.DB
+	// RotationOverlap is how long previous secrets stay valid after
+	// RotateAccessKey, defaults to DefaultRotationOverlap.
+	RotationOverlap time.Duration
+
+	secretsOnce  sync.Once
+	secretsTable bool
 }
 
 func NewDbAccessSecretProvider(db *gorm.DB) *DbAccessSecretProvider {
-	return &DbAccessSecretProvider{db: db, accessKeys: make(map[string]string)}
+	return &DbAccessSecretProvider{db: db}
 }
 
-// GetAccessSecret retrieves the access secret for a given access key ID.
-// It first checks the in-memory cache, and if not found, queries the database.
-// The retrieved secret is then cached for future use.
-func (p *DbAccessSecretProvider) GetAccessSecret(accessKeyId string) (string, error) {
-	if secret, ok := p.accessKeys[accessKeyId]; ok {
-		return secret, nil
+// MigrateAccessKeys creates the api_access_keys and api_access_key_secrets
+// tables, or adds their missing columns.
+func MigrateAccessKeys(db *gorm.DB) error {
+	return db.AutoMigrate(&APIAccessKey{}, &APIAccessKeySecret{})
+}
+
+// GetAccessKey retrieves the access key with its status and validity from the database.
+// The secret versions are only read once the api_access_key_secrets table
+// exists, see MigrateAccessKeys, until then the secret column is used.
+func (p *DbAccessSecretProvider) GetAccessKey(accessKeyId string) (*APIAccessKey, error) {
+	db := p.db
+	if p.hasSecretsTable() {
+		db = db.Preload("Secrets")
 	}
+	var key APIAccessKey
+	if err := db.Where("key_id = ?", accessKeyId).Take(&key).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
 
+// hasSecretsTable reports whether the api_access_key_secrets table exists,
+// it is checked once per provider.
+func (p *DbAccessSecretProvider) hasSecretsTable() bool {
+	p.secretsOnce.Do(func() {
+		p.secretsTable = p.db.Migrator().HasTable(&APIAccessKeySecret{})
+	})
+	return p.secretsTable
+}
+
+// GetAccessSecret retrieves the current access secret for a given access key ID.
+func (p *DbAccessSecretProvider) GetAccessSecret(accessKeyId string) (string, error) {
 	var accessSecret string
 	err := p.db.Table("api_access_keys").Where("key_id = ?", accessKeyId).Pluck("secret", &accessSecret).Error
 	if err != nil {
 		return "", err
 	}
-
-	if accessSecret != "" {
-		p.accessKeys[accessKeyId] = accessSecret
-	}
-
 	return accessSecret, nil
 }
 
@@ -73,6 +188,11 @@ func GetSignatureKey(accessSecretKey, timeStamp, apiName, apiVersion string) []b
 	kDate := HmacSha256(timeStamp, kSecret)
 	kVersion := HmacSha256(apiVersion, kDate)
 	kApi := HmacSha256(apiName, kVersion)
+	// the intermediate keys are derived from the secret
+	defer clear(kSecret)
+	defer clear(kDate)
+	defer clear(kVersion)
+	defer clear(kApi)
 	return HmacSha256(TERMINATOR, kApi)
 }
 
@@ -81,7 +201,7 @@ func GetSignatureKey(accessSecretKey, timeStamp, apiName, apiVersion string) []b
 // to compute a unique signature.
 // The computed signature is then returned as a string.
 func ComputeSignature(accessSecretKey, payload string, headers map[string]string) string {
-	const ALGORITHM_KEY = "HMAC-SHA256"
+	const ALGORITHM_KEY = SignatureAlgorithmV1
 
 	timestamp := headers["ts"]
 	apiName := headers["api"]
@@ -90,6 +210,7 @@ func ComputeSignature(accessSecretKey, payload string, headers map[string]string
 	userId := headers["usrid"]
 
 	signingKey := GetSignatureKey(accessSecretKey, timestamp, apiName, apiVersion)
+	defer clear(signingKey)
 
 	payloadHash := Sha256(payload)
 
@@ -103,34 +224,45 @@ func ComputeSignature(accessSecretKey, payload string, headers map[string]string
 // VerifySignature verifies the signature of the given payload and headers.
 // It uses the access secret key, timestamp, API name, and API version
 // to compute a unique signature and compare it with the provided signature.
+// When the provider implements MultiSecretProvider every valid secret version is tried.
 func VerifySignature(tokenHeader, securityHeader, payload string, accessSecretProvider AccessSecretProvider) error {
-	tokens := splitKeyValue(tokenHeader, "/", "=")
-
-	credentials := splitKeyValue(tokens["creds"], "\n", ":")
-	accessKeyId := credentials["access-key"]
-	accessSecret, err := accessSecretProvider.GetAccessSecret(accessKeyId)
+	signatureHeader, err := ParseSignatureHeader(tokenHeader)
 	if err != nil {
 		return err
 	}
-
-	headers := splitKeyValue(securityHeader, "/", "=")
-	providedSignature := tokens["signature"]
-	computedSignature := ComputeSignature(accessSecret, payload, headers)
-	if computedSignature != providedSignature {
-		return errors.New("SIGNATURE_MISMATCH")
+	headers, err := ParseSignedHeaders(securityHeader)
+	if err != nil {
+		return err
 	}
-	return nil
+	signatureHeader.Algorithm = SignatureAlgorithmV1
+	return verifyWithSecrets(accessSecretProvider, signatureHeader, signatureMatcher(signatureHeader, headers, payload, nil, "", false))
 }
 
-// splitKeyValue splits a string into key-value pairs using the provided separators.
-func splitKeyValue(s, pairSep, kvSep string) map[string]string {
-	result := make(map[string]string)
-	pairs := strings.Split(s, pairSep)
-	for _, pair := range pairs {
-		kv := strings.SplitN(pair, kvSep, 2)
-		if len(kv) == 2 {
-			result[kv[0]] = kv[1]
+// verifyWithSecrets verifies the signature with each secret of the access key
+// until one matches.
+func verifyWithSecrets(accessSecretProvider AccessSecretProvider, signatureHeader *SignatureHeader, verify func(accessSecret string) bool) error {
+	var secrets []string
+	if mp, ok := accessSecretProvider.(MultiSecretProvider); ok {
+		s, err := mp.GetAccessSecrets(signatureHeader.AccessKeyId)
+		if err != nil {
+			return err
+		}
+		secrets = s
+	} else {
+		s, err := accessSecretProvider.GetAccessSecret(signatureHeader.AccessKeyId)
+		if err != nil {
+			return err
+		}
+		secrets = []string{s}
+	}
+
+	for _, accessSecret := range secrets {
+		if accessSecret == "" {
+			continue
+		}
+		if verify(accessSecret) {
+			return nil
 		}
 	}
-	return result
+	return ErrSignatureMismatch
 }
@@ -0,0 +1,224 @@
+package crypto
+
+import (
+	"context"
+	stdcrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type staticSecretProvider map[string]string
+
+func (p staticSecretProvider) GetAccessSecret(accessKeyId string) (string, error) {
+	return p[accessKeyId], nil
+}
+
+func mustParseSignedHeaders(t *testing.T, securityHeader string) map[string]string {
+	t.Helper()
+	headers, err := ParseSignedHeaders(securityHeader)
+	require.NoError(t, err)
+	return headers
+}
+
+func TestVerifySignature(t *testing.T) {
+	provider := staticSecretProvider{"AK1": "secret1"}
+	securityHeader := "ts=20240101T000000Z/api=payments/ver=v1/chnl=web/usrid=u1"
+	headers := mustParseSignedHeaders(t, securityHeader)
+	payload := `{"amount":100}`
+
+	signature := ComputeSignature("secret1", payload, headers)
+	authHeader := "creds=access-key:AK1/signature=" + signature
+
+	sh, err := ParseSignatureHeader(authHeader)
+	require.NoError(t, err)
+	assert.Equal(t, "AK1", sh.AccessKeyId)
+	assert.Equal(t, signature, sh.Signature)
+
+	assert.NoError(t, VerifySignature(authHeader, securityHeader, payload, provider))
+	assert.ErrorIs(t, VerifySignature(authHeader, securityHeader, `{"amount":101}`, provider), ErrSignatureMismatch)
+
+	_, err = ParseSignatureHeader("signature=" + signature)
+	assert.ErrorIs(t, err, ErrMissingAccessKey)
+	_, err = ParseSignatureHeader("creds=access-key:AK1")
+	assert.ErrorIs(t, err, ErrMissingSignature)
+}
+
+func TestAPIAccessKeyIsValid(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+
+	assert.True(t, (&APIAccessKey{KeyId: "AK1", Secret: "s"}).IsValidAt(now))
+	assert.True(t, (&APIAccessKey{KeyId: "AK1", Secret: "s", Status: AccessKeyStatusActive, ValidFrom: &past, ValidTo: &future}).IsValidAt(now))
+	assert.False(t, (&APIAccessKey{KeyId: "AK1", Secret: "s", Status: AccessKeyStatusRevoked}).IsValidAt(now))
+	assert.False(t, (&APIAccessKey{KeyId: "AK1", Secret: "s", ValidFrom: &future}).IsValidAt(now))
+	assert.False(t, (&APIAccessKey{KeyId: "AK1", Secret: "s", ValidTo: &past}).IsValidAt(now))
+	assert.False(t, (&APIAccessKey{KeyId: "AK1"}).IsValidAt(now))
+	assert.False(t, (*APIAccessKey)(nil).IsValidAt(now))
+}
+
+func TestVerifyRequestSignature(t *testing.T) {
+	provider := staticSecretProvider{"AK1": "secret1"}
+	securityHeader := "ts=20240101T000000Z/api=payments/ver=v1/chnl=web/usrid=u1"
+	headers := mustParseSignedHeaders(t, securityHeader)
+	payload := `{"amount":100}`
+	newRequest := func(target string) *CanonicalRequest {
+		r := httptest.NewRequest(http.MethodPost, target, nil)
+		r.Header.Set("Content-Type", "application/json")
+		return NewCanonicalRequest(r)
+	}
+
+	req := newRequest("/v1/payments/p%201?b=2&a=1&a=0")
+	signature := ComputeCanonicalSignature("secret1", payload, headers, req, []string{"Content-Type"})
+	authHeader := "creds=access-key:AK1/signature=" + signature + "/alg=HMAC-SHA256-V2/hdrs=content-type"
+
+	require.NoError(t, VerifyRequestSignature(authHeader, securityHeader, payload, req, provider, false))
+	// query parameter order does not matter
+	assert.NoError(t, VerifyRequestSignature(authHeader, securityHeader, payload, newRequest("/v1/payments/p%201?a=0&a=1&b=2"), provider, false))
+	assert.ErrorIs(t, VerifyRequestSignature(authHeader, securityHeader, payload, newRequest("/v1/refunds/p%201?b=2&a=1&a=0"), provider, false), ErrSignatureMismatch)
+	assert.ErrorIs(t, VerifyRequestSignature(authHeader, securityHeader, payload, newRequest("/v1/payments/p%201?b=3&a=1&a=0"), provider, false), ErrSignatureMismatch)
+	other := newRequest("/v1/payments/p%201?b=2&a=1&a=0")
+	other.Method = http.MethodPut
+	assert.ErrorIs(t, VerifyRequestSignature(authHeader, securityHeader, payload, other, provider, false), ErrSignatureMismatch)
+	other.Method = http.MethodPost
+	other.Header.Set("Content-Type", "text/plain")
+	assert.ErrorIs(t, VerifyRequestSignature(authHeader, securityHeader, payload, other, provider, false), ErrSignatureMismatch)
+
+	// v1 signatures are only accepted during migration
+	v1Header := "creds=access-key:AK1/signature=" + ComputeSignature("secret1", payload, headers)
+	assert.NoError(t, VerifyRequestSignature(v1Header, securityHeader, payload, req, provider, true))
+	assert.ErrorIs(t, VerifyRequestSignature(v1Header, securityHeader, payload, req, provider, false), ErrUnsupportedSignatureAlgorithm)
+}
+
+type versionedSecretProvider map[string][]string
+
+func (p versionedSecretProvider) GetAccessSecret(accessKeyId string) (string, error) {
+	return p[accessKeyId][0], nil
+}
+
+func (p versionedSecretProvider) GetAccessSecrets(accessKeyId string) ([]string, error) {
+	return p[accessKeyId], nil
+}
+
+func TestVerifySignatureWithRotatedSecrets(t *testing.T) {
+	securityHeader := "ts=20240101T000000Z/api=payments/ver=v1/chnl=web/usrid=u1"
+	payload := `{"amount":100}`
+	signedWith := func(secret string) string {
+		return "creds=access-key:AK1/signature=" + ComputeSignature(secret, payload, mustParseSignedHeaders(t, securityHeader))
+	}
+
+	provider := versionedSecretProvider{"AK1": {"current", "previous"}}
+	assert.NoError(t, VerifySignature(signedWith("current"), securityHeader, payload, provider))
+	assert.NoError(t, VerifySignature(signedWith("previous"), securityHeader, payload, provider))
+	assert.ErrorIs(t, VerifySignature(signedWith("expired"), securityHeader, payload, provider), ErrSignatureMismatch)
+}
+
+func TestAPIAccessKeyActiveSecrets(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Hour)
+
+	legacy := &APIAccessKey{KeyId: "AK1", Secret: "legacy"}
+	assert.Equal(t, []string{"legacy"}, legacy.ActiveSecrets(now))
+
+	rotated := &APIAccessKey{KeyId: "AK1", Secret: "v3", Secrets: []APIAccessKeySecret{
+		{Version: 1, Secret: "v1", ExpiresAt: &past},
+		{Version: 3, Secret: "v3"},
+		{Version: 2, Secret: "v2", ExpiresAt: &future},
+	}}
+	assert.Equal(t, []string{"v3", "v2"}, rotated.ActiveSecrets(now))
+	assert.Equal(t, []string{"v3"}, rotated.ActiveSecrets(future))
+	assert.True(t, rotated.IsValidAt(now))
+
+	allExpired := &APIAccessKey{KeyId: "AK1", Secret: "v1", Secrets: []APIAccessKeySecret{{Version: 1, Secret: "v1", ExpiresAt: &past}}}
+	assert.False(t, allExpired.IsValidAt(now))
+}
+
+func TestDbAccessSecretProviderMigration(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "keys.db")), &gorm.Config{})
+	require.NoError(t, err)
+	// a table created before the secret versions
+	require.NoError(t, db.Exec("CREATE TABLE api_access_keys (key_id TEXT PRIMARY KEY, secret TEXT, status TEXT)").Error)
+	require.NoError(t, db.Exec("INSERT INTO api_access_keys (key_id, secret, status) VALUES ('AK1', 'legacy', 'ACTIVE')").Error)
+
+	secrets, err := NewDbAccessSecretProvider(db).GetAccessSecrets("AK1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"legacy"}, secrets)
+
+	require.NoError(t, MigrateAccessKeys(db))
+	provider := NewDbAccessSecretProvider(db)
+	rotated, err := provider.RotateAccessKey(context.Background(), "AK1")
+	require.NoError(t, err)
+	secrets, err = provider.GetAccessSecrets("AK1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{rotated.Secret, "legacy"}, secrets)
+}
+
+func TestVerifyAsymmetricSignature(t *testing.T) {
+	securityHeader := "ts=20240101T000000Z/api=payments/ver=v1/chnl=web/usrid=u1"
+	headers := mustParseSignedHeaders(t, securityHeader)
+	payload := `{"amount":100}`
+	req := NewCanonicalRequest(httptest.NewRequest(http.MethodPost, "/v1/payments", nil))
+
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	ecPrivate, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&ecPrivate.PublicKey)
+	require.NoError(t, err)
+
+	provider := staticSecretProvider{
+		"ED1": base64.StdEncoding.EncodeToString(edPublic),
+		"EC1": string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+	}
+	for _, tc := range []struct {
+		keyId, alg string
+		signer     stdcrypto.Signer
+	}{
+		{"ED1", SignatureAlgorithmEd25519, edPrivate},
+		{"EC1", SignatureAlgorithmEcdsaP256, ecPrivate},
+	} {
+		signature, err := SignCanonicalRequest(tc.signer, payload, headers, req, nil)
+		require.NoError(t, err)
+		authHeader := "creds=access-key:" + tc.keyId + "/signature=" + signature + "/alg=" + tc.alg
+
+		assert.NoError(t, VerifyRequestSignature(authHeader, securityHeader, payload, req, provider, false), tc.alg)
+		assert.ErrorIs(t, VerifyRequestSignature(authHeader, securityHeader, `{"amount":101}`, req, provider, false), ErrSignatureMismatch, tc.alg)
+	}
+
+	// the algorithm must match the registered key type
+	signature, err := SignCanonicalRequest(edPrivate, payload, headers, req, nil)
+	require.NoError(t, err)
+	authHeader := "creds=access-key:EC1/signature=" + signature + "/alg=" + SignatureAlgorithmEd25519
+	assert.ErrorIs(t, VerifyRequestSignature(authHeader, securityHeader, payload, req, provider, false), ErrSignatureMismatch)
+}
+
+func TestAccessKeyContext(t *testing.T) {
+	_, ok := AccessKeyFromContext(context.Background())
+	assert.False(t, ok)
+
+	key := &APIAccessKey{KeyId: "AK1", InstitutionId: "inst1", ApplicationName: "app", Secret: "secret1",
+		Secrets: []APIAccessKeySecret{{Version: 1, Secret: "secret1"}}}
+	got, ok := AccessKeyFromContext(NewAccessKeyContext(context.Background(), key))
+	require.True(t, ok)
+	assert.Equal(t, "AK1", got.KeyId)
+	assert.Equal(t, "inst1", got.InstitutionId)
+	assert.Equal(t, "app", got.ApplicationName)
+	assert.Empty(t, got.Secret)
+	assert.Nil(t, got.Secrets)
+	assert.Equal(t, "secret1", key.Secret)
+}
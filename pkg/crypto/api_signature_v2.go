@@ -0,0 +1,232 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Signature algorithms
+const (
+	SignatureAlgorithmV1 = "HMAC-SHA256"
+	// SignatureAlgorithmV2 additionally covers the HTTP method, path, query
+	// string and selected headers, so a signed body cannot be replayed against
+	// a different endpoint.
+	SignatureAlgorithmV2 = "HMAC-SHA256-V2"
+)
+
+// Access key types, see APIAccessKey.KeyType.
+const (
+	// AccessKeyTypeHmac keys hold a shared secret, verified with the HMAC
+	// algorithms.
+	AccessKeyTypeHmac = "HMAC"
+	// AccessKeyTypePublicKey keys hold the public key of a partner, verified
+	// with the asymmetric algorithms.
+	AccessKeyTypePublicKey = "PUBLIC_KEY"
+)
+
+var ErrUnsupportedSignatureAlgorithm = errors.New("UNSUPPORTED_SIGNATURE_ALGORITHM")
+
+// CanonicalRequest holds the parts of the request covered by a v2 signature.
+type CanonicalRequest struct {
+	Method string
+	// Path is the unescaped request path.
+	Path   string
+	Query  url.Values
+	Header http.Header
+}
+
+// NewCanonicalRequest returns the canonical request of an HTTP request.
+func NewCanonicalRequest(r *http.Request) *CanonicalRequest {
+	return &CanonicalRequest{Method: r.Method, Path: r.URL.Path, Query: r.URL.Query(), Header: r.Header}
+}
+
+// canonicalString builds the canonical form of the request.
+// format: <METHOD>\n<path>\n<sorted query>\n<name:value>\n...\n<signed header names>
+func (r *CanonicalRequest) canonicalString(signedHeaders []string) string {
+	var sb strings.Builder
+	sb.WriteString(strings.ToUpper(r.Method))
+	sb.WriteByte('\n')
+	sb.WriteString(canonicalPath(r.Path))
+	sb.WriteByte('\n')
+	sb.WriteString(canonicalQuery(r.Query))
+	sb.WriteByte('\n')
+	names := canonicalHeaderNames(signedHeaders)
+	for _, name := range names {
+		values := r.Header.Values(name)
+		trimmed := make([]string, len(values))
+		for i, v := range values {
+			trimmed[i] = strings.Join(strings.Fields(v), " ")
+		}
+		sb.WriteString(name)
+		sb.WriteByte(':')
+		sb.WriteString(strings.Join(trimmed, ","))
+		sb.WriteByte('\n')
+	}
+	sb.WriteString(strings.Join(names, ";"))
+	return sb.String()
+}
+
+// canonicalPath escapes every path segment, an empty path is "/".
+func canonicalPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	segments := strings.Split(p, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// canonicalQuery sorts the query parameters by name and value and escapes them
+// with %20 for spaces.
+func canonicalQuery(q url.Values) string {
+	pairs := make([]string, 0, len(q))
+	for k, values := range q {
+		key := escapeQuery(k)
+		for _, v := range values {
+			pairs = append(pairs, key+"="+escapeQuery(v))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+func escapeQuery(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func canonicalHeaderNames(headers []string) []string {
+	names := make([]string, 0, len(headers))
+	for _, h := range headers {
+		if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+			names = append(names, h)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ComputeCanonicalSignature generates a v2 signature for the given payload,
+// signed headers and request. signedHeaders are the names of the HTTP headers
+// covered by the signature, as listed in the hdrs token of the Authorization header.
+func ComputeCanonicalSignature(accessSecretKey, payload string, headers map[string]string, req *CanonicalRequest, signedHeaders []string) string {
+	signingKey := GetSignatureKey(accessSecretKey, headers["ts"], headers["api"], headers["ver"])
+	stringToSign := CanonicalStringToSign(SignatureAlgorithmV2, payload, headers, req, signedHeaders)
+	return hex.EncodeToString(HmacSha256(stringToSign, signingKey))
+}
+
+// CanonicalStringToSign returns the string signed by the v2 and asymmetric
+// signature algorithms.
+// format: <alg>\n<timestamp>\n<hex sha256 of the canonical request, channel, user id and payload hash>
+func CanonicalStringToSign(algorithm, payload string, headers map[string]string, req *CanonicalRequest, signedHeaders []string) string {
+	request := req.canonicalString(signedHeaders) + "\n" +
+		headers["chnl"] + "\n" +
+		headers["usrid"] + "\n" +
+		hex.EncodeToString(Sha256(payload))
+
+	return algorithm + "\n" + headers["ts"] + "\n" + hex.EncodeToString(Sha256(request))
+}
+
+// VerifyRequestSignature verifies the signature using the algorithm named by
+// the alg token of the Authorization header. Requests without an alg token are
+// v1 signed and are only accepted when allowV1 is set, which allows both
+// schemes to be verified while clients migrate to v2. For the asymmetric
+// algorithms the provider returns the public keys of the access key.
+func VerifyRequestSignature(tokenHeader, securityHeader, payload string, req *CanonicalRequest, accessSecretProvider AccessSecretProvider, allowV1 bool) error {
+	signatureHeader, err := ParseSignatureHeader(tokenHeader)
+	if err != nil {
+		return err
+	}
+	if !isSupportedAlgorithm(signatureHeader.Algorithm, req, allowV1) {
+		return ErrUnsupportedSignatureAlgorithm
+	}
+	headers, err := ParseSignedHeaders(securityHeader)
+	if err != nil {
+		return err
+	}
+	return verifyWithSecrets(accessSecretProvider, signatureHeader, signatureMatcher(signatureHeader, headers, payload, req, "", false))
+}
+
+// isSupportedAlgorithm reports whether the algorithm can be verified, the
+// canonical algorithms need the request.
+func isSupportedAlgorithm(algorithm string, req *CanonicalRequest, allowV1 bool) bool {
+	switch algorithm {
+	case SignatureAlgorithmV1:
+		return allowV1
+	case SignatureAlgorithmV2, SignatureAlgorithmEd25519, SignatureAlgorithmEcdsaP256:
+		return req != nil
+	default:
+		return false
+	}
+}
+
+// AlgorithmKeyType returns the type of access key the signature algorithm is
+// verified with.
+func AlgorithmKeyType(algorithm string) string {
+	switch algorithm {
+	case SignatureAlgorithmV1, SignatureAlgorithmV2:
+		return AccessKeyTypeHmac
+	default:
+		return AccessKeyTypePublicKey
+	}
+}
+
+// SecretKeyType returns AccessKeyTypePublicKey for PEM encoded public keys
+// and AccessKeyTypeHmac otherwise. Raw base64 Ed25519 public keys cannot be
+// told apart from HMAC secrets, their access keys need the KeyType
+// AccessKeyTypePublicKey.
+func SecretKeyType(secret string) string {
+	if block, _ := pem.Decode([]byte(strings.TrimSpace(secret))); block != nil && block.Type == "PUBLIC KEY" {
+		return AccessKeyTypePublicKey
+	}
+	return AccessKeyTypeHmac
+}
+
+// signatureMatcher returns a function reporting whether the signature was
+// produced with the given secret, or public key for the asymmetric algorithms.
+// Secrets of another type than the algorithm never match, so that a public key
+// cannot be used as the HMAC secret of a forged signature. keyType is the type
+// of the access key, stored keys without a type are typed from their secret,
+// see SecretKeyType. The secrets of an AccessSecretProvider have no type at
+// all, the asymmetric algorithms then read them as public keys.
+func signatureMatcher(signatureHeader *SignatureHeader, headers map[string]string, payload string, req *CanonicalRequest, keyType string, stored bool) func(secret string) bool {
+	algorithmKeyType := AlgorithmKeyType(signatureHeader.Algorithm)
+	typeMatches := func(secret string) bool {
+		switch {
+		case keyType != "":
+			return keyType == algorithmKeyType
+		case stored || algorithmKeyType == AccessKeyTypeHmac:
+			return SecretKeyType(secret) == algorithmKeyType
+		default:
+			return true
+		}
+	}
+	switch signatureHeader.Algorithm {
+	case SignatureAlgorithmV1:
+		return func(accessSecret string) bool {
+			return typeMatches(accessSecret) &&
+				hmac.Equal([]byte(ComputeSignature(accessSecret, payload, headers)), []byte(signatureHeader.Signature))
+		}
+	case SignatureAlgorithmV2:
+		return func(accessSecret string) bool {
+			if !typeMatches(accessSecret) {
+				return false
+			}
+			computed := ComputeCanonicalSignature(accessSecret, payload, headers, req, signatureHeader.SignedHeaders)
+			return hmac.Equal([]byte(computed), []byte(signatureHeader.Signature))
+		}
+	default:
+		stringToSign := CanonicalStringToSign(signatureHeader.Algorithm, payload, headers, req, signatureHeader.SignedHeaders)
+		return func(publicKey string) bool {
+			return typeMatches(publicKey) &&
+				verifyAsymmetricSignature(signatureHeader.Algorithm, publicKey, stringToSign, signatureHeader.Signature)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package awssig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// ErrNoCredentials is returned by the providers which are not configured, so
+// that ChainCredentials tries the next one.
+var ErrNoCredentials = errors.New("awssig: no credentials")
+
+// Credentials are the AWS credentials used to sign requests, static
+// credentials are a CredentialsProvider.
+type Credentials struct {
+	AccessKeyId     string
+	SecretAccessKey string
+	SessionToken    string
+	// Expires is the expiry of temporary credentials, zero for long-term ones.
+	Expires time.Time
+}
+
+// CredentialsProvider returns the credentials to sign a request with, it is
+// called for every request so that temporary credentials get refreshed.
+type CredentialsProvider interface {
+	Retrieve(ctx context.Context) (Credentials, error)
+}
+
+// CredentialsProviderFunc is a CredentialsProvider function.
+type CredentialsProviderFunc func(ctx context.Context) (Credentials, error)
+
+func (f CredentialsProviderFunc) Retrieve(ctx context.Context) (Credentials, error) {
+	return f(ctx)
+}
+
+func (c Credentials) Retrieve(context.Context) (Credentials, error) {
+	if c.AccessKeyId == "" || c.SecretAccessKey == "" {
+		return Credentials{}, ErrNoCredentials
+	}
+	return c, nil
+}
+
+// CredentialsFromEnv reads the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN environment variables.
+func CredentialsFromEnv() Credentials {
+	return Credentials{
+		AccessKeyId:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// EnvCredentials returns the credentials of the environment variables, see
+// CredentialsFromEnv.
+func EnvCredentials() CredentialsProvider {
+	return CredentialsProviderFunc(func(ctx context.Context) (Credentials, error) {
+		return CredentialsFromEnv().Retrieve(ctx)
+	})
+}
+
+// DefaultCredentials looks the credentials up with the default chain of the
+// AWS SDK: the environment variables, the shared config and credentials
+// files, the web identity token, the container credentials endpoint and the
+// instance metadata. The SDK caches temporary credentials and refreshes them
+// before they expire.
+func DefaultCredentials() CredentialsProvider {
+	var (
+		once     sync.Once
+		provider CredentialsProvider
+		err      error
+	)
+	return CredentialsProviderFunc(func(ctx context.Context) (Credentials, error) {
+		once.Do(func() {
+			var cfg aws.Config
+			if cfg, err = config.LoadDefaultConfig(ctx); err == nil {
+				provider = SDKCredentials(cfg.Credentials)
+			}
+		})
+		if err != nil {
+			return Credentials{}, fmt.Errorf("awssig: load config: %w", err)
+		}
+		return provider.Retrieve(ctx)
+	})
+}
+
+// SDKCredentials adapts a credentials provider of the AWS SDK, e.g. the
+// Credentials of an aws.Config or a stscreds.AssumeRoleProvider.
+func SDKCredentials(p aws.CredentialsProvider) CredentialsProvider {
+	return CredentialsProviderFunc(func(ctx context.Context) (Credentials, error) {
+		if p == nil {
+			return Credentials{}, ErrNoCredentials
+		}
+		c, err := p.Retrieve(ctx)
+		if err != nil {
+			return Credentials{}, fmt.Errorf("awssig: %w", err)
+		}
+		creds := Credentials{AccessKeyId: c.AccessKeyID, SecretAccessKey: c.SecretAccessKey, SessionToken: c.SessionToken}
+		if c.CanExpire {
+			creds.Expires = c.Expires
+		}
+		return creds, nil
+	})
+}
+
+// ChainCredentials returns the credentials of the first provider which is
+// configured, the errors other than ErrNoCredentials are returned at once.
+func ChainCredentials(providers ...CredentialsProvider) CredentialsProvider {
+	return CredentialsProviderFunc(func(ctx context.Context) (Credentials, error) {
+		for _, p := range providers {
+			creds, err := p.Retrieve(ctx)
+			if !errors.Is(err, ErrNoCredentials) {
+				return creds, err
+			}
+		}
+		return Credentials{}, ErrNoCredentials
+	})
+}
+
+// CachedCredentials caches the credentials of p, temporary credentials are
+// retrieved again 5 minutes before they expire.
+func CachedCredentials(p CredentialsProvider) CredentialsProvider {
+	var (
+		mu    sync.Mutex
+		creds *Credentials
+	)
+	return CredentialsProviderFunc(func(ctx context.Context) (Credentials, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if creds != nil && (creds.Expires.IsZero() || time.Now().Before(creds.Expires.Add(-5*time.Minute))) {
+			return *creds, nil
+		}
+		c, err := p.Retrieve(ctx)
+		if err != nil {
+			return Credentials{}, err
+		}
+		creds = &c
+		return c, nil
+	})
+}
@@ -0,0 +1,155 @@
+package awssig
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// clearEnv unsets the variables of the providers for the test.
+func clearEnv(t *testing.T) {
+	for _, name := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN",
+		"AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_ROLE_ARN", "AWS_ROLE_SESSION_NAME", "AWS_ENDPOINT_URL_STS",
+		"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "AWS_CONTAINER_CREDENTIALS_FULL_URI",
+		"AWS_CONTAINER_AUTHORIZATION_TOKEN", "AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE",
+		"AWS_EC2_METADATA_SERVICE_ENDPOINT", "AWS_PROFILE", "AWS_REGION"} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+}
+
+func TestEnvCredentials(t *testing.T) {
+	clearEnv(t)
+	_, err := DefaultCredentials().Retrieve(context.Background())
+	assert.Error(t, err)
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	creds, err := DefaultCredentials().Retrieve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, Credentials{AccessKeyId: "AKID", SecretAccessKey: "secret"}, creds)
+}
+
+func TestContainerCredentials(t *testing.T) {
+	clearEnv(t)
+	expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "pod-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"AccessKeyId": "ASIA", "SecretAccessKey": "secret", "Token": "session", "Expiration": expires})
+	}))
+	defer srv.Close()
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("pod-token"), 0o600))
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", srv.URL+"/v1/credentials")
+	t.Setenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE", tokenFile)
+
+	creds, err := DefaultCredentials().Retrieve(context.Background())
+	require.NoError(t, err)
+	// the SDK refreshes temporary credentials a few minutes early
+	assert.WithinDuration(t, expires, creds.Expires, 10*time.Minute)
+	creds.Expires = time.Time{}
+	assert.Equal(t, Credentials{AccessKeyId: "ASIA", SecretAccessKey: "secret", SessionToken: "session"}, creds)
+
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", "http://example.com/credentials")
+	_, err = DefaultCredentials().Retrieve(context.Background())
+	assert.Error(t, err)
+}
+
+func TestInstanceCredentials(t *testing.T) {
+	clearEnv(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/latest/api/token":
+			w.Header().Set("X-aws-ec2-metadata-token-ttl-seconds", "21600")
+			_, _ = w.Write([]byte("imds-token"))
+		case r.Header.Get("X-aws-ec2-metadata-token") != "imds-token":
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/latest/meta-data/iam/security-credentials/":
+			_, _ = w.Write([]byte("app-role"))
+		case r.URL.Path == "/latest/meta-data/iam/security-credentials/app-role":
+			_, _ = w.Write([]byte(`{"Code":"Success","AccessKeyId":"ASIA","SecretAccessKey":"secret","Token":"session","Expiration":"2030-01-01T00:00:00Z"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "")
+	t.Setenv("AWS_EC2_METADATA_SERVICE_ENDPOINT", srv.URL)
+
+	creds, err := DefaultCredentials().Retrieve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "ASIA", creds.AccessKeyId)
+	assert.Equal(t, "session", creds.SessionToken)
+	assert.False(t, creds.Expires.IsZero())
+}
+
+func TestWebIdentityCredentials(t *testing.T) {
+	clearEnv(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("Action") != "AssumeRoleWithWebIdentity" || r.PostFormValue("WebIdentityToken") != "jwt" ||
+			r.PostFormValue("RoleArn") != "arn:aws:iam::111122223333:role/app" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(`<AssumeRoleWithWebIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleWithWebIdentityResult>
+    <Credentials>
+      <AccessKeyId>ASIA</AccessKeyId>
+      <SecretAccessKey>secret</SecretAccessKey>
+      <SessionToken>session</SessionToken>
+      <Expiration>2030-01-01T00:00:00Z</Expiration>
+    </Credentials>
+  </AssumeRoleWithWebIdentityResult>
+</AssumeRoleWithWebIdentityResponse>`))
+	}))
+	defer srv.Close()
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("jwt"), 0o600))
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", tokenFile)
+	t.Setenv("AWS_ROLE_ARN", "arn:aws:iam::111122223333:role/app")
+	t.Setenv("AWS_ENDPOINT_URL_STS", srv.URL)
+	t.Setenv("AWS_REGION", "eu-west-1")
+
+	creds, err := DefaultCredentials().Retrieve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, Credentials{AccessKeyId: "ASIA", SecretAccessKey: "secret", SessionToken: "session", Expires: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)}, creds)
+}
+
+func TestCachedCredentials(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		expires time.Time
+		calls   int
+	}{
+		{name: "long-term", calls: 1},
+		{name: "temporary", expires: time.Now().Add(time.Hour), calls: 1},
+		// refreshed shortly before they expire
+		{name: "expiring", expires: time.Now().Add(time.Minute), calls: 3},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			cached := CachedCredentials(CredentialsProviderFunc(func(ctx context.Context) (Credentials, error) {
+				calls++
+				return Credentials{AccessKeyId: "ASIA", SecretAccessKey: "secret", Expires: tt.expires}, nil
+			}))
+			for range 3 {
+				_, err := cached.Retrieve(context.Background())
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tt.calls, calls)
+		})
+	}
+}
@@ -0,0 +1,115 @@
+// Package awssig signs requests to AWS services with Signature Version 4.
+package awssig
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const algorithm = "AWS4-HMAC-SHA256"
+
+// Sign adds the X-Amz-Date, X-Amz-Security-Token and Authorization headers to
+// the request. All headers already set on the request are signed.
+func Sign(req *http.Request, payload []byte, creds Credentials, region, service string, t time.Time) {
+	t = t.UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		trimmed := make([]string, len(values))
+		for i, v := range values {
+			// sequential spaces are collapsed
+			trimmed[i] = strings.Join(strings.Fields(v), " ")
+		}
+		headers[strings.ToLower(name)] = strings.Join(trimmed, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := req.Method + "\n" + path + "\n" + canonicalQuery(req) + "\n" +
+		canonicalHeaders.String() + "\n" + signedHeaders + "\n" + hexSha256(payload)
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := algorithm + "\n" + amzDate + "\n" + scope + "\n" + hexSha256([]byte(canonicalRequest))
+
+	kDate := hmacSha256([]byte("AWS4"+creds.SecretAccessKey), date)
+	kRegion := hmacSha256(kDate, region)
+	kService := hmacSha256(kRegion, service)
+	kSigning := hmacSha256(kService, "aws4_request")
+	signature := hex.EncodeToString(hmacSha256(kSigning, stringToSign))
+
+	req.Header.Set("Authorization", algorithm+" Credential="+creds.AccessKeyId+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// canonicalQuery returns the query parameters sorted by name and value, with
+// the characters other than the unreserved ones percent-encoded.
+func canonicalQuery(req *http.Request) string {
+	var params [][2]string
+	for name, values := range req.URL.Query() {
+		for _, v := range values {
+			params = append(params, [2]string{escape(name), escape(v)})
+		}
+	}
+	sort.Slice(params, func(i, j int) bool {
+		if params[i][0] != params[j][0] {
+			return params[i][0] < params[j][0]
+		}
+		return params[i][1] < params[j][1]
+	})
+	encoded := make([]string, len(params))
+	for i, p := range params {
+		encoded[i] = p[0] + "=" + p[1]
+	}
+	return strings.Join(encoded, "&")
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hexSha256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
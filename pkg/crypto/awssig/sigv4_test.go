@@ -0,0 +1,77 @@
+package awssig
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Requests of the AWS Signature Version 4 test suite, the session token one
+// is checked against the signer of the AWS SDK for Go.
+func TestSign(t *testing.T) {
+	creds := Credentials{AccessKeyId: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	tests := []struct {
+		name          string
+		method        string
+		url           string
+		headers       map[string]string
+		body          string
+		sessionToken  string
+		signedHeaders string
+		signature     string
+	}{
+		{name: "get-vanilla", method: http.MethodGet, url: "https://example.amazonaws.com/",
+			signature: "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"},
+		{name: "get-vanilla-empty-query-key", method: http.MethodGet, url: "https://example.amazonaws.com/?Param1=value1",
+			signature: "a67d582fa61cc504c4bae71f336f98b97f1ea3c7a6bfe1b6e45aec72011b9aeb"},
+		{name: "get-vanilla-query-order-key-case", method: http.MethodGet, url: "https://example.amazonaws.com/?Param2=value2&Param1=value1",
+			signature: "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500"},
+		{name: "get-vanilla-query-unreserved", method: http.MethodGet,
+			url:       "https://example.amazonaws.com/?-._~0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz=-._~0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz",
+			signature: "9c3e54bfcdf0b19771a7f523ee5669cdf59bc7cc0884027167c21bb143a40197"},
+		{name: "get-vanilla-utf8-query", method: http.MethodGet, url: "https://example.amazonaws.com/?%E1%88%B4=bar",
+			signature: "2cdec8eed098649ff3a119c94853b13c643bcf08f8b0a1d91e12c9027818dd04"},
+		{name: "get-header-value-trim", method: http.MethodGet, url: "https://example.amazonaws.com/",
+			headers:       map[string]string{"My-Header1": " value1", "My-Header2": ` "a   b   c"`},
+			signedHeaders: "host;my-header1;my-header2;x-amz-date",
+			signature:     "acc3ed3afb60bb290fc8d2dd0098b9911fcaa05412b367055dee359757a9c736"},
+		{name: "post-vanilla", method: http.MethodPost, url: "https://example.amazonaws.com/",
+			signature: "5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b"},
+		{name: "post-vanilla-query", method: http.MethodPost, url: "https://example.amazonaws.com/?Param1=value1",
+			signature: "28038455d6de14eafc1f9222cf5aa6f1a96197d7deb8263271d420d138af7f11"},
+		{name: "post-x-www-form-urlencoded", method: http.MethodPost, url: "https://example.amazonaws.com/",
+			headers: map[string]string{"Content-Type": "application/x-www-form-urlencoded"}, body: "Param1=value1",
+			signedHeaders: "content-type;host;x-amz-date",
+			signature:     "ff11897932ad3f4e8b18135d722051e5ac45fc38421b1da7b9d196a0fe09473a"},
+		{name: "post-sts-header-before", method: http.MethodPost, url: "https://example.amazonaws.com/",
+			sessionToken:  "AQoDYXdzEPT//////////wEXAMPLE",
+			signedHeaders: "host;x-amz-date;x-amz-security-token",
+			signature:     "997fca65d08f4072d2c61b34906c6c8e83179f706ce49ad9dbb7c41659dc53cc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			require.NoError(t, err)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			creds := creds
+			creds.SessionToken = tt.sessionToken
+			signedHeaders := tt.signedHeaders
+			if signedHeaders == "" {
+				signedHeaders = "host;x-amz-date"
+			}
+
+			Sign(req, []byte(tt.body), creds, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+			assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+			assert.Equal(t, tt.sessionToken, req.Header.Get("X-Amz-Security-Token"))
+			assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+				"SignedHeaders="+signedHeaders+", Signature="+tt.signature, req.Header.Get("Authorization"))
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package crypto
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/achuala/go-svc-extn/pkg/cache"
+)
+
+const defaultSecretCacheTTL = 5 * time.Minute
+
+var (
+	_ AccessSecretProvider = (*CachedAccessSecretProvider)(nil)
+	_ MultiSecretProvider  = (*CachedAccessSecretProvider)(nil)
+	_ AccessKeyProvider    = (*CachedAccessSecretProvider)(nil)
+)
+
+// CachedSecretProviderConfig configures a CachedAccessSecretProvider.
+type CachedSecretProviderConfig struct {
+	// TTL bounds how long a key, including its secrets, is kept in the cache
+	// and how long a disabled key keeps working. Defaults to 5 minutes.
+	TTL time.Duration
+	// RefreshInterval reloads the keys used since the previous refresh in the
+	// background, so that hot keys never miss the cache. Zero disables it.
+	RefreshInterval time.Duration
+}
+
+// CachedAccessSecretProvider caches the access keys of another provider in
+// pkg/cache with a TTL. Prefer a local cache, a remote cache stores the
+// secrets outside of the process.
+type CachedAccessSecretProvider struct {
+	provider AccessSecretProvider
+	cache    cache.Cache
+	ttl      time.Duration
+
+	mu sync.Mutex
+	// used holds the key ids requested since the previous refresh
+	used map[string]struct{}
+	stop chan struct{}
+	once sync.Once
+}
+
+func NewCachedAccessSecretProvider(provider AccessSecretProvider, c cache.Cache, cfg *CachedSecretProviderConfig) *CachedAccessSecretProvider {
+	ttl := cfg.TTL
+	if ttl <= 0 {
+		ttl = defaultSecretCacheTTL
+	}
+	p := &CachedAccessSecretProvider{
+		provider: provider,
+		cache:    c,
+		ttl:      ttl,
+		used:     make(map[string]struct{}),
+		stop:     make(chan struct{}),
+	}
+	if cfg.RefreshInterval > 0 {
+		go p.refreshLoop(cfg.RefreshInterval)
+	}
+	return p
+}
+
+// GetAccessKey returns the cached access key, loading it on a cache miss.
+// Providers which do not implement AccessKeyProvider are represented by a key
+// holding only their secrets.
+func (p *CachedAccessSecretProvider) GetAccessKey(accessKeyId string) (*APIAccessKey, error) {
+	ctx := context.Background()
+	p.markUsed(accessKeyId)
+	if v, ok := p.cache.Get(ctx, cacheKey(accessKeyId)); ok {
+		var key APIAccessKey
+		if err := json.Unmarshal([]byte(v), &key); err == nil {
+			return &key, nil
+		}
+	}
+	return p.load(ctx, accessKeyId)
+}
+
+// GetAccessSecret returns the newest valid secret of the access key.
+func (p *CachedAccessSecretProvider) GetAccessSecret(accessKeyId string) (string, error) {
+	secrets, err := p.GetAccessSecrets(accessKeyId)
+	if err != nil || len(secrets) == 0 {
+		return "", err
+	}
+	return secrets[0], nil
+}
+
+// GetAccessSecrets returns the valid secrets of the access key, newest first.
+func (p *CachedAccessSecretProvider) GetAccessSecrets(accessKeyId string) ([]string, error) {
+	key, err := p.GetAccessKey(accessKeyId)
+	if err != nil {
+		return nil, err
+	}
+	return key.ActiveSecrets(time.Now()), nil
+}
+
+// Invalidate removes the access key from the cache, e.g. after it has been
+// revoked or rotated.
+func (p *CachedAccessSecretProvider) Invalidate(accessKeyId string) error {
+	p.mu.Lock()
+	delete(p.used, accessKeyId)
+	p.mu.Unlock()
+	return p.cache.Delete(context.Background(), cacheKey(accessKeyId))
+}
+
+// Close stops the background refresh.
+func (p *CachedAccessSecretProvider) Close() {
+	p.once.Do(func() { close(p.stop) })
+}
+
+// load reads the access key from the underlying provider and caches it.
+// Errors are not cached.
+func (p *CachedAccessSecretProvider) load(ctx context.Context, accessKeyId string) (*APIAccessKey, error) {
+	var key *APIAccessKey
+	switch v := p.provider.(type) {
+	case AccessKeyProvider:
+		k, err := v.GetAccessKey(accessKeyId)
+		if err != nil {
+			return nil, err
+		}
+		key = k
+	case MultiSecretProvider:
+		secrets, err := v.GetAccessSecrets(accessKeyId)
+		if err != nil {
+			return nil, err
+		}
+		key = &APIAccessKey{KeyId: accessKeyId}
+		for i, s := range secrets {
+			key.Secrets = append(key.Secrets, APIAccessKeySecret{KeyId: accessKeyId, Version: len(secrets) - i, Secret: s})
+		}
+	default:
+		secret, err := p.provider.GetAccessSecret(accessKeyId)
+		if err != nil {
+			return nil, err
+		}
+		key = &APIAccessKey{KeyId: accessKeyId, Secret: secret}
+	}
+
+	if b, err := json.Marshal(key); err == nil {
+		_ = p.cache.SetWithTTL(ctx, cacheKey(accessKeyId), string(b), p.ttl)
+	}
+	return key, nil
+}
+
+func (p *CachedAccessSecretProvider) markUsed(accessKeyId string) {
+	p.mu.Lock()
+	p.used[accessKeyId] = struct{}{}
+	p.mu.Unlock()
+}
+
+// refreshLoop reloads the keys used since the previous tick. Keys which are no
+// longer used simply expire from the cache.
+func (p *CachedAccessSecretProvider) refreshLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			used := p.used
+			p.used = make(map[string]struct{})
+			p.mu.Unlock()
+
+			ctx := context.Background()
+			for accessKeyId := range used {
+				if _, err := p.load(ctx, accessKeyId); err != nil {
+					// the key may have been deleted, stop serving it from the cache
+					_ = p.cache.Delete(ctx, cacheKey(accessKeyId))
+				}
+			}
+		}
+	}
+}
+
+func cacheKey(accessKeyId string) string {
+	return "access-key:" + accessKeyId
+}
@@ -0,0 +1,124 @@
+package crypto
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type mapCache struct {
+	mu      sync.Mutex
+	entries map[string]string
+}
+
+func newMapCache() *mapCache {
+	return &mapCache{entries: make(map[string]string)}
+}
+
+func (c *mapCache) Get(ctx context.Context, key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.entries[key]
+	return v, ok
+}
+
+func (c *mapCache) Set(ctx context.Context, key string, value string) error {
+	return c.SetWithTTL(ctx, key, value, 0)
+}
+
+func (c *mapCache) Delete(ctx context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+	return nil
+}
+
+func (c *mapCache) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	return nil
+}
+
+func (c *mapCache) SetWithTTL(ctx context.Context, key string, value string, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = value
+	return nil
+}
+
+type countingKeyProvider struct {
+	mu    sync.Mutex
+	keys  map[string]*APIAccessKey
+	calls int
+}
+
+func (p *countingKeyProvider) GetAccessSecret(accessKeyId string) (string, error) {
+	key, err := p.GetAccessKey(accessKeyId)
+	if err != nil {
+		return "", err
+	}
+	return key.Secret, nil
+}
+
+func (p *countingKeyProvider) GetAccessKey(accessKeyId string) (*APIAccessKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls++
+	key, ok := p.keys[accessKeyId]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copied := *key
+	return &copied, nil
+}
+
+func (p *countingKeyProvider) callCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.calls
+}
+
+func TestCachedAccessSecretProvider(t *testing.T) {
+	inner := &countingKeyProvider{keys: map[string]*APIAccessKey{"AK1": {KeyId: "AK1", Secret: "secret1", Status: AccessKeyStatusActive}}}
+	p := NewCachedAccessSecretProvider(inner, newMapCache(), &CachedSecretProviderConfig{})
+	defer p.Close()
+
+	secret, err := p.GetAccessSecret("AK1")
+	require.NoError(t, err)
+	assert.Equal(t, "secret1", secret)
+	key, err := p.GetAccessKey("AK1")
+	require.NoError(t, err)
+	assert.True(t, key.IsValid())
+	assert.Equal(t, 1, inner.callCount())
+
+	// revoked keys are picked up once the cache entry is invalidated
+	inner.keys["AK1"].Status = AccessKeyStatusRevoked
+	key, _ = p.GetAccessKey("AK1")
+	assert.True(t, key.IsValid())
+	require.NoError(t, p.Invalidate("AK1"))
+	key, _ = p.GetAccessKey("AK1")
+	assert.False(t, key.IsValid())
+	assert.Equal(t, 2, inner.callCount())
+
+	// errors are not cached
+	_, err = p.GetAccessKey("AK2")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	_, err = p.GetAccessKey("AK2")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	assert.Equal(t, 4, inner.callCount())
+}
+
+func TestCachedAccessSecretProviderRefresh(t *testing.T) {
+	inner := &countingKeyProvider{keys: map[string]*APIAccessKey{"AK1": {KeyId: "AK1", Secret: "secret1"}}}
+	p := NewCachedAccessSecretProvider(inner, newMapCache(), &CachedSecretProviderConfig{RefreshInterval: 10 * time.Millisecond})
+	defer p.Close()
+
+	_, err := p.GetAccessSecret("AK1")
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	// reloaded once in the background, then dropped as it was not used again
+	assert.Equal(t, 2, inner.callCount())
+}
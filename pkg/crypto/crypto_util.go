@@ -9,35 +9,153 @@ import (
 	"encoding/base64"
 	"io"
 	"strings"
+	"time"
 
 	"github.com/achuala/go-svc-extn/pkg/crypto/encdec"
 	"github.com/achuala/go-svc-extn/pkg/crypto/hash"
 
+	"github.com/go-kratos/kratos/v2/log"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/metric"
 )
 
+// ErrDeterministicKeysetNotConfigured is returned by the deterministic
+// encryption when CryptoConfig.DeterministicKeysetData is not set.
+var ErrDeterministicKeysetNotConfigured = errors.New("DETERMINISTIC_KEYSET_NOT_CONFIGURED")
+
+// ErrStreamingKeysetNotConfigured is returned by the stream encryption when
+// CryptoConfig.StreamingKeysetData is not set.
+var ErrStreamingKeysetNotConfigured = errors.New("STREAMING_KEYSET_NOT_CONFIGURED")
+
+// ErrSignatureKeysetNotConfigured is returned by Sign and Verify when
+// CryptoConfig.SignatureKeysetData is not set.
+var ErrSignatureKeysetNotConfigured = errors.New("SIGNATURE_KEYSET_NOT_CONFIGURED")
+
+// ErrMacKeysetNotConfigured is returned by ComputeMAC and VerifyMAC when
+// CryptoConfig.MacKeysetData is not set.
+var ErrMacKeysetNotConfigured = errors.New("MAC_KEYSET_NOT_CONFIGURED")
+
+// ErrHybridKeysetNotConfigured is returned by DecryptHybrid when
+// CryptoConfig.HybridKeysetData is not set.
+var ErrHybridKeysetNotConfigured = errors.New("HYBRID_KEYSET_NOT_CONFIGURED")
+
 type CryptoUtil struct {
-	hashProvider   hash.Hasher
-	cryptoProvider encdec.CryptoHandler
+	hashProvider          hash.Hasher
+	cryptoProvider        *encdec.TinkCryptoHandler
+	deterministicProvider *encdec.TinkDeterministicHandler
+	streamingProvider     *encdec.TinkStreamingHandler
+	signatureProvider     *encdec.TinkSignatureHandler
+	macProvider           *encdec.TinkMACHandler
+	hybridProvider        *encdec.TinkHybridHandler
 }
 
 type CryptoConfig struct {
+	// KmsUri is the URI of the key encryption key of the keyset, either a
+	// caas-kms:// URI or a managed KMS key whose client has been registered,
+	// e.g. with awskms.Register.
 	KmsUri       string
 	KmsUriPrefix string
 	KeysetData   string
-	HmacKey      string
-	KekAd        []byte
+	// DeterministicKeysetData is an AES-SIV keyset encrypted under the same
+	// KEK, see encdec.NewDeterministicKeyset. It enables EncryptDeterministic.
+	DeterministicKeysetData string
+	// StreamingKeysetData is a streaming keyset encrypted under the same KEK,
+	// see encdec.NewStreamingKeyset. It enables EncryptStream.
+	StreamingKeysetData string
+	// SignatureKeysetData is a private signature keyset encrypted under the
+	// same KEK, see encdec.NewSignatureKeyset. It enables Sign and Verify.
+	SignatureKeysetData string
+	// MacKeysetData is an HMAC keyset encrypted under the same KEK, see
+	// encdec.NewMACKeyset. It enables ComputeMAC and VerifyMAC.
+	MacKeysetData string
+	// HybridKeysetData is a private hybrid keyset encrypted under the same
+	// KEK, see encdec.NewHybridKeyset. It enables DecryptHybrid.
+	HybridKeysetData string
+	HmacKey          string
+	// HmacKeys holds the versioned alias keys by key id, see HmacKeyId.
+	HmacKeys map[string]string
+	// HmacKeyId is the id of the key in HmacKeys used for new aliases.
+	// When empty, aliases are created with HmacKey and carry no key id.
+	HmacKeyId string
+	// AliasAlgorithm selects the keyed hash used for aliases, one of
+	// sip24 (default), hmac-sha256 or blake2b.
+	AliasAlgorithm string
+	// AliasSize is the alias size in bytes, the default depends on the algorithm.
+	AliasSize int
+	KekAd     []byte
+	// KeyRotationInterval, KeyRotationTimeout, OnKeyRotate and Logger
+	// configure the rotation of the keyset, Meter records the key usage,
+	// operation and KMS metrics of all the keysets, see
+	// encdec.TinkConfiguration.
+	KeyRotationInterval time.Duration
+	KeyRotationTimeout  time.Duration
+	OnKeyRotate         func(ctx context.Context, keySetData string) error
+	Logger              log.Logger
+	Meter               metric.Meter
 }
 
 func NewCryptoUtil(cfg *CryptoConfig) (*CryptoUtil, error) {
-	conf := hash.SipHashConfiguration{Key: cfg.HmacKey}
-	hasher := hash.NewHasherSipHash24(&conf)
-	tinkCfg := &encdec.TinkConfiguration{KekUri: cfg.KmsUri, KekUriPrefix: cfg.KmsUriPrefix, KeySetData: cfg.KeysetData, KekAd: cfg.KekAd}
+	hasher, err := newAliasHasher(cfg)
+	if err != nil {
+		return nil, err
+	}
+	tinkCfg := &encdec.TinkConfiguration{KekUri: cfg.KmsUri, KekUriPrefix: cfg.KmsUriPrefix, KeySetData: cfg.KeysetData, KekAd: cfg.KekAd,
+		KeyRotationInterval: cfg.KeyRotationInterval, KeyRotationTimeout: cfg.KeyRotationTimeout, OnKeyRotate: cfg.OnKeyRotate,
+		Logger: cfg.Logger, Meter: cfg.Meter}
 	cryptoProvider, err := encdec.NewTinkCryptoHandler(tinkCfg)
 	if err != nil {
 		return nil, err
 	}
-	return &CryptoUtil{hasher, cryptoProvider}, nil
+	u := &CryptoUtil{hashProvider: hasher, cryptoProvider: cryptoProvider}
+	if cfg.DeterministicKeysetData != "" {
+		u.deterministicProvider, err = encdec.NewTinkDeterministicHandler(&encdec.TinkConfiguration{KekUri: cfg.KmsUri,
+			KekUriPrefix: cfg.KmsUriPrefix, KeySetData: cfg.DeterministicKeysetData, KekAd: cfg.KekAd, Meter: cfg.Meter})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.StreamingKeysetData != "" {
+		u.streamingProvider, err = encdec.NewTinkStreamingHandler(&encdec.TinkConfiguration{KekUri: cfg.KmsUri,
+			KekUriPrefix: cfg.KmsUriPrefix, KeySetData: cfg.StreamingKeysetData, KekAd: cfg.KekAd, Meter: cfg.Meter})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.SignatureKeysetData != "" {
+		u.signatureProvider, err = encdec.NewTinkSignatureHandler(&encdec.TinkConfiguration{KekUri: cfg.KmsUri,
+			KekUriPrefix: cfg.KmsUriPrefix, KeySetData: cfg.SignatureKeysetData, KekAd: cfg.KekAd, Meter: cfg.Meter})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.MacKeysetData != "" {
+		u.macProvider, err = encdec.NewTinkMACHandler(&encdec.TinkConfiguration{KekUri: cfg.KmsUri,
+			KekUriPrefix: cfg.KmsUriPrefix, KeySetData: cfg.MacKeysetData, KekAd: cfg.KekAd, Meter: cfg.Meter})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.HybridKeysetData != "" {
+		u.hybridProvider, err = encdec.NewTinkHybridHandler(&encdec.TinkConfiguration{KekUri: cfg.KmsUri,
+			KekUriPrefix: cfg.KmsUriPrefix, KeySetData: cfg.HybridKeysetData, KekAd: cfg.KekAd, Meter: cfg.Meter})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return u, nil
+}
+
+func newAliasHasher(cfg *CryptoConfig) (hash.Hasher, error) {
+	switch cfg.AliasAlgorithm {
+	case "", hash.AlgorithmSip24:
+		return hash.NewHasherSipHash24(&hash.SipHashConfiguration{Key: cfg.HmacKey, Keys: cfg.HmacKeys, ActiveKeyId: cfg.HmacKeyId, Size: cfg.AliasSize}), nil
+	case hash.AlgorithmHmacSha256:
+		return hash.NewHasherHmacSha256(&hash.HmacSha256Configuration{Key: cfg.HmacKey, Keys: cfg.HmacKeys, ActiveKeyId: cfg.HmacKeyId}), nil
+	case hash.AlgorithmBlake2b:
+		return hash.NewHasherBlake2b(&hash.Blake2bConfiguration{Key: cfg.HmacKey, Keys: cfg.HmacKeys, ActiveKeyId: cfg.HmacKeyId, Size: cfg.AliasSize}), nil
+	default:
+		return nil, errors.Errorf("unsupported alias algorithm %s", cfg.AliasAlgorithm)
+	}
 }
 
 // CreateAlias creates an alias for the given plain text.
@@ -49,9 +167,29 @@ func (u *CryptoUtil) CreateAlias(ctx context.Context, plain []byte) ([]byte, err
 	return u.hashProvider.Generate(ctx, plain)
 }
 
+// AliasCandidates returns the aliases of the given plain text for all the
+// configured keys, starting with the active key.
+// It is used to look up values stored before an alias key rotation.
+func (u *CryptoUtil) AliasCandidates(ctx context.Context, plain []byte) ([][]byte, error) {
+	if len(plain) == 0 {
+		return [][]byte{make([]byte, 0)}, nil
+	}
+	if kh, ok := u.hashProvider.(hash.KeyedHasher); ok {
+		return kh.Candidates(ctx, plain)
+	}
+	alias, err := u.hashProvider.Generate(ctx, plain)
+	if err != nil {
+		return nil, err
+	}
+	return [][]byte{alias}, nil
+}
+
 // CompareHash compares the plain text with the stored hash.
 // It returns true if the plain text is the same as the stored hash.
 func (u *CryptoUtil) CompareHash(ctx context.Context, plainName, storedHash []byte) (bool, error) {
+	if kh, ok := u.hashProvider.(hash.KeyedHasher); ok && len(plainName) > 0 {
+		return kh.Compare(ctx, plainName, storedHash)
+	}
 	newHash, err := u.CreateAlias(ctx, plainName)
 	if err != nil {
 		return false, err
@@ -87,6 +225,167 @@ func (u *CryptoUtil) Decrypt(ctx context.Context, cipeherText string, ad []byte)
 	}
 }
 
+// EncryptBytes encrypts the given plain text like Encrypt, without encoding
+// the cipher text, e.g. for binary message payloads.
+func (u *CryptoUtil) EncryptBytes(ctx context.Context, plainText, ad []byte) ([]byte, error) {
+	return u.cryptoProvider.Encrypt(ctx, plainText, ad)
+}
+
+// DecryptBytes decrypts a cipher text of EncryptBytes.
+func (u *CryptoUtil) DecryptBytes(ctx context.Context, cipherText, ad []byte) ([]byte, error) {
+	return u.cryptoProvider.Decrypt(ctx, cipherText, ad)
+}
+
+// DecryptSecret decrypts the given cipher text of Encrypt into a Secret, the
+// caller destroys it once the plain text is no longer needed.
+func (u *CryptoUtil) DecryptSecret(ctx context.Context, cipherText string, ad []byte) (*Secret, error) {
+	plainText, err := u.Decrypt(ctx, cipherText, ad)
+	if err != nil {
+		return nil, err
+	}
+	return NewSecret(plainText), nil
+}
+
+// EncryptDeterministic encrypts the given plain text with the deterministic
+// keyset, the same plain text and associated data always give the same cipher
+// text so that it can be used for exact match lookups. It reveals which
+// values are equal, use Encrypt when that is not required.
+func (u *CryptoUtil) EncryptDeterministic(ctx context.Context, plainText, ad []byte) (string, error) {
+	if u.deterministicProvider == nil {
+		return "", ErrDeterministicKeysetNotConfigured
+	}
+	cipherText, err := u.deterministicProvider.Encrypt(ctx, plainText, ad)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawStdEncoding.EncodeToString(cipherText), nil
+}
+
+// DecryptDeterministic decrypts a cipher text of EncryptDeterministic.
+func (u *CryptoUtil) DecryptDeterministic(ctx context.Context, cipherText string, ad []byte) ([]byte, error) {
+	if u.deterministicProvider == nil {
+		return nil, ErrDeterministicKeysetNotConfigured
+	}
+	cipher, err := base64.RawStdEncoding.DecodeString(cipherText)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to decode")
+	}
+	return u.deterministicProvider.Decrypt(ctx, cipher, ad)
+}
+
+// EncryptStream encrypts src into dst with the streaming keyset without
+// loading it in memory, e.g. for exports and file uploads. It returns the
+// number of plain text bytes read from src.
+func (u *CryptoUtil) EncryptStream(ctx context.Context, dst io.Writer, src io.Reader, ad []byte) (int64, error) {
+	if u.streamingProvider == nil {
+		return 0, ErrStreamingKeysetNotConfigured
+	}
+	return u.streamingProvider.EncryptStream(ctx, dst, src, ad)
+}
+
+// DecryptStream decrypts a stream of EncryptStream from src into dst. It
+// returns the number of plain text bytes written to dst. The stream is
+// authenticated segment by segment, on error the output written so far must
+// be discarded.
+func (u *CryptoUtil) DecryptStream(ctx context.Context, dst io.Writer, src io.Reader, ad []byte) (int64, error) {
+	if u.streamingProvider == nil {
+		return 0, ErrStreamingKeysetNotConfigured
+	}
+	return u.streamingProvider.DecryptStream(ctx, dst, src, ad)
+}
+
+// Sign signs the data with the signature keyset, e.g. a webhook payload.
+// It returns the base64 encoded signature.
+func (u *CryptoUtil) Sign(ctx context.Context, data []byte) (string, error) {
+	if u.signatureProvider == nil {
+		return "", ErrSignatureKeysetNotConfigured
+	}
+	sig, err := u.signatureProvider.Sign(ctx, data)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawStdEncoding.EncodeToString(sig), nil
+}
+
+// Verify verifies a signature of Sign.
+func (u *CryptoUtil) Verify(ctx context.Context, signature string, data []byte) error {
+	if u.signatureProvider == nil {
+		return ErrSignatureKeysetNotConfigured
+	}
+	sig, err := base64.RawStdEncoding.DecodeString(signature)
+	if err != nil {
+		return errors.Wrap(err, "unable to decode")
+	}
+	return u.signatureProvider.Verify(ctx, sig, data)
+}
+
+// PublicKeyset returns the public keys of the signature keyset for the
+// parties verifying the signatures, see encdec.NewTinkSignatureVerifier.
+func (u *CryptoUtil) PublicKeyset() (string, error) {
+	if u.signatureProvider == nil {
+		return "", ErrSignatureKeysetNotConfigured
+	}
+	return u.signatureProvider.PublicKeyset()
+}
+
+// ComputeMAC computes the MAC of the data with the MAC keyset.
+// It returns the base64 encoded MAC.
+func (u *CryptoUtil) ComputeMAC(ctx context.Context, data []byte) (string, error) {
+	if u.macProvider == nil {
+		return "", ErrMacKeysetNotConfigured
+	}
+	tag, err := u.macProvider.ComputeMAC(ctx, data)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawStdEncoding.EncodeToString(tag), nil
+}
+
+// VerifyMAC verifies a MAC of ComputeMAC.
+func (u *CryptoUtil) VerifyMAC(ctx context.Context, mac string, data []byte) error {
+	if u.macProvider == nil {
+		return ErrMacKeysetNotConfigured
+	}
+	tag, err := base64.RawStdEncoding.DecodeString(mac)
+	if err != nil {
+		return errors.Wrap(err, "unable to decode")
+	}
+	return u.macProvider.VerifyMAC(ctx, tag, data)
+}
+
+// DecryptHybrid decrypts a cipher text encrypted by a partner to the public
+// keys of the hybrid keyset, see EncryptWithPublicKeyset.
+func (u *CryptoUtil) DecryptHybrid(ctx context.Context, cipherText string, contextInfo []byte) ([]byte, error) {
+	if u.hybridProvider == nil {
+		return nil, ErrHybridKeysetNotConfigured
+	}
+	cipher, err := base64.RawStdEncoding.DecodeString(cipherText)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to decode")
+	}
+	return u.hybridProvider.Decrypt(ctx, cipher, contextInfo)
+}
+
+// HybridPublicKeyset returns the public keys of the hybrid keyset to be
+// shared with the partners encrypting to it.
+func (u *CryptoUtil) HybridPublicKeyset() (string, error) {
+	if u.hybridProvider == nil {
+		return "", ErrHybridKeysetNotConfigured
+	}
+	return u.hybridProvider.PublicKeyset()
+}
+
+// RotateKey makes a new key the primary encryption key of the keyset, see
+// encdec.TinkCryptoHandler.RotateKey.
+func (u *CryptoUtil) RotateKey(ctx context.Context) (uint32, error) {
+	return u.cryptoProvider.RotateKey(ctx)
+}
+
+// KeyUsage returns the number of decryptions by key of the keyset.
+func (u *CryptoUtil) KeyUsage() []encdec.KeyUsage {
+	return u.cryptoProvider.KeyUsage()
+}
+
 // GenerateAesKey generates an AES key.
 // It returns the AES key.
 func GenerateAesKey(ctx context.Context, key string) (string, error) {
@@ -110,6 +409,7 @@ func EncryptWithKey(ctx context.Context, key, plainText string) (string, error)
 	if err != nil {
 		return "", err
 	}
+	defer clear(keyBytes)
 	block, err := aes.NewCipher(keyBytes)
 	if err != nil {
 		return "", err
@@ -133,6 +433,21 @@ func EncryptWithKey(ctx context.Context, key, plainText string) (string, error)
 	return ciperText, nil
 }
 
+// EncryptWithPublicKeyset encrypts the given plain text to the public hybrid
+// keyset of a partner, who decrypts it with the private keyset.
+// It returns the encrypted value of the plain text.
+func EncryptWithPublicKeyset(ctx context.Context, publicKeySetData string, plainText, contextInfo []byte) (string, error) {
+	encrypter, err := encdec.NewTinkHybridEncrypter(publicKeySetData)
+	if err != nil {
+		return "", err
+	}
+	cipherText, err := encrypter.Encrypt(ctx, plainText, contextInfo)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawStdEncoding.EncodeToString(cipherText), nil
+}
+
 // DecryptWithKey decrypts the given cipher text with the given key.
 // It returns the decrypted value of the cipher text.
 func DecryptWithKey(ctx context.Context, key, cipeherText string) ([]byte, error) {
@@ -140,6 +455,7 @@ func DecryptWithKey(ctx context.Context, key, cipeherText string) ([]byte, error
 	if err != nil {
 		return nil, err
 	}
+	defer clear(keyBytes)
 
 	// We need to split the data using $
 	splitCipherText := strings.Split(cipeherText, "$$")
@@ -1,10 +1,15 @@
 package crypto
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"fmt"
+	"io"
+	"strings"
 	"testing"
 
+	"github.com/achuala/go-svc-extn/pkg/crypto/encdec"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -33,4 +38,139 @@ func TestAesEncDec(t *testing.T) {
 	plainText, err := cu.Decrypt(context.Background(), cipher, []byte("caas ad"))
 	require.NoError(t, err)
 	assert.Equal(t, plain, plainText)
+
+	raw, err := cu.EncryptBytes(context.Background(), plain, []byte("caas ad"))
+	require.NoError(t, err)
+	plainText, err = cu.DecryptBytes(context.Background(), raw, []byte("caas ad"))
+	require.NoError(t, err)
+	assert.Equal(t, plain, plainText)
+	_, err = cu.DecryptBytes(context.Background(), raw, []byte("other ad"))
+	assert.Error(t, err)
+}
+
+func TestDeterministicEncDec(t *testing.T) {
+	ctx := context.Background()
+	cu, err := NewCryptoUtil(cfg)
+	require.NoError(t, err)
+	_, err = cu.EncryptDeterministic(ctx, []byte("James Bond"), nil)
+	assert.ErrorIs(t, err, ErrDeterministicKeysetNotConfigured)
+
+	deterministicKeysetData, err := encdec.NewDeterministicKeyset(kmsUri, cfg.KekAd)
+	require.NoError(t, err)
+	dcfg := *cfg
+	dcfg.DeterministicKeysetData = deterministicKeysetData
+	cu, err = NewCryptoUtil(&dcfg)
+	require.NoError(t, err)
+
+	plain := []byte("James Bond")
+	cipher, err := cu.EncryptDeterministic(ctx, plain, []byte("caas ad"))
+	require.NoError(t, err)
+	again, err := cu.EncryptDeterministic(ctx, plain, []byte("caas ad"))
+	require.NoError(t, err)
+	assert.Equal(t, cipher, again)
+	other, err := cu.EncryptDeterministic(ctx, plain, []byte("other ad"))
+	require.NoError(t, err)
+	assert.NotEqual(t, cipher, other)
+
+	plainText, err := cu.DecryptDeterministic(ctx, cipher, []byte("caas ad"))
+	require.NoError(t, err)
+	assert.Equal(t, plain, plainText)
+}
+
+func TestStreamEncDec(t *testing.T) {
+	ctx := context.Background()
+	cu, err := NewCryptoUtil(cfg)
+	require.NoError(t, err)
+	_, err = cu.EncryptStream(ctx, io.Discard, strings.NewReader("James Bond"), nil)
+	assert.ErrorIs(t, err, ErrStreamingKeysetNotConfigured)
+
+	streamingKeysetData, err := encdec.NewStreamingKeyset(kmsUri, cfg.KekAd)
+	require.NoError(t, err)
+	scfg := *cfg
+	scfg.StreamingKeysetData = streamingKeysetData
+	cu, err = NewCryptoUtil(&scfg)
+	require.NoError(t, err)
+
+	// spans several segments
+	plain := bytes.Repeat([]byte("James Bond "), 2000)
+	cipher := new(bytes.Buffer)
+	n, err := cu.EncryptStream(ctx, cipher, bytes.NewReader(plain), []byte("caas ad"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(plain)), n)
+
+	decrypted := new(bytes.Buffer)
+	_, err = cu.DecryptStream(ctx, decrypted, bytes.NewReader(cipher.Bytes()), []byte("caas ad"))
+	require.NoError(t, err)
+	assert.Equal(t, plain, decrypted.Bytes())
+
+	_, err = cu.DecryptStream(ctx, io.Discard, bytes.NewReader(cipher.Bytes()[:cipher.Len()-1]), []byte("caas ad"))
+	assert.Error(t, err)
+	_, err = cu.DecryptStream(ctx, io.Discard, bytes.NewReader(cipher.Bytes()), []byte("other ad"))
+	assert.Error(t, err)
+}
+
+func TestSignAndMAC(t *testing.T) {
+	ctx := context.Background()
+	cu, err := NewCryptoUtil(cfg)
+	require.NoError(t, err)
+	_, err = cu.Sign(ctx, []byte("payload"))
+	assert.ErrorIs(t, err, ErrSignatureKeysetNotConfigured)
+	_, err = cu.ComputeMAC(ctx, []byte("payload"))
+	assert.ErrorIs(t, err, ErrMacKeysetNotConfigured)
+
+	signatureKeysetData, err := encdec.NewSignatureKeyset(encdec.SignatureEd25519, kmsUri, cfg.KekAd)
+	require.NoError(t, err)
+	macKeysetData, err := encdec.NewMACKeyset(kmsUri, cfg.KekAd)
+	require.NoError(t, err)
+	scfg := *cfg
+	scfg.SignatureKeysetData = signatureKeysetData
+	scfg.MacKeysetData = macKeysetData
+	cu, err = NewCryptoUtil(&scfg)
+	require.NoError(t, err)
+
+	sig, err := cu.Sign(ctx, []byte("payload"))
+	require.NoError(t, err)
+	require.NoError(t, cu.Verify(ctx, sig, []byte("payload")))
+	assert.Error(t, cu.Verify(ctx, sig, []byte("tampered")))
+
+	// verifiers only get the public keys
+	publicKeyset, err := cu.PublicKeyset()
+	require.NoError(t, err)
+	verifier, err := encdec.NewTinkSignatureVerifier(publicKeyset)
+	require.NoError(t, err)
+	rawSig, err := base64.RawStdEncoding.DecodeString(sig)
+	require.NoError(t, err)
+	require.NoError(t, verifier.Verify(ctx, rawSig, []byte("payload")))
+	_, err = verifier.Sign(ctx, []byte("payload"))
+	assert.ErrorIs(t, err, encdec.ErrSigningNotSupported)
+
+	tag, err := cu.ComputeMAC(ctx, []byte("payload"))
+	require.NoError(t, err)
+	require.NoError(t, cu.VerifyMAC(ctx, tag, []byte("payload")))
+	assert.Error(t, cu.VerifyMAC(ctx, tag, []byte("tampered")))
+}
+
+func TestHybridEncDec(t *testing.T) {
+	ctx := context.Background()
+	hybridKeysetData, err := encdec.NewHybridKeyset(encdec.HybridHPKEX25519, kmsUri, cfg.KekAd)
+	require.NoError(t, err)
+	hcfg := *cfg
+	hcfg.HybridKeysetData = hybridKeysetData
+	cu, err := NewCryptoUtil(&hcfg)
+	require.NoError(t, err)
+
+	publicKeyset, err := cu.HybridPublicKeyset()
+	require.NoError(t, err)
+	exported, err := encdec.ExportPublicKeyset(hybridKeysetData, kmsUri, cfg.KekAd)
+	require.NoError(t, err)
+	assert.Equal(t, publicKeyset, exported)
+
+	plain := []byte("James Bond")
+	cipher, err := EncryptWithPublicKeyset(ctx, publicKeyset, plain, []byte("statement"))
+	require.NoError(t, err)
+	plainText, err := cu.DecryptHybrid(ctx, cipher, []byte("statement"))
+	require.NoError(t, err)
+	assert.Equal(t, plain, plainText)
+	_, err = cu.DecryptHybrid(ctx, cipher, []byte("other"))
+	assert.Error(t, err)
 }
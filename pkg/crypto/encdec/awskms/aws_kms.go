@@ -0,0 +1,175 @@
+// Package awskms provides a Tink KMS client for AWS KMS key encryption keys.
+//
+// Register the client before creating the crypto handler so that KEK URIs of
+// the form aws-kms://arn:aws:kms:<region>:<account>:key/<key id> are resolved:
+//
+//	if err := awskms.Register(awskms.Prefix, &awskms.Config{}); err != nil {
+//		return err
+//	}
+//
+// KMS is called with the AWS SDK, which looks the credentials up with its
+// default chain unless Config.Credentials is set. The package is a separate
+// module so that the KMS client of the SDK is only a dependency of the
+// services using AWS KMS.
+package awskms
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/achuala/go-svc-extn/pkg/crypto/awssig"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/tink-crypto/tink-go/v2/core/registry"
+	"github.com/tink-crypto/tink-go/v2/tink"
+)
+
+// Prefix is the prefix of AWS KMS key URIs.
+const Prefix = "aws-kms://"
+
+var _ registry.KMSClient = (*Client)(nil)
+
+// Config configures the AWS KMS client, the region is taken from the key ARN.
+type Config struct {
+	// Credentials default to the default credentials chain of the AWS SDK,
+	// static credentials can be set with an awssig.Credentials.
+	Credentials awssig.CredentialsProvider
+	// Endpoint overrides the regional endpoint, e.g. for a VPC endpoint.
+	Endpoint string
+	// Timeout is the deadline of each KMS call, defaults to 10s.
+	Timeout time.Duration
+}
+
+// Client is a Tink KMS client for AWS KMS.
+type Client struct {
+	uriPrefix string
+	c         *Config
+	aws       aws.Config
+}
+
+// NewClient returns a client for the keys with the uriPrefix, which is either
+// Prefix for any key or the URI of a single key.
+func NewClient(uriPrefix string, c *Config) (*Client, error) {
+	if !strings.HasPrefix(strings.ToLower(uriPrefix), Prefix) {
+		return nil, fmt.Errorf("uriPrefix must start with %s, but got %s", Prefix, uriPrefix)
+	}
+	cfg := *c
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	var opts []func(*config.LoadOptions) error
+	if cfg.Credentials != nil {
+		opts = append(opts, config.WithCredentialsProvider(sdkCredentials(cfg.Credentials)))
+	}
+	awsCfg, err := config.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("awskms: load config: %w", err)
+	}
+	return &Client{uriPrefix: uriPrefix, c: &cfg, aws: awsCfg}, nil
+}
+
+// Register creates a client and registers it with the Tink KMS registry.
+func Register(uriPrefix string, c *Config) error {
+	client, err := NewClient(uriPrefix, c)
+	if err != nil {
+		return err
+	}
+	registry.RegisterKMSClient(client)
+	return nil
+}
+
+// Supported returns true if this client does support keyURI.
+func (c *Client) Supported(keyURI string) bool {
+	return strings.HasPrefix(keyURI, c.uriPrefix)
+}
+
+// GetAEAD returns an AEAD by keyURI.
+func (c *Client) GetAEAD(keyURI string) (tink.AEAD, error) {
+	if !c.Supported(keyURI) {
+		return nil, fmt.Errorf("keyURI must start with prefix %s, but got %s", c.uriPrefix, keyURI)
+	}
+	keyArn := strings.TrimPrefix(keyURI, Prefix)
+	// arn:aws:kms:<region>:<account>:key/<key id>
+	parts := strings.SplitN(keyArn, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" || parts[2] != "kms" || parts[3] == "" {
+		return nil, fmt.Errorf("invalid AWS KMS key ARN %s", keyArn)
+	}
+	client := kms.NewFromConfig(c.aws, func(o *kms.Options) {
+		o.Region = parts[3]
+		if c.c.Endpoint != "" {
+			o.BaseEndpoint = aws.String(c.c.Endpoint)
+		}
+	})
+	return &kmsAEAD{kms: client, keyArn: keyArn, timeout: c.c.Timeout}, nil
+}
+
+// kmsAEAD encrypts with the AWS KMS key, the associated data is bound to the
+// ciphertext as encryption context.
+type kmsAEAD struct {
+	kms     *kms.Client
+	keyArn  string
+	timeout time.Duration
+}
+
+func (a *kmsAEAD) Encrypt(plaintext, associatedData []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+	defer cancel()
+	out, err := a.kms.Encrypt(ctx, &kms.EncryptInput{
+		KeyId:             aws.String(a.keyArn),
+		Plaintext:         plaintext,
+		EncryptionContext: encryptionContext(associatedData),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("awskms: encrypt: %w", err)
+	}
+	return out.CiphertextBlob, nil
+}
+
+func (a *kmsAEAD) Decrypt(ciphertext, associatedData []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+	defer cancel()
+	out, err := a.kms.Decrypt(ctx, &kms.DecryptInput{
+		KeyId:             aws.String(a.keyArn),
+		CiphertextBlob:    ciphertext,
+		EncryptionContext: encryptionContext(associatedData),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("awskms: decrypt: %w", err)
+	}
+	// aliases are resolved by KMS, only key ARNs can be compared
+	if strings.Contains(a.keyArn, ":key/") && aws.ToString(out.KeyId) != a.keyArn {
+		return nil, fmt.Errorf("awskms: decrypt: ciphertext was encrypted with key %s", aws.ToString(out.KeyId))
+	}
+	return out.Plaintext, nil
+}
+
+// sdkCredentials adapts the credentials provider to the AWS SDK.
+func sdkCredentials(p awssig.CredentialsProvider) aws.CredentialsProvider {
+	return aws.NewCredentialsCache(aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		c, err := p.Retrieve(ctx)
+		if err != nil {
+			return aws.Credentials{}, err
+		}
+		return aws.Credentials{
+			AccessKeyID:     c.AccessKeyId,
+			SecretAccessKey: c.SecretAccessKey,
+			SessionToken:    c.SessionToken,
+			CanExpire:       !c.Expires.IsZero(),
+			Expires:         c.Expires,
+			Source:          "awssig",
+		}, nil
+	}))
+}
+
+// encryptionContext binds the associated data the same way as the Tink AWS
+// KMS integration so that ciphertexts are interchangeable.
+func encryptionContext(associatedData []byte) map[string]string {
+	if len(associatedData) == 0 {
+		return nil
+	}
+	return map[string]string{"associatedData": hex.EncodeToString(associatedData)}
+}
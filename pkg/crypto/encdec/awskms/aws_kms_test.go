@@ -0,0 +1,73 @@
+package awskms
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/achuala/go-svc-extn/pkg/crypto/awssig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const keyArn = "arn:aws:kms:eu-west-1:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+
+// fakeKMS "encrypts" by keeping the plaintext and encryption context of each
+// ciphertext blob.
+type fakeKMS struct {
+	blobs map[string]map[string]any
+}
+
+func (f *fakeKMS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") || !strings.Contains(auth, "/eu-west-1/kms/aws4_request, ") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	var req map[string]any
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	switch r.Header.Get("X-Amz-Target") {
+	case "TrentService.Encrypt":
+		blob := []byte("blob-" + req["Plaintext"].(string))
+		f.blobs[string(blob)] = req
+		_ = json.NewEncoder(w).Encode(map[string]any{"CiphertextBlob": blob, "KeyId": keyArn})
+	case "TrentService.Decrypt":
+		var blob []byte
+		_ = json.Unmarshal([]byte(`"`+req["CiphertextBlob"].(string)+`"`), &blob)
+		enc, ok := f.blobs[string(blob)]
+		if !ok || !reflect.DeepEqual(enc["EncryptionContext"], req["EncryptionContext"]) {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type":"InvalidCiphertextException"}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"Plaintext": enc["Plaintext"], "KeyId": keyArn})
+	}
+}
+
+func TestAwsKmsAEAD(t *testing.T) {
+	srv := httptest.NewServer(&fakeKMS{blobs: map[string]map[string]any{}})
+	defer srv.Close()
+
+	client, err := NewClient(Prefix, &Config{Credentials: awssig.Credentials{AccessKeyId: "AKID", SecretAccessKey: "secret"}, Endpoint: srv.URL})
+	require.NoError(t, err)
+	assert.True(t, client.Supported(Prefix+keyArn))
+	assert.False(t, client.Supported("gcp-kms://projects/p"))
+
+	a, err := client.GetAEAD(Prefix + keyArn)
+	require.NoError(t, err)
+	ciphertext, err := a.Encrypt([]byte("keyset"), []byte("ad"))
+	require.NoError(t, err)
+	plaintext, err := a.Decrypt(ciphertext, []byte("ad"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("keyset"), plaintext)
+	_, err = a.Decrypt(ciphertext, []byte("other"))
+	assert.Error(t, err)
+
+	_, err = client.GetAEAD(Prefix + "not-an-arn")
+	assert.Error(t, err)
+	_, err = NewClient("caas-kms://", &Config{})
+	assert.Error(t, err)
+}
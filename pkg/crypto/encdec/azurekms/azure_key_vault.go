@@ -0,0 +1,232 @@
+// Package azurekms provides a Tink KMS client for Azure Key Vault key
+// encryption keys.
+//
+// Register the client before creating the crypto handler so that KEK URIs of
+// the form azure-kv://<vault>.vault.azure.net/keys/<key>[/<version>] are
+// resolved:
+//
+//	if err := azurekms.Register(azurekms.Prefix, &azurekms.Config{}); err != nil {
+//		return err
+//	}
+//
+// Key Vault is called with the Azure SDK, authenticated with the
+// DefaultAzureCredential unless Config.Credential is set. The package is a
+// separate module so that the Azure SDK is only a dependency of the services
+// using Key Vault.
+package azurekms
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azkeys"
+	"github.com/tink-crypto/tink-go/v2/core/registry"
+	"github.com/tink-crypto/tink-go/v2/tink"
+)
+
+// Prefix is the prefix of Azure Key Vault key URIs.
+const Prefix = "azure-kv://"
+
+const ciphertextFormat = 1
+
+var (
+	_ registry.KMSClient = (*Client)(nil)
+
+	errInvalidCiphertext = errors.New("azurekms: invalid ciphertext")
+)
+
+// Config configures the Azure Key Vault client.
+type Config struct {
+	// Credential authenticates the Key Vault calls, defaults to the
+	// DefaultAzureCredential of the Azure SDK: the environment, workload
+	// identity, managed identity and Azure CLI credentials.
+	Credential azcore.TokenCredential
+	// ClientId selects a user assigned managed identity instead of the
+	// default credential.
+	ClientId string
+	// ClientOptions are the options of the Key Vault clients, e.g. retries.
+	ClientOptions *azkeys.ClientOptions
+	// Timeout is the deadline of each Key Vault call, defaults to 10s.
+	Timeout time.Duration
+}
+
+// Client is a Tink KMS client for Azure Key Vault RSA keys.
+type Client struct {
+	uriPrefix string
+	c         *Config
+}
+
+// NewClient returns a client for the keys with the uriPrefix, which is either
+// Prefix for any key or the URI of a single key.
+func NewClient(uriPrefix string, c *Config) (*Client, error) {
+	if !strings.HasPrefix(strings.ToLower(uriPrefix), Prefix) {
+		return nil, fmt.Errorf("uriPrefix must start with %s, but got %s", Prefix, uriPrefix)
+	}
+	cfg := *c
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.Credential == nil {
+		var err error
+		if cfg.ClientId != "" {
+			cfg.Credential, err = azidentity.NewManagedIdentityCredential(&azidentity.ManagedIdentityCredentialOptions{ID: azidentity.ClientID(cfg.ClientId)})
+		} else {
+			cfg.Credential, err = azidentity.NewDefaultAzureCredential(nil)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("azurekms: credential: %w", err)
+		}
+	}
+	return &Client{uriPrefix: uriPrefix, c: &cfg}, nil
+}
+
+// Register creates a client and registers it with the Tink KMS registry.
+func Register(uriPrefix string, c *Config) error {
+	client, err := NewClient(uriPrefix, c)
+	if err != nil {
+		return err
+	}
+	registry.RegisterKMSClient(client)
+	return nil
+}
+
+// Supported returns true if this client does support keyURI.
+func (c *Client) Supported(keyURI string) bool {
+	return strings.HasPrefix(keyURI, c.uriPrefix)
+}
+
+// GetAEAD returns an AEAD by keyURI.
+func (c *Client) GetAEAD(keyURI string) (tink.AEAD, error) {
+	if !c.Supported(keyURI) {
+		return nil, fmt.Errorf("keyURI must start with prefix %s, but got %s", c.uriPrefix, keyURI)
+	}
+	host, path, _ := strings.Cut(strings.TrimPrefix(keyURI, Prefix), "/")
+	parts := strings.Split(path, "/")
+	if host == "" || len(parts) < 2 || len(parts) > 3 || parts[0] != "keys" || parts[1] == "" {
+		return nil, fmt.Errorf("invalid Azure Key Vault key URI %s", keyURI)
+	}
+	client, err := azkeys.NewClient("https://"+host, c.c.Credential, c.c.ClientOptions)
+	if err != nil {
+		return nil, fmt.Errorf("azurekms: %w", err)
+	}
+	a := &keyVaultAEAD{client: client, keyURL: "https://" + host + "/" + path, name: parts[1], timeout: c.c.Timeout}
+	if len(parts) == 3 {
+		a.version = parts[2]
+	}
+	return a, nil
+}
+
+// keyVaultAEAD is an envelope AEAD, a random AES-256-GCM data key encrypts the
+// plaintext with the associated data and is wrapped with the Key Vault key,
+// as Key Vault RSA keys do not support associated data. The ciphertext is
+//
+//	format(1) | len(kid)(2) | kid | len(wrapped key)(2) | wrapped key | nonce | AES-GCM ciphertext
+//
+// where kid is the versioned key id which wrapped the data key.
+type keyVaultAEAD struct {
+	client  *azkeys.Client
+	keyURL  string
+	name    string
+	version string
+	timeout time.Duration
+}
+
+func (a *keyVaultAEAD) Encrypt(plaintext, associatedData []byte) ([]byte, error) {
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+	defer cancel()
+	wrapped, err := a.client.WrapKey(ctx, a.name, a.version, wrapParameters(dek), nil)
+	if err != nil {
+		return nil, fmt.Errorf("azurekms: encrypt: %w", err)
+	}
+	if wrapped.KID == nil {
+		return nil, errors.New("azurekms: encrypt: response without key id")
+	}
+	kid := string(*wrapped.KID)
+	gcm, err := newGCM(dek)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	out := []byte{ciphertextFormat}
+	out = binary.BigEndian.AppendUint16(out, uint16(len(kid)))
+	out = append(out, kid...)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(wrapped.Result)))
+	out = append(out, wrapped.Result...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, plaintext, associatedData), nil
+}
+
+func (a *keyVaultAEAD) Decrypt(ciphertext, associatedData []byte) ([]byte, error) {
+	if len(ciphertext) < 1 || ciphertext[0] != ciphertextFormat {
+		return nil, errInvalidCiphertext
+	}
+	kid, rest, ok := readField(ciphertext[1:])
+	if !ok {
+		return nil, errInvalidCiphertext
+	}
+	wrappedKey, rest, ok := readField(rest)
+	if !ok {
+		return nil, errInvalidCiphertext
+	}
+	// only unwrap with a version of the configured key
+	id := azkeys.ID(kid)
+	if string(id) != a.keyURL && !strings.HasPrefix(string(id), a.keyURL+"/") {
+		return nil, fmt.Errorf("azurekms: decrypt: ciphertext was encrypted with key %s", id)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+	defer cancel()
+	unwrapped, err := a.client.UnwrapKey(ctx, id.Name(), id.Version(), wrapParameters(wrappedKey), nil)
+	if err != nil {
+		return nil, fmt.Errorf("azurekms: decrypt: %w", err)
+	}
+	gcm, err := newGCM(unwrapped.Result)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) < gcm.NonceSize() {
+		return nil, errInvalidCiphertext
+	}
+	return gcm.Open(nil, rest[:gcm.NonceSize()], rest[gcm.NonceSize():], associatedData)
+}
+
+func wrapParameters(value []byte) azkeys.KeyOperationParameters {
+	return azkeys.KeyOperationParameters{Algorithm: to.Ptr(azkeys.EncryptionAlgorithmRSAOAEP256), Value: value}
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// readField reads a field prefixed with its 2 byte length.
+func readField(b []byte) (field, rest []byte, ok bool) {
+	if len(b) < 2 {
+		return nil, nil, false
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return nil, nil, false
+	}
+	return b[2 : 2+n], b[2+n:], true
+}
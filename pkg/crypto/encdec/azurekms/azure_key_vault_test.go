@@ -0,0 +1,93 @@
+package azurekms
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azkeys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type staticCredential string
+
+func (c staticCredential) GetToken(context.Context, policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: string(c), ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+func TestKeyVaultAEAD(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	var srv *httptest.Server
+	srv = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the SDK authenticates after the challenge of the vault
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.Header().Set("WWW-Authenticate", `Bearer authorization="https://login.microsoftonline.com/tenant", resource="https://vault.azure.net"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var req map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		value, err := base64.RawURLEncoding.DecodeString(req["value"])
+		if err != nil || req["alg"] != "RSA-OAEP-256" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var out []byte
+		switch r.URL.Path {
+		case "/keys/kek/wrapkey":
+			out, err = rsa.EncryptOAEP(sha256.New(), rand.Reader, &key.PublicKey, value, nil)
+		case "/keys/kek/v1/unwrapkey":
+			out, err = rsa.DecryptOAEP(sha256.New(), rand.Reader, key, value, nil)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{"kid": srv.URL + "/keys/kek/v1", "value": base64.RawURLEncoding.EncodeToString(out)})
+	}))
+	defer srv.Close()
+
+	options := &azkeys.ClientOptions{DisableChallengeResourceVerification: true}
+	options.Transport = srv.Client()
+	client, err := NewClient(Prefix, &Config{Credential: staticCredential("token"), ClientOptions: options})
+	require.NoError(t, err)
+	host := strings.TrimPrefix(srv.URL, "https://")
+	a, err := client.GetAEAD(Prefix + host + "/keys/kek")
+	require.NoError(t, err)
+
+	ciphertext, err := a.Encrypt([]byte("keyset"), []byte("ad"))
+	require.NoError(t, err)
+	plaintext, err := a.Decrypt(ciphertext, []byte("ad"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("keyset"), plaintext)
+
+	_, err = a.Decrypt(ciphertext, []byte("other"))
+	assert.Error(t, err)
+	_, err = a.Decrypt(ciphertext[:20], []byte("ad"))
+	assert.Error(t, err)
+
+	// data keys are only unwrapped with the configured key
+	other, err := client.GetAEAD(Prefix + host + "/keys/other")
+	require.NoError(t, err)
+	_, err = other.Decrypt(ciphertext, []byte("ad"))
+	assert.ErrorContains(t, err, "encrypted with key")
+
+	_, err = client.GetAEAD(Prefix + host + "/secrets/kek")
+	assert.Error(t, err)
+}
@@ -7,9 +7,8 @@ import (
 	"strings"
 	"sync"
 
-	"github.com/tink-crypto/tink-go/v2/aead"
+	"github.com/tink-crypto/tink-go/v2/aead/subtle"
 	"github.com/tink-crypto/tink-go/v2/core/registry"
-	"github.com/tink-crypto/tink-go/v2/keyset"
 	"github.com/tink-crypto/tink-go/v2/tink"
 )
 
@@ -45,20 +44,16 @@ func (c *CustomKMSClient) GetAEAD(keyURI string) (tink.AEAD, error) {
 	keyID := strings.TrimPrefix(keyURI, customKmsPrefix)
 
 	c.keyMutex.RLock()
-	_, exists := c.keys[keyID]
+	keyMaterial, exists := c.keys[keyID]
 	c.keyMutex.RUnlock()
 
 	if !exists {
 		return nil, fmt.Errorf("key not found: %s", keyID)
 	}
 
-	kt := aead.AES256GCMKeyTemplate()
-	kh, err := keyset.NewHandle(kt)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create key handle: %v", err)
-	}
-
-	return aead.New(kh)
+	// The AEAD is derived from the stored key so that it decrypts what it
+	// encrypted with the same key, across calls and after an ImportKey.
+	return subtle.NewAESGCM(keyMaterial)
 }
 
 // CreateKey generates a new key and returns its URI
@@ -68,19 +63,68 @@ func (c *CustomKMSClient) CreateKey() (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("failed to generate random key: %v", err)
 	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate key id: %v", err)
+	}
 
-	keyID := base64.RawURLEncoding.EncodeToString(keyMaterial)
+	// The key id is random, the URI doesn't reveal the key material.
+	keyURI := customKmsPrefix + base64.RawURLEncoding.EncodeToString(id)
+	if err := c.ImportKey(keyURI, keyMaterial); err != nil {
+		return "", err
+	}
+	return keyURI, nil
+}
+
+// ImportKey stores the 256-bit key material under the key URI, e.g. to
+// restore a key exported with ExportKey.
+func (c *CustomKMSClient) ImportKey(keyURI string, keyMaterial []byte) error {
+	if !c.Supported(keyURI) {
+		return fmt.Errorf("unsupported key URI: %s", keyURI)
+	}
+	if len(keyMaterial) != keyLength {
+		return fmt.Errorf("key must be %d bytes, but got %d", keyLength, len(keyMaterial))
+	}
+
+	keyID := strings.TrimPrefix(keyURI, customKmsPrefix)
 
 	c.keyMutex.Lock()
-	c.keys[keyID] = keyMaterial
-	c.keyMutex.Unlock()
+	defer c.keyMutex.Unlock()
+	if _, exists := c.keys[keyID]; exists {
+		return fmt.Errorf("key already exists: %s", keyID)
+	}
+	c.keys[keyID] = append([]byte(nil), keyMaterial...)
+	return nil
+}
 
-	return customKmsPrefix + keyID, nil
+// ExportKey returns the key material of the key URI, to be kept in a secret
+// store and imported again with ImportKey.
+func (c *CustomKMSClient) ExportKey(keyURI string) ([]byte, error) {
+	if !c.Supported(keyURI) {
+		return nil, fmt.Errorf("unsupported key URI: %s", keyURI)
+	}
+
+	keyID := strings.TrimPrefix(keyURI, customKmsPrefix)
+
+	c.keyMutex.RLock()
+	defer c.keyMutex.RUnlock()
+	keyMaterial, exists := c.keys[keyID]
+	if !exists {
+		return nil, fmt.Errorf("key not found: %s", keyID)
+	}
+	return append([]byte(nil), keyMaterial...), nil
 }
 
 // RegisterCustomKMS registers the custom KMS client with Tink's registry
 func RegisterCustomKMS() error {
+	NewRegisteredCustomKMSClient()
+	return nil
+}
+
+// NewRegisteredCustomKMSClient registers a new custom KMS client with Tink's
+// registry and returns it, to create or import the keys the registry resolves
+func NewRegisteredCustomKMSClient() *CustomKMSClient {
 	kmsClient := NewCustomKMSClient()
 	registry.RegisterKMSClient(kmsClient)
-	return nil
+	return kmsClient
 }
@@ -0,0 +1,60 @@
+package encdec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tink-crypto/tink-go/v2/core/registry"
+)
+
+func TestCustomKMSClient(t *testing.T) {
+	client := NewCustomKMSClient()
+	keyURI, err := client.CreateKey()
+	require.NoError(t, err)
+
+	a, err := client.GetAEAD(keyURI)
+	require.NoError(t, err)
+	cipher, err := a.Encrypt([]byte("plain"), []byte("ad"))
+	require.NoError(t, err)
+
+	// a new AEAD of the same key decrypts
+	b, err := client.GetAEAD(keyURI)
+	require.NoError(t, err)
+	plain, err := b.Decrypt(cipher, []byte("ad"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("plain"), plain)
+	_, err = b.Decrypt(cipher, []byte("other ad"))
+	assert.Error(t, err)
+
+	// as does another client after an export and import
+	key, err := client.ExportKey(keyURI)
+	require.NoError(t, err)
+	other := NewCustomKMSClient()
+	require.NoError(t, other.ImportKey(keyURI, key))
+	assert.Error(t, other.ImportKey(keyURI, key))
+	c, err := other.GetAEAD(keyURI)
+	require.NoError(t, err)
+	plain, err = c.Decrypt(cipher, []byte("ad"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("plain"), plain)
+
+	_, err = other.GetAEAD(customKmsPrefix + "unknown")
+	assert.Error(t, err)
+	assert.Error(t, other.ImportKey(customKmsPrefix+"short", key[:16]))
+	_, err = other.ExportKey("caas-kms://key")
+	assert.Error(t, err)
+}
+
+func TestRegisterCustomKMS(t *testing.T) {
+	defer registry.ClearKMSClients()
+	require.NoError(t, RegisterCustomKMS())
+	client := NewRegisteredCustomKMSClient()
+	keyURI, err := client.CreateKey()
+	require.NoError(t, err)
+
+	registered, err := registry.GetKMSClient(keyURI)
+	require.NoError(t, err)
+	_, err = registered.GetAEAD(keyURI)
+	assert.NoError(t, err)
+}
@@ -15,3 +15,19 @@ type CryptoHandler interface {
 type CryptoProvider interface {
 	CryptoHandler(ctx context.Context) CryptoHandler
 }
+
+// SignatureHandler provides methods for signing data and verifying signatures
+type SignatureHandler interface {
+	// Signs the data and returns the signature
+	Sign(ctx context.Context, data []byte) ([]byte, error)
+	// Verifies the signature of the data
+	Verify(ctx context.Context, signature, data []byte) error
+}
+
+// MACHandler provides methods for computing and verifying message authentication codes
+type MACHandler interface {
+	// Computes the MAC of the data
+	ComputeMAC(ctx context.Context, data []byte) ([]byte, error)
+	// Verifies the MAC of the data
+	VerifyMAC(ctx context.Context, mac, data []byte) error
+}
@@ -0,0 +1,113 @@
+// Package gcpkms provides a Tink KMS client for Google Cloud KMS key
+// encryption keys.
+//
+// Register the client before creating the crypto handler so that KEK URIs of
+// the form gcp-kms://projects/<project>/locations/<location>/keyRings/<ring>/cryptoKeys/<key>
+// are resolved:
+//
+//	if err := gcpkms.Register(gcpkms.Prefix, &gcpkms.Config{}); err != nil {
+//		return err
+//	}
+//
+// The keys are used with the Tink Cloud KMS integration, authenticated with
+// the Application Default Credentials unless Config.TokenSource is set. The
+// package is a separate module so that the Google API client is only a
+// dependency of the services using Cloud KMS.
+package gcpkms
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+	"github.com/tink-crypto/tink-go/v2/core/registry"
+	"github.com/tink-crypto/tink-go/v2/tink"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/cloudkms/v1"
+	"google.golang.org/api/option"
+)
+
+// Prefix is the prefix of Google Cloud KMS key URIs.
+const Prefix = "gcp-kms://"
+
+var _ registry.KMSClient = (*Client)(nil)
+
+// Config configures the Google Cloud KMS client.
+type Config struct {
+	// TokenSource returns the OAuth2 access token, defaults to the token of
+	// the Application Default Credentials: the GOOGLE_APPLICATION_CREDENTIALS
+	// file, the gcloud credentials or the service account of the instance.
+	TokenSource oauth2.TokenSource
+	// Endpoint overrides the API endpoint, defaults to https://cloudkms.googleapis.com/.
+	Endpoint string
+	// Timeout is the deadline of each Cloud KMS call, defaults to 10s.
+	Timeout time.Duration
+}
+
+// Client is a Tink KMS client for Google Cloud KMS.
+type Client struct {
+	kms registry.KMSClient
+}
+
+// NewClient returns a client for the keys with the uriPrefix, which is either
+// Prefix for any key or the URI of a single key.
+func NewClient(uriPrefix string, c *Config) (*Client, error) {
+	if !strings.HasPrefix(strings.ToLower(uriPrefix), Prefix) {
+		return nil, fmt.Errorf("uriPrefix must start with %s, but got %s", Prefix, uriPrefix)
+	}
+	cfg := *c
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	ctx := context.Background()
+	if cfg.TokenSource == nil {
+		creds, err := google.FindDefaultCredentials(ctx, cloudkms.CloudPlatformScope)
+		if err != nil {
+			return nil, fmt.Errorf("gcpkms: default credentials: %w", err)
+		}
+		cfg.TokenSource = creds.TokenSource
+	}
+	// the Tink AEAD calls Cloud KMS without a context, the timeout of the
+	// HTTP client is the deadline of each call
+	httpClient := oauth2.NewClient(ctx, cfg.TokenSource)
+	httpClient.Timeout = cfg.Timeout
+	opts := []option.ClientOption{option.WithHTTPClient(httpClient)}
+	if cfg.Endpoint != "" {
+		opts = append(opts, option.WithEndpoint(cfg.Endpoint))
+	}
+	kms, err := gcpkms.NewClientWithOptions(ctx, uriPrefix, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("gcpkms: %w", err)
+	}
+	return &Client{kms: kms}, nil
+}
+
+// Register creates a client and registers it with the Tink KMS registry.
+func Register(uriPrefix string, c *Config) error {
+	client, err := NewClient(uriPrefix, c)
+	if err != nil {
+		return err
+	}
+	registry.RegisterKMSClient(client)
+	return nil
+}
+
+// Supported returns true if this client does support keyURI.
+func (c *Client) Supported(keyURI string) bool {
+	return c.kms.Supported(keyURI)
+}
+
+// GetAEAD returns an AEAD by keyURI. The AEAD passes the associated data to
+// Cloud KMS as additional authenticated data and verifies the CRC32C
+// checksums of the requests and responses.
+func (c *Client) GetAEAD(keyURI string) (tink.AEAD, error) {
+	name := strings.TrimPrefix(keyURI, Prefix)
+	parts := strings.Split(name, "/")
+	if len(parts) != 8 || parts[0] != "projects" || parts[2] != "locations" || parts[4] != "keyRings" || parts[6] != "cryptoKeys" {
+		return nil, fmt.Errorf("invalid Google Cloud KMS key name %s", name)
+	}
+	return c.kms.GetAEAD(keyURI)
+}
@@ -0,0 +1,79 @@
+package gcpkms
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"hash/crc32"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+const keyName = "projects/p1/locations/global/keyRings/ring/cryptoKeys/kek"
+
+func checksum(b []byte) string {
+	return strconv.FormatInt(int64(crc32.Checksum(b, crc32.MakeTable(crc32.Castagnoli))), 10)
+}
+
+func TestGcpKmsAEAD(t *testing.T) {
+	aad := map[string][]byte{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var req map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		decode := func(field string) []byte {
+			b, _ := base64.URLEncoding.DecodeString(req[field])
+			return b
+		}
+		switch r.URL.Path {
+		case "/v1/" + keyName + ":encrypt":
+			ciphertext := append([]byte("enc-"), decode("plaintext")...)
+			aad[string(ciphertext)] = decode("additionalAuthenticatedData")
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"ciphertext":              base64.StdEncoding.EncodeToString(ciphertext),
+				"ciphertextCrc32c":        checksum(ciphertext),
+				"verifiedPlaintextCrc32c": true,
+				"verifiedAdditionalAuthenticatedDataCrc32c": true,
+			})
+		case "/v1/" + keyName + ":decrypt":
+			ciphertext := decode("ciphertext")
+			expected, ok := aad[string(ciphertext)]
+			if !ok || string(expected) != string(decode("additionalAuthenticatedData")) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			plaintext := ciphertext[4:]
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"plaintext":       base64.StdEncoding.EncodeToString(plaintext),
+				"plaintextCrc32c": checksum(plaintext),
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(Prefix, &Config{Endpoint: srv.URL + "/", TokenSource: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"})})
+	require.NoError(t, err)
+	a, err := client.GetAEAD(Prefix + keyName)
+	require.NoError(t, err)
+
+	ciphertext, err := a.Encrypt([]byte("keyset"), []byte("ad"))
+	require.NoError(t, err)
+	plaintext, err := a.Decrypt(ciphertext, []byte("ad"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("keyset"), plaintext)
+	_, err = a.Decrypt(ciphertext, []byte("other"))
+	assert.Error(t, err)
+
+	_, err = client.GetAEAD(Prefix + "projects/p1/cryptoKeys/kek")
+	assert.Error(t, err)
+}
@@ -0,0 +1,312 @@
+package encdec
+
+import (
+	"context"
+	stdcrypto "crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"math/big"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/tink-crypto/tink-go/v2/insecurecleartextkeyset"
+	"github.com/tink-crypto/tink-go/v2/keyset"
+	commonpb "github.com/tink-crypto/tink-go/v2/proto/common_go_proto"
+	ecdsapb "github.com/tink-crypto/tink-go/v2/proto/ecdsa_go_proto"
+	eciespb "github.com/tink-crypto/tink-go/v2/proto/ecies_aead_hkdf_go_proto"
+	ed25519pb "github.com/tink-crypto/tink-go/v2/proto/ed25519_go_proto"
+	hpkepb "github.com/tink-crypto/tink-go/v2/proto/hpke_go_proto"
+	tinkpb "github.com/tink-crypto/tink-go/v2/proto/tink_go_proto"
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrUnsupportedJOSEKey is returned when the primary key of a keyset has no
+// JOSE equivalent, e.g. an ECDSA key with a non standard hash or a key with
+// the legacy output prefix.
+var ErrUnsupportedJOSEKey = errors.New("key not supported by JOSE")
+
+// ErrUnknownJOSEKey is returned by ECDH for a key id not in the keyset.
+var ErrUnknownJOSEKey = errors.New("unknown JOSE key id")
+
+// JOSEKey is a public key of a keyset usable with JWS or JWE. The key id is
+// the base64 URL encoded Tink key id.
+type JOSEKey struct {
+	Kid string
+	// Alg is the JWS algorithm of signature keys, empty for the key
+	// agreement keys of hybrid keysets.
+	Alg string
+	// Key is an ed25519.PublicKey or *ecdsa.PublicKey for signature keys and
+	// an *ecdh.PublicKey for key agreement keys.
+	Key     stdcrypto.PublicKey
+	Primary bool
+}
+
+// SignJOSE signs the JWS signing input with the primary key of the keyset.
+// It returns the signature in its JWS encoding, the alg and kid header
+// parameters are those of the primary JOSEKey.
+func (h *TinkSignatureHandler) SignJOSE(ctx context.Context, signingInput []byte) ([]byte, error) {
+	if h.signer == nil {
+		return nil, ErrSigningNotSupported
+	}
+	if h.jws == nil {
+		return nil, ErrUnsupportedJOSEKey
+	}
+	sig, err := h.Sign(ctx, signingInput)
+	if err != nil {
+		return nil, err
+	}
+	if h.jws.prefixed {
+		sig = sig[5:]
+	}
+	if h.jws.der {
+		return derToP1363(sig, h.jws.size)
+	}
+	return sig, nil
+}
+
+// JOSEKeys returns the public keys of the keyset for the JWS verifiers, e.g.
+// to publish them as a JSON Web Key Set.
+func (h *TinkSignatureHandler) JOSEKeys() ([]JOSEKey, error) {
+	return publicJOSEKeys(h.public)
+}
+
+// JOSEKeys returns the public keys of the keyset the JWE senders agree a
+// content encryption key with.
+func (h *TinkHybridHandler) JOSEKeys() ([]JOSEKey, error) {
+	return publicJOSEKeys(h.public)
+}
+
+// ECDH computes the ECDH-ES shared secret of the key with the given key id,
+// the primary key when empty, and the ephemeral public key of a JWE.
+func (h *TinkHybridHandler) ECDH(kid string, ephemeral *ecdh.PublicKey) ([]byte, error) {
+	if kid == "" {
+		kid = h.primaryKid
+	}
+	key, ok := h.ecdhKeys[kid]
+	if !ok {
+		return nil, ErrUnknownJOSEKey
+	}
+	z, err := key.ECDH(ephemeral)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to agree key")
+	}
+	return z, nil
+}
+
+func joseKid(keyId uint32) string {
+	return base64.RawURLEncoding.EncodeToString(binary.BigEndian.AppendUint32(nil, keyId))
+}
+
+// jwsKey is the primary key of a signature keyset with the conversion of its
+// Tink signatures to JWS signatures.
+type jwsKey struct {
+	JOSEKey
+	// prefixed signatures start with the 5 byte Tink output prefix
+	prefixed bool
+	// der signatures are converted to the fixed size r || s of JWS
+	der  bool
+	size int
+}
+
+func publicJOSEKeys(public *keyset.Handle) ([]JOSEKey, error) {
+	keys, err := joseKeys(public)
+	if err != nil {
+		return nil, err
+	}
+	pub := make([]JOSEKey, 0, len(keys))
+	for _, key := range keys {
+		pub = append(pub, key.JOSEKey)
+	}
+	return pub, nil
+}
+
+// primaryJWSKey returns the primary key of a public signature keyset, nil
+// when it has no JWS algorithm.
+func primaryJWSKey(public *keyset.Handle) (*jwsKey, error) {
+	keys, err := joseKeys(public)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if key.Primary && key.Alg != "" {
+			return &key, nil
+		}
+	}
+	return nil, nil
+}
+
+// joseKeys returns the enabled keys of a public keyset which have a JOSE
+// equivalent, the other keys are skipped.
+func joseKeys(public *keyset.Handle) ([]jwsKey, error) {
+	mem := &keyset.MemReaderWriter{}
+	if err := public.WriteWithNoSecrets(mem); err != nil {
+		return nil, errors.Wrap(err, "unable to read public keyset")
+	}
+	var keys []jwsKey
+	for _, key := range mem.Keyset.GetKey() {
+		if key.GetStatus() != tinkpb.KeyStatusType_ENABLED {
+			continue
+		}
+		k, err := joseKey(key.GetKeyData())
+		if err != nil {
+			return nil, err
+		}
+		if k == nil {
+			continue
+		}
+		if k.Alg != "" {
+			switch key.GetOutputPrefixType() {
+			case tinkpb.OutputPrefixType_TINK, tinkpb.OutputPrefixType_CRUNCHY:
+				k.prefixed = true
+			case tinkpb.OutputPrefixType_RAW:
+			default:
+				// legacy signatures are computed over data || 0x00
+				continue
+			}
+		}
+		k.Kid = joseKid(key.GetKeyId())
+		k.Primary = key.GetKeyId() == mem.Keyset.GetPrimaryKeyId()
+		keys = append(keys, *k)
+	}
+	return keys, nil
+}
+
+func joseKey(kd *tinkpb.KeyData) (*jwsKey, error) {
+	typeUrl := kd.GetTypeUrl()
+	switch {
+	case strings.HasSuffix(typeUrl, ".Ed25519PublicKey"):
+		var key ed25519pb.Ed25519PublicKey
+		if err := proto.Unmarshal(kd.GetValue(), &key); err != nil {
+			return nil, errors.Wrap(err, "unable to parse key")
+		}
+		return &jwsKey{JOSEKey: JOSEKey{Alg: "EdDSA", Key: ed25519.PublicKey(key.GetKeyValue())}}, nil
+	case strings.HasSuffix(typeUrl, ".EcdsaPublicKey"):
+		var key ecdsapb.EcdsaPublicKey
+		if err := proto.Unmarshal(kd.GetValue(), &key); err != nil {
+			return nil, errors.Wrap(err, "unable to parse key")
+		}
+		var curve elliptic.Curve
+		var alg string
+		switch p := key.GetParams(); {
+		case p.GetCurve() == commonpb.EllipticCurveType_NIST_P256 && p.GetHashType() == commonpb.HashType_SHA256:
+			curve, alg = elliptic.P256(), "ES256"
+		case p.GetCurve() == commonpb.EllipticCurveType_NIST_P384 && p.GetHashType() == commonpb.HashType_SHA384:
+			curve, alg = elliptic.P384(), "ES384"
+		case p.GetCurve() == commonpb.EllipticCurveType_NIST_P521 && p.GetHashType() == commonpb.HashType_SHA512:
+			curve, alg = elliptic.P521(), "ES512"
+		default:
+			return nil, nil
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(key.GetX()), Y: new(big.Int).SetBytes(key.GetY())}
+		return &jwsKey{JOSEKey: JOSEKey{Alg: alg, Key: pub}, der: key.GetParams().GetEncoding() == ecdsapb.EcdsaSignatureEncoding_DER,
+			size: (curve.Params().BitSize + 7) / 8}, nil
+	case strings.HasSuffix(typeUrl, ".EciesAeadHkdfPublicKey"):
+		var key eciespb.EciesAeadHkdfPublicKey
+		if err := proto.Unmarshal(kd.GetValue(), &key); err != nil {
+			return nil, errors.Wrap(err, "unable to parse key")
+		}
+		if key.GetParams().GetKemParams().GetCurveType() != commonpb.EllipticCurveType_NIST_P256 {
+			return nil, nil
+		}
+		point := append([]byte{4}, fixedSize(key.GetX(), 32)...)
+		pub, err := ecdh.P256().NewPublicKey(append(point, fixedSize(key.GetY(), 32)...))
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to parse key")
+		}
+		return &jwsKey{JOSEKey: JOSEKey{Key: pub}}, nil
+	case strings.HasSuffix(typeUrl, ".HpkePublicKey"):
+		var key hpkepb.HpkePublicKey
+		if err := proto.Unmarshal(kd.GetValue(), &key); err != nil {
+			return nil, errors.Wrap(err, "unable to parse key")
+		}
+		curve := hpkeCurve(key.GetParams())
+		if curve == nil {
+			return nil, nil
+		}
+		pub, err := curve.NewPublicKey(key.GetPublicKey())
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to parse key")
+		}
+		return &jwsKey{JOSEKey: JOSEKey{Key: pub}}, nil
+	}
+	return nil, nil
+}
+
+// ecdhKeys returns the private key agreement keys of a hybrid keyset by
+// JOSE key id.
+func ecdhKeys(handle *keyset.Handle) (map[string]*ecdh.PrivateKey, error) {
+	ks := insecurecleartextkeyset.KeysetMaterial(handle)
+	keys := make(map[string]*ecdh.PrivateKey)
+	for _, key := range ks.GetKey() {
+		if key.GetStatus() != tinkpb.KeyStatusType_ENABLED {
+			continue
+		}
+		var priv *ecdh.PrivateKey
+		var err error
+		switch typeUrl := key.GetKeyData().GetTypeUrl(); {
+		case strings.HasSuffix(typeUrl, ".EciesAeadHkdfPrivateKey"):
+			var k eciespb.EciesAeadHkdfPrivateKey
+			if err := proto.Unmarshal(key.GetKeyData().GetValue(), &k); err != nil {
+				return nil, errors.Wrap(err, "unable to parse key")
+			}
+			if k.GetPublicKey().GetParams().GetKemParams().GetCurveType() != commonpb.EllipticCurveType_NIST_P256 {
+				continue
+			}
+			priv, err = ecdh.P256().NewPrivateKey(fixedSize(k.GetKeyValue(), 32))
+		case strings.HasSuffix(typeUrl, ".HpkePrivateKey"):
+			var k hpkepb.HpkePrivateKey
+			if err := proto.Unmarshal(key.GetKeyData().GetValue(), &k); err != nil {
+				return nil, errors.Wrap(err, "unable to parse key")
+			}
+			curve := hpkeCurve(k.GetPublicKey().GetParams())
+			if curve == nil {
+				continue
+			}
+			priv, err = curve.NewPrivateKey(k.GetPrivateKey())
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to parse key")
+		}
+		keys[joseKid(key.GetKeyId())] = priv
+	}
+	return keys, nil
+}
+
+func hpkeCurve(params *hpkepb.HpkeParams) ecdh.Curve {
+	switch params.GetKem() {
+	case hpkepb.HpkeKem_DHKEM_X25519_HKDF_SHA256:
+		return ecdh.X25519()
+	case hpkepb.HpkeKem_DHKEM_P256_HKDF_SHA256:
+		return ecdh.P256()
+	case hpkepb.HpkeKem_DHKEM_P384_HKDF_SHA384:
+		return ecdh.P384()
+	case hpkepb.HpkeKem_DHKEM_P521_HKDF_SHA512:
+		return ecdh.P521()
+	}
+	return nil
+}
+
+// fixedSize left pads or trims the leading zeros of a big endian integer,
+// Tink may encode coordinates with an extra leading zero.
+func fixedSize(b []byte, size int) []byte {
+	return new(big.Int).SetBytes(b).FillBytes(make([]byte, size))
+}
+
+// derToP1363 converts an ASN.1 ECDSA signature to the r || s encoding of JWS.
+func derToP1363(sig []byte, size int) ([]byte, error) {
+	var rs struct{ R, S *big.Int }
+	if rest, err := asn1.Unmarshal(sig, &rs); err != nil || len(rest) > 0 {
+		return nil, errors.New("malformed ECDSA signature")
+	}
+	out := make([]byte, 2*size)
+	rs.R.FillBytes(out[:size])
+	rs.S.FillBytes(out[size:])
+	return out, nil
+}
@@ -0,0 +1,263 @@
+package encdec
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/tink-crypto/tink-go/v2/aead"
+	"github.com/tink-crypto/tink-go/v2/daead"
+	"github.com/tink-crypto/tink-go/v2/hybrid"
+	"github.com/tink-crypto/tink-go/v2/keyset"
+	"github.com/tink-crypto/tink-go/v2/mac"
+	tinkpb "github.com/tink-crypto/tink-go/v2/proto/tink_go_proto"
+	"github.com/tink-crypto/tink-go/v2/signature"
+	"github.com/tink-crypto/tink-go/v2/streamingaead"
+	"github.com/tink-crypto/tink-go/v2/tink"
+)
+
+// The helpers below produce and maintain the KeySetData of TinkConfiguration:
+// an AEAD keyset encrypted under the key encryption key with the associated
+// data, binary encoded and base64 URL encoded without padding. The KEK URI is
+// resolved the same way as by NewTinkCryptoHandler.
+
+// NewKeyset generates an AES256-GCM keyset encrypted under the KEK.
+func NewKeyset(kekUri string, kekAd []byte) (string, error) {
+	return newKeyset(aead.AES256GCMKeyTemplate(), kekUri, kekAd)
+}
+
+// NewDeterministicKeyset generates an AES-SIV keyset for deterministic
+// encryption encrypted under the KEK.
+func NewDeterministicKeyset(kekUri string, kekAd []byte) (string, error) {
+	return newKeyset(daead.AESSIVKeyTemplate(), kekUri, kekAd)
+}
+
+// NewStreamingKeyset generates an AES256-GCM-HKDF streaming keyset encrypted
+// under the KEK.
+func NewStreamingKeyset(kekUri string, kekAd []byte) (string, error) {
+	return newKeyset(streamingaead.AES256GCMHKDF4KBKeyTemplate(), kekUri, kekAd)
+}
+
+// Signature keyset algorithms of NewSignatureKeyset.
+const (
+	SignatureEd25519   = "ed25519"
+	SignatureECDSAP256 = "ecdsa-p256"
+)
+
+// NewSignatureKeyset generates a private Ed25519 or ECDSA P-256 signature
+// keyset encrypted under the KEK.
+func NewSignatureKeyset(algorithm, kekUri string, kekAd []byte) (string, error) {
+	switch algorithm {
+	case SignatureEd25519:
+		return newKeyset(signature.ED25519KeyTemplate(), kekUri, kekAd)
+	case SignatureECDSAP256:
+		return newKeyset(signature.ECDSAP256KeyTemplate(), kekUri, kekAd)
+	default:
+		return "", errors.Errorf("unsupported signature algorithm %s", algorithm)
+	}
+}
+
+// Hybrid keyset algorithms of NewHybridKeyset.
+const (
+	HybridHPKEX25519 = "hpke-x25519"
+	HybridECIESP256  = "ecies-p256"
+)
+
+// NewHybridKeyset generates a private HPKE X25519 or ECIES P-256 hybrid
+// encryption keyset encrypted under the KEK. Partners encrypt to its public
+// keyset, see ExportPublicKeyset.
+func NewHybridKeyset(algorithm, kekUri string, kekAd []byte) (string, error) {
+	switch algorithm {
+	case HybridHPKEX25519:
+		return newKeyset(hybrid.DHKEM_X25519_HKDF_SHA256_HKDF_SHA256_AES_256_GCM_Key_Template(), kekUri, kekAd)
+	case HybridECIESP256:
+		return newKeyset(hybrid.ECIESHKDFAES128GCMKeyTemplate(), kekUri, kekAd)
+	default:
+		return "", errors.Errorf("unsupported hybrid algorithm %s", algorithm)
+	}
+}
+
+// NewMACKeyset generates an HMAC-SHA256 keyset encrypted under the KEK.
+func NewMACKeyset(kekUri string, kekAd []byte) (string, error) {
+	return newKeyset(mac.HMACSHA256Tag256KeyTemplate(), kekUri, kekAd)
+}
+
+func newKeyset(template *tinkpb.KeyTemplate, kekUri string, kekAd []byte) (string, error) {
+	handle, err := keyset.NewHandle(template)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to generate keyset")
+	}
+	return writeKeyset(handle, kekUri, kekAd)
+}
+
+// RotateKeyset adds a new key of the type of the primary key to the keyset and makes it the primary key. The previous keys are
+// kept so that existing ciphertexts can still be decrypted.
+func RotateKeyset(keySetData, kekUri string, kekAd []byte) (string, error) {
+	handle, err := readKeyset(keySetData, kekUri, kekAd)
+	if err != nil {
+		return "", err
+	}
+	manager := keyset.NewManagerFromHandle(handle)
+	keyId, err := manager.Add(rotationTemplate(handle))
+	if err != nil {
+		return "", errors.Wrap(err, "unable to add key")
+	}
+	if err := manager.SetPrimary(keyId); err != nil {
+		return "", errors.Wrap(err, "unable to set primary key")
+	}
+	rotated, err := manager.Handle()
+	if err != nil {
+		return "", errors.Wrap(err, "unable to rotate keyset")
+	}
+	return writeKeyset(rotated, kekUri, kekAd)
+}
+
+// ReencryptKeyset decrypts the keyset with the old KEK and encrypts it under
+// the new KEK, e.g. when moving from caas-kms to a managed KMS.
+func ReencryptKeyset(keySetData, oldKekUri string, oldKekAd []byte, newKekUri string, newKekAd []byte) (string, error) {
+	handle, err := readKeyset(keySetData, oldKekUri, oldKekAd)
+	if err != nil {
+		return "", err
+	}
+	return writeKeyset(handle, newKekUri, newKekAd)
+}
+
+// KeysetInfo returns the ids and statuses of the keys in the keyset, without
+// the key material.
+func KeysetInfo(keySetData, kekUri string, kekAd []byte) (*tinkpb.KeysetInfo, error) {
+	handle, err := readKeyset(keySetData, kekUri, kekAd)
+	if err != nil {
+		return nil, err
+	}
+	return handle.KeysetInfo(), nil
+}
+
+// ExportPublicKeyset returns the public keys of a private signature or
+// hybrid keyset, unencrypted, binary encoded and base64 URL encoded without
+// padding. It is the only part of such a keyset to be shared with partners.
+func ExportPublicKeyset(keySetData, kekUri string, kekAd []byte) (string, error) {
+	handle, err := readKeyset(keySetData, kekUri, kekAd)
+	if err != nil {
+		return "", err
+	}
+	public, err := handle.Public()
+	if err != nil {
+		return "", errors.Wrap(err, "unable to get public keyset")
+	}
+	return writePublicKeyset(public)
+}
+
+// rotationTemplate returns the template of the keys added by a rotation.
+func rotationTemplate(handle *keyset.Handle) *tinkpb.KeyTemplate {
+	info := handle.KeysetInfo()
+	for _, key := range info.GetKeyInfo() {
+		if key.GetKeyId() != info.GetPrimaryKeyId() {
+			continue
+		}
+		switch {
+		case strings.HasSuffix(key.GetTypeUrl(), ".AesSivKey"):
+			return daead.AESSIVKeyTemplate()
+		case strings.HasSuffix(key.GetTypeUrl(), ".AesGcmHkdfStreamingKey"):
+			return streamingaead.AES256GCMHKDF4KBKeyTemplate()
+		case strings.HasSuffix(key.GetTypeUrl(), ".Ed25519PrivateKey"):
+			return signature.ED25519KeyTemplate()
+		case strings.HasSuffix(key.GetTypeUrl(), ".EcdsaPrivateKey"):
+			return signature.ECDSAP256KeyTemplate()
+		case strings.HasSuffix(key.GetTypeUrl(), ".HpkePrivateKey"):
+			return hybrid.DHKEM_X25519_HKDF_SHA256_HKDF_SHA256_AES_256_GCM_Key_Template()
+		case strings.HasSuffix(key.GetTypeUrl(), ".EciesAeadHkdfPrivateKey"):
+			return hybrid.ECIESHKDFAES128GCMKeyTemplate()
+		case strings.HasSuffix(key.GetTypeUrl(), ".HmacKey"):
+			return mac.HMACSHA256Tag256KeyTemplate()
+		}
+	}
+	return aead.AES256GCMKeyTemplate()
+}
+
+func kekAEAD(kekUri string) (tink.AEAD, error) {
+	client, err := kekClient(&TinkConfiguration{KekUri: kekUri})
+	if err != nil {
+		return nil, err
+	}
+	return client.GetAEAD(kekUri)
+}
+
+func readKeyset(keySetData, kekUri string, kekAd []byte) (*keyset.Handle, error) {
+	kek, err := kekAEAD(kekUri)
+	if err != nil {
+		return nil, err
+	}
+	return decryptKeyset(keySetData, kek, kekAd)
+}
+
+// loadKeyset decrypts the KeySetData of the configuration with its KEK.
+func loadKeyset(c *TinkConfiguration) (*keyset.Handle, error) {
+	kek, err := configuredKEK(c)
+	if err != nil {
+		return nil, err
+	}
+	return decryptKeyset(c.KeySetData, kek, c.KekAd)
+}
+
+// configuredKEK returns the KEK of the configuration, instrumented when a
+// meter is set.
+func configuredKEK(c *TinkConfiguration) (tink.AEAD, error) {
+	client, err := kekClient(c)
+	if err != nil {
+		return nil, err
+	}
+	kek, err := client.GetAEAD(c.KekUri)
+	if err != nil {
+		return nil, err
+	}
+	return instrumentKEK(kek, c)
+}
+
+func decryptKeyset(keySetData string, kek tink.AEAD, kekAd []byte) (*keyset.Handle, error) {
+	encryptedKeyset, err := base64.RawURLEncoding.DecodeString(keySetData)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to decode keyset")
+	}
+	handle, err := keyset.ReadWithAssociatedData(keyset.NewBinaryReader(bytes.NewReader(encryptedKeyset)), kek, kekAd)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to decrypt keyset")
+	}
+	return handle, nil
+}
+
+func writeKeyset(handle *keyset.Handle, kekUri string, kekAd []byte) (string, error) {
+	kek, err := kekAEAD(kekUri)
+	if err != nil {
+		return "", err
+	}
+	return encryptKeyset(handle, kek, kekAd)
+}
+
+func encryptKeyset(handle *keyset.Handle, kek tink.AEAD, kekAd []byte) (string, error) {
+	buf := new(bytes.Buffer)
+	if err := handle.WriteWithAssociatedData(keyset.NewBinaryWriter(buf), kek, kekAd); err != nil {
+		return "", errors.Wrap(err, "unable to encrypt keyset")
+	}
+	return base64.RawURLEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+func readPublicKeyset(publicKeySetData string) (*keyset.Handle, error) {
+	data, err := base64.RawURLEncoding.DecodeString(publicKeySetData)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to decode keyset")
+	}
+	handle, err := keyset.ReadWithNoSecrets(keyset.NewBinaryReader(bytes.NewReader(data)))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read public keyset")
+	}
+	return handle, nil
+}
+
+func writePublicKeyset(public *keyset.Handle) (string, error) {
+	buf := new(bytes.Buffer)
+	if err := public.WriteWithNoSecrets(keyset.NewBinaryWriter(buf)); err != nil {
+		return "", errors.Wrap(err, "unable to write public keyset")
+	}
+	return base64.RawURLEncoding.EncodeToString(buf.Bytes()), nil
+}
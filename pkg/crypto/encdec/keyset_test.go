@@ -0,0 +1,189 @@
+package encdec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeysetLifecycle(t *testing.T) {
+	ctx := context.Background()
+	kekUri, err := NewKeyURI()
+	require.NoError(t, err)
+	kekAd := []byte("kek ad")
+
+	keySetData, err := NewKeyset(kekUri, kekAd)
+	require.NoError(t, err)
+	handler, err := NewTinkCryptoHandler(&TinkConfiguration{KekUri: kekUri, KeySetData: keySetData, KekAd: kekAd})
+	require.NoError(t, err)
+	cipher, err := handler.Encrypt(ctx, []byte("plain"), []byte("ad"))
+	require.NoError(t, err)
+
+	_, err = KeysetInfo(keySetData, kekUri, []byte("other ad"))
+	assert.Error(t, err)
+
+	// existing ciphertexts are decrypted with the previous key after a rotation
+	rotated, err := RotateKeyset(keySetData, kekUri, kekAd)
+	require.NoError(t, err)
+	before, err := KeysetInfo(keySetData, kekUri, kekAd)
+	require.NoError(t, err)
+	after, err := KeysetInfo(rotated, kekUri, kekAd)
+	require.NoError(t, err)
+	assert.Len(t, after.GetKeyInfo(), 2)
+	assert.NotEqual(t, before.GetPrimaryKeyId(), after.GetPrimaryKeyId())
+
+	newKekUri, err := NewKeyURI()
+	require.NoError(t, err)
+	reencrypted, err := ReencryptKeyset(rotated, kekUri, kekAd, newKekUri, []byte("new kek ad"))
+	require.NoError(t, err)
+	_, err = KeysetInfo(reencrypted, kekUri, kekAd)
+	assert.Error(t, err)
+
+	handler, err = NewTinkCryptoHandler(&TinkConfiguration{KekUri: newKekUri, KeySetData: reencrypted, KekAd: []byte("new kek ad")})
+	require.NoError(t, err)
+	plain, err := handler.Decrypt(ctx, cipher, []byte("ad"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("plain"), plain)
+}
+
+func TestTinkCryptoHandlerRotateKey(t *testing.T) {
+	ctx := context.Background()
+	kekUri, err := NewKeyURI()
+	require.NoError(t, err)
+	keySetData, err := NewKeyset(kekUri, nil)
+	require.NoError(t, err)
+
+	var persisted string
+	handler, err := NewTinkCryptoHandler(&TinkConfiguration{KekUri: kekUri, KeySetData: keySetData,
+		OnKeyRotate: func(_ context.Context, keySetData string) error {
+			persisted = keySetData
+			return nil
+		}})
+	require.NoError(t, err)
+	defer handler.Close()
+
+	before, err := handler.Encrypt(ctx, []byte("before"), nil)
+	require.NoError(t, err)
+	keyId, err := handler.RotateKey(ctx)
+	require.NoError(t, err)
+	after, err := handler.Encrypt(ctx, []byte("after"), nil)
+	require.NoError(t, err)
+
+	for _, cipher := range [][]byte{before, after, before} {
+		_, err := handler.Decrypt(ctx, cipher, nil)
+		require.NoError(t, err)
+	}
+	usage := handler.KeyUsage()
+	require.Len(t, usage, 2)
+	for _, u := range usage {
+		if u.KeyId == keyId {
+			assert.True(t, u.Primary)
+			assert.Equal(t, uint64(1), u.Decrypts)
+		} else {
+			assert.False(t, u.Primary)
+			assert.Equal(t, uint64(2), u.Decrypts)
+		}
+	}
+
+	// other instances pick up the persisted keyset
+	other, err := NewTinkCryptoHandler(&TinkConfiguration{KekUri: kekUri, KeySetData: keySetData})
+	require.NoError(t, err)
+	_, err = other.Decrypt(ctx, after, nil)
+	assert.Error(t, err)
+	require.NoError(t, other.Reload(persisted))
+	plain, err := other.Decrypt(ctx, after, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("after"), plain)
+}
+
+func TestTinkCryptoHandlerRotateKeyRequiresHook(t *testing.T) {
+	kekUri, err := NewKeyURI()
+	require.NoError(t, err)
+	keySetData, err := NewKeyset(kekUri, nil)
+	require.NoError(t, err)
+
+	_, err = NewTinkCryptoHandler(&TinkConfiguration{KekUri: kekUri, KeySetData: keySetData, KeyRotationInterval: time.Hour})
+	assert.ErrorIs(t, err, ErrNoKeyRotateHook)
+
+	handler, err := NewTinkCryptoHandler(&TinkConfiguration{KekUri: kekUri, KeySetData: keySetData})
+	require.NoError(t, err)
+	_, err = handler.RotateKey(context.Background())
+	assert.ErrorIs(t, err, ErrNoKeyRotateHook)
+	assert.Len(t, handler.KeyUsage(), 1, "the keyset was rotated without being persisted")
+}
+
+// rotationLogger captures the messages of the scheduled rotations.
+type rotationLogger chan string
+
+func (l rotationLogger) Log(level log.Level, keyvals ...interface{}) error {
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		if keyvals[i] == log.DefaultMessageKey {
+			l <- fmt.Sprintf("%s %v", level, keyvals[i+1])
+		}
+	}
+	return nil
+}
+
+func TestTinkCryptoHandlerScheduledRotationFailure(t *testing.T) {
+	kekUri, err := NewKeyURI()
+	require.NoError(t, err)
+	keySetData, err := NewKeyset(kekUri, nil)
+	require.NoError(t, err)
+
+	logger := make(rotationLogger, 16)
+	deadlines := make(chan bool, 16)
+	handler, err := NewTinkCryptoHandler(&TinkConfiguration{KekUri: kekUri, KeySetData: keySetData,
+		KeyRotationInterval: 10 * time.Millisecond, KeyRotationTimeout: time.Second, Logger: logger,
+		OnKeyRotate: func(ctx context.Context, _ string) error {
+			_, ok := ctx.Deadline()
+			deadlines <- ok
+			return errors.New("secret store unavailable")
+		}})
+	require.NoError(t, err)
+	defer handler.Close()
+
+	select {
+	case msg := <-logger:
+		assert.Contains(t, msg, "ERROR")
+		assert.Contains(t, msg, "secret store unavailable")
+	case <-time.After(5 * time.Second):
+		t.Fatal("failed rotation was not logged")
+	}
+	assert.True(t, <-deadlines, "scheduled rotation without deadline")
+	assert.Len(t, handler.KeyUsage(), 1)
+}
+
+func TestDeterministicKeyset(t *testing.T) {
+	ctx := context.Background()
+	kekUri, err := NewKeyURI()
+	require.NoError(t, err)
+	keySetData, err := NewDeterministicKeyset(kekUri, nil)
+	require.NoError(t, err)
+	handler, err := NewTinkDeterministicHandler(&TinkConfiguration{KekUri: kekUri, KeySetData: keySetData})
+	require.NoError(t, err)
+	cipher, err := handler.Encrypt(ctx, []byte("plain"), nil)
+	require.NoError(t, err)
+
+	// rotation keeps the key type of the keyset
+	rotated, err := RotateKeyset(keySetData, kekUri, nil)
+	require.NoError(t, err)
+	info, err := KeysetInfo(rotated, kekUri, nil)
+	require.NoError(t, err)
+	for _, key := range info.GetKeyInfo() {
+		assert.Contains(t, key.GetTypeUrl(), "AesSivKey")
+	}
+	handler, err = NewTinkDeterministicHandler(&TinkConfiguration{KekUri: kekUri, KeySetData: rotated})
+	require.NoError(t, err)
+	plain, err := handler.Decrypt(ctx, cipher, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("plain"), plain)
+	again, err := handler.Encrypt(ctx, []byte("plain"), nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, cipher, again)
+}
@@ -0,0 +1,125 @@
+package encdec
+
+import (
+	"context"
+	"encoding/binary"
+	"strings"
+	"time"
+
+	"github.com/tink-crypto/tink-go/v2/tink"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// The handlers record the following instruments when TinkConfiguration.Meter
+// is set:
+//
+//   - crypto.operations, the operations by primitive, operation and outcome
+//   - crypto.bytes, the plain text bytes processed by primitive and operation
+//   - crypto.keyset.key_use, the successful operations by key id, to see
+//     when a rotated key no longer encrypts or decrypts anything
+//   - crypto.kms.duration, the latency of the KEK calls wrapping and
+//     unwrapping the keysets by KMS, operation and outcome
+type cryptoMetrics struct {
+	primitive  attribute.KeyValue
+	operations metric.Int64Counter
+	bytes      metric.Int64Counter
+	keyUse     metric.Int64Counter
+}
+
+// newCryptoMetrics returns nil without a meter, the methods of a nil
+// cryptoMetrics do nothing.
+func newCryptoMetrics(meter metric.Meter, primitive string) (*cryptoMetrics, error) {
+	if meter == nil {
+		return nil, nil
+	}
+	m := &cryptoMetrics{primitive: attribute.String("primitive", primitive)}
+	var err error
+	if m.operations, err = meter.Int64Counter("crypto.operations",
+		metric.WithDescription("Number of crypto operations by primitive, operation and outcome")); err != nil {
+		return nil, err
+	}
+	if m.bytes, err = meter.Int64Counter("crypto.bytes", metric.WithUnit("By"),
+		metric.WithDescription("Plain text bytes processed by primitive and operation")); err != nil {
+		return nil, err
+	}
+	if m.keyUse, err = meter.Int64Counter("crypto.keyset.key_use",
+		metric.WithDescription("Number of crypto operations by keyset key id")); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// record records an operation over n plain text bytes. The key id is read
+// from the Tink output prefix of the cipher text, signature or tag, it is
+// not recorded for outputs without prefix, e.g. streams.
+func (m *cryptoMetrics) record(ctx context.Context, operation string, n int, prefixed []byte, err error) {
+	if m == nil {
+		return
+	}
+	op := attribute.String("operation", operation)
+	if err != nil {
+		m.operations.Add(ctx, 1, metric.WithAttributes(m.primitive, op, attribute.String("outcome", "error")))
+		return
+	}
+	m.operations.Add(ctx, 1, metric.WithAttributes(m.primitive, op, attribute.String("outcome", "ok")))
+	m.bytes.Add(ctx, int64(n), metric.WithAttributes(m.primitive, op))
+	if keyId, ok := tinkKeyId(prefixed); ok {
+		m.keyUse.Add(ctx, 1, metric.WithAttributes(m.primitive, op, attribute.Int64("key_id", int64(keyId))))
+	}
+}
+
+// tinkKeyId returns the key id of a Tink output, which starts with a version
+// byte followed by the 4 byte key id.
+func tinkKeyId(b []byte) (uint32, bool) {
+	const tinkPrefixVersion = 1
+	if len(b) < 5 || b[0] != tinkPrefixVersion {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(b[1:5]), true
+}
+
+// instrumentedKEK records the latency and failures of the key encryption key,
+// for managed KMS keys every call is a remote call.
+type instrumentedKEK struct {
+	tink.AEAD
+	kms      attribute.KeyValue
+	duration metric.Float64Histogram
+}
+
+// instrumentKEK wraps the KEK of the configuration when a meter is set.
+func instrumentKEK(kek tink.AEAD, c *TinkConfiguration) (tink.AEAD, error) {
+	if c.Meter == nil {
+		return kek, nil
+	}
+	duration, err := c.Meter.Float64Histogram("crypto.kms.duration", metric.WithUnit("s"),
+		metric.WithDescription("Latency of the key encryption key calls by KMS, operation and outcome"))
+	if err != nil {
+		return nil, err
+	}
+	kms, _, _ := strings.Cut(strings.ToLower(c.KekUri), "://")
+	return &instrumentedKEK{AEAD: kek, kms: attribute.String("kms", kms), duration: duration}, nil
+}
+
+func (k *instrumentedKEK) Encrypt(plaintext, associatedData []byte) ([]byte, error) {
+	start := time.Now()
+	cipher, err := k.AEAD.Encrypt(plaintext, associatedData)
+	k.observe("wrap", start, err)
+	return cipher, err
+}
+
+func (k *instrumentedKEK) Decrypt(ciphertext, associatedData []byte) ([]byte, error) {
+	start := time.Now()
+	plain, err := k.AEAD.Decrypt(ciphertext, associatedData)
+	k.observe("unwrap", start, err)
+	return plain, err
+}
+
+func (k *instrumentedKEK) observe(operation string, start time.Time, err error) {
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	}
+	k.duration.Record(context.Background(), time.Since(start).Seconds(),
+		metric.WithAttributes(k.kms, attribute.String("operation", operation), attribute.String("outcome", outcome)))
+}
@@ -0,0 +1,90 @@
+package encdec
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+// testMeter counts the measurements by instrument name and attributes.
+type testMeter struct {
+	noop.Meter
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+type testCounter struct {
+	noop.Int64Counter
+	m    *testMeter
+	name string
+}
+
+type testHistogram struct {
+	noop.Float64Histogram
+	m    *testMeter
+	name string
+}
+
+func (m *testMeter) Int64Counter(name string, _ ...metric.Int64CounterOption) (metric.Int64Counter, error) {
+	return &testCounter{m: m, name: name}, nil
+}
+
+func (m *testMeter) Float64Histogram(name string, _ ...metric.Float64HistogramOption) (metric.Float64Histogram, error) {
+	return &testHistogram{m: m, name: name}, nil
+}
+
+func (m *testMeter) add(name string, attrs string, incr int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counts[name+"{"+attrs+"}"] += incr
+}
+
+func (c *testCounter) Add(_ context.Context, incr int64, opts ...metric.AddOption) {
+	attrs := metric.NewAddConfig(opts).Attributes()
+	c.m.add(c.name, attrs.Encoded(attribute.DefaultEncoder()), incr)
+}
+
+func (h *testHistogram) Record(_ context.Context, _ float64, opts ...metric.RecordOption) {
+	attrs := metric.NewRecordConfig(opts).Attributes()
+	h.m.add(h.name, attrs.Encoded(attribute.DefaultEncoder()), 1)
+}
+
+func TestMetrics(t *testing.T) {
+	ctx := context.Background()
+	kekUri, err := NewKeyURI()
+	require.NoError(t, err)
+	keySetData, err := NewKeyset(kekUri, nil)
+	require.NoError(t, err)
+	info, err := KeysetInfo(keySetData, kekUri, nil)
+	require.NoError(t, err)
+
+	meter := &testMeter{counts: map[string]int64{}}
+	handler, err := NewTinkCryptoHandler(&TinkConfiguration{KekUri: kekUri, KeySetData: keySetData, Meter: meter})
+	require.NoError(t, err)
+	cipher, err := handler.Encrypt(ctx, []byte("plain"), nil)
+	require.NoError(t, err)
+	_, err = handler.Decrypt(ctx, cipher, nil)
+	require.NoError(t, err)
+	_, err = handler.Decrypt(ctx, cipher, []byte("other ad"))
+	require.Error(t, err)
+
+	keyId := strconv.FormatUint(uint64(info.GetPrimaryKeyId()), 10)
+	assert.Equal(t, map[string]int64{
+		"crypto.kms.duration{kms=caas-kms,operation=unwrap,outcome=ok}":                1,
+		"crypto.operations{operation=encrypt,outcome=ok,primitive=aead}":               1,
+		"crypto.operations{operation=decrypt,outcome=ok,primitive=aead}":               1,
+		"crypto.operations{operation=decrypt,outcome=error,primitive=aead}":            1,
+		"crypto.bytes{operation=encrypt,primitive=aead}":                               5,
+		"crypto.bytes{operation=decrypt,primitive=aead}":                               5,
+		"crypto.keyset.key_use{key_id=" + keyId + ",operation=encrypt,primitive=aead}": 1,
+		"crypto.keyset.key_use{key_id=" + keyId + ",operation=decrypt,primitive=aead}": 1,
+		"crypto.keyset.decrypt{key_id=" + keyId + "}":                                  1,
+	}, meter.counts)
+}
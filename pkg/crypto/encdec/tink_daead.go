@@ -0,0 +1,54 @@
+package encdec
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/tink-crypto/tink-go/v2/daead"
+	"github.com/tink-crypto/tink-go/v2/tink"
+)
+
+// TinkDeterministicHandler encrypts with a deterministic AEAD (AES-SIV) keyset,
+// equal plaintexts with equal associated data produce equal ciphertexts so
+// that encrypted values can be looked up by exact match. It reveals which
+// values are equal and should only be used when that is acceptable.
+type TinkDeterministicHandler struct {
+	daead   tink.DeterministicAEAD
+	metrics *cryptoMetrics
+}
+
+// NewTinkDeterministicHandler decrypts the AES-SIV keyset in KeySetData with
+// the KEK, see NewDeterministicKeyset.
+func NewTinkDeterministicHandler(c *TinkConfiguration) (*TinkDeterministicHandler, error) {
+	handle, err := loadKeyset(c)
+	if err != nil {
+		return nil, err
+	}
+	primitive, err := daead.New(handle)
+	if err != nil {
+		return nil, err
+	}
+	metrics, err := newCryptoMetrics(c.Meter, "daead")
+	if err != nil {
+		return nil, err
+	}
+	return &TinkDeterministicHandler{daead: primitive, metrics: metrics}, nil
+}
+
+func (h *TinkDeterministicHandler) Encrypt(ctx context.Context, plain, associatedData []byte) ([]byte, error) {
+	cipher, err := h.daead.EncryptDeterministically(plain, associatedData)
+	h.metrics.record(ctx, "encrypt", len(plain), cipher, err)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to encrypt")
+	}
+	return cipher, nil
+}
+
+func (h *TinkDeterministicHandler) Decrypt(ctx context.Context, cipher, associatedData []byte) ([]byte, error) {
+	decrypted, err := h.daead.DecryptDeterministically(cipher, associatedData)
+	h.metrics.record(ctx, "decrypt", len(decrypted), cipher, err)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to decrypt")
+	}
+	return decrypted, nil
+}
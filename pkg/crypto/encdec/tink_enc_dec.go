@@ -1,63 +1,271 @@
 package encdec
 
 import (
-	"bytes"
 	"context"
-	"encoding/base64"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/go-kratos/kratos/v2/log"
 	"github.com/pkg/errors"
 	"github.com/tink-crypto/tink-go/v2/aead"
+	"github.com/tink-crypto/tink-go/v2/core/registry"
 	"github.com/tink-crypto/tink-go/v2/keyset"
 	"github.com/tink-crypto/tink-go/v2/tink"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
 )
 
 type TinkConfiguration struct {
-	KekUri       string
+	// KekUri is the URI of the key encryption key. caas-kms:// keys are
+	// handled here, other schemes are resolved with the KMS clients registered
+	// with Tink, see the awskms, gcpkms, azurekms and vaulttransit packages.
+	KekUri string
+	// KekUriPrefix is the prefix of caas-kms:// URIs, defaults to caas-kms://.
 	KekUriPrefix string
 	KeySetData   string
 	KekAd        []byte
+	// KeyRotationInterval rotates the primary key of the keyset on a
+	// schedule, zero disables the scheduled rotation. It requires
+	// OnKeyRotate. See RotateKey.
+	KeyRotationInterval time.Duration
+	// KeyRotationTimeout bounds a scheduled rotation including OnKeyRotate,
+	// defaults to 30s.
+	KeyRotationTimeout time.Duration
+	// OnKeyRotate persists the keyset data of a rotated keyset, e.g. in a
+	// secret store. The rotation is abandoned when it fails.
+	OnKeyRotate func(ctx context.Context, keySetData string) error
+	// Logger logs the failed scheduled rotations, defaults to the kratos
+	// global logger.
+	Logger log.Logger
+	// Meter records the crypto.keyset.decrypt counter by key id of the AEAD
+	// keyset and the operation and KMS metrics of all the handlers when set.
+	Meter metric.Meter
 }
 
 type TinkCryptoHandler struct {
+	kek         tink.AEAD
+	kekAd       []byte
+	onKeyRotate func(ctx context.Context, keySetData string) error
+	state       atomic.Pointer[tinkState]
+
+	// rotateMu serializes rotations, encryption and decryption use the state
+	// without locking.
+	rotateMu sync.Mutex
+	usage    sync.Map // key id -> *keyUsage
+	decrypts metric.Int64Counter
+	metrics  *cryptoMetrics
+	log      *log.Helper
+
+	stop chan struct{}
+	once sync.Once
+}
+
+type tinkState struct {
 	ksh  *keyset.Handle
 	aead tink.AEAD
 }
 
+// KeyUsage reports how much traffic a key of the keyset still decrypts, a
+// key which no longer decrypts anything can be retired.
+type KeyUsage struct {
+	KeyId    uint32
+	Primary  bool
+	Status   string
+	Decrypts uint64
+	LastUsed time.Time
+}
+
+// ErrNoKeyRotateHook is returned when a keyset is rotated without
+// TinkConfiguration.OnKeyRotate, the rotated keyset would be lost on restart
+// and the other instances could not decrypt with the new key.
+var ErrNoKeyRotateHook = errors.New("key rotation requires OnKeyRotate to persist the keyset")
+
+const defaultKeyRotationTimeout = 30 * time.Second
+
+type keyUsage struct {
+	decrypts atomic.Uint64
+	lastUsed atomic.Int64
+}
+
 func NewTinkCryptoHandler(c *TinkConfiguration) (*TinkCryptoHandler, error) {
-	client, err := NewCaasKmsClient(c.KekUriPrefix)
-	if err != nil {
-		return nil, err
+	if c.KeyRotationInterval > 0 && c.OnKeyRotate == nil {
+		return nil, ErrNoKeyRotateHook
 	}
-	kekAEAD, err := client.GetAEAD(c.KekUri)
+	kekAEAD, err := configuredKEK(c)
 	if err != nil {
 		return nil, err
 	}
 
-	keysetAssociatedData := c.KekAd
-
-	encryptedKeyset, err := base64.RawURLEncoding.DecodeString(c.KeySetData)
-	if err != nil {
+	h := &TinkCryptoHandler{kek: kekAEAD, kekAd: c.KekAd, onKeyRotate: c.OnKeyRotate, stop: make(chan struct{})}
+	if err := h.Reload(c.KeySetData); err != nil {
+		return nil, err
+	}
+	if c.Meter != nil {
+		h.decrypts, err = c.Meter.Int64Counter("crypto.keyset.decrypt",
+			metric.WithDescription("Number of decryptions by keyset key id"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if h.metrics, err = newCryptoMetrics(c.Meter, "aead"); err != nil {
 		return nil, err
 	}
+	if c.KeyRotationInterval > 0 {
+		logger := c.Logger
+		if logger == nil {
+			logger = log.GetLogger()
+		}
+		h.log = log.NewHelper(logger)
+		timeout := c.KeyRotationTimeout
+		if timeout <= 0 {
+			timeout = defaultKeyRotationTimeout
+		}
+		go h.rotateLoop(c.KeyRotationInterval, timeout)
+	}
+	return h, nil
+}
+
+// Reload replaces the keyset, e.g. with a keyset rotated by another instance.
+func (h *TinkCryptoHandler) Reload(keySetData string) error {
 	// To use the primitive, we first need to decrypt the keyset. We use the same
 	// KEK AEAD and the same associated data that we used to encrypt it.
-	reader := keyset.NewBinaryReader(bytes.NewReader(encryptedKeyset))
-	handle, err := keyset.ReadWithAssociatedData(reader, kekAEAD, keysetAssociatedData)
+	handle, err := decryptKeyset(keySetData, h.kek, h.kekAd)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	return h.setKeyset(handle)
+}
 
-	aead, err := aead.New(handle)
+func (h *TinkCryptoHandler) setKeyset(handle *keyset.Handle) error {
+	primitive, err := aead.New(handle)
+	if err != nil {
+		return err
+	}
+	h.state.Store(&tinkState{ksh: handle, aead: primitive})
+	return nil
+}
 
+// RotateKey adds a new AES256-GCM key to the keyset and makes it the primary
+// key used for encryption, the previous keys are retained for decryption. The
+// rotated keyset is persisted with OnKeyRotate before it is used. It returns
+// the id of the new primary key. It fails with ErrNoKeyRotateHook without
+// OnKeyRotate.
+//
+// Rotation must only be scheduled on a single instance, the other instances
+// load the persisted keyset with Reload.
+func (h *TinkCryptoHandler) RotateKey(ctx context.Context) (uint32, error) {
+	if h.onKeyRotate == nil {
+		return 0, ErrNoKeyRotateHook
+	}
+	h.rotateMu.Lock()
+	defer h.rotateMu.Unlock()
+
+	manager := keyset.NewManagerFromHandle(h.state.Load().ksh)
+	keyId, err := manager.Add(aead.AES256GCMKeyTemplate())
 	if err != nil {
-		return nil, err
+		return 0, errors.Wrap(err, "unable to add key")
+	}
+	if err := manager.SetPrimary(keyId); err != nil {
+		return 0, errors.Wrap(err, "unable to set primary key")
+	}
+	handle, err := manager.Handle()
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to rotate keyset")
+	}
+	keySetData, err := encryptKeyset(handle, h.kek, h.kekAd)
+	if err != nil {
+		return 0, err
 	}
+	if err := h.onKeyRotate(ctx, keySetData); err != nil {
+		return 0, errors.Wrap(err, "unable to persist rotated keyset")
+	}
+	if err := h.setKeyset(handle); err != nil {
+		return 0, err
+	}
+	return keyId, nil
+}
+
+// KeyUsage returns the keys of the keyset with the number of decryptions
+// since start and the time of the last one.
+func (h *TinkCryptoHandler) KeyUsage() []KeyUsage {
+	info := h.state.Load().ksh.KeysetInfo()
+	keys := make([]KeyUsage, 0, len(info.GetKeyInfo()))
+	for _, key := range info.GetKeyInfo() {
+		u := KeyUsage{KeyId: key.GetKeyId(), Primary: key.GetKeyId() == info.GetPrimaryKeyId(), Status: key.GetStatus().String()}
+		if v, ok := h.usage.Load(key.GetKeyId()); ok {
+			ku := v.(*keyUsage)
+			u.Decrypts = ku.decrypts.Load()
+			if lastUsed := ku.lastUsed.Load(); lastUsed > 0 {
+				u.LastUsed = time.Unix(0, lastUsed)
+			}
+		}
+		keys = append(keys, u)
+	}
+	return keys
+}
 
-	return &TinkCryptoHandler{ksh: handle, aead: aead}, nil
+// Close stops the scheduled key rotation.
+func (h *TinkCryptoHandler) Close() {
+	h.once.Do(func() { close(h.stop) })
+}
+
+func (h *TinkCryptoHandler) rotateLoop(interval, timeout time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-ticker.C:
+			// a failed rotation is retried on the next tick
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			if keyId, err := h.RotateKey(ctx); err != nil {
+				h.log.Errorf("scheduled keyset rotation failed: %v", err)
+			} else {
+				h.log.Infof("rotated keyset, new primary key %d", keyId)
+			}
+			cancel()
+		}
+	}
+}
+
+// recordDecrypt attributes a decryption to the key which encrypted it, Tink
+// ciphertexts start with a version byte followed by the 4 byte key id.
+func (h *TinkCryptoHandler) recordDecrypt(ctx context.Context, cipher []byte) {
+	keyId, ok := tinkKeyId(cipher)
+	if !ok {
+		return
+	}
+	v, _ := h.usage.LoadOrStore(keyId, &keyUsage{})
+	ku := v.(*keyUsage)
+	ku.decrypts.Add(1)
+	ku.lastUsed.Store(time.Now().UnixNano())
+	if h.decrypts != nil {
+		h.decrypts.Add(ctx, 1, metric.WithAttributes(attribute.Int64("key_id", int64(keyId))))
+	}
+}
+
+// kekClient returns the KMS client of the key encryption key.
+func kekClient(c *TinkConfiguration) (registry.KMSClient, error) {
+	if strings.HasPrefix(strings.ToLower(c.KekUri), caasKmsPrefix) {
+		prefix := c.KekUriPrefix
+		if prefix == "" {
+			prefix = caasKmsPrefix
+		}
+		return NewCaasKmsClient(prefix)
+	}
+	client, err := registry.GetKMSClient(c.KekUri)
+	if err != nil {
+		return nil, errors.Wrapf(err, "no KMS client registered for %s", c.KekUri)
+	}
+	return client, nil
 }
 
 func (h *TinkCryptoHandler) Encrypt(ctx context.Context, plain, associatedData []byte) ([]byte, error) {
-	cipher, err := h.aead.Encrypt(plain, associatedData)
+	cipher, err := h.state.Load().aead.Encrypt(plain, associatedData)
+	h.metrics.record(ctx, "encrypt", len(plain), cipher, err)
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to encrypt")
 	}
@@ -65,9 +273,11 @@ func (h *TinkCryptoHandler) Encrypt(ctx context.Context, plain, associatedData [
 }
 
 func (h *TinkCryptoHandler) Decrypt(ctx context.Context, cipher, associatedData []byte) ([]byte, error) {
-	decrypted, err := h.aead.Decrypt(cipher, associatedData)
+	decrypted, err := h.state.Load().aead.Decrypt(cipher, associatedData)
+	h.metrics.record(ctx, "decrypt", len(decrypted), cipher, err)
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to decrypt")
 	}
+	h.recordDecrypt(ctx, cipher)
 	return decrypted, nil
 }
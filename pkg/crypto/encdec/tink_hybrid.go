@@ -0,0 +1,95 @@
+package encdec
+
+import (
+	"context"
+	"crypto/ecdh"
+
+	"github.com/pkg/errors"
+	"github.com/tink-crypto/tink-go/v2/hybrid"
+	"github.com/tink-crypto/tink-go/v2/keyset"
+	"github.com/tink-crypto/tink-go/v2/tink"
+)
+
+// TinkHybridHandler decrypts payloads encrypted by partners to the public
+// keys of a private hybrid keyset, see NewHybridKeyset.
+type TinkHybridHandler struct {
+	decrypter tink.HybridDecrypt
+	public    *keyset.Handle
+
+	// ecdhKeys are the keys of the keyset usable for JWE key agreement
+	ecdhKeys   map[string]*ecdh.PrivateKey
+	primaryKid string
+	metrics    *cryptoMetrics
+}
+
+// NewTinkHybridHandler decrypts the private hybrid keyset in KeySetData with
+// the KEK.
+func NewTinkHybridHandler(c *TinkConfiguration) (*TinkHybridHandler, error) {
+	handle, err := loadKeyset(c)
+	if err != nil {
+		return nil, err
+	}
+	decrypter, err := hybrid.NewHybridDecrypt(handle)
+	if err != nil {
+		return nil, err
+	}
+	public, err := handle.Public()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get public keyset")
+	}
+	keys, err := ecdhKeys(handle)
+	if err != nil {
+		return nil, err
+	}
+	metrics, err := newCryptoMetrics(c.Meter, "hybrid")
+	if err != nil {
+		return nil, err
+	}
+	return &TinkHybridHandler{decrypter: decrypter, public: public, ecdhKeys: keys,
+		primaryKid: joseKid(handle.KeysetInfo().GetPrimaryKeyId()), metrics: metrics}, nil
+}
+
+// Decrypt decrypts a cipher text of TinkHybridEncrypter.Encrypt, the context
+// info must be the one used for the encryption.
+func (h *TinkHybridHandler) Decrypt(ctx context.Context, cipher, contextInfo []byte) ([]byte, error) {
+	decrypted, err := h.decrypter.Decrypt(cipher, contextInfo)
+	h.metrics.record(ctx, "decrypt", len(decrypted), cipher, err)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to decrypt")
+	}
+	return decrypted, nil
+}
+
+// PublicKeyset returns the public keys of the keyset to be shared with the
+// partners encrypting to it, see ExportPublicKeyset.
+func (h *TinkHybridHandler) PublicKeyset() (string, error) {
+	return writePublicKeyset(h.public)
+}
+
+// TinkHybridEncrypter encrypts to the public keyset of a partner.
+type TinkHybridEncrypter struct {
+	encrypter tink.HybridEncrypt
+}
+
+// NewTinkHybridEncrypter creates an encrypter from a public hybrid keyset.
+func NewTinkHybridEncrypter(publicKeySetData string) (*TinkHybridEncrypter, error) {
+	public, err := readPublicKeyset(publicKeySetData)
+	if err != nil {
+		return nil, err
+	}
+	encrypter, err := hybrid.NewHybridEncrypt(public)
+	if err != nil {
+		return nil, err
+	}
+	return &TinkHybridEncrypter{encrypter: encrypter}, nil
+}
+
+// Encrypt encrypts the plain data, the context info is authenticated but not
+// encrypted, like associated data.
+func (e *TinkHybridEncrypter) Encrypt(ctx context.Context, plain, contextInfo []byte) ([]byte, error) {
+	cipher, err := e.encrypter.Encrypt(plain, contextInfo)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to encrypt")
+	}
+	return cipher, nil
+}
@@ -0,0 +1,53 @@
+package encdec
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/tink-crypto/tink-go/v2/mac"
+	"github.com/tink-crypto/tink-go/v2/tink"
+)
+
+// TinkMACHandler computes and verifies HMAC-SHA256 tags with a MAC keyset,
+// see NewMACKeyset.
+type TinkMACHandler struct {
+	mac     tink.MAC
+	metrics *cryptoMetrics
+}
+
+var _ MACHandler = (*TinkMACHandler)(nil)
+
+// NewTinkMACHandler decrypts the MAC keyset in KeySetData with the KEK.
+func NewTinkMACHandler(c *TinkConfiguration) (*TinkMACHandler, error) {
+	handle, err := loadKeyset(c)
+	if err != nil {
+		return nil, err
+	}
+	primitive, err := mac.New(handle)
+	if err != nil {
+		return nil, err
+	}
+	metrics, err := newCryptoMetrics(c.Meter, "mac")
+	if err != nil {
+		return nil, err
+	}
+	return &TinkMACHandler{mac: primitive, metrics: metrics}, nil
+}
+
+func (h *TinkMACHandler) ComputeMAC(ctx context.Context, data []byte) ([]byte, error) {
+	tag, err := h.mac.ComputeMAC(data)
+	h.metrics.record(ctx, "compute_mac", len(data), tag, err)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to compute mac")
+	}
+	return tag, nil
+}
+
+func (h *TinkMACHandler) VerifyMAC(ctx context.Context, tag, data []byte) error {
+	err := h.mac.VerifyMAC(tag, data)
+	h.metrics.record(ctx, "verify_mac", len(data), tag, err)
+	if err != nil {
+		return errors.Wrap(err, "invalid mac")
+	}
+	return nil
+}
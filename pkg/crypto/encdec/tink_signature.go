@@ -0,0 +1,97 @@
+package encdec
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/tink-crypto/tink-go/v2/keyset"
+	"github.com/tink-crypto/tink-go/v2/signature"
+	"github.com/tink-crypto/tink-go/v2/tink"
+)
+
+// ErrSigningNotSupported is returned by Sign of a handler created from a
+// public keyset.
+var ErrSigningNotSupported = errors.New("signing requires the private keyset")
+
+// TinkSignatureHandler signs with a private signature keyset (Ed25519 or
+// ECDSA) and verifies with its public keys, see NewSignatureKeyset.
+type TinkSignatureHandler struct {
+	signer   tink.Signer
+	verifier tink.Verifier
+	public   *keyset.Handle
+	jws      *jwsKey
+	metrics  *cryptoMetrics
+}
+
+var _ SignatureHandler = (*TinkSignatureHandler)(nil)
+
+// NewTinkSignatureHandler decrypts the private signature keyset in
+// KeySetData with the KEK.
+func NewTinkSignatureHandler(c *TinkConfiguration) (*TinkSignatureHandler, error) {
+	handle, err := loadKeyset(c)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := signature.NewSigner(handle)
+	if err != nil {
+		return nil, err
+	}
+	public, err := handle.Public()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get public keyset")
+	}
+	verifier, err := signature.NewVerifier(public)
+	if err != nil {
+		return nil, err
+	}
+	jws, err := primaryJWSKey(public)
+	if err != nil {
+		return nil, err
+	}
+	metrics, err := newCryptoMetrics(c.Meter, "signature")
+	if err != nil {
+		return nil, err
+	}
+	return &TinkSignatureHandler{signer: signer, verifier: verifier, public: public, jws: jws, metrics: metrics}, nil
+}
+
+// NewTinkSignatureVerifier creates a verify only handler from a public
+// keyset, see PublicKeyset.
+func NewTinkSignatureVerifier(publicKeySetData string) (*TinkSignatureHandler, error) {
+	public, err := readPublicKeyset(publicKeySetData)
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := signature.NewVerifier(public)
+	if err != nil {
+		return nil, err
+	}
+	return &TinkSignatureHandler{verifier: verifier, public: public}, nil
+}
+
+func (h *TinkSignatureHandler) Sign(ctx context.Context, data []byte) ([]byte, error) {
+	if h.signer == nil {
+		return nil, ErrSigningNotSupported
+	}
+	sig, err := h.signer.Sign(data)
+	h.metrics.record(ctx, "sign", len(data), sig, err)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to sign")
+	}
+	return sig, nil
+}
+
+func (h *TinkSignatureHandler) Verify(ctx context.Context, sig, data []byte) error {
+	err := h.verifier.Verify(sig, data)
+	h.metrics.record(ctx, "verify", len(data), sig, err)
+	if err != nil {
+		return errors.Wrap(err, "invalid signature")
+	}
+	return nil
+}
+
+// PublicKeyset returns the public keys of the keyset to be shared with the
+// parties verifying the signatures, see ExportPublicKeyset.
+func (h *TinkSignatureHandler) PublicKeyset() (string, error) {
+	return writePublicKeyset(h.public)
+}
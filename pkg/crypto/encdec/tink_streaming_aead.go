@@ -0,0 +1,82 @@
+package encdec
+
+import (
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/tink-crypto/tink-go/v2/streamingaead"
+	"github.com/tink-crypto/tink-go/v2/tink"
+)
+
+// TinkStreamingHandler encrypts streams with a streaming AEAD
+// (AES256-GCM-HKDF) keyset in segments, so that large payloads are never
+// held in memory.
+type TinkStreamingHandler struct {
+	saead   tink.StreamingAEAD
+	metrics *cryptoMetrics
+}
+
+// NewTinkStreamingHandler decrypts the streaming keyset in KeySetData with
+// the KEK, see NewStreamingKeyset.
+func NewTinkStreamingHandler(c *TinkConfiguration) (*TinkStreamingHandler, error) {
+	handle, err := loadKeyset(c)
+	if err != nil {
+		return nil, err
+	}
+	primitive, err := streamingaead.New(handle)
+	if err != nil {
+		return nil, err
+	}
+	metrics, err := newCryptoMetrics(c.Meter, "streaming_aead")
+	if err != nil {
+		return nil, err
+	}
+	return &TinkStreamingHandler{saead: primitive, metrics: metrics}, nil
+}
+
+// EncryptStream encrypts src into dst until src returns io.EOF.
+func (h *TinkStreamingHandler) EncryptStream(ctx context.Context, dst io.Writer, src io.Reader, associatedData []byte) (n int64, err error) {
+	defer func() { h.metrics.record(ctx, "encrypt", int(n), nil, err) }()
+	w, err := h.saead.NewEncryptingWriter(dst, associatedData)
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to encrypt")
+	}
+	n, err = io.Copy(w, contextReader{ctx, src})
+	if err != nil {
+		return n, errors.Wrap(err, "unable to encrypt")
+	}
+	// closing writes the last segment
+	if err := w.Close(); err != nil {
+		return n, errors.Wrap(err, "unable to encrypt")
+	}
+	return n, nil
+}
+
+// DecryptStream decrypts src into dst. A truncated or modified stream fails
+// with an error, the plain text written to dst before must then be discarded.
+func (h *TinkStreamingHandler) DecryptStream(ctx context.Context, dst io.Writer, src io.Reader, associatedData []byte) (n int64, err error) {
+	defer func() { h.metrics.record(ctx, "decrypt", int(n), nil, err) }()
+	r, err := h.saead.NewDecryptingReader(contextReader{ctx, src}, associatedData)
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to decrypt")
+	}
+	n, err = io.Copy(dst, r)
+	if err != nil {
+		return n, errors.Wrap(err, "unable to decrypt")
+	}
+	return n, nil
+}
+
+// contextReader stops reading once the context is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
@@ -0,0 +1,346 @@
+// Package vaulttransit provides a Tink KMS client for key encryption keys held
+// by the HashiCorp Vault transit secrets engine.
+//
+// Register the client before creating the crypto handler so that KEK URIs of
+// the form vault-transit://<mount>/<key> are resolved:
+//
+//	client, err := vaulttransit.NewClient(vaulttransit.Prefix, &vaulttransit.Config{
+//		AppRole: &vaulttransit.AppRole{RoleId: roleId, SecretId: secretId},
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	defer client.Close()
+//	registry.RegisterKMSClient(client)
+package vaulttransit
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/achuala/go-svc-extn/pkg/crypto/encdec/internal/kmsutil"
+	"github.com/tink-crypto/tink-go/v2/core/registry"
+	"github.com/tink-crypto/tink-go/v2/tink"
+)
+
+// Prefix is the prefix of Vault transit key URIs.
+const Prefix = "vault-transit://"
+
+// minTokenTTL is the remaining lifetime below which an AppRole token is
+// replaced by a new login rather than renewed, e.g. once it reached its max TTL.
+const minTokenTTL = time.Minute
+
+var _ registry.KMSClient = (*Client)(nil)
+
+// Config configures the Vault transit client. The token is used unless
+// AppRole is set.
+type Config struct {
+	// Address of the Vault server, defaults to VAULT_ADDR.
+	Address string
+	// Token used to authenticate, defaults to VAULT_TOKEN.
+	Token     string
+	Namespace string
+	AppRole   *AppRole
+	Timeout   time.Duration
+}
+
+// AppRole are the credentials of the AppRole auth method.
+type AppRole struct {
+	// Mount is the path of the auth method, defaults to "approle".
+	Mount    string
+	RoleId   string
+	SecretId string
+}
+
+// Client is a Tink KMS client for the Vault transit secrets engine. Tokens
+// with a TTL are renewed in the background, AppRole tokens which can no
+// longer be renewed are replaced by logging in again.
+type Client struct {
+	uriPrefix string
+	c         *Config
+	client    *http.Client
+	now       func() time.Time
+
+	mu        sync.Mutex
+	token     string
+	renewable bool
+	// renewAt and expiresAt are zero for tokens without a TTL.
+	renewAt   time.Time
+	expiresAt time.Time
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// NewClient authenticates with Vault and returns a client for the keys with
+// the uriPrefix, which is either Prefix for any key or the URI of a single key.
+// Close the client to stop the token renewal.
+func NewClient(uriPrefix string, c *Config) (*Client, error) {
+	if !strings.HasPrefix(strings.ToLower(uriPrefix), Prefix) {
+		return nil, fmt.Errorf("uriPrefix must start with %s, but got %s", Prefix, uriPrefix)
+	}
+	cfg := *c
+	if cfg.Address == "" {
+		cfg.Address = os.Getenv("VAULT_ADDR")
+	}
+	if cfg.Token == "" {
+		cfg.Token = os.Getenv("VAULT_TOKEN")
+	}
+	if cfg.AppRole != nil && cfg.AppRole.Mount == "" {
+		appRole := *cfg.AppRole
+		appRole.Mount = "approle"
+		cfg.AppRole = &appRole
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	cfg.Address = strings.TrimSuffix(cfg.Address, "/")
+
+	client := &Client{
+		uriPrefix: uriPrefix,
+		c:         &cfg,
+		client:    &http.Client{Timeout: cfg.Timeout},
+		now:       time.Now,
+		stop:      make(chan struct{}),
+	}
+	if err := client.authenticate(context.Background()); err != nil {
+		return nil, err
+	}
+	go client.renewLoop()
+	return client, nil
+}
+
+// Register creates a client and registers it with the Tink KMS registry. The
+// client renews its token for the lifetime of the process.
+func Register(uriPrefix string, c *Config) error {
+	client, err := NewClient(uriPrefix, c)
+	if err != nil {
+		return err
+	}
+	registry.RegisterKMSClient(client)
+	return nil
+}
+
+// Close stops the background token renewal.
+func (c *Client) Close() {
+	c.once.Do(func() { close(c.stop) })
+}
+
+// Supported returns true if this client does support keyURI.
+func (c *Client) Supported(keyURI string) bool {
+	return strings.HasPrefix(keyURI, c.uriPrefix)
+}
+
+// GetAEAD returns an AEAD by keyURI.
+func (c *Client) GetAEAD(keyURI string) (tink.AEAD, error) {
+	if !c.Supported(keyURI) {
+		return nil, fmt.Errorf("keyURI must start with prefix %s, but got %s", c.uriPrefix, keyURI)
+	}
+	path := strings.Trim(strings.TrimPrefix(keyURI, Prefix), "/")
+	i := strings.LastIndex(path, "/")
+	if i <= 0 || i == len(path)-1 {
+		return nil, fmt.Errorf("invalid Vault transit key URI %s", keyURI)
+	}
+	return &transitAEAD{client: c, mount: path[:i], key: path[i+1:]}, nil
+}
+
+// transitAEAD encrypts with the transit key, the associated data requires an
+// AES-GCM or ChaCha20-Poly1305 key.
+type transitAEAD struct {
+	client *Client
+	mount  string
+	key    string
+}
+
+func (a *transitAEAD) Encrypt(plaintext, associatedData []byte) ([]byte, error) {
+	req := map[string]string{"plaintext": base64.StdEncoding.EncodeToString(plaintext)}
+	if len(associatedData) > 0 {
+		req["associated_data"] = base64.StdEncoding.EncodeToString(associatedData)
+	}
+	var resp struct {
+		Data struct {
+			Ciphertext string `json:"ciphertext"`
+		} `json:"data"`
+	}
+	if err := a.client.call(context.Background(), "/v1/"+a.mount+"/encrypt/"+a.key, req, &resp); err != nil {
+		return nil, fmt.Errorf("vaulttransit: encrypt: %w", err)
+	}
+	return []byte(resp.Data.Ciphertext), nil
+}
+
+func (a *transitAEAD) Decrypt(ciphertext, associatedData []byte) ([]byte, error) {
+	req := map[string]string{"ciphertext": string(ciphertext)}
+	if len(associatedData) > 0 {
+		req["associated_data"] = base64.StdEncoding.EncodeToString(associatedData)
+	}
+	var resp struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}
+	if err := a.client.call(context.Background(), "/v1/"+a.mount+"/decrypt/"+a.key, req, &resp); err != nil {
+		return nil, fmt.Errorf("vaulttransit: decrypt: %w", err)
+	}
+	return base64.StdEncoding.DecodeString(resp.Data.Plaintext)
+}
+
+// call sends an authenticated request, refreshing the token when it is due.
+func (c *Client) call(ctx context.Context, path string, in, out any) error {
+	c.mu.Lock()
+	if !c.renewAt.IsZero() && !c.now().Before(c.renewAt) {
+		// a failed renewal is retried by the renew loop while the token is valid
+		if err := c.refresh(ctx); err != nil && !c.now().Before(c.expiresAt) {
+			c.mu.Unlock()
+			return err
+		}
+	}
+	token := c.token
+	c.mu.Unlock()
+	return c.do(ctx, path, token, in, out)
+}
+
+type authResponse struct {
+	Auth *struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int64  `json:"lease_duration"`
+		Renewable     bool   `json:"renewable"`
+	} `json:"auth"`
+	Data *struct {
+		TTL       int64 `json:"ttl"`
+		Renewable bool  `json:"renewable"`
+	} `json:"data"`
+}
+
+// authenticate logs in with AppRole, or looks up the TTL of the token.
+func (c *Client) authenticate(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.c.AppRole != nil {
+		return c.login(ctx)
+	}
+	var resp authResponse
+	if err := c.do(ctx, "/v1/auth/token/lookup-self", c.c.Token, nil, &resp); err != nil {
+		return fmt.Errorf("vaulttransit: lookup token: %w", err)
+	}
+	if resp.Data == nil {
+		return fmt.Errorf("vaulttransit: lookup token: missing token data")
+	}
+	c.setToken(c.c.Token, resp.Data.TTL, resp.Data.Renewable)
+	return nil
+}
+
+func (c *Client) login(ctx context.Context) error {
+	var resp authResponse
+	in := map[string]string{"role_id": c.c.AppRole.RoleId, "secret_id": c.c.AppRole.SecretId}
+	if err := c.do(ctx, "/v1/auth/"+c.c.AppRole.Mount+"/login", "", in, &resp); err != nil {
+		return fmt.Errorf("vaulttransit: approle login: %w", err)
+	}
+	if resp.Auth == nil || resp.Auth.ClientToken == "" {
+		return fmt.Errorf("vaulttransit: approle login: missing client token")
+	}
+	c.setToken(resp.Auth.ClientToken, resp.Auth.LeaseDuration, resp.Auth.Renewable)
+	return nil
+}
+
+// refresh renews the token, or logs in again when the token can no longer be
+// renewed. It must be called with c.mu held.
+func (c *Client) refresh(ctx context.Context) error {
+	err := c.renew(ctx)
+	if c.c.AppRole != nil {
+		if err == nil && c.expiresAt.Sub(c.now()) >= minTokenTTL {
+			return nil
+		}
+		err = c.login(ctx)
+	}
+	if err == nil {
+		return nil
+	}
+	// retry halfway to the expiry, once expired an AppRole login is retried
+	// by the next call and a token is given up
+	if now := c.now(); now.Before(c.expiresAt) {
+		c.renewAt = now.Add(c.expiresAt.Sub(now) / 2)
+	} else if c.c.AppRole == nil {
+		c.renewAt = time.Time{}
+	}
+	return err
+}
+
+func (c *Client) renew(ctx context.Context) error {
+	if !c.renewable {
+		return fmt.Errorf("vaulttransit: token is not renewable")
+	}
+	var resp authResponse
+	if err := c.do(ctx, "/v1/auth/token/renew-self", c.token, struct{}{}, &resp); err != nil {
+		return fmt.Errorf("vaulttransit: renew token: %w", err)
+	}
+	if resp.Auth == nil {
+		return fmt.Errorf("vaulttransit: renew token: missing auth data")
+	}
+	c.setToken(c.token, resp.Auth.LeaseDuration, resp.Auth.Renewable)
+	return nil
+}
+
+// setToken stores the token, which is renewed after two thirds of its TTL.
+func (c *Client) setToken(token string, ttlSeconds int64, renewable bool) {
+	c.token = token
+	c.renewable = renewable
+	if ttlSeconds <= 0 {
+		c.renewAt, c.expiresAt = time.Time{}, time.Time{}
+		return
+	}
+	ttl := time.Duration(ttlSeconds) * time.Second
+	now := c.now()
+	c.renewAt = now.Add(ttl * 2 / 3)
+	c.expiresAt = now.Add(ttl)
+}
+
+// renewLoop refreshes the token when it is due, so that idle clients keep a
+// valid token. It stops once the token has no TTL or has expired.
+func (c *Client) renewLoop() {
+	for {
+		c.mu.Lock()
+		now := c.now()
+		done := c.renewAt.IsZero() || !now.Before(c.expiresAt)
+		wait := c.renewAt.Sub(now)
+		c.mu.Unlock()
+		if done {
+			return
+		}
+		timer := time.NewTimer(max(wait, time.Second))
+		select {
+		case <-c.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		c.mu.Lock()
+		if !c.now().Before(c.renewAt) {
+			_ = c.refresh(context.Background())
+		}
+		c.mu.Unlock()
+	}
+}
+
+func (c *Client) do(ctx context.Context, path, token string, in, out any) error {
+	method := http.MethodPost
+	if in == nil {
+		method = http.MethodGet
+	}
+	req, _, err := kmsutil.NewJSONRequest(ctx, method, c.c.Address+path, in)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if c.c.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.c.Namespace)
+	}
+	return kmsutil.Do(c.client, req, out)
+}
@@ -0,0 +1,124 @@
+package vaulttransit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeVault is a transit engine which "encrypts" by prefixing the plaintext,
+// tokens issued by the AppRole login have a TTL of one hour.
+type fakeVault struct {
+	mu       sync.Mutex
+	tokens   map[string]bool
+	logins   int
+	renewals int
+	noRenew  bool
+}
+
+func (f *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var req map[string]string
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	reply := func(v any) { _ = json.NewEncoder(w).Encode(v) }
+	token := r.Header.Get("X-Vault-Token")
+
+	if r.URL.Path == "/v1/auth/approle/login" {
+		if req["role_id"] != "role" || req["secret_id"] != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.logins++
+		token := "s.token" + string(rune('0'+f.logins))
+		f.tokens[token] = true
+		reply(map[string]any{"auth": map[string]any{"client_token": token, "lease_duration": 3600, "renewable": true}})
+		return
+	}
+	if !f.tokens[token] || r.Header.Get("X-Vault-Namespace") != "team" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	switch {
+	case r.URL.Path == "/v1/auth/token/renew-self":
+		if f.noRenew {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.renewals++
+		reply(map[string]any{"auth": map[string]any{"client_token": token, "lease_duration": 3600, "renewable": true}})
+	case r.URL.Path == "/v1/kv/transit/encrypt/kek":
+		reply(map[string]any{"data": map[string]string{"ciphertext": "vault:v1:" + req["plaintext"] + ":" + req["associated_data"]}})
+	case r.URL.Path == "/v1/kv/transit/decrypt/kek":
+		plaintext, ad, _ := strings.Cut(strings.TrimPrefix(req["ciphertext"], "vault:v1:"), ":")
+		if ad != req["associated_data"] {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		reply(map[string]any{"data": map[string]string{"plaintext": plaintext}})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestVaultTransitAEAD(t *testing.T) {
+	vault := &fakeVault{tokens: map[string]bool{}}
+	srv := httptest.NewServer(vault)
+	defer srv.Close()
+
+	client, err := NewClient(Prefix, &Config{Address: srv.URL, Namespace: "team", AppRole: &AppRole{RoleId: "role", SecretId: "secret"}})
+	require.NoError(t, err)
+	defer client.Close()
+	now := time.Now()
+	advance := func(d time.Duration) {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		now = now.Add(d)
+	}
+	client.mu.Lock()
+	client.now = func() time.Time { return now }
+	client.mu.Unlock()
+
+	a, err := client.GetAEAD(Prefix + "kv/transit/kek")
+	require.NoError(t, err)
+	ciphertext, err := a.Encrypt([]byte("keyset"), []byte("ad"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(ciphertext), "vault:v1:"))
+	plaintext, err := a.Decrypt(ciphertext, []byte("ad"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("keyset"), plaintext)
+	_, err = a.Decrypt(ciphertext, []byte("other"))
+	assert.Error(t, err)
+
+	// the token is renewed after two thirds of its TTL
+	advance(50 * time.Minute)
+	_, err = a.Encrypt([]byte("keyset"), nil)
+	require.NoError(t, err)
+	vault.mu.Lock()
+	assert.Equal(t, 1, vault.logins)
+	assert.Equal(t, 1, vault.renewals)
+	vault.mu.Unlock()
+
+	// and replaced by a new login once it can no longer be renewed
+	vault.mu.Lock()
+	vault.noRenew = true
+	vault.mu.Unlock()
+	advance(50 * time.Minute)
+	_, err = a.Encrypt([]byte("keyset"), nil)
+	require.NoError(t, err)
+	vault.mu.Lock()
+	assert.Equal(t, 2, vault.logins)
+	vault.mu.Unlock()
+
+	_, err = client.GetAEAD(Prefix + "kek")
+	assert.Error(t, err)
+	_, err = NewClient(Prefix, &Config{Address: srv.URL, AppRole: &AppRole{RoleId: "role", SecretId: "wrong"}})
+	assert.Error(t, err)
+}
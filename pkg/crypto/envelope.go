@@ -0,0 +1,98 @@
+package crypto
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// ErrMalformedEnvelope is returned when an envelope can't be parsed.
+var ErrMalformedEnvelope = errors.New("MALFORMED_ENVELOPE")
+
+const envelopeVersion = 1
+
+// EnvelopeEncrypt encrypts the given plain text with a fresh AES-256-GCM data
+// key, which is in turn encrypted with the keyset. Only the 32 byte data key
+// goes through the keyset, and a record is crypto-shredded by deleting its
+// envelope, no other record shares its key.
+//
+// The envelope is laid out as
+//
+//	version (1) | wrapped key length (2) | wrapped key | nonce (12) | cipher text
+//
+// The associated data authenticates both the wrapped key and the cipher text.
+func (u *CryptoUtil) EnvelopeEncrypt(ctx context.Context, plainText, ad []byte) ([]byte, error) {
+	dek, err := NewRandomSecret(32)
+	if err != nil {
+		return nil, err
+	}
+	defer dek.Destroy()
+	wrapped, err := u.cryptoProvider.Encrypt(ctx, dek.Bytes(), ad)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to wrap data key")
+	}
+	if len(wrapped) > 0xffff {
+		return nil, errors.New("wrapped data key too large")
+	}
+	aesgcm, err := newDataKeyCipher(dek.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	envelope := make([]byte, 3, 3+len(wrapped)+aesgcm.NonceSize()+len(plainText)+aesgcm.Overhead())
+	envelope[0] = envelopeVersion
+	binary.BigEndian.PutUint16(envelope[1:3], uint16(len(wrapped)))
+	envelope = append(envelope, wrapped...)
+	nonce := make([]byte, aesgcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	envelope = append(envelope, nonce...)
+	return aesgcm.Seal(envelope, nonce, plainText, ad), nil
+}
+
+// EnvelopeDecrypt decrypts an envelope of EnvelopeEncrypt.
+func (u *CryptoUtil) EnvelopeDecrypt(ctx context.Context, envelope, ad []byte) ([]byte, error) {
+	if len(envelope) < 3 || envelope[0] != envelopeVersion {
+		return nil, ErrMalformedEnvelope
+	}
+	wrappedLen := int(binary.BigEndian.Uint16(envelope[1:3]))
+	rest := envelope[3:]
+	if len(rest) < wrappedLen {
+		return nil, ErrMalformedEnvelope
+	}
+	wrapped, rest := rest[:wrappedLen], rest[wrappedLen:]
+
+	unwrapped, err := u.cryptoProvider.Decrypt(ctx, wrapped, ad)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to unwrap data key")
+	}
+	dek := NewSecret(unwrapped)
+	defer dek.Destroy()
+	aesgcm, err := newDataKeyCipher(dek.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) < aesgcm.NonceSize()+aesgcm.Overhead() {
+		return nil, ErrMalformedEnvelope
+	}
+	nonce, cipherText := rest[:aesgcm.NonceSize()], rest[aesgcm.NonceSize():]
+	plainText, err := aesgcm.Open(nil, nonce, cipherText, ad)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to decrypt")
+	}
+	return plainText, nil
+}
+
+func newDataKeyCipher(dek []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(dek)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
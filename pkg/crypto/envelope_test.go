@@ -0,0 +1,37 @@
+package crypto
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvelopeEncDec(t *testing.T) {
+	ctx := context.Background()
+	cu, err := NewCryptoUtil(cfg)
+	require.NoError(t, err)
+
+	plain := []byte("James Bond")
+	envelope, err := cu.EnvelopeEncrypt(ctx, plain, []byte("record-1"))
+	require.NoError(t, err)
+	other, err := cu.EnvelopeEncrypt(ctx, plain, []byte("record-1"))
+	require.NoError(t, err)
+	assert.NotEqual(t, envelope, other)
+
+	plainText, err := cu.EnvelopeDecrypt(ctx, envelope, []byte("record-1"))
+	require.NoError(t, err)
+	assert.Equal(t, plain, plainText)
+
+	_, err = cu.EnvelopeDecrypt(ctx, envelope, []byte("record-2"))
+	assert.Error(t, err)
+	tampered := append([]byte(nil), envelope...)
+	tampered[len(tampered)-1] ^= 1
+	_, err = cu.EnvelopeDecrypt(ctx, tampered, []byte("record-1"))
+	assert.Error(t, err)
+	_, err = cu.EnvelopeDecrypt(ctx, envelope[:10], []byte("record-1"))
+	assert.ErrorIs(t, err, ErrMalformedEnvelope)
+	_, err = cu.EnvelopeDecrypt(ctx, append([]byte{2}, envelope[1:]...), []byte("record-1"))
+	assert.ErrorIs(t, err, ErrMalformedEnvelope)
+}
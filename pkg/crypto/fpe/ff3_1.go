@@ -0,0 +1,215 @@
+// Package fpe implements format-preserving encryption with FF3-1 (NIST SP
+// 800-38G Rev. 1): the cipher text has the length and the alphabet of the
+// plain text, e.g. digits stay digits.
+package fpe
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+// Alphabets of the characters to encrypt.
+const (
+	Digits       = "0123456789"
+	LowerAlnum   = "0123456789abcdefghijklmnopqrstuvwxyz"
+	Alphanumeric = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+)
+
+// TweakSize is the size in bytes of the FF3-1 tweak.
+const TweakSize = 7
+
+const rounds = 8
+
+var (
+	ErrInvalidTweak  = errors.New("FPE_INVALID_TWEAK")
+	ErrInvalidLength = errors.New("FPE_INVALID_LENGTH")
+	ErrInvalidInput  = errors.New("FPE_INVALID_INPUT")
+)
+
+// FF31 is an FF3-1 cipher over an alphabet.
+type FF31 struct {
+	block    cipher.Block
+	alphabet []rune
+	index    map[rune]int
+	radix    *big.Int
+	minLen   int
+	maxLen   int
+}
+
+// NewFF31 creates an FF3-1 cipher with an AES key of 16, 24 or 32 bytes over
+// the alphabet, which must hold between 2 and 65536 distinct characters.
+func NewFF31(key []byte, alphabet string) (*FF31, error) {
+	runes := []rune(alphabet)
+	if len(runes) < 2 || len(runes) > 1<<16 {
+		return nil, errors.Errorf("unsupported alphabet size %d", len(runes))
+	}
+	index := make(map[rune]int, len(runes))
+	for i, r := range runes {
+		if _, ok := index[r]; ok {
+			return nil, errors.Errorf("duplicate alphabet character %q", r)
+		}
+		index[r] = i
+	}
+	// FF3-1 encrypts with the byte reversed key
+	revKey := reverseBytes(key)
+	block, err := aes.NewCipher(revKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid fpe key")
+	}
+	radix := big.NewInt(int64(len(runes)))
+	// radix^minLen >= 1000000 and maxLen = 2 * floor(log_radix(2^96))
+	minLen, maxLen := 1, 0
+	for p := new(big.Int).Set(radix); p.Cmp(big.NewInt(1000000)) < 0; p.Mul(p, radix) {
+		minLen++
+	}
+	limit := new(big.Int).Lsh(big.NewInt(1), 96)
+	for p := new(big.Int).Set(radix); p.Cmp(limit) <= 0; p.Mul(p, radix) {
+		maxLen += 2
+	}
+	return &FF31{block: block, alphabet: runes, index: index, radix: radix, minLen: minLen, maxLen: maxLen}, nil
+}
+
+// MinLen returns the minimum length of the plain text.
+func (c *FF31) MinLen() int {
+	return c.minLen
+}
+
+// MaxLen returns the maximum length of the plain text.
+func (c *FF31) MaxLen() int {
+	return c.maxLen
+}
+
+// Encrypt encrypts the plain text, all characters of which must be in the
+// alphabet, with the 7 byte tweak.
+func (c *FF31) Encrypt(tweak []byte, plain string) (string, error) {
+	return c.cipher(tweak, plain, true)
+}
+
+// Decrypt decrypts a cipher text of Encrypt with the same tweak.
+func (c *FF31) Decrypt(tweak []byte, cipherText string) (string, error) {
+	return c.cipher(tweak, cipherText, false)
+}
+
+func (c *FF31) cipher(tweak []byte, text string, encrypt bool) (string, error) {
+	if len(tweak) != TweakSize {
+		return "", ErrInvalidTweak
+	}
+	x, err := c.numerals(text)
+	if err != nil {
+		return "", err
+	}
+	n := len(x)
+	if n < c.minLen || n > c.maxLen {
+		return "", ErrInvalidLength
+	}
+	u := (n + 1) / 2
+	v := n - u
+	a, b := x[:u], x[u:]
+
+	// T_L = T[0..27] || 0^4, T_R = T[32..55] || T[28..31]
+	tl := [4]byte{tweak[0], tweak[1], tweak[2], tweak[3] & 0xf0}
+	tr := [4]byte{tweak[4], tweak[5], tweak[6], tweak[3] << 4}
+
+	modU := new(big.Int).Exp(c.radix, big.NewInt(int64(u)), nil)
+	modV := new(big.Int).Exp(c.radix, big.NewInt(int64(v)), nil)
+	for r := 0; r < rounds; r++ {
+		i := r
+		if !encrypt {
+			i = rounds - 1 - r
+		}
+		m, w, mod := u, tr, modU
+		if i%2 == 1 {
+			m, w, mod = v, tl, modV
+		}
+		half := b
+		if !encrypt {
+			half = a
+		}
+		y := c.round(w, i, half)
+		var num *big.Int
+		if encrypt {
+			num = c.num(a)
+			num.Add(num, y)
+		} else {
+			num = c.num(b)
+			num.Sub(num, y)
+		}
+		num.Mod(num, mod)
+		out := c.str(num, m)
+		if encrypt {
+			a, b = b, out
+		} else {
+			a, b = out, a
+		}
+	}
+
+	runes := make([]rune, 0, n)
+	for _, d := range append(append([]int{}, a...), b...) {
+		runes = append(runes, c.alphabet[d])
+	}
+	return string(runes), nil
+}
+
+// round computes y = NUM(REVB(CIPH_REVB(K)(REVB(P)))) with
+// P = W xor [i]^4 || [NUM_radix(REV(half))]^12.
+func (c *FF31) round(w [4]byte, i int, half []int) *big.Int {
+	var p [16]byte
+	copy(p[:4], w[:])
+	p[3] ^= byte(i)
+	c.num(half).FillBytes(p[4:])
+	reverseInPlace(p[:])
+	var s [16]byte
+	c.block.Encrypt(s[:], p[:])
+	reverseInPlace(s[:])
+	return new(big.Int).SetBytes(s[:])
+}
+
+// num returns NUM_radix(REV(x)), the numerals are read least significant
+// first.
+func (c *FF31) num(x []int) *big.Int {
+	n := new(big.Int)
+	for i := len(x) - 1; i >= 0; i-- {
+		n.Mul(n, c.radix)
+		n.Add(n, big.NewInt(int64(x[i])))
+	}
+	return n
+}
+
+// str returns REV(STR^m_radix(n)), the numerals least significant first.
+func (c *FF31) str(n *big.Int, m int) []int {
+	x := make([]int, m)
+	n = new(big.Int).Set(n)
+	d := new(big.Int)
+	for i := 0; i < m; i++ {
+		n.DivMod(n, c.radix, d)
+		x[i] = int(d.Int64())
+	}
+	return x
+}
+
+func (c *FF31) numerals(text string) ([]int, error) {
+	x := make([]int, 0, len(text))
+	for _, r := range text {
+		d, ok := c.index[r]
+		if !ok {
+			return nil, ErrInvalidInput
+		}
+		x = append(x, d)
+	}
+	return x, nil
+}
+
+func reverseBytes(b []byte) []byte {
+	r := append([]byte(nil), b...)
+	reverseInPlace(r)
+	return r
+}
+
+func reverseInPlace(b []byte) {
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+}
@@ -0,0 +1,52 @@
+package fpe
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFF31KnownAnswer(t *testing.T) {
+	// NIST ACVP FF3-1 sample
+	key, _ := hex.DecodeString("2DE79D232DF5585D68CE47882AE256D6")
+	tweak, _ := hex.DecodeString("CBD09280979564")
+	c, err := NewFF31(key, Digits)
+	require.NoError(t, err)
+	cipherText, err := c.Encrypt(tweak, "3992520240")
+	require.NoError(t, err)
+	assert.Equal(t, "8901801106", cipherText)
+	plain, err := c.Decrypt(tweak, cipherText)
+	require.NoError(t, err)
+	assert.Equal(t, "3992520240", plain)
+}
+
+func TestFF31(t *testing.T) {
+	key, _ := hex.DecodeString("EF4359D8D580AA4F7F036D6F04FC6A942B7E151628AED2A6")
+	tweak, _ := hex.DecodeString("D8E7920AFA330A")
+	for _, alphabet := range []string{Digits, LowerAlnum, Alphanumeric} {
+		c, err := NewFF31(key, alphabet)
+		require.NoError(t, err)
+		for _, plain := range []string{"890121234567890000", "4000001234", "123456"} {
+			cipherText, err := c.Encrypt(tweak, plain)
+			require.NoError(t, err)
+			assert.Len(t, cipherText, len(plain))
+			assert.NotEqual(t, plain, cipherText)
+			decrypted, err := c.Decrypt(tweak, cipherText)
+			require.NoError(t, err)
+			assert.Equal(t, plain, decrypted)
+		}
+	}
+
+	c, err := NewFF31(key, Digits)
+	require.NoError(t, err)
+	assert.Equal(t, 6, c.MinLen())
+	assert.Equal(t, 56, c.MaxLen())
+	_, err = c.Encrypt(tweak, "12345")
+	assert.ErrorIs(t, err, ErrInvalidLength)
+	_, err = c.Encrypt(tweak, "12345a")
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	_, err = c.Encrypt(tweak[:6], "123456")
+	assert.ErrorIs(t, err, ErrInvalidTweak)
+}
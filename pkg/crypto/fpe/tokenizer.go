@@ -0,0 +1,101 @@
+package fpe
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+
+	"github.com/pkg/errors"
+)
+
+type TokenizerConfiguration struct {
+	// Key is the base64 encoded AES key, see crypto.GenerateAesKey.
+	Key string
+	// Alphabet holds the characters which are encrypted, defaults to Digits.
+	// Other characters, e.g. separators, are kept in place.
+	Alphabet string
+	// PreservePrefix and PreserveSuffix are the numbers of alphabet
+	// characters kept in clear at the start and the end, e.g. the BIN and the
+	// last 4 digits of a card number. The prefix is shortened when fewer than
+	// MinLen characters would be left to encrypt.
+	PreservePrefix int
+	PreserveSuffix int
+}
+
+// Tokenizer encrypts values such as card and phone numbers into tokens of
+// the same format. Tokens are deterministic per tenant, the tenant is the
+// tweak of the encryption so that equal values of different tenants give
+// different tokens.
+type Tokenizer struct {
+	c      *TokenizerConfiguration
+	cipher *FF31
+}
+
+func NewTokenizer(c *TokenizerConfiguration) (*Tokenizer, error) {
+	key, err := base64.RawStdEncoding.DecodeString(c.Key)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to decode fpe key")
+	}
+	cfg := *c
+	if cfg.Alphabet == "" {
+		cfg.Alphabet = Digits
+	}
+	cipher, err := NewFF31(key, cfg.Alphabet)
+	if err != nil {
+		return nil, err
+	}
+	return &Tokenizer{c: &cfg, cipher: cipher}, nil
+}
+
+// NewPANTokenizer creates a tokenizer of card numbers which keeps the 6
+// digit BIN and the last 4 digits.
+func NewPANTokenizer(key string) (*Tokenizer, error) {
+	return NewTokenizer(&TokenizerConfiguration{Key: key, Alphabet: Digits, PreservePrefix: 6, PreserveSuffix: 4})
+}
+
+// Tokenize returns the token of the value for the tenant.
+func (t *Tokenizer) Tokenize(ctx context.Context, tenant, value string) (string, error) {
+	return t.apply(tenant, value, t.cipher.Encrypt)
+}
+
+// Detokenize returns the value of a token of Tokenize for the same tenant.
+func (t *Tokenizer) Detokenize(ctx context.Context, tenant, token string) (string, error) {
+	return t.apply(tenant, token, t.cipher.Decrypt)
+}
+
+func (t *Tokenizer) apply(tenant, value string, fn func(tweak []byte, text string) (string, error)) (string, error) {
+	runes := []rune(value)
+	positions := make([]int, 0, len(runes))
+	for i, r := range runes {
+		if _, ok := t.cipher.index[r]; ok {
+			positions = append(positions, i)
+		}
+	}
+	prefix, suffix := t.c.PreservePrefix, t.c.PreserveSuffix
+	if n := len(positions) - suffix - t.cipher.MinLen(); prefix > n {
+		prefix = max(n, 0)
+	}
+	if prefix+suffix >= len(positions) {
+		return "", ErrInvalidLength
+	}
+	positions = positions[prefix : len(positions)-suffix]
+
+	text := make([]rune, len(positions))
+	for i, p := range positions {
+		text[i] = runes[p]
+	}
+	out, err := fn(tenantTweak(tenant), string(text))
+	if err != nil {
+		return "", err
+	}
+	for i, r := range []rune(out) {
+		runes[positions[i]] = r
+	}
+	return string(runes), nil
+}
+
+// tenantTweak derives the 7 byte FF3-1 tweak of the tenant.
+func tenantTweak(tenant string) []byte {
+	sum := sha256.Sum256([]byte(tenant))
+	return sum[:TweakSize]
+}
@@ -0,0 +1,55 @@
+package fpe
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenizer(t *testing.T) {
+	ctx := context.Background()
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	pan, err := NewPANTokenizer(base64.RawStdEncoding.EncodeToString(key))
+	require.NoError(t, err)
+
+	for _, value := range []string{"4111111111111111", "4111 1111 1111 1111", "378282246310005", "4111111111111111111"} {
+		token, err := pan.Tokenize(ctx, "tenant-a", value)
+		require.NoError(t, err)
+		assert.Len(t, token, len(value))
+		assert.NotEqual(t, value, token)
+		assert.Equal(t, value[len(value)-4:], token[len(token)-4:])
+		for i, r := range value {
+			assert.Equal(t, r == ' ', rune(token[i]) == ' ')
+		}
+		got, err := pan.Detokenize(ctx, "tenant-a", token)
+		require.NoError(t, err)
+		assert.Equal(t, value, got)
+
+		again, err := pan.Tokenize(ctx, "tenant-a", value)
+		require.NoError(t, err)
+		assert.Equal(t, token, again)
+		other, err := pan.Tokenize(ctx, "tenant-b", value)
+		require.NoError(t, err)
+		assert.NotEqual(t, token, other)
+	}
+
+	token, err := pan.Tokenize(ctx, "tenant-a", "4111111111111111")
+	require.NoError(t, err)
+	assert.Equal(t, "411111", token[:6])
+
+	phone, err := NewTokenizer(&TokenizerConfiguration{Key: base64.RawStdEncoding.EncodeToString(key), PreservePrefix: 2})
+	require.NoError(t, err)
+	token, err = phone.Tokenize(ctx, "tenant-a", "+44 20-7946-0958")
+	require.NoError(t, err)
+	assert.Equal(t, "+44 ", token[:4])
+	assert.Equal(t, "-", token[6:7])
+
+	_, err = pan.Tokenize(ctx, "tenant-a", "4111 1111")
+	assert.ErrorIs(t, err, ErrInvalidLength)
+}
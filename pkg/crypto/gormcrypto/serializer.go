@@ -0,0 +1,147 @@
+// Package gormcrypto encrypts model fields transparently with GORM
+// serializers backed by crypto.CryptoUtil.
+//
+//	type Customer struct {
+//		Id         uint64
+//		Email      string `gorm:"column:email;serializer:encrypted"`
+//		EmailAlias []byte `gorm:"column:email_alias;index;serializer:alias;aliasof:Email"`
+//	}
+//
+// Email is stored encrypted with the column as associated data, and
+// EmailAlias receives the alias of the plain Email on every write so that
+// rows can be looked up with Alias.
+package gormcrypto
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/achuala/go-svc-extn/pkg/crypto"
+	"gorm.io/gorm/schema"
+)
+
+// Serializer names of the gorm tag.
+const (
+	SerializerEncrypted = "encrypted"
+	SerializerAlias     = "alias"
+)
+
+// Register registers the encrypted and alias serializers with GORM. The
+// serializers are global, the last registered CryptoUtil is used.
+func Register(u *crypto.CryptoUtil) {
+	schema.RegisterSerializer(SerializerEncrypted, &EncryptedSerializer{u: u})
+	schema.RegisterSerializer(SerializerAlias, &AliasSerializer{u: u})
+}
+
+// Alias returns the alias of the value to query an alias column.
+func Alias(ctx context.Context, u *crypto.CryptoUtil, value string) ([]byte, error) {
+	return u.CreateAlias(ctx, []byte(value))
+}
+
+var _ schema.SerializerInterface = (*EncryptedSerializer)(nil)
+
+// EncryptedSerializer encrypts string and []byte fields. The table and the
+// column are the associated data, a value copied to another column can't be
+// decrypted. Empty values are stored empty.
+type EncryptedSerializer struct {
+	u *crypto.CryptoUtil
+}
+
+func (s *EncryptedSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	plain, err := plainBytes(field, fieldValue)
+	if err != nil || len(plain) == 0 {
+		return "", err
+	}
+	return s.u.Encrypt(ctx, plain, associatedData(field))
+}
+
+func (s *EncryptedSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	fieldValue := reflect.New(field.FieldType).Elem()
+	var cipherText string
+	switch v := dbValue.(type) {
+	case nil:
+	case string:
+		cipherText = v
+	case []byte:
+		cipherText = string(v)
+	default:
+		return fmt.Errorf("failed to decrypt %s, unsupported value %T", field.Name, dbValue)
+	}
+	if cipherText != "" {
+		plain, err := s.u.Decrypt(ctx, cipherText, associatedData(field))
+		if err != nil {
+			return fmt.Errorf("failed to decrypt %s: %w", field.Name, err)
+		}
+		switch field.FieldType.Kind() {
+		case reflect.String:
+			fieldValue.SetString(string(plain))
+		default:
+			fieldValue.SetBytes(plain)
+		}
+	}
+	field.ReflectValueOf(ctx, dst).Set(fieldValue)
+	return nil
+}
+
+var _ schema.SerializerInterface = (*AliasSerializer)(nil)
+
+// AliasSerializer writes the alias of the plain value of the field named by
+// the aliasof tag setting, the field's own value is ignored on writes.
+type AliasSerializer struct {
+	u *crypto.CryptoUtil
+}
+
+func (s *AliasSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	name := field.TagSettings["ALIASOF"]
+	source := field.Schema.LookUpField(name)
+	if source == nil {
+		return nil, fmt.Errorf("alias field %s: unknown aliasof field %q", field.Name, name)
+	}
+	// ValueOf of a serialized field, e.g. an encrypted one, returns the GORM
+	// serializer wrapper instead of the plain value.
+	plain, err := plainBytes(source, source.ReflectValueOf(ctx, dst).Interface())
+	if err != nil {
+		return nil, err
+	}
+	return s.u.CreateAlias(ctx, plain)
+}
+
+func (s *AliasSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	fieldValue := reflect.New(field.FieldType).Elem()
+	var alias []byte
+	switch v := dbValue.(type) {
+	case nil:
+	case string:
+		alias = []byte(v)
+	case []byte:
+		alias = append([]byte(nil), v...)
+	default:
+		return fmt.Errorf("failed to scan %s, unsupported value %T", field.Name, dbValue)
+	}
+	switch field.FieldType.Kind() {
+	case reflect.String:
+		fieldValue.SetString(string(alias))
+	default:
+		fieldValue.SetBytes(alias)
+	}
+	field.ReflectValueOf(ctx, dst).Set(fieldValue)
+	return nil
+}
+
+func plainBytes(field *schema.Field, fieldValue interface{}) ([]byte, error) {
+	switch v := fieldValue.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	default:
+		return nil, fmt.Errorf("field %s must be a string or []byte, but is %T", field.Name, fieldValue)
+	}
+}
+
+func associatedData(field *schema.Field) []byte {
+	return []byte(field.Schema.Table + "." + field.DBName)
+}
@@ -0,0 +1,69 @@
+package gormcrypto
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/achuala/go-svc-extn/pkg/crypto"
+	"github.com/achuala/go-svc-extn/pkg/crypto/encdec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm/schema"
+)
+
+type customer struct {
+	Id         uint64
+	Email      string `gorm:"column:email;serializer:encrypted"`
+	Document   []byte `gorm:"column:document;serializer:encrypted"`
+	EmailAlias []byte `gorm:"column:email_alias;serializer:alias;aliasof:Email"`
+}
+
+func TestSerializers(t *testing.T) {
+	ctx := context.Background()
+	kekUri, err := encdec.NewKeyURI()
+	require.NoError(t, err)
+	keySetData, err := encdec.NewKeyset(kekUri, nil)
+	require.NoError(t, err)
+	u, err := crypto.NewCryptoUtil(&crypto.CryptoConfig{KmsUri: kekUri, KeysetData: keySetData, HmacKey: "QWVzR2NtS2V5EhIaECT2tUhyiuLKsiUlTbWSZq"})
+	require.NoError(t, err)
+	Register(u)
+
+	s, err := schema.Parse(&customer{}, &sync.Map{}, schema.NamingStrategy{})
+	require.NoError(t, err)
+	encrypted := &EncryptedSerializer{u: u}
+	alias := &AliasSerializer{u: u}
+
+	in := customer{Email: "bond@example.com", Document: []byte("passport")}
+	src := reflect.ValueOf(&in).Elem()
+	var out customer
+	dst := reflect.ValueOf(&out).Elem()
+
+	email, err := encrypted.Value(ctx, s.LookUpField("Email"), src, in.Email)
+	require.NoError(t, err)
+	assert.NotContains(t, email, "bond")
+	require.NoError(t, encrypted.Scan(ctx, s.LookUpField("Email"), dst, email))
+	assert.Equal(t, in.Email, out.Email)
+
+	// the column is the associated data
+	assert.Error(t, encrypted.Scan(ctx, s.LookUpField("Document"), dst, email))
+	document, err := encrypted.Value(ctx, s.LookUpField("Document"), src, in.Document)
+	require.NoError(t, err)
+	require.NoError(t, encrypted.Scan(ctx, s.LookUpField("Document"), dst, []byte(document.(string))))
+	assert.Equal(t, in.Document, out.Document)
+
+	emailAlias, err := alias.Value(ctx, s.LookUpField("EmailAlias"), src, in.EmailAlias)
+	require.NoError(t, err)
+	expected, err := Alias(ctx, u, in.Email)
+	require.NoError(t, err)
+	assert.Equal(t, expected, emailAlias)
+	require.NoError(t, alias.Scan(ctx, s.LookUpField("EmailAlias"), dst, emailAlias))
+	assert.Equal(t, expected, out.EmailAlias)
+
+	empty, err := encrypted.Value(ctx, s.LookUpField("Email"), src, "")
+	require.NoError(t, err)
+	assert.Equal(t, "", empty)
+	require.NoError(t, encrypted.Scan(ctx, s.LookUpField("Email"), dst, nil))
+	assert.Equal(t, "", out.Email)
+}
@@ -0,0 +1,198 @@
+package hash
+
+import (
+	"crypto/md5"  //#nosec G501 -- checksums of legacy artifacts
+	"crypto/sha1" //#nosec G505 -- checksums of legacy artifacts
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	stdhash "hash"
+	"hash/crc32"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/sha3"
+)
+
+// Digest algorithms supported by SumReader and MultiSum.
+const (
+	DigestMD5        = "md5"
+	DigestSHA1       = "sha1"
+	DigestSHA256     = "sha256"
+	DigestSHA384     = "sha384"
+	DigestSHA512     = "sha512"
+	DigestSHA3_256   = "sha3-256"
+	DigestSHA3_512   = "sha3-512"
+	DigestBlake2b256 = "blake2b-256"
+	DigestBlake2b512 = "blake2b-512"
+	DigestCRC32C     = "crc32c"
+)
+
+var (
+	ErrUnknownDigest  = errors.New("unknown digest algorithm")
+	ErrDigestMismatch = errors.New("digest does not match")
+)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// NewDigest returns a new unkeyed hash.Hash for the digest algorithm.
+func NewDigest(algo string) (stdhash.Hash, error) {
+	switch algo {
+	case DigestMD5:
+		return md5.New(), nil //#nosec G401 -- checksums of legacy artifacts
+	case DigestSHA1:
+		return sha1.New(), nil //#nosec G401 -- checksums of legacy artifacts
+	case DigestSHA256:
+		return sha256.New(), nil
+	case DigestSHA384:
+		return sha512.New384(), nil
+	case DigestSHA512:
+		return sha512.New(), nil
+	case DigestSHA3_256:
+		return sha3.New256(), nil
+	case DigestSHA3_512:
+		return sha3.New512(), nil
+	case DigestBlake2b256:
+		return blake2b.New256(nil)
+	case DigestBlake2b512:
+		return blake2b.New512(nil)
+	case DigestCRC32C:
+		return crc32.New(crc32cTable), nil
+	default:
+		return nil, errors.Wrap(ErrUnknownDigest, algo)
+	}
+}
+
+// SumReader returns the digest of everything read from r.
+func SumReader(algo string, r io.Reader) ([]byte, error) {
+	h, err := NewDigest(algo)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return h.Sum(nil), nil
+}
+
+// SumFile returns the digest of the file contents.
+func SumFile(algo, path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer f.Close()
+	return SumReader(algo, f)
+}
+
+// VerifyReader compares the digest of r with the expected digest in constant
+// time and returns ErrDigestMismatch when they differ.
+func VerifyReader(algo string, r io.Reader, expected []byte) error {
+	sum, err := SumReader(algo, r)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare(sum, expected) != 1 {
+		return errors.Wrap(ErrDigestMismatch, algo)
+	}
+	return nil
+}
+
+// MultiHasher computes several digests of the same data in one pass.
+// It is an io.Writer and can be combined with io.TeeReader or io.MultiWriter.
+type MultiHasher struct {
+	algos   []string
+	digests []stdhash.Hash
+	writer  io.Writer
+}
+
+// NewMultiHasher returns a MultiHasher for the digest algorithms, defaulting
+// to SHA-256, SHA-512 and CRC32C.
+func NewMultiHasher(algos ...string) (*MultiHasher, error) {
+	if len(algos) == 0 {
+		algos = []string{DigestSHA256, DigestSHA512, DigestCRC32C}
+	}
+	m := &MultiHasher{algos: algos}
+	writers := make([]io.Writer, 0, len(algos))
+	for _, algo := range algos {
+		h, err := NewDigest(algo)
+		if err != nil {
+			return nil, err
+		}
+		m.digests = append(m.digests, h)
+		writers = append(writers, h)
+	}
+	m.writer = io.MultiWriter(writers...)
+	return m, nil
+}
+
+func (m *MultiHasher) Write(p []byte) (int, error) {
+	return m.writer.Write(p)
+}
+
+// Sums returns the digests computed so far by algorithm.
+func (m *MultiHasher) Sums() map[string][]byte {
+	sums := make(map[string][]byte, len(m.algos))
+	for i, algo := range m.algos {
+		sums[algo] = m.digests[i].Sum(nil)
+	}
+	return sums
+}
+
+// Reset resets all the digests.
+func (m *MultiHasher) Reset() {
+	for _, h := range m.digests {
+		h.Reset()
+	}
+}
+
+// SumOptions configures MultiSum.
+type SumOptions struct {
+	// Algorithms to compute, defaults to SHA-256, SHA-512 and CRC32C.
+	Algorithms []string
+	// Tee receives a copy of the data, e.g. the destination file of a download.
+	Tee io.Writer
+	// Progress is called with the total number of bytes read after every chunk.
+	Progress func(total int64)
+}
+
+// MultiSum reads r to the end and returns all the digests and the number of
+// bytes read.
+func MultiSum(r io.Reader, opts *SumOptions) (map[string][]byte, int64, error) {
+	if opts == nil {
+		opts = &SumOptions{}
+	}
+	m, err := NewMultiHasher(opts.Algorithms...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var w io.Writer = m
+	if opts.Tee != nil {
+		w = io.MultiWriter(m, opts.Tee)
+	}
+	if opts.Progress != nil {
+		w = &progressWriter{w: w, progress: opts.Progress}
+	}
+
+	n, err := io.Copy(w, r)
+	if err != nil {
+		return nil, n, errors.WithStack(err)
+	}
+	return m.Sums(), n, nil
+}
+
+type progressWriter struct {
+	w        io.Writer
+	total    int64
+	progress func(total int64)
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.total += int64(n)
+	p.progress(p.total)
+	return n, err
+}
@@ -47,7 +47,13 @@ func NewCryptDecoder() *crypt.Decoder {
 
 var CryptDecoder = NewCryptDecoder()
 
+// Compare compares the password with the hash, detecting the algorithm from the
+// hash format. Failures are reported as *HashError.
 func Compare(ctx context.Context, password []byte, hash []byte) error {
+	return newHashError(DetectAlgorithm(hash), compare(ctx, password, hash))
+}
+
+func compare(ctx context.Context, password []byte, hash []byte) error {
 	switch {
 	case IsMD5CryptHash(hash):
 		return CompareMD5Crypt(ctx, password, hash)
@@ -262,6 +268,8 @@ var (
 	isFirebaseScryptHash = regexp.MustCompile(`^\$firescrypt\$`)
 	isMD5Hash            = regexp.MustCompile(`^\$md5\$`)
 	isSip24Hash          = regexp.MustCompile(`^\$sip24\$`)
+	isHmacSha256Hash     = regexp.MustCompile(`^\$hmac-sha256\$`)
+	isBlake2bHash        = regexp.MustCompile(`^\$blake2b\$`)
 )
 
 func IsMD5CryptHash(hash []byte) bool       { return isMD5CryptHash.Match(hash) }
@@ -277,6 +285,47 @@ func IsSHAHash(hash []byte) bool            { return isSHAHash.Match(hash) }
 func IsFirebaseScryptHash(hash []byte) bool { return isFirebaseScryptHash.Match(hash) }
 func IsMD5Hash(hash []byte) bool            { return isMD5Hash.Match(hash) }
 func IsSip24Hash(hash []byte) bool          { return isSip24Hash.Match(hash) }
+func IsHmacSha256Hash(hash []byte) bool     { return isHmacSha256Hash.Match(hash) }
+func IsBlake2bHash(hash []byte) bool        { return isBlake2bHash.Match(hash) }
+
+// DetectAlgorithm returns the algorithm of the hash, or an empty string when
+// the format is not recognised.
+func DetectAlgorithm(hash []byte) string {
+	switch {
+	case IsMD5CryptHash(hash):
+		return AlgorithmMD5Crypt
+	case IsBcryptHash(hash):
+		return AlgorithmBcrypt
+	case IsSHA256CryptHash(hash):
+		return AlgorithmSHA256Crypt
+	case IsSHA512CryptHash(hash):
+		return AlgorithmSHA512Crypt
+	case IsArgon2idHash(hash):
+		return AlgorithmArgon2id
+	case IsArgon2iHash(hash):
+		return AlgorithmArgon2i
+	case IsPbkdf2Hash(hash):
+		return AlgorithmPbkdf2
+	case IsScryptHash(hash):
+		return AlgorithmScrypt
+	case IsSSHAHash(hash):
+		return AlgorithmSSHA
+	case IsSHAHash(hash):
+		return AlgorithmSHA
+	case IsFirebaseScryptHash(hash):
+		return AlgorithmFirebaseScrypt
+	case IsMD5Hash(hash):
+		return AlgorithmMD5
+	case IsSip24Hash(hash):
+		return AlgorithmSip24
+	case IsHmacSha256Hash(hash):
+		return AlgorithmHmacSha256
+	case IsBlake2bHash(hash):
+		return AlgorithmBlake2b
+	default:
+		return ""
+	}
+}
 
 func IsValidHashFormat(hash []byte) bool {
 	if IsMD5CryptHash(hash) ||
@@ -291,7 +340,9 @@ func IsValidHashFormat(hash []byte) bool {
 		IsSHAHash(hash) ||
 		IsFirebaseScryptHash(hash) ||
 		IsMD5Hash(hash) ||
-		IsSip24Hash(hash) {
+		IsSip24Hash(hash) ||
+		IsHmacSha256Hash(hash) ||
+		IsBlake2bHash(hash) {
 		return true
 	} else {
 		return false
@@ -449,7 +500,7 @@ func compareSHAHelper(hasher string, raw []byte, hash []byte) error {
 		sum := sha512.Sum512(raw)
 		sha = sum[:]
 	default:
-		return errors.WithStack(ErrMismatchedHashAndPassword)
+		return errors.WithStack(ErrUnknownHashAlgorithm)
 	}
 
 	encodedHash := []byte(base64.StdEncoding.EncodeToString(hash))
@@ -0,0 +1,113 @@
+package hash
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+var ErrPasswordTooLong = errors.New("password cannot exceed 72 bytes")
+
+// Reason classifies why a hash comparison failed.
+type Reason int
+
+const (
+	// ReasonMismatch means the hash is valid but the password does not match it.
+	ReasonMismatch Reason = iota + 1
+	// ReasonMalformed means the stored hash could not be decoded.
+	ReasonMalformed
+	// ReasonUnsupported means the hash algorithm or version is not supported.
+	ReasonUnsupported
+)
+
+func (r Reason) String() string {
+	switch r {
+	case ReasonMismatch:
+		return "mismatch"
+	case ReasonMalformed:
+		return "malformed"
+	case ReasonUnsupported:
+		return "unsupported"
+	default:
+		return fmt.Sprintf("reason(%d)", int(r))
+	}
+}
+
+// HashError is returned by Compare, it carries the detected algorithm and the
+// reason of the failure. The underlying error is available through errors.Unwrap.
+//
+// errors.Is reports ErrMismatchedHashAndPassword, ErrInvalidHash and
+// ErrUnknownHashAlgorithm for the respective reasons.
+type HashError struct {
+	Algorithm string
+	Reason    Reason
+	Err       error
+}
+
+func (e *HashError) Error() string {
+	algorithm := e.Algorithm
+	if algorithm == "" {
+		algorithm = "unknown"
+	}
+	return fmt.Sprintf("%s hash comparison failed (%s): %v", algorithm, e.Reason, e.Err)
+}
+
+func (e *HashError) Unwrap() error {
+	return e.Err
+}
+
+func (e *HashError) Is(target error) bool {
+	switch target {
+	case ErrMismatchedHashAndPassword:
+		return e.Reason == ReasonMismatch
+	case ErrInvalidHash:
+		return e.Reason == ReasonMalformed
+	case ErrUnknownHashAlgorithm:
+		return e.Reason == ReasonUnsupported
+	default:
+		return false
+	}
+}
+
+// IsMismatch reports whether the error is a password mismatch against a valid hash.
+func IsMismatch(err error) bool {
+	return reasonOf(err) == ReasonMismatch
+}
+
+// IsMalformed reports whether the error is caused by a hash that could not be decoded.
+func IsMalformed(err error) bool {
+	return reasonOf(err) == ReasonMalformed
+}
+
+// IsUnsupported reports whether the error is caused by an unsupported algorithm or version.
+func IsUnsupported(err error) bool {
+	return reasonOf(err) == ReasonUnsupported
+}
+
+func reasonOf(err error) Reason {
+	var hashErr *HashError
+	if errors.As(err, &hashErr) {
+		return hashErr.Reason
+	}
+	return 0
+}
+
+// newHashError classifies the error returned by a comparator.
+func newHashError(algorithm string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var hashErr *HashError
+	if errors.As(err, &hashErr) {
+		return err
+	}
+
+	reason := ReasonMalformed
+	switch {
+	case errors.Is(err, ErrMismatchedHashAndPassword), errors.Is(err, ErrPasswordTooLong):
+		reason = ReasonMismatch
+	case errors.Is(err, ErrUnknownHashAlgorithm), errors.Is(err, ErrIncompatibleVersion):
+		reason = ReasonUnsupported
+	}
+	return &HashError{Algorithm: algorithm, Reason: reason, Err: err}
+}
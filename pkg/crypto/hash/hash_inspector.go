@@ -0,0 +1,325 @@
+package hash
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Algorithm names reported by InspectHash.
+const (
+	AlgorithmMD5Crypt       = "md5-crypt"
+	AlgorithmBcrypt         = "bcrypt"
+	AlgorithmSHA256Crypt    = "sha256-crypt"
+	AlgorithmSHA512Crypt    = "sha512-crypt"
+	AlgorithmArgon2id       = "argon2id"
+	AlgorithmArgon2i        = "argon2i"
+	AlgorithmPbkdf2         = "pbkdf2"
+	AlgorithmScrypt         = "scrypt"
+	AlgorithmSSHA           = "ssha"
+	AlgorithmSHA            = "sha"
+	AlgorithmFirebaseScrypt = "firescrypt"
+	AlgorithmMD5            = "md5"
+	AlgorithmSip24          = "sip24"
+	AlgorithmHmacSha256     = "hmac-sha256"
+	AlgorithmBlake2b        = "blake2b"
+)
+
+var ErrPolicyViolation = errors.New("hash does not satisfy the policy")
+
+// Strength is the estimated relative strength of a stored hash against offline
+// brute force attacks.
+type Strength int
+
+const (
+	StrengthWeak Strength = iota
+	StrengthModerate
+	StrengthStrong
+)
+
+func (s Strength) String() string {
+	switch s {
+	case StrengthWeak:
+		return "weak"
+	case StrengthModerate:
+		return "moderate"
+	case StrengthStrong:
+		return "strong"
+	default:
+		return fmt.Sprintf("strength(%d)", int(s))
+	}
+}
+
+// HashInfo describes the algorithm and cost parameters of an encoded hash.
+// Parameters which do not apply to the algorithm are left zero.
+type HashInfo struct {
+	Algorithm string
+	// Digest is the underlying digest for pbkdf2, sha and ssha hashes.
+	Digest string
+	// Iterations is the argon2 time cost, pbkdf2 iterations or crypt rounds.
+	Iterations uint32
+	// Memory is the argon2 memory cost in KiB.
+	Memory      uint32
+	Parallelism uint32
+	// Cost is the bcrypt cost or the scrypt CPU/memory cost (N).
+	Cost      uint32
+	BlockSize uint32
+	// SaltLength and KeyLength are in bytes, for crypt hashes the length the
+	// crypt base64 encoding of the salt and digest decodes to.
+	SaltLength int
+	KeyLength  int
+	Strength   Strength
+}
+
+// InspectHash decodes the given hash and returns its algorithm, cost parameters,
+// salt length and estimated strength. The password is not required.
+func InspectHash(hash []byte) (*HashInfo, error) {
+	info, err := inspectHash(hash)
+	if err != nil {
+		return nil, err
+	}
+	info.Strength = gradeHashStrength(info)
+	return info, nil
+}
+
+func inspectHash(hash []byte) (*HashInfo, error) {
+	switch {
+	case IsMD5CryptHash(hash):
+		return inspectCryptHash(AlgorithmMD5Crypt, string(hash), 1000)
+	case IsBcryptHash(hash):
+		cost, err := bcrypt.Cost(hash)
+		if err != nil {
+			return nil, errors.WithStack(ErrInvalidHash)
+		}
+		// bcrypt always uses a 128 bit salt and a 184 bit digest.
+		return &HashInfo{Algorithm: AlgorithmBcrypt, Cost: uint32(cost), SaltLength: 16, KeyLength: 23}, nil
+	case IsSHA256CryptHash(hash):
+		return inspectCryptHash(AlgorithmSHA256Crypt, string(hash), 5000)
+	case IsSHA512CryptHash(hash):
+		return inspectCryptHash(AlgorithmSHA512Crypt, string(hash), 5000)
+	case IsArgon2idHash(hash), IsArgon2iHash(hash):
+		p, salt, key, err := decodeArgon2idHash(string(hash))
+		if err != nil {
+			return nil, err
+		}
+		algorithm := AlgorithmArgon2id
+		if IsArgon2iHash(hash) {
+			algorithm = AlgorithmArgon2i
+		}
+		return &HashInfo{
+			Algorithm:   algorithm,
+			Iterations:  p.Iterations,
+			Memory:      uint32(p.Memory),
+			Parallelism: uint32(p.Parallelism),
+			SaltLength:  len(salt),
+			KeyLength:   len(key),
+		}, nil
+	case IsPbkdf2Hash(hash):
+		p, salt, key, err := decodePbkdf2Hash(string(hash))
+		if err != nil {
+			return nil, err
+		}
+		return &HashInfo{
+			Algorithm:  AlgorithmPbkdf2,
+			Digest:     p.Algorithm,
+			Iterations: p.Iterations,
+			SaltLength: len(salt),
+			KeyLength:  len(key),
+		}, nil
+	case IsScryptHash(hash):
+		p, salt, key, err := decodeScryptHash(string(hash))
+		if err != nil {
+			return nil, err
+		}
+		return &HashInfo{
+			Algorithm:   AlgorithmScrypt,
+			Cost:        p.Cost,
+			BlockSize:   p.Block,
+			Parallelism: p.Parallelization,
+			SaltLength:  len(salt),
+			KeyLength:   len(key),
+		}, nil
+	case IsSSHAHash(hash):
+		digest, salt, key, err := decodeSSHAHash(string(hash))
+		if err != nil {
+			return nil, err
+		}
+		return &HashInfo{Algorithm: AlgorithmSSHA, Digest: digest, Iterations: 1, SaltLength: len(salt), KeyLength: len(key)}, nil
+	case IsSHAHash(hash):
+		digest, _, salt, key, err := decodeSHAHash(string(hash))
+		if err != nil {
+			return nil, err
+		}
+		return &HashInfo{Algorithm: AlgorithmSHA, Digest: digest, Iterations: 1, SaltLength: len(salt), KeyLength: len(key)}, nil
+	case IsFirebaseScryptHash(hash):
+		p, salt, _, key, _, err := decodeFirebaseScryptHash(string(hash))
+		if err != nil {
+			return nil, err
+		}
+		return &HashInfo{
+			Algorithm:   AlgorithmFirebaseScrypt,
+			Cost:        p.Cost,
+			BlockSize:   p.Block,
+			Parallelism: p.Parallelization,
+			SaltLength:  len(salt),
+			KeyLength:   len(key),
+		}, nil
+	case IsMD5Hash(hash):
+		_, salt, key, err := decodeMD5Hash(string(hash))
+		if err != nil {
+			return nil, err
+		}
+		return &HashInfo{Algorithm: AlgorithmMD5, Digest: "md5", Iterations: 1, SaltLength: len(salt), KeyLength: len(key)}, nil
+	case IsSip24Hash(hash):
+		return inspectKeyedHash(AlgorithmSip24, string(hash))
+	case IsHmacSha256Hash(hash):
+		return inspectKeyedHash(AlgorithmHmacSha256, string(hash))
+	case IsBlake2bHash(hash):
+		return inspectKeyedHash(AlgorithmBlake2b, string(hash))
+	default:
+		return nil, errors.WithStack(ErrUnknownHashAlgorithm)
+	}
+}
+
+// inspectCryptHash reads the rounds and salt of a crypt(5) style hash.
+// format: $<id>$[rounds=<rounds>$]<salt>$<hash>
+func inspectCryptHash(algorithm, encodedHash string, defaultRounds uint32) (*HashInfo, error) {
+	parts := strings.Split(encodedHash, "$")
+	if len(parts) < 4 {
+		return nil, errors.WithStack(ErrInvalidHash)
+	}
+
+	info := &HashInfo{Algorithm: algorithm, Iterations: defaultRounds}
+	parts = parts[2:]
+	if strings.HasPrefix(parts[0], "rounds=") {
+		if _, err := fmt.Sscanf(parts[0], "rounds=%d", &info.Iterations); err != nil {
+			return nil, errors.WithStack(ErrInvalidHash)
+		}
+		parts = parts[1:]
+	}
+	if len(parts) != 2 {
+		return nil, errors.WithStack(ErrInvalidHash)
+	}
+	info.SaltLength = cryptDecodedLen(parts[0])
+	info.KeyLength = cryptDecodedLen(parts[1])
+
+	return info, nil
+}
+
+// cryptDecodedLen returns the number of bytes the crypt base64 string s
+// decodes to, each character encoding 6 bits.
+func cryptDecodedLen(s string) int {
+	return len(s) * 6 / 8
+}
+
+// inspectKeyedHash reads the digest length of a versioned keyed hash.
+// format: $<id>$<key id>$<hash>
+func inspectKeyedHash(algorithm, encodedHash string) (*HashInfo, error) {
+	parts := strings.Split(encodedHash, "$")
+	if len(parts) != 4 {
+		return nil, errors.WithStack(ErrInvalidHash)
+	}
+	key, err := base64.StdEncoding.Strict().DecodeString(parts[3])
+	if err != nil {
+		return nil, errors.WithStack(ErrInvalidHash)
+	}
+	return &HashInfo{Algorithm: algorithm, Iterations: 1, KeyLength: len(key)}, nil
+}
+
+// gradeHashStrength grades the hash parameters against the current OWASP
+// password storage recommendations. Salts shorter than 16 bytes lower the
+// grade by one level.
+func gradeHashStrength(info *HashInfo) Strength {
+	var s Strength
+	switch info.Algorithm {
+	case AlgorithmArgon2id, AlgorithmArgon2i:
+		switch {
+		case info.Memory >= 19*1024 && info.Iterations >= 2:
+			s = StrengthStrong
+		case info.Memory >= 7*1024:
+			s = StrengthModerate
+		}
+		if info.Algorithm == AlgorithmArgon2i && s == StrengthStrong {
+			s = StrengthModerate
+		}
+	case AlgorithmBcrypt:
+		switch {
+		case info.Cost >= 12:
+			s = StrengthStrong
+		case info.Cost >= 10:
+			s = StrengthModerate
+		}
+	case AlgorithmScrypt, AlgorithmFirebaseScrypt:
+		switch {
+		case info.Cost >= 1<<17 && info.BlockSize >= 8:
+			s = StrengthStrong
+		case info.Cost >= 1<<14:
+			s = StrengthModerate
+		}
+	case AlgorithmPbkdf2:
+		strong := uint32(600_000)
+		switch info.Digest {
+		case "sha1":
+			strong = 1_300_000
+		case "sha512":
+			strong = 210_000
+		}
+		switch {
+		case info.Iterations >= strong:
+			s = StrengthStrong
+		case info.Iterations >= 100_000:
+			s = StrengthModerate
+		}
+	case AlgorithmSHA256Crypt, AlgorithmSHA512Crypt:
+		if info.Iterations >= 5000 {
+			s = StrengthModerate
+		}
+	default:
+		// single round digests and md5-crypt are trivially brute forced
+		s = StrengthWeak
+	}
+
+	if s > StrengthWeak && info.Algorithm != AlgorithmBcrypt && info.SaltLength < 16 {
+		s--
+	}
+	return s
+}
+
+// Policy describes the minimum requirements for stored hashes.
+type Policy struct {
+	// AllowedAlgorithms restricts the accepted algorithms, empty allows all.
+	AllowedAlgorithms []string
+	MinStrength       Strength
+	// MinSaltLength is in bytes, like HashInfo.SaltLength.
+	MinSaltLength int
+}
+
+// Validate checks the inspected hash against the policy and returns an error
+// wrapping ErrPolicyViolation describing the first requirement that is not met.
+func (p *Policy) Validate(info *HashInfo) error {
+	if info == nil {
+		return errors.Wrap(ErrPolicyViolation, "missing hash info")
+	}
+	if len(p.AllowedAlgorithms) > 0 {
+		allowed := false
+		for _, a := range p.AllowedAlgorithms {
+			if a == info.Algorithm {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return errors.Wrapf(ErrPolicyViolation, "algorithm %s is not allowed", info.Algorithm)
+		}
+	}
+	if info.Strength < p.MinStrength {
+		return errors.Wrapf(ErrPolicyViolation, "strength %s is below %s", info.Strength, p.MinStrength)
+	}
+	if info.SaltLength < p.MinSaltLength {
+		return errors.Wrapf(ErrPolicyViolation, "salt length %d is below %d", info.SaltLength, p.MinSaltLength)
+	}
+	return nil
+}
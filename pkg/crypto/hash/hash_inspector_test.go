@@ -0,0 +1,82 @@
+package hash_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/achuala/go-svc-extn/pkg/crypto/hash"
+)
+
+func TestInspectHash(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		hash     string
+		expected hash.HashInfo
+	}{
+		{
+			hash:     "$2a$12$o6hx.Wog/wvFSkT/Bp/6DOxCtLRTDj7lm9on9suF/WaCGNVHbkfL6",
+			expected: hash.HashInfo{Algorithm: hash.AlgorithmBcrypt, Cost: 12, SaltLength: 16, KeyLength: 23, Strength: hash.StrengthStrong},
+		},
+		{
+			hash:     "$argon2id$v=19$m=32,t=2,p=4$cm94YnRVOW5jZzFzcVE4bQ$MNzk5BtR2vUhrp6qQEjRNw",
+			expected: hash.HashInfo{Algorithm: hash.AlgorithmArgon2id, Iterations: 2, Memory: 32, Parallelism: 4, SaltLength: 16, KeyLength: 16, Strength: hash.StrengthWeak},
+		},
+		{
+			hash:     "$pbkdf2-sha256$i=100000,l=32$1jP+5Zxpxgtee/iPxGgOz0RfE9/KJuDElP1ley4VxXc$QJxzfvdbHYBpydCbHoFg3GJEqMFULwskiuqiJctoYpI",
+			expected: hash.HashInfo{Algorithm: hash.AlgorithmPbkdf2, Digest: "sha256", Iterations: 100000, SaltLength: 32, KeyLength: 32, Strength: hash.StrengthModerate},
+		},
+		{
+			hash:     "$scrypt$ln=16384,r=8,p=1$2npRo7P03Mt8keSoMbyD/tKFWyUzjiQf2svUaNDSrhA=$MiCzNcIplSMqSBrm4HckjYqYhaVPPjTARTzwB1cVNYE=",
+			expected: hash.HashInfo{Algorithm: hash.AlgorithmScrypt, Cost: 16384, BlockSize: 8, Parallelism: 1, SaltLength: 32, KeyLength: 32, Strength: hash.StrengthModerate},
+		},
+		{
+			hash:     "$sha256-crypt$rounds=535000$05R.9KB6UC2kLI3w$Q/zslzx./JjkAVPTwp6th7nW5l7JU91Gte/UmIh.U78",
+			expected: hash.HashInfo{Algorithm: hash.AlgorithmSHA256Crypt, Iterations: 535000, SaltLength: 12, KeyLength: 32, Strength: hash.StrengthWeak},
+		},
+		{
+			hash:     "$md5$CY9rzUYh03PK3k6DJie09g==",
+			expected: hash.HashInfo{Algorithm: hash.AlgorithmMD5, Digest: "md5", Iterations: 1, KeyLength: 16, Strength: hash.StrengthWeak},
+		},
+	} {
+		tc := tc
+		t.Run(tc.expected.Algorithm, func(t *testing.T) {
+			t.Parallel()
+			info, err := hash.InspectHash([]byte(tc.hash))
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, *info)
+		})
+	}
+
+	_, err := hash.InspectHash([]byte("$unknown$12$o6hx.Wog/wvFSkT/Bp/6DOxCtLRTDj7lm9on9suF/WaCGNVHbkfL6"))
+	assert.ErrorIs(t, err, hash.ErrUnknownHashAlgorithm)
+	_, err = hash.InspectHash([]byte("$pbkdf2-sha256$1jP+5Zxpxgtee/iPxGgOz0RfE9/KJuDElP1ley4VxXc$QJxzfvdbHYBpydCbHoFg3GJEqMFULwskiuqiJctoYpI"))
+	assert.Error(t, err)
+}
+
+func TestPolicyValidate(t *testing.T) {
+	t.Parallel()
+	policy := hash.Policy{
+		AllowedAlgorithms: []string{hash.AlgorithmArgon2id, hash.AlgorithmBcrypt},
+		MinStrength:       hash.StrengthModerate,
+		MinSaltLength:     16,
+	}
+
+	info, err := hash.InspectHash([]byte("$2a$12$o6hx.Wog/wvFSkT/Bp/6DOxCtLRTDj7lm9on9suF/WaCGNVHbkfL6"))
+	require.NoError(t, err)
+	assert.NoError(t, policy.Validate(info))
+
+	info, err = hash.InspectHash([]byte("$argon2id$v=19$m=32,t=2,p=4$cm94YnRVOW5jZzFzcVE4bQ$MNzk5BtR2vUhrp6qQEjRNw"))
+	require.NoError(t, err)
+	assert.ErrorIs(t, policy.Validate(info), hash.ErrPolicyViolation)
+
+	info, err = hash.InspectHash([]byte("$pbkdf2-sha256$i=100000,l=32$1jP+5Zxpxgtee/iPxGgOz0RfE9/KJuDElP1ley4VxXc$QJxzfvdbHYBpydCbHoFg3GJEqMFULwskiuqiJctoYpI"))
+	require.NoError(t, err)
+	assert.ErrorIs(t, policy.Validate(info), hash.ErrPolicyViolation)
+	// the 16 characters of a crypt salt decode to 12 bytes
+	info, err = hash.InspectHash([]byte("$sha256-crypt$rounds=535000$05R.9KB6UC2kLI3w$Q/zslzx./JjkAVPTwp6th7nW5l7JU91Gte/UmIh.U78"))
+	require.NoError(t, err)
+	assert.ErrorContains(t, (&hash.Policy{MinSaltLength: 16}).Validate(info), "salt length 12 is below 16")
+	assert.NoError(t, (&hash.Policy{MinSaltLength: 12}).Validate(info))
+}
@@ -16,3 +16,15 @@ type Hasher interface {
 type HashProvider interface {
 	Hasher(ctx context.Context) Hasher
 }
+
+// KeyedHasher is a Hasher producing deterministic hashes with versioned keys,
+// such as the hashers used to create aliases.
+type KeyedHasher interface {
+	Hasher
+
+	// Compare returns whether the hash was generated from the data with any of the configured keys.
+	Compare(ctx context.Context, data []byte, hash []byte) (bool, error)
+
+	// Candidates returns the hashes of the data for all configured keys, starting with the active key.
+	Candidates(ctx context.Context, data []byte) ([][]byte, error)
+}
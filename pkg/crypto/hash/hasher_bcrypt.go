@@ -39,7 +39,7 @@ func validateBcryptPasswordLength(password []byte) error {
 	// so if password is longer than 72 bytes, function returns an error
 	// See https://en.wikipedia.org/wiki/Bcrypt#User_input
 	if len(password) > 72 {
-		return errors.New("password cannot exceed 72 bytes")
+		return errors.WithStack(ErrPasswordTooLong)
 	}
 	return nil
 }
@@ -0,0 +1,77 @@
+package hash
+
+import (
+	"context"
+	stdhash "hash"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/blake2b"
+)
+
+var _ KeyedHasher = (*Blake2b)(nil)
+
+// Blake2b generates deterministic keyed BLAKE2b hashes.
+type Blake2b struct {
+	c *Blake2bConfiguration
+}
+
+type Blake2bConfiguration struct {
+	// Key is the legacy key, hashes generated with it carry no key id.
+	Key string
+	// Keys holds the versioned keys by key id. Hashes generated with a
+	// versioned key are encoded as $blake2b$<key id>$<hash>.
+	Keys map[string]string
+	// ActiveKeyId selects the key from Keys used for new hashes, when empty
+	// the legacy Key is used.
+	ActiveKeyId string
+	// Size is the output size in bytes, either 32 (default) or 64.
+	Size int
+}
+
+func NewHasherBlake2b(c *Blake2bConfiguration) *Blake2b {
+	return &Blake2b{c: c}
+}
+
+func (h *Blake2b) spec() *keyedHashSpec {
+	return &keyedHashSpec{prefix: "blake2b", key: h.c.Key, keys: h.c.Keys, activeKeyId: h.c.ActiveKeyId, newHash: newBlake2b}
+}
+
+func newBlake2b(key []byte, size int) (stdhash.Hash, error) {
+	if len(key) > blake2b.Size {
+		return nil, errors.Errorf("blake2b key cannot exceed %d bytes", blake2b.Size)
+	}
+	switch size {
+	case 0, blake2b.Size256:
+		return blake2b.New256(key)
+	case blake2b.Size:
+		return blake2b.New512(key)
+	default:
+		return nil, errors.Errorf("unsupported blake2b size %d", size)
+	}
+}
+
+func (h *Blake2b) Generate(ctx context.Context, data []byte) ([]byte, error) {
+	return h.GenerateWithKey(ctx, h.c.ActiveKeyId, data)
+}
+
+// GenerateWithKey hashes the data with the key identified by keyId, an empty
+// key id selects the legacy key.
+func (h *Blake2b) GenerateWithKey(ctx context.Context, keyId string, data []byte) ([]byte, error) {
+	return h.spec().generate(keyId, data, h.c.Size)
+}
+
+// Candidates returns the hashes of the data for every configured key, starting
+// with the active key.
+func (h *Blake2b) Candidates(ctx context.Context, data []byte) ([][]byte, error) {
+	return h.spec().candidates(data, h.c.Size)
+}
+
+// Compare returns whether the hash was generated from the data, using the key
+// and size the hash was generated with.
+func (h *Blake2b) Compare(ctx context.Context, data []byte, hash []byte) (bool, error) {
+	return h.spec().compare(data, hash)
+}
+
+func (h *Blake2b) Understands(hash []byte) bool {
+	return IsBlake2bHash(hash)
+}
@@ -0,0 +1,69 @@
+package hash
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	stdhash "hash"
+
+	"github.com/pkg/errors"
+)
+
+var _ KeyedHasher = (*HmacSha256)(nil)
+
+// HmacSha256 generates deterministic HMAC-SHA256 hashes, a FIPS approved
+// alternative to SipHash for aliases.
+type HmacSha256 struct {
+	c *HmacSha256Configuration
+}
+
+type HmacSha256Configuration struct {
+	// Key is the legacy key, hashes generated with it carry no key id.
+	Key string
+	// Keys holds the versioned keys by key id. Hashes generated with a
+	// versioned key are encoded as $hmac-sha256$<key id>$<hash>.
+	Keys map[string]string
+	// ActiveKeyId selects the key from Keys used for new hashes, when empty
+	// the legacy Key is used.
+	ActiveKeyId string
+}
+
+func NewHasherHmacSha256(c *HmacSha256Configuration) *HmacSha256 {
+	return &HmacSha256{c: c}
+}
+
+func (h *HmacSha256) spec() *keyedHashSpec {
+	return &keyedHashSpec{prefix: "hmac-sha256", key: h.c.Key, keys: h.c.Keys, activeKeyId: h.c.ActiveKeyId, newHash: newHmacSha256}
+}
+
+func newHmacSha256(key []byte, size int) (stdhash.Hash, error) {
+	if size != 0 && size != sha256.Size {
+		return nil, errors.Errorf("unsupported hmac-sha256 size %d", size)
+	}
+	return hmac.New(sha256.New, key), nil
+}
+
+func (h *HmacSha256) Generate(ctx context.Context, data []byte) ([]byte, error) {
+	return h.GenerateWithKey(ctx, h.c.ActiveKeyId, data)
+}
+
+// GenerateWithKey hashes the data with the key identified by keyId, an empty
+// key id selects the legacy key.
+func (h *HmacSha256) GenerateWithKey(ctx context.Context, keyId string, data []byte) ([]byte, error) {
+	return h.spec().generate(keyId, data, 0)
+}
+
+// Candidates returns the hashes of the data for every configured key, starting
+// with the active key.
+func (h *HmacSha256) Candidates(ctx context.Context, data []byte) ([][]byte, error) {
+	return h.spec().candidates(data, 0)
+}
+
+// Compare returns whether the hash was generated from the data.
+func (h *HmacSha256) Compare(ctx context.Context, data []byte, hash []byte) (bool, error) {
+	return h.spec().compare(data, hash)
+}
+
+func (h *HmacSha256) Understands(hash []byte) bool {
+	return IsHmacSha256Hash(hash)
+}
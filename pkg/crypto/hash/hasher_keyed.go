@@ -0,0 +1,109 @@
+package hash
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	stdhash "hash"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var ErrUnknownKeyId = errors.New("unknown key id")
+
+// keyedHashSpec describes a deterministic keyed hash and its versioned keys.
+// Hashes generated with the legacy key are plain base64, hashes generated with
+// a versioned key are encoded as $<prefix>$<key id>$<hash>.
+type keyedHashSpec struct {
+	prefix      string
+	key         string
+	keys        map[string]string
+	activeKeyId string
+	newHash     func(key []byte, size int) (stdhash.Hash, error)
+}
+
+func (s *keyedHashSpec) generate(keyId string, data []byte, size int) ([]byte, error) {
+	key, err := s.lookupKey(keyId)
+	if err != nil {
+		return nil, err
+	}
+
+	hasher, err := s.newHash(key, size)
+	if err != nil {
+		return nil, err
+	}
+	hasher.Write(data)
+	encoded := base64.StdEncoding.EncodeToString(hasher.Sum(nil))
+
+	if keyId == "" {
+		return []byte(encoded), nil
+	}
+	return []byte(fmt.Sprintf("$%s$%s$%s", s.prefix, keyId, encoded)), nil
+}
+
+func (s *keyedHashSpec) candidates(data []byte, size int) ([][]byte, error) {
+	keyIds := make([]string, 0, len(s.keys))
+	for keyId := range s.keys {
+		if keyId != s.activeKeyId {
+			keyIds = append(keyIds, keyId)
+		}
+	}
+	sort.Strings(keyIds)
+	keyIds = append([]string{s.activeKeyId}, keyIds...)
+	if s.activeKeyId != "" && s.key != "" {
+		keyIds = append(keyIds, "")
+	}
+
+	result := make([][]byte, 0, len(keyIds))
+	for _, keyId := range keyIds {
+		hash, err := s.generate(keyId, data, size)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, hash)
+	}
+	return result, nil
+}
+
+// compare regenerates the hash with the key id and size found in the stored hash.
+func (s *keyedHashSpec) compare(data []byte, hash []byte) (bool, error) {
+	keyId, encoded := "", string(hash)
+	if s.understands(hash) {
+		parts := strings.Split(string(hash), "$")
+		if len(parts) != 4 {
+			return false, errors.WithStack(ErrInvalidHash)
+		}
+		keyId, encoded = parts[2], parts[3]
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return false, errors.WithStack(ErrInvalidHash)
+	}
+
+	otherHash, err := s.generate(keyId, data, len(raw))
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare(hash, otherHash) == 1, nil
+}
+
+func (s *keyedHashSpec) understands(hash []byte) bool {
+	return strings.HasPrefix(string(hash), "$"+s.prefix+"$")
+}
+
+func (s *keyedHashSpec) lookupKey(keyId string) ([]byte, error) {
+	if keyId == "" {
+		if s.key == "" {
+			return nil, errors.Errorf("%s key is not configured", s.prefix)
+		}
+		return []byte(s.key), nil
+	}
+	key, ok := s.keys[keyId]
+	if !ok {
+		return nil, errors.Wrap(ErrUnknownKeyId, keyId)
+	}
+	return []byte(key), nil
+}
@@ -2,31 +2,74 @@ package hash
 
 import (
 	"context"
-	"encoding/base64"
+	stdhash "hash"
 
 	"github.com/dchest/siphash"
+	"github.com/pkg/errors"
 )
 
+var _ KeyedHasher = (*SipHash24)(nil)
+
 type SipHash24 struct {
 	c *SipHashConfiguration
 }
 
 type SipHashConfiguration struct {
+	// Key is the legacy key, hashes generated with it carry no key id.
 	Key string
+	// Keys holds the versioned keys by key id. Hashes generated with a
+	// versioned key are encoded as $sip24$<key id>$<hash>.
+	Keys map[string]string
+	// ActiveKeyId selects the key from Keys used for new hashes, when empty
+	// the legacy Key is used.
+	ActiveKeyId string
+	// Size is the output size in bytes, either 8 (default) or 16.
+	Size int
 }
 
 func NewHasherSipHash24(c *SipHashConfiguration) *SipHash24 {
 	return &SipHash24{c: c}
 }
 
+func (h *SipHash24) spec() *keyedHashSpec {
+	return &keyedHashSpec{prefix: "sip24", key: h.c.Key, keys: h.c.Keys, activeKeyId: h.c.ActiveKeyId, newHash: newSipHash}
+}
+
+func newSipHash(key []byte, size int) (stdhash.Hash, error) {
+	if len(key) < 16 {
+		return nil, errors.New("siphash key must be at least 16 bytes")
+	}
+	switch size {
+	case 0, 8:
+		return siphash.New(key), nil
+	case 16:
+		return siphash.New128(key), nil
+	default:
+		return nil, errors.Errorf("unsupported siphash size %d", size)
+	}
+}
+
 func (h *SipHash24) Generate(ctx context.Context, data []byte) ([]byte, error) {
+	return h.GenerateWithKey(ctx, h.c.ActiveKeyId, data)
+}
 
-	hasher := siphash.New([]byte(h.c.Key))
-	hasher.Write(data)
-	hash := hasher.Sum(nil)
+// GenerateWithKey hashes the data with the key identified by keyId, an empty
+// key id selects the legacy key.
+func (h *SipHash24) GenerateWithKey(ctx context.Context, keyId string, data []byte) ([]byte, error) {
+	return h.spec().generate(keyId, data, h.c.Size)
+}
 
-	return []byte(base64.StdEncoding.EncodeToString(hash)), nil
+// Candidates returns the hashes of the data for every configured key, starting
+// with the active key, so that lookups keep matching rows written before a
+// key rotation.
+func (h *SipHash24) Candidates(ctx context.Context, data []byte) ([][]byte, error) {
+	return h.spec().candidates(data, h.c.Size)
+}
 
+// Compare returns whether the hash was generated from the data, using the key
+// and size the hash was generated with.
+func (h *SipHash24) Compare(ctx context.Context, data []byte, hash []byte) (bool, error) {
+	return h.spec().compare(data, hash)
 }
 
 func (h *SipHash24) Understands(hash []byte) bool {
@@ -1,6 +1,7 @@
 package hash_test
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
 	"encoding/base64"
@@ -422,3 +423,141 @@ func TestCompare(t *testing.T) {
 	})
 
 }
+
+func TestSipHash24KeyRotation(t *testing.T) {
+	t.Parallel()
+	data := []byte("James Bond")
+	legacy := hash.NewHasherSipHash24(&hash.SipHashConfiguration{Key: "QWVzR2NtS2V5EhIaECT2tU"})
+	legacyHash, err := legacy.Generate(context.Background(), data)
+	require.NoError(t, err)
+	assert.False(t, legacy.Understands(legacyHash))
+
+	conf := hash.SipHashConfiguration{
+		Key:         "QWVzR2NtS2V5EhIaECT2tU",
+		Keys:        map[string]string{"k1": "hyiuLKsiUlTbWSZqBy5xO0", "k2": "HOt9BnlWviqnxYFt3jJbJK"},
+		ActiveKeyId: "k1",
+	}
+	h := hash.NewHasherSipHash24(&conf)
+	k1Hash, err := h.Generate(context.Background(), data)
+	require.NoError(t, err)
+	assert.True(t, h.Understands(k1Hash))
+
+	conf.ActiveKeyId = "k2"
+	k2Hash, err := h.Generate(context.Background(), data)
+	require.NoError(t, err)
+	assert.NotEqual(t, k1Hash, k2Hash)
+
+	wide := hash.NewHasherSipHash24(&hash.SipHashConfiguration{Keys: conf.Keys, ActiveKeyId: "k2", Size: 16})
+	wideHash, err := wide.Generate(context.Background(), data)
+	require.NoError(t, err)
+	assert.Greater(t, len(wideHash), len(k2Hash))
+
+	for _, hs := range [][]byte{legacyHash, k1Hash, k2Hash, wideHash} {
+		ok, err := h.Compare(context.Background(), data, hs)
+		require.NoError(t, err)
+		assert.True(t, ok, string(hs))
+	}
+	ok, err := h.Compare(context.Background(), []byte("Bond James"), k1Hash)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	candidates, err := h.Candidates(context.Background(), data)
+	require.NoError(t, err)
+	require.Len(t, candidates, 3)
+	assert.Equal(t, k2Hash, candidates[0])
+	assert.Contains(t, candidates, legacyHash)
+}
+
+func TestKeyedHashers(t *testing.T) {
+	t.Parallel()
+	data := []byte("James Bond")
+	keys := map[string]string{"k1": "hyiuLKsiUlTbWSZqBy5xO0", "k2": "HOt9BnlWviqnxYFt3jJbJK"}
+	for name, h := range map[string]hash.KeyedHasher{
+		"hmac-sha256": hash.NewHasherHmacSha256(&hash.HmacSha256Configuration{Keys: keys, ActiveKeyId: "k2"}),
+		"blake2b":     hash.NewHasherBlake2b(&hash.Blake2bConfiguration{Keys: keys, ActiveKeyId: "k2"}),
+		"blake2b-512": hash.NewHasherBlake2b(&hash.Blake2bConfiguration{Keys: keys, ActiveKeyId: "k2", Size: 64}),
+	} {
+		name, h := name, h
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			hs, err := h.Generate(context.Background(), data)
+			require.NoError(t, err)
+			assert.True(t, h.Understands(hs))
+			assert.True(t, hash.IsValidHashFormat(hs))
+
+			again, err := h.Generate(context.Background(), data)
+			require.NoError(t, err)
+			assert.Equal(t, hs, again)
+
+			ok, err := h.Compare(context.Background(), data, hs)
+			require.NoError(t, err)
+			assert.True(t, ok)
+
+			candidates, err := h.Candidates(context.Background(), data)
+			require.NoError(t, err)
+			require.Len(t, candidates, 2)
+			assert.Equal(t, hs, candidates[0])
+			ok, err = h.Compare(context.Background(), data, candidates[1])
+			require.NoError(t, err)
+			assert.True(t, ok)
+		})
+	}
+}
+
+func TestCompareErrors(t *testing.T) {
+	t.Parallel()
+	var hashErr *hash.HashError
+
+	err := hash.Compare(context.Background(), []byte("tset"), []byte("$2a$12$o6hx.Wog/wvFSkT/Bp/6DOxCtLRTDj7lm9on9suF/WaCGNVHbkfL6"))
+	require.ErrorAs(t, err, &hashErr)
+	assert.Equal(t, hash.AlgorithmBcrypt, hashErr.Algorithm)
+	assert.Equal(t, hash.ReasonMismatch, hashErr.Reason)
+	assert.ErrorIs(t, err, hash.ErrMismatchedHashAndPassword)
+	assert.True(t, hash.IsMismatch(err))
+
+	err = hash.Compare(context.Background(), []byte("test"), []byte("$pbkdf2-sha256$aaaa$1jP+5Zxpxgtee/iPxGgOz0RfE9/KJuDElP1ley4VxXc$QJxzfvdbHYBpydCbHoFg3GJEqMFULwskiuqiJctoYpI"))
+	require.ErrorAs(t, err, &hashErr)
+	assert.Equal(t, hash.AlgorithmPbkdf2, hashErr.Algorithm)
+	assert.ErrorIs(t, err, hash.ErrInvalidHash)
+	assert.NotErrorIs(t, err, hash.ErrMismatchedHashAndPassword)
+	assert.True(t, hash.IsMalformed(err))
+
+	err = hash.Compare(context.Background(), []byte("test"), []byte("$argon2id$v=18$m=32,t=2,p=4$cm94YnRVOW5jZzFzcVE4bQ$MNzk5BtR2vUhrp6qQEjRNw"))
+	assert.True(t, hash.IsUnsupported(err))
+	assert.ErrorIs(t, err, hash.ErrIncompatibleVersion)
+
+	err = hash.Compare(context.Background(), []byte("test"), []byte("$unknown$12$o6hx.Wog/wvFSkT/Bp/6DOxCtLRTDj7lm9on9suF/WaCGNVHbkfL6"))
+	assert.ErrorIs(t, err, hash.ErrUnknownHashAlgorithm)
+	assert.True(t, hash.IsUnsupported(err))
+
+	err = hash.Compare(context.Background(), mkpw(t, 73), []byte("$2a$12$o6hx.Wog/wvFSkT/Bp/6DOxCtLRTDj7lm9on9suF/WaCGNVHbkfL6"))
+	assert.ErrorIs(t, err, hash.ErrPasswordTooLong)
+	assert.True(t, hash.IsMismatch(err))
+}
+
+func TestMultiSum(t *testing.T) {
+	t.Parallel()
+	data := mkpw(t, 1<<20)
+	var tee bytes.Buffer
+	var progress int64
+	sums, n, err := hash.MultiSum(bytes.NewReader(data), &hash.SumOptions{
+		Tee:      &tee,
+		Progress: func(total int64) { progress = total },
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), n)
+	assert.Equal(t, n, progress)
+	assert.Equal(t, data, tee.Bytes())
+	require.Len(t, sums, 3)
+
+	for algo, sum := range sums {
+		single, err := hash.SumReader(algo, bytes.NewReader(data))
+		require.NoError(t, err)
+		assert.Equal(t, single, sum, algo)
+		assert.NoError(t, hash.VerifyReader(algo, bytes.NewReader(data), sum))
+	}
+	assert.ErrorIs(t, hash.VerifyReader(hash.DigestSHA256, bytes.NewReader(data[1:]), sums[hash.DigestSHA256]), hash.ErrDigestMismatch)
+
+	_, err = hash.SumReader("md4", bytes.NewReader(data))
+	assert.ErrorIs(t, err, hash.ErrUnknownDigest)
+}
@@ -0,0 +1,308 @@
+package hash
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Score is the estimated guessability of a password on the zxcvbn scale.
+type Score int
+
+const (
+	// ScoreTooGuessable is a banned or trivially guessable password, fewer than 10^3 guesses.
+	ScoreTooGuessable Score = iota
+	// ScoreVeryGuessable protects from throttled online attacks, fewer than 10^6 guesses.
+	ScoreVeryGuessable
+	// ScoreSomewhatGuessable protects from unthrottled online attacks, fewer than 10^8 guesses.
+	ScoreSomewhatGuessable
+	// ScoreSafelyUnguessable offers moderate protection from offline attacks, fewer than 10^10 guesses.
+	ScoreSafelyUnguessable
+	// ScoreVeryUnguessable offers strong protection from offline attacks.
+	ScoreVeryUnguessable
+)
+
+func (s Score) String() string {
+	switch s {
+	case ScoreTooGuessable:
+		return "too guessable"
+	case ScoreVeryGuessable:
+		return "very guessable"
+	case ScoreSomewhatGuessable:
+		return "somewhat guessable"
+	case ScoreSafelyUnguessable:
+		return "safely unguessable"
+	default:
+		return "very unguessable"
+	}
+}
+
+// defaultBannedPasswords are the most common passwords from public breach corpora.
+var defaultBannedPasswords = []string{
+	"123456", "123456789", "12345678", "1234567", "1234567890", "111111", "000000",
+	"123123", "654321", "666666", "121212", "112233", "password", "password1",
+	"passw0rd", "qwerty", "qwertyuiop", "qwerty123", "1q2w3e4r", "1qaz2wsx", "abc123",
+	"iloveyou", "admin", "administrator", "welcome", "letmein", "monkey", "dragon",
+	"football", "baseball", "sunshine", "master", "shadow", "princess", "trustno1",
+	"superman", "michael", "jennifer", "hunter", "freedom", "whatever", "starwars",
+	"secret", "login", "charlie", "donald", "batman", "access", "flower", "hello",
+	"changeme", "default", "guest", "root", "test", "pass",
+}
+
+// leetSubstitutions maps common character substitutions back to letters.
+var leetSubstitutions = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '8': 'b', '9': 'g',
+	'@': 'a', '$': 's', '!': 'i', '|': 'l', '+': 't',
+}
+
+var keyboardRows = []string{
+	"`1234567890-=", "qwertyuiop[]\\", "asdfghjkl;'", "zxcvbnm,./",
+}
+
+// StrengthEstimatorConfiguration configures a StrengthEstimator.
+type StrengthEstimatorConfiguration struct {
+	// BannedPasswords are rejected outright and penalised when they appear
+	// inside a longer password. Matching is case insensitive.
+	BannedPasswords []string
+	// ExcludeDefaultBannedPasswords disables the built-in list of common passwords.
+	ExcludeDefaultBannedPasswords bool
+	// MinLength scores shorter passwords as ScoreTooGuessable.
+	MinLength int
+}
+
+// StrengthEstimator estimates password strength from its entropy, discounting
+// dictionary words, repeats, sequences and keyboard walks the way zxcvbn does.
+type StrengthEstimator struct {
+	banned map[string]struct{}
+	// unleeted holds the banned passwords with leet substitutions reverted
+	unleeted     map[string]struct{}
+	maxBannedLen int
+	minLength    int
+}
+
+var defaultStrengthEstimator = NewStrengthEstimator(&StrengthEstimatorConfiguration{})
+
+// EstimateStrength scores the password with the built-in banned password list.
+func EstimateStrength(password []byte) Score {
+	return defaultStrengthEstimator.Estimate(password)
+}
+
+func NewStrengthEstimator(c *StrengthEstimatorConfiguration) *StrengthEstimator {
+	e := &StrengthEstimator{banned: make(map[string]struct{}), unleeted: make(map[string]struct{}), minLength: c.MinLength}
+	words := c.BannedPasswords
+	if !c.ExcludeDefaultBannedPasswords {
+		// a new slice, appending could write into the caller's one
+		words = slices.Concat(c.BannedPasswords, defaultBannedPasswords)
+	}
+	for _, w := range words {
+		w = strings.ToLower(strings.TrimSpace(w))
+		if w == "" {
+			continue
+		}
+		e.banned[w] = struct{}{}
+		e.unleeted[string(unleet([]rune(w)))] = struct{}{}
+		if n := len([]rune(w)); n > e.maxBannedLen {
+			e.maxBannedLen = n
+		}
+	}
+	return e
+}
+
+// Estimate returns the score of the password.
+func (e *StrengthEstimator) Estimate(password []byte) Score {
+	if len([]rune(string(password))) < e.minLength || e.isBanned(password) {
+		return ScoreTooGuessable
+	}
+
+	log10Guesses := e.Entropy(password) * math.Log10(2)
+	switch {
+	case log10Guesses < 3:
+		return ScoreTooGuessable
+	case log10Guesses < 6:
+		return ScoreVeryGuessable
+	case log10Guesses < 8:
+		return ScoreSomewhatGuessable
+	case log10Guesses < 10:
+		return ScoreSafelyUnguessable
+	default:
+		return ScoreVeryUnguessable
+	}
+}
+
+// Entropy returns the estimated entropy of the password in bits.
+func (e *StrengthEstimator) Entropy(password []byte) float64 {
+	runes := []rune(string(password))
+	normalized := unleet(runes)
+	charBits := math.Log2(float64(charsetSize(runes)))
+
+	var bits float64
+	for i := 0; i < len(runes); {
+		n, patternBits := e.longestPattern(runes, normalized, i)
+		if n == 0 {
+			bits += charBits
+			i++
+			continue
+		}
+		bits += patternBits
+		i += n
+	}
+	return bits
+}
+
+func (e *StrengthEstimator) isBanned(password []byte) bool {
+	lower := []rune(strings.ToLower(string(password)))
+	if _, ok := e.banned[string(lower)]; ok {
+		return true
+	}
+	_, ok := e.unleeted[string(unleet(lower))]
+	return ok
+}
+
+// longestPattern returns the length and entropy of the longest guessable
+// pattern starting at i, or zero when no pattern applies.
+func (e *StrengthEstimator) longestPattern(runes, normalized []rune, i int) (int, float64) {
+	var (
+		length int
+		bits   float64
+	)
+	consider := func(n int, b float64) {
+		if n > length {
+			length, bits = n, b
+		}
+	}
+
+	// dictionary words, including leet speak variants
+	for n := min(e.maxBannedLen, len(runes)-i); n >= 4 && n > length; n-- {
+		word := strings.ToLower(string(runes[i : i+n]))
+		_, plain := e.banned[word]
+		_, leet := e.unleeted[string(normalized[i:i+n])]
+		if plain || leet {
+			b := math.Log2(float64(len(e.banned)))
+			if !plain {
+				b++
+			}
+			consider(n, b+caseBits(runes[i:i+n]))
+			break
+		}
+	}
+
+	// repeated characters
+	n := 1
+	for i+n < len(runes) && unicode.ToLower(runes[i+n]) == unicode.ToLower(runes[i]) {
+		n++
+	}
+	if n >= 3 {
+		consider(n, math.Log2(float64(charsetSize(runes[i:i+1])))+math.Log2(float64(n)))
+	}
+
+	// alphabetical and numerical sequences
+	if i+1 < len(runes) {
+		step := unicode.ToLower(runes[i+1]) - unicode.ToLower(runes[i])
+		if step == 1 || step == -1 {
+			n = 2
+			for i+n < len(runes) && unicode.ToLower(runes[i+n])-unicode.ToLower(runes[i+n-1]) == step {
+				n++
+			}
+			if n >= 3 {
+				consider(n, math.Log2(float64(charsetSize(runes[i:i+1])))+math.Log2(float64(n))+1)
+			}
+		}
+	}
+
+	// recent years
+	if i+4 <= len(runes) {
+		if year, err := strconv.Atoi(string(runes[i : i+4])); err == nil && year >= 1900 && year < 2100 {
+			consider(4, math.Log2(200))
+		}
+	}
+
+	// keyboard walks along a single row
+	for _, row := range keyboardRows {
+		start := strings.IndexRune(row, unicode.ToLower(runes[i]))
+		if start < 0 {
+			continue
+		}
+		for _, dir := range []int{1, -1} {
+			n = 1
+			for i+n < len(runes) {
+				pos := start + dir*n
+				if pos < 0 || pos >= len(row) || rune(row[pos]) != unicode.ToLower(runes[i+n]) {
+					break
+				}
+				n++
+			}
+			if n >= 4 {
+				consider(n, math.Log2(float64(len(row)*2))+math.Log2(float64(n)))
+			}
+		}
+	}
+
+	return length, bits
+}
+
+// caseBits is the extra entropy of capitalisation beyond an initial capital.
+func caseBits(runes []rune) float64 {
+	upper := 0
+	for _, r := range runes {
+		if unicode.IsUpper(r) {
+			upper++
+		}
+	}
+	switch {
+	case upper == 0:
+		return 0
+	case upper == 1 && unicode.IsUpper(runes[0]):
+		return 1
+	default:
+		return float64(upper)
+	}
+}
+
+func charsetSize(runes []rune) int {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range runes {
+		switch {
+		case r > unicode.MaxASCII:
+			other = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	size := 0
+	if lower {
+		size += 26
+	}
+	if upper {
+		size += 26
+	}
+	if digit {
+		size += 10
+	}
+	if symbol {
+		size += 33
+	}
+	if other {
+		size += 100
+	}
+	return max(size, 1)
+}
+
+func unleet(runes []rune) []rune {
+	result := make([]rune, len(runes))
+	for i, r := range runes {
+		r = unicode.ToLower(r)
+		if sub, ok := leetSubstitutions[r]; ok {
+			r = sub
+		}
+		result[i] = r
+	}
+	return result
+}
@@ -0,0 +1,46 @@
+package hash_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/achuala/go-svc-extn/pkg/crypto/hash"
+)
+
+func TestEstimateStrength(t *testing.T) {
+	t.Parallel()
+	for password, expected := range map[string]hash.Score{
+		"password":                     hash.ScoreTooGuessable,
+		"P@ssw0rd":                     hash.ScoreTooGuessable,
+		"aaaaaaaa":                     hash.ScoreTooGuessable,
+		"abcdefgh":                     hash.ScoreTooGuessable,
+		"zxcvbnm":                      hash.ScoreTooGuessable,
+		"monkey2024!":                  hash.ScoreVeryGuessable,
+		"kX9#mQ2$vL":                   hash.ScoreVeryUnguessable,
+		"correct horse battery staple": hash.ScoreVeryUnguessable,
+	} {
+		assert.Equal(t, expected, hash.EstimateStrength([]byte(password)), password)
+	}
+}
+
+func TestStrengthEstimatorBannedPasswords(t *testing.T) {
+	t.Parallel()
+	e := hash.NewStrengthEstimator(&hash.StrengthEstimatorConfiguration{
+		BannedPasswords: []string{"AcmeCorp2024"},
+		MinLength:       8,
+	})
+	assert.Equal(t, hash.ScoreTooGuessable, e.Estimate([]byte("acmecorp2024")))
+	assert.Equal(t, hash.ScoreTooGuessable, e.Estimate([]byte("@cm3c0rp2024")))
+	assert.Equal(t, hash.ScoreTooGuessable, e.Estimate([]byte("kX9#mQ2")))
+	assert.Less(t, e.Entropy([]byte("AcmeCorp2024!x")), hash.NewStrengthEstimator(&hash.StrengthEstimatorConfiguration{}).Entropy([]byte("AcmeCorp2024!x")))
+	assert.Equal(t, hash.ScoreVeryUnguessable, e.Estimate([]byte("kX9#mQ2$vL")))
+}
+
+func TestStrengthEstimatorKeepsBannedPasswords(t *testing.T) {
+	t.Parallel()
+	banned := make([]string, 1, 8)
+	banned[0] = "AcmeCorp2024"
+	hash.NewStrengthEstimator(&hash.StrengthEstimatorConfiguration{BannedPasswords: banned})
+	assert.Equal(t, []string{"AcmeCorp2024", "", ""}, banned[:3], "the defaults were appended into the caller's slice")
+}
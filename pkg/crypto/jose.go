@@ -0,0 +1,368 @@
+package crypto
+
+import (
+	"context"
+	stdcrypto "crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/achuala/go-svc-extn/pkg/crypto/encdec"
+)
+
+// ErrTokenDecryption is returned when a JWE cannot be decrypted, without
+// telling whether the key agreement or the authentication failed.
+var ErrTokenDecryption = errors.New("TOKEN_DECRYPTION_FAILED")
+
+// The JWE helpers use direct key agreement (ECDH-ES) with A256GCM content
+// encryption, which every JOSE library supports and needs no key wrapping.
+const (
+	jweAlgorithm  = "ECDH-ES"
+	jweEncryption = "A256GCM"
+)
+
+type jwsHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+}
+
+type jweHeader struct {
+	Alg  string      `json:"alg"`
+	Enc  string      `json:"enc"`
+	Kid  string      `json:"kid,omitempty"`
+	Epk  *jsonWebKey `json:"epk"`
+	Apu  string      `json:"apu,omitempty"`
+	Apv  string      `json:"apv,omitempty"`
+	Zip  string      `json:"zip,omitempty"`
+	Crit []string    `json:"crit,omitempty"`
+}
+
+// SignJWS signs the payload with the primary key of the signature keyset and
+// returns a compact JWS (RFC 7515). Ed25519 keys sign with EdDSA and ECDSA
+// keys with ES256, ES384 or ES512, see JWKS for the verification keys.
+func (u *CryptoUtil) SignJWS(ctx context.Context, payload []byte) (string, error) {
+	if u.signatureProvider == nil {
+		return "", ErrSignatureKeysetNotConfigured
+	}
+	keys, err := u.signatureProvider.JOSEKeys()
+	if err != nil {
+		return "", err
+	}
+	i := slices.IndexFunc(keys, func(k encdec.JOSEKey) bool { return k.Primary })
+	if i < 0 {
+		return "", encdec.ErrUnsupportedJOSEKey
+	}
+	header, err := json.Marshal(&jwsHeader{Alg: keys[i].Alg, Kid: keys[i].Kid})
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sig, err := u.signatureProvider.SignJOSE(ctx, []byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// VerifyJWS verifies a JWS of SignJWS with the public keys of the signature
+// keyset and returns its payload.
+func (u *CryptoUtil) VerifyJWS(ctx context.Context, token string) ([]byte, error) {
+	if u.signatureProvider == nil {
+		return nil, ErrSignatureKeysetNotConfigured
+	}
+	keys, err := u.signatureProvider.JOSEKeys()
+	if err != nil {
+		return nil, err
+	}
+	return VerifyJWS(ctx, joseKeySource(keys), token)
+}
+
+// VerifyJWS verifies a compact JWS signed by a partner with a key of the key
+// source, e.g. its JWKS, and returns the payload. Like JWTVerifier, only
+// asymmetric algorithms are accepted.
+func VerifyJWS(ctx context.Context, keys JWTKeySource, token string) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformedToken
+	}
+	var header struct {
+		jwsHeader
+		Crit []string `json:"crit"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if !slices.Contains(jwtAlgorithms, header.Alg) {
+		return nil, ErrUnsupportedTokenAlgorithm
+	}
+	// no extensions are understood, e.g. unencoded payloads (RFC 7797)
+	if len(header.Crit) > 0 {
+		return nil, ErrMalformedToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+	key, err := keys.PublicKey(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if !verifyJWTSignature(header.Alg, key, parts[0]+"."+parts[1], signature) {
+		return nil, ErrTokenSignature
+	}
+	return payload, nil
+}
+
+// EncryptJWE encrypts the payload to the public key of a partner given as a
+// JSON Web Key, an EC P-256, P-384 or P-521 key or an OKP X25519 key, and
+// returns a compact JWE (RFC 7516) with ECDH-ES and A256GCM.
+func EncryptJWE(ctx context.Context, jwk []byte, payload []byte) (string, error) {
+	var key jsonWebKey
+	if err := json.Unmarshal(jwk, &key); err != nil {
+		return "", ErrInvalidPublicKey
+	}
+	if key.Use != "" && key.Use != "enc" {
+		return "", ErrInvalidPublicKey
+	}
+	recipient, err := key.ecdhPublicKey()
+	if err != nil {
+		return "", err
+	}
+	ephemeral, err := recipient.Curve().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	z, err := ephemeral.ECDH(recipient)
+	if err != nil {
+		return "", err
+	}
+	epk, err := newJSONWebKey(ephemeral.PublicKey())
+	if err != nil {
+		return "", err
+	}
+	header, err := json.Marshal(&jweHeader{Alg: jweAlgorithm, Enc: jweEncryption, Kid: key.Kid, Epk: epk})
+	if err != nil {
+		return "", err
+	}
+	protected := base64.RawURLEncoding.EncodeToString(header)
+	gcm, err := jweCipher(z, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	iv := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nil, iv, payload, []byte(protected))
+	cipherText, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+	return strings.Join([]string{protected, "", base64.RawURLEncoding.EncodeToString(iv),
+		base64.RawURLEncoding.EncodeToString(cipherText), base64.RawURLEncoding.EncodeToString(tag)}, "."), nil
+}
+
+// DecryptJWE decrypts a compact JWE encrypted by a partner to a key of the
+// hybrid keyset with ECDH-ES and A256GCM, see EncryptJWE and JWKS.
+func (u *CryptoUtil) DecryptJWE(ctx context.Context, token string) ([]byte, error) {
+	if u.hybridProvider == nil {
+		return nil, ErrHybridKeysetNotConfigured
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 || parts[1] != "" {
+		return nil, ErrMalformedToken
+	}
+	var header jweHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if header.Alg != jweAlgorithm || header.Enc != jweEncryption || header.Zip != "" || len(header.Crit) > 0 {
+		return nil, ErrUnsupportedTokenAlgorithm
+	}
+	if header.Epk == nil {
+		return nil, ErrMalformedToken
+	}
+	ephemeral, err := header.Epk.ecdhPublicKey()
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+	var segments [3][]byte
+	for i, part := range parts[2:] {
+		if segments[i], err = base64.RawURLEncoding.DecodeString(part); err != nil {
+			return nil, ErrMalformedToken
+		}
+	}
+	apu, err := base64.RawURLEncoding.DecodeString(header.Apu)
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+	apv, err := base64.RawURLEncoding.DecodeString(header.Apv)
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+	z, err := u.hybridProvider.ECDH(header.Kid, ephemeral)
+	if err != nil {
+		return nil, ErrTokenDecryption
+	}
+	gcm, err := jweCipher(z, apu, apv)
+	if err != nil {
+		return nil, err
+	}
+	iv, cipherText, tag := segments[0], segments[1], segments[2]
+	if len(iv) != gcm.NonceSize() || len(tag) != gcm.Overhead() {
+		return nil, ErrMalformedToken
+	}
+	payload, err := gcm.Open(nil, iv, append(cipherText, tag...), []byte(parts[0]))
+	if err != nil {
+		return nil, ErrTokenDecryption
+	}
+	return payload, nil
+}
+
+// JWKS returns the JSON Web Key Set of the public keys of the signature and
+// hybrid keysets, for the partners verifying the JWS and encrypting the JWE.
+func (u *CryptoUtil) JWKS() ([]byte, error) {
+	set := struct {
+		Keys []*jsonWebKey `json:"keys"`
+	}{Keys: []*jsonWebKey{}}
+	add := func(keys []encdec.JOSEKey, err error) error {
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			jwk, err := newJSONWebKey(key.Key)
+			if err != nil {
+				return err
+			}
+			jwk.Kid, jwk.Alg, jwk.Use = key.Kid, key.Alg, "sig"
+			if key.Alg == "" {
+				jwk.Alg, jwk.Use = jweAlgorithm, "enc"
+			}
+			set.Keys = append(set.Keys, jwk)
+		}
+		return nil
+	}
+	if u.signatureProvider != nil {
+		if err := add(u.signatureProvider.JOSEKeys()); err != nil {
+			return nil, err
+		}
+	}
+	if u.hybridProvider != nil {
+		if err := add(u.hybridProvider.JOSEKeys()); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(&set)
+}
+
+// jweCipher derives the content encryption key from the shared secret with
+// the Concat KDF of RFC 7518 section 4.6.
+func jweCipher(z, apu, apv []byte) (cipher.AEAD, error) {
+	cek := concatKDF(z, jweEncryption, apu, apv, 32)
+	defer clear(cek)
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// concatKDF implements the single step KDF of NIST SP 800-56A with SHA-256,
+// for keys of at most 32 bytes.
+func concatKDF(z []byte, alg string, apu, apv []byte, keyLen int) []byte {
+	h := sha256.New()
+	h.Write([]byte{0, 0, 0, 1})
+	h.Write(z)
+	for _, field := range [][]byte{[]byte(alg), apu, apv} {
+		h.Write(binary.BigEndian.AppendUint32(nil, uint32(len(field))))
+		h.Write(field)
+	}
+	h.Write(binary.BigEndian.AppendUint32(nil, uint32(keyLen*8)))
+	return h.Sum(nil)[:keyLen]
+}
+
+// joseKeySource resolves the signing keys of a JWS of SignJWS.
+type joseKeySource []encdec.JOSEKey
+
+func (s joseKeySource) PublicKey(ctx context.Context, kid string) (stdcrypto.PublicKey, error) {
+	for _, key := range s {
+		if key.Alg != "" && (key.Kid == kid || kid == "" && key.Primary) {
+			return key.Key, nil
+		}
+	}
+	return nil, ErrUnknownSigningKey
+}
+
+func newJSONWebKey(key stdcrypto.PublicKey) (*jsonWebKey, error) {
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		return &jsonWebKey{Kty: "OKP", Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(k)}, nil
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		return &jsonWebKey{Kty: "EC", Crv: k.Curve.Params().Name,
+			X: base64.RawURLEncoding.EncodeToString(k.X.FillBytes(make([]byte, size))),
+			Y: base64.RawURLEncoding.EncodeToString(k.Y.FillBytes(make([]byte, size)))}, nil
+	case *ecdh.PublicKey:
+		if k.Curve() == ecdh.X25519() {
+			return &jsonWebKey{Kty: "OKP", Crv: "X25519", X: base64.RawURLEncoding.EncodeToString(k.Bytes())}, nil
+		}
+		var crv string
+		switch k.Curve() {
+		case ecdh.P256():
+			crv = "P-256"
+		case ecdh.P384():
+			crv = "P-384"
+		case ecdh.P521():
+			crv = "P-521"
+		default:
+			return nil, ErrInvalidPublicKey
+		}
+		// uncompressed point 0x04 || x || y
+		point := k.Bytes()[1:]
+		size := len(point) / 2
+		return &jsonWebKey{Kty: "EC", Crv: crv, X: base64.RawURLEncoding.EncodeToString(point[:size]),
+			Y: base64.RawURLEncoding.EncodeToString(point[size:])}, nil
+	}
+	return nil, ErrInvalidPublicKey
+}
+
+// ecdhPublicKey returns the key agreement key of an EC or X25519 JWK.
+func (k *jsonWebKey) ecdhPublicKey() (*ecdh.PublicKey, error) {
+	if k.Kty == "OKP" {
+		if k.Crv != "X25519" {
+			return nil, ErrInvalidPublicKey
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, ErrInvalidPublicKey
+		}
+		key, err := ecdh.X25519().NewPublicKey(x)
+		if err != nil {
+			return nil, ErrInvalidPublicKey
+		}
+		return key, nil
+	}
+	if k.Kty != "EC" {
+		return nil, ErrInvalidPublicKey
+	}
+	pub, err := k.publicKey()
+	if err != nil {
+		return nil, err
+	}
+	key, err := pub.(*ecdsa.PublicKey).ECDH()
+	if err != nil {
+		return nil, ErrInvalidPublicKey
+	}
+	return key, nil
+}
@@ -0,0 +1,93 @@
+package crypto
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/achuala/go-svc-extn/pkg/crypto/encdec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWS(t *testing.T) {
+	ctx := context.Background()
+	for _, algorithm := range []string{encdec.SignatureEd25519, encdec.SignatureECDSAP256} {
+		t.Run(algorithm, func(t *testing.T) {
+			signatureKeysetData, err := encdec.NewSignatureKeyset(algorithm, kmsUri, cfg.KekAd)
+			require.NoError(t, err)
+			scfg := *cfg
+			scfg.SignatureKeysetData = signatureKeysetData
+			cu, err := NewCryptoUtil(&scfg)
+			require.NoError(t, err)
+
+			token, err := cu.SignJWS(ctx, []byte(`{"amount":100}`))
+			require.NoError(t, err)
+			payload, err := cu.VerifyJWS(ctx, token)
+			require.NoError(t, err)
+			assert.Equal(t, []byte(`{"amount":100}`), payload)
+
+			parts := strings.Split(token, ".")
+			tampered := parts[0] + "." + b64([]byte(`{"amount":999}`)) + "." + parts[2]
+			_, err = cu.VerifyJWS(ctx, tampered)
+			assert.ErrorIs(t, err, ErrTokenSignature)
+
+			// partners verify with the published key set
+			jwks, err := cu.JWKS()
+			require.NoError(t, err)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = w.Write(jwks)
+			}))
+			defer srv.Close()
+			payload, err = VerifyJWS(ctx, NewJWKS(&JWKSConfig{URL: srv.URL}), token)
+			require.NoError(t, err)
+			assert.Equal(t, []byte(`{"amount":100}`), payload)
+		})
+	}
+}
+
+func TestJWE(t *testing.T) {
+	ctx := context.Background()
+	for _, algorithm := range []string{encdec.HybridHPKEX25519, encdec.HybridECIESP256} {
+		t.Run(algorithm, func(t *testing.T) {
+			hybridKeysetData, err := encdec.NewHybridKeyset(algorithm, kmsUri, cfg.KekAd)
+			require.NoError(t, err)
+			hcfg := *cfg
+			hcfg.HybridKeysetData = hybridKeysetData
+			cu, err := NewCryptoUtil(&hcfg)
+			require.NoError(t, err)
+
+			jwks, err := cu.JWKS()
+			require.NoError(t, err)
+			var set struct {
+				Keys []json.RawMessage `json:"keys"`
+			}
+			require.NoError(t, json.Unmarshal(jwks, &set))
+			require.Len(t, set.Keys, 1)
+
+			token, err := EncryptJWE(ctx, set.Keys[0], []byte("James Bond"))
+			require.NoError(t, err)
+			assert.Len(t, strings.Split(token, "."), 5)
+			plain, err := cu.DecryptJWE(ctx, token)
+			require.NoError(t, err)
+			assert.Equal(t, []byte("James Bond"), plain)
+
+			parts := strings.Split(token, ".")
+			parts[3] = b64(append([]byte{1}, []byte("James Bond")[1:]...))
+			_, err = cu.DecryptJWE(ctx, strings.Join(parts, "."))
+			assert.ErrorIs(t, err, ErrTokenDecryption)
+		})
+	}
+}
+
+func TestConcatKDF(t *testing.T) {
+	// RFC 7518 appendix C
+	z := []byte{158, 86, 217, 29, 129, 113, 53, 211, 114, 131, 66, 131, 191, 132, 38, 156,
+		251, 49, 110, 163, 218, 128, 106, 72, 246, 218, 167, 121, 140, 254, 144, 196}
+	key := concatKDF(z, "A128GCM", []byte("Alice"), []byte("Bob"), 16)
+	assert.Equal(t, "VqqN6vgjbSBcIijNcacQGg", base64.RawURLEncoding.EncodeToString(key))
+}
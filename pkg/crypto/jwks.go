@@ -0,0 +1,240 @@
+package crypto
+
+import (
+	"context"
+	stdcrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+var ErrUnknownSigningKey = errors.New("UNKNOWN_SIGNING_KEY")
+
+// JWTKeySource resolves the public key a token was signed with.
+type JWTKeySource interface {
+	// PublicKey returns the key with the given key id, the id is empty for
+	// tokens without a kid header.
+	PublicKey(ctx context.Context, kid string) (stdcrypto.PublicKey, error)
+}
+
+var _ JWTKeySource = (*JWKS)(nil)
+
+// JWKSConfig configures a JWKS key set.
+type JWKSConfig struct {
+	// URL of the JSON Web Key Set, e.g. the jwks_uri of the OIDC provider.
+	URL string
+	// RefreshInterval is how long the fetched keys are cached, defaults to 1h.
+	RefreshInterval time.Duration
+	// MinRefreshInterval limits the refetches triggered by unknown key ids,
+	// defaults to 1m.
+	MinRefreshInterval time.Duration
+	Timeout            time.Duration
+}
+
+// JWKS is a JSON Web Key Set fetched from a URL. The keys are cached and
+// refetched after the refresh interval, or earlier when a token references an
+// unknown key id so that rotated signing keys are picked up. Concurrent
+// refreshes share one fetch, which does not block the lookups of the cached
+// keys.
+type JWKS struct {
+	c      *JWKSConfig
+	client *http.Client
+	now    func() time.Time
+	fetch  singleflight.Group
+
+	mu        sync.Mutex
+	keys      map[string]stdcrypto.PublicKey
+	fetchedAt time.Time
+}
+
+func NewJWKS(c *JWKSConfig) *JWKS {
+	cfg := *c
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = time.Hour
+	}
+	if cfg.MinRefreshInterval <= 0 {
+		cfg.MinRefreshInterval = time.Minute
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	return &JWKS{c: &cfg, client: &http.Client{Timeout: cfg.Timeout}, now: time.Now}
+}
+
+func (s *JWKS) PublicKey(ctx context.Context, kid string) (stdcrypto.PublicKey, error) {
+	now := s.now()
+	keys, fetchedAt := s.cached()
+	if keys == nil || now.Sub(fetchedAt) >= s.c.RefreshInterval {
+		// keep using the stale keys while the provider is unavailable
+		if err := s.refresh(ctx); err != nil && keys == nil {
+			return nil, err
+		}
+		keys, fetchedAt = s.cached()
+	}
+	if key, ok := lookup(keys, kid); ok {
+		return key, nil
+	}
+	if now.Sub(fetchedAt) < s.c.MinRefreshInterval {
+		return nil, ErrUnknownSigningKey
+	}
+	if err := s.refresh(ctx); err != nil {
+		return nil, err
+	}
+	keys, _ = s.cached()
+	if key, ok := lookup(keys, kid); ok {
+		return key, nil
+	}
+	return nil, ErrUnknownSigningKey
+}
+
+func (s *JWKS) cached() (map[string]stdcrypto.PublicKey, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.keys, s.fetchedAt
+}
+
+// lookup returns the key with the id, a token without kid is only accepted
+// when the set has a single key.
+func lookup(keys map[string]stdcrypto.PublicKey, kid string) (stdcrypto.PublicKey, bool) {
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, true
+		}
+	}
+	key, ok := keys[kid]
+	return key, ok
+}
+
+// refresh fetches the key set once for the concurrent callers, the fetch is
+// not cancelled with the context of the caller it runs for as the others
+// wait for it, it is bounded by the Timeout.
+func (s *JWKS) refresh(ctx context.Context) error {
+	_, err, _ := s.fetch.Do(s.c.URL, func() (any, error) {
+		keys, err := s.fetchKeys(context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.keys = keys
+		s.fetchedAt = s.now()
+		return nil, nil
+	})
+	return err
+}
+
+func (s *JWKS) fetchKeys(ctx context.Context) (map[string]stdcrypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.c.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("jwks: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jwks: unexpected status %d", resp.StatusCode)
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("jwks: %w", err)
+	}
+	keys := make(map[string]stdcrypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		// keys of unsupported types are skipped rather than failing the set
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+func (k *jsonWebKey) publicKey() (stdcrypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, ErrInvalidPublicKey
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, ErrInvalidPublicKey
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, ErrInvalidPublicKey
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, ErrInvalidPublicKey
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, ErrInvalidPublicKey
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, ErrInvalidPublicKey
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, ErrInvalidPublicKey
+	}
+	return new(big.Int).SetBytes(b), nil
+}
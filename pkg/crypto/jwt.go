@@ -0,0 +1,263 @@
+package crypto
+
+import (
+	"context"
+	stdcrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"hash"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMalformedToken            = errors.New("MALFORMED_TOKEN")
+	ErrUnsupportedTokenAlgorithm = errors.New("UNSUPPORTED_TOKEN_ALGORITHM")
+	ErrTokenSignature            = errors.New("TOKEN_SIGNATURE_INVALID")
+	ErrTokenExpired              = errors.New("TOKEN_EXPIRED")
+	ErrTokenExpiryMissing        = errors.New("TOKEN_EXPIRY_MISSING")
+	ErrTokenNotYetValid          = errors.New("TOKEN_NOT_YET_VALID")
+	ErrInvalidIssuer             = errors.New("INVALID_ISSUER")
+	ErrInvalidAudience           = errors.New("INVALID_AUDIENCE")
+)
+
+// JWTClaims are the claims of a verified token. The registered claims are
+// parsed, all claims including custom ones are available in Raw.
+type JWTClaims struct {
+	Issuer    string
+	Subject   string
+	Audience  []string
+	ID        string
+	ExpiresAt *time.Time
+	NotBefore *time.Time
+	IssuedAt  *time.Time
+	Raw       map[string]any
+}
+
+// String returns the string value of a custom claim.
+func (c *JWTClaims) String(name string) string {
+	s, _ := c.Raw[name].(string)
+	return s
+}
+
+// Scopes returns the space separated scope claim of OAuth access tokens.
+func (c *JWTClaims) Scopes() []string {
+	return strings.Fields(c.String("scope"))
+}
+
+// JWTVerifierConfig configures a JWTVerifier.
+type JWTVerifierConfig struct {
+	Keys JWTKeySource
+	// Issuers are the accepted iss values, any issuer is accepted when empty.
+	Issuers []string
+	// Audiences are the accepted aud values, the token must contain at least
+	// one of them. Any audience is accepted when empty.
+	Audiences []string
+	// ClockSkew is the leeway applied to exp, nbf and iat, defaults to 1m.
+	ClockSkew time.Duration
+	// Algorithms are the accepted signature algorithms, defaults to all the
+	// supported asymmetric algorithms. Symmetric algorithms and none are
+	// never accepted.
+	Algorithms []string
+	// AllowMissingExpiry accepts the tokens without exp claim, which are
+	// rejected by default as they stay valid forever.
+	AllowMissingExpiry bool
+}
+
+// JWTVerifier verifies signed JSON Web Tokens, e.g. OIDC service tokens.
+type JWTVerifier struct {
+	c   *JWTVerifierConfig
+	now func() time.Time
+}
+
+var jwtAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+func NewJWTVerifier(c *JWTVerifierConfig) *JWTVerifier {
+	cfg := *c
+	if cfg.ClockSkew <= 0 {
+		cfg.ClockSkew = time.Minute
+	}
+	if len(cfg.Algorithms) == 0 {
+		cfg.Algorithms = jwtAlgorithms
+	}
+	return &JWTVerifier{c: &cfg, now: time.Now}
+}
+
+// Verify checks the signature and the registered claims of the token and
+// returns its claims.
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (*JWTClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformedToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if !slices.Contains(v.c.Algorithms, header.Alg) || !slices.Contains(jwtAlgorithms, header.Alg) {
+		return nil, ErrUnsupportedTokenAlgorithm
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+	key, err := v.c.Keys.PublicKey(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if !verifyJWTSignature(header.Alg, key, parts[0]+"."+parts[1], signature) {
+		return nil, ErrTokenSignature
+	}
+
+	var raw map[string]any
+	if err := decodeSegment(parts[1], &raw); err != nil {
+		return nil, err
+	}
+	claims, err := parseClaims(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.validate(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (v *JWTVerifier) validate(claims *JWTClaims) error {
+	now := v.now()
+	if claims.ExpiresAt == nil && !v.c.AllowMissingExpiry {
+		return ErrTokenExpiryMissing
+	}
+	if claims.ExpiresAt != nil && !now.Before(claims.ExpiresAt.Add(v.c.ClockSkew)) {
+		return ErrTokenExpired
+	}
+	if claims.NotBefore != nil && now.Add(v.c.ClockSkew).Before(*claims.NotBefore) {
+		return ErrTokenNotYetValid
+	}
+	if claims.IssuedAt != nil && now.Add(v.c.ClockSkew).Before(*claims.IssuedAt) {
+		return ErrTokenNotYetValid
+	}
+	if len(v.c.Issuers) > 0 && !slices.Contains(v.c.Issuers, claims.Issuer) {
+		return ErrInvalidIssuer
+	}
+	if len(v.c.Audiences) > 0 && !slices.ContainsFunc(claims.Audience, func(aud string) bool {
+		return slices.Contains(v.c.Audiences, aud)
+	}) {
+		return ErrInvalidAudience
+	}
+	return nil
+}
+
+func decodeSegment(segment string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return ErrMalformedToken
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return ErrMalformedToken
+	}
+	return nil
+}
+
+func parseClaims(raw map[string]any) (*JWTClaims, error) {
+	claims := &JWTClaims{Raw: raw}
+	var ok bool
+	for name, target := range map[string]*string{"iss": &claims.Issuer, "sub": &claims.Subject, "jti": &claims.ID} {
+		if v, present := raw[name]; present {
+			if *target, ok = v.(string); !ok {
+				return nil, ErrMalformedToken
+			}
+		}
+	}
+	for name, target := range map[string]**time.Time{"exp": &claims.ExpiresAt, "nbf": &claims.NotBefore, "iat": &claims.IssuedAt} {
+		if v, present := raw[name]; present {
+			seconds, ok := v.(float64)
+			if !ok {
+				return nil, ErrMalformedToken
+			}
+			t := time.Unix(int64(seconds), 0)
+			*target = &t
+		}
+	}
+	switch aud := raw["aud"].(type) {
+	case nil:
+	case string:
+		claims.Audience = []string{aud}
+	case []any:
+		for _, a := range aud {
+			s, ok := a.(string)
+			if !ok {
+				return nil, ErrMalformedToken
+			}
+			claims.Audience = append(claims.Audience, s)
+		}
+	default:
+		return nil, ErrMalformedToken
+	}
+	return claims, nil
+}
+
+func verifyJWTSignature(alg string, key stdcrypto.PublicKey, signingInput string, signature []byte) bool {
+	var h hash.Hash
+	var hashFunc stdcrypto.Hash
+	switch alg[len(alg)-3:] {
+	case "256":
+		h, hashFunc = sha256.New(), stdcrypto.SHA256
+	case "384":
+		h, hashFunc = sha512.New384(), stdcrypto.SHA384
+	case "512":
+		h, hashFunc = sha512.New(), stdcrypto.SHA512
+	}
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if h == nil {
+			return false
+		}
+		h.Write([]byte(signingInput))
+		switch alg[:2] {
+		case "RS":
+			return rsa.VerifyPKCS1v15(k, hashFunc, h.Sum(nil), signature) == nil
+		case "PS":
+			return rsa.VerifyPSS(k, hashFunc, h.Sum(nil), signature, nil) == nil
+		}
+	case *ecdsa.PublicKey:
+		// the curve must match the algorithm, ES512 uses P-521
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if alg[:2] != "ES" || h == nil || len(signature) != 2*size || hashFunc.Size() != min(size, 64) {
+			return false
+		}
+		h.Write([]byte(signingInput))
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(k, h.Sum(nil), r, s)
+	case ed25519.PublicKey:
+		return alg == "EdDSA" && ed25519.Verify(k, []byte(signingInput), signature)
+	}
+	return false
+}
+
+type jwtClaimsCtxKey struct{}
+
+// NewJWTClaimsContext returns a context carrying the verified token claims.
+func NewJWTClaimsContext(ctx context.Context, claims *JWTClaims) context.Context {
+	return context.WithValue(ctx, jwtClaimsCtxKey{}, claims)
+}
+
+// JWTClaimsFromContext returns the claims of the bearer token the request
+// was authenticated with.
+func JWTClaimsFromContext(ctx context.Context) (*JWTClaims, bool) {
+	claims, ok := ctx.Value(jwtClaimsCtxKey{}).(*JWTClaims)
+	return claims, ok
+}
@@ -0,0 +1,198 @@
+package crypto
+
+import (
+	"context"
+	stdcrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type jwksServer struct {
+	mu      sync.Mutex
+	keys    []map[string]string
+	fetches int
+	// delay holds the responses, e.g. to overlap concurrent fetches
+	delay time.Duration
+}
+
+func (s *jwksServer) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	time.Sleep(s.delay)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fetches++
+	_ = json.NewEncoder(w).Encode(map[string]any{"keys": s.keys})
+}
+
+func (s *jwksServer) setKeys(keys ...map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func signJWT(t *testing.T, alg, kid string, signer stdcrypto.Signer, claims map[string]any) string {
+	t.Helper()
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	input := b64(header) + "." + b64(payload)
+
+	var signature []byte
+	switch k := signer.(type) {
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(k, []byte(input))
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256([]byte(input))
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, stdcrypto.SHA256, digest[:])
+		require.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256([]byte(input))
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		require.NoError(t, err)
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return input + "." + b64(signature)
+}
+
+func TestJWTVerifier(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	edPublic, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	server := &jwksServer{}
+	server.setKeys(
+		map[string]string{"kty": "RSA", "kid": "rsa", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		map[string]string{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+	)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	now := time.Unix(1700000000, 0)
+	jwks := NewJWKS(&JWKSConfig{URL: ts.URL})
+	jwks.now = func() time.Time { return now }
+	v := NewJWTVerifier(&JWTVerifierConfig{Keys: jwks, Issuers: []string{"https://idp"}, Audiences: []string{"payments"}})
+	v.now = func() time.Time { return now }
+	ctx := context.Background()
+	claims := func(overrides map[string]any) map[string]any {
+		c := map[string]any{"iss": "https://idp", "sub": "svc-a", "aud": []string{"ledger", "payments"},
+			"exp": now.Add(time.Minute).Unix(), "iat": now.Unix(), "scope": "read write"}
+		for k, v := range overrides {
+			if v == nil {
+				delete(c, k)
+				continue
+			}
+			c[k] = v
+		}
+		return c
+	}
+
+	got, err := v.Verify(ctx, signJWT(t, "RS256", "rsa", rsaKey, claims(nil)))
+	require.NoError(t, err)
+	assert.Equal(t, "svc-a", got.Subject)
+	assert.Equal(t, []string{"ledger", "payments"}, got.Audience)
+	assert.Equal(t, []string{"read", "write"}, got.Scopes())
+
+	_, err = v.Verify(ctx, signJWT(t, "ES256", "ec", ecKey, claims(map[string]any{"aud": "payments"})))
+	assert.NoError(t, err)
+
+	for name, tc := range map[string]struct {
+		token string
+		err   error
+	}{
+		"expired":          {signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]any{"exp": now.Add(-2 * time.Minute).Unix()})), ErrTokenExpired},
+		"not yet valid":    {signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]any{"nbf": now.Add(2 * time.Minute).Unix()})), ErrTokenNotYetValid},
+		"issuer":           {signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]any{"iss": "https://other"})), ErrInvalidIssuer},
+		"audience":         {signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]any{"aud": "ledger"})), ErrInvalidAudience},
+		"wrong key":        {signJWT(t, "RS256", "ec", rsaKey, claims(nil)), ErrTokenSignature},
+		"algorithm":        {signJWT(t, "HS256", "rsa", rsaKey, claims(nil)), ErrUnsupportedTokenAlgorithm},
+		"malformed":        {"not.a-token", ErrMalformedToken},
+		"unknown key id":   {signJWT(t, "EdDSA", "ed", edKey, claims(nil)), ErrUnknownSigningKey},
+		"malformed claims": {signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]any{"exp": "tomorrow"})), ErrMalformedToken},
+		"missing expiry":   {signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]any{"exp": nil})), ErrTokenExpiryMissing},
+	} {
+		_, err := v.Verify(ctx, tc.token)
+		assert.ErrorIs(t, err, tc.err, name)
+	}
+
+	// the tokens without exp are accepted when allowed
+	lenient := NewJWTVerifier(&JWTVerifierConfig{Keys: jwks, AllowMissingExpiry: true})
+	lenient.now = v.now
+	_, err = lenient.Verify(ctx, signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]any{"exp": nil})))
+	assert.NoError(t, err)
+
+	// within the clock skew
+	_, err = v.Verify(ctx, signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]any{"exp": now.Add(-30 * time.Second).Unix()})))
+	assert.NoError(t, err)
+
+	// a rotated key is fetched once the min refresh interval has passed
+	server.setKeys(map[string]string{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": b64(edPublic)})
+	token := signJWT(t, "EdDSA", "ed", edKey, claims(nil))
+	_, err = v.Verify(ctx, token)
+	assert.ErrorIs(t, err, ErrUnknownSigningKey)
+	fetches := server.fetches
+	now = now.Add(2 * time.Minute)
+	token = signJWT(t, "EdDSA", "ed", edKey, claims(nil))
+	_, err = v.Verify(ctx, token)
+	assert.NoError(t, err)
+	assert.Equal(t, fetches+1, server.fetches)
+
+	_, ok := JWTClaimsFromContext(ctx)
+	assert.False(t, ok)
+	c, ok := JWTClaimsFromContext(NewJWTClaimsContext(ctx, got))
+	require.True(t, ok)
+	assert.Equal(t, "svc-a", c.Subject)
+}
+
+func TestJWKSConcurrentRefresh(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	server := &jwksServer{delay: 50 * time.Millisecond}
+	server.setKeys(map[string]string{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))})
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	jwks := NewJWKS(&JWKSConfig{URL: ts.URL})
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := jwks.PublicKey(context.Background(), "ec")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, server.fetches)
+
+	// the fetch is shared, the caller cancelling does not fail it
+	jwks = NewJWKS(&JWKSConfig{URL: ts.URL})
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	_, err = jwks.PublicKey(ctx, "ec")
+	assert.NoError(t, err)
+}
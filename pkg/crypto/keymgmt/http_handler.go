@@ -0,0 +1,208 @@
+package keymgmt
+
+import (
+	"context"
+	"time"
+
+	"github.com/achuala/go-svc-extn/pkg/crypto"
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/transport/grpc"
+	"github.com/go-kratos/kratos/v2/transport/http"
+)
+
+// HttpHandler exposes the Service over HTTP. It implements extn.ApiService so
+// it can be registered with extn.RegisterServices. The routes must be protected
+// by an authentication middleware, which should also set the audit actor with
+// WithActor.
+type HttpHandler struct {
+	svc *Service
+}
+
+func NewHttpHandler(svc *Service) *HttpHandler {
+	return &HttpHandler{svc: svc}
+}
+
+type createKeyRequest struct {
+	InstitutionId   string     `json:"institution_id"`
+	ApplicationName string     `json:"application_name"`
+	ValidFrom       *time.Time `json:"valid_from,omitempty"`
+	ValidTo         *time.Time `json:"valid_to,omitempty"`
+}
+
+type expireKeyRequest struct {
+	ValidTo time.Time `json:"valid_to"`
+}
+
+type keyResponse struct {
+	KeyId           string     `json:"key_id"`
+	InstitutionId   string     `json:"institution_id"`
+	ApplicationName string     `json:"application_name"`
+	Status          string     `json:"status"`
+	ValidFrom       *time.Time `json:"valid_from,omitempty"`
+	ValidTo         *time.Time `json:"valid_to,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	// Secret is only set in the responses of the create and rotate requests.
+	Secret string `json:"secret,omitempty"`
+}
+
+type listKeysResponse struct {
+	Keys          []*keyResponse `json:"keys"`
+	NextPageToken string         `json:"next_page_token,omitempty"`
+}
+
+type auditResponse struct {
+	Entries []*AuditEntry `json:"entries"`
+}
+
+func (h *HttpHandler) RegisterGrpc(server *grpc.Server) {}
+
+func (h *HttpHandler) RegisterHttp(server *http.Server) {
+	r := server.Route("/")
+	r.POST("/v1/access-keys", h.createKey)
+	r.GET("/v1/access-keys/{key_id}", h.getKey)
+	r.POST("/v1/access-keys/{key_id}/enable", h.enableKey)
+	r.POST("/v1/access-keys/{key_id}/disable", h.disableKey)
+	r.POST("/v1/access-keys/{key_id}/expire", h.expireKey)
+	r.POST("/v1/access-keys/{key_id}/rotate", h.rotateKey)
+	r.GET("/v1/access-keys/{key_id}/audit", h.listAudit)
+	r.GET("/v1/institutions/{institution_id}/access-keys", h.listKeys)
+}
+
+func (h *HttpHandler) createKey(ctx http.Context) error {
+	var in createKeyRequest
+	if err := ctx.Bind(&in); err != nil {
+		return err
+	}
+	return h.invoke(ctx, "/keymgmt/CreateKey", &in, func(c context.Context) (interface{}, error) {
+		created, err := h.svc.CreateKey(c, &CreateKeyRequest{
+			InstitutionId:   in.InstitutionId,
+			ApplicationName: in.ApplicationName,
+			ValidFrom:       in.ValidFrom,
+			ValidTo:         in.ValidTo,
+		})
+		if err != nil {
+			return nil, err
+		}
+		resp := toKeyResponse(created.Key)
+		resp.Secret = created.Secret
+		return resp, nil
+	})
+}
+
+func (h *HttpHandler) getKey(ctx http.Context) error {
+	keyId := ctx.Vars().Get("key_id")
+	return h.invoke(ctx, "/keymgmt/GetKey", keyId, func(c context.Context) (interface{}, error) {
+		key, err := h.svc.GetKey(c, keyId)
+		if err != nil {
+			return nil, err
+		}
+		return toKeyResponse(key), nil
+	})
+}
+
+func (h *HttpHandler) enableKey(ctx http.Context) error {
+	keyId := ctx.Vars().Get("key_id")
+	return h.invoke(ctx, "/keymgmt/EnableKey", keyId, func(c context.Context) (interface{}, error) {
+		return struct{}{}, h.svc.EnableKey(c, keyId)
+	})
+}
+
+func (h *HttpHandler) disableKey(ctx http.Context) error {
+	keyId := ctx.Vars().Get("key_id")
+	return h.invoke(ctx, "/keymgmt/DisableKey", keyId, func(c context.Context) (interface{}, error) {
+		return struct{}{}, h.svc.DisableKey(c, keyId)
+	})
+}
+
+func (h *HttpHandler) expireKey(ctx http.Context) error {
+	keyId := ctx.Vars().Get("key_id")
+	var in expireKeyRequest
+	if err := ctx.Bind(&in); err != nil {
+		return err
+	}
+	if in.ValidTo.IsZero() {
+		in.ValidTo = time.Now()
+	}
+	return h.invoke(ctx, "/keymgmt/ExpireKey", &in, func(c context.Context) (interface{}, error) {
+		return struct{}{}, h.svc.ExpireKey(c, keyId, in.ValidTo)
+	})
+}
+
+func (h *HttpHandler) rotateKey(ctx http.Context) error {
+	keyId := ctx.Vars().Get("key_id")
+	return h.invoke(ctx, "/keymgmt/RotateKey", keyId, func(c context.Context) (interface{}, error) {
+		rotated, err := h.svc.RotateKey(c, keyId)
+		if err != nil {
+			return nil, err
+		}
+		resp := toKeyResponse(rotated.Key)
+		resp.Secret = rotated.Secret
+		return resp, nil
+	})
+}
+
+func (h *HttpHandler) listAudit(ctx http.Context) error {
+	keyId := ctx.Vars().Get("key_id")
+	return h.invoke(ctx, "/keymgmt/ListAudit", keyId, func(c context.Context) (interface{}, error) {
+		entries, err := h.svc.ListAudit(c, keyId)
+		if err != nil {
+			return nil, err
+		}
+		return &auditResponse{Entries: entries}, nil
+	})
+}
+
+func (h *HttpHandler) listKeys(ctx http.Context) error {
+	institutionId := ctx.Vars().Get("institution_id")
+	pageToken := ctx.Query().Get("page_token")
+	return h.invoke(ctx, "/keymgmt/ListKeys", institutionId, func(c context.Context) (interface{}, error) {
+		keys, next, err := h.svc.ListKeys(c, institutionId, pageToken)
+		if err != nil {
+			return nil, err
+		}
+		resp := &listKeysResponse{Keys: make([]*keyResponse, len(keys)), NextPageToken: next}
+		for i, k := range keys {
+			resp.Keys[i] = toKeyResponse(k)
+		}
+		return resp, nil
+	})
+}
+
+// invoke runs the call through the server middleware chain and writes the result.
+func (h *HttpHandler) invoke(ctx http.Context, operation string, req interface{}, call func(context.Context) (interface{}, error)) error {
+	http.SetOperation(ctx, operation)
+	handler := ctx.Middleware(func(c context.Context, _ interface{}) (interface{}, error) {
+		out, err := call(c)
+		return out, toHttpError(err)
+	})
+	out, err := handler(ctx, req)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func toHttpError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ErrKeyNotFound):
+		return errors.NotFound(ErrKeyNotFound.Error(), "access key not found")
+	case errors.Is(err, ErrMissingInstitution):
+		return errors.BadRequest(ErrMissingInstitution.Error(), "institution_id is required")
+	default:
+		return err
+	}
+}
+
+func toKeyResponse(k *crypto.APIAccessKey) *keyResponse {
+	return &keyResponse{
+		KeyId:           k.KeyId,
+		InstitutionId:   k.InstitutionId,
+		ApplicationName: k.ApplicationName,
+		Status:          k.Status,
+		ValidFrom:       k.ValidFrom,
+		ValidTo:         k.ValidTo,
+		CreatedAt:       k.CreatedAt,
+	}
+}
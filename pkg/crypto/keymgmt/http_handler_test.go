@@ -0,0 +1,99 @@
+package keymgmt_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/achuala/go-svc-extn/pkg/crypto/keymgmt"
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+	khttp "github.com/go-kratos/kratos/v2/transport/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// adminOnly accepts the requests of the admin token and records the admin as
+// the audit actor.
+func adminOnly(handler middleware.Handler) middleware.Handler {
+	return func(ctx context.Context, req interface{}) (interface{}, error) {
+		tr, _ := transport.FromServerContext(ctx)
+		if tr.RequestHeader().Get("Authorization") != "Bearer admin-token" {
+			return nil, errors.Unauthorized("UNAUTHORIZED", "unauthorized")
+		}
+		return handler(keymgmt.WithActor(ctx, "admin"), req)
+	}
+}
+
+func TestHttpHandler(t *testing.T) {
+	svc, _ := newTestService(t)
+	srv := khttp.NewServer(khttp.Middleware(adminOnly))
+	keymgmt.NewHttpHandler(svc).RegisterHttp(srv)
+
+	call := func(method, path, body, token string) (int, map[string]interface{}) {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, r)
+		var out map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &out), w.Body.String())
+		return w.Code, out
+	}
+
+	t.Run("authorization", func(t *testing.T) {
+		for _, token := range []string{"", "other-token"} {
+			code, _ := call(http.MethodPost, "/v1/access-keys", `{"institution_id":"inst-1"}`, token)
+			assert.Equal(t, http.StatusUnauthorized, code)
+			code, _ = call(http.MethodGet, "/v1/institutions/inst-1/access-keys", "", token)
+			assert.Equal(t, http.StatusUnauthorized, code)
+		}
+		keys, _, err := svc.ListKeys(context.Background(), "inst-1", "")
+		require.NoError(t, err)
+		assert.Empty(t, keys)
+	})
+
+	t.Run("create, rotate and list", func(t *testing.T) {
+		code, created := call(http.MethodPost, "/v1/access-keys", `{"institution_id":"inst-1","application_name":"billing"}`, "admin-token")
+		require.Equal(t, http.StatusOK, code, created)
+		keyId, _ := created["key_id"].(string)
+		require.NotEmpty(t, keyId)
+		assert.NotEmpty(t, created["secret"])
+
+		code, rotated := call(http.MethodPost, "/v1/access-keys/"+keyId+"/rotate", "", "admin-token")
+		require.Equal(t, http.StatusOK, code, rotated)
+		assert.NotEmpty(t, rotated["secret"])
+		assert.NotEqual(t, created["secret"], rotated["secret"])
+
+		code, listed := call(http.MethodGet, "/v1/institutions/inst-1/access-keys", "", "admin-token")
+		require.Equal(t, http.StatusOK, code, listed)
+		keys, _ := listed["keys"].([]interface{})
+		require.Len(t, keys, 1)
+		key, _ := keys[0].(map[string]interface{})
+		assert.Equal(t, keyId, key["key_id"])
+		assert.NotContains(t, key, "secret")
+
+		code, audit := call(http.MethodGet, "/v1/access-keys/"+keyId+"/audit", "", "admin-token")
+		require.Equal(t, http.StatusOK, code, audit)
+		entries, _ := audit["entries"].([]interface{})
+		require.Len(t, entries, 2)
+		for _, e := range entries {
+			assert.Equal(t, "admin", e.(map[string]interface{})["actor"])
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		code, _ := call(http.MethodPost, "/v1/access-keys", `{"application_name":"billing"}`, "admin-token")
+		assert.Equal(t, http.StatusBadRequest, code)
+		code, _ = call(http.MethodGet, "/v1/access-keys/unknown", "", "admin-token")
+		assert.Equal(t, http.StatusNotFound, code)
+		code, _ = call(http.MethodPost, "/v1/access-keys/unknown/rotate", "", "admin-token")
+		assert.Equal(t, http.StatusNotFound, code)
+	})
+}
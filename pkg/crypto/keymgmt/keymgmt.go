@@ -0,0 +1,226 @@
+// Package keymgmt manages the lifecycle of API access keys and keeps an audit
+// log of every change.
+package keymgmt
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/achuala/go-svc-extn/pkg/crypto"
+	"github.com/achuala/go-svc-extn/pkg/data"
+	"github.com/achuala/go-svc-extn/pkg/util/db"
+	"github.com/achuala/go-svc-extn/pkg/util/idgen"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrKeyNotFound        = errors.New("ACCESS_KEY_NOT_FOUND")
+	ErrMissingInstitution = errors.New("MISSING_INSTITUTION")
+)
+
+// Audit actions
+const (
+	AuditActionCreate  = "CREATE"
+	AuditActionEnable  = "ENABLE"
+	AuditActionDisable = "DISABLE"
+	AuditActionExpire  = "EXPIRE"
+	AuditActionRotate  = "ROTATE"
+)
+
+// AuditEntry is a change of an access key as stored in the api_access_key_audit table.
+type AuditEntry struct {
+	Id        uint64    `gorm:"column:id;primaryKey" json:"id,string"`
+	KeyId     string    `gorm:"column:key_id;index" json:"key_id"`
+	Action    string    `gorm:"column:action" json:"action"`
+	Actor     string    `gorm:"column:actor" json:"actor,omitempty"`
+	Details   string    `gorm:"column:details" json:"details,omitempty"`
+	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
+}
+
+func (AuditEntry) TableName() string {
+	return "api_access_key_audit"
+}
+
+type actorKey struct{}
+
+// WithActor returns a context recording the actor of the changes in the audit log.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor set by WithActor.
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// CreateKeyRequest describes a new access key.
+type CreateKeyRequest struct {
+	InstitutionId   string
+	ApplicationName string
+	ValidFrom       *time.Time
+	ValidTo         *time.Time
+}
+
+// CreatedKey is the result of CreateKey and RotateKey. The secret is only ever returned
+// here and cannot be retrieved later.
+type CreatedKey struct {
+	Key    *crypto.APIAccessKey
+	Secret string
+}
+
+// Service manages the access keys.
+type Service struct {
+	data *data.Data
+}
+
+func NewService(d *data.Data) *Service {
+	return &Service{data: d}
+}
+
+// CreateKey creates an active access key with a generated high entropy secret.
+func (s *Service) CreateKey(ctx context.Context, req *CreateKeyRequest) (*CreatedKey, error) {
+	if req.InstitutionId == "" {
+		return nil, ErrMissingInstitution
+	}
+	secret, err := crypto.GenerateAccessSecret()
+	if err != nil {
+		return nil, err
+	}
+	key := &crypto.APIAccessKey{
+		KeyId:           idgen.NewId(),
+		InstitutionId:   req.InstitutionId,
+		ApplicationName: req.ApplicationName,
+		Secret:          secret,
+		Status:          crypto.AccessKeyStatusActive,
+		ValidFrom:       req.ValidFrom,
+		ValidTo:         req.ValidTo,
+	}
+	err = s.data.InTx(ctx, func(ctx context.Context) error {
+		if err := s.data.DB(ctx).Create(key).Error; err != nil {
+			return err
+		}
+		return s.audit(ctx, key.KeyId, AuditActionCreate, "institution="+key.InstitutionId)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &CreatedKey{Key: redact(key), Secret: secret}, nil
+}
+
+// EnableKey activates a disabled access key.
+func (s *Service) EnableKey(ctx context.Context, keyId string) error {
+	return s.update(ctx, keyId, AuditActionEnable, "", map[string]interface{}{"status": crypto.AccessKeyStatusActive})
+}
+
+// DisableKey disables the access key, it can be enabled again.
+func (s *Service) DisableKey(ctx context.Context, keyId string) error {
+	return s.update(ctx, keyId, AuditActionDisable, "", map[string]interface{}{"status": crypto.AccessKeyStatusDisabled})
+}
+
+// ExpireKey sets the end of the validity of the access key.
+func (s *Service) ExpireKey(ctx context.Context, keyId string, at time.Time) error {
+	return s.update(ctx, keyId, AuditActionExpire, "valid_to="+at.UTC().Format(time.RFC3339), map[string]interface{}{"valid_to": at})
+}
+
+// RotateKey generates a new secret for the access key. The previous secrets
+// stay valid for the rotation overlap, see crypto.DbAccessSecretProvider.
+func (s *Service) RotateKey(ctx context.Context, keyId string) (*CreatedKey, error) {
+	var rotated *crypto.APIAccessKeySecret
+	err := s.data.InTx(ctx, func(ctx context.Context) error {
+		var err error
+		rotated, err = crypto.NewDbAccessSecretProvider(s.data.DB(ctx)).RotateAccessKey(ctx, keyId)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrKeyNotFound
+		}
+		if err != nil {
+			return err
+		}
+		return s.audit(ctx, keyId, AuditActionRotate, "version="+strconv.Itoa(rotated.Version))
+	})
+	if err != nil {
+		return nil, err
+	}
+	key, err := s.GetKey(ctx, keyId)
+	if err != nil {
+		return nil, err
+	}
+	return &CreatedKey{Key: key, Secret: rotated.Secret}, nil
+}
+
+// GetKey returns the access key without its secret.
+func (s *Service) GetKey(ctx context.Context, keyId string) (*crypto.APIAccessKey, error) {
+	var key crypto.APIAccessKey
+	if err := s.data.DB(ctx).Where("key_id = ?", keyId).Take(&key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrKeyNotFound
+		}
+		return nil, err
+	}
+	return redact(&key), nil
+}
+
+// ListKeys returns a page of the access keys of the institution without their
+// secrets, and the token of the next page when there are more keys.
+func (s *Service) ListKeys(ctx context.Context, institutionId, pageToken string) ([]*crypto.APIAccessKey, string, error) {
+	page, pageSize := db.ParsePageToken(pageToken)
+	page, pageSize = max(page, 1), min(max(pageSize, 1), 100)
+	var keys []*crypto.APIAccessKey
+	// one more key tells whether there is a next page
+	err := s.data.DB(ctx).Where("institution_id = ?", institutionId).
+		Order("created_at, key_id").Offset((page - 1) * pageSize).Limit(pageSize + 1).Find(&keys).Error
+	if err != nil {
+		return nil, "", err
+	}
+	nextPageToken := ""
+	if len(keys) > pageSize {
+		keys = keys[:pageSize]
+		nextPageToken = db.ToPageToken(page, pageSize)
+	}
+	for _, k := range keys {
+		redact(k)
+	}
+	return keys, nextPageToken, nil
+}
+
+// ListAudit returns the audit log of the access key, oldest first.
+func (s *Service) ListAudit(ctx context.Context, keyId string) ([]*AuditEntry, error) {
+	var entries []*AuditEntry
+	if err := s.data.DB(ctx).Where("key_id = ?", keyId).Order("created_at, id").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (s *Service) update(ctx context.Context, keyId, action, details string, values map[string]interface{}) error {
+	return s.data.InTx(ctx, func(ctx context.Context) error {
+		res := s.data.DB(ctx).Model(&crypto.APIAccessKey{}).Where("key_id = ?", keyId).Updates(values)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrKeyNotFound
+		}
+		return s.audit(ctx, keyId, action, details)
+	})
+}
+
+func (s *Service) audit(ctx context.Context, keyId, action, details string) error {
+	entry := &AuditEntry{
+		Id:      idgen.NewSnowflakeId(),
+		KeyId:   keyId,
+		Action:  action,
+		Actor:   ActorFromContext(ctx),
+		Details: details,
+	}
+	return s.data.DB(ctx).Create(entry).Error
+}
+
+// redact removes the secrets from the key.
+func redact(key *crypto.APIAccessKey) *crypto.APIAccessKey {
+	key.Secret = ""
+	key.Secrets = nil
+	return key
+}
@@ -0,0 +1,120 @@
+package keymgmt_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/achuala/go-svc-extn/pkg/crypto"
+	"github.com/achuala/go-svc-extn/pkg/crypto/keymgmt"
+	"github.com/achuala/go-svc-extn/pkg/data"
+	_ "github.com/achuala/go-svc-extn/pkg/data/sqlite"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func newTestService(t *testing.T) (*keymgmt.Service, *gorm.DB) {
+	db, err := data.NewGormWithOptions(filepath.Join(t.TempDir(), "keys.db"), data.WithDialect(data.SQLite))
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&crypto.APIAccessKey{}, &crypto.APIAccessKeySecret{}, &keymgmt.AuditEntry{}))
+	d, cleanup, err := data.NewData(db, log.DefaultLogger)
+	require.NoError(t, err)
+	t.Cleanup(cleanup)
+	return keymgmt.NewService(d), db
+}
+
+func TestKeyLifecycle(t *testing.T) {
+	svc, db := newTestService(t)
+	ctx := keymgmt.WithActor(context.Background(), "admin")
+	provider := crypto.NewDbAccessSecretProvider(db)
+
+	_, err := svc.CreateKey(ctx, &keymgmt.CreateKeyRequest{ApplicationName: "billing"})
+	assert.ErrorIs(t, err, keymgmt.ErrMissingInstitution)
+
+	created, err := svc.CreateKey(ctx, &keymgmt.CreateKeyRequest{InstitutionId: "inst-1", ApplicationName: "billing"})
+	require.NoError(t, err)
+	assert.Len(t, created.Secret, 64)
+	assert.Empty(t, created.Key.Secret)
+	keyId := created.Key.KeyId
+
+	isValid := func() bool {
+		key, err := provider.GetAccessKey(keyId)
+		require.NoError(t, err)
+		return key.IsValid()
+	}
+	assert.True(t, isValid())
+	require.NoError(t, svc.DisableKey(ctx, keyId))
+	assert.False(t, isValid())
+	require.NoError(t, svc.EnableKey(ctx, keyId))
+	assert.True(t, isValid())
+
+	rotated, err := svc.RotateKey(ctx, keyId)
+	require.NoError(t, err)
+	assert.NotEqual(t, created.Secret, rotated.Secret)
+	assert.Empty(t, rotated.Key.Secret)
+	// the previous secret stays valid during the overlap
+	secrets, err := provider.GetAccessSecrets(keyId)
+	require.NoError(t, err)
+	assert.Equal(t, []string{rotated.Secret, created.Secret}, secrets)
+
+	require.NoError(t, svc.ExpireKey(ctx, keyId, time.Now().Add(-time.Second)))
+	assert.False(t, isValid())
+
+	for _, err := range []error{
+		svc.DisableKey(ctx, "unknown"),
+		svc.ExpireKey(ctx, "unknown", time.Now()),
+	} {
+		assert.ErrorIs(t, err, keymgmt.ErrKeyNotFound)
+	}
+	_, err = svc.RotateKey(ctx, "unknown")
+	assert.ErrorIs(t, err, keymgmt.ErrKeyNotFound)
+	_, err = svc.GetKey(ctx, "unknown")
+	assert.ErrorIs(t, err, keymgmt.ErrKeyNotFound)
+
+	entries, err := svc.ListAudit(ctx, keyId)
+	require.NoError(t, err)
+	var actions []string
+	for _, e := range entries {
+		actions = append(actions, e.Action)
+		assert.Equal(t, "admin", e.Actor)
+	}
+	assert.Equal(t, []string{
+		keymgmt.AuditActionCreate,
+		keymgmt.AuditActionDisable,
+		keymgmt.AuditActionEnable,
+		keymgmt.AuditActionRotate,
+		keymgmt.AuditActionExpire,
+	}, actions)
+	assert.Equal(t, "version=2", entries[3].Details)
+}
+
+func TestListKeys(t *testing.T) {
+	svc, _ := newTestService(t)
+	ctx := context.Background()
+	for i := 0; i < 12; i++ {
+		_, err := svc.CreateKey(ctx, &keymgmt.CreateKeyRequest{InstitutionId: "inst-1"})
+		require.NoError(t, err)
+	}
+	_, err := svc.CreateKey(ctx, &keymgmt.CreateKeyRequest{InstitutionId: "inst-2"})
+	require.NoError(t, err)
+
+	seen := map[string]bool{}
+	first, next, err := svc.ListKeys(ctx, "inst-1", "")
+	require.NoError(t, err)
+	assert.Len(t, first, 10)
+	require.NotEmpty(t, next)
+	second, next, err := svc.ListKeys(ctx, "inst-1", next)
+	require.NoError(t, err)
+	assert.Len(t, second, 2)
+	assert.Empty(t, next)
+
+	for _, k := range append(first, second...) {
+		assert.Equal(t, "inst-1", k.InstitutionId)
+		assert.Empty(t, k.Secret)
+		assert.False(t, seen[k.KeyId], "key %s listed twice", k.KeyId)
+		seen[k.KeyId] = true
+	}
+}
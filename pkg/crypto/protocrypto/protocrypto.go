@@ -0,0 +1,91 @@
+// Package protocrypto encrypts the fields of proto messages marked with
+// (options.sensitive).encrypt = true, e.g. before a message is persisted or
+// published, and decrypts them on read.
+//
+// String fields hold the base64 cipher text of CryptoUtil.Encrypt, bytes
+// fields its raw bytes. The full name of the field is the associated data,
+// so a cipher text can't be moved to another field.
+package protocrypto
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/achuala/go-svc-extn/gen/go/options"
+	"github.com/achuala/go-svc-extn/pkg/crypto"
+	"github.com/achuala/go-svc-extn/pkg/util/sensitive"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// EncryptFields encrypts the fields of m marked for encryption in place.
+// Singular and repeated string and bytes fields are supported.
+func EncryptFields(ctx context.Context, u *crypto.CryptoUtil, m proto.Message) error {
+	return transform(m, func(fd protoreflect.FieldDescriptor, v protoreflect.Value) (protoreflect.Value, error) {
+		ad := []byte(fd.FullName())
+		if fd.Kind() == protoreflect.StringKind {
+			cipherText, err := u.Encrypt(ctx, []byte(v.String()), ad)
+			if err != nil {
+				return v, err
+			}
+			return protoreflect.ValueOfString(cipherText), nil
+		}
+		cipherText, err := u.Encrypt(ctx, v.Bytes(), ad)
+		if err != nil {
+			return v, err
+		}
+		cipher, err := base64.RawStdEncoding.DecodeString(cipherText)
+		if err != nil {
+			return v, err
+		}
+		return protoreflect.ValueOfBytes(cipher), nil
+	})
+}
+
+// DecryptFields decrypts the fields of m encrypted by EncryptFields in place.
+func DecryptFields(ctx context.Context, u *crypto.CryptoUtil, m proto.Message) error {
+	return transform(m, func(fd protoreflect.FieldDescriptor, v protoreflect.Value) (protoreflect.Value, error) {
+		ad := []byte(fd.FullName())
+		if fd.Kind() == protoreflect.StringKind {
+			plain, err := u.Decrypt(ctx, v.String(), ad)
+			if err != nil {
+				return v, err
+			}
+			return protoreflect.ValueOfString(string(plain)), nil
+		}
+		plain, err := u.Decrypt(ctx, base64.RawStdEncoding.EncodeToString(v.Bytes()), ad)
+		if err != nil {
+			return v, err
+		}
+		return protoreflect.ValueOfBytes(plain), nil
+	})
+}
+
+func transform(m proto.Message, fn func(fd protoreflect.FieldDescriptor, v protoreflect.Value) (protoreflect.Value, error)) error {
+	return sensitive.Walk(m.ProtoReflect(), func(m protoreflect.Message, fd protoreflect.FieldDescriptor, v protoreflect.Value, opts *options.Sensitive) error {
+		if !opts.GetEncrypt() {
+			return nil
+		}
+		if fd.IsMap() || (fd.Kind() != protoreflect.StringKind && fd.Kind() != protoreflect.BytesKind) {
+			return fmt.Errorf("field %s can't be encrypted, only string and bytes fields are supported", fd.FullName())
+		}
+		if fd.IsList() {
+			list := v.List()
+			for i := 0; i < list.Len(); i++ {
+				out, err := fn(fd, list.Get(i))
+				if err != nil {
+					return fmt.Errorf("field %s: %w", fd.FullName(), err)
+				}
+				list.Set(i, out)
+			}
+			return nil
+		}
+		out, err := fn(fd, v)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", fd.FullName(), err)
+		}
+		m.Set(fd, out)
+		return nil
+	})
+}
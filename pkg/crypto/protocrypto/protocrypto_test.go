@@ -0,0 +1,103 @@
+package protocrypto
+
+import (
+	"context"
+	"testing"
+
+	"github.com/achuala/go-svc-extn/gen/go/options"
+	"github.com/achuala/go-svc-extn/pkg/crypto"
+	"github.com/achuala/go-svc-extn/pkg/crypto/encdec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// customerDescriptor builds
+//
+//	message Customer {
+//		string name = 1;
+//		string email = 2 [(options.sensitive).encrypt = true];
+//		bytes document = 3 [(options.sensitive).encrypt = true];
+//		repeated string phones = 4 [(options.sensitive).encrypt = true];
+//		Customer parent = 5;
+//	}
+func customerDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	encrypt := func() *descriptorpb.FieldOptions {
+		opts := &descriptorpb.FieldOptions{}
+		proto.SetExtension(opts, options.E_Sensitive, &options.Sensitive{Encrypt: true})
+		return opts
+	}
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, label descriptorpb.FieldDescriptorProto_Label, opts *descriptorpb.FieldOptions) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{Name: proto.String(name), Number: proto.Int32(number), Type: typ.Enum(), Label: label.Enum(), Options: opts}
+		if typ == descriptorpb.FieldDescriptorProto_TYPE_MESSAGE {
+			f.TypeName = proto.String(".test.Customer")
+		}
+		return f
+	}
+	optional, repeated := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("test/customer.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Customer"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, optional, nil),
+				field("email", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, optional, encrypt()),
+				field("document", 3, descriptorpb.FieldDescriptorProto_TYPE_BYTES, optional, encrypt()),
+				field("phones", 4, descriptorpb.FieldDescriptorProto_TYPE_STRING, repeated, encrypt()),
+				field("parent", 5, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, optional, nil),
+			},
+		}},
+	}, protoregistry.GlobalFiles)
+	require.NoError(t, err)
+	return fd.Messages().Get(0)
+}
+
+func TestEncryptFields(t *testing.T) {
+	ctx := context.Background()
+	kekUri, err := encdec.NewKeyURI()
+	require.NoError(t, err)
+	keySetData, err := encdec.NewKeyset(kekUri, nil)
+	require.NoError(t, err)
+	u, err := crypto.NewCryptoUtil(&crypto.CryptoConfig{KmsUri: kekUri, KeysetData: keySetData})
+	require.NoError(t, err)
+
+	md := customerDescriptor(t)
+	fields := md.Fields()
+	newCustomer := func(email string) *dynamicpb.Message {
+		m := dynamicpb.NewMessage(md)
+		m.Set(fields.ByName("name"), protoreflect.ValueOfString("James"))
+		m.Set(fields.ByName("email"), protoreflect.ValueOfString(email))
+		m.Set(fields.ByName("document"), protoreflect.ValueOfBytes([]byte("passport")))
+		phones := m.Mutable(fields.ByName("phones")).List()
+		phones.Append(protoreflect.ValueOfString("+44 20 7946 0958"))
+		return m
+	}
+	m := newCustomer("bond@example.com")
+	m.Set(fields.ByName("parent"), protoreflect.ValueOfMessage(newCustomer("m@example.com")))
+	plain := proto.Clone(m)
+
+	require.NoError(t, EncryptFields(ctx, u, m))
+	assert.Equal(t, "James", m.Get(fields.ByName("name")).String())
+	assert.NotEqual(t, "bond@example.com", m.Get(fields.ByName("email")).String())
+	assert.NotEqual(t, []byte("passport"), m.Get(fields.ByName("document")).Bytes())
+	assert.NotEqual(t, "+44 20 7946 0958", m.Get(fields.ByName("phones")).List().Get(0).String())
+	parent := m.Get(fields.ByName("parent")).Message()
+	assert.NotEqual(t, "m@example.com", parent.Get(fields.ByName("email")).String())
+	assert.False(t, proto.Equal(plain, m))
+
+	require.NoError(t, DecryptFields(ctx, u, m))
+	assert.True(t, proto.Equal(plain, m))
+
+	// the field name is the associated data
+	m = newCustomer("bond@example.com")
+	require.NoError(t, EncryptFields(ctx, u, m))
+	m.Set(fields.ByName("email"), m.Get(fields.ByName("phones")).List().Get(0))
+	assert.Error(t, DecryptFields(ctx, u, m))
+}
@@ -0,0 +1,97 @@
+package crypto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/achuala/go-svc-extn/pkg/cache"
+)
+
+var ErrQuotaExceeded = errors.New("QUOTA_EXCEEDED")
+
+// Quota windows
+const (
+	QuotaWindowMinute = "minute"
+	QuotaWindowDay    = "day"
+)
+
+// QuotaExceededError describes the exceeded quota, it matches ErrQuotaExceeded.
+type QuotaExceededError struct {
+	Window  string
+	Limit   int64
+	ResetAt time.Time
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("quota of %d requests per %s exceeded, resets at %s", e.Limit, e.Window, e.ResetAt.Format(time.RFC3339))
+}
+
+func (e *QuotaExceededError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+// Quota is the number of requests allowed per access key, zero is unlimited.
+type Quota struct {
+	PerMinute int64
+	PerDay    int64
+}
+
+// QuotaLimiter enforces the request quotas of the access keys with fixed
+// minute and day (UTC) windows counted in the cache.
+type QuotaLimiter struct {
+	counter  cache.Counter
+	defaults Quota
+	now      func() time.Time
+}
+
+// NewQuotaLimiter returns a QuotaLimiter applying the defaults to the keys
+// which have no quota of their own.
+func NewQuotaLimiter(counter cache.Counter, defaults *Quota) *QuotaLimiter {
+	l := &QuotaLimiter{counter: counter, now: time.Now}
+	if defaults != nil {
+		l.defaults = *defaults
+	}
+	return l
+}
+
+// Allow counts the request against the quotas of the access key and returns a
+// *QuotaExceededError when one of them is exceeded.
+func (l *QuotaLimiter) Allow(ctx context.Context, key *APIAccessKey) error {
+	perMinute, perDay := l.defaults.PerMinute, l.defaults.PerDay
+	if key.RequestsPerMinute > 0 {
+		perMinute = key.RequestsPerMinute
+	}
+	if key.RequestsPerDay > 0 {
+		perDay = key.RequestsPerDay
+	}
+
+	now := l.now().UTC()
+	if perMinute > 0 {
+		resetAt := now.Truncate(time.Minute).Add(time.Minute)
+		if err := l.count(ctx, key.KeyId, QuotaWindowMinute, perMinute, resetAt, now); err != nil {
+			return err
+		}
+	}
+	if perDay > 0 {
+		resetAt := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+		if err := l.count(ctx, key.KeyId, QuotaWindowDay, perDay, resetAt, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *QuotaLimiter) count(ctx context.Context, keyId, window string, limit int64, resetAt, now time.Time) error {
+	counterKey := "quota:" + keyId + ":" + window + ":" + strconv.FormatInt(resetAt.Unix(), 10)
+	n, err := l.counter.Incr(ctx, counterKey, resetAt.Sub(now)+time.Minute)
+	if err != nil {
+		return err
+	}
+	if n > limit {
+		return &QuotaExceededError{Window: window, Limit: limit, ResetAt: resetAt}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package crypto
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryCounter map[string]int64
+
+func (c memoryCounter) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	c[key]++
+	return c[key], nil
+}
+
+func TestQuotaLimiter(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 10, 30, 15, 0, time.UTC)
+	l := NewQuotaLimiter(memoryCounter{}, &Quota{PerMinute: 2, PerDay: 3})
+	l.now = func() time.Time { return now }
+
+	key := &APIAccessKey{KeyId: "AK1"}
+	require.NoError(t, l.Allow(ctx, key))
+	require.NoError(t, l.Allow(ctx, key))
+
+	err := l.Allow(ctx, key)
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+	var qe *QuotaExceededError
+	require.ErrorAs(t, err, &qe)
+	assert.Equal(t, QuotaWindowMinute, qe.Window)
+	assert.Equal(t, int64(2), qe.Limit)
+	assert.Equal(t, time.Date(2024, 1, 1, 10, 31, 0, 0, time.UTC), qe.ResetAt)
+
+	// the next minute starts a new window, but the daily quota is used up
+	now = now.Add(time.Minute)
+	require.NoError(t, l.Allow(ctx, key))
+	err = l.Allow(ctx, key)
+	require.ErrorAs(t, err, &qe)
+	assert.Equal(t, QuotaWindowDay, qe.Window)
+	assert.Equal(t, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), qe.ResetAt)
+
+	// quotas of the key override the defaults
+	unlimited := &APIAccessKey{KeyId: "AK2", RequestsPerMinute: 100, RequestsPerDay: 100}
+	for i := 0; i < 10; i++ {
+		require.NoError(t, l.Allow(ctx, unlimited))
+	}
+}
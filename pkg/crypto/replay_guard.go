@@ -0,0 +1,130 @@
+package crypto
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/achuala/go-svc-extn/pkg/cache"
+)
+
+var (
+	ErrRequestExpired = errors.New("REQUEST_EXPIRED")
+	ErrReplayDetected = errors.New("REPLAY_DETECTED")
+	// ErrNonAtomicNonceStore is returned by CacheNonceStore.Claim when the
+	// cache can't claim a nonce atomically, see cache.Locker.
+	ErrNonAtomicNonceStore = errors.New("NON_ATOMIC_NONCE_STORE")
+)
+
+const defaultMaxClockSkew = 5 * time.Minute
+
+// NonceStore remembers the nonces of verified requests.
+type NonceStore interface {
+	// Claim records the nonce for the given ttl. It returns false if the
+	// nonce has already been claimed.
+	Claim(ctx context.Context, nonce string, ttl time.Duration) (bool, error)
+}
+
+// CacheNonceStore is a NonceStore backed by pkg/cache. Nonces are claimed with
+// cache.Locker.SetNX, so that only one of concurrent replays of a request
+// succeeds. Claims fail with ErrNonAtomicNonceStore for caches which do not
+// implement cache.Locker.
+type CacheNonceStore struct {
+	cache cache.Cache
+}
+
+func NewCacheNonceStore(c cache.Cache) *CacheNonceStore {
+	return &CacheNonceStore{cache: c}
+}
+
+// Claim records the nonce unless it is already present in the cache.
+func (s *CacheNonceStore) Claim(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	locker, ok := s.cache.(cache.Locker)
+	if !ok {
+		return false, ErrNonAtomicNonceStore
+	}
+	return locker.SetNX(ctx, nonce, "1", ttl)
+}
+
+// ReplayProtectionConfig configures a ReplayGuard.
+type ReplayProtectionConfig struct {
+	// MaxClockSkew is the maximum difference between the signed timestamp and
+	// the server time, defaults to 5 minutes.
+	MaxClockSkew time.Duration
+	// NonceStore records the nonce of each verified request, nil disables the
+	// nonce check and only the timestamp is validated.
+	NonceStore NonceStore
+}
+
+// ReplayGuard rejects signed requests which are outside of the clock skew
+// window or have been seen before.
+type ReplayGuard struct {
+	maxClockSkew time.Duration
+	nonces       NonceStore
+	now          func() time.Time
+}
+
+func NewReplayGuard(cfg *ReplayProtectionConfig) *ReplayGuard {
+	skew := cfg.MaxClockSkew
+	if skew <= 0 {
+		skew = defaultMaxClockSkew
+	}
+	return &ReplayGuard{maxClockSkew: skew, nonces: cfg.NonceStore, now: time.Now}
+}
+
+// CheckTimestamp validates the signed ts header against the clock skew window.
+func (g *ReplayGuard) CheckTimestamp(signedHeaders map[string]string) error {
+	ts, err := ParseSignatureTimestamp(signedHeaders["ts"])
+	if err != nil {
+		return ErrRequestExpired
+	}
+	skew := g.now().Sub(ts)
+	if skew > g.maxClockSkew || skew < -g.maxClockSkew {
+		return ErrRequestExpired
+	}
+	return nil
+}
+
+// Check validates the timestamp and claims the request signature as its nonce.
+// The nonce header is not covered by the signature, so it can't tell requests
+// apart: a captured request could be replayed with another one.
+// It must only be called after the signature has been verified.
+func (g *ReplayGuard) Check(ctx context.Context, accessKeyId string, signedHeaders map[string]string, signature string) error {
+	if err := g.CheckTimestamp(signedHeaders); err != nil {
+		return err
+	}
+	if g.nonces == nil {
+		return nil
+	}
+	// Requests older than twice the skew are rejected by the timestamp check,
+	// so the nonce does not need to be kept any longer.
+	ok, err := g.nonces.Claim(ctx, "nonce:"+accessKeyId+":"+signature, 2*g.maxClockSkew)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrReplayDetected
+	}
+	return nil
+}
+
+// ParseSignatureTimestamp parses the ts header of a signed request, which can be
+// RFC 3339, the compact ISO 8601 basic format (20060102T150405Z) or unix time in
+// seconds or milliseconds.
+func ParseSignatureTimestamp(ts string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, ts); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("20060102T150405Z", ts); err == nil {
+		return t, nil
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(ts) >= 13 {
+		return time.UnixMilli(unix), nil
+	}
+	return time.Unix(unix, 0), nil
+}
@@ -0,0 +1,78 @@
+package crypto
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/achuala/go-svc-extn/pkg/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryNonceStore map[string]struct{}
+
+func (s memoryNonceStore) Claim(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	if _, ok := s[nonce]; ok {
+		return false, nil
+	}
+	s[nonce] = struct{}{}
+	return true, nil
+}
+
+func TestReplayGuard(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	g := NewReplayGuard(&ReplayProtectionConfig{MaxClockSkew: time.Minute, NonceStore: memoryNonceStore{}})
+	g.now = func() time.Time { return now }
+
+	headers := mustParseSignedHeaders(t, "ts=20240101T000030Z/api=payments/ver=v1")
+	require.NoError(t, g.Check(ctx, "AK1", headers, "sig1"))
+	assert.ErrorIs(t, g.Check(ctx, "AK1", headers, "sig1"), ErrReplayDetected)
+	// nonces are scoped to the access key
+	assert.NoError(t, g.Check(ctx, "AK2", headers, "sig1"))
+
+	// the nonce header is not signed, changing it does not make a new request
+	withNonce := mustParseSignedHeaders(t, "ts=2024-01-01T00:00:00Z/api=payments/ver=v1/nonce=n1")
+	require.NoError(t, g.Check(ctx, "AK1", withNonce, "sig2"))
+	otherNonce := mustParseSignedHeaders(t, "ts=2024-01-01T00:00:00Z/api=payments/ver=v1/nonce=n2")
+	assert.ErrorIs(t, g.Check(ctx, "AK1", otherNonce, "sig2"), ErrReplayDetected)
+	assert.NoError(t, g.Check(ctx, "AK1", withNonce, "sig3"))
+
+	for _, ts := range []string{"20231231T235800Z", "1704067320", "1704067320000", "", "yesterday"} {
+		err := g.Check(ctx, "AK1", map[string]string{"ts": ts}, "sig-"+ts)
+		assert.ErrorIs(t, err, ErrRequestExpired, ts)
+	}
+	assert.NoError(t, g.CheckTimestamp(map[string]string{"ts": "1704067200"}))
+	assert.NoError(t, g.CheckTimestamp(map[string]string{"ts": "1704067200000"}))
+}
+
+func TestCacheNonceStore(t *testing.T) {
+	ctx := context.Background()
+	c, err, cleanup := cache.NewLocalCacheRistretto(&cache.CacheConfig{Mode: "local"})
+	require.NoError(t, err)
+	defer cleanup()
+	store := NewCacheNonceStore(c)
+
+	var claimed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := store.Claim(ctx, "nonce:AK1:n1", time.Minute)
+			assert.NoError(t, err)
+			if ok {
+				claimed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), claimed.Load())
+
+	// caches without SetNX can't claim nonces atomically
+	_, err = NewCacheNonceStore(struct{ cache.Cache }{c}).Claim(ctx, "nonce:AK1:n2", time.Minute)
+	assert.ErrorIs(t, err, ErrNonAtomicNonceStore)
+}
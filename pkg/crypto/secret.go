@@ -0,0 +1,123 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"log/slog"
+	"runtime"
+	"sync"
+)
+
+const redactedSecret = "[REDACTED]"
+
+// Secret holds sensitive bytes such as keys, access secrets and decrypted
+// plain texts. The bytes are kept in memory locked against swapping where the
+// platform allows it, and are zeroed by Destroy. Formatting, logging and JSON
+// encoding a Secret print [REDACTED] instead of the bytes.
+type Secret struct {
+	b      []byte
+	region []byte // locked memory mapping backing b, nil when not locked
+	once   sync.Once
+}
+
+// NewSecret copies b into a new secret and zeroes b.
+func NewSecret(b []byte) *Secret {
+	s := newSecret(len(b))
+	copy(s.b, b)
+	clear(b)
+	return s
+}
+
+// NewSecretString copies the string into a new secret. The string itself
+// can't be zeroed, prefer NewSecret where the bytes are at hand.
+func NewSecretString(v string) *Secret {
+	s := newSecret(len(v))
+	copy(s.b, v)
+	return s
+}
+
+// NewRandomSecret returns a secret of n random bytes, e.g. a data key.
+func NewRandomSecret(n int) (*Secret, error) {
+	s := newSecret(n)
+	if _, err := io.ReadFull(rand.Reader, s.b); err != nil {
+		s.Destroy()
+		return nil, err
+	}
+	return s, nil
+}
+
+func newSecret(n int) *Secret {
+	s := &Secret{}
+	s.b, s.region = allocLocked(n)
+	if s.region != nil {
+		// the mapping isn't garbage collected
+		runtime.SetFinalizer(s, (*Secret).Destroy)
+	}
+	return s
+}
+
+// Bytes returns the secret bytes, nil once destroyed. The slice must not be
+// retained or used after Destroy.
+func (s *Secret) Bytes() []byte {
+	return s.b
+}
+
+// Len returns the number of secret bytes.
+func (s *Secret) Len() int {
+	return len(s.b)
+}
+
+// Locked reports whether the bytes are locked in memory.
+func (s *Secret) Locked() bool {
+	return s.region != nil
+}
+
+// Equal compares the secret with b in constant time.
+func (s *Secret) Equal(b []byte) bool {
+	return subtle.ConstantTimeCompare(s.b, b) == 1
+}
+
+// Destroy zeroes the bytes and releases the locked memory. It is safe to call
+// more than once.
+func (s *Secret) Destroy() {
+	s.once.Do(func() {
+		clear(s.b)
+		if s.region != nil {
+			freeLocked(s.region)
+			runtime.SetFinalizer(s, nil)
+		}
+		s.b, s.region = nil, nil
+	})
+}
+
+// Redact implements the Redacter interface of the logging middleware.
+func (s *Secret) Redact() string {
+	return redactedSecret
+}
+
+func (s *Secret) String() string {
+	return redactedSecret
+}
+
+func (s *Secret) GoString() string {
+	return redactedSecret
+}
+
+// Format prints [REDACTED] for every verb, %x included.
+func (s *Secret) Format(f fmt.State, _ rune) {
+	_, _ = io.WriteString(f, redactedSecret)
+}
+
+func (s *Secret) LogValue() slog.Value {
+	return slog.StringValue(redactedSecret)
+}
+
+func (s *Secret) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + redactedSecret + `"`), nil
+}
+
+func (s *Secret) MarshalText() ([]byte, error) {
+	return []byte(redactedSecret), nil
+}
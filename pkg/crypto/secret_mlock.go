@@ -0,0 +1,34 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package crypto
+
+import (
+	"os"
+	"syscall"
+)
+
+// allocLocked maps whole pages for the secret so that unlocking it doesn't
+// unlock the memory of others. It falls back to the heap when the mapping or
+// the lock fails, e.g. when RLIMIT_MEMLOCK is exhausted.
+func allocLocked(n int) ([]byte, []byte) {
+	if n == 0 {
+		return make([]byte, 0), nil
+	}
+	pageSize := os.Getpagesize()
+	size := (n + pageSize - 1) / pageSize * pageSize
+	region, err := syscall.Mmap(-1, 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+	if err != nil {
+		return make([]byte, n), nil
+	}
+	if err := syscall.Mlock(region); err != nil {
+		_ = syscall.Munmap(region)
+		return make([]byte, n), nil
+	}
+	return region[:n:n], region
+}
+
+func freeLocked(region []byte) {
+	clear(region)
+	_ = syscall.Munlock(region)
+	_ = syscall.Munmap(region)
+}
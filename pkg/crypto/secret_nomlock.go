@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package crypto
+
+// allocLocked keeps secrets on the heap where memory can't be locked.
+func allocLocked(n int) ([]byte, []byte) {
+	return make([]byte, n), nil
+}
+
+func freeLocked(region []byte) {}
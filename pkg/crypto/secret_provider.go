@@ -0,0 +1,80 @@
+package crypto
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+var ErrSecretNotFound = errors.New("SECRET_NOT_FOUND")
+
+// SecretProvider returns secrets by name from a secret store.
+type SecretProvider interface {
+	GetSecret(ctx context.Context, name string) (string, error)
+}
+
+var _ AccessSecretProvider = (*SecretStoreAccessProvider)(nil)
+
+// SecretStoreAccessProvider resolves access secrets from a SecretProvider so
+// that the signature middleware can be used without a database. The secret
+// name is the access key id with an optional prefix.
+type SecretStoreAccessProvider struct {
+	store  SecretProvider
+	prefix string
+}
+
+func NewSecretStoreAccessProvider(store SecretProvider, prefix string) *SecretStoreAccessProvider {
+	return &SecretStoreAccessProvider{store: store, prefix: prefix}
+}
+
+func (p *SecretStoreAccessProvider) GetAccessSecret(accessKeyId string) (string, error) {
+	return p.store.GetSecret(context.Background(), p.prefix+accessKeyId)
+}
+
+// EnvSecretProvider reads secrets from environment variables. The variable
+// name is the prefix followed by the secret name in upper case, with every
+// character other than letters and digits replaced by an underscore.
+type EnvSecretProvider struct {
+	Prefix string
+}
+
+func (p *EnvSecretProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	envName := p.Prefix + strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, name)
+	secret, ok := os.LookupEnv(envName)
+	if !ok || secret == "" {
+		return "", ErrSecretNotFound
+	}
+	return secret, nil
+}
+
+// FileSecretProvider reads secrets from the files of a directory, one file
+// per secret named after it, as mounted by Kubernetes or Docker secrets.
+type FileSecretProvider struct {
+	Dir string
+}
+
+func (p *FileSecretProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	if name == "" || !filepath.IsLocal(name) || strings.ContainsAny(name, `/\`) {
+		return "", ErrSecretNotFound
+	}
+	b, err := os.ReadFile(filepath.Join(p.Dir, name))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", ErrSecretNotFound
+		}
+		return "", err
+	}
+	secret := strings.TrimRight(string(b), "\r\n")
+	if secret == "" {
+		return "", ErrSecretNotFound
+	}
+	return secret, nil
+}
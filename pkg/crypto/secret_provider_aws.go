@@ -0,0 +1,112 @@
+package crypto
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/achuala/go-svc-extn/pkg/crypto/awssig"
+)
+
+var _ SecretProvider = (*AwsSecretsManagerProvider)(nil)
+
+// AwsSecretsManagerConfiguration configures an AwsSecretsManagerProvider.
+// The region defaults to AWS_REGION.
+type AwsSecretsManagerConfiguration struct {
+	Region string
+	// Static credentials, they override Credentials.
+	AccessKeyId     string
+	SecretAccessKey string
+	SessionToken    string
+	// Credentials default to awssig.DefaultCredentials.
+	Credentials awssig.CredentialsProvider
+	// Endpoint overrides the regional endpoint, e.g. for a VPC endpoint.
+	Endpoint string
+	// JsonKey selects a key of a JSON secret string, empty uses the whole string.
+	JsonKey string
+	Timeout time.Duration
+}
+
+// AwsSecretsManagerProvider reads secrets from AWS Secrets Manager, the
+// secret name is the secret id or ARN.
+type AwsSecretsManagerProvider struct {
+	c      *AwsSecretsManagerConfiguration
+	client *http.Client
+	now    func() time.Time
+}
+
+func NewAwsSecretsManagerProvider(c *AwsSecretsManagerConfiguration) *AwsSecretsManagerProvider {
+	cfg := *c
+	if cfg.Region == "" {
+		cfg.Region = os.Getenv("AWS_REGION")
+	}
+	if cfg.AccessKeyId != "" {
+		cfg.Credentials = awssig.Credentials{AccessKeyId: cfg.AccessKeyId, SecretAccessKey: cfg.SecretAccessKey, SessionToken: cfg.SessionToken}
+	} else if cfg.Credentials == nil {
+		cfg.Credentials = awssig.DefaultCredentials()
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://secretsmanager." + cfg.Region + ".amazonaws.com"
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	return &AwsSecretsManagerProvider{c: &cfg, client: &http.Client{Timeout: cfg.Timeout}, now: time.Now}
+}
+
+func (p *AwsSecretsManagerProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	payload, err := json.Marshal(map[string]string{"SecretId": name})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.c.Endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	creds, err := p.c.Credentials.Retrieve(ctx)
+	if err != nil {
+		return "", err
+	}
+	awssig.Sign(req, payload, creds, p.c.Region, "secretsmanager", p.now())
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		SecretString string `json:"SecretString"`
+		Type         string `json:"__type"`
+		Message      string `json:"message"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		if strings.HasSuffix(body.Type, "ResourceNotFoundException") {
+			return "", ErrSecretNotFound
+		}
+		return "", fmt.Errorf("secretsmanager: %s: %s", body.Type, body.Message)
+	}
+
+	secret := body.SecretString
+	if p.c.JsonKey != "" {
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+			return "", err
+		}
+		secret, _ = fields[p.c.JsonKey].(string)
+	}
+	if secret == "" {
+		return "", ErrSecretNotFound
+	}
+	return secret, nil
+}
@@ -0,0 +1,94 @@
+package crypto
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvAndFileSecretProviders(t *testing.T) {
+	ctx := context.Background()
+
+	t.Setenv("API_SECRET_PARTNER_1", "env-secret")
+	env := &EnvSecretProvider{Prefix: "API_SECRET_"}
+	secret, err := env.GetSecret(ctx, "partner-1")
+	require.NoError(t, err)
+	assert.Equal(t, "env-secret", secret)
+	_, err = env.GetSecret(ctx, "partner-2")
+	assert.ErrorIs(t, err, ErrSecretNotFound)
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "AK1"), []byte("file-secret\n"), 0o600))
+	files := NewSecretStoreAccessProvider(&FileSecretProvider{Dir: dir}, "")
+	secret, err = files.GetAccessSecret("AK1")
+	require.NoError(t, err)
+	assert.Equal(t, "file-secret", secret)
+	for _, name := range []string{"AK2", "../AK1", "sub/AK1", ""} {
+		_, err = files.GetAccessSecret(name)
+		assert.ErrorIs(t, err, ErrSecretNotFound, name)
+	}
+}
+
+func TestVaultSecretProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/v1/kv/data/api-keys/AK1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":{"data":{"secret":"vault-secret"}}}`))
+	}))
+	defer srv.Close()
+
+	p := NewVaultSecretProvider(&VaultConfiguration{Address: srv.URL, Token: "token", Mount: "kv"})
+	secret, err := p.GetSecret(context.Background(), "api-keys/AK1")
+	require.NoError(t, err)
+	assert.Equal(t, "vault-secret", secret)
+	_, err = p.GetSecret(context.Background(), "api-keys/AK2")
+	assert.ErrorIs(t, err, ErrSecretNotFound)
+}
+
+func TestAwsSecretsManagerProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/20240101/eu-west-1/secretsmanager/aws4_request, ") ||
+			!strings.Contains(auth, "SignedHeaders=content-type;host;x-amz-date;x-amz-target, ") ||
+			r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"__type":"AccessDeniedException"}`))
+			return
+		}
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body["SecretId"] != "api-keys/AK1" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type":"ResourceNotFoundException","message":"not found"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"SecretString":"{\"secret\":\"aws-secret\"}"}`))
+	}))
+	defer srv.Close()
+
+	p := NewAwsSecretsManagerProvider(&AwsSecretsManagerConfiguration{
+		Region: "eu-west-1", AccessKeyId: "AKID", SecretAccessKey: "secret", Endpoint: srv.URL, JsonKey: "secret",
+	})
+	p.now = func() time.Time { return time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC) }
+
+	secret, err := p.GetSecret(context.Background(), "api-keys/AK1")
+	require.NoError(t, err)
+	assert.Equal(t, "aws-secret", secret)
+	_, err = p.GetSecret(context.Background(), "api-keys/AK2")
+	assert.ErrorIs(t, err, ErrSecretNotFound)
+}
@@ -0,0 +1,97 @@
+package crypto
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+var _ SecretProvider = (*VaultSecretProvider)(nil)
+
+// VaultConfiguration configures a VaultSecretProvider.
+type VaultConfiguration struct {
+	// Address of the Vault server, defaults to VAULT_ADDR.
+	Address string
+	// Token used to authenticate, defaults to VAULT_TOKEN.
+	Token     string
+	Namespace string
+	// Mount is the path of the KV version 2 secrets engine, defaults to "secret".
+	Mount string
+	// Field is the key of the secret data holding the secret, defaults to "secret".
+	Field   string
+	Timeout time.Duration
+}
+
+// VaultSecretProvider reads secrets from the HashiCorp Vault KV version 2
+// secrets engine, the secret name is the path below the mount.
+type VaultSecretProvider struct {
+	c      *VaultConfiguration
+	client *http.Client
+}
+
+func NewVaultSecretProvider(c *VaultConfiguration) *VaultSecretProvider {
+	cfg := *c
+	if cfg.Address == "" {
+		cfg.Address = os.Getenv("VAULT_ADDR")
+	}
+	if cfg.Token == "" {
+		cfg.Token = os.Getenv("VAULT_TOKEN")
+	}
+	if cfg.Mount == "" {
+		cfg.Mount = "secret"
+	}
+	if cfg.Field == "" {
+		cfg.Field = "secret"
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	return &VaultSecretProvider{c: &cfg, client: &http.Client{Timeout: cfg.Timeout}}
+}
+
+func (p *VaultSecretProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	segments := strings.Split(strings.Trim(name, "/"), "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	endpoint := strings.TrimRight(p.c.Address, "/") + "/v1/" + strings.Trim(p.c.Mount, "/") + "/data/" + strings.Join(segments, "/")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", p.c.Token)
+	if p.c.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.c.Namespace)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return "", ErrSecretNotFound
+	case resp.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("vault: unexpected status %d reading %s", resp.StatusCode, name)
+	}
+	var body struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	secret, ok := body.Data.Data[p.c.Field].(string)
+	if !ok || secret == "" {
+		return "", ErrSecretNotFound
+	}
+	return secret, nil
+}
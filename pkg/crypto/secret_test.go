@@ -0,0 +1,47 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecret(t *testing.T) {
+	raw := []byte("top secret")
+	s := NewSecret(raw)
+	assert.Equal(t, make([]byte, len(raw)), raw)
+	assert.Equal(t, []byte("top secret"), s.Bytes())
+	assert.True(t, s.Equal([]byte("top secret")))
+	assert.False(t, s.Equal([]byte("top secreT")))
+
+	for _, format := range []string{"%v", "%+v", "%#v", "%s", "%q", "%x"} {
+		assert.Equal(t, "[REDACTED]", fmt.Sprintf(format, s), format)
+	}
+	assert.Equal(t, "[REDACTED]", s.Redact())
+	encoded, err := json.Marshal(struct{ Key *Secret }{s})
+	require.NoError(t, err)
+	assert.Equal(t, `{"Key":"[REDACTED]"}`, string(encoded))
+	buf := new(bytes.Buffer)
+	slog.New(slog.NewTextHandler(buf, nil)).Info("loaded", "key", s)
+	assert.NotContains(t, buf.String(), "top secret")
+
+	s.Destroy()
+	s.Destroy()
+	assert.Nil(t, s.Bytes())
+	assert.Equal(t, 0, s.Len())
+
+	random, err := NewRandomSecret(32)
+	require.NoError(t, err)
+	defer random.Destroy()
+	assert.Equal(t, 32, random.Len())
+	assert.False(t, random.Equal(make([]byte, 32)))
+
+	empty := NewSecretString("")
+	assert.Equal(t, 0, empty.Len())
+	empty.Destroy()
+}
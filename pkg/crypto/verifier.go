@@ -0,0 +1,218 @@
+package crypto
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// FailureCode is the reason a request failed verification.
+type FailureCode string
+
+const (
+	FailureNone                 FailureCode = ""
+	FailureMissingHeader        FailureCode = "MISSING_HEADER"
+	FailureMalformedHeader      FailureCode = "MALFORMED_HEADER"
+	FailureUnsupportedAlgorithm FailureCode = "UNSUPPORTED_ALGORITHM"
+	FailureUnknownKey           FailureCode = "UNKNOWN_KEY"
+	FailureKeyInactive          FailureCode = "KEY_INACTIVE"
+	FailureKeyExpired           FailureCode = "KEY_EXPIRED"
+	FailureRequestExpired       FailureCode = "REQUEST_EXPIRED"
+	FailureSignatureMismatch    FailureCode = "SIGNATURE_MISMATCH"
+	FailureReplayDetected       FailureCode = "REPLAY_DETECTED"
+	// FailureSandboxNotAllowed is a sandbox request signed with a production key.
+	FailureSandboxNotAllowed FailureCode = "SANDBOX_NOT_ALLOWED"
+	// FailureTestKeyNotAllowed is a production request signed with a test key.
+	FailureTestKeyNotAllowed FailureCode = "TEST_KEY_NOT_ALLOWED"
+	// FailureInternal is an error of the secret provider or the replay cache.
+	FailureInternal FailureCode = "INTERNAL"
+)
+
+// VerificationRequest holds the parts of a signed request.
+type VerificationRequest struct {
+	// Authorization is the Authorization header.
+	Authorization string
+	// SignedHeaders is the x-signed-headers header.
+	SignedHeaders string
+	Payload       string
+	// Request is required by the v2 and asymmetric algorithms.
+	Request *CanonicalRequest
+}
+
+// VerificationResult describes the outcome of VerifyRequest. The fields are
+// filled in as far as verification got, so that failures can be logged with
+// the key id and timestamp of the request.
+type VerificationResult struct {
+	KeyId     string
+	Algorithm string
+	// Key is the access key, only the key id is set when the provider does
+	// not implement AccessKeyProvider.
+	Key       *APIAccessKey
+	Timestamp time.Time
+	// TimestampSkew is the server time minus the signed timestamp.
+	TimestampSkew time.Duration
+	// SecretVersion is the version of the matched secret, 0 for keys without
+	// versioned secrets.
+	SecretVersion int
+	// Sandbox is set for test traffic, i.e. requests carrying the sandbox
+	// flag in the signed headers and signed with a test enabled key.
+	Sandbox bool
+	Failure FailureCode
+	// Err is the underlying error of the failure.
+	Err error
+}
+
+// Verified reports whether the request passed verification.
+func (r *VerificationResult) Verified() bool {
+	return r.Failure == FailureNone
+}
+
+// VerifierConfig configures a Verifier.
+type VerifierConfig struct {
+	Provider AccessSecretProvider
+	// ReplayGuard optionally validates the timestamp and nonce of the request.
+	ReplayGuard *ReplayGuard
+	// AllowV1 accepts the v1 signatures which do not cover the request.
+	AllowV1 bool
+}
+
+// Verifier verifies signed requests and reports the reason of failures.
+type Verifier struct {
+	provider    AccessSecretProvider
+	replayGuard *ReplayGuard
+	allowV1     bool
+	now         func() time.Time
+}
+
+func NewVerifier(cfg *VerifierConfig) *Verifier {
+	return &Verifier{provider: cfg.Provider, replayGuard: cfg.ReplayGuard, allowV1: cfg.AllowV1, now: time.Now}
+}
+
+// VerifyRequest verifies the signature of the request. The result is never nil.
+func (v *Verifier) VerifyRequest(ctx context.Context, req *VerificationRequest) *VerificationResult {
+	r := &VerificationResult{}
+	fail := func(code FailureCode, err error) *VerificationResult {
+		r.Failure, r.Err = code, err
+		return r
+	}
+
+	if req.Authorization == "" || req.SignedHeaders == "" {
+		return fail(FailureMissingHeader, ErrMissingSignature)
+	}
+	sh, err := ParseSignatureHeader(req.Authorization)
+	if err != nil {
+		return fail(FailureMalformedHeader, err)
+	}
+	r.KeyId, r.Algorithm = sh.AccessKeyId, sh.Algorithm
+	r.Key = &APIAccessKey{KeyId: sh.AccessKeyId}
+
+	headers, err := ParseSignedHeaders(req.SignedHeaders)
+	if err != nil {
+		return fail(FailureMalformedHeader, err)
+	}
+	now := v.now()
+	if ts, err := ParseSignatureTimestamp(headers["ts"]); err == nil {
+		r.Timestamp, r.TimestampSkew = ts, now.Sub(ts)
+	}
+	if v.replayGuard != nil {
+		if err := v.replayGuard.CheckTimestamp(headers); err != nil {
+			return fail(FailureRequestExpired, err)
+		}
+	}
+	if !isSupportedAlgorithm(sh.Algorithm, req.Request, v.allowV1) {
+		return fail(FailureUnsupportedAlgorithm, ErrUnsupportedSignatureAlgorithm)
+	}
+
+	secrets, code, err := v.secrets(r, now)
+	if code != FailureNone {
+		return fail(code, err)
+	}
+	// the algorithm is chosen by the client, it must be one of the key type
+	if r.Key.KeyType != "" && r.Key.KeyType != AlgorithmKeyType(sh.Algorithm) {
+		return fail(FailureUnsupportedAlgorithm, ErrUnsupportedSignatureAlgorithm)
+	}
+	_, stored := v.provider.(AccessKeyProvider)
+	matches := signatureMatcher(sh, headers, req.Payload, req.Request, r.Key.KeyType, stored)
+	matched := false
+	for _, s := range secrets {
+		if s.Secret != "" && matches(s.Secret) {
+			r.SecretVersion, matched = s.Version, true
+			break
+		}
+	}
+	if !matched {
+		return fail(FailureSignatureMismatch, ErrSignatureMismatch)
+	}
+	// the flag is only trusted once the signature has been verified
+	r.Sandbox = IsSandboxFlag(headers[SandboxHeader])
+	if r.Sandbox && !r.Key.TestEnabled {
+		return fail(FailureSandboxNotAllowed, nil)
+	}
+	if !r.Sandbox && r.Key.TestEnabled {
+		return fail(FailureTestKeyNotAllowed, nil)
+	}
+
+	if v.replayGuard != nil {
+		if err := v.replayGuard.Check(ctx, sh.AccessKeyId, headers, sh.Signature); err != nil {
+			switch {
+			case errors.Is(err, ErrRequestExpired):
+				return fail(FailureRequestExpired, err)
+			case errors.Is(err, ErrReplayDetected):
+				return fail(FailureReplayDetected, err)
+			default:
+				return fail(FailureInternal, err)
+			}
+		}
+	}
+	return r
+}
+
+// secrets resolves the access key and its usable secrets.
+func (v *Verifier) secrets(r *VerificationResult, now time.Time) ([]APIAccessKeySecret, FailureCode, error) {
+	switch p := v.provider.(type) {
+	case AccessKeyProvider:
+		key, err := p.GetAccessKey(r.KeyId)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, FailureUnknownKey, err
+		}
+		if err != nil {
+			return nil, FailureInternal, err
+		}
+		r.Key = key
+		if key.Status != "" && key.Status != AccessKeyStatusActive {
+			return nil, FailureKeyInactive, nil
+		}
+		if (key.ValidFrom != nil && now.Before(*key.ValidFrom)) || (key.ValidTo != nil && !now.Before(*key.ValidTo)) {
+			return nil, FailureKeyExpired, nil
+		}
+		secrets := key.ActiveSecretVersions(now)
+		if len(secrets) == 0 {
+			return nil, FailureKeyExpired, nil
+		}
+		return secrets, FailureNone, nil
+	case MultiSecretProvider:
+		values, err := p.GetAccessSecrets(r.KeyId)
+		if err != nil {
+			return nil, FailureInternal, err
+		}
+		if len(values) == 0 {
+			return nil, FailureUnknownKey, nil
+		}
+		secrets := make([]APIAccessKeySecret, len(values))
+		for i, s := range values {
+			secrets[i] = APIAccessKeySecret{KeyId: r.KeyId, Secret: s}
+		}
+		return secrets, FailureNone, nil
+	default:
+		secret, err := v.provider.GetAccessSecret(r.KeyId)
+		if err != nil {
+			return nil, FailureInternal, err
+		}
+		if secret == "" {
+			return nil, FailureUnknownKey, nil
+		}
+		return []APIAccessKeySecret{{KeyId: r.KeyId, Secret: secret}}, FailureNone, nil
+	}
+}
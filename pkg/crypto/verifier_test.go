@@ -0,0 +1,222 @@
+package crypto
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestVerifierVerifyRequest(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 10, 0, time.UTC)
+	past := now.Add(-time.Hour)
+	securityHeader := "ts=20240101T000000Z/api=payments/ver=v1/chnl=web/usrid=u1"
+	payload := `{"amount":100}`
+	req := NewCanonicalRequest(httptest.NewRequest(http.MethodPost, "/v1/payments", nil))
+	sign := func(keyId, secret string) string {
+		signature := ComputeCanonicalSignature(secret, payload, mustParseSignedHeaders(t, securityHeader), req, nil)
+		return "creds=access-key:" + keyId + "/signature=" + signature + "/alg=HMAC-SHA256-V2"
+	}
+
+	provider := &countingKeyProvider{keys: map[string]*APIAccessKey{
+		"AK1": {KeyId: "AK1", Secret: "v2", Secrets: []APIAccessKeySecret{{Version: 1, Secret: "v1"}, {Version: 2, Secret: "v2"}}},
+		"AK2": {KeyId: "AK2", Secret: "s", Status: AccessKeyStatusDisabled},
+		"AK3": {KeyId: "AK3", Secret: "s", ValidTo: &past},
+	}}
+	guard := NewReplayGuard(&ReplayProtectionConfig{MaxClockSkew: time.Minute, NonceStore: memoryNonceStore{}})
+	guard.now = func() time.Time { return now }
+	v := NewVerifier(&VerifierConfig{Provider: provider, ReplayGuard: guard})
+	v.now = guard.now
+
+	result := v.VerifyRequest(ctx, &VerificationRequest{Authorization: sign("AK1", "v1"), SignedHeaders: securityHeader, Payload: payload, Request: req})
+	assert.True(t, result.Verified(), result.Err)
+	assert.Equal(t, "AK1", result.KeyId)
+	assert.Equal(t, SignatureAlgorithmV2, result.Algorithm)
+	assert.Equal(t, 1, result.SecretVersion)
+	assert.Equal(t, 10*time.Second, result.TimestampSkew)
+
+	for name, tc := range map[string]struct {
+		req     *VerificationRequest
+		failure FailureCode
+	}{
+		"missing header":   {&VerificationRequest{SignedHeaders: securityHeader}, FailureMissingHeader},
+		"malformed header": {&VerificationRequest{Authorization: "creds=", SignedHeaders: securityHeader}, FailureMalformedHeader},
+		"v1 not allowed": {&VerificationRequest{
+			Authorization: "creds=access-key:AK1/signature=" + ComputeSignature("v2", payload, mustParseSignedHeaders(t, securityHeader)),
+			SignedHeaders: securityHeader, Payload: payload, Request: req,
+		}, FailureUnsupportedAlgorithm},
+		"unknown key":      {&VerificationRequest{Authorization: sign("AK9", "s"), SignedHeaders: securityHeader, Payload: payload, Request: req}, FailureUnknownKey},
+		"disabled key":     {&VerificationRequest{Authorization: sign("AK2", "s"), SignedHeaders: securityHeader, Payload: payload, Request: req}, FailureKeyInactive},
+		"expired key":      {&VerificationRequest{Authorization: sign("AK3", "s"), SignedHeaders: securityHeader, Payload: payload, Request: req}, FailureKeyExpired},
+		"bad signature":    {&VerificationRequest{Authorization: sign("AK1", "v3"), SignedHeaders: securityHeader, Payload: payload, Request: req}, FailureSignatureMismatch},
+		"replayed request": {&VerificationRequest{Authorization: sign("AK1", "v1"), SignedHeaders: securityHeader, Payload: payload, Request: req}, FailureReplayDetected},
+		"replayed with another nonce": {&VerificationRequest{
+			Authorization: sign("AK1", "v1"), SignedHeaders: securityHeader + "/nonce=n2", Payload: payload, Request: req,
+		}, FailureReplayDetected},
+		"stale request": {&VerificationRequest{
+			Authorization: sign("AK1", "v2"), SignedHeaders: "ts=20231231T000000Z/api=payments/ver=v1", Payload: payload, Request: req,
+		}, FailureRequestExpired},
+	} {
+		result := v.VerifyRequest(ctx, tc.req)
+		assert.False(t, result.Verified(), name)
+		assert.Equal(t, tc.failure, result.Failure, name)
+	}
+}
+
+type failingKeyProvider struct{ err error }
+
+func (p failingKeyProvider) GetAccessSecret(string) (string, error) { return "", p.err }
+
+func (p failingKeyProvider) GetAccessKey(string) (*APIAccessKey, error) { return nil, p.err }
+
+func TestVerifierProviderError(t *testing.T) {
+	securityHeader := "ts=20240101T000000Z/api=payments/ver=v1"
+	req := NewCanonicalRequest(httptest.NewRequest(http.MethodPost, "/v1/payments", nil))
+	signature := ComputeCanonicalSignature("s", "", mustParseSignedHeaders(t, securityHeader), req, nil)
+	vreq := &VerificationRequest{
+		Authorization: "creds=access-key:AK1/signature=" + signature + "/alg=HMAC-SHA256-V2",
+		SignedHeaders: securityHeader, Request: req,
+	}
+
+	// a failing store is not reported as an unknown key
+	unavailable := errors.New("connection refused")
+	result := NewVerifier(&VerifierConfig{Provider: failingKeyProvider{unavailable}}).VerifyRequest(context.Background(), vreq)
+	assert.Equal(t, FailureInternal, result.Failure)
+	assert.ErrorIs(t, result.Err, unavailable)
+
+	result = NewVerifier(&VerifierConfig{Provider: failingKeyProvider{gorm.ErrRecordNotFound}}).VerifyRequest(context.Background(), vreq)
+	assert.Equal(t, FailureUnknownKey, result.Failure)
+}
+
+func TestVerifierSandbox(t *testing.T) {
+	ctx := context.Background()
+	payload := `{"amount":100}`
+	req := NewCanonicalRequest(httptest.NewRequest(http.MethodPost, "/v1/payments", nil))
+	provider := &countingKeyProvider{keys: map[string]*APIAccessKey{
+		"LIVE": {KeyId: "LIVE", Secret: "live"},
+		"TEST": {KeyId: "TEST", Secret: "test", TestEnabled: true},
+	}}
+	v := NewVerifier(&VerifierConfig{Provider: provider})
+	verify := func(keyId, secret, securityHeader string) *VerificationResult {
+		signature := ComputeCanonicalSignature(secret, payload, mustParseSignedHeaders(t, securityHeader), req, nil)
+		return v.VerifyRequest(ctx, &VerificationRequest{
+			Authorization: "creds=access-key:" + keyId + "/signature=" + signature + "/alg=HMAC-SHA256-V2",
+			SignedHeaders: securityHeader, Payload: payload, Request: req,
+		})
+	}
+	production := "ts=20240101T000000Z/api=payments/ver=v1"
+	sandbox := production + "/sandbox=true"
+
+	result := verify("TEST", "test", sandbox)
+	assert.True(t, result.Verified())
+	assert.True(t, result.Sandbox)
+
+	result = verify("LIVE", "live", production)
+	assert.True(t, result.Verified())
+	assert.False(t, result.Sandbox)
+
+	assert.Equal(t, FailureSandboxNotAllowed, verify("LIVE", "live", sandbox).Failure)
+	assert.Equal(t, FailureTestKeyNotAllowed, verify("TEST", "test", production).Failure)
+
+	assert.False(t, IsSandbox(ctx))
+	assert.True(t, IsSandbox(NewSandboxContext(ctx)))
+}
+
+func TestVerifierRejectsHmacWithPublicKey(t *testing.T) {
+	ctx := context.Background()
+	securityHeader := "ts=20240101T000000Z/api=payments/ver=v1/chnl=web/usrid=u1"
+	headers := mustParseSignedHeaders(t, securityHeader)
+	payload := `{"amount":100}`
+	req := NewCanonicalRequest(httptest.NewRequest(http.MethodPost, "/v1/payments", nil))
+
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecPrivate, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	publicPem := func(key any) string {
+		der, err := x509.MarshalPKIXPublicKey(key)
+		require.NoError(t, err)
+		return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	}
+	rsaPublic, ecPublic := publicPem(&rsaPrivate.PublicKey), publicPem(&ecPrivate.PublicKey)
+
+	provider := &countingKeyProvider{keys: map[string]*APIAccessKey{
+		"RSA":        {KeyId: "RSA", Secret: rsaPublic},
+		"EC":         {KeyId: "EC", Secret: ecPublic},
+		"EC_TYPED":   {KeyId: "EC_TYPED", Secret: ecPublic, KeyType: AccessKeyTypePublicKey},
+		"HMAC_TYPED": {KeyId: "HMAC_TYPED", Secret: "s", KeyType: AccessKeyTypeHmac},
+	}}
+	v := NewVerifier(&VerifierConfig{Provider: provider, AllowV1: true})
+	v.now = func() time.Time { return time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC) }
+
+	for name, tc := range map[string]struct {
+		keyId, secret, alg string
+		failure            FailureCode
+	}{
+		"v2 with rsa public key":         {"RSA", rsaPublic, SignatureAlgorithmV2, FailureSignatureMismatch},
+		"v1 with rsa public key":         {"RSA", rsaPublic, SignatureAlgorithmV1, FailureSignatureMismatch},
+		"v2 with ecdsa public key":       {"EC", ecPublic, SignatureAlgorithmV2, FailureSignatureMismatch},
+		"v1 with ecdsa public key":       {"EC", ecPublic, SignatureAlgorithmV1, FailureSignatureMismatch},
+		"v2 with typed public key":       {"EC_TYPED", ecPublic, SignatureAlgorithmV2, FailureUnsupportedAlgorithm},
+		"asymmetric with typed hmac key": {"HMAC_TYPED", "s", SignatureAlgorithmEcdsaP256, FailureUnsupportedAlgorithm},
+	} {
+		var signature string
+		switch tc.alg {
+		case SignatureAlgorithmV1:
+			signature = ComputeSignature(tc.secret, payload, headers)
+		case SignatureAlgorithmV2:
+			signature = ComputeCanonicalSignature(tc.secret, payload, headers, req, nil)
+		default:
+			signature, err = SignCanonicalRequest(ecPrivate, payload, headers, req, nil)
+			require.NoError(t, err)
+		}
+		authHeader := "creds=access-key:" + tc.keyId + "/signature=" + signature + "/alg=" + tc.alg
+		result := v.VerifyRequest(ctx, &VerificationRequest{Authorization: authHeader, SignedHeaders: securityHeader, Payload: payload, Request: req})
+		assert.Equal(t, tc.failure, result.Failure, name)
+
+		plain := staticSecretProvider{tc.keyId: tc.secret}
+		if tc.keyId != "HMAC_TYPED" {
+			assert.ErrorIs(t, VerifyRequestSignature(authHeader, securityHeader, payload, req, plain, true), ErrSignatureMismatch, name)
+		}
+	}
+}
+
+func TestVerifierLegacyHmacKey(t *testing.T) {
+	ctx := context.Background()
+	securityHeader := "ts=20240101T000000Z/api=payments/ver=v1/chnl=web/usrid=u1"
+	headers := mustParseSignedHeaders(t, securityHeader)
+	payload := `{"amount":100}`
+	req := NewCanonicalRequest(httptest.NewRequest(http.MethodPost, "/v1/payments", nil))
+
+	// A base64 secret of 32 bytes also parses as a raw Ed25519 public key,
+	// stored keys without a type still verify it as an HMAC secret.
+	secret := base64.StdEncoding.EncodeToString(make([]byte, 32))
+	provider := &countingKeyProvider{keys: map[string]*APIAccessKey{
+		"LEGACY": {KeyId: "LEGACY", Secret: secret},
+	}}
+	v := NewVerifier(&VerifierConfig{Provider: provider, AllowV1: true})
+	v.now = func() time.Time { return time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC) }
+
+	for alg, signature := range map[string]string{
+		SignatureAlgorithmV1: ComputeSignature(secret, payload, headers),
+		SignatureAlgorithmV2: ComputeCanonicalSignature(secret, payload, headers, req, nil),
+	} {
+		authHeader := "creds=access-key:LEGACY/signature=" + signature + "/alg=" + alg
+		result := v.VerifyRequest(ctx, &VerificationRequest{Authorization: authHeader, SignedHeaders: securityHeader, Payload: payload, Request: req})
+		assert.Equal(t, FailureNone, result.Failure, alg)
+	}
+}
@@ -0,0 +1,50 @@
+// Package ctxkeys holds the values of the request shared by the middlewares,
+// the data layer and the messaging, without depending on any of them.
+package ctxkeys
+
+import "context"
+
+// Key is the type of the context keys of the package.
+type Key string
+
+// CorrelationIdKey is the context key, and the header, of the correlation ID.
+const CorrelationIdKey Key = "x-correlation-id"
+
+type (
+	actorKey  struct{}
+	tenantKey struct{}
+)
+
+// NewCorrelationIdContext returns a context carrying the correlation ID.
+func NewCorrelationIdContext(ctx context.Context, correlationId string) context.Context {
+	return context.WithValue(ctx, CorrelationIdKey, correlationId)
+}
+
+// CorrelationIdFromContext returns the correlation ID of the context.
+func CorrelationIdFromContext(ctx context.Context) (string, bool) {
+	correlationId, ok := ctx.Value(CorrelationIdKey).(string)
+	return correlationId, ok && correlationId != ""
+}
+
+// NewActorContext returns a context carrying the actor, the authenticated
+// user or access key the changes are made by.
+func NewActorContext(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor of the context.
+func ActorFromContext(ctx context.Context) (string, bool) {
+	actor, ok := ctx.Value(actorKey{}).(string)
+	return actor, ok && actor != ""
+}
+
+// NewTenantContext returns a context carrying the tenant.
+func NewTenantContext(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant of the context.
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantKey{}).(string)
+	return tenant, ok && tenant != ""
+}
@@ -0,0 +1,286 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/achuala/go-svc-extn/pkg/ctxkeys"
+	"github.com/achuala/go-svc-extn/pkg/util/idgen"
+	"gorm.io/gorm"
+)
+
+// Audited is embedded in the models recording who created and last updated
+// them, see Auditing.
+type Audited struct {
+	CreatedBy string `gorm:"size:255"`
+	UpdatedBy string `gorm:"size:255"`
+}
+
+// AuditTrailEntry records a change of a model designated by WithAuditTrail in
+// the audit_trail table.
+type AuditTrailEntry struct {
+	Id string `gorm:"primaryKey;size:64"`
+	// Table and primary key of the changed row
+	Table      string `gorm:"size:255;not null;index:idx_audit_trail_row"`
+	PrimaryKey string `gorm:"size:255;not null;index:idx_audit_trail_row"`
+	// create, update or delete
+	Action        string `gorm:"size:16;not null"`
+	Actor         string `gorm:"size:255"`
+	CorrelationId string `gorm:"size:64"`
+	// Columns of the row before and after the change as JSON objects, only
+	// the changed ones for the updates
+	Before    string
+	After     string
+	CreatedAt time.Time
+}
+
+func (AuditTrailEntry) TableName() string {
+	return "audit_trail"
+}
+
+// Actor returns the user of the request, the subject of its bearer token or
+// the access key of its signature as set by the authentication middlewares,
+// see ctxkeys.NewActorContext, empty outside of a request.
+func Actor(ctx context.Context) string {
+	actor, _ := ctxkeys.ActorFromContext(ctx)
+	return actor
+}
+
+// Auditing is a gorm plugin, installed by NewGormWithOptions with
+// WithAuditing or WithAuditTrail, which sets the CreatedBy and UpdatedBy
+// columns of the Audited models to the Actor of the context. CreatedAt and
+// UpdatedAt are set by gorm. The changes of a single row of the designated
+// models are also recorded in the audit trail, in the transaction of the
+// change, with the correlation id of the request. As NewGormWithOptions skips
+// the default transaction of gorm, the plugin begins one for these changes
+// when they are not run in a transaction already, e.g. of Data.InTx.
+type Auditing struct {
+	trail map[reflect.Type]bool
+}
+
+// NewAuditing returns the plugin recording the changes of the trail models
+// in the audit trail.
+func NewAuditing(trail ...interface{}) *Auditing {
+	a := &Auditing{trail: map[reflect.Type]bool{}}
+	for _, model := range trail {
+		a.trail[reflect.Indirect(reflect.ValueOf(model)).Type()] = true
+	}
+	return a
+}
+
+func (a *Auditing) Name() string {
+	return "extn:auditing"
+}
+
+func (a *Auditing) Initialize(db *gorm.DB) error {
+	callbacks := []error{
+		db.Callback().Create().Before("gorm:create").Register("extn:auditing", a.beforeCreate),
+		db.Callback().Create().After("gorm:create").Register("extn:auditing_trail", a.afterCreate),
+		db.Callback().Update().Before("gorm:update").Register("extn:auditing", a.beforeUpdate),
+		db.Callback().Update().After("gorm:update").Register("extn:auditing_trail", a.afterUpdate),
+		db.Callback().Delete().Before("gorm:delete").Register("extn:auditing", a.beforeDelete),
+		db.Callback().Delete().After("gorm:delete").Register("extn:auditing_trail", a.afterDelete),
+	}
+	for _, err := range callbacks {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const (
+	auditingBefore = "extn:auditing_before"
+	auditingTx     = "extn:auditing_tx"
+)
+
+// begin starts a transaction for a trailed change which is not run in one, so
+// that the change and its audit trail entry are committed together. Beginning
+// fails with gorm.ErrInvalidTransaction in a transaction, which is then used.
+func (a *Auditing) begin(db *gorm.DB) {
+	if !a.trailedModel(db) {
+		return
+	}
+	if tx := db.Begin(); tx.Error == nil {
+		db.Statement.ConnPool = tx.Statement.ConnPool
+		db.InstanceSet(auditingTx, true)
+	} else if !errors.Is(tx.Error, gorm.ErrInvalidTransaction) {
+		_ = db.AddError(tx.Error)
+	}
+}
+
+// commit ends the transaction started by begin, rolling it back when the
+// change or its audit trail entry failed.
+func (a *Auditing) commit(db *gorm.DB) {
+	if started, _ := db.InstanceGet(auditingTx); started != true {
+		return
+	}
+	if db.Error != nil {
+		db.Rollback()
+	} else {
+		db.Commit()
+	}
+	db.Statement.ConnPool = db.ConnPool
+}
+
+func (a *Auditing) beforeCreate(db *gorm.DB) {
+	a.begin(db)
+	stmt := db.Statement
+	if stmt.Schema == nil || db.Error != nil {
+		return
+	}
+	actor := Actor(stmt.Context)
+	if actor == "" {
+		return
+	}
+	for _, name := range []string{"CreatedBy", "UpdatedBy"} {
+		field := stmt.Schema.LookUpField(name)
+		if field == nil {
+			continue
+		}
+		switch rv := stmt.ReflectValue; rv.Kind() {
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < rv.Len(); i++ {
+				_ = field.Set(stmt.Context, reflect.Indirect(rv.Index(i)), actor)
+			}
+		case reflect.Struct:
+			_ = field.Set(stmt.Context, rv, actor)
+		}
+	}
+}
+
+func (a *Auditing) afterCreate(db *gorm.DB) {
+	defer a.commit(db)
+	if pk, ok := a.trailed(db); ok {
+		a.record(db, "create", pk, nil, a.load(db, pk))
+	}
+}
+
+func (a *Auditing) beforeUpdate(db *gorm.DB) {
+	a.begin(db)
+	stmt := db.Statement
+	if stmt.Schema == nil || db.Error != nil {
+		return
+	}
+	if field := stmt.Schema.LookUpField("UpdatedBy"); field != nil {
+		if actor := Actor(stmt.Context); actor != "" {
+			stmt.SetColumn(field.DBName, actor)
+		}
+	}
+	if pk, ok := a.trailed(db); ok {
+		db.InstanceSet(auditingBefore, a.load(db, pk))
+	}
+}
+
+func (a *Auditing) afterUpdate(db *gorm.DB) {
+	defer a.commit(db)
+	pk, ok := a.trailed(db)
+	if !ok || db.RowsAffected == 0 {
+		return
+	}
+	before, _ := db.InstanceGet(auditingBefore)
+	beforeRow, _ := before.(map[string]interface{})
+	afterRow := a.load(db, pk)
+	for column, value := range afterRow {
+		if old, ok := beforeRow[column]; ok && reflect.DeepEqual(old, value) {
+			delete(beforeRow, column)
+			delete(afterRow, column)
+		}
+	}
+	a.record(db, "update", pk, beforeRow, afterRow)
+}
+
+func (a *Auditing) beforeDelete(db *gorm.DB) {
+	a.begin(db)
+	if pk, ok := a.trailed(db); ok {
+		db.InstanceSet(auditingBefore, a.load(db, pk))
+	}
+}
+
+func (a *Auditing) afterDelete(db *gorm.DB) {
+	defer a.commit(db)
+	pk, ok := a.trailed(db)
+	if !ok || db.RowsAffected == 0 {
+		return
+	}
+	before, _ := db.InstanceGet(auditingBefore)
+	beforeRow, _ := before.(map[string]interface{})
+	a.record(db, "delete", pk, beforeRow, nil)
+}
+
+// trailed returns the primary key of the row changed by the statement when
+// its model is designated for the audit trail and it changes a single row.
+func (a *Auditing) trailed(db *gorm.DB) (map[string]interface{}, bool) {
+	if !a.trailedModel(db) {
+		return nil, false
+	}
+	stmt := db.Statement
+	pk := make(map[string]interface{}, len(stmt.Schema.PrimaryFields))
+	for _, field := range stmt.Schema.PrimaryFields {
+		v, zero := field.ValueOf(stmt.Context, stmt.ReflectValue)
+		if zero {
+			return nil, false
+		}
+		pk[field.DBName] = v
+	}
+	return pk, len(pk) > 0
+}
+
+// trailedModel reports whether the statement changes a single row of a model
+// designated for the audit trail, whose primary key may not be known yet.
+func (a *Auditing) trailedModel(db *gorm.DB) bool {
+	stmt := db.Statement
+	return stmt.Schema != nil && db.Error == nil && a.trail[stmt.Schema.ModelType] && stmt.ReflectValue.Kind() == reflect.Struct
+}
+
+// load reads the row in the transaction of the statement, from the primary.
+func (a *Auditing) load(db *gorm.DB, pk map[string]interface{}) map[string]interface{} {
+	row := map[string]interface{}{}
+	tx := db.Session(&gorm.Session{NewDB: true, SkipHooks: true, Context: WithPrimary(db.Statement.Context)})
+	if err := tx.Table(db.Statement.Table).Where(pk).Take(&row).Error; err != nil {
+		return nil
+	}
+	return row
+}
+
+func (a *Auditing) record(db *gorm.DB, action string, pk, before, after map[string]interface{}) {
+	ctx := db.Statement.Context
+	correlationId, _ := ctxkeys.CorrelationIdFromContext(ctx)
+	entry := &AuditTrailEntry{
+		Id:            idgen.NewId(),
+		Table:         db.Statement.Table,
+		PrimaryKey:    primaryKeyString(pk),
+		Action:        action,
+		Actor:         Actor(ctx),
+		CorrelationId: correlationId,
+		Before:        jsonString(before),
+		After:         jsonString(after),
+	}
+	if err := db.Session(&gorm.Session{NewDB: true, SkipHooks: true}).Create(entry).Error; err != nil {
+		_ = db.AddError(fmt.Errorf("unable to record the audit trail: %w", err))
+	}
+}
+
+func primaryKeyString(pk map[string]interface{}) string {
+	if len(pk) == 1 {
+		for _, v := range pk {
+			return fmt.Sprint(v)
+		}
+	}
+	return jsonString(pk)
+}
+
+func jsonString(v map[string]interface{}) string {
+	if v == nil {
+		return ""
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
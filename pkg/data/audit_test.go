@@ -0,0 +1,85 @@
+package data_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/achuala/go-svc-extn/pkg/ctxkeys"
+	"github.com/achuala/go-svc-extn/pkg/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type auditedNote struct {
+	Id   int64
+	Text string
+	data.Audited
+}
+
+func TestAuditing(t *testing.T) {
+	db := openTestDB(t, []interface{}{&auditedNote{}}, data.WithAuditing())
+
+	alice := ctxkeys.NewActorContext(context.Background(), "alice")
+	note := &auditedNote{Text: "draft"}
+	require.NoError(t, db.WithContext(alice).Create(note).Error)
+	assert.Equal(t, "alice", note.CreatedBy)
+	assert.Equal(t, "alice", note.UpdatedBy)
+
+	bob := ctxkeys.NewActorContext(context.Background(), "bob")
+	require.NoError(t, db.WithContext(bob).Model(note).Update("text", "final").Error)
+	var stored auditedNote
+	require.NoError(t, db.First(&stored, note.Id).Error)
+	assert.Equal(t, "alice", stored.CreatedBy)
+	assert.Equal(t, "bob", stored.UpdatedBy)
+
+	// outside of a request the columns are left alone
+	require.NoError(t, db.Model(note).Update("text", "batch").Error)
+	require.NoError(t, db.First(&stored, note.Id).Error)
+	assert.Equal(t, "bob", stored.UpdatedBy)
+}
+
+func TestAuditTrail(t *testing.T) {
+	db := openTestDB(t, []interface{}{&auditedNote{}, &data.AuditTrailEntry{}}, data.WithAuditTrail(&auditedNote{}))
+	ctx := ctxkeys.NewCorrelationIdContext(ctxkeys.NewActorContext(context.Background(), "alice"), "c-1")
+
+	note := &auditedNote{Text: "draft"}
+	require.NoError(t, db.WithContext(ctx).Create(note).Error)
+	require.NoError(t, db.WithContext(ctx).Model(note).Update("text", "final").Error)
+	require.NoError(t, db.WithContext(ctx).Delete(note).Error)
+
+	var entries []data.AuditTrailEntry
+	require.NoError(t, db.Order("created_at, rowid").Find(&entries).Error)
+	require.Len(t, entries, 3)
+	for i, action := range []string{"create", "update", "delete"} {
+		assert.Equal(t, action, entries[i].Action)
+		assert.Equal(t, "audited_notes", entries[i].Table)
+		assert.Equal(t, "1", entries[i].PrimaryKey)
+		assert.Equal(t, "alice", entries[i].Actor)
+		assert.Equal(t, "c-1", entries[i].CorrelationId)
+	}
+	assert.Empty(t, entries[0].Before)
+	assert.Contains(t, entries[0].After, `"text":"draft"`)
+	assert.Equal(t, `{"text":"draft"}`, entries[1].Before)
+	assert.Equal(t, `{"text":"final"}`, entries[1].After)
+	assert.Contains(t, entries[2].Before, `"text":"final"`)
+	assert.Empty(t, entries[2].After)
+}
+
+func TestAuditTrailOutsideTx(t *testing.T) {
+	// the trail table is missing, recording the changes fails
+	db := openTestDB(t, []interface{}{&auditedNote{}}, data.WithAuditTrail(&auditedNote{}))
+	ctx := ctxkeys.NewActorContext(context.Background(), "alice")
+
+	note := &auditedNote{Text: "draft"}
+	assert.ErrorContains(t, db.WithContext(ctx).Create(note).Error, "unable to record the audit trail")
+	var count int64
+	require.NoError(t, db.Model(&auditedNote{}).Count(&count).Error)
+	assert.Zero(t, count, "the change was committed without its audit trail")
+
+	// and so is an update
+	require.NoError(t, db.Exec("INSERT INTO audited_notes (id, text) VALUES (1, 'draft')").Error)
+	assert.Error(t, db.WithContext(ctx).Model(&auditedNote{Id: 1}).Update("text", "final").Error)
+	var stored auditedNote
+	require.NoError(t, db.First(&stored, 1).Error)
+	assert.Equal(t, "draft", stored.Text)
+}
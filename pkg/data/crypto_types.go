@@ -0,0 +1,133 @@
+package data
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/achuala/go-svc-extn/pkg/crypto"
+)
+
+// ErrCryptoNotBound is returned by the EncryptedString and HashedString
+// columns before BindCrypto.
+var ErrCryptoNotBound = errors.New("crypto of the encrypted columns is not bound, call data.BindCrypto")
+
+// encryptedStringAD is the associated data of the EncryptedString values.
+var encryptedStringAD = []byte("data.EncryptedString")
+
+var boundCrypto atomic.Pointer[crypto.CryptoUtil]
+
+// BindCrypto sets the CryptoUtil of the EncryptedString and HashedString
+// columns of all the models, at startup before the first query.
+func BindCrypto(u *crypto.CryptoUtil) {
+	boundCrypto.Store(u)
+}
+
+func cryptoUtil() (*crypto.CryptoUtil, error) {
+	u := boundCrypto.Load()
+	if u == nil {
+		return nil, ErrCryptoNotBound
+	}
+	return u, nil
+}
+
+// EncryptedString is a string column stored encrypted. Unlike the
+// gormcrypto serializers the column is not part of the associated data, an
+// encrypted value can be copied to another EncryptedString column. Empty
+// values are stored empty.
+type EncryptedString string
+
+func (s EncryptedString) Value() (driver.Value, error) {
+	if s == "" {
+		return "", nil
+	}
+	u, err := cryptoUtil()
+	if err != nil {
+		return nil, err
+	}
+	return u.Encrypt(context.Background(), []byte(s), encryptedStringAD)
+}
+
+func (s *EncryptedString) Scan(value interface{}) error {
+	var cipherText string
+	switch v := value.(type) {
+	case nil:
+	case string:
+		cipherText = v
+	case []byte:
+		cipherText = string(v)
+	default:
+		return fmt.Errorf("failed to decrypt EncryptedString, unsupported value %T", value)
+	}
+	if cipherText == "" {
+		*s = ""
+		return nil
+	}
+	u, err := cryptoUtil()
+	if err != nil {
+		return err
+	}
+	plain, err := u.Decrypt(context.Background(), cipherText, encryptedStringAD)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt EncryptedString: %w", err)
+	}
+	*s = EncryptedString(plain)
+	return nil
+}
+
+// HashedString is a column storing the alias of a string, e.g. a password
+// or a document number which is only compared. Set Plain to write a new
+// value, the rows read have the Hash only.
+type HashedString struct {
+	Plain string
+	Hash  []byte
+}
+
+// NewHashedString returns the HashedString to write the plain value.
+func NewHashedString(plain string) HashedString {
+	return HashedString{Plain: plain}
+}
+
+// HashOf returns the alias of the plain value, e.g. to look up the rows
+// with the value.
+func HashOf(ctx context.Context, plain string) ([]byte, error) {
+	u, err := cryptoUtil()
+	if err != nil {
+		return nil, err
+	}
+	return u.CreateAlias(ctx, []byte(plain))
+}
+
+// Matches reports whether the stored hash is the alias of plain, with any
+// of the alias keys.
+func (h HashedString) Matches(ctx context.Context, plain string) (bool, error) {
+	u, err := cryptoUtil()
+	if err != nil {
+		return false, err
+	}
+	return u.CompareHash(ctx, []byte(plain), h.Hash)
+}
+
+func (h HashedString) Value() (driver.Value, error) {
+	if h.Plain == "" {
+		return h.Hash, nil
+	}
+	return HashOf(context.Background(), h.Plain)
+}
+
+func (h *HashedString) Scan(value interface{}) error {
+	h.Plain = ""
+	switch v := value.(type) {
+	case nil:
+		h.Hash = nil
+	case string:
+		h.Hash = []byte(v)
+	case []byte:
+		h.Hash = append([]byte(nil), v...)
+	default:
+		return fmt.Errorf("failed to scan HashedString, unsupported value %T", value)
+	}
+	return nil
+}
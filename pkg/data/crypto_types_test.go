@@ -0,0 +1,47 @@
+package data_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/achuala/go-svc-extn/pkg/crypto"
+	"github.com/achuala/go-svc-extn/pkg/crypto/encdec"
+	"github.com/achuala/go-svc-extn/pkg/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCryptoTypes(t *testing.T) {
+	ctx := context.Background()
+	kekUri, err := encdec.NewKeyURI()
+	require.NoError(t, err)
+	keySetData, err := encdec.NewKeyset(kekUri, nil)
+	require.NoError(t, err)
+	u, err := crypto.NewCryptoUtil(&crypto.CryptoConfig{KmsUri: kekUri, KeysetData: keySetData, HmacKey: "QWVzR2NtS2V5EhIaECT2tUhyiuLKsiUlTbWSZq"})
+	require.NoError(t, err)
+	data.BindCrypto(u)
+
+	stored, err := data.EncryptedString("bond@example.com").Value()
+	require.NoError(t, err)
+	assert.NotContains(t, stored, "bond")
+	var email data.EncryptedString
+	require.NoError(t, email.Scan(stored))
+	assert.Equal(t, data.EncryptedString("bond@example.com"), email)
+
+	stored, err = data.NewHashedString("secret").Value()
+	require.NoError(t, err)
+	var hashed data.HashedString
+	require.NoError(t, hashed.Scan(stored))
+	assert.Empty(t, hashed.Plain)
+	ok, err := hashed.Matches(ctx, "secret")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = hashed.Matches(ctx, "other")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// rows read are written back unchanged
+	again, err := hashed.Value()
+	require.NoError(t, err)
+	assert.Equal(t, stored, again)
+}
@@ -0,0 +1,74 @@
+package data
+
+import (
+	"fmt"
+	"sync"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// Dialects accepted by WithDialect. Postgres is built in, the drivers of the
+// others are registered by importing their package, e.g.
+//
+//	import _ "github.com/achuala/go-svc-extn/pkg/data/mysql"
+//
+// so that the services only depend on the drivers they use. The SQLite
+// driver needs cgo.
+const (
+	Postgres  = "postgres"
+	MySQL     = "mysql"
+	SQLite    = "sqlite"
+	SQLServer = "sqlserver"
+)
+
+// DialectorFunc returns the gorm dialector of a DSN, configured with the
+// options of the driver.
+type DialectorFunc func(dsn string) gorm.Dialector
+
+var (
+	dialectsMu sync.RWMutex
+	dialects   = map[string]DialectorFunc{
+		Postgres: postgres.Open,
+	}
+)
+
+// PostgresConfig holds the options of the Postgres driver.
+type PostgresConfig struct {
+	// PreferSimpleProtocol disables the prepared statements, e.g. behind
+	// PgBouncer in transaction pooling mode.
+	PreferSimpleProtocol bool
+	// WithoutReturning disables the RETURNING clause of the inserts.
+	WithoutReturning bool
+}
+
+// RegisterPostgres replaces the options of the built in Postgres driver.
+func RegisterPostgres(cfg PostgresConfig) {
+	RegisterDialect(Postgres, func(dsn string) gorm.Dialector {
+		return postgres.New(postgres.Config{DSN: dsn, PreferSimpleProtocol: cfg.PreferSimpleProtocol, WithoutReturning: cfg.WithoutReturning})
+	})
+}
+
+// RegisterDialect makes the driver of a dialect available to WithDialect, as
+// the driver packages do, e.g. for other drivers:
+//
+//	data.RegisterDialect("clickhouse", func(dsn string) gorm.Dialector {
+//		return clickhouse.Open(dsn)
+//	})
+//
+// It also replaces the configuration of the registered drivers.
+func RegisterDialect(name string, fn DialectorFunc) {
+	dialectsMu.Lock()
+	defer dialectsMu.Unlock()
+	dialects[name] = fn
+}
+
+func dialector(name, dsn string) (gorm.Dialector, error) {
+	dialectsMu.RLock()
+	defer dialectsMu.RUnlock()
+	fn, ok := dialects[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown database dialect %q, import its driver package", name)
+	}
+	return fn(dsn), nil
+}
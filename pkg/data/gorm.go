@@ -2,11 +2,14 @@ package data
 
 import (
 	"context"
+	"database/sql"
+	"io/fs"
 	"time"
 
 	"github.com/go-kratos/kratos/v2/log"
-	"gorm.io/driver/postgres"
+	"go.opentelemetry.io/otel/metric"
 	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 	"gorm.io/plugin/opentelemetry/tracing"
 )
 
@@ -23,10 +26,32 @@ type contextTxKey struct{}
 
 // Execute the database actions in a transaction
 func (d *Data) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
-	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+	return d.InTxWithOptions(ctx, TxOptions{}, fn)
+}
+
+// TxOptions sets the isolation level and access mode of a transaction, the
+// zero value selects the defaults of the database.
+type TxOptions struct {
+	ReadOnly  bool
+	Isolation sql.IsolationLevel
+}
+
+// InTxWithOptions executes the database actions in a transaction with the
+// options, e.g. sql.LevelRepeatableRead or a read only transaction.
+//
+// Within the transaction of ctx, the actions run in a nested transaction on
+// a savepoint of the ambient one, the options are ignored: a failure rolls
+// back the actions of the nested transaction only, the ambient transaction
+// continues and decides whether the actions of both are committed.
+func (d *Data) InTxWithOptions(ctx context.Context, opts TxOptions, fn func(ctx context.Context) error) error {
+	var txOpts *sql.TxOptions
+	if opts != (TxOptions{}) {
+		txOpts = &sql.TxOptions{ReadOnly: opts.ReadOnly, Isolation: opts.Isolation}
+	}
+	return d.DB(ctx).WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		ctx = context.WithValue(ctx, contextTxKey{}, tx)
 		return fn(ctx)
-	})
+	}, txOpts)
 }
 
 // DB Get the database connection
@@ -52,24 +77,212 @@ func NewData(db *gorm.DB, logger log.Logger) (*Data, func(), error) {
 	}, nil
 }
 
+// GormOption configures NewGormWithOptions.
+type GormOption func(*gormOptions)
+
+type gormOptions struct {
+	dialect           string
+	optimisticLocking bool
+	auditing          bool
+	auditTrail        []interface{}
+	migrations        fs.FS
+	tenancy           *Tenancy
+	logger            logger.Interface
+	queryTimeout      time.Duration
+	meter             metric.Meter
+	migrationOpts     []MigrationOption
+	replicaDSNs       []string
+	replicaPolicy     ReplicaPolicy
+}
+
+// WithDialect selects the driver of the databases, Postgres by default. The
+// drivers of the other dialects are registered by importing their package,
+// see MySQL. SQLite databases, e.g. in memory for the tests, use a single
+// connection.
+func WithDialect(dialect string) GormOption {
+	return func(o *gormOptions) {
+		o.dialect = dialect
+	}
+}
+
+// WithOptimisticLocking checks the Version of the models embedding it on
+// updates, see OptimisticLock.
+func WithOptimisticLocking() GormOption {
+	return func(o *gormOptions) {
+		o.optimisticLocking = true
+	}
+}
+
+// WithAuditing sets the CreatedBy and UpdatedBy columns of the models
+// embedding Audited, see Auditing.
+func WithAuditing() GormOption {
+	return func(o *gormOptions) {
+		o.auditing = true
+	}
+}
+
+// WithAuditTrail records the changes of the models in the audit trail, see
+// Auditing. It implies WithAuditing.
+func WithAuditTrail(models ...interface{}) GormOption {
+	return func(o *gormOptions) {
+		o.auditing = true
+		o.auditTrail = append(o.auditTrail, models...)
+	}
+}
+
+// WithMigrations applies the migrations of fsys, see Migrator, once
+// connected.
+func WithMigrations(fsys fs.FS, opts ...MigrationOption) GormOption {
+	return func(o *gormOptions) {
+		o.migrations = fsys
+		o.migrationOpts = append(o.migrationOpts, opts...)
+	}
+}
+
+// WithTenancy scopes the statements on the tenant models, see Tenancy.
+func WithTenancy(opts ...TenancyOption) GormOption {
+	return func(o *gormOptions) {
+		o.tenancy = NewTenancy(opts...)
+	}
+}
+
+// WithLogger logs the SQL statements with the logger, e.g. a GormLogger.
+func WithLogger(l logger.Interface) GormOption {
+	return func(o *gormOptions) {
+		o.logger = l
+	}
+}
+
+// WithDefaultQueryTimeout bounds the statements without deadline by timeout,
+// see QueryTimeout.
+func WithDefaultQueryTimeout(timeout time.Duration) GormOption {
+	return func(o *gormOptions) {
+		o.queryTimeout = timeout
+	}
+}
+
+// WithMeter records the metrics of the plugins, e.g. the statements
+// cancelled at the default query timeout.
+func WithMeter(meter metric.Meter) GormOption {
+	return func(o *gormOptions) {
+		o.meter = meter
+	}
+}
+
+// WithReplicas sends the reads outside of transactions to the replicas,
+// selected by policy. Use WithPrimary to read from the primary.
+func WithReplicas(policy ReplicaPolicy, dsns ...string) GormOption {
+	return func(o *gormOptions) {
+		o.replicaPolicy = policy
+		o.replicaDSNs = append(o.replicaDSNs, dsns...)
+	}
+}
+
 // NewDB gorm Connecting to a Database
 func NewGorm(dsn string) (*gorm.DB, error) {
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{SkipDefaultTransaction: true})
+	return NewGormWithOptions(dsn)
+}
+
+// NewGormWithOptions connects to the primary database and to its replicas.
+func NewGormWithOptions(dsn string, opts ...GormOption) (*gorm.DB, error) {
+	o := &gormOptions{dialect: Postgres}
+	for _, opt := range opts {
+		opt(o)
+	}
+	db, sqlDB, err := openGorm(o.dialect, dsn, o.logger)
 	if err != nil {
 		return nil, err
 	}
 	if err := db.Use(tracing.NewPlugin(tracing.WithoutMetrics())); err != nil {
+		_ = sqlDB.Close()
 		return nil, err
 	}
+	if o.optimisticLocking {
+		if err := db.Use(OptimisticLock{}); err != nil {
+			_ = sqlDB.Close()
+			return nil, err
+		}
+	}
+	if o.auditing {
+		if err := db.Use(NewAuditing(o.auditTrail...)); err != nil {
+			_ = sqlDB.Close()
+			return nil, err
+		}
+	}
+	if o.queryTimeout > 0 {
+		q, err := NewQueryTimeout(o.queryTimeout, o.meter)
+		if err == nil {
+			err = db.Use(q)
+		}
+		if err != nil {
+			_ = sqlDB.Close()
+			return nil, err
+		}
+	}
+	if o.tenancy != nil {
+		if err := db.Use(o.tenancy); err != nil {
+			_ = sqlDB.Close()
+			return nil, err
+		}
+	}
+	if o.migrations != nil {
+		if err := NewMigrator(db, o.migrations, o.migrationOpts...).Up(context.Background()); err != nil {
+			_ = sqlDB.Close()
+			return nil, err
+		}
+	}
+	if len(o.replicaDSNs) == 0 {
+		return db, nil
+	}
+	r := &replicas{policy: o.replicaPolicy}
+	closeAll := func() {
+		_ = sqlDB.Close()
+		for _, pool := range r.pools {
+			_ = pool.(*sql.DB).Close()
+		}
+	}
+	for _, replicaDSN := range o.replicaDSNs {
+		_, replicaDB, err := openGorm(o.dialect, replicaDSN, o.logger)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		r.pools = append(r.pools, replicaDB)
+	}
+	if err := db.Use(r); err != nil {
+		closeAll()
+		return nil, err
+	}
+	return db, nil
+}
+
+func openGorm(dialect, dsn string, l logger.Interface) (*gorm.DB, *sql.DB, error) {
+	d, err := dialector(dialect, dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+	db, err := gorm.Open(d, &gorm.Config{SkipDefaultTransaction: true, Logger: l})
+	if err != nil {
+		return nil, nil, err
+	}
 	sqlDB, err := db.DB()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	configurePool(sqlDB, dialect)
+	return db, sqlDB, nil
+}
+
+func configurePool(sqlDB *sql.DB, dialect string) {
+	if dialect == SQLite {
+		// every connection to an in memory database opens a new database
+		sqlDB.SetMaxOpenConns(1)
+		return
 	}
 	sqlDB.SetMaxIdleConns(1)
 	sqlDB.SetMaxOpenConns(10)
 	sqlDB.SetConnMaxIdleTime(5 * time.Minute)
 	sqlDB.SetConnMaxLifetime(8 * time.Hour)
-	return db, nil
 }
 
 // Paginate Pagination
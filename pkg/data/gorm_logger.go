@@ -0,0 +1,161 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// ParamsMode selects how GormLogger logs the bound parameters of the SQL
+// statements, which may hold personal data, e.g. in WHERE clauses.
+type ParamsMode int
+
+const (
+	// ParamsKeep logs the statements with their parameters
+	ParamsKeep ParamsMode = iota
+	// ParamsStrip logs the statements with their placeholders
+	ParamsStrip
+	// ParamsHash logs the statements with a hash of each parameter, the
+	// same value has the same hash
+	ParamsHash
+)
+
+type contextSQLLoggingKey struct{}
+
+// WithSQLLogging returns a context whose SQL statements are all logged at
+// info level when enabled, or none of them when not, whatever the level of
+// the GormLogger, e.g. to trace the statements of a single request.
+func WithSQLLogging(ctx context.Context, enabled bool) context.Context {
+	return context.WithValue(ctx, contextSQLLoggingKey{}, enabled)
+}
+
+// GormLogger is a gorm logger writing to a Kratos logger.
+type GormLogger struct {
+	logger        log.Logger
+	level         logger.LogLevel
+	slowThreshold time.Duration
+	params        ParamsMode
+}
+
+// GormLoggerOption configures the GormLogger.
+type GormLoggerOption func(*GormLogger)
+
+// WithSlowThreshold logs the statements taking longer than d at warn level,
+// 200ms by default, 0 disables it.
+func WithSlowThreshold(d time.Duration) GormLoggerOption {
+	return func(l *GormLogger) {
+		l.slowThreshold = d
+	}
+}
+
+// WithParamsMode sets how the parameters of the statements are logged,
+// ParamsKeep by default.
+func WithParamsMode(mode ParamsMode) GormLoggerOption {
+	return func(l *GormLogger) {
+		l.params = mode
+	}
+}
+
+// WithLogLevel sets the level of the logged statements, logger.Warn by
+// default: the slow statements and the errors.
+func WithLogLevel(level logger.LogLevel) GormLoggerOption {
+	return func(l *GormLogger) {
+		l.level = level
+	}
+}
+
+// NewGormLogger .
+func NewGormLogger(l log.Logger, opts ...GormLoggerOption) *GormLogger {
+	gl := &GormLogger{logger: l, level: logger.Warn, slowThreshold: 200 * time.Millisecond}
+	for _, opt := range opts {
+		opt(gl)
+	}
+	return gl
+}
+
+func (l *GormLogger) LogMode(level logger.LogLevel) logger.Interface {
+	clone := *l
+	clone.level = level
+	return &clone
+}
+
+func (l *GormLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= logger.Info {
+		l.log(ctx, log.LevelInfo, msg, data...)
+	}
+}
+
+func (l *GormLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= logger.Warn {
+		l.log(ctx, log.LevelWarn, msg, data...)
+	}
+}
+
+func (l *GormLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= logger.Error {
+		l.log(ctx, log.LevelError, msg, data...)
+	}
+}
+
+// log formats the message with its arguments, as gorm passes printf style
+// arguments.
+func (l *GormLogger) log(ctx context.Context, level log.Level, msg string, data ...interface{}) {
+	_ = log.WithContext(ctx, l.logger).Log(level, "msg", fmt.Sprintf(msg, data...))
+}
+
+func (l *GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	enabled, forced := ctx.Value(contextSQLLoggingKey{}).(bool)
+	if forced && !enabled || !forced && l.level <= logger.Silent {
+		return
+	}
+	elapsed := time.Since(begin)
+	slow := l.slowThreshold > 0 && elapsed > l.slowThreshold
+	var level log.Level
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound) && (forced || l.level >= logger.Error):
+		level = log.LevelError
+	case slow && (forced || l.level >= logger.Warn):
+		level = log.LevelWarn
+	case forced || l.level >= logger.Info:
+		level = log.LevelInfo
+	default:
+		return
+	}
+	sql, rows := fc()
+	keyvals := []interface{}{
+		"sql", sql,
+		"rows", rows,
+		"latency", elapsed.Seconds(),
+	}
+	if err != nil {
+		keyvals = append(keyvals, "error", err.Error())
+	}
+	if slow {
+		keyvals = append(keyvals, "slow_query", true)
+	}
+	_ = log.WithContext(ctx, l.logger).Log(level, keyvals...)
+}
+
+// ParamsFilter implements gorm.ParamsFilter, it strips or hashes
+// the parameters of the logged statements.
+func (l *GormLogger) ParamsFilter(_ context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	switch l.params {
+	case ParamsStrip:
+		return sql, nil
+	case ParamsHash:
+		hashed := make([]interface{}, len(params))
+		for i, param := range params {
+			sum := sha256.Sum256([]byte(fmt.Sprint(param)))
+			hashed[i] = "h:" + hex.EncodeToString(sum[:8])
+		}
+		return sql, hashed
+	}
+	return sql, params
+}
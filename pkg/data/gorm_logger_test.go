@@ -0,0 +1,138 @@
+package data_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/achuala/go-svc-extn/pkg/data"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type sqlEntry struct {
+	level   log.Level
+	keyvals map[interface{}]interface{}
+}
+
+type sqlLog struct {
+	entries []sqlEntry
+}
+
+func (l *sqlLog) Log(level log.Level, keyvals ...interface{}) error {
+	entry := sqlEntry{level: level, keyvals: map[interface{}]interface{}{}}
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		entry.keyvals[keyvals[i]] = keyvals[i+1]
+	}
+	l.entries = append(l.entries, entry)
+	return nil
+}
+
+func (l *sqlLog) levels() []log.Level {
+	var levels []log.Level
+	for _, entry := range l.entries {
+		levels = append(levels, entry.level)
+	}
+	return levels
+}
+
+// openLoggedDB opens a test database logging its statements to the
+// returned log, left empty of the migration statements.
+func openLoggedDB(t *testing.T, opts ...data.GormLoggerOption) (*gorm.DB, *sqlLog) {
+	rec := &sqlLog{}
+	db := openTestDB(t, []interface{}{&txItem{}}, data.WithLogger(data.NewGormLogger(rec, opts...)))
+	require.NoError(t, db.Create(&txItem{Id: 1, Name: "alice"}).Error)
+	rec.entries = nil
+	return db, rec
+}
+
+func TestGormLoggerLevels(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  context.Context
+		opts []data.GormLoggerOption
+		want []log.Level
+	}{
+		{name: "silent", opts: []data.GormLoggerOption{data.WithLogLevel(logger.Silent)}},
+		{name: "error", opts: []data.GormLoggerOption{data.WithLogLevel(logger.Error)}, want: []log.Level{log.LevelError}},
+		{name: "default", want: []log.Level{log.LevelError}},
+		{name: "info", opts: []data.GormLoggerOption{data.WithLogLevel(logger.Info)}, want: []log.Level{log.LevelInfo, log.LevelInfo, log.LevelError}},
+		{name: "slow", opts: []data.GormLoggerOption{data.WithSlowThreshold(time.Nanosecond)}, want: []log.Level{log.LevelWarn, log.LevelWarn, log.LevelError}},
+		{name: "slow at error level", opts: []data.GormLoggerOption{data.WithLogLevel(logger.Error), data.WithSlowThreshold(time.Nanosecond)}, want: []log.Level{log.LevelError}},
+		{name: "forced", ctx: data.WithSQLLogging(context.Background(), true), opts: []data.GormLoggerOption{data.WithLogLevel(logger.Silent)}, want: []log.Level{log.LevelInfo, log.LevelInfo, log.LevelError}},
+		{name: "disabled", ctx: data.WithSQLLogging(context.Background(), false), opts: []data.GormLoggerOption{data.WithLogLevel(logger.Info)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := tt.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			db, rec := openLoggedDB(t, tt.opts...)
+			db = db.WithContext(ctx)
+			require.NoError(t, db.First(&txItem{}, 1).Error)
+			assert.ErrorIs(t, db.First(&txItem{}, 2).Error, gorm.ErrRecordNotFound)
+			assert.Error(t, db.Exec("SELECT * FROM missing_items").Error)
+			assert.Equal(t, tt.want, rec.levels())
+		})
+	}
+}
+
+func TestGormLoggerTrace(t *testing.T) {
+	db, rec := openLoggedDB(t, data.WithLogLevel(logger.Info), data.WithSlowThreshold(time.Nanosecond))
+	require.NoError(t, db.Model(&txItem{}).Where("id = ?", 1).Update("name", "bob").Error)
+	assert.Error(t, db.Exec("SELECT * FROM missing_items").Error)
+
+	require.Len(t, rec.entries, 2)
+	updated := rec.entries[0].keyvals
+	assert.Equal(t, "UPDATE `tx_items` SET `name`=\"bob\" WHERE id = 1", updated["sql"])
+	assert.Equal(t, int64(1), updated["rows"])
+	assert.Equal(t, true, updated["slow_query"])
+	assert.NotContains(t, updated, "error")
+	failed := rec.entries[1].keyvals
+	assert.Equal(t, "SELECT * FROM missing_items", failed["sql"])
+	assert.Contains(t, failed["error"], "no such table")
+}
+
+func TestGormLoggerParams(t *testing.T) {
+	sum := sha256.Sum256([]byte("alice"))
+	tests := []struct {
+		name string
+		mode data.ParamsMode
+		want string
+	}{
+		{name: "keep", mode: data.ParamsKeep, want: `name = "alice"`},
+		{name: "strip", mode: data.ParamsStrip, want: "name = ?"},
+		{name: "hash", mode: data.ParamsHash, want: `name = "h:` + hex.EncodeToString(sum[:8]) + `"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, rec := openLoggedDB(t, data.WithLogLevel(logger.Info), data.WithParamsMode(tt.mode))
+			var items []txItem
+			require.NoError(t, db.Where("name = ?", "alice").Find(&items).Error)
+			require.Len(t, rec.entries, 1)
+			assert.Contains(t, rec.entries[0].keyvals["sql"], tt.want)
+		})
+	}
+}
+
+func TestGormLoggerMessages(t *testing.T) {
+	ctx := context.Background()
+	rec := &sqlLog{}
+	l := data.NewGormLogger(rec)
+	l.Info(ctx, "%d statements", 3)
+	l.Warn(ctx, "%d slow statements", 2)
+	l.Error(ctx, "%d failed statements", 1)
+	require.Equal(t, []log.Level{log.LevelWarn, log.LevelError}, rec.levels())
+	assert.Equal(t, "2 slow statements", rec.entries[0].keyvals["msg"])
+
+	rec.entries = nil
+	l.LogMode(logger.Info).Info(ctx, "%d statements", 3)
+	l.Info(ctx, "%d statements", 3)
+	assert.Equal(t, []log.Level{log.LevelInfo}, rec.levels(), "LogMode changed the level of the logger")
+}
@@ -0,0 +1,120 @@
+package data_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/achuala/go-svc-extn/pkg/data"
+	_ "github.com/achuala/go-svc-extn/pkg/data/sqlite"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type txItem struct {
+	Id   int64
+	Name string
+}
+
+func newTestData(t *testing.T) *data.Data {
+	db, err := data.NewGormWithOptions("file::memory:", data.WithDialect(data.SQLite))
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&txItem{}))
+	d, cleanup, err := data.NewData(db, log.DefaultLogger)
+	require.NoError(t, err)
+	t.Cleanup(cleanup)
+	return d
+}
+
+// openTestDB opens a sqlite database in a temporary file with opts and
+// migrates the models.
+func openTestDB(t *testing.T, models []interface{}, opts ...data.GormOption) *gorm.DB {
+	opts = append([]data.GormOption{data.WithDialect(data.SQLite)}, opts...)
+	db, err := data.NewGormWithOptions(filepath.Join(t.TempDir(), "test.db"), opts...)
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(models...))
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func itemNames(t *testing.T, d *data.Data) []string {
+	var names []string
+	require.NoError(t, d.DB(context.Background()).Model(&txItem{}).Order("id").Pluck("name", &names).Error)
+	return names
+}
+
+func TestInTxNested(t *testing.T) {
+	ctx := context.Background()
+	d := newTestData(t)
+
+	// a failed nested transaction rolls back to its savepoint only
+	err := d.InTx(ctx, func(ctx context.Context) error {
+		require.NoError(t, d.DB(ctx).Create(&txItem{Name: "outer"}).Error)
+		err := d.InTx(ctx, func(ctx context.Context) error {
+			require.NoError(t, d.DB(ctx).Create(&txItem{Name: "inner"}).Error)
+			return errors.New("inner failed")
+		})
+		assert.EqualError(t, err, "inner failed")
+		return d.InTx(ctx, func(ctx context.Context) error {
+			return d.DB(ctx).Create(&txItem{Name: "second"}).Error
+		})
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"outer", "second"}, itemNames(t, d))
+
+	// a failed ambient transaction rolls back the committed nested ones
+	err = d.InTx(ctx, func(ctx context.Context) error {
+		require.NoError(t, d.InTx(ctx, func(ctx context.Context) error {
+			return d.DB(ctx).Create(&txItem{Name: "nested"}).Error
+		}))
+		return errors.New("outer failed")
+	})
+	assert.EqualError(t, err, "outer failed")
+	assert.Equal(t, []string{"outer", "second"}, itemNames(t, d))
+}
+
+// txOptionsPool records the options of the transactions begun on the pool.
+type txOptionsPool struct {
+	*sql.DB
+	opts []*sql.TxOptions
+}
+
+func (p *txOptionsPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	p.opts = append(p.opts, opts)
+	return p.DB.BeginTx(ctx, opts)
+}
+
+func TestInTxWithOptions(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t, []interface{}{&txItem{}})
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	pool := &txOptionsPool{DB: sqlDB}
+	db.ConnPool, db.Statement.ConnPool = pool, pool
+	d, _, err := data.NewData(db, log.DefaultLogger)
+	require.NoError(t, err)
+
+	require.NoError(t, d.InTx(ctx, func(ctx context.Context) error {
+		return d.DB(ctx).Create(&txItem{Name: "default"}).Error
+	}))
+	require.Equal(t, []*sql.TxOptions{nil}, pool.opts, "the defaults of the database were not selected")
+
+	// the options of a nested transaction are ignored, it runs on a savepoint
+	pool.opts = nil
+	opts := data.TxOptions{ReadOnly: true, Isolation: sql.LevelSerializable}
+	require.NoError(t, d.InTxWithOptions(ctx, opts, func(ctx context.Context) error {
+		return d.InTxWithOptions(ctx, data.TxOptions{Isolation: sql.LevelReadCommitted}, func(ctx context.Context) error {
+			var items []txItem
+			return d.DB(ctx).Find(&items).Error
+		})
+	}))
+	assert.Equal(t, []*sql.TxOptions{{ReadOnly: true, Isolation: sql.LevelSerializable}}, pool.opts)
+}
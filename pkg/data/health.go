@@ -0,0 +1,99 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"gorm.io/gorm"
+)
+
+// healthTimeout bounds the pings of Health without deadline.
+const healthTimeout = 2 * time.Second
+
+// Health pings the database, within 2 seconds unless ctx has a deadline.
+func (d *Data) Health(ctx context.Context) error {
+	sqlDB, err := d.db.DB()
+	if err != nil {
+		return err
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, healthTimeout)
+		defer cancel()
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// RegisterPoolMetrics publishes the statistics of the connection pools of db,
+// the primary and the replicas, labeled by name and role:
+//
+//   - db.pool.connections.max, the maximum number of open connections
+//   - db.pool.connections.open, the number of open connections
+//   - db.pool.connections.in_use, the number of connections in use
+//   - db.pool.connections.idle, the number of idle connections
+//   - db.pool.wait.count, the number of waits for a connection
+//   - db.pool.wait.duration, the total time waited for a connection in seconds
+//
+// The statistics are read at every collection of the meter provider.
+func RegisterPoolMetrics(db *gorm.DB, meter metric.Meter, name string) (metric.Registration, error) {
+	maxOpen, err := meter.Int64ObservableGauge("db.pool.connections.max",
+		metric.WithDescription("Maximum number of open connections by pool and role"))
+	if err != nil {
+		return nil, err
+	}
+	open, err := meter.Int64ObservableGauge("db.pool.connections.open",
+		metric.WithDescription("Number of open connections by pool and role"))
+	if err != nil {
+		return nil, err
+	}
+	inUse, err := meter.Int64ObservableGauge("db.pool.connections.in_use",
+		metric.WithDescription("Number of connections in use by pool and role"))
+	if err != nil {
+		return nil, err
+	}
+	idle, err := meter.Int64ObservableGauge("db.pool.connections.idle",
+		metric.WithDescription("Number of idle connections by pool and role"))
+	if err != nil {
+		return nil, err
+	}
+	waitCount, err := meter.Int64ObservableCounter("db.pool.wait.count",
+		metric.WithDescription("Number of waits for a connection by pool and role"))
+	if err != nil {
+		return nil, err
+	}
+	waitDuration, err := meter.Float64ObservableCounter("db.pool.wait.duration", metric.WithUnit("s"),
+		metric.WithDescription("Total time waited for a connection by pool and role"))
+	if err != nil {
+		return nil, err
+	}
+
+	primary, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	pools := map[string]*sql.DB{"primary": primary}
+	if r, ok := db.Config.Plugins[(&replicas{}).Name()].(*replicas); ok {
+		for i, pool := range r.pools {
+			if sqlDB, ok := pool.(*sql.DB); ok {
+				pools["replica-"+strconv.Itoa(i)] = sqlDB
+			}
+		}
+	}
+	return meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		for role, pool := range pools {
+			stats := pool.Stats()
+			attrs := metric.WithAttributes(attribute.String("pool", name), attribute.String("role", role))
+			o.ObserveInt64(maxOpen, int64(stats.MaxOpenConnections), attrs)
+			o.ObserveInt64(open, int64(stats.OpenConnections), attrs)
+			o.ObserveInt64(inUse, int64(stats.InUse), attrs)
+			o.ObserveInt64(idle, int64(stats.Idle), attrs)
+			o.ObserveInt64(waitCount, stats.WaitCount, attrs)
+			o.ObserveFloat64(waitDuration, stats.WaitDuration.Seconds(), attrs)
+		}
+		return nil
+	}, maxOpen, open, inUse, idle, waitCount, waitDuration)
+}
@@ -0,0 +1,79 @@
+package data_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/achuala/go-svc-extn/pkg/data"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestHealth(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t, []interface{}{&txItem{}})
+	d, _, err := data.NewData(db, log.DefaultLogger)
+	require.NoError(t, err)
+	require.NoError(t, d.Health(ctx))
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.ErrorIs(t, d.Health(cancelled), context.Canceled)
+
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	require.NoError(t, sqlDB.Close())
+	assert.Error(t, d.Health(ctx))
+}
+
+// collectedGauges returns the values of the gauges by name and attributes.
+func collectedGauges(t *testing.T, reader sdkmetric.Reader) map[string]map[string]int64 {
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	gauges := map[string]map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if gauge, ok := m.Data.(metricdata.Gauge[int64]); ok {
+				values := map[string]int64{}
+				for _, dp := range gauge.DataPoints {
+					values[dp.Attributes.Encoded(attribute.DefaultEncoder())] = dp.Value
+				}
+				gauges[m.Name] = values
+			}
+		}
+	}
+	return gauges
+}
+
+func TestRegisterPoolMetrics(t *testing.T) {
+	ctx := context.Background()
+	db := openDBAt(t, seedDB(t, "primary"), data.WithReplicas(data.RoundRobin, seedDB(t, "replica")))
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	reg, err := data.RegisterPoolMetrics(db, provider.Meter("test"), "orders")
+	require.NoError(t, err)
+
+	const primary, replica = "pool=orders,role=primary", "pool=orders,role=replica-0"
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	conn, err := sqlDB.Conn(ctx)
+	require.NoError(t, err)
+	gauges := collectedGauges(t, reader)
+	assert.Equal(t, int64(1), gauges["db.pool.connections.max"][primary])
+	assert.Equal(t, int64(1), gauges["db.pool.connections.in_use"][primary])
+	assert.Equal(t, int64(0), gauges["db.pool.connections.idle"][primary])
+	assert.Contains(t, gauges["db.pool.connections.open"], replica)
+
+	require.NoError(t, conn.Close())
+	gauges = collectedGauges(t, reader)
+	assert.Equal(t, int64(0), gauges["db.pool.connections.in_use"][primary])
+	assert.Equal(t, int64(1), gauges["db.pool.connections.idle"][primary])
+
+	// the statistics are no longer read once unregistered
+	require.NoError(t, reg.Unregister())
+	assert.Empty(t, collectedGauges(t, reader)["db.pool.connections.max"])
+}
@@ -0,0 +1,78 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrNotInTransaction is returned by the locking helpers outside of InTx, the
+// locks are released at the end of the transaction.
+var ErrNotInTransaction = errors.New("row locks require a transaction, use InTx")
+
+// ErrAdvisoryLockUnsupported is returned by AdvisoryLock on the databases
+// without transaction level advisory locks.
+var ErrAdvisoryLockUnsupported = errors.New("advisory locks are not supported by the database")
+
+// LockForUpdate reads the rows matching conds into dest, a model or a slice
+// of models, with SELECT ... FOR UPDATE, blocking until the rows locked by
+// other transactions are released. It fails with gorm.ErrRecordNotFound
+// when dest is a model and no row matches.
+func LockForUpdate(ctx context.Context, d *Data, dest interface{}, conds ...interface{}) error {
+	return lockForUpdate(ctx, d, "", dest, conds...)
+}
+
+// LockForUpdateNoWait is LockForUpdate failing at once when a row is locked
+// by another transaction.
+func LockForUpdateNoWait(ctx context.Context, d *Data, dest interface{}, conds ...interface{}) error {
+	return lockForUpdate(ctx, d, "NOWAIT", dest, conds...)
+}
+
+// LockForUpdateSkipLocked is LockForUpdate skipping the rows locked by other
+// transactions, e.g. to share a queue table between workers.
+func LockForUpdateSkipLocked(ctx context.Context, d *Data, dest interface{}, conds ...interface{}) error {
+	return lockForUpdate(ctx, d, "SKIP LOCKED", dest, conds...)
+}
+
+func lockForUpdate(ctx context.Context, d *Data, options string, dest interface{}, conds ...interface{}) error {
+	if _, ok := ctx.Value(contextTxKey{}).(*gorm.DB); !ok {
+		return ErrNotInTransaction
+	}
+	result := d.DB(ctx).WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE", Options: options}).
+		Find(dest, conds...)
+	if result.Error != nil {
+		return result.Error
+	}
+	if kind := reflect.Indirect(reflect.ValueOf(dest)).Kind(); kind != reflect.Slice && kind != reflect.Array && result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// AdvisoryLock runs fn in a transaction, see InTx, holding the Postgres
+// advisory lock of key until the transaction ends, so that the workflows on
+// the same key are serialized with respect to the database transactions.
+// SQLite runs fn in a transaction without lock, its writes are serialized,
+// other databases fail with ErrAdvisoryLockUnsupported.
+func (d *Data) AdvisoryLock(ctx context.Context, key string, fn func(ctx context.Context) error) error {
+	return d.InTx(ctx, func(ctx context.Context) error {
+		db := d.DB(ctx).WithContext(ctx)
+		switch db.Dialector.Name() {
+		case Postgres:
+			h := fnv.New64a()
+			_, _ = h.Write([]byte(key))
+			if err := db.Exec("SELECT pg_advisory_xact_lock(?)", int64(h.Sum64())).Error; err != nil {
+				return err
+			}
+		case SQLite:
+		default:
+			return ErrAdvisoryLockUnsupported
+		}
+		return fn(ctx)
+	})
+}
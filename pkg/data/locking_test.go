@@ -0,0 +1,135 @@
+package data_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/achuala/go-svc-extn/pkg/data"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type lockedItem struct {
+	Id   int64
+	Name string
+}
+
+// recordLocking records the locking clauses of the queries, which SQLite
+// leaves out of the SQL.
+func recordLocking(t *testing.T, db *gorm.DB) *[]clause.Locking {
+	var locks []clause.Locking
+	require.NoError(t, db.Callback().Query().Before("gorm:query").Register("test:locking", func(db *gorm.DB) {
+		if c, ok := db.Statement.Clauses["FOR"]; ok {
+			locks = append(locks, c.Expression.(clause.Locking))
+		}
+	}))
+	return &locks
+}
+
+func TestLockForUpdate(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t, []interface{}{&lockedItem{}})
+	require.NoError(t, db.Create([]*lockedItem{{Id: 1, Name: "a"}, {Id: 2, Name: "b"}}).Error)
+	locks := recordLocking(t, db)
+	d, cleanup, err := data.NewData(db, log.DefaultLogger)
+	require.NoError(t, err)
+	defer cleanup()
+
+	tests := []struct {
+		name    string
+		lock    func(ctx context.Context, d *data.Data, dest interface{}, conds ...interface{}) error
+		options string
+	}{
+		{name: "wait", lock: data.LockForUpdate},
+		{name: "no wait", lock: data.LockForUpdateNoWait, options: clause.LockingOptionsNoWait},
+		{name: "skip locked", lock: data.LockForUpdateSkipLocked, options: clause.LockingOptionsSkipLocked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*locks = nil
+			var item lockedItem
+			assert.ErrorIs(t, tt.lock(ctx, d, &item, "id = ?", 1), data.ErrNotInTransaction)
+
+			err := d.InTx(ctx, func(ctx context.Context) error {
+				require.NoError(t, tt.lock(ctx, d, &item, "id = ?", 1))
+				assert.Equal(t, "a", item.Name)
+
+				var items []lockedItem
+				require.NoError(t, tt.lock(ctx, d, &items, "id > ?", 0))
+				assert.Len(t, items, 2)
+
+				// no row is not found for a model only
+				require.NoError(t, tt.lock(ctx, d, &items, "id > ?", 2))
+				assert.Empty(t, items)
+				return tt.lock(ctx, d, &lockedItem{}, "id = ?", 3)
+			})
+			assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+			want := clause.Locking{Strength: clause.LockingStrengthUpdate, Options: tt.options}
+			assert.Equal(t, []clause.Locking{want, want, want, want}, *locks)
+		})
+	}
+}
+
+func TestAdvisoryLock(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t, []interface{}{&lockedItem{}})
+	d, cleanup, err := data.NewData(db, log.DefaultLogger)
+	require.NoError(t, err)
+	defer cleanup()
+
+	// SQLite runs fn in a transaction
+	err = d.AdvisoryLock(ctx, "order-1", func(ctx context.Context) error {
+		require.NoError(t, d.DB(ctx).Create(&lockedItem{Id: 1, Name: "a"}).Error)
+		require.NoError(t, data.LockForUpdate(ctx, d, &lockedItem{}, "id = ?", 1))
+		return errors.New("failed")
+	})
+	assert.EqualError(t, err, "failed")
+	var n int64
+	require.NoError(t, db.Model(&lockedItem{}).Count(&n).Error)
+	assert.Zero(t, n, "the writes of the failed workflow were committed")
+
+	require.NoError(t, d.AdvisoryLock(ctx, "order-1", func(ctx context.Context) error {
+		return d.DB(ctx).Create(&lockedItem{Id: 1, Name: "a"}).Error
+	}))
+	require.NoError(t, db.Model(&lockedItem{}).Count(&n).Error)
+	assert.Equal(t, int64(1), n)
+}
+
+// otherDialector is a database without advisory locks.
+type otherDialector struct {
+	gorm.Dialector
+}
+
+func (otherDialector) Name() string {
+	return "other"
+}
+
+func TestAdvisoryLockUnsupported(t *testing.T) {
+	data.RegisterDialect("other", func(dsn string) gorm.Dialector {
+		return otherDialector{sqlite.Open(dsn)}
+	})
+	db, err := data.NewGormWithOptions(filepath.Join(t.TempDir(), "other.db"), data.WithDialect("other"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	d, cleanup, err := data.NewData(db, log.DefaultLogger)
+	require.NoError(t, err)
+	defer cleanup()
+
+	called := false
+	err = d.AdvisoryLock(context.Background(), "order-1", func(ctx context.Context) error {
+		called = true
+		return nil
+	})
+	assert.ErrorIs(t, err, data.ErrAdvisoryLockUnsupported)
+	assert.False(t, called)
+}
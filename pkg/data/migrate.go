@@ -0,0 +1,232 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"gorm.io/gorm"
+)
+
+// Migration is a schema change read from the files <version>_<name>.up.sql
+// and <version>_<name>.down.sql, e.g. 0001_create_users.up.sql.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationOption configures the Migrator.
+type MigrationOption func(*Migrator)
+
+// WithMigrationsTable sets the table recording the applied migrations,
+// schema_migrations by default.
+func WithMigrationsTable(table string) MigrationOption {
+	return func(m *Migrator) {
+		m.table = table
+	}
+}
+
+// WithMigrationsDryRun logs the migrations which would be applied or
+// reverted instead of running them.
+func WithMigrationsDryRun() MigrationOption {
+	return func(m *Migrator) {
+		m.dryRun = true
+	}
+}
+
+// migrationsLockId is the key of the Postgres advisory lock of the
+// migrations.
+const migrationsLockId = 7244310795
+
+// Migrator applies the SQL migrations of a file system, e.g. an embed.FS, in
+// the order of their versions. Each migration runs in a transaction with the
+// record of its version. On Postgres the migrations hold an advisory lock so
+// that the instances of a service starting together do not race.
+type Migrator struct {
+	db     *gorm.DB
+	fsys   fs.FS
+	table  string
+	dryRun bool
+}
+
+// NewMigrator .
+func NewMigrator(db *gorm.DB, fsys fs.FS, opts ...MigrationOption) *Migrator {
+	m := &Migrator{db: db, fsys: fsys, table: "schema_migrations"}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Migrations returns the migrations at the root of the file system, see
+// fs.Sub, ordered by version. Two migrations with the same version, e.g.
+// 0002_a.up.sql and 0002_b.up.sql, fail.
+func (m *Migrator) Migrations() ([]*Migration, error) {
+	files, err := fs.Glob(m.fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int64]*Migration{}
+	// the files of each version by direction
+	seen := map[int64]map[string]string{}
+	for _, file := range files {
+		name, direction, ok := strings.Cut(strings.TrimSuffix(path.Base(file), ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migration %s is not named <version>_<name>.up.sql or .down.sql", file)
+		}
+		versionText, name, _ := strings.Cut(name, "_")
+		version, err := strconv.ParseInt(versionText, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s has no version: %w", file, err)
+		}
+		if seen[version] == nil {
+			seen[version] = map[string]string{}
+		}
+		for otherDirection, other := range seen[version] {
+			if otherDirection == direction || byVersion[version].Name != name {
+				return nil, fmt.Errorf("migrations %s and %s have the same version %d", other, file, version)
+			}
+		}
+		seen[version][direction] = file
+		content, err := fs.ReadFile(m.fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		}
+		if direction == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %d has no up file", migration.Version)
+		}
+		migrations = append(migrations, migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Up applies the migrations which were not applied yet.
+func (m *Migrator) Up(ctx context.Context) error {
+	migrations, err := m.Migrations()
+	if err != nil {
+		return err
+	}
+	return m.locked(ctx, func(db *gorm.DB) error {
+		applied, err := m.applied(db)
+		if err != nil {
+			return err
+		}
+		for _, migration := range migrations {
+			if applied[migration.Version] {
+				continue
+			}
+			if err := m.run(db, migration, migration.Up, func(tx *gorm.DB) error {
+				return tx.Exec("INSERT INTO "+m.table+" (version, name, applied_at) VALUES (?, ?, ?)",
+					migration.Version, migration.Name, time.Now()).Error
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Down reverts the last steps applied migrations.
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	migrations, err := m.Migrations()
+	if err != nil {
+		return err
+	}
+	return m.locked(ctx, func(db *gorm.DB) error {
+		applied, err := m.applied(db)
+		if err != nil {
+			return err
+		}
+		for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+			migration := migrations[i]
+			if !applied[migration.Version] {
+				continue
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("migration %d has no down file", migration.Version)
+			}
+			if err := m.run(db, migration, migration.Down, func(tx *gorm.DB) error {
+				return tx.Exec("DELETE FROM "+m.table+" WHERE version = ?", migration.Version).Error
+			}); err != nil {
+				return err
+			}
+			steps--
+		}
+		return nil
+	})
+}
+
+// locked runs fn on a single connection holding the advisory lock.
+func (m *Migrator) locked(ctx context.Context, fn func(db *gorm.DB) error) error {
+	return m.db.WithContext(ctx).Connection(func(db *gorm.DB) error {
+		if db.Dialector.Name() == Postgres {
+			if err := db.Exec("SELECT pg_advisory_lock(?)", migrationsLockId).Error; err != nil {
+				return err
+			}
+			defer db.Exec("SELECT pg_advisory_unlock(?)", migrationsLockId)
+		}
+		if m.dryRun {
+			return fn(db)
+		}
+		if err := db.Exec("CREATE TABLE IF NOT EXISTS " + m.table +
+			" (version BIGINT PRIMARY KEY, name VARCHAR(255) NOT NULL, applied_at TIMESTAMP NOT NULL)").Error; err != nil {
+			return err
+		}
+		return fn(db)
+	})
+}
+
+func (m *Migrator) applied(db *gorm.DB) (map[int64]bool, error) {
+	var versions []int64
+	if !db.Migrator().HasTable(m.table) {
+		return map[int64]bool{}, nil
+	}
+	if err := db.Table(m.table).Pluck("version", &versions).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[int64]bool, len(versions))
+	for _, version := range versions {
+		applied[version] = true
+	}
+	return applied, nil
+}
+
+func (m *Migrator) run(db *gorm.DB, migration *Migration, sql string, record func(tx *gorm.DB) error) error {
+	if m.dryRun {
+		log.Infof("migration %d %s would run:\n%s", migration.Version, migration.Name, sql)
+		return nil
+	}
+	log.Infof("running migration %d %s", migration.Version, migration.Name)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(sql).Error; err != nil {
+			return err
+		}
+		return record(tx)
+	})
+	if err != nil {
+		return fmt.Errorf("migration %d %s failed: %w", migration.Version, migration.Name, err)
+	}
+	return nil
+}
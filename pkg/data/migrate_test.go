@@ -0,0 +1,75 @@
+package data_test
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/achuala/go-svc-extn/pkg/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrations(t *testing.T) {
+	file := func(sql string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(sql)} }
+	tests := []struct {
+		name     string
+		fsys     fstest.MapFS
+		versions []int64
+		err      string
+	}{
+		{
+			name: "ordered by version",
+			fsys: fstest.MapFS{
+				"0002_add_email.up.sql":      file("ALTER TABLE users ADD email TEXT"),
+				"0001_create_users.up.sql":   file("CREATE TABLE users (id INT)"),
+				"0001_create_users.down.sql": file("DROP TABLE users"),
+			},
+			versions: []int64{1, 2},
+		},
+		{
+			name: "same version with another name",
+			fsys: fstest.MapFS{
+				"0001_create_users.up.sql":  file("CREATE TABLE users (id INT)"),
+				"0001_create_orders.up.sql": file("CREATE TABLE orders (id INT)"),
+			},
+			err: "have the same version 1",
+		},
+		{
+			name: "same version with another prefix",
+			fsys: fstest.MapFS{
+				"0001_create_users.up.sql": file("CREATE TABLE users (id INT)"),
+				"1_create_users.up.sql":    file("CREATE TABLE users (id INT)"),
+			},
+			err: "have the same version 1",
+		},
+		{
+			name: "same version of a down file",
+			fsys: fstest.MapFS{
+				"0001_create_users.up.sql":   file("CREATE TABLE users (id INT)"),
+				"0001_create_users.down.sql": file("DROP TABLE users"),
+				"01_create_users.down.sql":   file("DROP TABLE users"),
+			},
+			err: "have the same version 1",
+		},
+		{
+			name: "down without up",
+			fsys: fstest.MapFS{"0001_create_users.down.sql": file("DROP TABLE users")},
+			err:  "has no up file",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := data.NewMigrator(nil, tt.fsys).Migrations()
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			var versions []int64
+			for _, m := range migrations {
+				versions = append(versions, m.Version)
+			}
+			assert.Equal(t, tt.versions, versions)
+		})
+	}
+}
@@ -0,0 +1,51 @@
+// Package mysql registers the MySQL driver for data.WithDialect(data.MySQL):
+//
+//	import _ "github.com/achuala/go-svc-extn/pkg/data/mysql"
+//
+// The DSN is the one of github.com/go-sql-driver/mysql, with parseTime=true
+// to scan the time columns, e.g.
+// user:pass@tcp(127.0.0.1:3306)/db?charset=utf8mb4&parseTime=True&loc=UTC.
+package mysql
+
+import (
+	"github.com/achuala/go-svc-extn/pkg/data"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// Config holds the options of the MySQL driver.
+type Config struct {
+	// DefaultStringSize is the size of the string columns without size,
+	// 256 by default.
+	DefaultStringSize uint
+	// SkipInitializeWithVersion does not query the server version on open,
+	// the features below are then set explicitly.
+	SkipInitializeWithVersion bool
+	// DisableDatetimePrecision is required before MySQL 5.6.
+	DisableDatetimePrecision bool
+	// DontSupportRenameIndex is required before MySQL 5.7 and with MariaDB.
+	DontSupportRenameIndex bool
+	// DontSupportRenameColumn is required before MySQL 8 and with MariaDB.
+	DontSupportRenameColumn bool
+}
+
+func init() {
+	Register(Config{})
+}
+
+// Register registers the driver with cfg, replacing the defaults.
+func Register(cfg Config) {
+	if cfg.DefaultStringSize == 0 {
+		cfg.DefaultStringSize = 256
+	}
+	data.RegisterDialect(data.MySQL, func(dsn string) gorm.Dialector {
+		return mysql.New(mysql.Config{
+			DSN:                       dsn,
+			DefaultStringSize:         cfg.DefaultStringSize,
+			SkipInitializeWithVersion: cfg.SkipInitializeWithVersion,
+			DisableDatetimePrecision:  cfg.DisableDatetimePrecision,
+			DontSupportRenameIndex:    cfg.DontSupportRenameIndex,
+			DontSupportRenameColumn:   cfg.DontSupportRenameColumn,
+		})
+	})
+}
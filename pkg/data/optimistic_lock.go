@@ -0,0 +1,126 @@
+package data
+
+import (
+	"errors"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// ErrStaleObject is returned by the updates of a model with a Version which
+// was modified since it was read.
+var ErrStaleObject = errors.New("stale object: modified since it was read")
+
+// Version is embedded in the models updated with optimistic locking, see
+// OptimisticLock.
+type Version struct {
+	Version int64 `gorm:"not null"`
+}
+
+// OptimisticLock is a gorm plugin, installed by NewGormWithOptions with
+// WithOptimisticLocking, which sets the Version of the created models to 1, and adds a condition on the
+// Version read to the updates of a single model, incrementing it. Updates of
+// a model whose Version changed meanwhile fail with ErrStaleObject. Updates
+// with a zero Version, e.g. by primary key only, or of several rows are not
+// checked. Only the models embedding Version are versioned, a Version field
+// declared by the model itself is left alone.
+type OptimisticLock struct{}
+
+func (OptimisticLock) Name() string {
+	return "extn:optimistic_lock"
+}
+
+func (l OptimisticLock) Initialize(db *gorm.DB) error {
+	if err := db.Callback().Create().Before("gorm:create").Register("extn:optimistic_lock", l.create); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().Before("gorm:update").Register("extn:optimistic_lock", l.beforeUpdate); err != nil {
+		return err
+	}
+	return db.Callback().Update().After("gorm:update").Register("extn:optimistic_lock_check", l.afterUpdate)
+}
+
+const optimisticLockChecked = "extn:optimistic_lock"
+
+var versionType = reflect.TypeOf(Version{})
+
+// versionField returns the field of the embedded Version of the model.
+func versionField(db *gorm.DB) (*schema.Field, bool) {
+	stmt := db.Statement
+	if stmt.Schema == nil || db.Error != nil {
+		return nil, false
+	}
+	for _, field := range stmt.Schema.Fields {
+		if field.Name == "Version" && len(field.BindNames) > 1 && ownerType(stmt.Schema.ModelType, field.BindNames) == versionType {
+			return field, true
+		}
+	}
+	return nil, false
+}
+
+// ownerType returns the type of the struct declaring the field bound by names.
+func ownerType(model reflect.Type, names []string) reflect.Type {
+	t := model
+	for _, name := range names[:len(names)-1] {
+		f, ok := t.FieldByName(name)
+		if !ok {
+			return nil
+		}
+		t = f.Type
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+	}
+	return t
+}
+
+func (OptimisticLock) create(db *gorm.DB) {
+	field, ok := versionField(db)
+	if !ok {
+		return
+	}
+	setVersion := func(rv reflect.Value) {
+		if _, zero := field.ValueOf(db.Statement.Context, rv); zero {
+			_ = field.Set(db.Statement.Context, rv, int64(1))
+		}
+	}
+	switch rv := db.Statement.ReflectValue; rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			setVersion(reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		setVersion(rv)
+	}
+}
+
+func (OptimisticLock) beforeUpdate(db *gorm.DB) {
+	field, ok := versionField(db)
+	if !ok || db.Statement.ReflectValue.Kind() != reflect.Struct {
+		return
+	}
+	v, zero := field.ValueOf(db.Statement.Context, db.Statement.ReflectValue)
+	if zero {
+		return
+	}
+	version := v.(int64)
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: version},
+	}})
+	db.Statement.SetColumn(field.DBName, version+1)
+	db.InstanceSet(optimisticLockChecked, version)
+}
+
+func (OptimisticLock) afterUpdate(db *gorm.DB) {
+	version, ok := db.InstanceGet(optimisticLockChecked)
+	if !ok || db.Error != nil || db.RowsAffected > 0 {
+		return
+	}
+	// the model keeps the version it was read with
+	if field, ok := versionField(db); ok {
+		_ = field.Set(db.Statement.Context, db.Statement.ReflectValue, version)
+	}
+	_ = db.AddError(ErrStaleObject)
+}
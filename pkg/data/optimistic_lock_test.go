@@ -0,0 +1,54 @@
+package data_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/achuala/go-svc-extn/pkg/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type versionedAccount struct {
+	Id      int64
+	Balance int
+	data.Version
+}
+
+func TestOptimisticLock(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t, []interface{}{&versionedAccount{}}, data.WithOptimisticLocking())
+
+	account := &versionedAccount{Balance: 10}
+	require.NoError(t, db.WithContext(ctx).Create(account).Error)
+	assert.EqualValues(t, 1, account.Version.Version)
+
+	// two copies read the same version
+	var first, second versionedAccount
+	require.NoError(t, db.First(&first, account.Id).Error)
+	require.NoError(t, db.First(&second, account.Id).Error)
+
+	first.Balance = 20
+	require.NoError(t, db.Save(&first).Error)
+	assert.EqualValues(t, 2, first.Version.Version)
+
+	// the update of the stale copy fails and leaves the row alone
+	second.Balance = 30
+	err := db.Save(&second).Error
+	assert.ErrorIs(t, err, data.ErrStaleObject)
+	assert.EqualValues(t, 1, second.Version.Version)
+	var stored versionedAccount
+	require.NoError(t, db.First(&stored, account.Id).Error)
+	assert.Equal(t, 20, stored.Balance)
+	assert.EqualValues(t, 2, stored.Version.Version)
+
+	// once reloaded it succeeds
+	require.NoError(t, db.First(&second, account.Id).Error)
+	require.NoError(t, db.Model(&second).Updates(map[string]interface{}{"balance": 30}).Error)
+	require.NoError(t, db.First(&stored, account.Id).Error)
+	assert.Equal(t, 30, stored.Balance)
+	assert.EqualValues(t, 3, stored.Version.Version)
+
+	// the updates of several rows are not checked
+	require.NoError(t, db.Model(&versionedAccount{}).Where("balance > ?", 0).Update("balance", 40).Error)
+}
@@ -0,0 +1,253 @@
+package data
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/achuala/go-svc-extn/pkg/cache"
+	"github.com/achuala/go-svc-extn/pkg/util/idgen"
+	"github.com/go-kratos/kratos/v2/log"
+	"gorm.io/gorm"
+)
+
+// OutboxEvent is an event waiting in the outbox_events table to be
+// published by the OutboxRelay.
+type OutboxEvent struct {
+	// Id of the event, generated when empty, it is the id of the published
+	// message so that the consumers can detect duplicates
+	Id       string            `gorm:"primaryKey;size:64"`
+	Topic    string            `gorm:"size:255;not null"`
+	Payload  []byte            `gorm:"not null"`
+	Metadata map[string]string `gorm:"serializer:json"`
+	// Failed publication attempts
+	Attempts  int
+	CreatedAt time.Time  `gorm:"index"`
+	SentAt    *time.Time `gorm:"index"`
+}
+
+func (OutboxEvent) TableName() string {
+	return "outbox_events"
+}
+
+// Outbox stores the events to publish in the database, in the transaction of
+// the changes they describe, so that they are published only once the
+// changes are committed.
+type Outbox struct {
+	data *Data
+}
+
+// NewOutbox .
+func NewOutbox(d *Data) *Outbox {
+	return &Outbox{data: d}
+}
+
+// Enqueue stores the event in the outbox, within the transaction of InTx
+// when ctx has one.
+func (o *Outbox) Enqueue(ctx context.Context, event *OutboxEvent) error {
+	if event.Id == "" {
+		event.Id = idgen.NewId()
+	}
+	return o.data.DB(ctx).WithContext(ctx).Create(event).Error
+}
+
+// OutboxPublisher publishes the outbox events, e.g. nats.NatsJsPublisher.
+type OutboxPublisher interface {
+	PublishMessage(topic string, msg *message.Message) error
+}
+
+// OutboxLock is the cache holding the lock of the relays, both the local and
+// the remote caches implement it, only the remote one is shared between the
+// instances of a service.
+type OutboxLock interface {
+	cache.Cache
+	cache.Locker
+}
+
+// OutboxRelayOption configures the OutboxRelay.
+type OutboxRelayOption func(*OutboxRelay)
+
+// WithOutboxPollInterval sets the interval between the polls of the outbox,
+// 1 second by default.
+func WithOutboxPollInterval(interval time.Duration) OutboxRelayOption {
+	return func(r *OutboxRelay) {
+		r.interval = interval
+	}
+}
+
+// WithOutboxBatchSize sets the maximum number of events published per poll,
+// 100 by default.
+func WithOutboxBatchSize(n int) OutboxRelayOption {
+	return func(r *OutboxRelay) {
+		r.batchSize = n
+	}
+}
+
+// WithOutboxLockTTL sets how long a relay holds the lock without releasing
+// it, 30 seconds by default. It should exceed the time to publish a batch.
+func WithOutboxLockTTL(ttl time.Duration) OutboxRelayOption {
+	return func(r *OutboxRelay) {
+		r.lockTTL = ttl
+	}
+}
+
+// WithOutboxTopics restricts the relay to the events of the topics, so that
+// the relays of different topics publish concurrently. By default the relay
+// publishes the events of all the topics.
+func WithOutboxTopics(topics ...string) OutboxRelayOption {
+	return func(r *OutboxRelay) {
+		r.topics = topics
+	}
+}
+
+// WithOutboxRetention sets how long the sent events are kept before they are
+// purged, 7 days by default. Zero keeps them.
+func WithOutboxRetention(retention time.Duration) OutboxRelayOption {
+	return func(r *OutboxRelay) {
+		r.retention = retention
+	}
+}
+
+// OutboxRelay publishes the events of the outbox in their order of creation
+// and marks them sent. The relays of the instances of a service take turns
+// with a lock in the cache, named after the database, the table and the
+// topics of the relay. An event is published again when the relay fails
+// before marking it sent, the consumers detect the duplicates by the message
+// id. The sent events are purged after the retention period.
+type OutboxRelay struct {
+	data      *Data
+	publisher OutboxPublisher
+	lock      OutboxLock
+	log       *log.Helper
+	interval  time.Duration
+	batchSize int
+	lockTTL   time.Duration
+	topics    []string
+	retention time.Duration
+	lockKey   string
+	purgedAt  time.Time
+}
+
+// NewOutboxRelay .
+func NewOutboxRelay(d *Data, publisher OutboxPublisher, lock OutboxLock, logger log.Logger, opts ...OutboxRelayOption) *OutboxRelay {
+	r := &OutboxRelay{
+		data:      d,
+		publisher: publisher,
+		lock:      lock,
+		log:       log.NewHelper(logger),
+		interval:  time.Second,
+		batchSize: 100,
+		lockTTL:   30 * time.Second,
+		retention: 7 * 24 * time.Hour,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	r.lockKey = outboxLockKey(d.db, r.topics)
+	return r
+}
+
+// outboxLockKey names the lock of the relays of the table in the database,
+// so that the services sharing the cache don't wait for each other.
+func outboxLockKey(db *gorm.DB, topics []string) string {
+	key := "outbox:relay:" + db.Migrator().CurrentDatabase() + "." + OutboxEvent{}.TableName()
+	if len(topics) > 0 {
+		topics = slices.Clone(topics)
+		slices.Sort(topics)
+		key += ":" + strings.Join(topics, ",")
+	}
+	return key
+}
+
+// Run polls the outbox until ctx is done.
+func (r *OutboxRelay) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		if err := r.Relay(ctx); err != nil {
+			r.log.Errorf("unable to relay the outbox events: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// outboxPurgeInterval is the interval between the purges of the sent events.
+const outboxPurgeInterval = time.Hour
+
+// Relay publishes a batch of events when no other relay holds the lock.
+func (r *OutboxRelay) Relay(ctx context.Context) error {
+	owner := idgen.NewId()
+	claimed, err := r.lock.SetNX(ctx, r.lockKey, owner, r.lockTTL)
+	if err != nil || !claimed {
+		return err
+	}
+	defer func() {
+		// the lock is released on shutdown too, unless another relay claimed
+		// it once the TTL expired
+		if _, err := r.lock.Unlock(context.WithoutCancel(ctx), r.lockKey, owner); err != nil {
+			r.log.Errorf("unable to release the outbox relay lock: %v", err)
+		}
+	}()
+
+	// the replicas may not have the latest sent events
+	ctx = WithPrimary(ctx)
+	if time.Since(r.purgedAt) >= outboxPurgeInterval {
+		if err := r.Purge(ctx); err != nil {
+			r.log.Errorf("unable to purge the sent outbox events: %v", err)
+		} else {
+			r.purgedAt = time.Now()
+		}
+	}
+	var events []*OutboxEvent
+	err = r.events(ctx).
+		Where("sent_at IS NULL").
+		Order("created_at, id").
+		Limit(r.batchSize).
+		Find(&events).Error
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		msg := message.NewMessage(event.Id, event.Payload)
+		for k, v := range event.Metadata {
+			msg.Metadata.Set(k, v)
+		}
+		if err := r.publisher.PublishMessage(event.Topic, msg); err != nil {
+			// later events wait so that the order is kept
+			if uerr := r.data.db.WithContext(ctx).Model(event).UpdateColumn("attempts", gorm.Expr("attempts + 1")).Error; uerr != nil {
+				r.log.Errorf("unable to count the failed attempt of outbox event %s: %v", event.Id, uerr)
+			}
+			return err
+		}
+		if err := r.data.db.WithContext(ctx).Model(event).UpdateColumn("sent_at", time.Now()).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Purge deletes the events of the relay sent before the retention period, the
+// relay purges them every hour.
+func (r *OutboxRelay) Purge(ctx context.Context) error {
+	if r.retention <= 0 {
+		return nil
+	}
+	return r.events(WithPrimary(ctx)).
+		Where("sent_at < ?", time.Now().Add(-r.retention)).
+		Delete(&OutboxEvent{}).Error
+}
+
+// events returns the query of the events of the topics of the relay.
+func (r *OutboxRelay) events(ctx context.Context) *gorm.DB {
+	db := r.data.db.WithContext(ctx)
+	if len(r.topics) > 0 {
+		db = db.Where("topic IN ?", r.topics)
+	}
+	return db
+}
@@ -0,0 +1,175 @@
+package data_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/achuala/go-svc-extn/pkg/cache"
+	"github.com/achuala/go-svc-extn/pkg/data"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingPublisher records the published message ids, it fails with err
+// and blocks while block is open.
+type recordingPublisher struct {
+	mu    sync.Mutex
+	ids   []string
+	err   error
+	block chan struct{}
+}
+
+func (p *recordingPublisher) PublishMessage(topic string, msg *message.Message) error {
+	if p.block != nil {
+		<-p.block
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	p.ids = append(p.ids, topic+"/"+msg.UUID)
+	return nil
+}
+
+func (p *recordingPublisher) published() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.ids...)
+}
+
+func newOutboxTestData(t *testing.T) (*data.Data, data.OutboxLock) {
+	db, err := data.NewGormWithOptions(filepath.Join(t.TempDir(), "outbox.db"), data.WithDialect(data.SQLite))
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&data.OutboxEvent{}))
+	d, cleanup, err := data.NewData(db, log.DefaultLogger)
+	require.NoError(t, err)
+	t.Cleanup(cleanup)
+	lock, err, closeLock := cache.NewLocalCacheRistretto(&cache.CacheConfig{Mode: "local"})
+	require.NoError(t, err)
+	t.Cleanup(closeLock)
+	return d, lock
+}
+
+func enqueue(t *testing.T, d *data.Data, events ...*data.OutboxEvent) {
+	outbox := data.NewOutbox(d)
+	for _, event := range events {
+		event.Payload = []byte("{}")
+		require.NoError(t, outbox.Enqueue(context.Background(), event))
+		// distinct creation times keep the order
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestOutboxRelay(t *testing.T) {
+	ctx := context.Background()
+	d, lock := newOutboxTestData(t)
+	enqueue(t, d, &data.OutboxEvent{Id: "1", Topic: "orders"}, &data.OutboxEvent{Id: "2", Topic: "payments"},
+		&data.OutboxEvent{Id: "3", Topic: "orders"})
+
+	publisher := &recordingPublisher{}
+	require.NoError(t, data.NewOutboxRelay(d, publisher, lock, log.DefaultLogger, data.WithOutboxTopics("orders")).Relay(ctx))
+	assert.Equal(t, []string{"orders/1", "orders/3"}, publisher.published())
+
+	require.NoError(t, data.NewOutboxRelay(d, publisher, lock, log.DefaultLogger).Relay(ctx))
+	assert.Equal(t, []string{"orders/1", "orders/3", "payments/2"}, publisher.published())
+
+	// the sent events are not published again
+	require.NoError(t, data.NewOutboxRelay(d, publisher, lock, log.DefaultLogger).Relay(ctx))
+	assert.Len(t, publisher.published(), 3)
+
+	// a failed event is retried and holds back the later ones
+	enqueue(t, d, &data.OutboxEvent{Id: "4", Topic: "orders"}, &data.OutboxEvent{Id: "5", Topic: "orders"})
+	failing := &recordingPublisher{err: errors.New("unavailable")}
+	assert.Error(t, data.NewOutboxRelay(d, failing, lock, log.DefaultLogger).Relay(ctx))
+	var event data.OutboxEvent
+	require.NoError(t, d.DB(ctx).First(&event, "id = ?", "4").Error)
+	assert.Equal(t, 1, event.Attempts)
+	assert.Nil(t, event.SentAt)
+}
+
+func TestOutboxRelayLock(t *testing.T) {
+	ctx := context.Background()
+	d, lock := newOutboxTestData(t)
+	enqueue(t, d, &data.OutboxEvent{Id: "1", Topic: "orders"}, &data.OutboxEvent{Id: "2", Topic: "payments"})
+
+	blocked := &recordingPublisher{block: make(chan struct{})}
+	done := make(chan error)
+	go func() {
+		done <- data.NewOutboxRelay(d, blocked, lock, log.DefaultLogger, data.WithOutboxTopics("orders")).Relay(ctx)
+	}()
+	// wait for the relay of the orders to hold its lock
+	time.Sleep(50 * time.Millisecond)
+
+	// the relays of the other topics don't wait, the ones of the orders skip
+	publisher := &recordingPublisher{}
+	require.NoError(t, data.NewOutboxRelay(d, publisher, lock, log.DefaultLogger, data.WithOutboxTopics("payments")).Relay(ctx))
+	require.NoError(t, data.NewOutboxRelay(d, publisher, lock, log.DefaultLogger, data.WithOutboxTopics("orders")).Relay(ctx))
+	assert.Equal(t, []string{"payments/2"}, publisher.published())
+
+	close(blocked.block)
+	require.NoError(t, <-done)
+	assert.Equal(t, []string{"orders/1"}, blocked.published())
+}
+
+func TestOutboxRelayExpiredLock(t *testing.T) {
+	ctx := context.Background()
+	d, lock := newOutboxTestData(t)
+	enqueue(t, d, &data.OutboxEvent{Id: "1", Topic: "orders"})
+
+	relay := func(publisher *recordingPublisher, ttl time.Duration) chan error {
+		done := make(chan error, 1)
+		go func() {
+			done <- data.NewOutboxRelay(d, publisher, lock, log.DefaultLogger, data.WithOutboxLockTTL(ttl)).Relay(ctx)
+		}()
+		return done
+	}
+	// the first relay outlives its lock, which the second one claims
+	first := &recordingPublisher{block: make(chan struct{})}
+	firstDone := relay(first, 20*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	second := &recordingPublisher{block: make(chan struct{})}
+	secondDone := relay(second, time.Minute)
+	time.Sleep(50 * time.Millisecond)
+
+	// the first relay does not release the lock of the second one
+	close(first.block)
+	require.NoError(t, <-firstDone)
+	enqueue(t, d, &data.OutboxEvent{Id: "2", Topic: "orders"})
+	publisher := &recordingPublisher{}
+	require.NoError(t, data.NewOutboxRelay(d, publisher, lock, log.DefaultLogger).Relay(ctx))
+	assert.Empty(t, publisher.published())
+
+	close(second.block)
+	require.NoError(t, <-secondDone)
+	assert.Equal(t, []string{"orders/1"}, first.published())
+}
+
+func TestOutboxPurge(t *testing.T) {
+	ctx := context.Background()
+	d, lock := newOutboxTestData(t)
+	enqueue(t, d, &data.OutboxEvent{Id: "old", Topic: "orders"}, &data.OutboxEvent{Id: "recent", Topic: "orders"},
+		&data.OutboxEvent{Id: "unsent", Topic: "orders"}, &data.OutboxEvent{Id: "other", Topic: "payments"})
+	old := time.Now().Add(-48 * time.Hour)
+	recent := time.Now().Add(-time.Hour)
+	require.NoError(t, d.DB(ctx).Model(&data.OutboxEvent{}).Where("id IN ?", []string{"old", "other"}).UpdateColumn("sent_at", old).Error)
+	require.NoError(t, d.DB(ctx).Model(&data.OutboxEvent{}).Where("id = ?", "recent").UpdateColumn("sent_at", recent).Error)
+
+	relay := data.NewOutboxRelay(d, &recordingPublisher{}, lock, log.DefaultLogger,
+		data.WithOutboxTopics("orders"), data.WithOutboxRetention(24*time.Hour))
+	require.NoError(t, relay.Purge(ctx))
+	var ids []string
+	require.NoError(t, d.DB(ctx).Model(&data.OutboxEvent{}).Order("id").Pluck("id", &ids).Error)
+	assert.Equal(t, []string{"other", "recent", "unsent"}, ids)
+
+	// zero retention keeps the events
+	require.NoError(t, data.NewOutboxRelay(d, &recordingPublisher{}, lock, log.DefaultLogger, data.WithOutboxRetention(0)).Purge(ctx))
+	require.NoError(t, d.DB(ctx).Model(&data.OutboxEvent{}).Order("id").Pluck("id", &ids).Error)
+	assert.Len(t, ids, 3)
+}
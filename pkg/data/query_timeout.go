@@ -0,0 +1,88 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"gorm.io/gorm"
+)
+
+// QueryTimeout is a gorm plugin bounding the statements whose context has no
+// deadline by a default timeout, so that a wedged statement can't hold a
+// pooled connection forever. Statements returning rows to iterate, Row and
+// Rows, are not bounded. The statements cancelled at the timeout are
+// counted in db.query.timeouts, by table, when a meter is given.
+type QueryTimeout struct {
+	timeout  time.Duration
+	timeouts metric.Int64Counter
+}
+
+// NewQueryTimeout returns the plugin bounding the statements by timeout,
+// meter may be nil.
+func NewQueryTimeout(timeout time.Duration, meter metric.Meter) (*QueryTimeout, error) {
+	q := &QueryTimeout{timeout: timeout}
+	if meter != nil {
+		var err error
+		q.timeouts, err = meter.Int64Counter("db.query.timeouts",
+			metric.WithDescription("Number of statements cancelled at the default query timeout by table"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+func (q *QueryTimeout) Name() string {
+	return "extn:query_timeout"
+}
+
+func (q *QueryTimeout) Initialize(db *gorm.DB) error {
+	callbacks := []error{
+		db.Callback().Create().Before("gorm:create").Register("extn:query_timeout", q.before),
+		db.Callback().Create().After("gorm:create").Register("extn:query_timeout_done", q.after),
+		db.Callback().Query().Before("gorm:query").Register("extn:query_timeout", q.before),
+		db.Callback().Query().After("gorm:query").Register("extn:query_timeout_done", q.after),
+		db.Callback().Update().Before("gorm:update").Register("extn:query_timeout", q.before),
+		db.Callback().Update().After("gorm:update").Register("extn:query_timeout_done", q.after),
+		db.Callback().Delete().Before("gorm:delete").Register("extn:query_timeout", q.before),
+		db.Callback().Delete().After("gorm:delete").Register("extn:query_timeout_done", q.after),
+		db.Callback().Raw().Before("gorm:raw").Register("extn:query_timeout", q.before),
+		db.Callback().Raw().After("gorm:raw").Register("extn:query_timeout_done", q.after),
+	}
+	for _, err := range callbacks {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const queryTimeoutCancel = "extn:query_timeout"
+
+func (q *QueryTimeout) before(db *gorm.DB) {
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if _, ok := ctx.Deadline(); ok || q.timeout <= 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, q.timeout)
+	db.Statement.Context = ctx
+	db.InstanceSet(queryTimeoutCancel, cancel)
+}
+
+func (q *QueryTimeout) after(db *gorm.DB) {
+	v, ok := db.InstanceGet(queryTimeoutCancel)
+	if !ok {
+		return
+	}
+	cancel := v.(context.CancelFunc)
+	if errors.Is(db.Statement.Context.Err(), context.DeadlineExceeded) && q.timeouts != nil {
+		q.timeouts.Add(context.Background(), 1, metric.WithAttributes(attribute.String("table", db.Statement.Table)))
+	}
+	cancel()
+}
@@ -0,0 +1,113 @@
+package data_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/achuala/go-svc-extn/pkg/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	"gorm.io/gorm"
+)
+
+// countingMeter counts the additions of the counters by name and
+// attributes.
+type countingMeter struct {
+	noop.Meter
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+type countingCounter struct {
+	noop.Int64Counter
+	m    *countingMeter
+	name string
+}
+
+func (m *countingMeter) Int64Counter(name string, _ ...metric.Int64CounterOption) (metric.Int64Counter, error) {
+	return &countingCounter{m: m, name: name}, nil
+}
+
+func (c *countingCounter) Add(_ context.Context, incr int64, opts ...metric.AddOption) {
+	attrs := metric.NewAddConfig(opts).Attributes()
+	c.m.mu.Lock()
+	defer c.m.mu.Unlock()
+	c.m.counts[c.name+"{"+attrs.Encoded(attribute.DefaultEncoder())+"}"] += incr
+}
+
+// slowCondition takes seconds for SQLite to evaluate.
+const slowCondition = "id IN (WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c WHERE x < 1000000000) SELECT count(*) FROM c)"
+
+// recordDeadlines records whether the statements run with a deadline, and
+// which one, once the plugin ran.
+func recordDeadlines(t *testing.T, db *gorm.DB) *[]time.Time {
+	var deadlines []time.Time
+	record := func(db *gorm.DB) {
+		deadline, _ := db.Statement.Context.Deadline()
+		deadlines = append(deadlines, deadline)
+	}
+	require.NoError(t, db.Callback().Query().After("extn:query_timeout").Before("gorm:query").Register("test:deadline", record))
+	require.NoError(t, db.Callback().Raw().After("extn:query_timeout").Before("gorm:raw").Register("test:deadline", record))
+	require.NoError(t, db.Callback().Row().Before("gorm:row").Register("test:deadline", record))
+	return &deadlines
+}
+
+func TestQueryTimeoutDeadlines(t *testing.T) {
+	db := openTestDB(t, []interface{}{&txItem{}}, data.WithDefaultQueryTimeout(time.Minute))
+	require.NoError(t, db.Create(&txItem{Id: 1, Name: "a"}).Error)
+	deadlines := recordDeadlines(t, db)
+
+	start := time.Now()
+	var items []txItem
+	require.NoError(t, db.Find(&items).Error)
+	require.NoError(t, db.Exec("UPDATE tx_items SET name = name").Error)
+	require.Len(t, *deadlines, 2)
+	for _, deadline := range *deadlines {
+		assert.WithinRange(t, deadline, start.Add(time.Minute), time.Now().Add(time.Minute))
+	}
+
+	// the deadline of the caller is kept, even when later
+	*deadlines = nil
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	own, _ := ctx.Deadline()
+	require.NoError(t, db.WithContext(ctx).Find(&items).Error)
+	assert.Equal(t, []time.Time{own}, *deadlines)
+
+	// the rows are not bounded, they are iterated after the callbacks
+	*deadlines = nil
+	var name string
+	require.NoError(t, db.Model(&txItem{}).Select("name").Row().Scan(&name))
+	assert.Equal(t, []time.Time{{}}, *deadlines)
+
+	unbounded := openTestDB(t, []interface{}{&txItem{}})
+	deadlines = recordDeadlines(t, unbounded)
+	require.NoError(t, unbounded.Find(&items).Error)
+	assert.Equal(t, []time.Time{{}}, *deadlines)
+}
+
+func TestQueryTimeoutCancel(t *testing.T) {
+	meter := &countingMeter{counts: map[string]int64{}}
+	db := openTestDB(t, []interface{}{&txItem{}}, data.WithDefaultQueryTimeout(50*time.Millisecond), data.WithMeter(meter))
+
+	start := time.Now()
+	var items []txItem
+	err := db.Where(slowCondition).Find(&items).Error
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Equal(t, map[string]int64{"db.query.timeouts{table=tx_items}": 1}, meter.counts)
+
+	// a statement cancelled by its caller is not counted
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Error(t, db.WithContext(ctx).Where(slowCondition).Find(&items).Error)
+	assert.Equal(t, int64(1), meter.counts["db.query.timeouts{table=tx_items}"])
+
+	require.NoError(t, db.Find(&items).Error)
+	assert.Equal(t, int64(1), meter.counts["db.query.timeouts{table=tx_items}"])
+}
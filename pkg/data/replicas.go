@@ -0,0 +1,82 @@
+package data
+
+import (
+	"context"
+	"math/rand/v2"
+	"strings"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+)
+
+// ReplicaPolicy selects the replica of a read.
+type ReplicaPolicy int
+
+const (
+	RoundRobin ReplicaPolicy = iota
+	Random
+)
+
+type contextPrimaryKey struct{}
+
+// WithPrimary returns a context whose queries are sent to the primary, e.g. to
+// read data just written, which the replicas may not have yet.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, contextPrimaryKey{}, true)
+}
+
+func usePrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(contextPrimaryKey{}).(bool)
+	return primary
+}
+
+// replicas is a gorm plugin sending the reads outside of transactions to the
+// replicas. Writes, locking reads and raw statements other than SELECT stay
+// on the primary.
+type replicas struct {
+	pools  []gorm.ConnPool
+	policy ReplicaPolicy
+	next   atomic.Uint64
+}
+
+func (r *replicas) Name() string {
+	return "extn:replicas"
+}
+
+func (r *replicas) Initialize(db *gorm.DB) error {
+	if err := db.Callback().Query().Before("gorm:query").Register("extn:replicas", r.route); err != nil {
+		return err
+	}
+	return db.Callback().Row().Before("gorm:row").Register("extn:replicas", r.route)
+}
+
+func (r *replicas) route(db *gorm.DB) {
+	stmt := db.Statement
+	if _, inTx := stmt.ConnPool.(gorm.TxCommitter); inTx || len(r.pools) == 0 {
+		return
+	}
+	if stmt.Context != nil && usePrimary(stmt.Context) {
+		return
+	}
+	if _, locking := stmt.Clauses["FOR"]; locking {
+		return
+	}
+	if sql := strings.TrimSpace(stmt.SQL.String()); sql != "" && !strings.EqualFold(firstWord(sql), "select") {
+		return
+	}
+	stmt.ConnPool = r.pick()
+}
+
+func (r *replicas) pick() gorm.ConnPool {
+	if r.policy == Random {
+		return r.pools[rand.IntN(len(r.pools))]
+	}
+	return r.pools[(r.next.Add(1)-1)%uint64(len(r.pools))]
+}
+
+func firstWord(sql string) string {
+	if i := strings.IndexAny(sql, " \t\r\n("); i >= 0 {
+		return sql[:i]
+	}
+	return sql
+}
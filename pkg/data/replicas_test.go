@@ -0,0 +1,125 @@
+package data_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/achuala/go-svc-extn/pkg/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type replicaItem struct {
+	Id   int64
+	Name string
+}
+
+// seedDB creates a sqlite database holding a single item named after the
+// database, so that the reads tell which one served them.
+func seedDB(t *testing.T, name string) string {
+	path := filepath.Join(t.TempDir(), name+".db")
+	db := openDBAt(t, path)
+	require.NoError(t, db.AutoMigrate(&replicaItem{}))
+	require.NoError(t, db.Create(&replicaItem{Name: name}).Error)
+	return path
+}
+
+func openDBAt(t *testing.T, path string, opts ...data.GormOption) *gorm.DB {
+	opts = append([]data.GormOption{data.WithDialect(data.SQLite)}, opts...)
+	db, err := data.NewGormWithOptions(path, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// servedBy returns the name of the database which served the read.
+func servedBy(t *testing.T, db *gorm.DB) string {
+	var item replicaItem
+	require.NoError(t, db.First(&item).Error)
+	return item.Name
+}
+
+func TestReplicasRouting(t *testing.T) {
+	ctx := context.Background()
+	db := openDBAt(t, seedDB(t, "primary"), data.WithReplicas(data.RoundRobin, seedDB(t, "replica")))
+
+	tests := []struct {
+		name string
+		read func(t *testing.T) string
+		want string
+	}{
+		{name: "query", read: func(t *testing.T) string { return servedBy(t, db.WithContext(ctx)) }, want: "replica"},
+		{name: "count", read: func(t *testing.T) string {
+			var n int64
+			require.NoError(t, db.Model(&replicaItem{}).Where("name = ?", "replica").Count(&n).Error)
+			if n == 1 {
+				return "replica"
+			}
+			return "primary"
+		}, want: "replica"},
+		{name: "row", read: func(t *testing.T) string {
+			var name string
+			require.NoError(t, db.Model(&replicaItem{}).Select("name").Row().Scan(&name))
+			return name
+		}, want: "replica"},
+		{name: "raw select", read: func(t *testing.T) string {
+			var name string
+			require.NoError(t, db.Raw("  select name FROM replica_items").Scan(&name).Error)
+			return name
+		}, want: "replica"},
+		{name: "with primary", read: func(t *testing.T) string { return servedBy(t, db.WithContext(data.WithPrimary(ctx))) }, want: "primary"},
+		{name: "transaction", read: func(t *testing.T) string {
+			var name string
+			require.NoError(t, db.Transaction(func(tx *gorm.DB) error {
+				name = servedBy(t, tx)
+				return nil
+			}))
+			return name
+		}, want: "primary"},
+		{name: "data transaction", read: func(t *testing.T) string {
+			d, cleanup, err := data.NewData(db, nil)
+			require.NoError(t, err)
+			defer cleanup()
+			var name string
+			require.NoError(t, d.InTx(ctx, func(ctx context.Context) error {
+				name = servedBy(t, d.DB(ctx))
+				return nil
+			}))
+			return name
+		}, want: "primary"},
+		{name: "for update", read: func(t *testing.T) string {
+			return servedBy(t, db.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate}))
+		}, want: "primary"},
+		{name: "raw statement other than select", read: func(t *testing.T) string {
+			var name string
+			require.NoError(t, db.Raw("UPDATE replica_items SET name = name RETURNING name").Scan(&name).Error)
+			return name
+		}, want: "primary"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.read(t))
+		})
+	}
+
+	// the writes stay on the primary
+	require.NoError(t, db.Model(&replicaItem{}).Where("name = ?", "primary").Update("name", "updated").Error)
+	assert.Equal(t, "updated", servedBy(t, db.WithContext(data.WithPrimary(ctx))))
+	assert.Equal(t, "replica", servedBy(t, db))
+}
+
+func TestReplicasRoundRobin(t *testing.T) {
+	db := openDBAt(t, seedDB(t, "primary"), data.WithReplicas(data.RoundRobin, seedDB(t, "replica-1"), seedDB(t, "replica-2")))
+	var served []string
+	for i := 0; i < 4; i++ {
+		served = append(served, servedBy(t, db))
+	}
+	assert.Equal(t, []string{"replica-1", "replica-2", "replica-1", "replica-2"}, served)
+}
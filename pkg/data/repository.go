@@ -0,0 +1,128 @@
+package data
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// QueryOption narrows or orders the rows of a Repository query, gorm scopes
+// such as Paginate are query options.
+type QueryOption = func(db *gorm.DB) *gorm.DB
+
+// Where filters the rows, with the arguments of gorm.DB.Where.
+func Where(query interface{}, args ...interface{}) QueryOption {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(query, args...)
+	}
+}
+
+// OrderBy orders the rows, e.g. "created_at desc".
+func OrderBy(order string) QueryOption {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Order(order)
+	}
+}
+
+// Preload loads the association of the rows.
+func Preload(association string) QueryOption {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Preload(association)
+	}
+}
+
+// Repository offers the CRUD operations of the model T, within the
+// transaction of InTx when the context has one.
+type Repository[T any] struct {
+	data *Data
+}
+
+// NewRepository .
+func NewRepository[T any](d *Data) *Repository[T] {
+	return &Repository[T]{data: d}
+}
+
+func (r *Repository[T]) db(ctx context.Context) *gorm.DB {
+	return r.data.DB(ctx).WithContext(ctx).Model(new(T))
+}
+
+// byId is the condition on the primary key of T.
+func (r *Repository[T]) byId(db *gorm.DB, id interface{}) (*gorm.DB, error) {
+	if err := db.Statement.Parse(new(T)); err != nil {
+		return nil, err
+	}
+	if db.Statement.Schema.PrioritizedPrimaryField == nil {
+		return nil, gorm.ErrPrimaryKeyRequired
+	}
+	return db.Where(clause.Eq{
+		Column: clause.Column{Table: clause.CurrentTable, Name: db.Statement.Schema.PrioritizedPrimaryField.DBName},
+		Value:  id,
+	}), nil
+}
+
+// Get returns the entity with the primary key id, gorm.ErrRecordNotFound
+// when there is none.
+func (r *Repository[T]) Get(ctx context.Context, id interface{}, opts ...QueryOption) (*T, error) {
+	db, err := r.byId(r.db(ctx).Scopes(opts...), id)
+	if err != nil {
+		return nil, err
+	}
+	entity := new(T)
+	if err := db.Take(entity).Error; err != nil {
+		return nil, err
+	}
+	return entity, nil
+}
+
+// List returns the entities matching the options, e.g. Where and Paginate.
+func (r *Repository[T]) List(ctx context.Context, opts ...QueryOption) ([]*T, error) {
+	var entities []*T
+	if err := r.db(ctx).Scopes(opts...).Find(&entities).Error; err != nil {
+		return nil, err
+	}
+	return entities, nil
+}
+
+// Count returns the number of entities matching the options.
+func (r *Repository[T]) Count(ctx context.Context, opts ...QueryOption) (int64, error) {
+	var count int64
+	err := r.db(ctx).Scopes(opts...).Count(&count).Error
+	return count, err
+}
+
+// Create inserts the entity.
+func (r *Repository[T]) Create(ctx context.Context, entity *T) error {
+	return r.data.DB(ctx).WithContext(ctx).Create(entity).Error
+}
+
+// Update writes all the columns of the entity, which should be read first,
+// gorm.ErrRecordNotFound when it does not exist.
+func (r *Repository[T]) Update(ctx context.Context, entity *T) error {
+	result := r.data.DB(ctx).WithContext(ctx).Model(entity).Select("*").Updates(entity)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Delete deletes the entity with the primary key id, gorm.ErrRecordNotFound
+// when there is none. The entity is read first so that the plugins, e.g.
+// Auditing, see the deleted row.
+func (r *Repository[T]) Delete(ctx context.Context, id interface{}) error {
+	entity, err := r.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	result := r.data.DB(ctx).WithContext(ctx).Delete(entity)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
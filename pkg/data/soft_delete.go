@@ -0,0 +1,119 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// WithDeleted includes the soft deleted rows, of the models with a
+// gorm.DeletedAt field, in the query.
+func WithDeleted() QueryOption {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped()
+	}
+}
+
+// OnlyDeleted restricts the query to the soft deleted rows.
+func OnlyDeleted() QueryOption {
+	return func(db *gorm.DB) *gorm.DB {
+		model := db.Statement.Model
+		if model == nil {
+			model = db.Statement.Dest
+		}
+		field, err := deletedAtField(db, model)
+		if err != nil {
+			_ = db.AddError(err)
+			return db
+		}
+		return db.Unscoped().Where(clause.Neq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: nil})
+	}
+}
+
+// deletedAtField returns the gorm.DeletedAt field of the model.
+func deletedAtField(db *gorm.DB, model interface{}) (*schema.Field, error) {
+	if model == nil {
+		return nil, gorm.ErrModelValueRequired
+	}
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, err
+	}
+	deletedAt := reflect.TypeOf(gorm.DeletedAt{})
+	for _, field := range stmt.Schema.Fields {
+		if field.FieldType == deletedAt {
+			return field, nil
+		}
+	}
+	return nil, errors.New("model " + stmt.Schema.Name + " is not soft deleted")
+}
+
+// PurgeOption configures PurgeSoftDeleted.
+type PurgeOption func(*purgeOptions)
+
+type purgeOptions struct {
+	batchSize int
+	progress  func(purged int64)
+}
+
+// WithPurgeBatchSize sets the number of rows deleted per statement, 1000 by
+// default.
+func WithPurgeBatchSize(n int) PurgeOption {
+	return func(o *purgeOptions) {
+		o.batchSize = n
+	}
+}
+
+// WithPurgeProgress calls progress with the number of rows purged so far
+// after every batch.
+func WithPurgeProgress(progress func(purged int64)) PurgeOption {
+	return func(o *purgeOptions) {
+		o.progress = progress
+	}
+}
+
+// PurgeSoftDeleted deletes for good the rows of the model soft deleted for
+// longer than olderThan, in batches so that the table is not locked for
+// long. It returns the number of purged rows, and stops when ctx is done.
+func PurgeSoftDeleted(ctx context.Context, d *Data, model interface{}, olderThan time.Duration, opts ...PurgeOption) (int64, error) {
+	o := &purgeOptions{batchSize: 1000}
+	for _, opt := range opts {
+		opt(o)
+	}
+	db := d.DB(ctx).WithContext(WithPrimary(ctx))
+	field, err := deletedAtField(db, model)
+	if err != nil {
+		return 0, err
+	}
+	pk := field.Schema.PrioritizedPrimaryField
+	if pk == nil {
+		return 0, gorm.ErrPrimaryKeyRequired
+	}
+	before := time.Now().Add(-olderThan)
+	var purged int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return purged, err
+		}
+		batch := db.Unscoped().Model(model).Select(pk.DBName).
+			Where(clause.Lt{Column: clause.Column{Name: field.DBName}, Value: before}).
+			Limit(o.batchSize)
+		// clause.IN would compare a single subquery with =
+		result := db.Unscoped().Where(clause.Expr{SQL: "? IN (?)", Vars: []interface{}{clause.Column{Name: pk.DBName}, batch}}).Delete(model)
+		if result.Error != nil {
+			return purged, result.Error
+		}
+		purged += result.RowsAffected
+		if result.RowsAffected > 0 && o.progress != nil {
+			o.progress(purged)
+		}
+		if result.RowsAffected < int64(o.batchSize) {
+			return purged, nil
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package data_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/achuala/go-svc-extn/pkg/data"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type softItem struct {
+	Id        int64
+	Name      string
+	DeletedAt gorm.DeletedAt
+}
+
+func newSoftDeleteData(t *testing.T) (*data.Data, *gorm.DB) {
+	db := openTestDB(t, []interface{}{&softItem{}, &txItem{}})
+	d, cleanup, err := data.NewData(db, log.DefaultLogger)
+	require.NoError(t, err)
+	t.Cleanup(cleanup)
+	return d, db
+}
+
+func softItemNames(items []*softItem) []string {
+	names := make([]string, len(items))
+	for i, item := range items {
+		names[i] = item.Name
+	}
+	return names
+}
+
+func TestSoftDeleteQueryOptions(t *testing.T) {
+	ctx := context.Background()
+	d, db := newSoftDeleteData(t)
+	repo := data.NewRepository[softItem](d)
+	for _, name := range []string{"a", "b", "c"} {
+		require.NoError(t, repo.Create(ctx, &softItem{Name: name}))
+	}
+	require.NoError(t, repo.Delete(ctx, 2))
+	require.NoError(t, db.Delete(&softItem{}, 3).Error)
+
+	tests := []struct {
+		name string
+		opts []data.QueryOption
+		want []string
+	}{
+		{name: "default", want: []string{"a"}},
+		{name: "with deleted", opts: []data.QueryOption{data.WithDeleted()}, want: []string{"a", "b", "c"}},
+		{name: "only deleted", opts: []data.QueryOption{data.OnlyDeleted()}, want: []string{"b", "c"}},
+		{name: "only deleted matching", opts: []data.QueryOption{data.OnlyDeleted(), data.Where("name = ?", "c")}, want: []string{"c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := repo.List(ctx, append(tt.opts, data.OrderBy("id"))...)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, softItemNames(items))
+			n, err := repo.Count(ctx, tt.opts...)
+			require.NoError(t, err)
+			assert.Equal(t, int64(len(tt.want)), n)
+		})
+	}
+
+	_, err := repo.Get(ctx, 2)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	item, err := repo.Get(ctx, 2, data.WithDeleted())
+	require.NoError(t, err)
+	assert.True(t, item.DeletedAt.Valid)
+	_, err = repo.Get(ctx, 1, data.OnlyDeleted())
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	_, err = data.NewRepository[txItem](d).List(ctx, data.OnlyDeleted())
+	assert.ErrorContains(t, err, "not soft deleted")
+}
+
+func TestPurgeSoftDeleted(t *testing.T) {
+	ctx := context.Background()
+	d, db := newSoftDeleteData(t)
+	old := gorm.DeletedAt{Time: time.Now().Add(-48 * time.Hour), Valid: true}
+	recent := gorm.DeletedAt{Time: time.Now().Add(-time.Hour), Valid: true}
+	items := []*softItem{{Name: "alive"}, {Name: "recent", DeletedAt: recent}}
+	for i := 0; i < 5; i++ {
+		items = append(items, &softItem{Name: "old", DeletedAt: old})
+	}
+	require.NoError(t, db.Create(items).Error)
+
+	var progress []int64
+	purged, err := data.PurgeSoftDeleted(ctx, d, &softItem{}, 24*time.Hour, data.WithPurgeBatchSize(2),
+		data.WithPurgeProgress(func(purged int64) { progress = append(progress, purged) }))
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), purged)
+	assert.Equal(t, []int64{2, 4, 5}, progress)
+
+	var names []string
+	require.NoError(t, db.Unscoped().Model(&softItem{}).Order("id").Pluck("name", &names).Error)
+	assert.Equal(t, []string{"alive", "recent"}, names)
+
+	purged, err = data.PurgeSoftDeleted(ctx, d, &softItem{}, 24*time.Hour)
+	require.NoError(t, err)
+	assert.Zero(t, purged)
+
+	_, err = data.PurgeSoftDeleted(ctx, d, &txItem{}, time.Hour)
+	assert.ErrorContains(t, err, "not soft deleted")
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = data.PurgeSoftDeleted(canceled, d, &softItem{}, 0)
+	assert.ErrorIs(t, err, context.Canceled)
+}
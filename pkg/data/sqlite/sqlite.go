@@ -0,0 +1,28 @@
+// Package sqlite registers the SQLite driver, which needs cgo, for
+// data.WithDialect(data.SQLite):
+//
+//	import _ "github.com/achuala/go-svc-extn/pkg/data/sqlite"
+package sqlite
+
+import (
+	"github.com/achuala/go-svc-extn/pkg/data"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// Config holds the options of the SQLite driver.
+type Config struct {
+	// DriverName is the database/sql driver, sqlite3 by default.
+	DriverName string
+}
+
+func init() {
+	Register(Config{})
+}
+
+// Register registers the driver with cfg, replacing the defaults.
+func Register(cfg Config) {
+	data.RegisterDialect(data.SQLite, func(dsn string) gorm.Dialector {
+		return &sqlite.Dialector{DriverName: cfg.DriverName, DSN: dsn}
+	})
+}
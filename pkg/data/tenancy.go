@@ -0,0 +1,170 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"regexp"
+
+	"github.com/achuala/go-svc-extn/pkg/ctxkeys"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Errors returned by the statements on the tenant models
+var (
+	ErrMissingTenant  = errors.New("tenant of the statement is unknown")
+	ErrTenantMismatch = errors.New("tenant of the model does not match the tenant of the context")
+	ErrInvalidTenant  = errors.New("tenant is not a valid schema name")
+)
+
+type contextNoTenantKey struct{}
+
+// WithoutTenantScope returns a context whose statements are not scoped by
+// tenant, e.g. for the jobs working across the tenants.
+func WithoutTenantScope(ctx context.Context) context.Context {
+	return context.WithValue(ctx, contextNoTenantKey{}, true)
+}
+
+// TenancyOption configures the Tenancy.
+type TenancyOption func(*Tenancy)
+
+// WithTenantColumn scopes the models by their TenantId column.
+func WithTenantColumn(models ...interface{}) TenancyOption {
+	return func(t *Tenancy) {
+		for _, model := range models {
+			t.columnModels[reflect.Indirect(reflect.ValueOf(model)).Type()] = true
+		}
+	}
+}
+
+// WithTenantSchema stores the models in a schema per tenant, named by
+// schemaName, the tenant itself when nil.
+func WithTenantSchema(schemaName func(tenant string) string, models ...interface{}) TenancyOption {
+	return func(t *Tenancy) {
+		t.schemaName = schemaName
+		for _, model := range models {
+			t.schemaModels[reflect.Indirect(reflect.ValueOf(model)).Type()] = true
+		}
+	}
+}
+
+var schemaNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Tenancy is a gorm plugin scoping the statements on the tenant models by
+// the tenant of the context, see ctxkeys.TenantFromContext, as set by
+// middleware.ServerTenant. The queries, updates and deletes of the models
+// with a tenant column get a tenant_id condition and their creates get the
+// TenantId, the tables of the models with a schema per tenant are qualified
+// by the schema of the tenant.
+// Statements without tenant fail with ErrMissingTenant, unless the context
+// is WithoutTenantScope. Raw SQL is not scoped.
+type Tenancy struct {
+	columnModels map[reflect.Type]bool
+	schemaModels map[reflect.Type]bool
+	schemaName   func(tenant string) string
+}
+
+// NewTenancy .
+func NewTenancy(opts ...TenancyOption) *Tenancy {
+	t := &Tenancy{columnModels: map[reflect.Type]bool{}, schemaModels: map[reflect.Type]bool{}}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+func (t *Tenancy) Name() string {
+	return "extn:tenancy"
+}
+
+func (t *Tenancy) Initialize(db *gorm.DB) error {
+	callbacks := []error{
+		db.Callback().Create().Before("gorm:create").Register("extn:tenancy", t.create),
+		db.Callback().Query().Before("gorm:query").Register("extn:tenancy", t.scope),
+		db.Callback().Row().Before("gorm:row").Register("extn:tenancy", t.scope),
+		db.Callback().Update().Before("gorm:update").Register("extn:tenancy", t.scope),
+		db.Callback().Delete().Before("gorm:delete").Register("extn:tenancy", t.scope),
+	}
+	for _, err := range callbacks {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tenant returns the tenant of the statement, false when it is not scoped.
+func (t *Tenancy) tenant(db *gorm.DB) (string, bool) {
+	stmt := db.Statement
+	if stmt.Schema == nil || db.Error != nil || (!t.columnModels[stmt.Schema.ModelType] && !t.schemaModels[stmt.Schema.ModelType]) {
+		return "", false
+	}
+	if noTenant, _ := stmt.Context.Value(contextNoTenantKey{}).(bool); noTenant {
+		return "", false
+	}
+	tenant, ok := ctxkeys.TenantFromContext(stmt.Context)
+	if !ok {
+		_ = db.AddError(ErrMissingTenant)
+		return "", false
+	}
+	if t.schemaModels[stmt.Schema.ModelType] {
+		name := tenant
+		if t.schemaName != nil {
+			name = t.schemaName(tenant)
+		}
+		if !schemaNamePattern.MatchString(name) {
+			_ = db.AddError(ErrInvalidTenant)
+			return "", false
+		}
+		stmt.Table = name + "." + stmt.Schema.Table
+	}
+	return tenant, true
+}
+
+func (t *Tenancy) tenantField(db *gorm.DB) *schema.Field {
+	if !t.columnModels[db.Statement.Schema.ModelType] {
+		return nil
+	}
+	return db.Statement.Schema.LookUpField("TenantId")
+}
+
+func (t *Tenancy) scope(db *gorm.DB) {
+	tenant, ok := t.tenant(db)
+	if !ok {
+		return
+	}
+	if field := t.tenantField(db); field != nil {
+		db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+			clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: tenant},
+		}})
+	}
+}
+
+func (t *Tenancy) create(db *gorm.DB) {
+	tenant, ok := t.tenant(db)
+	if !ok {
+		return
+	}
+	field := t.tenantField(db)
+	if field == nil {
+		return
+	}
+	setTenant := func(rv reflect.Value) {
+		v, zero := field.ValueOf(db.Statement.Context, rv)
+		if zero {
+			_ = field.Set(db.Statement.Context, rv, tenant)
+		} else if v != tenant {
+			_ = db.AddError(ErrTenantMismatch)
+		}
+	}
+	switch rv := db.Statement.ReflectValue; rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			setTenant(reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		setTenant(rv)
+	}
+}
@@ -0,0 +1,61 @@
+package data_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/achuala/go-svc-extn/pkg/ctxkeys"
+	"github.com/achuala/go-svc-extn/pkg/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type tenantInvoice struct {
+	Id       int64
+	TenantId string
+	Amount   int
+}
+
+func TestTenancyColumn(t *testing.T) {
+	db := openTestDB(t, []interface{}{&tenantInvoice{}}, data.WithTenancy(data.WithTenantColumn(&tenantInvoice{})))
+	acme := ctxkeys.NewTenantContext(context.Background(), "acme")
+	globex := ctxkeys.NewTenantContext(context.Background(), "globex")
+
+	// creates get the tenant of the context
+	invoice := &tenantInvoice{Amount: 10}
+	require.NoError(t, db.WithContext(acme).Create(invoice).Error)
+	assert.Equal(t, "acme", invoice.TenantId)
+	require.NoError(t, db.WithContext(globex).Create(&tenantInvoice{Amount: 20}).Error)
+	err := db.WithContext(acme).Create(&tenantInvoice{TenantId: "globex", Amount: 30}).Error
+	assert.ErrorIs(t, err, data.ErrTenantMismatch)
+
+	amounts := func(ctx context.Context) []int {
+		var amounts []int
+		require.NoError(t, db.WithContext(ctx).Model(&tenantInvoice{}).Order("id").Pluck("amount", &amounts).Error)
+		return amounts
+	}
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		amounts []int
+	}{
+		{name: "tenant acme", ctx: acme, amounts: []int{10}},
+		{name: "tenant globex", ctx: globex, amounts: []int{20}},
+		{name: "without tenant scope", ctx: data.WithoutTenantScope(context.Background()), amounts: []int{10, 20}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.amounts, amounts(tt.ctx))
+		})
+	}
+
+	// updates and deletes only reach the rows of the tenant
+	require.NoError(t, db.WithContext(globex).Model(&tenantInvoice{}).Where("amount > ?", 0).Update("amount", 25).Error)
+	require.NoError(t, db.WithContext(globex).Where("amount > ?", 0).Delete(&tenantInvoice{}).Error)
+	assert.Equal(t, []int{10}, amounts(data.WithoutTenantScope(context.Background())))
+
+	// statements without tenant fail
+	var invoices []tenantInvoice
+	err = db.WithContext(context.Background()).Find(&invoices).Error
+	assert.ErrorIs(t, err, data.ErrMissingTenant)
+}
@@ -0,0 +1,228 @@
+// Package event provides an in-process bus for domain events. Subscribers are
+// matched by subject pattern and the events are forwarded to the registered
+// EventPublisher transports, e.g. a broker.
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/achuala/go-svc-extn/pkg/messaging"
+	"github.com/achuala/go-svc-extn/pkg/util/idgen"
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+// Event is a domain event about Entity, published on Subject.
+type Event[T any] struct {
+	Id      string
+	Subject string
+	Entity  T
+	Meta    map[string]string
+	Time    time.Time
+}
+
+// NewEvent returns an event with a new id, stamped with the current time.
+func NewEvent[T any](subject string, entity T) Event[T] {
+	return Event[T]{
+		Id:      idgen.NewId(),
+		Subject: subject,
+		Entity:  entity,
+		Meta:    map[string]string{},
+		Time:    time.Now(),
+	}
+}
+
+// Any returns e with the entity as any, as taken by EventBus.Publish.
+func (e Event[T]) Any() Event[any] {
+	return Event[any]{Id: e.Id, Subject: e.Subject, Entity: e.Entity, Meta: e.Meta, Time: e.Time}
+}
+
+// EventPublisher forwards the events of the bus to a transport.
+type EventPublisher interface {
+	Publish(ctx context.Context, event Event[any]) error
+}
+
+// EventBus publishes events to its subscribers and publishers.
+type EventBus interface {
+	Publish(ctx context.Context, event Event[any]) error
+}
+
+// ErrEntityType is returned to the publisher, or the error handler with async
+// dispatch, when an entity cannot be converted to the type of a subscriber.
+var ErrEntityType = errors.New("event: entity does not match the subscriber type")
+
+type subscription struct {
+	id      uint64
+	pattern string
+	handler func(ctx context.Context, event Event[any]) error
+}
+
+type busOptions struct {
+	publishers   []EventPublisher
+	async        bool
+	errorHandler func(ctx context.Context, event Event[any], err error)
+}
+
+// BusOption configures an EventBusImpl.
+type BusOption func(*busOptions)
+
+// WithPublishers forwards the published events to publishers, after the
+// subscribers were dispatched.
+func WithPublishers(publishers ...EventPublisher) BusOption {
+	return func(o *busOptions) {
+		o.publishers = append(o.publishers, publishers...)
+	}
+}
+
+// WithAsyncDispatch runs every subscriber on its own goroutine, Publish returns
+// without waiting for them and their errors go to the error handler. Wait with
+// Close for the subscribers still running.
+func WithAsyncDispatch() BusOption {
+	return func(o *busOptions) {
+		o.async = true
+	}
+}
+
+// WithErrorHandler sets the handler of the subscriber errors with async
+// dispatch, which logs them by default.
+func WithErrorHandler(fn func(ctx context.Context, event Event[any], err error)) BusOption {
+	return func(o *busOptions) {
+		o.errorHandler = fn
+	}
+}
+
+type EventBusImpl struct {
+	opts    busOptions
+	mu      sync.RWMutex
+	subs    []subscription
+	nextId  uint64
+	running sync.WaitGroup
+}
+
+var _ EventBus = (*EventBusImpl)(nil)
+
+// NewEventBus returns a bus dispatching synchronously unless WithAsyncDispatch is given.
+func NewEventBus(opts ...BusOption) *EventBusImpl {
+	o := busOptions{
+		errorHandler: func(ctx context.Context, event Event[any], err error) {
+			log.Errorf("event %s on %s failed: %v", event.Id, event.Subject, err)
+		},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &EventBusImpl{opts: o}
+}
+
+// Publish dispatches event to the subscribers whose pattern matches its subject,
+// in subscription order, then forwards it to the publishers. With synchronous
+// dispatch the errors of the subscribers and publishers are joined, the failure
+// of one does not stop the others.
+func (b *EventBusImpl) Publish(ctx context.Context, event Event[any]) error {
+	if event.Id == "" {
+		event.Id = idgen.NewId()
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	var errs []error
+	for _, sub := range b.matching(event.Subject) {
+		if b.opts.async {
+			b.running.Add(1)
+			go func() {
+				defer b.running.Done()
+				if err := sub.handler(context.WithoutCancel(ctx), event); err != nil {
+					b.opts.errorHandler(ctx, event, err)
+				}
+			}()
+			continue
+		}
+		if err := sub.handler(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, publisher := range b.opts.publishers {
+		if err := publisher.Publish(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (b *EventBusImpl) matching(subject string) []subscription {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	var subs []subscription
+	for _, sub := range b.subs {
+		if messaging.SubjectMatches(sub.pattern, subject) {
+			subs = append(subs, sub)
+		}
+	}
+	return subs
+}
+
+// Close waits for the subscribers running with async dispatch until ctx is done.
+func (b *EventBusImpl) Close(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		b.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *EventBusImpl) subscribe(pattern string, handler func(ctx context.Context, event Event[any]) error) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nextId++
+	id := b.nextId
+	b.subs = append(b.subs, subscription{id: id, pattern: pattern, handler: handler})
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for i, sub := range b.subs {
+			if sub.id == id {
+				b.subs = append(b.subs[:i:i], b.subs[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Subscribe registers handler for the events whose subject matches pattern,
+// which may use the NATS wildcards, * for one token and > for the remaining
+// ones. The entity is converted to T, through JSON when it is not a T already,
+// e.g. a map. It returns the function removing the subscription.
+func Subscribe[T any](bus *EventBusImpl, pattern string, handler func(ctx context.Context, event Event[T]) error) func() {
+	return bus.subscribe(pattern, func(ctx context.Context, event Event[any]) error {
+		entity, err := entityAs[T](event.Entity)
+		if err != nil {
+			return fmt.Errorf("event %s: %w", event.Id, err)
+		}
+		return handler(ctx, Event[T]{Id: event.Id, Subject: event.Subject, Entity: entity, Meta: event.Meta, Time: event.Time})
+	})
+}
+
+func entityAs[T any](entity any) (T, error) {
+	if typed, ok := entity.(T); ok {
+		return typed, nil
+	}
+	var typed T
+	data, err := json.Marshal(entity)
+	if err != nil {
+		return typed, fmt.Errorf("%w: %v", ErrEntityType, err)
+	}
+	if err := json.Unmarshal(data, &typed); err != nil {
+		return typed, fmt.Errorf("%w: %v", ErrEntityType, err)
+	}
+	return typed, nil
+}
@@ -0,0 +1,73 @@
+package event_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/achuala/go-svc-extn/pkg/event"
+)
+
+type orderCreated struct {
+	OrderId string `json:"orderId"`
+	Amount  int    `json:"amount"`
+}
+
+func TestSubscribe(t *testing.T) {
+	bus := event.NewEventBus()
+	var got []string
+	event.Subscribe(bus, "orders.created", func(ctx context.Context, e event.Event[orderCreated]) error {
+		got = append(got, "created:"+e.Entity.OrderId)
+		return nil
+	})
+	unsubscribe := event.Subscribe(bus, "orders.>", func(ctx context.Context, e event.Event[map[string]any]) error {
+		got = append(got, "any:"+e.Subject)
+		return nil
+	})
+
+	if err := bus.Publish(context.Background(), event.NewEvent("orders.created", orderCreated{OrderId: "o-1"}).Any()); err != nil {
+		t.Fatal(err)
+	}
+	// A map entity is converted to the subscriber type through JSON.
+	if err := bus.Publish(context.Background(), event.NewEvent[any]("orders.created", map[string]any{"orderId": "o-2"})); err != nil {
+		t.Fatal(err)
+	}
+	unsubscribe()
+	if err := bus.Publish(context.Background(), event.NewEvent[any]("orders.cancelled", nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"created:o-1", "any:orders.created", "created:o-2", "any:orders.created"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+}
+
+func TestAsyncDispatch(t *testing.T) {
+	failed := make(chan error, 1)
+	bus := event.NewEventBus(event.WithAsyncDispatch(), event.WithErrorHandler(func(ctx context.Context, e event.Event[any], err error) {
+		failed <- err
+	}))
+	event.Subscribe(bus, "orders.*", func(ctx context.Context, e event.Event[orderCreated]) error {
+		return errors.New("failed")
+	})
+	if err := bus.Publish(context.Background(), event.NewEvent[any]("orders.created", orderCreated{})); err != nil {
+		t.Fatalf("expected no error with async dispatch, got %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := bus.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-failed:
+	default:
+		t.Error("expected the subscriber error to reach the error handler")
+	}
+}
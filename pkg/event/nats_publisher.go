@@ -0,0 +1,101 @@
+package event
+
+import (
+	"context"
+
+	"github.com/achuala/go-svc-extn/pkg/messaging"
+	"github.com/achuala/go-svc-extn/pkg/messaging/nats"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+type natsPublisherOptions struct {
+	source    string
+	topic     func(event Event[any]) string
+	eventType func(event Event[any]) string
+	mode      messaging.ContentMode
+}
+
+// NatsPublisherOption configures the publisher of NewNatsPublisher.
+type NatsPublisherOption func(*natsPublisherOptions)
+
+// WithSource sets the CloudEvents source attribute, "go-svc-extn" by default.
+func WithSource(source string) NatsPublisherOption {
+	return func(o *natsPublisherOptions) {
+		o.source = source
+	}
+}
+
+// WithTopic sets the NATS subject an event is published on, its subject by default.
+func WithTopic(fn func(event Event[any]) string) NatsPublisherOption {
+	return func(o *natsPublisherOptions) {
+		o.topic = fn
+	}
+}
+
+// WithEventType sets the CloudEvents type attribute of an event, its subject by default.
+func WithEventType(fn func(event Event[any]) string) NatsPublisherOption {
+	return func(o *natsPublisherOptions) {
+		o.eventType = fn
+	}
+}
+
+// WithContentMode sets the CloudEvents content mode, structured by default. In
+// binary mode the attributes are carried as NATS headers next to the meta
+// entries and the entity is the payload.
+func WithContentMode(mode messaging.ContentMode) NatsPublisherOption {
+	return func(o *natsPublisherOptions) {
+		o.mode = mode
+	}
+}
+
+type natsPublisher struct {
+	publisher *nats.NatsJsPublisher
+	opts      natsPublisherOptions
+}
+
+// NewNatsPublisher returns an EventPublisher sending the events of the bus as
+// CloudEvents through jsPublisher, in structured mode unless WithContentMode
+// says otherwise. The id, subject and time of the event become the id, subject
+// and time attributes and the entity the JSON data, the meta entries are
+// carried as message headers. Consumers get the entity back with
+// messaging.Decode or messaging.TypedHandler, and the event with
+// messaging.ConsumeEvent.
+func NewNatsPublisher(jsPublisher *nats.NatsJsPublisher, opts ...NatsPublisherOption) EventPublisher {
+	o := natsPublisherOptions{
+		source: "go-svc-extn",
+		topic: func(event Event[any]) string {
+			return event.Subject
+		},
+		eventType: func(event Event[any]) string {
+			return event.Subject
+		},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &natsPublisher{publisher: jsPublisher, opts: o}
+}
+
+func (p *natsPublisher) Publish(ctx context.Context, event Event[any]) error {
+	ce := cloudevents.NewEvent()
+	ce.SetSpecVersion(cloudevents.VersionV1)
+	ce.SetID(event.Id)
+	ce.SetSource(p.opts.source)
+	ce.SetType(p.opts.eventType(event))
+	ce.SetSubject(event.Subject)
+	ce.SetTime(event.Time)
+	if err := ce.SetData(cloudevents.ApplicationJSON, event.Entity); err != nil {
+		return err
+	}
+	msg, err := messaging.EventMessage(ctx, &ce, p.opts.mode)
+	if err != nil {
+		return err
+	}
+	for k, v := range event.Meta {
+		// the attributes of the event win
+		if _, ok := msg.Metadata[k]; !ok {
+			msg.Metadata.Set(k, v)
+		}
+	}
+	return p.publisher.PublishMessage(p.opts.topic(event), msg)
+}
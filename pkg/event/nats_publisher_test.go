@@ -0,0 +1,104 @@
+package event_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	watermill_nats "github.com/ThreeDotsLabs/watermill-nats/v2/pkg/nats"
+	"github.com/achuala/go-svc-extn/pkg/event"
+	"github.com/achuala/go-svc-extn/pkg/messaging"
+	"github.com/achuala/go-svc-extn/pkg/messaging/nats"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/nats-io/nats-server/v2/server"
+	nc "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func TestNatsPublisher(t *testing.T) {
+	s, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, JetStream: true, StoreDir: t.TempDir(), NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatalf("failed to create nats server: %v", err)
+	}
+	go s.Start()
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server not ready")
+	}
+	defer s.Shutdown()
+	conn, err := nc.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	js, _ := jetstream.New(conn)
+	if _, err := js.CreateStream(context.Background(), jetstream.StreamConfig{Name: "EVENTS", Subjects: []string{"events.>"}}); err != nil {
+		t.Fatalf("failed to create stream: %v", err)
+	}
+	jsPublisher, closeFn, err := nats.NewNatsJsPublisher(&messaging.BrokerConfig{Address: s.ClientURL(), Timeout: 5 * time.Second}, log.DefaultLogger)
+	if err != nil {
+		t.Fatalf("failed to create publisher: %v", err)
+	}
+	defer closeFn()
+
+	tests := []struct {
+		name string
+		mode messaging.ContentMode
+	}{
+		{name: "structured", mode: messaging.StructuredMode},
+		{name: "binary", mode: messaging.BinaryMode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received := make(chan *nc.Msg, 1)
+			sub, err := conn.ChanSubscribe("events.>", received)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer sub.Unsubscribe()
+
+			publisher := event.NewNatsPublisher(jsPublisher,
+				event.WithSource("orders"),
+				event.WithContentMode(tt.mode),
+				event.WithTopic(func(e event.Event[any]) string { return "events." + e.Subject }),
+				event.WithEventType(func(e event.Event[any]) string { return "com.example." + e.Subject }),
+			)
+			e := event.NewEvent("orders.created", orderCreated{OrderId: "o-1", Amount: 5}).Any()
+			e.Meta = map[string]string{"tenant": "acme", messaging.ContentTypeKey: "text/plain"}
+			if err := publisher.Publish(context.Background(), e); err != nil {
+				t.Fatalf("failed to publish: %v", err)
+			}
+
+			var natsMsg *nc.Msg
+			select {
+			case natsMsg = <-received:
+			case <-time.After(5 * time.Second):
+				t.Fatal("event was not published")
+			}
+			if natsMsg.Subject != "events.orders.created" {
+				t.Errorf("expected subject events.orders.created, got %s", natsMsg.Subject)
+			}
+			msg, err := (&watermill_nats.NATSMarshaler{}).Unmarshal(natsMsg)
+			if err != nil {
+				t.Fatalf("failed to unmarshal: %v", err)
+			}
+			if got := msg.Metadata.Get("tenant"); got != "acme" {
+				t.Errorf("expected the meta entries as headers, got tenant=%s", got)
+			}
+			ce, err := messaging.ConsumeEvent(msg)
+			if err != nil {
+				t.Fatalf("failed to consume event: %v", err)
+			}
+			if ce.ID() != e.Id || ce.Source() != "orders" || ce.Type() != "com.example.orders.created" || ce.Subject() != "orders.created" || !ce.Time().Equal(e.Time) {
+				t.Errorf("unexpected event attributes %s", ce)
+			}
+			// the meta entries do not override the attributes of the event
+			if ce.DataContentType() != "application/json" {
+				t.Errorf("expected datacontenttype application/json, got %s", ce.DataContentType())
+			}
+			got, err := messaging.Decode[orderCreated](msg)
+			if err != nil || got.OrderId != "o-1" || got.Amount != 5 {
+				t.Errorf("unexpected entity %+v, %v", got, err)
+			}
+		})
+	}
+}
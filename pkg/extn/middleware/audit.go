@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"time"
+
+	"github.com/achuala/go-svc-extn/pkg/crypto"
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+)
+
+// AuditEvent is the audit record of a request.
+type AuditEvent struct {
+	Time      time.Time `json:"time"`
+	Component string    `json:"component"`
+	Operation string    `json:"operation"`
+	// Subject of the bearer token the request was authenticated with
+	UserId string `json:"user_id,omitempty"`
+	// Access key and institution of a signed request
+	AccessKeyId   string `json:"access_key_id,omitempty"`
+	InstitutionId string `json:"institution_id,omitempty"`
+	CorrelationId string `json:"correlation_id,omitempty"`
+	// Request with its sensitive fields handled as by the logging middleware
+	Request string `json:"request"`
+	// Error code and reason, 0 on success
+	Code    int32   `json:"code"`
+	Reason  string  `json:"reason,omitempty"`
+	Latency float64 `json:"latency"`
+}
+
+// AuditSink stores or forwards the audit events.
+type AuditSink interface {
+	Audit(ctx context.Context, event *AuditEvent) error
+}
+
+// AuditSinkFunc is an AuditSink function, e.g. inserting the events in a
+// database table.
+type AuditSinkFunc func(ctx context.Context, event *AuditEvent) error
+
+func (f AuditSinkFunc) Audit(ctx context.Context, event *AuditEvent) error {
+	return f(ctx, event)
+}
+
+// LogAuditSink writes the audit events to a logger, which should be a
+// dedicated one, not the debug log.
+func LogAuditSink(logger log.Logger) AuditSink {
+	return AuditSinkFunc(func(ctx context.Context, e *AuditEvent) error {
+		return log.WithContext(ctx, logger).Log(log.LevelInfo,
+			"time", e.Time.Format(time.RFC3339Nano),
+			"component", e.Component,
+			"op", e.Operation,
+			"user_id", e.UserId,
+			"access_key_id", e.AccessKeyId,
+			"institution_id", e.InstitutionId,
+			"correlation_id", e.CorrelationId,
+			"req", e.Request,
+			"code", e.Code,
+			"reason", e.Reason,
+			"latency", e.Latency,
+		)
+	})
+}
+
+// Publisher publishes raw messages, e.g. nats.NatsJsPublisher.
+type Publisher interface {
+	Publish(topic string, data []byte) error
+}
+
+// PublishAuditSink publishes the audit events as JSON to the topic.
+func PublishAuditSink(p Publisher, topic string) AuditSink {
+	return AuditSinkFunc(func(_ context.Context, e *AuditEvent) error {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		return p.Publish(topic, data)
+	})
+}
+
+// ServerAudit is a server middleware which sends an audit event to the sink
+// for the requests of the operations matching one of patterns, in the
+// path.Match syntax, all operations without patterns. Place it after the
+// authentication middlewares so that the caller is known. The options
+// configure the handling of the sensitive fields of the request, failures
+// of the sink are logged to logger and do not fail the request.
+func ServerAudit(logger log.Logger, sink AuditSink, patterns []string, opts ...LogOption) middleware.Middleware {
+	o := newLogOptions(opts)
+	audited := func(operation string) bool {
+		if len(patterns) == 0 {
+			return true
+		}
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, operation); ok {
+				return true
+			}
+		}
+		return false
+	}
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			tr, ok := transport.FromServerContext(ctx)
+			if !ok || !audited(tr.Operation()) {
+				return handler(ctx, req)
+			}
+			event := &AuditEvent{
+				Time:          time.Now(),
+				Component:     tr.Kind().String(),
+				Operation:     tr.Operation(),
+				CorrelationId: requestCorrelationId(ctx, tr),
+				Request:       extractArgs(req, o),
+			}
+			if claims, ok := crypto.JWTClaimsFromContext(ctx); ok {
+				event.UserId = claims.Subject
+			}
+			if key, ok := crypto.AccessKeyFromContext(ctx); ok {
+				event.AccessKeyId, event.InstitutionId = key.KeyId, key.InstitutionId
+			}
+			reply, err := handler(ctx, req)
+			event.Latency = time.Since(event.Time).Seconds()
+			if se := errors.FromError(err); se != nil {
+				event.Code, event.Reason = se.Code, se.Reason
+			}
+			if serr := sink.Audit(ctx, event); serr != nil {
+				_ = log.WithContext(ctx, logger).Log(log.LevelError,
+					"msg", "unable to audit the request",
+					"op", event.Operation,
+					"correlation_id", event.CorrelationId,
+					"error", serr.Error(),
+				)
+			}
+			return reply, err
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+
+	"github.com/achuala/go-svc-extn/pkg/crypto"
+	kerrors "github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingSink struct {
+	events []*AuditEvent
+	err    error
+}
+
+func (s *recordingSink) Audit(_ context.Context, e *AuditEvent) error {
+	s.events = append(s.events, e)
+	return s.err
+}
+
+func TestServerAuditPatterns(t *testing.T) {
+	tests := []struct {
+		name      string
+		patterns  []string
+		operation string
+		audited   bool
+	}{
+		{name: "all operations", operation: "/payments.v1.Payments/Charge", audited: true},
+		{name: "matching", patterns: []string{"/payments.v1.Payments/*"}, operation: "/payments.v1.Payments/Charge", audited: true},
+		{name: "second pattern", patterns: []string{"/ledger.v1.Ledger/*", "/payments.v1.Payments/Charge"}, operation: "/payments.v1.Payments/Charge", audited: true},
+		{name: "not matching", patterns: []string{"/payments.v1.Payments/*"}, operation: "/grpc.health.v1.Health/Check"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &recordingSink{}
+			handler := ServerAudit(&recordingLogger{}, sink, tt.patterns)(func(ctx context.Context, req interface{}) (interface{}, error) {
+				return "ok", nil
+			})
+			_, err := handler(transport.NewServerContext(context.Background(), newTestTransport(tt.operation, nil)), "req")
+			require.NoError(t, err)
+			assert.Equal(t, tt.audited, len(sink.events) == 1)
+		})
+	}
+}
+
+func TestServerAuditEvent(t *testing.T) {
+	sink := &recordingSink{}
+	handler := ServerAudit(&recordingLogger{}, sink, nil, WithMaxFieldBytes(8))(func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, kerrors.Forbidden("LIMIT_EXCEEDED", "limit exceeded")
+	})
+	tr := newTestTransport("/payments.v1.Payments/Charge", nil)
+	tr.header.Set(string(CtxCorrelationIdKey), "c-1")
+	ctx := transport.NewServerContext(context.Background(), tr)
+	ctx = crypto.NewJWTClaimsContext(ctx, &crypto.JWTClaims{Subject: "alice"})
+	ctx = crypto.NewAccessKeyContext(ctx, &crypto.APIAccessKey{KeyId: "AK1", InstitutionId: "bank-1", Secret: "s"})
+
+	_, err := handler(ctx, cardRequest{number: "4111111111111111"})
+	assert.Error(t, err)
+	require.Len(t, sink.events, 1)
+	event := sink.events[0]
+	assert.Equal(t, "grpc", event.Component)
+	assert.Equal(t, "/payments.v1.Payments/Charge", event.Operation)
+	assert.Equal(t, "alice", event.UserId)
+	assert.Equal(t, "AK1", event.AccessKeyId)
+	assert.Equal(t, "bank-1", event.InstitutionId)
+	assert.Equal(t, "c-1", event.CorrelationId)
+	// the request is redacted, then truncated
+	assert.Equal(t, "card ***...truncated(1KB)", event.Request)
+	assert.Equal(t, int32(403), event.Code)
+	assert.Equal(t, "LIMIT_EXCEEDED", event.Reason)
+	assert.False(t, event.Time.IsZero())
+}
+
+func TestServerAuditSinkFailure(t *testing.T) {
+	logger := &recordingLogger{}
+	sink := &recordingSink{err: assert.AnError}
+	handler := ServerAudit(logger, sink, nil)(func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	})
+	tr := newTestTransport("/payments.v1.Payments/Charge", nil)
+	reply, err := handler(transport.NewServerContext(context.Background(), tr), "req")
+	require.NoError(t, err, "a failure of the sink failed the request")
+	assert.Equal(t, "ok", reply)
+	require.Len(t, logger.entries, 1)
+	assert.Equal(t, log.LevelError, logger.entries[0].level)
+	assert.Equal(t, "/payments.v1.Payments/Charge", logger.entries[0].keyvals["op"])
+	assert.Equal(t, assert.AnError.Error(), logger.entries[0].keyvals["error"])
+}
@@ -0,0 +1,235 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+)
+
+// ErrCircuitOpen is returned by ClientCircuitBreaker without calling the
+// endpoint while its breaker is open.
+var ErrCircuitOpen = errors.ServiceUnavailable("CIRCUIT_OPEN", "circuit breaker of the endpoint is open")
+
+// BreakerState is the state of the circuit breaker of an endpoint.
+type BreakerState int
+
+const (
+	// BreakerClosed lets the calls through and tracks their error rate
+	BreakerClosed BreakerState = iota
+	// BreakerOpen rejects the calls until the open timeout elapses
+	BreakerOpen
+	// BreakerHalfOpen lets probe calls through to decide whether to close
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// BreakerPolicy configures ClientCircuitBreaker, the zero values select the
+// defaults.
+type BreakerPolicy struct {
+	// Rolling window of the error rate and its number of buckets, defaults
+	// 10s and 10
+	Window  time.Duration
+	Buckets int
+	// Minimum number of calls in the window before the breaker opens,
+	// default 20
+	MinRequests int
+	// Error rate of the window opening the breaker, default 0.5
+	ErrorRate float64
+	// How long the breaker stays open before probing, default 5s
+	OpenTimeout time.Duration
+	// Concurrent probe calls while half-open, the breaker closes after as
+	// many successes and opens again at the first failure. Default 1.
+	HalfOpenProbes int
+	// Failure reports whether an error counts as a failure of the endpoint,
+	// by default server errors (5xx) and connection failures. Calls canceled
+	// by the caller are not failures of the endpoint.
+	Failure func(err error) bool
+	// OnStateChange is called on every state change of the breaker of an
+	// endpoint, e.g. with LogBreakerStateChange or to update a gauge.
+	OnStateChange func(endpoint string, from, to BreakerState)
+}
+
+func (p BreakerPolicy) withDefaults() BreakerPolicy {
+	if p.Window <= 0 {
+		p.Window = 10 * time.Second
+	}
+	if p.Buckets <= 0 {
+		p.Buckets = 10
+	}
+	if p.MinRequests <= 0 {
+		p.MinRequests = 20
+	}
+	if p.ErrorRate <= 0 {
+		p.ErrorRate = 0.5
+	}
+	if p.OpenTimeout <= 0 {
+		p.OpenTimeout = 5 * time.Second
+	}
+	if p.HalfOpenProbes <= 0 {
+		p.HalfOpenProbes = 1
+	}
+	if p.Failure == nil {
+		p.Failure = func(err error) bool {
+			if errors.Is(err, context.Canceled) {
+				return false
+			}
+			return connectionFailure(err) || errors.FromError(err).Code >= 500
+		}
+	}
+	return p
+}
+
+// LogBreakerStateChange returns an OnStateChange hook logging the state
+// changes, at warn level when a breaker opens.
+func LogBreakerStateChange(logger log.Logger) func(endpoint string, from, to BreakerState) {
+	return func(endpoint string, from, to BreakerState) {
+		level := log.LevelInfo
+		if to == BreakerOpen {
+			level = log.LevelWarn
+		}
+		_ = logger.Log(level, "msg", "circuit breaker state changed", "endpoint", endpoint, "from", from.String(), "to", to.String())
+	}
+}
+
+// ClientCircuitBreaker is a client middleware which keeps a circuit breaker
+// per endpoint. A breaker opens when the error rate of the rolling window
+// exceeds the policy, the calls then fail with ErrCircuitOpen until the open
+// timeout elapses and probe calls succeed.
+func ClientCircuitBreaker(policy BreakerPolicy) middleware.Middleware {
+	p := policy.withDefaults()
+	var (
+		mu       sync.Mutex
+		breakers = make(map[string]*breaker)
+	)
+	get := func(endpoint string) *breaker {
+		mu.Lock()
+		defer mu.Unlock()
+		b, ok := breakers[endpoint]
+		if !ok {
+			b = &breaker{policy: &p, endpoint: endpoint, buckets: make([]breakerBucket, p.Buckets)}
+			breakers[endpoint] = b
+		}
+		return b
+	}
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			var endpoint string
+			if tr, ok := transport.FromClientContext(ctx); ok {
+				endpoint = tr.Endpoint()
+			}
+			b := get(endpoint)
+			probe, ok := b.allow(time.Now())
+			if !ok {
+				return nil, ErrCircuitOpen
+			}
+			reply, err := handler(ctx, req)
+			b.record(time.Now(), err != nil && p.Failure(err), probe)
+			return reply, err
+		}
+	}
+}
+
+type breakerBucket struct {
+	epoch    int64
+	total    int
+	failures int
+}
+
+type breaker struct {
+	policy   *BreakerPolicy
+	endpoint string
+
+	mu        sync.Mutex
+	state     BreakerState
+	openedAt  time.Time
+	buckets   []breakerBucket
+	probes    int
+	successes int
+}
+
+// allow returns whether a call may proceed and whether it is a probe.
+func (b *breaker) allow(now time.Time) (probe bool, ok bool) {
+	b.mu.Lock()
+	from := b.state
+	if b.state == BreakerOpen && now.Sub(b.openedAt) >= b.policy.OpenTimeout {
+		b.state, b.probes, b.successes = BreakerHalfOpen, 0, 0
+	}
+	switch b.state {
+	case BreakerClosed:
+		ok = true
+	case BreakerHalfOpen:
+		if b.probes < b.policy.HalfOpenProbes {
+			b.probes++
+			probe, ok = true, true
+		}
+	}
+	to := b.state
+	b.mu.Unlock()
+	b.notify(from, to)
+	return probe, ok
+}
+
+func (b *breaker) record(now time.Time, failed bool, probe bool) {
+	b.mu.Lock()
+	from := b.state
+	switch {
+	case probe && b.state == BreakerHalfOpen:
+		b.probes--
+		if failed {
+			b.open(now)
+		} else if b.successes++; b.successes >= b.policy.HalfOpenProbes {
+			b.state = BreakerClosed
+			clear(b.buckets)
+		}
+	case !probe && b.state == BreakerClosed:
+		width := int64(b.policy.Window) / int64(b.policy.Buckets)
+		epoch := now.UnixNano() / width
+		bucket := &b.buckets[epoch%int64(len(b.buckets))]
+		if bucket.epoch != epoch {
+			*bucket = breakerBucket{epoch: epoch}
+		}
+		bucket.total++
+		if failed {
+			bucket.failures++
+		}
+		var total, failures int
+		for _, bk := range b.buckets {
+			if epoch-bk.epoch < int64(len(b.buckets)) {
+				total += bk.total
+				failures += bk.failures
+			}
+		}
+		if total >= b.policy.MinRequests && float64(failures) >= b.policy.ErrorRate*float64(total) {
+			b.open(now)
+		}
+	}
+	to := b.state
+	b.mu.Unlock()
+	b.notify(from, to)
+}
+
+func (b *breaker) open(now time.Time) {
+	b.state, b.openedAt = BreakerOpen, now
+}
+
+func (b *breaker) notify(from, to BreakerState) {
+	if from != to && b.policy.OnStateChange != nil {
+		b.policy.OnStateChange(b.endpoint, from, to)
+	}
+}
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientCircuitBreakerOpens(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		calls  int
+		opened bool
+	}{
+		{name: "server errors", err: errors.ServiceUnavailable("UNAVAILABLE", "unavailable"), calls: 4, opened: true},
+		{name: "client errors", err: errors.BadRequest("INVALID", "invalid"), calls: 6},
+		{name: "canceled calls", err: fmt.Errorf("call orders: %w", context.Canceled), calls: 6},
+		{name: "successes", calls: 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := newTestTransport("/svc/Get", nil)
+			tr.endpoint = "orders:9000"
+			ctx := transport.NewClientContext(context.Background(), tr)
+			calls := 0
+			handler := ClientCircuitBreaker(BreakerPolicy{MinRequests: 4, OpenTimeout: time.Minute})(func(ctx context.Context, req interface{}) (interface{}, error) {
+				calls++
+				return nil, tt.err
+			})
+			var err error
+			for i := 0; i < 6; i++ {
+				_, err = handler(ctx, nil)
+			}
+			assert.Equal(t, tt.calls, calls)
+			assert.Equal(t, tt.opened, errors.Is(err, ErrCircuitOpen))
+		})
+	}
+}
+
+func TestClientCircuitBreakerHalfOpen(t *testing.T) {
+	tests := []struct {
+		name  string
+		probe error
+		state BreakerState
+	}{
+		{name: "probe succeeds", state: BreakerClosed},
+		{name: "probe fails", probe: errors.InternalServer("INTERNAL", "internal"), state: BreakerOpen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var changes []BreakerState
+			policy := BreakerPolicy{
+				MinRequests: 2,
+				OpenTimeout: 20 * time.Millisecond,
+				OnStateChange: func(endpoint string, from, to BreakerState) {
+					assert.Equal(t, "orders:9000", endpoint)
+					changes = append(changes, to)
+				},
+			}
+			tr := newTestTransport("/svc/Get", nil)
+			tr.endpoint = "orders:9000"
+			ctx := transport.NewClientContext(context.Background(), tr)
+			var next error = errors.ServiceUnavailable("UNAVAILABLE", "unavailable")
+			handler := ClientCircuitBreaker(policy)(func(ctx context.Context, req interface{}) (interface{}, error) {
+				return nil, next
+			})
+			for i := 0; i < 2; i++ {
+				_, _ = handler(ctx, nil)
+			}
+			_, err := handler(ctx, nil)
+			assert.ErrorIs(t, err, ErrCircuitOpen)
+
+			time.Sleep(policy.OpenTimeout)
+			next = tt.probe
+			_, err = handler(ctx, nil)
+			assert.Equal(t, tt.probe, err)
+			assert.Equal(t, []BreakerState{BreakerOpen, BreakerHalfOpen, tt.state}, changes)
+
+			_, err = handler(ctx, nil)
+			assert.Equal(t, tt.state == BreakerOpen, errors.Is(err, ErrCircuitOpen))
+		})
+	}
+}
+
+func TestClientCircuitBreakerPerEndpoint(t *testing.T) {
+	handler := ClientCircuitBreaker(BreakerPolicy{MinRequests: 1, OpenTimeout: time.Minute})(func(ctx context.Context, req interface{}) (interface{}, error) {
+		tr, _ := transport.FromClientContext(ctx)
+		if tr.Endpoint() == "failing:9000" {
+			return nil, errors.ServiceUnavailable("UNAVAILABLE", "unavailable")
+		}
+		return "ok", nil
+	})
+	call := func(endpoint string) error {
+		tr := newTestTransport("/svc/Get", nil)
+		tr.endpoint = endpoint
+		_, err := handler(transport.NewClientContext(context.Background(), tr), nil)
+		return err
+	}
+	assert.Error(t, call("failing:9000"))
+	assert.ErrorIs(t, call("failing:9000"), ErrCircuitOpen)
+	assert.NoError(t, call("healthy:9000"))
+}
@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/achuala/go-svc-extn/pkg/cache"
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+)
+
+// DebugCaptureHeader enables the capture of the payloads of a request when
+// set to true.
+const DebugCaptureHeader = "X-Debug-Capture"
+
+// CapturedPayload is the request and response of a captured request, with
+// their sensitive fields handled as by the logging middleware.
+type CapturedPayload struct {
+	Time          time.Time `json:"time"`
+	Operation     string    `json:"operation"`
+	CorrelationId string    `json:"correlation_id"`
+	Request       string    `json:"request"`
+	Response      string    `json:"response,omitempty"`
+	// Error code and reason, 0 on success
+	Code   int32  `json:"code"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// CaptureOption configures ServerDebugCapture.
+type CaptureOption func(*captureOptions)
+
+type captureOptions struct {
+	ttl     time.Duration
+	enabled func(ctx context.Context, operation string) bool
+	logOpts []LogOption
+}
+
+// WithCaptureTTL sets how long the payloads are kept, 15 minutes by default.
+func WithCaptureTTL(ttl time.Duration) CaptureOption {
+	return func(o *captureOptions) {
+		o.ttl = ttl
+	}
+}
+
+// WithCaptureFlag captures the requests for which enabled returns true, e.g.
+// a feature flag for an operation or a tenant, in addition to the ones with
+// the DebugCaptureHeader.
+func WithCaptureFlag(enabled func(ctx context.Context, operation string) bool) CaptureOption {
+	return func(o *captureOptions) {
+		o.enabled = enabled
+	}
+}
+
+// WithCaptureLogOptions configures the handling of the sensitive fields of
+// the captured payloads, see Server.
+func WithCaptureLogOptions(opts ...LogOption) CaptureOption {
+	return func(o *captureOptions) {
+		o.logOpts = append(o.logOpts, opts...)
+	}
+}
+
+// ServerDebugCapture is a server middleware which stores the payloads of the
+// requests with the DebugCaptureHeader, or enabled by WithCaptureFlag, in the
+// cache under their correlation id, so that they can be retrieved with
+// CapturedPayloadFromCache without raising the log levels. Place it after
+// ServerCorrelationIdInjector, requests without correlation id are not
+// captured. Failures of the cache are logged and do not fail the request.
+func ServerDebugCapture(store cache.Cache, opts ...CaptureOption) middleware.Middleware {
+	o := &captureOptions{ttl: 15 * time.Minute}
+	for _, opt := range opts {
+		opt(o)
+	}
+	lo := newLogOptions(o.logOpts)
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			tr, ok := transport.FromServerContext(ctx)
+			if !ok {
+				return handler(ctx, req)
+			}
+			capture, _ := strconv.ParseBool(tr.RequestHeader().Get(DebugCaptureHeader))
+			if !capture && o.enabled != nil {
+				capture = o.enabled(ctx, tr.Operation())
+			}
+			correlationId := requestCorrelationId(ctx, tr)
+			if !capture || correlationId == "" {
+				return handler(ctx, req)
+			}
+			payload := &CapturedPayload{
+				Time:          time.Now(),
+				Operation:     tr.Operation(),
+				CorrelationId: correlationId,
+				Request:       extractArgs(req, lo),
+			}
+			reply, err := handler(ctx, req)
+			if se := errors.FromError(err); se != nil {
+				payload.Code, payload.Reason = se.Code, se.Reason
+			} else {
+				payload.Response = extractArgs(reply, lo)
+			}
+			if serr := storeCapturedPayload(ctx, store, payload, o.ttl); serr != nil {
+				log.Errorf("unable to capture %s: %v", payload.Operation, serr)
+			}
+			return reply, err
+		}
+	}
+}
+
+func capturedPayloadKey(correlationId string) string {
+	return "capture:" + correlationId
+}
+
+func storeCapturedPayload(ctx context.Context, store cache.Cache, payload *CapturedPayload, ttl time.Duration) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return store.SetWithTTL(ctx, capturedPayloadKey(payload.CorrelationId), string(b), ttl)
+}
+
+// CapturedPayloadFromCache returns the payloads captured by
+// ServerDebugCapture for the correlation id.
+func CapturedPayloadFromCache(ctx context.Context, store cache.Cache, correlationId string) (*CapturedPayload, bool) {
+	v, ok := store.Get(ctx, capturedPayloadKey(correlationId))
+	if !ok {
+		return nil, false
+	}
+	payload := &CapturedPayload{}
+	if err := json.Unmarshal([]byte(v), payload); err != nil {
+		return nil, false
+	}
+	return payload, true
+}
@@ -0,0 +1,164 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	kerrors "github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// captureCache is a cache of the tests recording the TTLs, its writes fail
+// when err is set.
+type captureCache struct {
+	mu      sync.Mutex
+	entries map[string]string
+	ttls    map[string]time.Duration
+	err     error
+}
+
+func newCaptureCache() *captureCache {
+	return &captureCache{entries: map[string]string{}, ttls: map[string]time.Duration{}}
+}
+
+func (c *captureCache) Get(ctx context.Context, key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.entries[key]
+	return v, ok
+}
+
+func (c *captureCache) Set(ctx context.Context, key string, value string) error {
+	return c.SetWithTTL(ctx, key, value, 0)
+}
+
+func (c *captureCache) Delete(ctx context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+	return nil
+}
+
+func (c *captureCache) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	return nil
+}
+
+func (c *captureCache) SetWithTTL(ctx context.Context, key string, value string, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	c.entries[key], c.ttls[key] = value, ttl
+	return nil
+}
+
+type cardRequest struct{ number string }
+
+func (r cardRequest) Redact() string { return "card ****" + r.number[len(r.number)-4:] }
+
+func TestServerDebugCapture(t *testing.T) {
+	tests := []struct {
+		name          string
+		header        string
+		correlationId string
+		opts          []CaptureOption
+		err           error
+		captured      bool
+		ttl           time.Duration
+	}{
+		{name: "header", header: "true", correlationId: "corr-1", captured: true, ttl: 15 * time.Minute},
+		{name: "without header", correlationId: "corr-1"},
+		{name: "header false", header: "false", correlationId: "corr-1"},
+		{name: "without correlation id", header: "true"},
+		{
+			name:          "flag",
+			correlationId: "corr-1",
+			opts: []CaptureOption{WithCaptureTTL(time.Minute), WithCaptureFlag(func(ctx context.Context, operation string) bool {
+				return operation == "/svc/Pay"
+			})},
+			captured: true,
+			ttl:      time.Minute,
+		},
+		{
+			name:          "flag of another operation",
+			correlationId: "corr-1",
+			opts: []CaptureOption{WithCaptureFlag(func(ctx context.Context, operation string) bool {
+				return operation == "/svc/Refund"
+			})},
+		},
+		{name: "handler error", header: "true", correlationId: "corr-1", err: kerrors.BadRequest("CARD_DECLINED", "declined"), captured: true, ttl: 15 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newCaptureCache()
+			tr := newTestTransport("/svc/Pay", nil)
+			if tt.header != "" {
+				tr.header.Set(DebugCaptureHeader, tt.header)
+			}
+			ctx := context.Background()
+			if tt.correlationId != "" {
+				ctx = NewCorrelationIdContext(ctx, tt.correlationId)
+			}
+			handler := ServerDebugCapture(store, tt.opts...)(func(ctx context.Context, req interface{}) (interface{}, error) {
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return "paid", nil
+			})
+
+			_, err := handler(transport.NewServerContext(ctx, tr), cardRequest{number: "4111111111111111"})
+			assert.Equal(t, tt.err, err)
+			payload, ok := CapturedPayloadFromCache(context.Background(), store, "corr-1")
+			require.Equal(t, tt.captured, ok)
+			if !tt.captured {
+				return
+			}
+			assert.Equal(t, tt.ttl, store.ttls[capturedPayloadKey("corr-1")])
+			assert.Equal(t, "/svc/Pay", payload.Operation)
+			assert.Equal(t, "corr-1", payload.CorrelationId)
+			assert.Equal(t, "card ****1111", payload.Request)
+			if tt.err != nil {
+				assert.Equal(t, int32(400), payload.Code)
+				assert.Equal(t, "CARD_DECLINED", payload.Reason)
+				assert.Empty(t, payload.Response)
+			} else {
+				assert.Zero(t, payload.Code)
+				assert.Equal(t, "paid", payload.Response)
+			}
+		})
+	}
+}
+
+func TestServerDebugCaptureStoreFailure(t *testing.T) {
+	store := newCaptureCache()
+	store.err = errors.New("cache unavailable")
+	tr := newTestTransport("/svc/Pay", nil)
+	tr.header.Set(DebugCaptureHeader, "true")
+	tr.header.Set(string(CtxCorrelationIdKey), "corr-1")
+	handler := ServerDebugCapture(store)(func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "paid", nil
+	})
+
+	reply, err := handler(transport.NewServerContext(context.Background(), tr), "pay")
+	require.NoError(t, err)
+	assert.Equal(t, "paid", reply)
+	_, ok := CapturedPayloadFromCache(context.Background(), store, "corr-1")
+	assert.False(t, ok)
+}
+
+func TestServerDebugCaptureWithoutTransport(t *testing.T) {
+	store := newCaptureCache()
+	handler := ServerDebugCapture(store)(func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "paid", nil
+	})
+	reply, err := handler(NewCorrelationIdContext(context.Background(), "corr-1"), "pay")
+	require.NoError(t, err)
+	assert.Equal(t, "paid", reply)
+	assert.Empty(t, store.entries)
+}
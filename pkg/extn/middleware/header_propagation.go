@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"context"
+	"net/textproto"
+
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+)
+
+type propagatedHeadersKey struct{}
+
+// WithPropagatedHeader returns a context carrying the header, which the
+// client middlewares send on the outgoing requests.
+func WithPropagatedHeader(ctx context.Context, key, value string) context.Context {
+	headers := map[string]string{textproto.CanonicalMIMEHeaderKey(key): value}
+	for k, v := range PropagatedHeaders(ctx) {
+		if _, ok := headers[k]; !ok {
+			headers[k] = v
+		}
+	}
+	return context.WithValue(ctx, propagatedHeadersKey{}, headers)
+}
+
+// PropagatedHeaders returns the headers of the context propagated to the
+// outgoing requests, keyed by their canonical names. The map must not be
+// modified.
+func PropagatedHeaders(ctx context.Context) map[string]string {
+	headers, _ := ctx.Value(propagatedHeadersKey{}).(map[string]string)
+	return headers
+}
+
+// ServerHeaderPropagation is a server middleware which copies the allowed
+// headers of the request, e.g. x-feature-flags or accept-language, in the
+// context for ClientHeaderPropagation and ClientCorrelationIdInjector.
+func ServerHeaderPropagation(allowed ...string) middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			if tr, ok := transport.FromServerContext(ctx); ok {
+				for _, key := range allowed {
+					if v := tr.RequestHeader().Get(key); v != "" {
+						ctx = WithPropagatedHeader(ctx, key, v)
+					}
+				}
+			}
+			return handler(ctx, req)
+		}
+	}
+}
+
+// ClientHeaderPropagation is a client middleware which sets the propagated
+// headers of the context on the outgoing request.
+func ClientHeaderPropagation() middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			setPropagatedHeaders(ctx)
+			return handler(ctx, req)
+		}
+	}
+}
+
+func setPropagatedHeaders(ctx context.Context) {
+	headers := PropagatedHeaders(ctx)
+	if len(headers) == 0 {
+		return
+	}
+	if tr, ok := transport.FromClientContext(ctx); ok {
+		for k, v := range headers {
+			tr.RequestHeader().Set(k, v)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeaderPropagation(t *testing.T) {
+	tests := []struct {
+		name     string
+		allowed  []string
+		header   http.Header
+		expected map[string]string
+	}{
+		{
+			name:     "allowed headers",
+			allowed:  []string{"x-feature-flags", "Accept-Language"},
+			header:   http.Header{"X-Feature-Flags": {"beta"}, "Accept-Language": {"fr"}},
+			expected: map[string]string{"X-Feature-Flags": "beta", "Accept-Language": "fr"},
+		},
+		{
+			name:     "other headers",
+			allowed:  []string{"x-feature-flags"},
+			header:   http.Header{"X-Feature-Flags": {"beta"}, "Cookie": {"session=1"}},
+			expected: map[string]string{"X-Feature-Flags": "beta"},
+		},
+		{
+			name:    "missing headers",
+			allowed: []string{"x-feature-flags"},
+			header:  http.Header{"Cookie": {"session=1"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/v1/items", nil)
+			r.Header = tt.header
+			ctx := transport.NewServerContext(context.Background(), newTestTransport("", r))
+
+			client := newTestTransport("/svc/Get", nil)
+			handler := ServerHeaderPropagation(tt.allowed...)(func(ctx context.Context, req interface{}) (interface{}, error) {
+				if len(tt.expected) == 0 {
+					assert.Empty(t, PropagatedHeaders(ctx))
+				} else {
+					assert.Equal(t, tt.expected, PropagatedHeaders(ctx))
+				}
+				call := ClientHeaderPropagation()(func(ctx context.Context, req interface{}) (interface{}, error) {
+					return nil, nil
+				})
+				return call(transport.NewClientContext(ctx, client), req)
+			})
+			_, err := handler(ctx, nil)
+			assert.NoError(t, err)
+			for k, v := range tt.expected {
+				assert.Equal(t, v, client.RequestHeader().Get(k))
+			}
+			assert.Empty(t, client.RequestHeader().Get("Cookie"))
+		})
+	}
+}
+
+func TestWithPropagatedHeader(t *testing.T) {
+	ctx := WithPropagatedHeader(context.Background(), "x-tenant", "acme")
+	ctx = WithPropagatedHeader(ctx, "X-TENANT", "globex")
+	ctx = WithPropagatedHeader(ctx, "accept-language", "fr")
+	assert.Equal(t, map[string]string{"X-Tenant": "globex", "Accept-Language": "fr"}, PropagatedHeaders(ctx))
+}
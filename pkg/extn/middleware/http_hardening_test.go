@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPHardeningRequests(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		body        string
+		contentType string
+		status      int
+		called      bool
+	}{
+		{name: "without body", method: http.MethodGet, status: http.StatusOK, called: true},
+		{name: "json body", method: http.MethodPost, body: `{"amount":100}`, contentType: "application/json", status: http.StatusOK, called: true},
+		{name: "media type parameters", method: http.MethodPost, body: `{}`, contentType: "Application/JSON; charset=utf-8", status: http.StatusOK, called: true},
+		{name: "proto body", method: http.MethodPost, body: "\x08\x01", contentType: "application/proto", status: http.StatusOK, called: true},
+		{name: "body too large", method: http.MethodPost, body: strings.Repeat("x", 65), contentType: "application/json", status: http.StatusRequestEntityTooLarge},
+		{name: "other media type", method: http.MethodPost, body: "amount=100", contentType: "application/x-www-form-urlencoded", status: http.StatusUnsupportedMediaType},
+		{name: "without content type", method: http.MethodPost, body: `{}`, status: http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			handler := HTTPHardening(HardeningConfig{MaxBodyBytes: 64})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				b, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				assert.Equal(t, tt.body, string(b))
+			}))
+			var body io.Reader
+			if tt.body != "" {
+				body = strings.NewReader(tt.body)
+			}
+			r := httptest.NewRequest(tt.method, "/v1/payments", body)
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, tt.called, called)
+			assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+		})
+	}
+}
+
+func TestHTTPHardeningBodyWithoutLength(t *testing.T) {
+	var readErr error
+	handler := HTTPHardening(HardeningConfig{MaxBodyBytes: 64})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, readErr = io.ReadAll(r.Body)
+	}))
+	r := httptest.NewRequest(http.MethodPost, "/v1/payments", strings.NewReader(strings.Repeat("x", 65)))
+	r.ContentLength = -1
+	r.Header.Set("Content-Type", "application/json")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	var maxBytes *http.MaxBytesError
+	assert.True(t, errors.As(readErr, &maxBytes), "read past the limit: %v", readErr)
+}
+
+func TestHTTPHardeningHeaders(t *testing.T) {
+	tests := []struct {
+		name   string
+		config HardeningConfig
+		want   map[string]string
+	}{
+		{
+			name: "defaults",
+			want: map[string]string{
+				"Strict-Transport-Security": "max-age=31536000",
+				"Content-Security-Policy":   "default-src 'none'; frame-ancestors 'none'",
+				"X-Frame-Options":           "DENY",
+				"X-Content-Type-Options":    "nosniff",
+			},
+		},
+		{
+			name:   "configured",
+			config: HardeningConfig{HSTSMaxAge: time.Hour, HSTSIncludeSubdomains: true, ContentSecurityPolicy: "default-src 'self'", FrameOptions: "SAMEORIGIN"},
+			want: map[string]string{
+				"Strict-Transport-Security": "max-age=3600; includeSubDomains",
+				"Content-Security-Policy":   "default-src 'self'",
+				"X-Frame-Options":           "SAMEORIGIN",
+			},
+		},
+		{
+			name:   "omitted",
+			config: HardeningConfig{HSTSMaxAge: -1, ContentSecurityPolicy: "-"},
+			want: map[string]string{
+				"Strict-Transport-Security": "",
+				"Content-Security-Policy":   "",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := HTTPHardening(tt.config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			for name, value := range tt.want {
+				assert.Equal(t, value, w.Header().Get(name), name)
+			}
+		})
+	}
+}
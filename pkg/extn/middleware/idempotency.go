@@ -0,0 +1,209 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/achuala/go-svc-extn/pkg/cache"
+	"github.com/achuala/go-svc-extn/pkg/ctxkeys"
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// IdempotencyKeyHeader is the request header carrying the idempotency key,
+// replayed responses are marked with the IdempotentReplayedHeader.
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// Errors returned by ServerIdempotency
+var (
+	ErrMissingIdempotencyKey = errors.BadRequest("MISSING_IDEMPOTENCY_KEY", "idempotency key header is required")
+	ErrIdempotencyInProgress = errors.Conflict("IDEMPOTENCY_IN_PROGRESS", "a request with the same idempotency key is in progress")
+	ErrIdempotencyKeyReused  = errors.New(http.StatusUnprocessableEntity, "IDEMPOTENCY_KEY_REUSED", "idempotency key was used for a different request")
+	ErrIdempotencyStore      = errors.ServiceUnavailable("IDEMPOTENCY_STORE_UNAVAILABLE", "unable to claim the idempotency key")
+	ErrIdempotencyRecord     = errors.InternalServer("IDEMPOTENCY_RECORD_INVALID", "unable to read the idempotency record")
+)
+
+// IdempotencyStore is the cache holding the idempotency records, both the
+// local and the remote caches implement it.
+type IdempotencyStore interface {
+	cache.Cache
+	cache.Locker
+}
+
+// IdempotencyOption configures ServerIdempotency.
+type IdempotencyOption func(*idempotencyOptions)
+
+type idempotencyOptions struct {
+	ttl      time.Duration
+	lockTTL  time.Duration
+	required bool
+}
+
+// WithIdempotencyTTL sets how long the responses are replayed, 24 hours by
+// default.
+func WithIdempotencyTTL(ttl time.Duration) IdempotencyOption {
+	return func(o *idempotencyOptions) {
+		o.ttl = ttl
+	}
+}
+
+// WithIdempotencyLockTTL sets how long a request in progress holds its key,
+// 1 minute by default. It should exceed the request timeout, the key is
+// released earlier when the request fails.
+func WithIdempotencyLockTTL(ttl time.Duration) IdempotencyOption {
+	return func(o *idempotencyOptions) {
+		o.lockTTL = ttl
+	}
+}
+
+// WithIdempotencyKeyRequired rejects the requests without idempotency key
+// instead of passing them through.
+func WithIdempotencyKeyRequired() IdempotencyOption {
+	return func(o *idempotencyOptions) {
+		o.required = true
+	}
+}
+
+// idempotencyRecord is stored under the key, without response while the
+// first request is in progress.
+type idempotencyRecord struct {
+	Fingerprint string `json:"fp"`
+	Response    []byte `json:"resp,omitempty"`
+}
+
+// ServerIdempotency is a server middleware which executes the requests with
+// the same Idempotency-Key header once per operation. The first successful
+// proto response is stored in the cache and replayed for the retries, a
+// retry arriving while the first request is in progress is rejected with
+// ErrIdempotencyInProgress. Failed requests are not stored so they can be
+// retried. Reusing a key for a different request body fails with
+// ErrIdempotencyKeyReused.
+//
+// The keys are scoped to the tenant and the actor of the request, see
+// pkg/ctxkeys, so that a caller can't replay the response of another caller
+// with the same key. Place it after the authentication and tenant
+// middlewares, the unauthenticated requests share one scope.
+func ServerIdempotency(store IdempotencyStore, opts ...IdempotencyOption) middleware.Middleware {
+	o := &idempotencyOptions{ttl: 24 * time.Hour, lockTTL: time.Minute}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			tr, ok := transport.FromServerContext(ctx)
+			if !ok {
+				return handler(ctx, req)
+			}
+			key := tr.RequestHeader().Get(IdempotencyKeyHeader)
+			if key == "" {
+				if o.required {
+					return nil, ErrMissingIdempotencyKey
+				}
+				return handler(ctx, req)
+			}
+			fingerprint, err := requestFingerprint(req)
+			if err != nil {
+				return nil, err
+			}
+			cacheKey := "idempotency:" + idempotencyScope(ctx) + ":" + tr.Operation() + ":" + key
+			if v, found := store.Get(ctx, cacheKey); found {
+				return replayResponse(tr, v, fingerprint)
+			}
+			lock, err := json.Marshal(&idempotencyRecord{Fingerprint: fingerprint})
+			if err != nil {
+				return nil, err
+			}
+			claimed, err := store.SetNX(ctx, cacheKey, string(lock), o.lockTTL)
+			if err != nil {
+				return nil, ErrIdempotencyStore.WithCause(err)
+			}
+			if !claimed {
+				v, found := store.Get(ctx, cacheKey)
+				if !found {
+					return nil, ErrIdempotencyInProgress
+				}
+				return replayResponse(tr, v, fingerprint)
+			}
+
+			reply, err := handler(ctx, req)
+			msg, isProto := reply.(proto.Message)
+			if err != nil || !isProto {
+				_ = store.Delete(ctx, cacheKey)
+				return reply, err
+			}
+			if record, err := storedResponse(fingerprint, msg); err != nil || store.SetWithTTL(ctx, cacheKey, record, o.ttl) != nil {
+				_ = store.Delete(ctx, cacheKey)
+			}
+			return reply, nil
+		}
+	}
+}
+
+// idempotencyScope hashes the tenant and the actor of the request.
+func idempotencyScope(ctx context.Context) string {
+	tenant, _ := ctxkeys.TenantFromContext(ctx)
+	actor, _ := ctxkeys.ActorFromContext(ctx)
+	sum := sha256.Sum256([]byte(tenant + "\x00" + actor))
+	return hex.EncodeToString(sum[:16])
+}
+
+// requestFingerprint hashes the deterministic encoding of the request, so
+// that a key reused for another request is detected.
+func requestFingerprint(req interface{}) (string, error) {
+	msg, ok := req.(proto.Message)
+	if !ok {
+		return "", nil
+	}
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func storedResponse(fingerprint string, reply proto.Message) (string, error) {
+	resp, err := anypb.New(reply)
+	if err != nil {
+		return "", err
+	}
+	b, err := proto.Marshal(resp)
+	if err != nil {
+		return "", err
+	}
+	record, err := json.Marshal(&idempotencyRecord{Fingerprint: fingerprint, Response: b})
+	return string(record), err
+}
+
+func replayResponse(tr transport.Transporter, v string, fingerprint string) (interface{}, error) {
+	var record idempotencyRecord
+	if err := json.Unmarshal([]byte(v), &record); err != nil {
+		return nil, ErrIdempotencyRecord.WithCause(err)
+	}
+	if record.Fingerprint != fingerprint {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if len(record.Response) == 0 {
+		return nil, ErrIdempotencyInProgress
+	}
+	resp := &anypb.Any{}
+	if err := proto.Unmarshal(record.Response, resp); err != nil {
+		return nil, ErrIdempotencyRecord.WithCause(err)
+	}
+	reply, err := resp.UnmarshalNew()
+	if err != nil {
+		return nil, ErrIdempotencyRecord.WithCause(err)
+	}
+	tr.ReplyHeader().Set(IdempotentReplayedHeader, "true")
+	return reply, nil
+}
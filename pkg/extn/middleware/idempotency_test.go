@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+
+	"github.com/achuala/go-svc-extn/pkg/cache"
+	"github.com/achuala/go-svc-extn/pkg/ctxkeys"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestServerIdempotencyScope(t *testing.T) {
+	store, err, cleanup := cache.NewLocalCacheRistretto(&cache.CacheConfig{Mode: "local"})
+	require.NoError(t, err)
+	defer cleanup()
+
+	calls := 0
+	handler := ServerIdempotency(store)(func(ctx context.Context, req interface{}) (interface{}, error) {
+		calls++
+		actor, _ := ctxkeys.ActorFromContext(ctx)
+		return wrapperspb.String(actor), nil
+	})
+	call := func(tenant, actor string) (interface{}, *testTransport) {
+		tr := newTestTransport("/payments.v1.Payments/Create", nil)
+		tr.header.Set(IdempotencyKeyHeader, "key-1")
+		ctx := ctxkeys.NewActorContext(ctxkeys.NewTenantContext(context.Background(), tenant), actor)
+		reply, err := handler(transport.NewServerContext(ctx, tr), wrapperspb.String("pay 100"))
+		require.NoError(t, err)
+		return reply, tr
+	}
+
+	for _, tc := range []struct {
+		name, tenant, actor string
+		calls               int
+		replayed            bool
+	}{
+		{"first call", "t1", "alice", 1, false},
+		{"retry of the caller", "t1", "alice", 1, true},
+		{"same key by another actor", "t1", "mallory", 2, false},
+		{"same key in another tenant", "t2", "alice", 3, false},
+	} {
+		reply, tr := call(tc.tenant, tc.actor)
+		assert.Equal(t, tc.calls, calls, tc.name)
+		assert.Equal(t, tc.replayed, tr.replyHeader.Get(IdempotentReplayedHeader) == "true", tc.name)
+		assert.True(t, proto.Equal(wrapperspb.String(tc.actor), reply.(proto.Message)), tc.name)
+	}
+}
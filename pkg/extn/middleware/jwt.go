@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/achuala/go-svc-extn/pkg/crypto"
+	"github.com/achuala/go-svc-extn/pkg/ctxkeys"
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+)
+
+// Errors returned by ServerJWTAuth
+var (
+	ErrMissingBearerToken = errors.Unauthorized("MISSING_BEARER_TOKEN", "missing bearer token")
+	ErrInvalidBearerToken = errors.Unauthorized("INVALID_BEARER_TOKEN", "bearer token is not valid")
+)
+
+// JWTAuthConfig configures ServerJWTAuth.
+type JWTAuthConfig struct {
+	// JWKSURL is the jwks_uri of the OIDC provider.
+	JWKSURL string
+	// JWKSRefreshInterval is how long the signing keys are cached, defaults to 1h.
+	JWKSRefreshInterval time.Duration
+	// Issuers and Audiences are the accepted iss and aud claims.
+	Issuers   []string
+	Audiences []string
+	// ClockSkew is the leeway applied to exp, nbf and iat, defaults to 1m.
+	ClockSkew  time.Duration
+	Algorithms []string
+	// AllowMissingExpiry accepts the tokens without exp claim.
+	AllowMissingExpiry bool
+	// Keys overrides JWKSURL, e.g. to share one key set between servers.
+	Keys crypto.JWTKeySource
+}
+
+// ServerJWTAuth middleware authenticates requests with an OIDC or OAuth bearer
+// token in the Authorization header. The token signature is verified with the
+// keys of the JWKS URL and the exp, nbf, iss and aud claims are validated, the
+// tokens without exp are rejected unless AllowMissingExpiry is set.
+//
+// The claims are available to the handlers with crypto.JWTClaimsFromContext,
+// and the subject is the actor of the request, see ctxkeys.ActorFromContext.
+func ServerJWTAuth(cfg *JWTAuthConfig) middleware.Middleware {
+	keys := cfg.Keys
+	if keys == nil {
+		keys = crypto.NewJWKS(&crypto.JWKSConfig{URL: cfg.JWKSURL, RefreshInterval: cfg.JWKSRefreshInterval})
+	}
+	verifier := crypto.NewJWTVerifier(&crypto.JWTVerifierConfig{
+		Keys:               keys,
+		Issuers:            cfg.Issuers,
+		Audiences:          cfg.Audiences,
+		ClockSkew:          cfg.ClockSkew,
+		Algorithms:         cfg.Algorithms,
+		AllowMissingExpiry: cfg.AllowMissingExpiry,
+	})
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (reply interface{}, err error) {
+			tr, ok := transport.FromServerContext(ctx)
+			if !ok {
+				return handler(ctx, req)
+			}
+			token, ok := bearerToken(tr.RequestHeader().Get(string(CtxAuthorizationKey)))
+			if !ok {
+				return nil, ErrMissingBearerToken
+			}
+			claims, err := verifier.Verify(ctx, token)
+			if err != nil {
+				return nil, jwtError(err)
+			}
+			ctx = crypto.NewJWTClaimsContext(ctx, claims)
+			if claims.Subject != "" {
+				ctx = ctxkeys.NewActorContext(ctx, claims.Subject)
+			}
+			return handler(ctx, req)
+		}
+	}
+}
+
+// ServerBearerOrSignatureAuth dispatches requests with a bearer token to the
+// jwt middleware and all other requests to the signature middleware, so that
+// an endpoint can serve internal OIDC callers and signing partners alike.
+func ServerBearerOrSignatureAuth(jwt, signature middleware.Middleware) middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		bearer, signed := jwt(handler), signature(handler)
+		return func(ctx context.Context, req interface{}) (reply interface{}, err error) {
+			if tr, ok := transport.FromServerContext(ctx); ok {
+				if _, ok := bearerToken(tr.RequestHeader().Get(string(CtxAuthorizationKey))); ok {
+					return bearer(ctx, req)
+				}
+			}
+			return signed(ctx, req)
+		}
+	}
+}
+
+func bearerToken(authorization string) (string, bool) {
+	scheme, token, ok := strings.Cut(authorization, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// jwtError maps the verification error to the error returned to the client,
+// failures to fetch the signing keys are not the client's fault.
+func jwtError(err error) error {
+	for _, reason := range []error{
+		crypto.ErrMalformedToken, crypto.ErrUnsupportedTokenAlgorithm, crypto.ErrTokenSignature,
+		crypto.ErrTokenExpired, crypto.ErrTokenExpiryMissing, crypto.ErrTokenNotYetValid, crypto.ErrInvalidIssuer,
+		crypto.ErrInvalidAudience, crypto.ErrUnknownSigningKey,
+	} {
+		if errors.Is(err, reason) {
+			return ErrInvalidBearerToken.WithCause(err).WithMetadata(map[string]string{"failure": reason.Error()})
+		}
+	}
+	return errors.ServiceUnavailable("TOKEN_CHECK_FAILED", "unable to verify bearer token").WithCause(err)
+}
@@ -0,0 +1,147 @@
+package middleware
+
+import (
+	"context"
+	stdcrypto "crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/achuala/go-svc-extn/pkg/crypto"
+	"github.com/achuala/go-svc-extn/pkg/ctxkeys"
+	kerrors "github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testJWTKeys is a key source of the tests, the kid "down" fails like an
+// unreachable JWKS endpoint.
+type testJWTKeys map[string]stdcrypto.PublicKey
+
+func (k testJWTKeys) PublicKey(ctx context.Context, kid string) (stdcrypto.PublicKey, error) {
+	if kid == "down" {
+		return nil, errors.New("jwks unavailable")
+	}
+	key, ok := k[kid]
+	if !ok {
+		return nil, crypto.ErrUnknownSigningKey
+	}
+	return key, nil
+}
+
+func signTestJWT(t *testing.T, kid string, key ed25519.PrivateKey, claims map[string]any) string {
+	t.Helper()
+	header, err := json.Marshal(map[string]string{"alg": "EdDSA", "kid": kid, "typ": "JWT"})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return input + "." + base64.RawURLEncoding.EncodeToString(ed25519.Sign(key, []byte(input)))
+}
+
+func TestServerJWTAuth(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, other, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	mw := ServerJWTAuth(&JWTAuthConfig{Keys: testJWTKeys{"k1": public}, Issuers: []string{"https://idp"}, Audiences: []string{"payments"}})
+
+	now := time.Now()
+	claims := func(overrides map[string]any) map[string]any {
+		c := map[string]any{"iss": "https://idp", "sub": "svc-a", "aud": "payments", "exp": now.Add(time.Hour).Unix(), "scope": "read"}
+		for k, v := range overrides {
+			c[k] = v
+		}
+		return c
+	}
+	valid := signTestJWT(t, "k1", private, claims(nil))
+
+	tests := []struct {
+		name          string
+		authorization string
+		reason        string
+		failure       string
+	}{
+		{name: "valid token", authorization: "Bearer " + valid},
+		{name: "lower case scheme", authorization: "bearer " + valid},
+		{name: "missing header", reason: "MISSING_BEARER_TOKEN"},
+		{name: "other scheme", authorization: "Basic dXNlcjpwYXNz", reason: "MISSING_BEARER_TOKEN"},
+		{name: "empty token", authorization: "Bearer  ", reason: "MISSING_BEARER_TOKEN"},
+		{name: "malformed token", authorization: "Bearer not-a-jwt", reason: "INVALID_BEARER_TOKEN", failure: "MALFORMED_TOKEN"},
+		{name: "forged signature", authorization: "Bearer " + signTestJWT(t, "k1", other, claims(nil)), reason: "INVALID_BEARER_TOKEN", failure: "TOKEN_SIGNATURE_INVALID"},
+		{name: "expired", authorization: "Bearer " + signTestJWT(t, "k1", private, claims(map[string]any{"exp": now.Add(-time.Hour).Unix()})), reason: "INVALID_BEARER_TOKEN", failure: "TOKEN_EXPIRED"},
+		{name: "other audience", authorization: "Bearer " + signTestJWT(t, "k1", private, claims(map[string]any{"aud": "ledger"})), reason: "INVALID_BEARER_TOKEN", failure: "INVALID_AUDIENCE"},
+		{name: "unknown key", authorization: "Bearer " + signTestJWT(t, "k2", private, claims(nil)), reason: "INVALID_BEARER_TOKEN", failure: "UNKNOWN_SIGNING_KEY"},
+		{name: "keys unavailable", authorization: "Bearer " + signTestJWT(t, "down", private, claims(nil)), reason: "TOKEN_CHECK_FAILED"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			ctx := transport.NewServerContext(context.Background(), newTestTransport("/svc/Get", r))
+			called := false
+			reply, err := mw(func(ctx context.Context, req interface{}) (interface{}, error) {
+				called = true
+				c, ok := crypto.JWTClaimsFromContext(ctx)
+				require.True(t, ok, "handler context without claims")
+				assert.Equal(t, "svc-a", c.Subject)
+				assert.Equal(t, []string{"read"}, c.Scopes())
+				actor, _ := ctxkeys.ActorFromContext(ctx)
+				assert.Equal(t, "svc-a", actor)
+				return "ok", nil
+			})(ctx, nil)
+			if tt.reason == "" {
+				require.NoError(t, err)
+				assert.Equal(t, "ok", reply)
+				return
+			}
+			assert.False(t, called, "rejected request reached the handler")
+			e := kerrors.FromError(err)
+			assert.Equal(t, tt.reason, e.Reason)
+			assert.Equal(t, tt.failure, e.Metadata["failure"])
+		})
+	}
+
+	t.Run("without transport", func(t *testing.T) {
+		reply, err := mw(func(ctx context.Context, req interface{}) (interface{}, error) {
+			_, ok := crypto.JWTClaimsFromContext(ctx)
+			assert.False(t, ok)
+			return "ok", nil
+		})(context.Background(), nil)
+		require.NoError(t, err)
+		assert.Equal(t, "ok", reply)
+	})
+}
+
+func TestServerBearerOrSignatureAuth(t *testing.T) {
+	mark := func(name string) middleware.Middleware {
+		return func(handler middleware.Handler) middleware.Handler {
+			return func(ctx context.Context, req interface{}) (interface{}, error) {
+				return name, nil
+			}
+		}
+	}
+	mw := ServerBearerOrSignatureAuth(mark("jwt"), mark("signature"))
+	for authorization, want := range map[string]string{
+		"Bearer token":                       "jwt",
+		"creds=access-key:AK1/signature=abc": "signature",
+		"":                                   "signature",
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Authorization", authorization)
+		ctx := transport.NewServerContext(context.Background(), newTestTransport("/svc/Get", r))
+		reply, err := mw(func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil })(ctx, nil)
+		require.NoError(t, err)
+		assert.Equal(t, want, reply, authorization)
+	}
+}
@@ -2,149 +2,374 @@ package middleware
 
 import (
 	"context"
+	"crypto/rand"
 	"fmt"
+	mathrand "math/rand/v2"
+	"path"
+	"sort"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/achuala/go-svc-extn/gen/go/options"
+	"github.com/achuala/go-svc-extn/pkg/util/sensitive"
 	"github.com/go-kratos/kratos/v2/errors"
 	"github.com/go-kratos/kratos/v2/log"
 	"github.com/go-kratos/kratos/v2/middleware"
 	"github.com/go-kratos/kratos/v2/transport"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoreflect"
-	"google.golang.org/protobuf/types/descriptorpb"
 )
 
 type Redacter interface {
 	Redact() string
 }
 
+// LogOption configures the Server and Client logging middlewares.
+type LogOption func(*logOptions)
+
+type logOptions struct {
+	maskFuncs      map[string]MaskFunc
+	obfuscationKey []byte
+	maxFieldBytes  int
+	namesAbove     int
+	sampleRate     float64
+	levels         []operationLevel
+	slowThreshold  time.Duration
+	slowThresholds []operationThreshold
+}
+
+type operationLevel struct {
+	pattern string
+	level   log.Level
+	off     bool
+}
+
+type operationThreshold struct {
+	pattern   string
+	threshold time.Duration
+}
+
+// WithMaskFunc registers a mask function for the fields annotated with
+// masking name, it replaces the built in function of the same name.
+func WithMaskFunc(name string, fn MaskFunc) LogOption {
+	return func(o *logOptions) {
+		o.maskFuncs[name] = fn
+	}
+}
+
+// WithObfuscationKey sets the HMAC key of the obfuscated fields, services
+// sharing the key log the same hash for the same value. Without it the
+// middlewares of the process share a random key, so the hashes can only be
+// correlated within the process; set it to correlate them across services.
+func WithObfuscationKey(key []byte) LogOption {
+	return func(o *logOptions) {
+		o.obfuscationKey = key
+	}
+}
+
+// WithMaxFieldBytes truncates the string and bytes fields of the logged
+// messages, nested ones included, to n bytes followed by a
+// ...truncated(nKB) marker with the original size. Arguments which are not
+// proto messages are truncated as a whole.
+func WithMaxFieldBytes(n int) LogOption {
+	return func(o *logOptions) {
+		o.maxFieldBytes = n
+	}
+}
+
+// WithFieldNamesAbove logs only the names of the populated fields of the
+// messages whose encoded size exceeds n bytes.
+func WithFieldNamesAbove(n int) LogOption {
+	return func(o *logOptions) {
+		o.namesAbove = n
+	}
+}
+
+// WithSampleRate logs the given fraction, between 0 and 1, of the successful
+// requests, errors are always logged. All requests are logged by default.
+func WithSampleRate(rate float64) LogOption {
+	return func(o *logOptions) {
+		o.sampleRate = rate
+	}
+}
+
+// WithOperationLevel logs the successful requests of the operations matching
+// pattern at level instead of info. Patterns use the path.Match syntax, e.g.
+// /grpc.health.v1.Health/*, the first matching pattern applies.
+func WithOperationLevel(pattern string, level log.Level) LogOption {
+	return func(o *logOptions) {
+		o.levels = append(o.levels, operationLevel{pattern: pattern, level: level})
+	}
+}
+
+// WithOperationSilenced does not log the successful requests of the
+// operations matching pattern, see WithOperationLevel.
+func WithOperationSilenced(pattern string) LogOption {
+	return func(o *logOptions) {
+		o.levels = append(o.levels, operationLevel{pattern: pattern, off: true})
+	}
+}
+
+// WithSlowThreshold logs the requests taking longer than d at warn level,
+// unless they failed, with slow_request=true. Slow requests are logged even
+// when sampled out or silenced.
+func WithSlowThreshold(d time.Duration) LogOption {
+	return func(o *logOptions) {
+		o.slowThreshold = d
+	}
+}
+
+// WithOperationSlowThreshold overrides the slow threshold for the operations
+// matching pattern, see WithOperationLevel, 0 disables it.
+func WithOperationSlowThreshold(pattern string, d time.Duration) LogOption {
+	return func(o *logOptions) {
+		o.slowThresholds = append(o.slowThresholds, operationThreshold{pattern: pattern, threshold: d})
+	}
+}
+
+func newLogOptions(opts []LogOption) *logOptions {
+	o := &logOptions{sampleRate: 1, maskFuncs: map[string]MaskFunc{
+		"pan":   maskPAN,
+		"email": maskEmail,
+		"phone": maskPhone,
+	}}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if len(o.obfuscationKey) == 0 {
+		o.obfuscationKey = processObfuscationKey()
+	}
+	return o
+}
+
+// processObfuscationKey is the random obfuscation key shared by the Server and
+// Client middlewares without WithObfuscationKey, so that they log the same
+// hashes.
+var processObfuscationKey = sync.OnceValue(func() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+})
+
+// successLevel returns the level of a successful request of the operation,
+// false when it is not logged.
+func (o *logOptions) successLevel(operation string) (log.Level, bool) {
+	for _, l := range o.levels {
+		if ok, _ := path.Match(l.pattern, operation); ok {
+			if l.off {
+				return 0, false
+			}
+			return l.level, o.sampled()
+		}
+	}
+	return log.LevelInfo, o.sampled()
+}
+
+// slow reports whether a request of the operation which took latency exceeds
+// its slow threshold.
+func (o *logOptions) slow(operation string, latency time.Duration) bool {
+	threshold := o.slowThreshold
+	for _, t := range o.slowThresholds {
+		if ok, _ := path.Match(t.pattern, operation); ok {
+			threshold = t.threshold
+			break
+		}
+	}
+	return threshold > 0 && latency > threshold
+}
+
+func (o *logOptions) sampled() bool {
+	return o.sampleRate >= 1 || mathrand.Float64() < o.sampleRate
+}
+
 // Server is a server logging middleware.
-func Server(logger log.Logger) middleware.Middleware {
+func Server(logger log.Logger, opts ...LogOption) middleware.Middleware {
+	o := newLogOptions(opts)
 	return func(handler middleware.Handler) middleware.Handler {
 		return func(ctx context.Context, req interface{}) (reply interface{}, err error) {
-			return logMiddleware(ctx, req, handler, logger, "server")
+			return logMiddleware(ctx, req, handler, logger, "server", o)
 		}
 	}
 }
 
 // Client is a client logging middleware.
-func Client(logger log.Logger) middleware.Middleware {
+func Client(logger log.Logger, opts ...LogOption) middleware.Middleware {
+	o := newLogOptions(opts)
 	return func(handler middleware.Handler) middleware.Handler {
 		return func(ctx context.Context, req interface{}) (reply interface{}, err error) {
-			return logMiddleware(ctx, req, handler, logger, "client")
+			return logMiddleware(ctx, req, handler, logger, "client", o)
 		}
 	}
 }
 
-func logMiddleware(ctx context.Context, req interface{}, handler middleware.Handler, logger log.Logger, kind string) (reply interface{}, err error) {
+func logMiddleware(ctx context.Context, req interface{}, handler middleware.Handler, logger log.Logger, kind string, o *logOptions) (reply interface{}, err error) {
 	var (
 		code      int32
 		reason    string
 		operation string
 		component string
+		tr        transport.Transporter
 	)
 	startTime := time.Now()
 	if kind == "server" {
 		if info, ok := transport.FromServerContext(ctx); ok {
 			component = info.Kind().String()
 			operation = info.Operation()
+			tr = info
 		}
 	} else if kind == "client" {
 		if info, ok := transport.FromClientContext(ctx); ok {
 			component = info.Kind().String()
 			operation = info.Operation()
+			tr = info
 		}
 	}
 	reply, err = handler(ctx, req)
+	latency := time.Since(startTime)
 	if se := errors.FromError(err); se != nil {
 		code = se.Code
 		reason = se.Reason
 	}
 	level, stack := extractError(err)
-	_ = log.WithContext(ctx, logger).Log(level,
+	slow := o.slow(operation, latency)
+	if err == nil {
+		var ok bool
+		if level, ok = o.successLevel(operation); !ok && !slow {
+			return
+		}
+		if slow && level < log.LevelWarn {
+			level = log.LevelWarn
+		}
+	}
+	keyvals := []interface{}{
 		"kind", kind,
 		"component", component,
 		"op", operation,
-		"req", extractArgs(req),
-		"resp", extractArgs(reply),
+		"correlation_id", requestCorrelationId(ctx, tr),
+		"req", extractArgs(req, o),
+		"resp", extractArgs(reply, o),
 		"code", code,
 		"reason", reason,
 		"stack", stack,
-		"latency", time.Since(startTime).Seconds(),
-	)
+		"latency", latency.Seconds(),
+	}
+	if slow {
+		keyvals = append(keyvals, "slow_request", true)
+	}
+	_ = log.WithContext(ctx, logger).Log(level, keyvals...)
 	return
 }
 
 // extractArgs returns the string representation of the req
-func extractArgs(req interface{}) string {
+func extractArgs(req interface{}, o *logOptions) string {
 	switch v := req.(type) {
 	case proto.Message:
 		clone := proto.Clone(v)
-		handleSensitiveData(clone.ProtoReflect())
+		handleSensitiveData(clone.ProtoReflect(), o)
+		if size := proto.Size(clone); o.namesAbove > 0 && size > o.namesAbove {
+			return fieldNames(clone.ProtoReflect(), size)
+		}
+		if o.maxFieldBytes > 0 {
+			truncateFields(clone.ProtoReflect(), o.maxFieldBytes)
+		}
 		return fmt.Sprintf("%+v", clone)
 	case Redacter:
-		return v.Redact()
+		return truncate(v.Redact(), o.maxFieldBytes)
 	case fmt.Stringer:
-		return v.String()
+		return truncate(v.String(), o.maxFieldBytes)
 	default:
-		return fmt.Sprintf("%+v", req)
+		return truncate(fmt.Sprintf("%+v", req), o.maxFieldBytes)
 	}
 }
 
-// extractError returns the log level and string representation of the error
-func extractError(err error) (log.Level, string) {
-	if err != nil {
-		return log.LevelError, fmt.Sprintf("%+v", err)
-	}
-	return log.LevelInfo, ""
+// fieldNames describes a message by its type, populated fields and size.
+func fieldNames(m protoreflect.Message, size int) string {
+	var names []string
+	m.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		names = append(names, string(fd.Name()))
+		return true
+	})
+	sort.Strings(names)
+	return fmt.Sprintf("%s{%s} (%d bytes)", m.Descriptor().FullName(), strings.Join(names, " "), size)
 }
 
-func handleSensitiveData(m protoreflect.Message) {
+// truncateFields truncates the string and bytes values of m and of the
+// messages nested in m to max bytes.
+func truncateFields(m protoreflect.Message, max int) {
 	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
-		opts := fd.Options().(*descriptorpb.FieldOptions)
-
-		switch typed := v.Interface().(type) {
-		case protoreflect.Message:
-			handleSensitiveData(typed)
-		case protoreflect.Map:
-			typed.Range(func(key protoreflect.MapKey, value protoreflect.Value) bool {
+		switch {
+		case fd.IsMap():
+			v.Map().Range(func(_ protoreflect.MapKey, value protoreflect.Value) bool {
 				if msg, ok := value.Interface().(protoreflect.Message); ok {
-					handleSensitiveData(msg)
-				}
-				if msg, ok := key.Interface().(protoreflect.Message); ok {
-					handleSensitiveData(msg)
+					truncateFields(msg, max)
 				}
 				return true
 			})
-		case protoreflect.List:
-			for i := 0; i < typed.Len(); i++ {
-				if msg, ok := typed.Get(i).Interface().(protoreflect.Message); ok {
-					handleSensitiveData(msg)
+		case fd.IsList():
+			list := v.List()
+			for i := 0; i < list.Len(); i++ {
+				if msg, ok := list.Get(i).Interface().(protoreflect.Message); ok {
+					truncateFields(msg, max)
 				}
 			}
+		case fd.Message() != nil:
+			truncateFields(v.Message(), max)
 		}
-
-		ext := proto.GetExtension(opts, options.E_Sensitive)
-		extVal, ok := ext.(*options.Sensitive)
-		if !ok || extVal == nil {
-			return true
-		}
-
-		if extVal.GetRedact() || extVal.Pii {
-			m.Clear(fd)
-		} else if extVal.GetMask() {
-			m.Set(fd, protoreflect.ValueOfString(maskString(v.String())))
-		}
-
+		sensitive.Replace(m, fd, v, func(kind protoreflect.Kind, v protoreflect.Value) (protoreflect.Value, bool) {
+			switch kind {
+			case protoreflect.StringKind:
+				if len(v.String()) > max {
+					return protoreflect.ValueOfString(truncate(v.String(), max)), true
+				}
+			case protoreflect.BytesKind:
+				if len(v.Bytes()) > max {
+					return protoreflect.ValueOfBytes([]byte(truncate(string(v.Bytes()), max))), true
+				}
+			}
+			return v, false
+		})
 		return true
 	})
 }
 
-func maskString(value string) string {
-	if len(value) <= 4 {
-		return "****"
+// truncate cuts value to max bytes on a rune boundary, max 0 keeps it whole.
+func truncate(value string, max int) string {
+	if max <= 0 || len(value) <= max {
+		return value
+	}
+	n := max
+	for n > 0 && !utf8.RuneStart(value[n]) {
+		n--
+	}
+	return fmt.Sprintf("%s...truncated(%dKB)", value[:n], (len(value)+1023)/1024)
+}
+
+// extractError returns the log level and string representation of the error
+func extractError(err error) (log.Level, string) {
+	if err != nil {
+		return log.LevelError, fmt.Sprintf("%+v", err)
+	}
+	return log.LevelInfo, ""
+}
+
+func handleSensitiveData(m protoreflect.Message, o *logOptions) {
+	if opts := sensitive.MessageOptions(m.Descriptor()); opts.GetLogAction() != nil || opts.GetPii() {
+		m.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+			m.Clear(fd)
+			return true
+		})
+		return
 	}
-	return strings.Repeat("*", len(value)-4) + value[len(value)-4:]
+	_ = sensitive.Walk(m, func(m protoreflect.Message, fd protoreflect.FieldDescriptor, v protoreflect.Value, opts *options.Sensitive) error {
+		if opts.GetRedact() || opts.Pii {
+			m.Clear(fd)
+		} else if opts.GetMask() || opts.GetObfuscate() {
+			o.scrubField(m, fd, v, opts)
+		}
+		return nil
+	})
 }
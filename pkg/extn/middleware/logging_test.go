@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+type logEntry struct {
+	level   log.Level
+	keyvals map[interface{}]interface{}
+}
+
+type recordingLogger struct {
+	entries []logEntry
+}
+
+func (l *recordingLogger) Log(level log.Level, keyvals ...interface{}) error {
+	entry := logEntry{level: level, keyvals: map[interface{}]interface{}{}}
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		entry.keyvals[keyvals[i]] = keyvals[i+1]
+	}
+	l.entries = append(l.entries, entry)
+	return nil
+}
+
+func TestObfuscationKey(t *testing.T) {
+	first, second := newLogOptions(nil), newLogOptions(nil)
+	assert.Len(t, first.obfuscationKey, 32)
+	assert.Equal(t, first.obfuscationKey, second.obfuscationKey)
+
+	key := []byte("shared-across-services")
+	assert.Equal(t, key, newLogOptions([]LogOption{WithObfuscationKey(key)}).obfuscationKey)
+}
+
+func TestServerLoggingLevels(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []LogOption
+		operation string
+		err       error
+		delay     time.Duration
+		logged    bool
+		level     log.Level
+		slow      bool
+	}{
+		{name: "default", operation: "/svc/Get", logged: true, level: log.LevelInfo},
+		{name: "sampled out", opts: []LogOption{WithSampleRate(0)}, operation: "/svc/Get"},
+		{name: "sampled out error", opts: []LogOption{WithSampleRate(0)}, operation: "/svc/Get", err: errors.InternalServer("INTERNAL", "internal"), logged: true, level: log.LevelError},
+		{name: "operation level", opts: []LogOption{WithOperationLevel("/grpc.health.v1.Health/*", log.LevelDebug)}, operation: "/grpc.health.v1.Health/Check", logged: true, level: log.LevelDebug},
+		{name: "other operation", opts: []LogOption{WithOperationLevel("/grpc.health.v1.Health/*", log.LevelDebug)}, operation: "/svc/Get", logged: true, level: log.LevelInfo},
+		{name: "first pattern applies", opts: []LogOption{WithOperationSilenced("/svc/*"), WithOperationLevel("/svc/Get", log.LevelDebug)}, operation: "/svc/Get"},
+		{name: "silenced", opts: []LogOption{WithOperationSilenced("/grpc.health.v1.Health/*")}, operation: "/grpc.health.v1.Health/Check"},
+		{name: "silenced error", opts: []LogOption{WithOperationSilenced("/svc/*")}, operation: "/svc/Get", err: errors.BadRequest("INVALID", "invalid"), logged: true, level: log.LevelError},
+		{name: "slow", opts: []LogOption{WithSlowThreshold(time.Millisecond)}, operation: "/svc/Get", delay: 5 * time.Millisecond, logged: true, level: log.LevelWarn, slow: true},
+		{name: "slow silenced", opts: []LogOption{WithSlowThreshold(time.Millisecond), WithOperationSilenced("/svc/*")}, operation: "/svc/Get", delay: 5 * time.Millisecond, logged: true, level: log.LevelWarn, slow: true},
+		{name: "slow sampled out", opts: []LogOption{WithSlowThreshold(time.Millisecond), WithSampleRate(0)}, operation: "/svc/Get", delay: 5 * time.Millisecond, logged: true, level: log.LevelWarn, slow: true},
+		{name: "slow threshold of the operation", opts: []LogOption{WithSlowThreshold(time.Millisecond), WithOperationSlowThreshold("/svc/*", 0)}, operation: "/svc/Get", delay: 5 * time.Millisecond, logged: true, level: log.LevelInfo},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := &recordingLogger{}
+			ctx := transport.NewServerContext(context.Background(), newTestTransport(tt.operation, nil))
+			handler := Server(logger, tt.opts...)(func(ctx context.Context, req interface{}) (interface{}, error) {
+				time.Sleep(tt.delay)
+				return "ok", tt.err
+			})
+			_, _ = handler(ctx, "req")
+			if !tt.logged {
+				assert.Empty(t, logger.entries)
+				return
+			}
+			if assert.Len(t, logger.entries, 1) {
+				entry := logger.entries[0]
+				assert.Equal(t, tt.level, entry.level)
+				assert.Equal(t, tt.operation, entry.keyvals["op"])
+				_, slow := entry.keyvals["slow_request"]
+				assert.Equal(t, tt.slow, slow)
+			}
+		})
+	}
+}
+
+func TestSampleRate(t *testing.T) {
+	tests := []struct {
+		name     string
+		rate     float64
+		min, max int
+	}{
+		{name: "all", rate: 1, min: 1000, max: 1000},
+		{name: "none", rate: 0, min: 0, max: 0},
+		{name: "tenth", rate: 0.1, min: 50, max: 150},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newLogOptions([]LogOption{WithSampleRate(tt.rate)})
+			logged := 0
+			for i := 0; i < 1000; i++ {
+				if _, ok := o.successLevel("/svc/Get"); ok {
+					logged++
+				}
+			}
+			assert.GreaterOrEqual(t, logged, tt.min)
+			assert.LessOrEqual(t, logged, tt.max)
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		max      int
+		expected string
+	}{
+		{name: "unlimited", value: "abcdef", expected: "abcdef"},
+		{name: "short", value: "abc", max: 4, expected: "abc"},
+		{name: "long", value: "abcdef", max: 4, expected: "abcd...truncated(1KB)"},
+		{name: "rune boundary", value: "aé€", max: 4, expected: "aé...truncated(1KB)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, extractArgs(tt.value, newLogOptions([]LogOption{WithMaxFieldBytes(tt.max)})))
+		})
+	}
+}
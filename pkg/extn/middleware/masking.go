@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"unicode"
+
+	"github.com/achuala/go-svc-extn/gen/go/options"
+	"github.com/achuala/go-svc-extn/pkg/util/sensitive"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// MaskFunc returns the masked value of a field logged by the logging
+// middlewares, see WithMaskFunc.
+type MaskFunc func(value string) string
+
+// mask applies the masking of the field, the first of name, token and email
+// which is set, otherwise keep_first and keep_last. Without masking, or with
+// an unknown name, the last 4 characters are kept.
+func (o *logOptions) mask(value string, m *options.Masking) string {
+	switch {
+	case m.GetName() != "":
+		if fn, ok := o.maskFuncs[m.GetName()]; ok {
+			return fn(value)
+		}
+	case m.GetToken() != "":
+		return m.GetToken()
+	case m.GetEmail():
+		return maskEmail(value)
+	case m.GetKeepFirst() > 0 || m.GetKeepLast() > 0:
+		return maskKeep(value, int(m.GetKeepFirst()), int(m.GetKeepLast()))
+	}
+	return maskKeep(value, 0, 4)
+}
+
+// maskKeep keeps the first and last characters of the value, values which
+// are not longer than what is kept are masked entirely.
+func maskKeep(value string, first, last int) string {
+	r := []rune(value)
+	if len(r) <= first+last {
+		return "****"
+	}
+	return string(r[:first]) + strings.Repeat("*", len(r)-first-last) + string(r[len(r)-last:])
+}
+
+// maskDigits keeps the first and last digits of the value and its
+// separators, e.g. spaces and dashes.
+func maskDigits(value string, first, last int) string {
+	digits := 0
+	for _, c := range value {
+		if unicode.IsDigit(c) {
+			digits++
+		}
+	}
+	if digits <= first+last {
+		return "****"
+	}
+	var b strings.Builder
+	i := 0
+	for _, c := range value {
+		if unicode.IsDigit(c) {
+			if i >= first && i < digits-last {
+				c = '*'
+			}
+			i++
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// maskPAN keeps the BIN and the last 4 digits of a card number.
+func maskPAN(value string) string {
+	return maskDigits(value, 6, 4)
+}
+
+// maskPhone keeps the last 4 digits of a phone number.
+func maskPhone(value string) string {
+	return maskDigits(value, 0, 4)
+}
+
+// maskEmail masks the local part of an email address and keeps the domain.
+func maskEmail(value string) string {
+	at := strings.LastIndexByte(value, '@')
+	if at < 0 {
+		return maskKeep(value, 0, 4)
+	}
+	return "****" + value[at:]
+}
+
+// obfuscate returns a short keyed hash of the value, equal values give equal
+// hashes so that requests can be correlated without logging the value.
+func (o *logOptions) obfuscate(value []byte) string {
+	mac := hmac.New(sha256.New, o.obfuscationKey)
+	mac.Write(value)
+	return "h:" + hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// scrubField masks or obfuscates the string and bytes values of a field,
+// lists and maps included. Other fields, messages included, are cleared as
+// their values can't be masked.
+func (o *logOptions) scrubField(m protoreflect.Message, fd protoreflect.FieldDescriptor, v protoreflect.Value, opts *options.Sensitive) {
+	scrub := func(value string) string {
+		if opts.GetObfuscate() {
+			return o.obfuscate([]byte(value))
+		}
+		return o.mask(value, opts.GetMasking())
+	}
+	switch fd.Kind() {
+	case protoreflect.StringKind, protoreflect.BytesKind:
+	default:
+		if !fd.IsMap() {
+			m.Clear(fd)
+			return
+		}
+	}
+	sensitive.Replace(m, fd, v, func(kind protoreflect.Kind, v protoreflect.Value) (protoreflect.Value, bool) {
+		switch kind {
+		case protoreflect.StringKind:
+			return protoreflect.ValueOfString(scrub(v.String())), true
+		case protoreflect.BytesKind:
+			return protoreflect.ValueOfBytes([]byte(scrub(string(v.Bytes())))), true
+		}
+		return v, false
+	})
+}
@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Metrics returns a middleware recording the rate, errors and duration of
+// the requests, labeled by kind (server or client), component (the
+// transport) and operation:
+//
+//   - rpc.requests, the number of requests
+//   - rpc.errors, the number of failed requests by error code and reason
+//   - rpc.duration, the latency of the requests in seconds
+//
+// The same middleware serves the server and client chains, export it to
+// Prometheus with the OpenTelemetry Prometheus exporter.
+func Metrics(meter metric.Meter) (middleware.Middleware, error) {
+	requests, err := meter.Int64Counter("rpc.requests",
+		metric.WithDescription("Number of requests by kind, component and operation"))
+	if err != nil {
+		return nil, err
+	}
+	failures, err := meter.Int64Counter("rpc.errors",
+		metric.WithDescription("Number of failed requests by kind, component, operation, code and reason"))
+	if err != nil {
+		return nil, err
+	}
+	duration, err := meter.Float64Histogram("rpc.duration", metric.WithUnit("s"),
+		metric.WithDescription("Latency of the requests by kind, component and operation"),
+		metric.WithExplicitBucketBoundaries(0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10))
+	if err != nil {
+		return nil, err
+	}
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			attrs := requestAttributes(ctx)
+			startTime := time.Now()
+			reply, err := handler(ctx, req)
+			duration.Record(ctx, time.Since(startTime).Seconds(), metric.WithAttributes(attrs...))
+			requests.Add(ctx, 1, metric.WithAttributes(attrs...))
+			if se := errors.FromError(err); se != nil {
+				failures.Add(ctx, 1, metric.WithAttributes(append(attrs,
+					attribute.String("code", strconv.Itoa(int(se.Code))),
+					attribute.String("reason", se.Reason))...))
+			}
+			return reply, err
+		}
+	}, nil
+}
+
+// requestAttributes returns the kind, component and operation of the
+// request. The client context is looked up first, calls made while serving
+// a request carry both.
+func requestAttributes(ctx context.Context) []attribute.KeyValue {
+	kind, info := "server", transport.Transporter(nil)
+	if ci, ok := transport.FromClientContext(ctx); ok {
+		kind, info = "client", ci
+	} else if si, ok := transport.FromServerContext(ctx); ok {
+		info = si
+	}
+	var component, operation string
+	if info != nil {
+		component, operation = info.Kind().String(), info.Operation()
+	}
+	return []attribute.KeyValue{
+		attribute.String("kind", kind),
+		attribute.String("component", component),
+		attribute.String("operation", operation),
+	}
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// collectedPoints returns the values of the data points of the metrics by
+// name and attributes, the count of the histograms.
+func collectedPoints(t *testing.T, reader sdkmetric.Reader) map[string]map[string]int64 {
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	points := map[string]map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			values := map[string]int64{}
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				for _, dp := range data.DataPoints {
+					values[dp.Attributes.Encoded(attribute.DefaultEncoder())] = dp.Value
+				}
+			case metricdata.Histogram[float64]:
+				for _, dp := range data.DataPoints {
+					values[dp.Attributes.Encoded(attribute.DefaultEncoder())] = int64(dp.Count)
+				}
+			}
+			points[m.Name] = values
+		}
+	}
+	return points
+}
+
+func TestMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	m, err := Metrics(provider.Meter("test"))
+	require.NoError(t, err)
+	handler := m(func(ctx context.Context, req interface{}) (interface{}, error) {
+		if req == "fail" {
+			return nil, errors.ServiceUnavailable("LEDGER_UNAVAILABLE", "ledger is unavailable")
+		}
+		return "ok", nil
+	})
+
+	server := transport.NewServerContext(context.Background(), newTestTransport("/payments.v1.Payments/Charge", nil))
+	_, err = handler(server, "pay")
+	require.NoError(t, err)
+	_, err = handler(server, "fail")
+	require.Error(t, err)
+	// the calls made while serving a request are labeled as client calls
+	client := transport.NewClientContext(server, newTestTransport("/ledger.v1.Ledger/Post", nil))
+	_, err = handler(client, "fail")
+	require.Error(t, err)
+
+	serverAttrs := "component=grpc,kind=server,operation=/payments.v1.Payments/Charge"
+	clientAttrs := "component=grpc,kind=client,operation=/ledger.v1.Ledger/Post"
+	points := collectedPoints(t, reader)
+	assert.Equal(t, map[string]int64{serverAttrs: 2, clientAttrs: 1}, points["rpc.requests"])
+	assert.Equal(t, map[string]int64{serverAttrs: 2, clientAttrs: 1}, points["rpc.duration"])
+	assert.Equal(t, map[string]int64{
+		"code=503," + serverAttrs + ",reason=LEDGER_UNAVAILABLE": 1,
+		"code=503," + clientAttrs + ",reason=LEDGER_UNAVAILABLE": 1,
+	}, points["rpc.errors"])
+}
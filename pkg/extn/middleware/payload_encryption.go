@@ -0,0 +1,227 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/achuala/go-svc-extn/pkg/crypto"
+	"github.com/go-kratos/kratos/v2/errors"
+)
+
+// PayloadEncoding is the Content-Encoding of payloads encrypted with the AEAD
+// keyset of crypto.CryptoUtil. The client sends it as Content-Encoding of the
+// request body and as Accept-Encoding to ask for an encrypted response.
+const PayloadEncoding = "aead-tink"
+
+// Errors returned by the ClientPayloadEncryption transport
+var (
+	ErrPlainPayload             = errors.New(http.StatusBadGateway, "PLAIN_PAYLOAD", "response payload is not encrypted")
+	ErrPayloadDecryptionFailure = errors.New(http.StatusBadGateway, "PAYLOAD_DECRYPTION_FAILED", "unable to decrypt response payload")
+	ErrPayloadTooLarge          = errors.New(http.StatusBadGateway, "PAYLOAD_TOO_LARGE", "response payload is too large")
+)
+
+// defaultMaxResponseBytes bounds the encrypted responses read by
+// ClientPayloadEncryption, see WithMaxResponseBytes.
+const defaultMaxResponseBytes = 16 << 20
+
+// PayloadEncryptionOption configures ServerPayloadEncryption and
+// ClientPayloadEncryption.
+type PayloadEncryptionOption func(*payloadEncryptionOptions)
+
+type payloadEncryptionOptions struct {
+	required         bool
+	maxResponseBytes int64
+}
+
+// WithPayloadEncryptionRequired rejects plain requests on the server, and
+// plain responses on the client, instead of passing them through.
+func WithPayloadEncryptionRequired() PayloadEncryptionOption {
+	return func(o *payloadEncryptionOptions) {
+		o.required = true
+	}
+}
+
+// WithMaxResponseBytes bounds the size of the encrypted responses the client
+// reads, default 16MB. Larger responses fail with ErrPayloadTooLarge.
+func WithMaxResponseBytes(n int64) PayloadEncryptionOption {
+	return func(o *payloadEncryptionOptions) {
+		o.maxResponseBytes = n
+	}
+}
+
+// The payloads are bound to the method and path of the request so that an
+// encrypted body cannot be replayed on another endpoint. Gateways between
+// the client and the server must not rewrite the path.
+func requestAd(method, path string) []byte {
+	return []byte("request " + method + " " + path)
+}
+
+func responseAd(method, path string) []byte {
+	return []byte("response " + method + " " + path)
+}
+
+// ServerPayloadEncryption is an HTTP filter which decrypts request bodies
+// sent with the PayloadEncoding content encoding, up to maxBytes, and
+// encrypts the response, including errors, when the client accepts it.
+// Register it with http.Filter, the body is decoded before and the reply
+// encoded after the Kratos middlewares so they cannot do it themselves.
+func ServerPayloadEncryption(cu *crypto.CryptoUtil, maxBytes int64, opts ...PayloadEncryptionOption) func(http.Handler) http.Handler {
+	o := &payloadEncryptionOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encrypted := strings.EqualFold(r.Header.Get("Content-Encoding"), PayloadEncoding)
+			hasBody := r.Body != nil && r.Body != http.NoBody
+			if !encrypted && o.required && (hasBody || !acceptsPayloadEncoding(r.Header)) {
+				http.Error(w, "payload encryption required", http.StatusUnsupportedMediaType)
+				return
+			}
+			if encrypted && hasBody {
+				body, err := io.ReadAll(io.LimitReader(r.Body, maxBytes+1))
+				_ = r.Body.Close()
+				if err != nil {
+					http.Error(w, "unable to read request body", http.StatusBadRequest)
+					return
+				}
+				if int64(len(body)) > maxBytes {
+					http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+					return
+				}
+				plain, err := cu.Decrypt(r.Context(), string(body), requestAd(r.Method, r.URL.Path))
+				if err != nil {
+					http.Error(w, "unable to decrypt request body", http.StatusBadRequest)
+					return
+				}
+				r.Body = io.NopCloser(bytes.NewReader(plain))
+				r.ContentLength = int64(len(plain))
+				r.Header.Del("Content-Encoding")
+				r.Header.Set("Content-Length", strconv.Itoa(len(plain)))
+			}
+			w.Header().Add("Vary", "Accept-Encoding")
+			if !acceptsPayloadEncoding(r.Header) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ew := &encryptingResponseWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(ew, r)
+			cipherText, err := cu.Encrypt(r.Context(), ew.body.Bytes(), responseAd(r.Method, r.URL.Path))
+			if err != nil {
+				w.Header().Del("Content-Type")
+				http.Error(w, "unable to encrypt response", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Encoding", PayloadEncoding)
+			w.Header().Set("Content-Length", strconv.Itoa(len(cipherText)))
+			w.WriteHeader(ew.status)
+			_, _ = io.WriteString(w, cipherText)
+		})
+	}
+}
+
+func acceptsPayloadEncoding(h http.Header) bool {
+	for _, v := range h.Values("Accept-Encoding") {
+		for _, enc := range strings.Split(v, ",") {
+			if name, _, _ := strings.Cut(enc, ";"); strings.EqualFold(strings.TrimSpace(name), PayloadEncoding) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// encryptingResponseWriter buffers the response so that it can be encrypted
+// as a whole once the handler returns.
+type encryptingResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (w *encryptingResponseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status, w.wroteHeader = status, true
+	}
+}
+
+func (w *encryptingResponseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.body.Write(b)
+}
+
+// ClientPayloadEncryption returns a transport which encrypts the request
+// bodies with the AEAD keyset and decrypts the responses encrypted by
+// ServerPayloadEncryption, both sides share the keyset. Use it with
+// http.WithTransport of the Kratos client, base defaults to
+// http.DefaultTransport.
+func ClientPayloadEncryption(cu *crypto.CryptoUtil, base http.RoundTripper, opts ...PayloadEncryptionOption) http.RoundTripper {
+	o := &payloadEncryptionOptions{maxResponseBytes: defaultMaxResponseBytes}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &payloadEncryptionTransport{cu: cu, base: base, o: o}
+}
+
+type payloadEncryptionTransport struct {
+	cu   *crypto.CryptoUtil
+	base http.RoundTripper
+	o    *payloadEncryptionOptions
+}
+
+func (t *payloadEncryptionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	out := req.Clone(ctx)
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		cipherText, err := t.cu.Encrypt(ctx, body, requestAd(req.Method, req.URL.Path))
+		if err != nil {
+			return nil, err
+		}
+		out.Body = io.NopCloser(strings.NewReader(cipherText))
+		out.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(strings.NewReader(cipherText)), nil }
+		out.ContentLength = int64(len(cipherText))
+		out.Header.Set("Content-Encoding", PayloadEncoding)
+	}
+	out.Header.Set("Accept-Encoding", PayloadEncoding)
+
+	resp, err := t.base.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(resp.Header.Get("Content-Encoding"), PayloadEncoding) {
+		if t.o.required {
+			_ = resp.Body.Close()
+			return nil, ErrPlainPayload
+		}
+		return resp, nil
+	}
+	cipherText, err := io.ReadAll(io.LimitReader(resp.Body, t.o.maxResponseBytes+1))
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(cipherText)) > t.o.maxResponseBytes {
+		return nil, ErrPayloadTooLarge
+	}
+	plain, err := t.cu.Decrypt(ctx, string(cipherText), responseAd(req.Method, req.URL.Path))
+	if err != nil {
+		return nil, ErrPayloadDecryptionFailure.WithCause(err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(plain))
+	resp.ContentLength = int64(len(plain))
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Set("Content-Length", strconv.Itoa(len(plain)))
+	return resp, nil
+}
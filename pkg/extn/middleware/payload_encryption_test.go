@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/achuala/go-svc-extn/pkg/crypto"
+	"github.com/achuala/go-svc-extn/pkg/crypto/encdec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCryptoUtil(t *testing.T) *crypto.CryptoUtil {
+	kekUri, err := encdec.NewKeyURI()
+	require.NoError(t, err)
+	keysetData, err := encdec.NewKeyset(kekUri, nil)
+	require.NoError(t, err)
+	cu, err := crypto.NewCryptoUtil(&crypto.CryptoConfig{KmsUri: kekUri, KeysetData: keysetData})
+	require.NoError(t, err)
+	return cu
+}
+
+// echoHandler replies with the request body it received.
+var echoHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = io.WriteString(w, "echo:"+string(body))
+})
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+// wireTransport records the encodings of the requests and responses on the
+// wire.
+func wireTransport(encodings *[]string) http.RoundTripper {
+	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		resp, err := http.DefaultTransport.RoundTrip(r)
+		if err == nil {
+			*encodings = append(*encodings, r.Header.Get("Content-Encoding"), resp.Header.Get("Content-Encoding"))
+		}
+		return resp, err
+	})
+}
+
+func post(t *testing.T, client *http.Client, url, body string) (*http.Response, string, error) {
+	resp, err := client.Post(url, "text/plain", strings.NewReader(body))
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(b), nil
+}
+
+func TestPayloadEncryptionRoundTrip(t *testing.T) {
+	cu := newTestCryptoUtil(t)
+	srv := httptest.NewServer(ServerPayloadEncryption(cu, 1024, WithPayloadEncryptionRequired())(echoHandler))
+	defer srv.Close()
+
+	var encodings []string
+	client := &http.Client{Transport: ClientPayloadEncryption(cu, wireTransport(&encodings), WithPayloadEncryptionRequired())}
+	resp, body, err := post(t, client, srv.URL+"/v1/echo", "hello")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "echo:hello", body)
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, []string{PayloadEncoding, PayloadEncoding}, encodings)
+
+	// a request without body asks for an encrypted response
+	encodings = nil
+	resp, err = client.Get(srv.URL + "/v1/echo")
+	require.NoError(t, err)
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "echo:", string(b))
+	assert.Equal(t, []string{"", PayloadEncoding}, encodings)
+}
+
+func TestPayloadEncryptionRequired(t *testing.T) {
+	cu := newTestCryptoUtil(t)
+	srv := httptest.NewServer(ServerPayloadEncryption(cu, 1024, WithPayloadEncryptionRequired())(echoHandler))
+	defer srv.Close()
+
+	// plain requests are rejected by the server
+	resp, _, err := post(t, srv.Client(), srv.URL+"/v1/echo", "hello")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+	resp, err = srv.Client().Get(srv.URL + "/v1/echo")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+
+	// plain responses are rejected by the client
+	plain := httptest.NewServer(echoHandler)
+	defer plain.Close()
+	client := &http.Client{Transport: ClientPayloadEncryption(cu, nil, WithPayloadEncryptionRequired())}
+	_, _, err = post(t, client, plain.URL+"/v1/echo", "hello")
+	assert.ErrorIs(t, err, ErrPlainPayload)
+
+	// and passed through otherwise
+	client = &http.Client{Transport: ClientPayloadEncryption(cu, nil)}
+	_, body, err := post(t, client, plain.URL+"/v1/echo", "hello")
+	require.NoError(t, err)
+	assert.NotContains(t, body, "hello", "the request body was sent in plain")
+}
+
+func TestPayloadEncryptionReplayedBody(t *testing.T) {
+	cu := newTestCryptoUtil(t)
+	srv := httptest.NewServer(ServerPayloadEncryption(cu, 1024)(echoHandler))
+	defer srv.Close()
+
+	// capture the encrypted body of a request to /v1/echo
+	var cipherText string
+	capture := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		b, _ := io.ReadAll(r.Body)
+		cipherText = string(b)
+		return &http.Response{StatusCode: http.StatusNoContent, Header: http.Header{}, Body: http.NoBody}, nil
+	})
+	client := &http.Client{Transport: ClientPayloadEncryption(cu, capture)}
+	_, _, err := post(t, client, srv.URL+"/v1/echo", "hello")
+	require.NoError(t, err)
+	require.NotEmpty(t, cipherText)
+
+	send := func(path string) int {
+		req, err := http.NewRequest(http.MethodPost, srv.URL+path, strings.NewReader(cipherText))
+		require.NoError(t, err)
+		req.Header.Set("Content-Encoding", PayloadEncoding)
+		resp, err := srv.Client().Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusOK, send("/v1/echo"))
+	assert.Equal(t, http.StatusBadRequest, send("/v1/transfer"), "the body was accepted on another path")
+}
+
+func TestPayloadEncryptionLimits(t *testing.T) {
+	cu := newTestCryptoUtil(t)
+	srv := httptest.NewServer(ServerPayloadEncryption(cu, 64)(echoHandler))
+	defer srv.Close()
+
+	client := &http.Client{Transport: ClientPayloadEncryption(cu, nil)}
+	resp, _, err := post(t, client, srv.URL+"/v1/echo", strings.Repeat("x", 64))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+
+	client = &http.Client{Transport: ClientPayloadEncryption(cu, nil, WithMaxResponseBytes(16))}
+	_, _, err = post(t, client, srv.URL+"/v1/echo", "hello")
+	assert.ErrorIs(t, err, ErrPayloadTooLarge)
+}
@@ -0,0 +1,154 @@
+package middleware
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"slices"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/middleware"
+	khttp "github.com/go-kratos/kratos/v2/transport/http"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// Errors returned by ServerPeerIdentity
+var (
+	ErrMissingClientCertificate = errors.Unauthorized("MISSING_CLIENT_CERTIFICATE", "client certificate is required")
+	ErrPeerNotAllowed           = errors.Forbidden("PEER_NOT_ALLOWED", "client certificate identity is not allowed")
+)
+
+// PeerIdentity is the identity of the client certificate of a mutual TLS
+// connection.
+type PeerIdentity struct {
+	// SPIFFE ID of the URI SAN, e.g. spiffe://example.org/ns/payments/sa/api,
+	// empty when the certificate has none
+	SpiffeId    string
+	TrustDomain string
+	CommonName  string
+}
+
+// Name returns the SPIFFE ID of the peer, else its common name.
+func (p *PeerIdentity) Name() string {
+	if p.SpiffeId != "" {
+		return p.SpiffeId
+	}
+	return p.CommonName
+}
+
+type peerIdentityContextKey struct{}
+
+// NewPeerIdentityContext returns a context carrying the peer identity.
+func NewPeerIdentityContext(ctx context.Context, identity *PeerIdentity) context.Context {
+	return context.WithValue(ctx, peerIdentityContextKey{}, identity)
+}
+
+// PeerIdentityFromContext returns the identity of the peer, as set by
+// ServerPeerIdentity.
+func PeerIdentityFromContext(ctx context.Context) (*PeerIdentity, bool) {
+	identity, ok := ctx.Value(peerIdentityContextKey{}).(*PeerIdentity)
+	return identity, ok
+}
+
+// PeerOption configures ServerPeerIdentity.
+type PeerOption func(*peerOptions)
+
+type peerOptions struct {
+	allowed      []string
+	trustDomains []string
+	required     bool
+}
+
+// WithAllowedPeers accepts only the peers whose SPIFFE ID or, without one,
+// common name is in names.
+func WithAllowedPeers(names ...string) PeerOption {
+	return func(o *peerOptions) {
+		o.allowed = append(o.allowed, names...)
+	}
+}
+
+// WithTrustDomains accepts only the peers with a SPIFFE ID in one of the
+// trust domains, e.g. example.org.
+func WithTrustDomains(domains ...string) PeerOption {
+	return func(o *peerOptions) {
+		o.trustDomains = append(o.trustDomains, domains...)
+	}
+}
+
+// WithClientCertificateRequired rejects the requests without client
+// certificate, otherwise they pass through, e.g. to be authenticated by their
+// signature.
+func WithClientCertificateRequired() PeerOption {
+	return func(o *peerOptions) {
+		o.required = true
+	}
+}
+
+// allows reports whether the options accept the peer, the peers of both an
+// allowed name and trust domain are accepted.
+func (o *peerOptions) allows(identity *PeerIdentity) bool {
+	if len(o.allowed) == 0 && len(o.trustDomains) == 0 {
+		return true
+	}
+	return slices.Contains(o.allowed, identity.Name()) ||
+		(identity.SpiffeId != "" && slices.Contains(o.trustDomains, identity.TrustDomain))
+}
+
+// ServerPeerIdentity is a server middleware which puts the identity of the
+// client certificate of the gRPC or HTTP connection in the context, see
+// PeerIdentityFromContext, for the internal mesh traffic. The certificate
+// chain is verified by the TLS configuration of the server, which must
+// verify the client certificates, this middleware only checks the identity
+// against the allowed peers and trust domains.
+func ServerPeerIdentity(opts ...PeerOption) middleware.Middleware {
+	o := &peerOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			cert := peerCertificate(ctx)
+			if cert == nil {
+				if o.required {
+					return nil, ErrMissingClientCertificate
+				}
+				return handler(ctx, req)
+			}
+			identity := certificateIdentity(cert)
+			if !o.allows(identity) {
+				return nil, ErrPeerNotAllowed
+			}
+			return handler(NewPeerIdentityContext(ctx, identity), req)
+		}
+	}
+}
+
+// peerCertificate returns the verified leaf certificate of the client of the
+// gRPC or HTTP request, nil without one.
+func peerCertificate(ctx context.Context) *x509.Certificate {
+	var state *tls.ConnectionState
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			state = &info.State
+		}
+	} else if r, ok := khttp.RequestFromServerContext(ctx); ok {
+		state = r.TLS
+	}
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return state.VerifiedChains[0][0]
+}
+
+func certificateIdentity(cert *x509.Certificate) *PeerIdentity {
+	identity := &PeerIdentity{CommonName: cert.Subject.CommonName}
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" {
+			identity.SpiffeId = uri.String()
+			identity.TrustDomain = uri.Host
+			break
+		}
+	}
+	return identity
+}
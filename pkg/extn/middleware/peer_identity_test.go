@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	khttp "github.com/go-kratos/kratos/v2/transport/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+func testPeerCertificate(commonName, spiffeId string) *x509.Certificate {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+	if spiffeId != "" {
+		uri, _ := url.Parse(spiffeId)
+		cert.URIs = []*url.URL{{Scheme: "https", Host: "payments.example.org"}, uri}
+	}
+	return cert
+}
+
+// grpcPeerContext returns the context of a gRPC request over a TLS
+// connection with the verified client certificate, without one when cert is
+// nil.
+func grpcPeerContext(cert *x509.Certificate) context.Context {
+	state := tls.ConnectionState{}
+	if cert != nil {
+		state.VerifiedChains = [][]*x509.Certificate{{cert}}
+	}
+	return peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{State: state}})
+}
+
+func TestServerPeerIdentity(t *testing.T) {
+	spiffe := testPeerCertificate("api", "spiffe://example.org/ns/payments/sa/api")
+	plain := testPeerCertificate("ledger", "")
+	foreign := testPeerCertificate("api", "spiffe://other.org/ns/payments/sa/api")
+
+	tests := []struct {
+		name     string
+		opts     []PeerOption
+		cert     *x509.Certificate
+		err      error
+		identity *PeerIdentity
+	}{
+		{name: "without certificate"},
+		{name: "without certificate required", opts: []PeerOption{WithClientCertificateRequired()}, err: ErrMissingClientCertificate},
+		{name: "spiffe id", cert: spiffe, identity: &PeerIdentity{SpiffeId: "spiffe://example.org/ns/payments/sa/api", TrustDomain: "example.org", CommonName: "api"}},
+		{name: "common name", cert: plain, identity: &PeerIdentity{CommonName: "ledger"}},
+		{name: "allowed spiffe id", opts: []PeerOption{WithAllowedPeers("spiffe://example.org/ns/payments/sa/api")}, cert: spiffe, identity: &PeerIdentity{SpiffeId: "spiffe://example.org/ns/payments/sa/api", TrustDomain: "example.org", CommonName: "api"}},
+		{name: "common name of a spiffe peer", opts: []PeerOption{WithAllowedPeers("api")}, cert: spiffe, err: ErrPeerNotAllowed},
+		{name: "allowed common name", opts: []PeerOption{WithAllowedPeers("ledger")}, cert: plain, identity: &PeerIdentity{CommonName: "ledger"}},
+		{name: "other common name", opts: []PeerOption{WithAllowedPeers("ledger")}, cert: testPeerCertificate("mallory", ""), err: ErrPeerNotAllowed},
+		{name: "trust domain", opts: []PeerOption{WithTrustDomains("example.org")}, cert: spiffe, identity: &PeerIdentity{SpiffeId: "spiffe://example.org/ns/payments/sa/api", TrustDomain: "example.org", CommonName: "api"}},
+		{name: "other trust domain", opts: []PeerOption{WithTrustDomains("example.org")}, cert: foreign, err: ErrPeerNotAllowed},
+		{name: "trust domain without spiffe id", opts: []PeerOption{WithTrustDomains("example.org")}, cert: plain, err: ErrPeerNotAllowed},
+		{name: "allowed name or trust domain", opts: []PeerOption{WithAllowedPeers("ledger"), WithTrustDomains("example.org")}, cert: plain, identity: &PeerIdentity{CommonName: "ledger"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			handler := ServerPeerIdentity(tt.opts...)(func(ctx context.Context, req interface{}) (interface{}, error) {
+				called = true
+				identity, ok := PeerIdentityFromContext(ctx)
+				assert.Equal(t, tt.identity != nil, ok)
+				assert.Equal(t, tt.identity, identity)
+				return "ok", nil
+			})
+
+			_, err := handler(grpcPeerContext(tt.cert), nil)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.err == nil, called)
+		})
+	}
+}
+
+func TestServerPeerIdentityHTTP(t *testing.T) {
+	srv := khttp.NewServer(khttp.Middleware(ServerPeerIdentity(WithClientCertificateRequired())))
+	srv.Route("/").GET("/whoami", func(ctx khttp.Context) error {
+		h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+			identity, _ := PeerIdentityFromContext(ctx)
+			return identity.Name(), nil
+		})
+		reply, err := h(ctx, nil)
+		if err != nil {
+			return err
+		}
+		return ctx.String(http.StatusOK, reply.(string))
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+	r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{testPeerCertificate("ledger", "")}}}
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ledger", w.Body.String())
+
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/whoami", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestPeerIdentityName(t *testing.T) {
+	assert.Equal(t, "spiffe://example.org/sa/api", (&PeerIdentity{SpiffeId: "spiffe://example.org/sa/api", CommonName: "api"}).Name())
+	assert.Equal(t, "api", (&PeerIdentity{CommonName: "api"}).Name())
+}
@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+)
+
+// ErrRecovered is returned by Recovery for the requests whose handler
+// panicked, it is the error of the Kratos recovery middleware.
+var ErrRecovered = errors.InternalServer("UNKNOWN", "unknown request error")
+
+// PanicReport describes a panic recovered by Recovery.
+type PanicReport struct {
+	Time          time.Time
+	Kind          string
+	Component     string
+	Operation     string
+	CorrelationId string
+	// Request with its sensitive fields handled as by the logging middleware
+	Request string
+	// Value passed to panic and stack of the panicking goroutine
+	Value   interface{}
+	Stack   []byte
+	Latency time.Duration
+}
+
+// PanicReporter forwards the recovered panics, e.g. to an error tracking
+// service.
+type PanicReporter interface {
+	Report(ctx context.Context, report *PanicReport)
+}
+
+// PanicReporterFunc is a PanicReporter function.
+type PanicReporterFunc func(ctx context.Context, report *PanicReport)
+
+func (f PanicReporterFunc) Report(ctx context.Context, report *PanicReport) {
+	f(ctx, report)
+}
+
+// LogPanicReporter logs the recovered panics at error level.
+func LogPanicReporter(logger log.Logger) PanicReporter {
+	return PanicReporterFunc(func(ctx context.Context, r *PanicReport) {
+		_ = log.WithContext(ctx, logger).Log(log.LevelError,
+			"kind", r.Kind,
+			"component", r.Component,
+			"op", r.Operation,
+			"correlation_id", r.CorrelationId,
+			"req", r.Request,
+			"panic", fmt.Sprintf("%v", r.Value),
+			"stack", string(r.Stack),
+			"latency", r.Latency.Seconds(),
+		)
+	})
+}
+
+// Recovery is a server and client middleware which recovers the panics of
+// the handler, reports them to reporter and fails the request with
+// ErrRecovered. It replaces the Kratos recovery middleware, which has no
+// hook, and should be the first middleware. The options configure the
+// handling of the sensitive fields of the reported request.
+func Recovery(reporter PanicReporter, opts ...LogOption) middleware.Middleware {
+	o := newLogOptions(opts)
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (reply interface{}, err error) {
+			startTime := time.Now()
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+				report := &PanicReport{
+					Time:    startTime,
+					Request: extractArgs(req, o),
+					Value:   v,
+					Stack:   debug.Stack(),
+					Latency: time.Since(startTime),
+				}
+				tr, ok := transport.FromServerContext(ctx)
+				report.Kind = "server"
+				if !ok {
+					tr, ok = transport.FromClientContext(ctx)
+					report.Kind = "client"
+				}
+				if ok {
+					report.Component = tr.Kind().String()
+					report.Operation = tr.Operation()
+				}
+				report.CorrelationId = requestCorrelationId(ctx, tr)
+				reporter.Report(ctx, report)
+				reply, err = nil, ErrRecovered
+			}()
+			return handler(ctx, req)
+		}
+	}
+}
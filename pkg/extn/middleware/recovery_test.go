@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecovery(t *testing.T) {
+	tests := []struct {
+		name      string
+		ctx       func(tr transport.Transporter) context.Context
+		kind      string
+		component string
+		operation string
+	}{
+		{
+			name: "server",
+			ctx: func(tr transport.Transporter) context.Context {
+				return transport.NewServerContext(context.Background(), tr)
+			},
+			kind:      "server",
+			component: "grpc",
+			operation: "/svc/Get",
+		},
+		{
+			name: "client",
+			ctx: func(tr transport.Transporter) context.Context {
+				return transport.NewClientContext(context.Background(), tr)
+			},
+			kind:      "client",
+			component: "grpc",
+			operation: "/svc/Get",
+		},
+		{
+			name: "without transport",
+			ctx:  func(transport.Transporter) context.Context { return context.Background() },
+			kind: "client",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := newTestTransport("/svc/Get", nil)
+			tr.header.Set(string(CtxCorrelationIdKey), "corr-1")
+			var reports []*PanicReport
+			reporter := PanicReporterFunc(func(ctx context.Context, r *PanicReport) { reports = append(reports, r) })
+			handler := Recovery(reporter, WithMaxFieldBytes(8))(func(ctx context.Context, req interface{}) (interface{}, error) {
+				panic("boom")
+			})
+
+			reply, err := handler(tt.ctx(tr), "a long request body")
+			assert.Nil(t, reply)
+			assert.Equal(t, ErrRecovered, err)
+			require.Len(t, reports, 1)
+			r := reports[0]
+			assert.Equal(t, tt.kind, r.Kind)
+			assert.Equal(t, tt.component, r.Component)
+			assert.Equal(t, tt.operation, r.Operation)
+			if tt.operation != "" {
+				assert.Equal(t, "corr-1", r.CorrelationId)
+			}
+			assert.Equal(t, "boom", r.Value)
+			assert.True(t, strings.HasPrefix(r.Request, "a long r"), r.Request)
+			assert.Contains(t, r.Request, "truncated")
+			assert.Contains(t, string(r.Stack), "recovery_test.go")
+			assert.False(t, r.Time.IsZero())
+		})
+	}
+}
+
+func TestRecoveryWithoutPanic(t *testing.T) {
+	reported := false
+	handler := Recovery(PanicReporterFunc(func(context.Context, *PanicReport) { reported = true }))(func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	})
+	reply, err := handler(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", reply)
+	assert.False(t, reported)
+}
+
+func TestLogPanicReporter(t *testing.T) {
+	logger := &recordingLogger{}
+	LogPanicReporter(logger).Report(context.Background(), &PanicReport{
+		Kind: "server", Component: "http", Operation: "/svc/Get", CorrelationId: "corr-1",
+		Request: "req", Value: "boom", Stack: []byte("stack"),
+	})
+	require.Len(t, logger.entries, 1)
+	entry := logger.entries[0]
+	assert.Equal(t, log.LevelError, entry.level)
+	assert.Equal(t, "/svc/Get", entry.keyvals["op"])
+	assert.Equal(t, "corr-1", entry.keyvals["correlation_id"])
+	assert.Equal(t, "boom", entry.keyvals["panic"])
+	assert.Equal(t, "stack", entry.keyvals["stack"])
+}
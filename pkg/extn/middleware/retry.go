@@ -0,0 +1,230 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	mathrand "math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+)
+
+// RetryPolicy configures ClientRetry, the zero values select the defaults.
+type RetryPolicy struct {
+	// Attempts per call including the first one, default 3
+	MaxAttempts int
+	// Backoff before the first retry, doubled for each retry up to
+	// MaxBackoff, defaults 100ms and 5s. The actual delay is drawn between 0
+	// and the backoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Error codes which are retried, HTTP status codes, gRPC codes are mapped
+	// to them. Default 429, 502, 503 and 504.
+	Codes []int
+	// Disables the retries of connection failures, e.g. connection resets
+	NoConnectionRetries bool
+	// Retry budget of the client: each failed attempt takes a token, each
+	// success gives back BudgetRatio of a token, retries stop while less
+	// than half of the BudgetTokens are left. Defaults 10 and 0.1, negative
+	// BudgetTokens disables the budget.
+	BudgetTokens float64
+	BudgetRatio  float64
+	// RetryNonIdempotent retries all the calls. By default only the calls
+	// with an idempotent HTTP method, GET, HEAD, PUT, DELETE or OPTIONS, the
+	// IdempotentOperations and the calls carrying an Idempotency-Key header
+	// are retried, as the server may have processed a failed call already.
+	RetryNonIdempotent bool
+	// IdempotentOperations are the operations, e.g. the gRPC methods, which
+	// are retried in addition.
+	IdempotentOperations []string
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 3
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = 100 * time.Millisecond
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = 5 * time.Second
+	}
+	if len(p.Codes) == 0 {
+		p.Codes = []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+	}
+	if p.BudgetTokens == 0 {
+		p.BudgetTokens = 10
+	}
+	if p.BudgetRatio <= 0 {
+		p.BudgetRatio = 0.1
+	}
+	return p
+}
+
+// retryBudget throttles the retries of a client like the gRPC retry
+// throttling, so that retries don't overload a failing server.
+type retryBudget struct {
+	mu     sync.Mutex
+	tokens float64
+	max    float64
+	ratio  float64
+}
+
+func (b *retryBudget) success() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.max, b.tokens+b.ratio)
+}
+
+// failure records a failed attempt and returns whether a retry is allowed.
+func (b *retryBudget) failure() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = max(0, b.tokens-1)
+	return b.tokens > b.max/2
+}
+
+// ClientRetry is a client middleware which retries the idempotent calls, see
+// RetryPolicy.RetryNonIdempotent, failing with the retryable codes of the
+// policy or with connection failures, waiting for an exponential backoff with
+// jitter or for the Retry-After of the server when it is longer. The retries stop at the deadline of the context, after
+// MaxAttempts or when the retry budget of the client is exhausted. Place it
+// before the logging middleware to log every attempt.
+func ClientRetry(policy RetryPolicy) middleware.Middleware {
+	p := policy.withDefaults()
+	var budget *retryBudget
+	if p.BudgetTokens > 0 {
+		budget = &retryBudget{tokens: p.BudgetTokens, max: p.BudgetTokens, ratio: p.BudgetRatio}
+	}
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (reply interface{}, err error) {
+			backoff := p.InitialBackoff
+			for attempt := 1; ; attempt++ {
+				reply, err = handler(ctx, req)
+				if err == nil {
+					budget.success()
+					return reply, nil
+				}
+				if !p.retryable(err) || !p.idempotent(ctx) {
+					return reply, err
+				}
+				if !budget.failure() || attempt >= p.MaxAttempts {
+					return reply, err
+				}
+				delay := time.Duration(mathrand.Int64N(int64(backoff) + 1))
+				if retryAfter, ok := retryAfter(ctx, err); ok && retryAfter > delay {
+					delay = retryAfter
+				}
+				if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+					return reply, err
+				}
+				timer := time.NewTimer(delay)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return reply, err
+				case <-timer.C:
+				}
+				if !rewindRequestBody(ctx) {
+					return reply, err
+				}
+				backoff = min(2*backoff, p.MaxBackoff)
+			}
+		}
+	}
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	if !p.NoConnectionRetries && connectionFailure(err) {
+		return true
+	}
+	return slices.Contains(p.Codes, int(errors.FromError(err).Code))
+}
+
+// idempotent reports whether the call can be sent again.
+func (p RetryPolicy) idempotent(ctx context.Context) bool {
+	if p.RetryNonIdempotent {
+		return true
+	}
+	tr, ok := transport.FromClientContext(ctx)
+	if !ok {
+		return false
+	}
+	if tr.RequestHeader().Get(IdempotencyKeyHeader) != "" || slices.Contains(p.IdempotentOperations, tr.Operation()) {
+		return true
+	}
+	if ht, ok := tr.(interface{ Request() *http.Request }); ok && ht.Request() != nil {
+		switch ht.Request().Method {
+		case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+			return true
+		}
+	}
+	return false
+}
+
+func connectionFailure(err error) bool {
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
+
+// retryAfter returns the Retry-After of the reply header, in seconds or as
+// an HTTP date, or of the metadata of the error.
+func retryAfter(ctx context.Context, err error) (time.Duration, bool) {
+	var value string
+	if tr, ok := transport.FromClientContext(ctx); ok && tr.ReplyHeader() != nil {
+		value = tr.ReplyHeader().Get("Retry-After")
+	}
+	if se := errors.FromError(err); value == "" && se != nil {
+		value = se.Metadata["Retry-After"]
+	}
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
+
+// rewindRequestBody resets the body of the HTTP request, the Kratos HTTP
+// client builds it once before the middlewares. It returns false when the
+// body can't be sent again.
+func rewindRequestBody(ctx context.Context) bool {
+	tr, ok := transport.FromClientContext(ctx)
+	if !ok {
+		return true
+	}
+	ht, ok := tr.(interface{ Request() *http.Request })
+	if !ok {
+		return true
+	}
+	r := ht.Request()
+	if r == nil || r.Body == nil || r.Body == http.NoBody {
+		return true
+	}
+	if r.GetBody == nil {
+		return false
+	}
+	body, err := r.GetBody()
+	if err != nil {
+		return false
+	}
+	r.Body = body
+	return true
+}
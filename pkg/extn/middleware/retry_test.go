@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientRetryIdempotentCalls(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		operation string
+		key       string
+		policy    RetryPolicy
+		calls     int
+	}{
+		{name: "get", method: http.MethodGet, calls: 3},
+		{name: "put", method: http.MethodPut, calls: 3},
+		{name: "post", method: http.MethodPost, calls: 1},
+		{name: "post with idempotency key", method: http.MethodPost, key: "k1", calls: 3},
+		{name: "post retried explicitly", method: http.MethodPost, policy: RetryPolicy{RetryNonIdempotent: true}, calls: 3},
+		{name: "grpc operation", operation: "/svc/Create", calls: 1},
+		{name: "grpc idempotent operation", operation: "/svc/Get", policy: RetryPolicy{IdempotentOperations: []string{"/svc/Get"}}, calls: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r *http.Request
+			if tt.method != "" {
+				r = httptest.NewRequest(tt.method, "/v1/items", nil)
+			}
+			tr := newTestTransport(tt.operation, r)
+			if tt.key != "" {
+				tr.RequestHeader().Set(IdempotencyKeyHeader, tt.key)
+			}
+			ctx := transport.NewClientContext(context.Background(), tr)
+			policy := tt.policy
+			policy.InitialBackoff = time.Millisecond
+			calls := 0
+			handler := ClientRetry(policy)(func(ctx context.Context, req interface{}) (interface{}, error) {
+				calls++
+				return nil, errors.ServiceUnavailable("UNAVAILABLE", "unavailable")
+			})
+			_, err := handler(ctx, nil)
+			assert.Error(t, err)
+			assert.Equal(t, tt.calls, calls)
+		})
+	}
+}
+
+func TestClientRetryStopsOnSuccess(t *testing.T) {
+	ctx := transport.NewClientContext(context.Background(), newTestTransport("", httptest.NewRequest(http.MethodGet, "/", nil)))
+	calls := 0
+	handler := ClientRetry(RetryPolicy{InitialBackoff: time.Millisecond})(func(ctx context.Context, req interface{}) (interface{}, error) {
+		calls++
+		if calls == 1 {
+			return nil, errors.ServiceUnavailable("UNAVAILABLE", "unavailable")
+		}
+		return "ok", nil
+	})
+	reply, err := handler(ctx, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", reply)
+	assert.Equal(t, 2, calls)
+}
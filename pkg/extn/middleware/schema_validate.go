@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/achuala/go-svc-extn/pkg/util/jsonschema"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// SchemaValidator is a server middleware which validates the requests of
+// the operations in schemas, mapping operation names to schema ids, against
+// the JSON schemas of v. Proto requests are validated in their JSON form
+// with the proto field names, as encoded by the Kratos JSON codec, so 64 bit
+// integers are strings. Violations fail the request with the
+// VALIDATION_FAILED error of Validator, the metadata maps the field paths to
+// the messages, violations of the document itself are under "message". Of the
+// options only WithValidationCatalog applies, keyed by the schema keywords.
+func SchemaValidator(v *jsonschema.JsonSchemaValidator, schemas map[string]string, opts ...ValidatorOption) middleware.Middleware {
+	o := newValidatorOptions(opts)
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (reply interface{}, err error) {
+			tr, ok := transport.FromServerContext(ctx)
+			if !ok {
+				return handler(ctx, req)
+			}
+			schemaId, ok := schemas[tr.Operation()]
+			if !ok {
+				return handler(ctx, req)
+			}
+			doc, err := jsonDocument(req)
+			if err != nil {
+				return nil, validationFailed(map[string]string{"message": err.Error()})
+			}
+			if err = v.ValidateJson(schemaId, doc); err != nil {
+				return nil, handleSchemaValidationError(err, o.localizer(ctx))
+			}
+			return handler(ctx, req)
+		}
+	}
+}
+
+// jsonDocument returns the request decoded as a generic JSON value.
+func jsonDocument(req interface{}) (any, error) {
+	var (
+		b   []byte
+		err error
+	)
+	if msg, ok := req.(proto.Message); ok {
+		b, err = protojson.MarshalOptions{UseProtoNames: true}.Marshal(msg)
+	} else {
+		b, err = json.Marshal(req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var doc any
+	err = json.Unmarshal(b, &doc)
+	return doc, err
+}
+
+func handleSchemaValidationError(err error, localize localizeFunc) error {
+	violations := jsonschema.FieldViolations(err)
+	if violations == nil {
+		return validationFailed(map[string]string{"message": err.Error()})
+	}
+	errMeta := make(map[string]string)
+	for _, violation := range violations {
+		field := violation.Field
+		if field == "" {
+			field = "message"
+		}
+		message := localize(violation.Keyword, violation.Message)
+		if m, ok := errMeta[field]; ok {
+			errMeta[field] = m + "; " + message
+		} else {
+			errMeta[field] = message
+		}
+	}
+	return validationFailed(errMeta)
+}
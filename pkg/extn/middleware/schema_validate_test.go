@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/achuala/go-svc-extn/pkg/util/jsonschema"
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const accountSchema = `{
+	"id": "http://example.com/account",
+	"type": "object",
+	"properties": {
+		"name": {"type": "string", "minLength": 3},
+		"lines": {"type": "array", "items": {"type": "object", "properties": {"sku": {"type": "string"}}}}
+	},
+	"required": ["name"]
+}`
+
+// schemaValidateRequest runs the SchemaValidator middleware on req of the
+// operation, returning whether the handler was called and the metadata of the
+// validation error.
+func schemaValidateRequest(t *testing.T, operation string, req interface{}, opts ...ValidatorOption) (bool, map[string]string) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "account.json"), []byte(accountSchema), 0644))
+	v, err := jsonschema.NewJsonSchemaValidator(dir)
+	require.NoError(t, err)
+
+	called := false
+	handler := SchemaValidator(v, map[string]string{"/test.v1.Accounts/Create": "http://example.com/account"}, opts...)(func(ctx context.Context, req interface{}) (interface{}, error) {
+		called = true
+		return "ok", nil
+	})
+	ctx := transport.NewServerContext(context.Background(), newTestTransport(operation, nil))
+	if _, err = handler(ctx, req); err == nil {
+		return called, nil
+	}
+	se := errors.FromError(err)
+	require.Equal(t, "VALIDATION_FAILED", se.Reason, err)
+	return called, se.Metadata
+}
+
+func TestSchemaValidator(t *testing.T) {
+	called, meta := schemaValidateRequest(t, "/test.v1.Accounts/Create", map[string]any{"lines": []any{map[string]any{"sku": 1}}})
+	assert.False(t, called)
+	assert.Equal(t, map[string]string{
+		"message":      "missing properties: 'name'",
+		"lines[0].sku": "expected string, but got number",
+	}, meta)
+
+	// proto requests are validated in their JSON form
+	called, meta = schemaValidateRequest(t, "/test.v1.Accounts/Create", newAccount(t, "Account", "ab", ""))
+	assert.False(t, called)
+	assert.Equal(t, map[string]string{"name": "length must be >= 3, but got 2"}, meta)
+
+	called, meta = schemaValidateRequest(t, "/test.v1.Accounts/Create", map[string]any{"name": "abc"})
+	assert.True(t, called)
+	assert.Nil(t, meta)
+
+	// operations without a schema are not validated
+	called, _ = schemaValidateRequest(t, "/test.v1.Accounts/Delete", map[string]any{})
+	assert.True(t, called)
+}
+
+func TestSchemaValidatorCatalog(t *testing.T) {
+	opt := WithValidationCatalog(ValidationCatalog{"en": {"minLength": "too short"}}, "en")
+	called, meta := schemaValidateRequest(t, "/test.v1.Accounts/Create", map[string]any{"name": "ab", "lines": "none"}, opt)
+	assert.False(t, called)
+	assert.Equal(t, map[string]string{"name": "too short", "lines": "expected array, but got string"}, meta)
+}
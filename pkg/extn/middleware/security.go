@@ -3,6 +3,7 @@ package middleware
 import (
 	"context"
 
+	"github.com/achuala/go-svc-extn/pkg/ctxkeys"
 	"github.com/achuala/go-svc-extn/pkg/util/idgen"
 	"github.com/go-kratos/kratos/v2/errors"
 	"github.com/go-kratos/kratos/v2/middleware"
@@ -10,22 +11,37 @@ import (
 )
 
 // CtxKey is a custom type for context keys
-type CtxKey string
+type CtxKey = ctxkeys.Key
 
 // Context keys for various headers
 const (
-	CtxCorrelationIdKey CtxKey = "x-correlation-id"
+	CtxCorrelationIdKey CtxKey = ctxkeys.CorrelationIdKey
 	CtxSystemPeerKey    CtxKey = "x-system-peer"
 	CtxSignedHeadersKey CtxKey = "x-signed-headers"
 	CtxAuthorizationKey CtxKey = "Authorization"
 )
 
-// getCorrelationIdFromCtx retrieves the correlation ID from the context or generates a new one
-func getCorrelationIdFromCtx(ctx context.Context) string {
-	if correlationId, ok := ctx.Value(CtxCorrelationIdKey).(string); ok {
+// NewCorrelationIdContext returns a context carrying the correlation ID, e.g. for jobs which are
+// not started by a request so that all their client calls share the same ID
+func NewCorrelationIdContext(ctx context.Context, correlationId string) context.Context {
+	return ctxkeys.NewCorrelationIdContext(ctx, correlationId)
+}
+
+// CorrelationIdFromContext returns the correlation ID of the request, as set by ServerCorrelationIdInjector
+func CorrelationIdFromContext(ctx context.Context) (string, bool) {
+	return ctxkeys.CorrelationIdFromContext(ctx)
+}
+
+// requestCorrelationId returns the correlation ID of the context, else the one of the request header
+// of the transport, the logging middleware can run before the injectors
+func requestCorrelationId(ctx context.Context, tr transport.Transporter) string {
+	if correlationId, ok := CorrelationIdFromContext(ctx); ok {
 		return correlationId
 	}
-	return idgen.NewId()
+	if tr != nil {
+		return tr.RequestHeader().Get(string(CtxCorrelationIdKey))
+	}
+	return ""
 }
 
 // ServerSecurityHeaderValidator middleware validates the presence of required security headers
@@ -44,29 +60,42 @@ func ServerSecurityHeaderValidator() middleware.Middleware {
 	}
 }
 
-// ServerCorrelationIdInjector middleware injects the correlation ID into the server context
+// ServerCorrelationIdInjector middleware injects the correlation ID into the server context. The ID of
+// the request header is used, else one is generated once for the request and written to the request
+// header. It is returned in the reply header.
 func ServerCorrelationIdInjector() middleware.Middleware {
 	return func(handler middleware.Handler) middleware.Handler {
 		return func(ctx context.Context, req interface{}) (reply interface{}, err error) {
 			if tr, ok := transport.FromServerContext(ctx); ok {
-				correlationId := tr.RequestHeader().Get(string(CtxCorrelationIdKey))
+				correlationId, ok := CorrelationIdFromContext(ctx)
+				if !ok {
+					correlationId = tr.RequestHeader().Get(string(CtxCorrelationIdKey))
+				}
 				if correlationId == "" {
 					correlationId = idgen.NewId()
 				}
-				ctx = context.WithValue(ctx, CtxCorrelationIdKey, correlationId)
-				ctx = transport.NewServerContext(ctx, tr)
+				tr.RequestHeader().Set(string(CtxCorrelationIdKey), correlationId)
+				tr.ReplyHeader().Set(string(CtxCorrelationIdKey), correlationId)
+				ctx = NewCorrelationIdContext(ctx, correlationId)
 			}
 			return handler(ctx, req)
 		}
 	}
 }
 
-// ClientCorrelationIdInjector middleware injects the correlation ID into the client request header
+// ClientCorrelationIdInjector middleware injects the correlation ID of the context into the client
+// request header, along with the headers propagated by ServerHeaderPropagation. Calls outside of a
+// request without NewCorrelationIdContext get a new ID each.
 func ClientCorrelationIdInjector() middleware.Middleware {
 	return func(handler middleware.Handler) middleware.Handler {
 		return func(ctx context.Context, req interface{}) (reply interface{}, err error) {
+			setPropagatedHeaders(ctx)
 			if tr, ok := transport.FromClientContext(ctx); ok {
-				correlationId := getCorrelationIdFromCtx(ctx)
+				correlationId, ok := CorrelationIdFromContext(ctx)
+				if !ok {
+					correlationId = idgen.NewId()
+					ctx = NewCorrelationIdContext(ctx, correlationId)
+				}
 				tr.RequestHeader().Set(string(CtxCorrelationIdKey), correlationId)
 			}
 			return handler(ctx, req)
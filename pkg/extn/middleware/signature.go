@@ -0,0 +1,250 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/achuala/go-svc-extn/pkg/crypto"
+	"github.com/achuala/go-svc-extn/pkg/ctxkeys"
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+	khttp "github.com/go-kratos/kratos/v2/transport/http"
+	"google.golang.org/protobuf/proto"
+)
+
+// Errors returned by ServerSignatureVerifier
+var (
+	ErrMissingSignature   = errors.Unauthorized("MISSING_SIGNATURE", "missing authorization or signature headers")
+	ErrMalformedSignature = errors.Unauthorized("MALFORMED_SIGNATURE", "authorization header is malformed")
+	ErrInvalidAccessKey   = errors.Unauthorized("ACCESS_KEY_INVALID", "access key is not valid")
+	ErrSignatureMismatch  = errors.Unauthorized("SIGNATURE_MISMATCH", "request signature does not match")
+	ErrRequestExpired     = errors.Unauthorized("REQUEST_EXPIRED", "request timestamp is outside of the allowed clock skew")
+	ErrReplayDetected     = errors.Unauthorized("REPLAY_DETECTED", "request has already been processed")
+	ErrQuotaExceeded      = errors.New(http.StatusTooManyRequests, "QUOTA_EXCEEDED", "request quota of the access key exceeded")
+	ErrSandboxNotAllowed  = errors.Forbidden("SANDBOX_NOT_ALLOWED", "sandbox requests are not allowed for this access key or endpoint")
+	ErrTestKeyNotAllowed  = errors.Forbidden("TEST_KEY_NOT_ALLOWED", "test access keys can only be used for sandbox requests")
+)
+
+// SignatureOption configures ServerSignatureVerifier.
+type SignatureOption func(*signatureOptions)
+
+type signatureOptions struct {
+	replayGuard  *crypto.ReplayGuard
+	quotaLimiter *crypto.QuotaLimiter
+	observer     func(context.Context, *crypto.VerificationResult)
+	rejectV1     bool
+	sandbox      bool
+	sandboxRoute middleware.Handler
+}
+
+// WithSandbox accepts test traffic on the endpoint. Sandbox requests are marked
+// with crypto.NewSandboxContext and dispatched to the handler when it is not
+// nil, otherwise to the regular handler which can check crypto.IsSandbox.
+// Endpoints without this option reject sandbox requests.
+func WithSandbox(handler middleware.Handler) SignatureOption {
+	return func(o *signatureOptions) {
+		o.sandbox = true
+		o.sandboxRoute = handler
+	}
+}
+
+// WithVerificationObserver is called with the result of every verification,
+// e.g. to log the failure code, key id and timestamp skew of rejected requests.
+func WithVerificationObserver(fn func(ctx context.Context, result *crypto.VerificationResult)) SignatureOption {
+	return func(o *signatureOptions) {
+		o.observer = fn
+	}
+}
+
+// WithQuotaLimiter enforces the request quotas of the access keys once the
+// signature has been verified. Requests over quota are rejected with 429 and
+// the window, limit and reset time in the error metadata.
+func WithQuotaLimiter(l *crypto.QuotaLimiter) SignatureOption {
+	return func(o *signatureOptions) {
+		o.quotaLimiter = l
+	}
+}
+
+// WithCanonicalSignatureRequired rejects v1 signatures once all clients have
+// migrated to HMAC-SHA256-V2. By default both schemes are accepted.
+func WithCanonicalSignatureRequired() SignatureOption {
+	return func(o *signatureOptions) {
+		o.rejectV1 = true
+	}
+}
+
+// WithReplayGuard rejects requests with a stale ts header or which have
+// already been verified once.
+func WithReplayGuard(g *crypto.ReplayGuard) SignatureOption {
+	return func(o *signatureOptions) {
+		o.replayGuard = g
+	}
+}
+
+type signaturePayloadKey struct{}
+
+// SignaturePayloadFilter is an HTTP filter which keeps a copy of the raw request
+// body, up to maxBytes, so that ServerSignatureVerifier can verify the signature
+// over the exact bytes sent by the client. Register it with http.Filter.
+func SignaturePayloadFilter(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Body != nil && r.Body != http.NoBody {
+				body, err := io.ReadAll(io.LimitReader(r.Body, maxBytes+1))
+				_ = r.Body.Close()
+				if err != nil {
+					http.Error(w, "unable to read request body", http.StatusBadRequest)
+					return
+				}
+				if int64(len(body)) > maxBytes {
+					http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+					return
+				}
+				r.Body = io.NopCloser(bytes.NewReader(body))
+				r = r.WithContext(context.WithValue(r.Context(), signaturePayloadKey{}, body))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ServerSignatureVerifier middleware verifies the signature of the request.
+// It parses the Authorization header, checks the access key is valid when the
+// provider implements crypto.AccessKeyProvider and verifies the signature over
+// the request payload. When a replay guard is configured the ts header must be
+// within the clock skew and the request must not have been seen before.
+//
+// v1, v2 (alg=HMAC-SHA256-V2) and asymmetric (alg=ED25519 or ECDSA-P256-SHA256)
+// signatures are accepted, v1 is rejected when WithCanonicalSignatureRequired
+// is set. For transports other than HTTP the canonical request is POST on the operation name without query or headers.
+//
+// The payload is the raw body captured by SignaturePayloadFilter, or the
+// deterministic protobuf encoding of the request for other transports.
+//
+// The verified access key, without its secrets, is available to the handlers
+// with crypto.AccessKeyFromContext. Only the key id is set when the provider
+// does not implement crypto.AccessKeyProvider. The key id is the actor of the
+// request unless a bearer token authenticated a user, see ctxkeys.ActorFromContext.
+func ServerSignatureVerifier(provider crypto.AccessSecretProvider, opts ...SignatureOption) middleware.Middleware {
+	o := &signatureOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	verifier := crypto.NewVerifier(&crypto.VerifierConfig{Provider: provider, ReplayGuard: o.replayGuard, AllowV1: !o.rejectV1})
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (reply interface{}, err error) {
+			tr, ok := transport.FromServerContext(ctx)
+			if !ok {
+				return handler(ctx, req)
+			}
+			payload, err := signaturePayload(ctx, req)
+			if err != nil {
+				return nil, ErrMalformedSignature.WithCause(err)
+			}
+			result := verifier.VerifyRequest(ctx, &crypto.VerificationRequest{
+				Authorization: tr.RequestHeader().Get(string(CtxAuthorizationKey)),
+				SignedHeaders: tr.RequestHeader().Get(string(CtxSignedHeadersKey)),
+				Payload:       payload,
+				Request:       canonicalRequest(tr),
+			})
+			if o.observer != nil {
+				o.observer(ctx, result)
+			}
+			if !result.Verified() {
+				return nil, verificationError(result)
+			}
+			if result.Sandbox && !o.sandbox {
+				return nil, ErrSandboxNotAllowed
+			}
+
+			if o.quotaLimiter != nil {
+				if err := o.quotaLimiter.Allow(ctx, result.Key); err != nil {
+					var qe *crypto.QuotaExceededError
+					if errors.As(err, &qe) {
+						retryAfter := int64(math.Ceil(time.Until(qe.ResetAt).Seconds()))
+						tr.ReplyHeader().Set("Retry-After", strconv.FormatInt(max(retryAfter, 1), 10))
+						return nil, ErrQuotaExceeded.WithMetadata(map[string]string{
+							"window":   qe.Window,
+							"limit":    strconv.FormatInt(qe.Limit, 10),
+							"reset_at": qe.ResetAt.Format(time.RFC3339),
+						})
+					}
+					return nil, errors.ServiceUnavailable("QUOTA_CHECK_FAILED", "unable to verify request quota").WithCause(err)
+				}
+			}
+			ctx = crypto.NewAccessKeyContext(ctx, result.Key)
+			if _, ok := ctxkeys.ActorFromContext(ctx); !ok {
+				ctx = ctxkeys.NewActorContext(ctx, result.Key.KeyId)
+			}
+			if result.Sandbox {
+				ctx = crypto.NewSandboxContext(ctx)
+				if o.sandboxRoute != nil {
+					return o.sandboxRoute(ctx, req)
+				}
+			}
+			return handler(ctx, req)
+		}
+	}
+}
+
+// verificationError maps the failure of the verification to the error returned
+// to the client. The failure code is added to the metadata for partner support.
+func verificationError(result *crypto.VerificationResult) error {
+	var err *errors.Error
+	switch result.Failure {
+	case crypto.FailureMissingHeader:
+		err = ErrMissingSignature
+	case crypto.FailureMalformedHeader, crypto.FailureUnsupportedAlgorithm:
+		err = ErrMalformedSignature
+	case crypto.FailureUnknownKey, crypto.FailureKeyInactive, crypto.FailureKeyExpired:
+		err = ErrInvalidAccessKey
+	case crypto.FailureRequestExpired:
+		err = ErrRequestExpired
+	case crypto.FailureReplayDetected:
+		err = ErrReplayDetected
+	case crypto.FailureSignatureMismatch:
+		err = ErrSignatureMismatch
+	case crypto.FailureSandboxNotAllowed:
+		err = ErrSandboxNotAllowed
+	case crypto.FailureTestKeyNotAllowed:
+		err = ErrTestKeyNotAllowed
+	default:
+		return errors.ServiceUnavailable("SIGNATURE_CHECK_FAILED", "unable to verify request signature").WithCause(result.Err)
+	}
+	return err.WithCause(result.Err).WithMetadata(map[string]string{"failure": string(result.Failure)})
+}
+
+// canonicalRequest returns the request covered by a v2 signature.
+func canonicalRequest(tr transport.Transporter) *crypto.CanonicalRequest {
+	if ht, ok := tr.(khttp.Transporter); ok && ht.Request() != nil {
+		return crypto.NewCanonicalRequest(ht.Request())
+	}
+	return &crypto.CanonicalRequest{Method: http.MethodPost, Path: tr.Operation()}
+}
+
+// signaturePayload returns the payload the client is expected to have signed.
+func signaturePayload(ctx context.Context, req interface{}) (string, error) {
+	if body, ok := ctx.Value(signaturePayloadKey{}).([]byte); ok {
+		return string(body), nil
+	}
+	switch v := req.(type) {
+	case proto.Message:
+		b, err := proto.MarshalOptions{Deterministic: true}.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	case []byte:
+		return string(v), nil
+	case string:
+		return v, nil
+	default:
+		return "", nil
+	}
+}
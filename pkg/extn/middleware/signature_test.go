@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/achuala/go-svc-extn/pkg/crypto"
+	kerrors "github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testSecretProvider map[string]string
+
+func (p testSecretProvider) GetAccessSecret(accessKeyId string) (string, error) {
+	return p[accessKeyId], nil
+}
+
+type testCounter struct {
+	counts map[string]int64
+	err    error
+}
+
+func (c *testCounter) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	c.counts[key]++
+	return c.counts[key], nil
+}
+
+// signedContext returns the server context of a request signed with the v1
+// signature of the access key AK1.
+func signedContext(t *testing.T, payload string) context.Context {
+	securityHeader := "ts=" + time.Now().UTC().Format("20060102150405") + "/api=orders/ver=v1/chnl=web/usrid=u1"
+	headers, err := crypto.ParseSignedHeaders(securityHeader)
+	require.NoError(t, err)
+	tr := newTestTransport("/orders.v1.Orders/Create", nil)
+	tr.RequestHeader().Set(string(CtxAuthorizationKey), "creds=access-key:AK1/signature="+crypto.ComputeSignature("secret1", payload, headers))
+	tr.RequestHeader().Set(string(CtxSignedHeadersKey), securityHeader)
+	return transport.NewServerContext(context.Background(), tr)
+}
+
+func TestServerSignatureVerifierQuota(t *testing.T) {
+	tests := []struct {
+		name     string
+		quota    *crypto.Quota
+		counter  error
+		allowed  int
+		reason   string
+		code     int
+		metadata map[string]string
+	}{
+		{name: "unlimited", allowed: 3},
+		{name: "within quota", quota: &crypto.Quota{PerMinute: 3}, allowed: 3},
+		{
+			name:     "minute quota exceeded",
+			quota:    &crypto.Quota{PerMinute: 2},
+			allowed:  2,
+			reason:   ErrQuotaExceeded.Reason,
+			code:     429,
+			metadata: map[string]string{"window": crypto.QuotaWindowMinute, "limit": "2"},
+		},
+		{
+			name:     "day quota exceeded",
+			quota:    &crypto.Quota{PerMinute: 10, PerDay: 1},
+			allowed:  1,
+			reason:   ErrQuotaExceeded.Reason,
+			code:     429,
+			metadata: map[string]string{"window": crypto.QuotaWindowDay, "limit": "1"},
+		},
+		{name: "counter failure", quota: &crypto.Quota{PerMinute: 2}, counter: errors.New("cache down"), reason: "QUOTA_CHECK_FAILED", code: 503},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts []SignatureOption
+			if tt.quota != nil {
+				opts = append(opts, WithQuotaLimiter(crypto.NewQuotaLimiter(&testCounter{counts: map[string]int64{}, err: tt.counter}, tt.quota)))
+			}
+			calls := 0
+			handler := ServerSignatureVerifier(testSecretProvider{"AK1": "secret1"}, opts...)(func(ctx context.Context, req interface{}) (interface{}, error) {
+				calls++
+				return "ok", nil
+			})
+
+			var err error
+			var ctx context.Context
+			for i := 0; i < 3; i++ {
+				ctx = signedContext(t, `{"id":"o-1"}`)
+				if _, err = handler(ctx, []byte(`{"id":"o-1"}`)); err != nil {
+					break
+				}
+			}
+			assert.Equal(t, tt.allowed, calls)
+			if tt.reason == "" {
+				assert.NoError(t, err)
+				return
+			}
+			e := kerrors.FromError(err)
+			assert.Equal(t, tt.reason, e.Reason)
+			assert.Equal(t, int32(tt.code), e.Code)
+
+			tr, _ := transport.FromServerContext(ctx)
+			retryAfter := tr.ReplyHeader().Get("Retry-After")
+			if tt.code != 429 {
+				assert.Empty(t, retryAfter)
+				return
+			}
+			seconds, err := strconv.Atoi(retryAfter)
+			require.NoError(t, err)
+			assert.True(t, seconds >= 1 && seconds <= 86400, "unexpected Retry-After %d", seconds)
+			for k, v := range tt.metadata {
+				assert.Equal(t, v, e.Metadata[k])
+			}
+			_, err = time.Parse(time.RFC3339, e.Metadata["reset_at"])
+			assert.NoError(t, err)
+		})
+	}
+}
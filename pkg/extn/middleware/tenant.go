@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/achuala/go-svc-extn/pkg/crypto"
+	"github.com/achuala/go-svc-extn/pkg/ctxkeys"
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+)
+
+// TenantHeader carries the tenant of the request between the services.
+const TenantHeader = "x-tenant-id"
+
+// Errors returned by ServerTenant
+var (
+	ErrMissingTenant  = errors.BadRequest("MISSING_TENANT", "tenant of the request is unknown")
+	ErrTenantMismatch = errors.Forbidden("TENANT_MISMATCH", "tenant header does not match the authenticated tenant")
+)
+
+// NewTenantContext returns a context carrying the tenant.
+func NewTenantContext(ctx context.Context, tenant string) context.Context {
+	return ctxkeys.NewTenantContext(ctx, tenant)
+}
+
+// TenantFromContext returns the tenant of the request, as set by ServerTenant.
+func TenantFromContext(ctx context.Context) (string, bool) {
+	return ctxkeys.TenantFromContext(ctx)
+}
+
+// TenantOption configures ServerTenant.
+type TenantOption func(*tenantOptions)
+
+type tenantOptions struct {
+	claim       string
+	trustHeader bool
+	required    bool
+}
+
+// WithTenantClaim sets the bearer token claim holding the tenant, tenant_id
+// by default.
+func WithTenantClaim(name string) TenantOption {
+	return func(o *tenantOptions) {
+		o.claim = name
+	}
+}
+
+// WithTenantHeaderTrusted takes the tenant from the TenantHeader when the
+// request has no authenticated tenant, e.g. for internal calls.
+func WithTenantHeaderTrusted() TenantOption {
+	return func(o *tenantOptions) {
+		o.trustHeader = true
+	}
+}
+
+// WithTenantRequired rejects the requests without tenant.
+func WithTenantRequired() TenantOption {
+	return func(o *tenantOptions) {
+		o.required = true
+	}
+}
+
+// ServerTenant is a server middleware which puts the tenant of the request
+// in the context, see TenantFromContext. The tenant is the institution of
+// the access key of a signed request, else the tenant claim of the bearer
+// token, else the TenantHeader when trusted. A TenantHeader which differs
+// from the authenticated tenant fails the request with ErrTenantMismatch.
+// Place it after the authentication middlewares.
+func ServerTenant(opts ...TenantOption) middleware.Middleware {
+	o := &tenantOptions{claim: "tenant_id"}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			var tenant, header string
+			if key, ok := crypto.AccessKeyFromContext(ctx); ok {
+				tenant = key.InstitutionId
+			}
+			if claims, ok := crypto.JWTClaimsFromContext(ctx); ok && tenant == "" {
+				tenant = claims.String(o.claim)
+			}
+			if tr, ok := transport.FromServerContext(ctx); ok {
+				header = tr.RequestHeader().Get(TenantHeader)
+			}
+			switch {
+			case tenant != "" && header != "" && header != tenant:
+				return nil, ErrTenantMismatch
+			case tenant == "" && o.trustHeader:
+				tenant = header
+			}
+			if tenant == "" {
+				if o.required {
+					return nil, ErrMissingTenant
+				}
+				return handler(ctx, req)
+			}
+			return handler(NewTenantContext(ctx, tenant), req)
+		}
+	}
+}
+
+// ClientTenant is a client middleware which sends the tenant of the context
+// in the TenantHeader.
+func ClientTenant() middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			if tenant, ok := TenantFromContext(ctx); ok {
+				if tr, ok := transport.FromClientContext(ctx); ok {
+					tr.RequestHeader().Set(TenantHeader, tenant)
+				}
+			}
+			return handler(ctx, req)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+
+	"github.com/achuala/go-svc-extn/pkg/crypto"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerTenant(t *testing.T) {
+	accessKey := &crypto.APIAccessKey{KeyId: "AK1", InstitutionId: "bank-1"}
+	claims := &crypto.JWTClaims{Subject: "alice", Raw: map[string]any{"tenant_id": "bank-2", "org": "bank-3"}}
+	tests := []struct {
+		name      string
+		opts      []TenantOption
+		accessKey *crypto.APIAccessKey
+		claims    *crypto.JWTClaims
+		header    string
+		tenant    string
+		err       error
+	}{
+		{name: "access key", accessKey: accessKey, claims: claims, tenant: "bank-1"},
+		{name: "claim", claims: claims, tenant: "bank-2"},
+		{name: "other claim", opts: []TenantOption{WithTenantClaim("org")}, claims: claims, tenant: "bank-3"},
+		{name: "matching header", accessKey: accessKey, header: "bank-1", tenant: "bank-1"},
+		{name: "header differs from the access key", accessKey: accessKey, claims: claims, header: "bank-2", err: ErrTenantMismatch},
+		{name: "header differs from the claim", opts: []TenantOption{WithTenantHeaderTrusted()}, claims: claims, header: "bank-9", err: ErrTenantMismatch},
+		{name: "untrusted header", header: "bank-9"},
+		{name: "trusted header", opts: []TenantOption{WithTenantHeaderTrusted()}, header: "bank-9", tenant: "bank-9"},
+		{name: "no tenant"},
+		{name: "required", opts: []TenantOption{WithTenantRequired()}, header: "bank-9", err: ErrMissingTenant},
+		{name: "required and known", opts: []TenantOption{WithTenantRequired()}, claims: claims, tenant: "bank-2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := newTestTransport("/payments.v1.Payments/Charge", nil)
+			if tt.header != "" {
+				tr.header.Set(TenantHeader, tt.header)
+			}
+			ctx := transport.NewServerContext(context.Background(), tr)
+			if tt.accessKey != nil {
+				ctx = crypto.NewAccessKeyContext(ctx, tt.accessKey)
+			}
+			if tt.claims != nil {
+				ctx = crypto.NewJWTClaimsContext(ctx, tt.claims)
+			}
+			var tenant string
+			called := false
+			handler := ServerTenant(tt.opts...)(func(ctx context.Context, req interface{}) (interface{}, error) {
+				called = true
+				tenant, _ = TenantFromContext(ctx)
+				return "ok", nil
+			})
+			_, err := handler(ctx, "req")
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				assert.False(t, called)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.tenant, tenant)
+		})
+	}
+}
+
+func TestClientTenant(t *testing.T) {
+	handler := ClientTenant()(func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	})
+
+	tr := newTestTransport("/ledger.v1.Ledger/Post", nil)
+	ctx := transport.NewClientContext(NewTenantContext(context.Background(), "bank-1"), tr)
+	_, err := handler(ctx, "req")
+	assert.NoError(t, err)
+	assert.Equal(t, "bank-1", tr.header.Get(TenantHeader))
+
+	tr = newTestTransport("/ledger.v1.Ledger/Post", nil)
+	_, err = handler(transport.NewClientContext(context.Background(), tr), "req")
+	assert.NoError(t, err)
+	assert.Empty(t, tr.header.Get(TenantHeader))
+}
@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+)
+
+// DeadlineHeader carries the time left to the deadline of the caller in
+// milliseconds, gRPC propagates deadlines itself but HTTP does not.
+const DeadlineHeader = "X-Request-Timeout"
+
+// ErrDeadlineExceeded is returned by ServerTimeout when the operation does
+// not complete in time.
+var ErrDeadlineExceeded = errors.New(http.StatusGatewayTimeout, "DEADLINE_EXCEEDED", "request deadline exceeded")
+
+// ServerTimeout is a server middleware which bounds the operations by the
+// timeout of timeouts for the operation, defaultTimeout otherwise, and by
+// the deadline of the caller sent in the DeadlineHeader. Zero means no
+// timeout. The handler gets a context with the deadline, which is cancelled
+// at the deadline, and the request fails with ErrDeadlineExceeded.
+//
+// The handlers must honour the context and pass it to their calls: a handler
+// ignoring it keeps running in the background after the request has failed,
+// holding its resources, and its result is discarded. A panic of the handler
+// fails the request with ErrRecovered like the Recovery middleware, as it
+// can't be recovered by the middlewares of the caller goroutine.
+func ServerTimeout(defaultTimeout time.Duration, timeouts map[string]time.Duration) middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			timeout := defaultTimeout
+			if tr, ok := transport.FromServerContext(ctx); ok {
+				if t, ok := timeouts[tr.Operation()]; ok {
+					timeout = t
+				}
+				if ms, err := strconv.ParseInt(tr.RequestHeader().Get(DeadlineHeader), 10, 64); err == nil {
+					if ms <= 0 {
+						return nil, ErrDeadlineExceeded
+					}
+					if remaining := time.Duration(ms) * time.Millisecond; timeout == 0 || remaining < timeout {
+						timeout = remaining
+					}
+				}
+			}
+			if timeout <= 0 {
+				return handler(ctx, req)
+			}
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			return handleWithDeadline(ctx, handler, req)
+		}
+	}
+}
+
+type handlerResult struct {
+	reply interface{}
+	err   error
+}
+
+// handleWithDeadline runs the handler with the deadline ctx in its own
+// goroutine so that the request returns at the deadline, panics are turned
+// into ErrRecovered carrying the panic value and stack.
+func handleWithDeadline(ctx context.Context, handler middleware.Handler, req interface{}) (interface{}, error) {
+	done := make(chan handlerResult, 1)
+	go func() {
+		var result handlerResult
+		defer func() {
+			if v := recover(); v != nil {
+				result = handlerResult{err: ErrRecovered.WithCause(fmt.Errorf("panic: %v\n%s", v, debug.Stack()))}
+			}
+			done <- result
+		}()
+		result.reply, result.err = handler(ctx, req)
+	}()
+	select {
+	case result := <-done:
+		if result.err != nil && ctx.Err() == context.DeadlineExceeded && errors.FromError(result.err).Code == errors.UnknownCode {
+			return nil, ErrDeadlineExceeded.WithCause(result.err)
+		}
+		return result.reply, result.err
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, ErrDeadlineExceeded
+		}
+		return nil, errors.ClientClosed("CLIENT_CLOSED", ctx.Err().Error())
+	}
+}
+
+// ClientDeadline is a client middleware which sends the time left to the
+// deadline of the context in the DeadlineHeader, so that ServerTimeout of
+// the downstream service stops when the caller gives up.
+func ClientDeadline() middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			if deadline, ok := ctx.Deadline(); ok {
+				if tr, ok := transport.FromClientContext(ctx); ok {
+					remaining := time.Until(deadline).Milliseconds()
+					if remaining <= 0 {
+						return nil, ErrDeadlineExceeded
+					}
+					tr.RequestHeader().Set(DeadlineHeader, strconv.FormatInt(remaining, 10))
+				}
+			}
+			return handler(ctx, req)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeout  time.Duration
+		deadline string
+		handler  func(ctx context.Context) (interface{}, error)
+		reason   string
+	}{
+		{
+			name:    "completes in time",
+			timeout: time.Second,
+			handler: func(ctx context.Context) (interface{}, error) { return "ok", nil },
+		},
+		{
+			name:    "handler honouring the context",
+			timeout: 10 * time.Millisecond,
+			handler: func(ctx context.Context) (interface{}, error) {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			},
+			reason: "DEADLINE_EXCEEDED",
+		},
+		{
+			name:    "handler ignoring the context",
+			timeout: 10 * time.Millisecond,
+			handler: func(ctx context.Context) (interface{}, error) {
+				time.Sleep(200 * time.Millisecond)
+				return "late", nil
+			},
+			reason: "DEADLINE_EXCEEDED",
+		},
+		{
+			name:     "caller deadline shorter than the timeout",
+			timeout:  time.Minute,
+			deadline: "10",
+			handler: func(ctx context.Context) (interface{}, error) {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			},
+			reason: "DEADLINE_EXCEEDED",
+		},
+		{
+			name:     "caller deadline passed",
+			timeout:  time.Minute,
+			deadline: "0",
+			handler:  func(ctx context.Context) (interface{}, error) { return "ok", nil },
+			reason:   "DEADLINE_EXCEEDED",
+		},
+		{
+			name:    "handler panicking",
+			timeout: time.Second,
+			handler: func(ctx context.Context) (interface{}, error) { panic("boom") },
+			reason:  "UNKNOWN",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.deadline != "" {
+				r.Header.Set(DeadlineHeader, tt.deadline)
+			}
+			ctx := transport.NewServerContext(context.Background(), newTestTransport("/svc/Get", r))
+			handler := ServerTimeout(tt.timeout, nil)(func(ctx context.Context, req interface{}) (interface{}, error) {
+				_, ok := ctx.Deadline()
+				assert.True(t, ok, "handler context without deadline")
+				return tt.handler(ctx)
+			})
+			reply, err := handler(ctx, nil)
+			if tt.reason == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, "ok", reply)
+				return
+			}
+			assert.Nil(t, reply)
+			assert.Equal(t, tt.reason, errors.Reason(err))
+		})
+	}
+}
+
+func TestClientDeadline(t *testing.T) {
+	tr := newTestTransport("/svc/Get", httptest.NewRequest(http.MethodGet, "/", nil))
+	ctx, cancel := context.WithTimeout(transport.NewClientContext(context.Background(), tr), time.Minute)
+	defer cancel()
+	_, err := ClientDeadline()(func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	})(ctx, nil)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, tr.RequestHeader().Get(DeadlineHeader))
+}
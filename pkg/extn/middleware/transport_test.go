@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/go-kratos/kratos/v2/transport"
+)
+
+type headerCarrier http.Header
+
+func (h headerCarrier) Get(key string) string      { return http.Header(h).Get(key) }
+func (h headerCarrier) Set(key, value string)      { http.Header(h).Set(key, value) }
+func (h headerCarrier) Add(key, value string)      { http.Header(h).Add(key, value) }
+func (h headerCarrier) Values(key string) []string { return http.Header(h).Values(key) }
+func (h headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// testTransport is a server or client transport of the tests, an HTTP one
+// when it has a request.
+type testTransport struct {
+	kind        transport.Kind
+	endpoint    string
+	operation   string
+	request     *http.Request
+	header      headerCarrier
+	replyHeader headerCarrier
+}
+
+func newTestTransport(operation string, r *http.Request) *testTransport {
+	tr := &testTransport{kind: transport.KindGRPC, operation: operation, header: headerCarrier{}, replyHeader: headerCarrier{}}
+	if r != nil {
+		tr.kind, tr.request, tr.header = transport.KindHTTP, r, headerCarrier(r.Header)
+	}
+	return tr
+}
+
+func (t *testTransport) Kind() transport.Kind            { return t.kind }
+func (t *testTransport) Endpoint() string                { return t.endpoint }
+func (t *testTransport) Operation() string               { return t.operation }
+func (t *testTransport) RequestHeader() transport.Header { return t.header }
+func (t *testTransport) ReplyHeader() transport.Header   { return t.replyHeader }
+func (t *testTransport) Request() *http.Request          { return t.request }
@@ -2,18 +2,22 @@ package middleware
 
 import (
 	"context"
+	"path"
 	"strconv"
 	"strings"
 
 	"buf.build/gen/go/bufbuild/protovalidate/protocolbuffers/go/buf/validate"
 	"github.com/bufbuild/protovalidate-go"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoreflect"
 
 	"fmt"
 	"sync"
 
 	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
 	"github.com/go-kratos/kratos/v2/middleware"
+	"golang.org/x/text/language"
 )
 
 var (
@@ -21,8 +25,126 @@ var (
 	once      sync.Once
 )
 
-// Validator is a validator middleware.
-func Validator() middleware.Middleware {
+// ConstraintFunc is a custom constraint of a message type, it returns the
+// violations keyed by field path, empty when the message is valid.
+type ConstraintFunc func(ctx context.Context, msg proto.Message) map[string]string
+
+// ValidatorOption configures the Validator middleware.
+type ValidatorOption func(*validatorOptions)
+
+type validatorOptions struct {
+	warmup      []proto.Message
+	constraints map[protoreflect.FullName][]ConstraintFunc
+	failOpen    []string
+	logger      log.Logger
+	catalog     ValidationCatalog
+	locales     []string
+	matcher     language.Matcher
+}
+
+// WithValidationWarmup compiles the constraints of the message types at
+// startup instead of on their first request, invalid constraints then
+// panic when the middleware is created rather than failing the requests.
+func WithValidationWarmup(msgs ...proto.Message) ValidatorOption {
+	return func(o *validatorOptions) {
+		o.warmup = append(o.warmup, msgs...)
+	}
+}
+
+// WithConstraint registers a constraint of the message type of msg, checked
+// after its protovalidate constraints, for the rules which are not expressible
+// in CEL with the standard functions.
+func WithConstraint(msg proto.Message, fn ConstraintFunc) ValidatorOption {
+	return func(o *validatorOptions) {
+		name := msg.ProtoReflect().Descriptor().FullName()
+		o.constraints[name] = append(o.constraints[name], fn)
+	}
+}
+
+// WithValidationFailOpen logs the violations of the messages whose full name
+// matches one of patterns, in the path.Match syntax, all messages without
+// patterns, at warn level instead of rejecting the request. It allows new
+// constraints to be deployed and observed before being enforced.
+func WithValidationFailOpen(logger log.Logger, patterns ...string) ValidatorOption {
+	return func(o *validatorOptions) {
+		o.logger = logger
+		o.failOpen = append(o.failOpen, patterns...)
+	}
+}
+
+// enforced reports whether the violations of the message type reject the
+// request.
+func (o *validatorOptions) enforced(name protoreflect.FullName) bool {
+	if o.logger == nil {
+		return true
+	}
+	if len(o.failOpen) == 0 {
+		return false
+	}
+	for _, pattern := range o.failOpen {
+		if ok, _ := path.Match(pattern, string(name)); ok {
+			return false
+		}
+	}
+	return true
+}
+
+func newValidatorOptions(opts []ValidatorOption) *validatorOptions {
+	o := &validatorOptions{constraints: map[protoreflect.FullName][]ConstraintFunc{}}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Validator is a validator middleware. Without options the validator is
+// shared by all the middlewares.
+func Validator(opts ...ValidatorOption) middleware.Middleware {
+	o := newValidatorOptions(opts)
+	v := sharedValidator()
+	if len(o.warmup) > 0 {
+		var err error
+		if v, err = protovalidate.New(protovalidate.WithMessages(o.warmup...)); err != nil {
+			panic(fmt.Sprintf("failed to initialize validator: %v", err))
+		}
+		// the constraints which fail to compile are only reported on validation
+		for _, msg := range o.warmup {
+			var compileErr *protovalidate.CompilationError
+			if err := v.Validate(msg.ProtoReflect().Type().New().Interface()); errors.As(err, &compileErr) {
+				panic(fmt.Sprintf("failed to compile the constraints of %s: %v", msg.ProtoReflect().Descriptor().FullName(), err))
+			}
+		}
+	}
+
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (reply interface{}, err error) {
+			msg, ok := req.(proto.Message)
+			if !ok {
+				return handler(ctx, req)
+			}
+			localize := o.localizer(ctx)
+			err = v.Validate(msg)
+			if fns := o.constraints[msg.ProtoReflect().Descriptor().FullName()]; len(fns) > 0 {
+				err = checkConstraints(ctx, msg, err, fns, localize)
+			}
+			if err == nil {
+				return handler(ctx, req)
+			}
+			name := msg.ProtoReflect().Descriptor().FullName()
+			if o.enforced(name) {
+				return nil, handleValidationError(err, localize)
+			}
+			_ = log.WithContext(ctx, o.logger).Log(log.LevelWarn,
+				"msg", "request validation failed, not enforced",
+				"type", name,
+				"violations", errors.FromError(handleValidationError(err, keepMessage)).Metadata,
+			)
+			return handler(ctx, req)
+		}
+	}
+}
+
+func sharedValidator() *protovalidate.Validator {
 	once.Do(func() {
 		v, err := protovalidate.New()
 		if err != nil {
@@ -30,29 +152,51 @@ func Validator() middleware.Middleware {
 		}
 		validator = v
 	})
+	return validator
+}
 
-	return func(handler middleware.Handler) middleware.Handler {
-		return func(ctx context.Context, req interface{}) (reply interface{}, err error) {
-			if msg, ok := req.(protoreflect.ProtoMessage); ok {
-				if err = validator.Validate(msg); err != nil {
-					return nil, handleValidationError(err)
-				}
+// checkConstraints runs the custom constraints of msg and merges their
+// violations with the ones of the protovalidate error.
+func checkConstraints(ctx context.Context, msg proto.Message, err error, fns []ConstraintFunc, localize localizeFunc) error {
+	errMeta := make(map[string]string)
+	for _, fn := range fns {
+		for field, violation := range fn(ctx, msg) {
+			errMeta[field] = violation
+		}
+	}
+	if len(errMeta) == 0 {
+		return err
+	}
+	if err != nil {
+		if se := errors.FromError(handleValidationError(err, localize)); se != nil {
+			for field, violation := range se.Metadata {
+				errMeta[field] = violation
 			}
-			return handler(ctx, req)
 		}
 	}
+	return validationFailed(errMeta)
 }
 
-// handleValidationError processes the validation error and returns a formatted error response
-func handleValidationError(err error) error {
+// handleValidationError processes the validation error and returns a formatted error response, the
+// messages of the violations are localized by their constraint id
+func handleValidationError(err error, localize localizeFunc) error {
+	if se := new(errors.Error); errors.As(err, &se) {
+		return se
+	}
 	errMeta := make(map[string]string)
 	if pvErr, ok := err.(*protovalidate.ValidationError); ok {
 		for _, violation := range pvErr.Violations {
-			errMeta[fieldPathString(violation.Proto.Field.Elements)] = *violation.Proto.Message
+			errMeta[fieldPathString(violation.Proto.Field.Elements)] = localize(violation.Proto.GetConstraintId(), violation.Proto.GetMessage())
 		}
 	} else {
 		errMeta["message"] = err.Error()
 	}
+	return validationFailed(errMeta)
+}
+
+// validationFailed returns the error of a failed request validation, the
+// metadata maps the field paths to the violations.
+func validationFailed(errMeta map[string]string) error {
 	return errors.BadRequest("VALIDATION_FAILED", "request validation failed").WithMetadata(errMeta)
 }
 
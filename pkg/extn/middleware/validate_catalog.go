@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/go-kratos/kratos/v2/transport"
+	"golang.org/x/text/language"
+)
+
+// AcceptLanguageHeader is the request header selecting the locale of the
+// validation messages.
+const AcceptLanguageHeader = "Accept-Language"
+
+// ValidationCatalog holds the user displayable messages of the validation
+// violations by locale, e.g. en or pt-BR, then by constraint id: the
+// protovalidate constraint id, e.g. string.min_len, or the JSON schema
+// keyword, e.g. minLength. Violations without a message in the catalog keep
+// their original message.
+type ValidationCatalog map[string]map[string]string
+
+// WithValidationCatalog localizes the messages of the violations with the
+// catalog, in the locale of the catalog which best matches the
+// Accept-Language header of the request, defaultLocale when none does.
+func WithValidationCatalog(catalog ValidationCatalog, defaultLocale string) ValidatorOption {
+	return func(o *validatorOptions) {
+		o.catalog = catalog
+		o.locales = []string{defaultLocale}
+		for locale := range catalog {
+			if locale != defaultLocale {
+				o.locales = append(o.locales, locale)
+			}
+		}
+		tags := make([]language.Tag, len(o.locales))
+		for i, locale := range o.locales {
+			tags[i] = language.Make(locale)
+		}
+		o.matcher = language.NewMatcher(tags)
+	}
+}
+
+// localizeFunc returns the message of a violation of the constraint.
+type localizeFunc func(constraintId, message string) string
+
+func keepMessage(_, message string) string {
+	return message
+}
+
+// localizer returns the localizeFunc of the locale of the request.
+func (o *validatorOptions) localizer(ctx context.Context) localizeFunc {
+	if o.catalog == nil {
+		return keepMessage
+	}
+	locale := o.locales[0]
+	if tr, ok := transport.FromServerContext(ctx); ok {
+		if tags, _, err := language.ParseAcceptLanguage(tr.RequestHeader().Get(AcceptLanguageHeader)); err == nil && len(tags) > 0 {
+			_, i, _ := o.matcher.Match(tags...)
+			locale = o.locales[i]
+		}
+	}
+	messages := o.catalog[locale]
+	return func(constraintId, message string) string {
+		if m, ok := messages[constraintId]; ok && constraintId != "" {
+			return m
+		}
+		return message
+	}
+}
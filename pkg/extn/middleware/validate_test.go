@@ -0,0 +1,191 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"buf.build/gen/go/bufbuild/protovalidate/protocolbuffers/go/buf/validate"
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// newAccount returns a test.v1.<name> message with the name field, which must
+// be at least 3 characters long, and the message constraint expression if any.
+func newAccount(t *testing.T, name, value, expression string) proto.Message {
+	fieldOpts := &descriptorpb.FieldOptions{}
+	proto.SetExtension(fieldOpts, validate.E_Field, &validate.FieldConstraints{
+		Type: &validate.FieldConstraints_String_{String_: &validate.StringRules{MinLen: proto.Uint64(3)}},
+	})
+	msgOpts := &descriptorpb.MessageOptions{}
+	if expression != "" {
+		proto.SetExtension(msgOpts, validate.E_Message, &validate.MessageConstraints{
+			Cel: []*validate.Constraint{{Id: proto.String("account.test"), Message: proto.String("invalid account"), Expression: proto.String(expression)}},
+		})
+	}
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:       proto.String("test/v1/" + strings.ToLower(name) + ".proto"),
+		Package:    proto.String("test.v1"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"buf/validate/validate.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name:    proto.String(name),
+			Options: msgOpts,
+			Field: []*descriptorpb.FieldDescriptorProto{{
+				Name:     proto.String("name"),
+				JsonName: proto.String("name"),
+				Number:   proto.Int32(1),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				Options:  fieldOpts,
+			}},
+		}},
+	}, protoregistry.GlobalFiles)
+	require.NoError(t, err)
+	msg := dynamicpb.NewMessage(file.Messages().Get(0))
+	msg.Set(file.Messages().Get(0).Fields().ByName("name"), protoreflect.ValueOfString(value))
+	return msg
+}
+
+// validateRequest runs the Validator middleware on req, returning whether the
+// handler was called and the metadata of the validation error.
+func validateRequest(t *testing.T, ctx context.Context, req interface{}, opts ...ValidatorOption) (bool, map[string]string) {
+	called := false
+	handler := Validator(opts...)(func(ctx context.Context, req interface{}) (interface{}, error) {
+		called = true
+		return "ok", nil
+	})
+	_, err := handler(ctx, req)
+	if err == nil {
+		return called, nil
+	}
+	se := errors.FromError(err)
+	require.Equal(t, "VALIDATION_FAILED", se.Reason, err)
+	return called, se.Metadata
+}
+
+func upperCase(field string) ConstraintFunc {
+	return func(_ context.Context, msg proto.Message) map[string]string {
+		fd := msg.ProtoReflect().Descriptor().Fields().ByName(protoreflect.Name(field))
+		if v := msg.ProtoReflect().Get(fd).String(); v != strings.ToUpper(v) {
+			return map[string]string{field: "must be upper case"}
+		}
+		return nil
+	}
+}
+
+func TestValidator(t *testing.T) {
+	ctx := context.Background()
+	called, meta := validateRequest(t, ctx, newAccount(t, "Account", "ab", ""))
+	assert.False(t, called)
+	assert.Equal(t, map[string]string{"name": "value length must be at least 3 characters"}, meta)
+
+	called, meta = validateRequest(t, ctx, newAccount(t, "Account", "abc", ""))
+	assert.True(t, called)
+	assert.Nil(t, meta)
+
+	// other requests are not validated
+	called, _ = validateRequest(t, ctx, "not a message")
+	assert.True(t, called)
+}
+
+func TestValidatorConstraint(t *testing.T) {
+	ctx := context.Background()
+	opt := WithConstraint(wrapperspb.String(""), upperCase("value"))
+
+	called, meta := validateRequest(t, ctx, wrapperspb.String("abc"), opt)
+	assert.False(t, called)
+	assert.Equal(t, map[string]string{"value": "must be upper case"}, meta)
+	called, _ = validateRequest(t, ctx, wrapperspb.String("ABC"), opt)
+	assert.True(t, called)
+	// the constraint applies to its message type only
+	called, _ = validateRequest(t, ctx, wrapperspb.Bytes([]byte("abc")), opt)
+	assert.True(t, called)
+
+	// the violations are merged with the protovalidate ones
+	account := newAccount(t, "Holder", "abc", "")
+	_, meta = validateRequest(t, ctx, account, WithConstraint(account, upperCase("name")))
+	assert.Equal(t, map[string]string{"name": "must be upper case"}, meta)
+	account = newAccount(t, "Owner", "AB", "")
+	_, meta = validateRequest(t, ctx, account, WithConstraint(account, func(context.Context, proto.Message) map[string]string {
+		return map[string]string{"owner": "unknown owner"}
+	}))
+	assert.Equal(t, map[string]string{"name": "value length must be at least 3 characters", "owner": "unknown owner"}, meta)
+}
+
+func TestValidatorFailOpen(t *testing.T) {
+	ctx := context.Background()
+	account := newAccount(t, "Account", "ab", "")
+	constraint := WithConstraint(wrapperspb.String(""), upperCase("value"))
+
+	logger := &recordingLogger{}
+	opts := []ValidatorOption{constraint, WithValidationFailOpen(logger, "test.v1.*")}
+	called, _ := validateRequest(t, ctx, account, opts...)
+	assert.True(t, called, "the violations of test.v1 messages were enforced")
+	require.Len(t, logger.entries, 1)
+	assert.Equal(t, log.LevelWarn, logger.entries[0].level)
+	assert.Equal(t, protoreflect.FullName("test.v1.Account"), logger.entries[0].keyvals["type"])
+	assert.Equal(t, map[string]string{"name": "value length must be at least 3 characters"}, logger.entries[0].keyvals["violations"])
+
+	called, meta := validateRequest(t, ctx, wrapperspb.String("abc"), opts...)
+	assert.False(t, called, "the violations of other messages were not enforced")
+	assert.Equal(t, map[string]string{"value": "must be upper case"}, meta)
+
+	// without patterns no violation is enforced
+	called, _ = validateRequest(t, ctx, wrapperspb.String("abc"), constraint, WithValidationFailOpen(&recordingLogger{}))
+	assert.True(t, called)
+}
+
+func TestValidatorWarmup(t *testing.T) {
+	account := newAccount(t, "Account", "ab", "")
+	called, meta := validateRequest(t, context.Background(), account, WithValidationWarmup(account))
+	assert.False(t, called)
+	assert.Equal(t, map[string]string{"name": "value length must be at least 3 characters"}, meta)
+
+	invalid := newAccount(t, "Invalid", "abc", "this.balance > 0")
+	assert.Panics(t, func() { Validator(WithValidationWarmup(invalid)) })
+}
+
+func TestValidationCatalog(t *testing.T) {
+	catalog := ValidationCatalog{
+		"en":    {"string.min_len": "too short"},
+		"pt-BR": {"string.min_len": "muito curto"},
+		"fr":    {"other.constraint": "autre"},
+	}
+	opt := WithValidationCatalog(catalog, "en")
+	tests := []struct {
+		name           string
+		acceptLanguage string
+		expected       string
+	}{
+		{name: "default locale", expected: "too short"},
+		{name: "exact", acceptLanguage: "pt-BR", expected: "muito curto"},
+		{name: "by language", acceptLanguage: "pt", expected: "muito curto"},
+		{name: "by quality", acceptLanguage: "de;q=0.9, pt-BR;q=0.8, en;q=0.5", expected: "muito curto"},
+		{name: "unknown locale", acceptLanguage: "de", expected: "too short"},
+		{name: "malformed header", acceptLanguage: ";;", expected: "too short"},
+		{name: "constraint not in the catalog", acceptLanguage: "fr", expected: "value length must be at least 3 characters"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := newTestTransport("/test.v1.Accounts/Create", nil)
+			if tt.acceptLanguage != "" {
+				tr.header.Set(AcceptLanguageHeader, tt.acceptLanguage)
+			}
+			ctx := transport.NewServerContext(context.Background(), tr)
+			called, meta := validateRequest(t, ctx, newAccount(t, "Account", "ab", ""), opt)
+			assert.False(t, called)
+			assert.Equal(t, map[string]string{"name": tt.expected}, meta)
+		})
+	}
+}
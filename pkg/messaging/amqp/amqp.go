@@ -0,0 +1,207 @@
+// Package amqp provides a RabbitMQ broker backed by watermill-amqp. Importing
+// the package registers it as "amqp", BrokerConfig.Address is the AMQP URI,
+// e.g. amqp://localhost:5672/vhost.
+//
+// Messages are published to one exchange, "events" of type "topic" by
+// default, with their topic as routing key. A subscriber consumes a queue named
+// after the DurableName of its config, else the ConsumerName, HandlerName or
+// Subject, which is bound to the exchange with the subject as binding key.
+// The subscribers sharing a queue compete for its messages.
+//
+// With a DeadLetterSubject the queue is declared with the dead-letter exchange
+// arguments, a failed message is nacked without requeue, after MaxDeliveries
+// attempts when set, and the broker routes it to the dead-letter exchange with
+// the DeadLetterSubject as routing key, recording the failure in the x-death
+// header. A durable queue named after the DeadLetterSubject holds them, consume
+// it with a subscriber whose DurableName is the DeadLetterSubject.
+package amqp
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	watermill_amqp "github.com/ThreeDotsLabs/watermill-amqp/v3/pkg/amqp"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+	"github.com/achuala/go-svc-extn/pkg/messaging"
+	"github.com/achuala/go-svc-extn/pkg/util/idgen"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+const (
+	// shutdownTimeout bounds the cleanup func of NewAmqpSubscriber.
+	shutdownTimeout = 5 * time.Second
+	// routerCloseTimeout leaves bounding the shutdown to the ctx of Shutdown.
+	routerCloseTimeout = time.Hour
+)
+
+func init() {
+	messaging.RegisterBroker(messaging.Amqp, newPublisher, newSubscriber)
+}
+
+type AmqpPublisher struct {
+	publisher message.Publisher
+}
+
+// NewAmqpPublisher connects to the broker of cfg, the exchange is declared on
+// the first publish.
+func NewAmqpPublisher(cfg *messaging.BrokerConfig, logger log.Logger, opts ...Option) (*AmqpPublisher, func(), error) {
+	log := log.NewHelper(logger)
+	amqpConfig, err := config(cfg, nil, newOptions(opts))
+	if err != nil {
+		return nil, nil, err
+	}
+	log.Infof("publisher connecting to amqp at - %s", redacted(amqpConfig.Connection.AmqpURI))
+	publisher, err := watermill_amqp.NewPublisher(amqpConfig, messaging.NewWatermillLoggerAdapter(logger))
+	if err != nil {
+		return nil, nil, err
+	}
+	return &AmqpPublisher{publisher: messaging.TracingPublisher(publisher)}, func() {
+		if err := publisher.Close(); err != nil {
+			log.Warnf("failed to close publisher: %v", err)
+		}
+	}, nil
+}
+
+func (p *AmqpPublisher) PublishEvent(topic string, event *cloudevents.Event) error {
+	msg, err := messaging.EventMessage(context.Background(), event, messaging.StructuredMode)
+	if err != nil {
+		return err
+	}
+	return p.publisher.Publish(topic, msg)
+}
+
+func (p *AmqpPublisher) PublishMessage(topic string, msg *message.Message) error {
+	return p.publisher.Publish(topic, msg)
+}
+
+func (p *AmqpPublisher) Publish(topic string, data []byte) error {
+	msg := message.NewMessage(idgen.NewId(), data)
+	return p.publisher.Publish(topic, msg)
+}
+
+type AmqpSubscriber struct {
+	router     *message.Router
+	subscriber *watermill_amqp.Subscriber
+	log        *log.Helper
+	once       sync.Once
+}
+
+// NewAmqpSubscriber declares the exchange, the queue of subCfg and its binding
+// and handles the messages of the queue with the HandlerFunc of subCfg once Run.
+func NewAmqpSubscriber(cfg *messaging.BrokerConfig, subCfg *messaging.NatsJsConsumerConfig, logger log.Logger, opts ...Option) (*AmqpSubscriber, func(), error) {
+	log := log.NewHelper(logger)
+	wmLogger := messaging.NewWatermillLoggerAdapter(logger)
+	amqpConfig, err := config(cfg, subCfg, newOptions(opts))
+	if err != nil {
+		return nil, nil, err
+	}
+	middlewares := []message.HandlerMiddleware{messaging.Tracing()}
+	if subCfg.Meter != nil {
+		metrics, err := messaging.Metrics(subCfg.Meter)
+		if err != nil {
+			return nil, nil, err
+		}
+		middlewares = append(middlewares, metrics)
+	}
+	if subCfg.PayloadCodec != nil {
+		middlewares = append(middlewares, subCfg.PayloadCodec.Decoding())
+	}
+	if subCfg.SchemaValidator != nil {
+		// Outside of the retries, a payload does not get valid by retrying.
+		middlewares = append(middlewares, messaging.SchemaValidation(subCfg.SchemaValidator, subCfg.Schemas))
+	}
+	retry := subCfg.Retry
+	if subCfg.MaxDeliveries > 0 && subCfg.DeadLetterSubject != "" {
+		// The message is nacked, and so dead-lettered by the broker, after
+		// MaxDeliveries failed attempts.
+		deliveries := messaging.RetryConfig{}
+		if retry != nil {
+			deliveries = *retry
+		}
+		deliveries.MaxRetries = subCfg.MaxDeliveries - 1
+		retry = &deliveries
+	}
+	if retry != nil {
+		middlewares = append(middlewares, retry.Middleware(logger))
+	}
+	middlewares = append(middlewares, subCfg.Middlewares...)
+	middlewares = append(middlewares, middleware.Recoverer)
+
+	log.Infof("subscriber connecting to amqp at - %s", redacted(amqpConfig.Connection.AmqpURI))
+	subscriber, err := watermill_amqp.NewSubscriber(amqpConfig, wmLogger)
+	if err != nil {
+		return nil, nil, err
+	}
+	router, err := message.NewRouter(message.RouterConfig{CloseTimeout: routerCloseTimeout}, wmLogger)
+	if err != nil {
+		subscriber.Close()
+		return nil, nil, err
+	}
+	router.AddMiddleware(middlewares...)
+	name := subCfg.HandlerName
+	if name == "" {
+		name = subCfg.Subject
+	}
+	router.AddNoPublisherHandler(name, subCfg.Subject, subscriber, subCfg.HandlerFunc)
+	amqpSubscriber := &AmqpSubscriber{router: router, subscriber: subscriber, log: log}
+	return amqpSubscriber, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := amqpSubscriber.Shutdown(ctx); err != nil {
+			log.Warnf("subscriber closed before in-flight messages completed: %v", err)
+		}
+	}, nil
+}
+
+func (s *AmqpSubscriber) Run(ctx context.Context) error {
+	s.log.Info("starting router and subscriber")
+	return s.router.Run(ctx)
+}
+
+// Shutdown stops receiving new messages and waits for the handlers in flight
+// until ctx is done, returning ctx.Err() when they were still running, their
+// messages are then redelivered.
+func (s *AmqpSubscriber) Shutdown(ctx context.Context) error {
+	s.log.Info("closing subscriber")
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		s.router.Close()
+	}()
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	s.once.Do(func() {
+		if err := s.subscriber.Close(); err != nil {
+			s.log.Warnf("failed to close subscriber: %v", err)
+		}
+	})
+	return err
+}
+
+// Running is closed once the subscriber is ready to receive messages.
+func (s *AmqpSubscriber) Running() chan struct{} {
+	return s.router.Running()
+}
+
+func newPublisher(cfg *messaging.BrokerConfig, logger log.Logger) (messaging.Publisher, func(), error) {
+	publisher, cleanup, err := NewAmqpPublisher(cfg, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	return publisher, cleanup, nil
+}
+
+func newSubscriber(cfg *messaging.BrokerConfig, subCfg *messaging.NatsJsConsumerConfig, logger log.Logger) (messaging.Subscriber, func(), error) {
+	subscriber, cleanup, err := NewAmqpSubscriber(cfg, subCfg, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	return subscriber, cleanup, nil
+}
@@ -0,0 +1,136 @@
+package amqp_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/achuala/go-svc-extn/pkg/messaging"
+	_ "github.com/achuala/go-svc-extn/pkg/messaging/amqp"
+	"github.com/achuala/go-svc-extn/pkg/util/idgen"
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+// brokerConfig returns the config of the RabbitMQ of AMQP_URL, the tests
+// needing a broker are skipped without it.
+func brokerConfig(t *testing.T) *messaging.BrokerConfig {
+	url := os.Getenv("AMQP_URL")
+	if url == "" {
+		t.Skip("AMQP_URL is not set")
+	}
+	return &messaging.BrokerConfig{Broker: messaging.Amqp, Address: url, Timeout: 5 * time.Second}
+}
+
+func TestAmqpPublishConsume(t *testing.T) {
+	cfg := brokerConfig(t)
+	logger := log.NewStdLogger(os.Stdout)
+	queue := "test-" + idgen.NewId()
+
+	received := make(chan *message.Message, 1)
+	subscriber, closeSubscriber, err := messaging.NewSubscriber(cfg, &messaging.NatsJsConsumerConfig{
+		DurableName: queue,
+		Subject:     queue + ".>",
+		HandlerName: "test-handler",
+		HandlerFunc: func(msg *message.Message) error {
+			received <- msg
+			return nil
+		},
+	}, logger)
+	if err != nil {
+		t.Fatalf("failed to create subscriber: %v", err)
+	}
+	defer closeSubscriber()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go subscriber.Run(ctx)
+
+	publisher, closePublisher, err := messaging.NewPublisher(cfg, logger)
+	if err != nil {
+		t.Fatalf("failed to create publisher: %v", err)
+	}
+	defer closePublisher()
+	// the queue is bound once the subscriber runs
+	time.Sleep(time.Second)
+	if err := publisher.Publish(queue+".created", []byte("hello")); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+
+	select {
+	case msg := <-received:
+		if string(msg.Payload) != "hello" {
+			t.Errorf("expected payload hello, got %s", msg.Payload)
+		}
+		if got := msg.Metadata.Get(messaging.SubjectKey); got != queue+".created" {
+			t.Errorf("expected subject %s.created, got %s", queue, got)
+		}
+	case <-ctx.Done():
+		t.Fatal("message was not consumed")
+	}
+}
+
+func TestAmqpDeadLetter(t *testing.T) {
+	cfg := brokerConfig(t)
+	logger := log.NewStdLogger(os.Stdout)
+	queue := "test-" + idgen.NewId()
+	deadLetters := queue + ".dlq"
+
+	attempts := 0
+	subscriber, closeSubscriber, err := messaging.NewSubscriber(cfg, &messaging.NatsJsConsumerConfig{
+		DurableName:       queue,
+		Subject:           queue + ".created",
+		HandlerName:       "failing-handler",
+		MaxDeliveries:     2,
+		DeadLetterSubject: deadLetters,
+		HandlerFunc: func(msg *message.Message) error {
+			attempts++
+			return errors.New("failed")
+		},
+	}, logger)
+	if err != nil {
+		t.Fatalf("failed to create subscriber: %v", err)
+	}
+	defer closeSubscriber()
+	received := make(chan *message.Message, 1)
+	dlqSubscriber, closeDlqSubscriber, err := messaging.NewSubscriber(cfg, &messaging.NatsJsConsumerConfig{
+		DurableName: deadLetters,
+		Subject:     deadLetters,
+		HandlerName: "dlq-handler",
+		HandlerFunc: func(msg *message.Message) error {
+			received <- msg
+			return nil
+		},
+	}, logger)
+	if err != nil {
+		t.Fatalf("failed to create dead-letter subscriber: %v", err)
+	}
+	defer closeDlqSubscriber()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go subscriber.Run(ctx)
+	go dlqSubscriber.Run(ctx)
+
+	publisher, closePublisher, err := messaging.NewPublisher(cfg, logger)
+	if err != nil {
+		t.Fatalf("failed to create publisher: %v", err)
+	}
+	defer closePublisher()
+	time.Sleep(time.Second)
+	if err := publisher.Publish(queue+".created", []byte("poison")); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+
+	select {
+	case msg := <-received:
+		if string(msg.Payload) != "poison" {
+			t.Errorf("expected payload poison, got %s", msg.Payload)
+		}
+		if attempts != 2 {
+			t.Errorf("expected 2 attempts before dead-lettering, got %d", attempts)
+		}
+	case <-ctx.Done():
+		t.Fatal("message was not dead-lettered")
+	}
+}
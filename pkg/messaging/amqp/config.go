@@ -0,0 +1,242 @@
+package amqp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	watermill_amqp "github.com/ThreeDotsLabs/watermill-amqp/v3/pkg/amqp"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/achuala/go-svc-extn/pkg/messaging"
+	"github.com/achuala/go-svc-extn/pkg/util/idgen"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Queue arguments wiring the dead-lettering of a queue.
+const (
+	deadLetterExchangeArg   = "x-dead-letter-exchange"
+	deadLetterRoutingKeyArg = "x-dead-letter-routing-key"
+)
+
+// config returns the watermill config of the publisher, or of the subscriber
+// when subCfg is set.
+func config(cfg *messaging.BrokerConfig, subCfg *messaging.NatsJsConsumerConfig, o *options) (watermill_amqp.Config, error) {
+	uri, err := amqpURI(cfg)
+	if err != nil {
+		return watermill_amqp.Config{}, err
+	}
+	tlsConfig, err := tlsConfig(cfg.TLS)
+	if err != nil {
+		return watermill_amqp.Config{}, err
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	c := watermill_amqp.Config{
+		Connection: watermill_amqp.ConnectionConfig{
+			AmqpURI: uri,
+			AmqpConfig: &amqp.Config{
+				Heartbeat:       10 * time.Second,
+				Locale:          "en_US",
+				TLSClientConfig: tlsConfig,
+				Dial:            amqp.DefaultDial(timeout),
+			},
+			Reconnect: watermill_amqp.DefaultReconnectConfig(),
+		},
+		Marshaler: marshaler{watermill_amqp.DefaultMarshaler{NotPersistentDeliveryMode: !o.durable}},
+		Exchange: watermill_amqp.ExchangeConfig{
+			GenerateName: watermill_amqp.GenerateExchangeNameConstant(o.exchange),
+			Type:         o.exchangeType,
+			Durable:      o.durable,
+		},
+		Publish: watermill_amqp.PublishConfig{
+			GenerateRoutingKey: func(topic string) string {
+				return topic
+			},
+			ConfirmDelivery: o.confirmDelivery,
+		},
+		TopologyBuilder: &watermill_amqp.DefaultTopologyBuilder{},
+	}
+	if subCfg == nil {
+		return c, nil
+	}
+
+	queue := queueName(subCfg)
+	if queue == "" {
+		return watermill_amqp.Config{}, fmt.Errorf("amqp: the subscriber needs a DurableName, ConsumerName, HandlerName or Subject to name its queue")
+	}
+	args := maps.Clone(o.queueArguments)
+	if subCfg.DeadLetterSubject != "" {
+		if args == nil {
+			args = amqp.Table{}
+		}
+		args[deadLetterExchangeArg] = o.deadLetterExchangeName()
+		args[deadLetterRoutingKeyArg] = subCfg.DeadLetterSubject
+		dlx := &deadLetterTopology{exchange: o.deadLetterExchangeName(), kind: "topic", subject: subCfg.DeadLetterSubject, durable: o.durable}
+		if dlx.exchange == o.exchange {
+			dlx.kind = o.exchangeType
+		}
+		c.TopologyBuilder = dlx
+	}
+	c.Queue = watermill_amqp.QueueConfig{
+		GenerateName: watermill_amqp.GenerateQueueNameConstant(queue),
+		Durable:      o.durable,
+		Arguments:    args,
+	}
+	c.QueueBind = watermill_amqp.QueueBindConfig{
+		GenerateRoutingKey: bindingKey,
+	}
+	c.Consume = watermill_amqp.ConsumeConfig{
+		Consumer: subCfg.ConsumerName,
+		// A nacked message is dead-lettered rather than requeued.
+		NoRequeueOnNack: subCfg.DeadLetterSubject != "",
+		Qos: watermill_amqp.QosConfig{
+			PrefetchCount: o.prefetch,
+		},
+	}
+	return c, nil
+}
+
+func (o *options) deadLetterExchangeName() string {
+	if o.deadLetterExchange != "" {
+		return o.deadLetterExchange
+	}
+	return o.exchange
+}
+
+// queueName names the queue of the subscriber, the subscribers sharing it
+// compete for its messages.
+func queueName(subCfg *messaging.NatsJsConsumerConfig) string {
+	for _, name := range []string{subCfg.DurableName, subCfg.ConsumerName, subCfg.HandlerName, subCfg.Subject} {
+		if name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// bindingKey maps the NATS wildcard ">" of the subject to the AMQP one "#",
+// "*" matches one token in both.
+func bindingKey(subject string) string {
+	tokens := strings.Split(subject, ".")
+	if tokens[len(tokens)-1] == ">" {
+		tokens[len(tokens)-1] = "#"
+	}
+	return strings.Join(tokens, ".")
+}
+
+// amqpURI returns the address with the credentials of cfg, unless it has some.
+func amqpURI(cfg *messaging.BrokerConfig) (string, error) {
+	u, err := url.Parse(cfg.Address)
+	if err != nil {
+		return "", fmt.Errorf("amqp: invalid address: %w", err)
+	}
+	if u.User == nil && cfg.Username != "" {
+		u.User = url.UserPassword(cfg.Username, cfg.Password)
+	}
+	if cfg.TLS != nil && u.Scheme == "amqp" {
+		u.Scheme = "amqps"
+	}
+	return u.String(), nil
+}
+
+// redacted returns the uri without its password, for the logs.
+func redacted(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return ""
+	}
+	return u.Redacted()
+}
+
+func tlsConfig(t *messaging.BrokerTLSConfig) (*tls.Config, error) {
+	if t == nil {
+		return nil, nil
+	}
+	c := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if t.CaFile != "" {
+		pem, err := os.ReadFile(t.CaFile)
+		if err != nil {
+			return nil, err
+		}
+		c.RootCAs = x509.NewCertPool()
+		if !c.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("amqp: no certificate in %s", t.CaFile)
+		}
+	}
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	return c, nil
+}
+
+// marshaler records the routing key of the received messages in the
+// messaging.SubjectKey metadata, so that the schema of the subject applies to
+// the subscribers of wildcard subjects. Unlike the default one it accepts the
+// headers which are not strings, like the x-death header of the dead-lettered
+// messages, and the messages of other publishers, without watermill uuid.
+type marshaler struct {
+	watermill_amqp.DefaultMarshaler
+}
+
+func (m marshaler) Unmarshal(delivery amqp.Delivery) (*message.Message, error) {
+	id, _ := delivery.Headers[watermill_amqp.DefaultMessageUUIDHeaderKey].(string)
+	if id == "" {
+		id = delivery.MessageId
+	}
+	if id == "" {
+		id = idgen.NewId()
+	}
+	msg := message.NewMessage(id, delivery.Body)
+	for key, value := range delivery.Headers {
+		if key == watermill_amqp.DefaultMessageUUIDHeaderKey {
+			continue
+		}
+		if s, ok := value.(string); ok {
+			msg.Metadata.Set(key, s)
+		} else {
+			msg.Metadata.Set(key, fmt.Sprint(value))
+		}
+	}
+	msg.Metadata.Set(messaging.SubjectKey, delivery.RoutingKey)
+	return msg, nil
+}
+
+// deadLetterTopology declares the dead-letter exchange and a queue named after
+// the dead-letter subject, so that the dead-lettered messages are kept until
+// a subscriber of the subject consumes them.
+type deadLetterTopology struct {
+	watermill_amqp.DefaultTopologyBuilder
+	exchange string
+	kind     string
+	subject  string
+	durable  bool
+}
+
+func (t *deadLetterTopology) BuildTopology(channel *amqp.Channel, params watermill_amqp.BuildTopologyParams, config watermill_amqp.Config, logger watermill.LoggerAdapter) error {
+	if err := channel.ExchangeDeclare(t.exchange, t.kind, t.durable, false, false, false, nil); err != nil {
+		return fmt.Errorf("cannot declare dead-letter exchange: %w", err)
+	}
+	if _, err := channel.QueueDeclare(t.subject, t.durable, false, false, false, nil); err != nil {
+		return fmt.Errorf("cannot declare dead-letter queue: %w", err)
+	}
+	if err := channel.QueueBind(t.subject, t.subject, t.exchange, false, nil); err != nil {
+		return fmt.Errorf("cannot bind dead-letter queue: %w", err)
+	}
+	return t.DefaultTopologyBuilder.BuildTopology(channel, params, config, logger)
+}
@@ -0,0 +1,84 @@
+package amqp
+
+import (
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// options are shared by the publisher and the subscriber, both declare the
+// exchange and the declarations must match.
+type options struct {
+	exchange           string
+	exchangeType       string
+	durable            bool
+	prefetch           int
+	deadLetterExchange string
+	queueArguments     amqp.Table
+	confirmDelivery    bool
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		exchange:     "events",
+		exchangeType: "topic",
+		durable:      true,
+		prefetch:     1,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Option configures an AmqpPublisher or an AmqpSubscriber.
+type Option func(*options)
+
+// WithExchange sets the exchange the messages are published to and the queues
+// are bound to, "events" of type "topic" by default. With a topic exchange the
+// topic of a message is its routing key and the subject of a subscriber its
+// binding key, where the NATS wildcard ">" is mapped to "#".
+func WithExchange(name, kind string) Option {
+	return func(o *options) {
+		o.exchange = name
+		o.exchangeType = kind
+	}
+}
+
+// WithDurable sets whether the exchange and the queues survive a broker
+// restart, true by default. Messages are published persistent when durable.
+func WithDurable(durable bool) Option {
+	return func(o *options) {
+		o.durable = durable
+	}
+}
+
+// WithPrefetch sets how many unacknowledged messages the broker delivers to
+// the subscriber, 1 by default.
+func WithPrefetch(count int) Option {
+	return func(o *options) {
+		o.prefetch = count
+	}
+}
+
+// WithDeadLetterExchange sets the exchange receiving the messages dead-lettered
+// to NatsJsConsumerConfig.DeadLetterSubject, the exchange of WithExchange by
+// default. It is declared as a topic exchange.
+func WithDeadLetterExchange(name string) Option {
+	return func(o *options) {
+		o.deadLetterExchange = name
+	}
+}
+
+// WithQueueArguments adds arguments to the queue declaration, e.g.
+// "x-queue-type": "quorum" or "x-message-ttl".
+func WithQueueArguments(args amqp.Table) Option {
+	return func(o *options) {
+		o.queueArguments = args
+	}
+}
+
+// WithConfirmDelivery makes the publishes wait for the broker confirmation.
+func WithConfirmDelivery() Option {
+	return func(o *options) {
+		o.confirmDelivery = true
+	}
+}
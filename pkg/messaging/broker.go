@@ -0,0 +1,98 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+// Broker names accepted in BrokerConfig.Broker.
+const (
+	Nats  = "nats"
+	Amqp  = "amqp"
+	InMem = "inmem"
+)
+
+// ErrUnknownBroker is returned when no backend is registered for BrokerConfig.Broker.
+var ErrUnknownBroker = errors.New("messaging: unknown broker")
+
+// Publisher is implemented by every broker backend.
+type Publisher interface {
+	PublishEvent(topic string, event *cloudevents.Event) error
+	PublishMessage(topic string, msg *message.Message) error
+	Publish(topic string, data []byte) error
+}
+
+// Subscriber consumes the configured subject until ctx is done or Shutdown is called.
+type Subscriber interface {
+	Run(ctx context.Context) error
+	// Shutdown stops receiving new messages and waits, bounded by ctx, for the
+	// handlers in flight before closing the subscriber.
+	Shutdown(ctx context.Context) error
+}
+
+// PublisherFunc builds a Publisher and its cleanup function for a broker.
+type PublisherFunc func(cfg *BrokerConfig, logger log.Logger) (Publisher, func(), error)
+
+// SubscriberFunc builds a Subscriber and its cleanup function for a broker.
+type SubscriberFunc func(cfg *BrokerConfig, subCfg *NatsJsConsumerConfig, logger log.Logger) (Subscriber, func(), error)
+
+type backend struct {
+	publisher  PublisherFunc
+	subscriber SubscriberFunc
+}
+
+var (
+	backendsMu sync.RWMutex
+	backends   = map[string]backend{}
+)
+
+// RegisterBroker makes a broker backend available to NewPublisher and NewSubscriber
+// under name. Backend packages call it from init, so the application only needs a
+// blank import of the package, e.g. _ "github.com/achuala/go-svc-extn/pkg/messaging/nats".
+func RegisterBroker(name string, publisher PublisherFunc, subscriber SubscriberFunc) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	backends[name] = backend{publisher: publisher, subscriber: subscriber}
+}
+
+func lookupBroker(name string) (backend, error) {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	b, ok := backends[name]
+	if !ok {
+		registered := make([]string, 0, len(backends))
+		for n := range backends {
+			registered = append(registered, n)
+		}
+		sort.Strings(registered)
+		return backend{}, fmt.Errorf("%w %q, registered: %v", ErrUnknownBroker, name, registered)
+	}
+	return b, nil
+}
+
+// NewPublisher returns a publisher for the broker named in cfg.Broker.
+func NewPublisher(cfg *BrokerConfig, logger log.Logger) (Publisher, func(), error) {
+	b, err := lookupBroker(cfg.Broker)
+	if err != nil {
+		return nil, nil, err
+	}
+	return b.publisher(cfg, logger)
+}
+
+// NewSubscriber returns a subscriber for the broker named in cfg.Broker that
+// routes messages on subCfg.Subject to subCfg.HandlerFunc. Fields of subCfg a
+// broker has no notion of, such as the stream name, are ignored.
+func NewSubscriber(cfg *BrokerConfig, subCfg *NatsJsConsumerConfig, logger log.Logger) (Subscriber, func(), error) {
+	b, err := lookupBroker(cfg.Broker)
+	if err != nil {
+		return nil, nil, err
+	}
+	return b.subscriber(cfg, subCfg, logger)
+}
@@ -0,0 +1,64 @@
+package messaging_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/achuala/go-svc-extn/pkg/messaging"
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+type testPublisher struct{ messaging.Publisher }
+
+type testSubscriber struct{ subject string }
+
+func (s *testSubscriber) Run(ctx context.Context) error      { return nil }
+func (s *testSubscriber) Shutdown(ctx context.Context) error { return nil }
+
+func TestRegisterBroker(t *testing.T) {
+	var closed []string
+	messaging.RegisterBroker("test",
+		func(cfg *messaging.BrokerConfig, logger log.Logger) (messaging.Publisher, func(), error) {
+			return testPublisher{}, func() { closed = append(closed, "publisher") }, nil
+		},
+		func(cfg *messaging.BrokerConfig, subCfg *messaging.NatsJsConsumerConfig, logger log.Logger) (messaging.Subscriber, func(), error) {
+			return &testSubscriber{subject: subCfg.Subject}, func() { closed = append(closed, "subscriber") }, nil
+		})
+
+	cfg := &messaging.BrokerConfig{Broker: "test"}
+	pub, closePub, err := messaging.NewPublisher(cfg, log.DefaultLogger)
+	if err != nil {
+		t.Fatalf("failed to create the publisher: %v", err)
+	}
+	if _, ok := pub.(testPublisher); !ok {
+		t.Errorf("expected the publisher of the test broker, got %T", pub)
+	}
+	sub, closeSub, err := messaging.NewSubscriber(cfg, &messaging.NatsJsConsumerConfig{Subject: "orders.>"}, log.DefaultLogger)
+	if err != nil {
+		t.Fatalf("failed to create the subscriber: %v", err)
+	}
+	if s, ok := sub.(*testSubscriber); !ok || s.subject != "orders.>" {
+		t.Errorf("expected the subscriber of the test broker on orders.>, got %#v", sub)
+	}
+	closePub()
+	closeSub()
+	if strings.Join(closed, ",") != "publisher,subscriber" {
+		t.Errorf("expected the cleanup funcs of the broker, got %v", closed)
+	}
+}
+
+func TestUnknownBroker(t *testing.T) {
+	messaging.RegisterBroker("other", nil, nil)
+	_, _, err := messaging.NewPublisher(&messaging.BrokerConfig{Broker: "kafka"}, log.DefaultLogger)
+	if !errors.Is(err, messaging.ErrUnknownBroker) {
+		t.Fatalf("expected ErrUnknownBroker, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "other") {
+		t.Errorf("expected the registered brokers in %q", err)
+	}
+	if _, _, err := messaging.NewSubscriber(&messaging.BrokerConfig{}, &messaging.NatsJsConsumerConfig{}, log.DefaultLogger); !errors.Is(err, messaging.ErrUnknownBroker) {
+		t.Errorf("expected ErrUnknownBroker without broker, got %v", err)
+	}
+}
@@ -0,0 +1,231 @@
+package messaging
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/binding"
+	"github.com/cloudevents/sdk-go/v2/binding/format"
+	"github.com/cloudevents/sdk-go/v2/binding/spec"
+	"github.com/cloudevents/sdk-go/v2/types"
+)
+
+// ContentMode is how a CloudEvent is carried by a message.
+type ContentMode int
+
+const (
+	// StructuredMode carries the whole event as the JSON payload.
+	StructuredMode ContentMode = iota
+	// BinaryMode carries the data as the payload and the attributes as
+	// metadata, i.e. NATS headers, prefixed with "ce-", the datacontenttype
+	// being the ContentTypeKey metadata.
+	BinaryMode
+)
+
+// eventAttributePrefix prefixes the attributes of the binary mode events.
+const eventAttributePrefix = "ce-"
+
+var eventSpecs = spec.WithPrefix(eventAttributePrefix)
+
+// EventMessage returns the message carrying event in mode, with the event id
+// as message uuid and ctx as message context.
+func EventMessage(ctx context.Context, event *cloudevents.Event, mode ContentMode) (*message.Message, error) {
+	msg := message.NewMessage(event.ID(), nil)
+	msg.SetContext(ctx)
+	if mode == StructuredMode {
+		data, err := event.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		msg.Payload = data
+		msg.Metadata.Set(ContentTypeKey, cloudevents.ApplicationCloudEventsJSON)
+		return msg, nil
+	}
+	if err := event.Validate(); err != nil {
+		return nil, err
+	}
+	w := &eventWriter{msg: msg}
+	if _, err := binding.Write(binding.WithForceBinary(ctx), binding.ToMessage(event), nil, w); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// ConsumeEvent reconstructs the CloudEvent of msg, in binary or structured
+// mode. A message which does not carry an event returns an error wrapping
+// ErrDecode.
+func ConsumeEvent(msg *message.Message) (*cloudevents.Event, error) {
+	event, err := binding.ToEvent(msg.Context(), &eventReader{msg: msg})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDecode, err)
+	}
+	return event, nil
+}
+
+// EventHandlerFunc handles the CloudEvent of a message.
+type EventHandlerFunc func(ctx context.Context, event *cloudevents.Event) error
+
+// EventHandler adapts fn to a watermill handler func, e.g. for
+// NatsJsConsumerConfig.HandlerFunc. A message which does not carry an event is
+// nacked with an error wrapping ErrDecode without calling fn.
+func EventHandler(fn EventHandlerFunc) func(msg *message.Message) error {
+	return func(msg *message.Message) error {
+		event, err := ConsumeEvent(msg)
+		if err != nil {
+			return fmt.Errorf("message %s: %w", msg.UUID, err)
+		}
+		return fn(msg.Context(), event)
+	}
+}
+
+// isBinaryEvent reports whether msg carries a binary mode event.
+func isBinaryEvent(msg *message.Message) bool {
+	return msg.Metadata.Get(eventSpecs.PrefixedSpecVersionName()) != ""
+}
+
+// eventWriter writes a binary mode event to a message.
+type eventWriter struct {
+	msg *message.Message
+}
+
+func (w *eventWriter) Start(ctx context.Context) error {
+	return nil
+}
+
+func (w *eventWriter) End(ctx context.Context) error {
+	return nil
+}
+
+func (w *eventWriter) SetData(data io.Reader) error {
+	payload, err := io.ReadAll(data)
+	if err != nil {
+		return err
+	}
+	w.msg.Payload = payload
+	return nil
+}
+
+func (w *eventWriter) SetAttribute(attribute spec.Attribute, value interface{}) error {
+	key := eventAttributePrefix + attribute.Name()
+	if attribute.Kind() == spec.DataContentType {
+		key = ContentTypeKey
+	}
+	return w.set(key, value)
+}
+
+func (w *eventWriter) SetExtension(name string, value interface{}) error {
+	return w.set(eventAttributePrefix+name, value)
+}
+
+func (w *eventWriter) set(key string, value interface{}) error {
+	if value == nil {
+		delete(w.msg.Metadata, key)
+		return nil
+	}
+	s, err := types.Format(value)
+	if err != nil {
+		return err
+	}
+	w.msg.Metadata.Set(key, s)
+	return nil
+}
+
+// eventReader reads the event of a message for binding.ToEvent.
+type eventReader struct {
+	msg *message.Message
+}
+
+func (r *eventReader) version() spec.Version {
+	return eventSpecs.Version(r.msg.Metadata.Get(eventSpecs.PrefixedSpecVersionName()))
+}
+
+func (r *eventReader) ReadEncoding() binding.Encoding {
+	if isBinaryEvent(r.msg) {
+		if r.version() == nil {
+			return binding.EncodingUnknown
+		}
+		return binding.EncodingBinary
+	}
+	if len(bytes.TrimSpace(r.msg.Payload)) == 0 {
+		return binding.EncodingUnknown
+	}
+	return binding.EncodingStructured
+}
+
+func (r *eventReader) ReadStructured(ctx context.Context, w binding.StructuredWriter) error {
+	if r.ReadEncoding() != binding.EncodingStructured {
+		return binding.ErrNotStructured
+	}
+	return w.SetStructuredEvent(ctx, format.JSON, bytes.NewReader(r.msg.Payload))
+}
+
+func (r *eventReader) ReadBinary(ctx context.Context, w binding.BinaryWriter) error {
+	version := r.version()
+	if !isBinaryEvent(r.msg) || version == nil {
+		return binding.ErrNotBinary
+	}
+	// the spec version goes first, it selects the attributes of the event
+	if err := w.SetAttribute(version.AttributeFromKind(spec.SpecVersion), version.String()); err != nil {
+		return err
+	}
+	for key, value := range r.msg.Metadata {
+		if key == ContentTypeKey {
+			if err := w.SetAttribute(version.AttributeFromKind(spec.DataContentType), value); err != nil {
+				return err
+			}
+			continue
+		}
+		if !strings.HasPrefix(key, eventAttributePrefix) {
+			continue
+		}
+		if attribute := version.Attribute(key); attribute != nil {
+			if attribute.Kind() == spec.SpecVersion {
+				continue
+			}
+			if err := w.SetAttribute(attribute, value); err != nil {
+				return err
+			}
+		} else if err := w.SetExtension(strings.TrimPrefix(key, eventAttributePrefix), value); err != nil {
+			return err
+		}
+	}
+	if len(r.msg.Payload) > 0 {
+		return w.SetData(bytes.NewReader(r.msg.Payload))
+	}
+	return nil
+}
+
+func (r *eventReader) GetAttribute(kind spec.Kind) (spec.Attribute, interface{}) {
+	version := r.version()
+	if version == nil {
+		return nil, nil
+	}
+	attribute := version.AttributeFromKind(kind)
+	if attribute == nil {
+		return nil, nil
+	}
+	key := attribute.PrefixedName()
+	if kind == spec.DataContentType {
+		key = ContentTypeKey
+	}
+	if value, ok := r.msg.Metadata[key]; ok {
+		return attribute, value
+	}
+	return attribute, nil
+}
+
+func (r *eventReader) GetExtension(name string) interface{} {
+	if value, ok := r.msg.Metadata[eventAttributePrefix+name]; ok {
+		return value
+	}
+	return nil
+}
+
+func (r *eventReader) Finish(error) error {
+	return nil
+}
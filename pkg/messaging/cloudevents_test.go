@@ -0,0 +1,136 @@
+package messaging_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/achuala/go-svc-extn/pkg/messaging"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+func newOrderEvent(t *testing.T) *cloudevents.Event {
+	event := cloudevents.NewEvent()
+	event.SetID("e-1")
+	event.SetSource("orders")
+	event.SetType("order.created")
+	event.SetSubject("o-1")
+	event.SetTime(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+	event.SetExtension("tenant", "acme")
+	if err := event.SetData(cloudevents.ApplicationJSON, order{Id: "o-1", Amount: 5}); err != nil {
+		t.Fatal(err)
+	}
+	return &event
+}
+
+func TestEventMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     messaging.ContentMode
+		metadata map[string]string
+		payload  string
+	}{
+		{
+			name:     "structured",
+			mode:     messaging.StructuredMode,
+			metadata: map[string]string{messaging.ContentTypeKey: "application/cloudevents+json"},
+		},
+		{
+			name: "binary",
+			mode: messaging.BinaryMode,
+			metadata: map[string]string{
+				"ce-specversion":         "1.0",
+				"ce-id":                  "e-1",
+				"ce-source":              "orders",
+				"ce-type":                "order.created",
+				"ce-subject":             "o-1",
+				"ce-time":                "2024-05-01T10:00:00Z",
+				"ce-tenant":              "acme",
+				messaging.ContentTypeKey: "application/json",
+			},
+			payload: `{"id":"o-1","amount":5}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := messaging.EventMessage(context.Background(), newOrderEvent(t), tt.mode)
+			if err != nil {
+				t.Fatalf("EventMessage: %v", err)
+			}
+			if msg.UUID != "e-1" {
+				t.Errorf("expected the event id as uuid, got %s", msg.UUID)
+			}
+			for k, v := range tt.metadata {
+				if got := msg.Metadata.Get(k); got != v {
+					t.Errorf("expected metadata %s=%s, got %s", k, v, got)
+				}
+			}
+			if tt.payload != "" && string(msg.Payload) != tt.payload {
+				t.Errorf("expected payload %s, got %s", tt.payload, msg.Payload)
+			}
+
+			// the consumer gets the event back whatever the mode
+			event, err := messaging.ConsumeEvent(msg)
+			if err != nil {
+				t.Fatalf("ConsumeEvent: %v", err)
+			}
+			want := newOrderEvent(t)
+			if event.ID() != want.ID() || event.Source() != want.Source() || event.Type() != want.Type() ||
+				event.Subject() != want.Subject() || !event.Time().Equal(want.Time()) || event.SpecVersion() != want.SpecVersion() {
+				t.Errorf("unexpected event attributes %s", event)
+			}
+			if got := event.Extensions()["tenant"]; got != "acme" {
+				t.Errorf("expected extension tenant=acme, got %v", got)
+			}
+			if event.DataContentType() != cloudevents.ApplicationJSON || string(event.Data()) != `{"id":"o-1","amount":5}` {
+				t.Errorf("unexpected event data %s %s", event.DataContentType(), event.Data())
+			}
+			// and Decode its data
+			got, err := messaging.Decode[order](msg)
+			if err != nil || got.Id != "o-1" || got.Amount != 5 {
+				t.Errorf("unexpected decode result %+v, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestEventMessageInvalid(t *testing.T) {
+	event := cloudevents.NewEvent()
+	if _, err := messaging.EventMessage(context.Background(), &event, messaging.BinaryMode); err == nil {
+		t.Error("expected an error for an event without id, source and type")
+	}
+}
+
+func TestEventHandler(t *testing.T) {
+	var got *cloudevents.Event
+	handler := messaging.EventHandler(func(ctx context.Context, event *cloudevents.Event) error {
+		got = event
+		return nil
+	})
+
+	msg, err := messaging.EventMessage(context.Background(), newOrderEvent(t), messaging.BinaryMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := handler(msg); err != nil {
+		t.Fatalf("handler: %v", err)
+	}
+	if got == nil || got.ID() != "e-1" {
+		t.Fatalf("expected event e-1, got %v", got)
+	}
+
+	got = nil
+	for _, msg := range []*message.Message{
+		message.NewMessage("2", []byte("not an event")),
+		message.NewMessage("3", nil),
+	} {
+		if err := handler(msg); !errors.Is(err, messaging.ErrDecode) {
+			t.Errorf("expected ErrDecode for message %s, got %v", msg.UUID, err)
+		}
+	}
+	if got != nil {
+		t.Error("expected the handler not to be called")
+	}
+}
@@ -0,0 +1,258 @@
+package messaging
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/achuala/go-svc-extn/pkg/crypto"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Message metadata keys describing how the payload was encoded by PayloadCodec.
+const (
+	ContentEncodingKey = "content-encoding"
+	EncryptionKeyIdKey = "encryption-key-id"
+)
+
+// Compression algorithms of PayloadCodec.
+const (
+	Gzip = "gzip"
+	Zstd = "zstd"
+)
+
+// ErrPayloadDecryption is wrapped by the errors of messages which are encrypted
+// but cannot be decrypted, e.g. because the codec has no CryptoUtil, and of
+// plaintext messages received by a codec requiring encryption.
+var ErrPayloadDecryption = errors.New("messaging: payload cannot be decrypted")
+
+// PayloadCodec compresses and encrypts payloads on publish and reverses it on
+// consume. The steps applied are recorded in the ContentEncodingKey metadata,
+// so consumers decode messages of publishers with any configuration.
+type PayloadCodec struct {
+	// CompressAbove is the payload size in bytes from which payloads are
+	// compressed, zero disables compression.
+	CompressAbove int
+	// Compression is Gzip (default) or Zstd.
+	Compression string
+	// Crypto encrypts the payloads with its AEAD keyset when set, the message
+	// UUID and the content encoding are bound as associated data. The id of
+	// the key is carried in the EncryptionKeyIdKey metadata. Messages which
+	// are not encrypted are then rejected with ErrPayloadDecryption, unless
+	// AllowUnencrypted is set.
+	Crypto *crypto.CryptoUtil
+	// AllowUnencrypted accepts plaintext messages when Crypto is set, e.g.
+	// while the publishers are moved to encryption.
+	AllowUnencrypted bool
+	// MaxDecompressedSize is the maximum size in bytes of a decompressed
+	// payload, default 16MB, negative disables the limit. A larger payload
+	// fails to decode with ErrDecode, so that a small compressed message
+	// can't exhaust the memory of the consumer.
+	MaxDecompressedSize int64
+}
+
+// defaultMaxDecompressedSize is the default of PayloadCodec.MaxDecompressedSize.
+const defaultMaxDecompressedSize = 16 << 20
+
+// encryptedEncoding marks an encrypted payload in ContentEncodingKey.
+const encryptedEncoding = "aead"
+
+// payloadAd binds the cipher text to the message and to its content encoding,
+// so that neither the steps recorded nor the UUID can be changed in transit.
+func payloadAd(msg *message.Message, encoding string) []byte {
+	return []byte("messaging:" + msg.UUID + ":" + encoding)
+}
+
+// Encode compresses and encrypts the payload of msg in place.
+func (c PayloadCodec) Encode(ctx context.Context, msg *message.Message) error {
+	if msg.Metadata.Get(ContentEncodingKey) != "" {
+		// Already encoded, e.g. a message being republished.
+		return nil
+	}
+	payload := msg.Payload
+	var encodings []string
+	if c.CompressAbove > 0 && len(payload) >= c.CompressAbove {
+		algorithm := c.Compression
+		if algorithm == "" {
+			algorithm = Gzip
+		}
+		compressed, err := compress(algorithm, payload)
+		if err != nil {
+			return err
+		}
+		payload = compressed
+		encodings = append(encodings, algorithm)
+	}
+	if c.Crypto != nil {
+		encodings = append(encodings, encryptedEncoding)
+		cipherText, err := c.Crypto.EncryptBytes(ctx, payload, payloadAd(msg, strings.Join(encodings, ", ")))
+		if err != nil {
+			return err
+		}
+		payload = cipherText
+		if keyId, ok := tinkKeyId(cipherText); ok {
+			msg.Metadata.Set(EncryptionKeyIdKey, strconv.FormatUint(uint64(keyId), 10))
+		}
+	}
+	if len(encodings) == 0 {
+		return nil
+	}
+	msg.Payload = payload
+	msg.Metadata.Set(ContentEncodingKey, strings.Join(encodings, ", "))
+	return nil
+}
+
+// Decode returns a copy of msg with the payload decrypted and decompressed as
+// recorded in its metadata, msg itself is left as received.
+func (c PayloadCodec) Decode(ctx context.Context, msg *message.Message) (*message.Message, error) {
+	encoding := msg.Metadata.Get(ContentEncodingKey)
+	encodings := strings.Split(encoding, ",")
+	if c.Crypto != nil && !c.AllowUnencrypted && strings.TrimSpace(encodings[len(encodings)-1]) != encryptedEncoding {
+		return nil, fmt.Errorf("%w: message is not encrypted", ErrPayloadDecryption)
+	}
+	if encoding == "" {
+		return msg, nil
+	}
+	payload := msg.Payload
+	for i := len(encodings) - 1; i >= 0; i-- {
+		var err error
+		switch strings.TrimSpace(encodings[i]) {
+		case encryptedEncoding:
+			if c.Crypto == nil {
+				return nil, fmt.Errorf("%w: no crypto configured", ErrPayloadDecryption)
+			}
+			payload, err = c.Crypto.DecryptBytes(ctx, payload, payloadAd(msg, encoding))
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrPayloadDecryption, err)
+			}
+		case Gzip, Zstd:
+			payload, err = decompress(strings.TrimSpace(encodings[i]), payload, c.maxDecompressedSize())
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrDecode, err)
+			}
+		default:
+			return nil, fmt.Errorf("%w: unknown content encoding %q", ErrDecode, encodings[i])
+		}
+	}
+	decoded := msg.Copy()
+	decoded.SetContext(msg.Context())
+	decoded.Payload = payload
+	delete(decoded.Metadata, ContentEncodingKey)
+	delete(decoded.Metadata, EncryptionKeyIdKey)
+	return decoded, nil
+}
+
+// Decoding returns a handler middleware passing the decoded message to the
+// handler. The received message keeps its encoded payload, so that a
+// dead-lettered message stays encrypted.
+func (c PayloadCodec) Decoding() message.HandlerMiddleware {
+	return func(h message.HandlerFunc) message.HandlerFunc {
+		return func(msg *message.Message) ([]*message.Message, error) {
+			decoded, err := c.Decode(msg.Context(), msg)
+			if err != nil {
+				return nil, fmt.Errorf("message %s: %w", msg.UUID, err)
+			}
+			return h(decoded)
+		}
+	}
+}
+
+type encodingPublisher struct {
+	message.Publisher
+	codec PayloadCodec
+}
+
+// EncodingPublisher decorates pub to encode the payloads with codec before
+// publishing.
+func EncodingPublisher(pub message.Publisher, codec PayloadCodec) message.Publisher {
+	return &encodingPublisher{Publisher: pub, codec: codec}
+}
+
+func (p *encodingPublisher) Publish(topic string, messages ...*message.Message) error {
+	for _, msg := range messages {
+		if err := p.codec.Encode(msg.Context(), msg); err != nil {
+			return fmt.Errorf("message %s: %w", msg.UUID, err)
+		}
+	}
+	return p.Publisher.Publish(topic, messages...)
+}
+
+func compress(algorithm string, payload []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch algorithm {
+	case Gzip:
+		w = gzip.NewWriter(&buf)
+	case Zstd:
+		zw, err := zstd.NewWriter(&buf)
+		if err != nil {
+			return nil, err
+		}
+		w = zw
+	default:
+		return nil, fmt.Errorf("messaging: unknown compression %q", algorithm)
+	}
+	if _, err := w.Write(payload); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c PayloadCodec) maxDecompressedSize() int64 {
+	if c.MaxDecompressedSize == 0 {
+		return defaultMaxDecompressedSize
+	}
+	return c.MaxDecompressedSize
+}
+
+// decompress decompresses payload, failing when it decompresses to more
+// than limit bytes, unless limit is negative.
+func decompress(algorithm string, payload []byte, limit int64) ([]byte, error) {
+	var r io.Reader
+	switch algorithm {
+	case Gzip:
+		gr, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		r = gr
+	default:
+		zr, err := zstd.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	if limit < 0 {
+		return io.ReadAll(r)
+	}
+	decompressed, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(decompressed)) > limit {
+		return nil, fmt.Errorf("decompressed payload exceeds %d bytes", limit)
+	}
+	return decompressed, nil
+}
+
+// tinkKeyId returns the key id of the Tink output prefix of a CryptoUtil cipher
+// text, a version byte followed by the big endian key id.
+func tinkKeyId(cipherText []byte) (uint32, bool) {
+	if len(cipherText) < 5 || cipherText[0] != 0x01 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(cipherText[1:5]), true
+}
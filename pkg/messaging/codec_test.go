@@ -0,0 +1,160 @@
+package messaging_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/achuala/go-svc-extn/pkg/crypto"
+	"github.com/achuala/go-svc-extn/pkg/crypto/encdec"
+	"github.com/achuala/go-svc-extn/pkg/messaging"
+)
+
+func TestPayloadCodecCompression(t *testing.T) {
+	payload := bytes.Repeat([]byte(`{"id":"o-1","amount":5}`), 100)
+	for _, algorithm := range []string{messaging.Gzip, messaging.Zstd} {
+		t.Run(algorithm, func(t *testing.T) {
+			codec := messaging.PayloadCodec{CompressAbove: 1024, Compression: algorithm}
+			msg := message.NewMessage("1", payload)
+			if err := codec.Encode(context.Background(), msg); err != nil {
+				t.Fatalf("failed to encode: %v", err)
+			}
+			if got := msg.Metadata.Get(messaging.ContentEncodingKey); got != algorithm {
+				t.Fatalf("expected content encoding %s, got %q", algorithm, got)
+			}
+			if len(msg.Payload) >= len(payload) {
+				t.Errorf("expected a compressed payload, got %d bytes", len(msg.Payload))
+			}
+			decoded, err := codec.Decode(context.Background(), msg)
+			if err != nil {
+				t.Fatalf("failed to decode: %v", err)
+			}
+			if !bytes.Equal(decoded.Payload, payload) {
+				t.Error("decoded payload differs from the original")
+			}
+			if decoded.Metadata.Get(messaging.ContentEncodingKey) != "" {
+				t.Error("expected the content encoding to be removed")
+			}
+		})
+	}
+}
+
+func TestPayloadCodecBelowThreshold(t *testing.T) {
+	codec := messaging.PayloadCodec{CompressAbove: 1024}
+	msg := message.NewMessage("1", []byte("small"))
+	if err := codec.Encode(context.Background(), msg); err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	if string(msg.Payload) != "small" || msg.Metadata.Get(messaging.ContentEncodingKey) != "" {
+		t.Errorf("expected the payload to be left as is, got %q", msg.Payload)
+	}
+}
+
+func TestPayloadCodecDecompressionLimit(t *testing.T) {
+	payload := bytes.Repeat([]byte{0}, 64<<10)
+	tests := []struct {
+		name  string
+		limit int64
+		err   error
+	}{
+		{name: "default"},
+		{name: "at the limit", limit: 64 << 10},
+		{name: "above the limit", limit: 1024, err: messaging.ErrDecode},
+		{name: "unlimited", limit: -1},
+	}
+	for _, algorithm := range []string{messaging.Gzip, messaging.Zstd} {
+		for _, tt := range tests {
+			t.Run(algorithm+" "+tt.name, func(t *testing.T) {
+				msg := message.NewMessage("1", payload)
+				if err := (messaging.PayloadCodec{CompressAbove: 1, Compression: algorithm}).Encode(context.Background(), msg); err != nil {
+					t.Fatalf("failed to encode: %v", err)
+				}
+				decoded, err := messaging.PayloadCodec{MaxDecompressedSize: tt.limit}.Decode(context.Background(), msg)
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("expected %v, got %v", tt.err, err)
+				}
+				if err == nil && !bytes.Equal(decoded.Payload, payload) {
+					t.Error("decoded payload differs from the original")
+				}
+			})
+		}
+	}
+}
+
+func TestPayloadCodecEncryption(t *testing.T) {
+	kekUri, err := encdec.NewKeyURI()
+	if err != nil {
+		t.Fatalf("failed to create the kek: %v", err)
+	}
+	keysetData, err := encdec.NewKeyset(kekUri, nil)
+	if err != nil {
+		t.Fatalf("failed to create the keyset: %v", err)
+	}
+	cu, err := crypto.NewCryptoUtil(&crypto.CryptoConfig{KmsUri: kekUri, KeysetData: keysetData})
+	if err != nil {
+		t.Fatalf("failed to create the crypto util: %v", err)
+	}
+	codec := messaging.PayloadCodec{Crypto: cu}
+	payload := []byte(`{"id":"o-1","amount":5}`)
+	msg := message.NewMessage("1", payload)
+	if err := codec.Encode(context.Background(), msg); err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	// the raw AEAD output: the Tink prefix, a 12 byte nonce, the cipher text
+	// and a 16 byte tag
+	if len(msg.Payload) != 5+12+len(payload)+16 || msg.Payload[0] != 0x01 {
+		t.Errorf("expected the raw cipher text, got %d bytes", len(msg.Payload))
+	}
+	if msg.Metadata.Get(messaging.EncryptionKeyIdKey) == "" {
+		t.Error("expected the encryption key id")
+	}
+	decoded, err := codec.Decode(context.Background(), msg)
+	if err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	if !bytes.Equal(decoded.Payload, payload) {
+		t.Error("decoded payload differs from the original")
+	}
+
+	// the message UUID is bound to the cipher text
+	moved := message.NewMessage("2", msg.Payload)
+	moved.Metadata = msg.Metadata
+	if _, err := codec.Decode(context.Background(), moved); !errors.Is(err, messaging.ErrPayloadDecryption) {
+		t.Errorf("expected ErrPayloadDecryption, got %v", err)
+	}
+
+	// and so is the content encoding
+	compressed := messaging.PayloadCodec{Crypto: cu, CompressAbove: 1}
+	msg = message.NewMessage("3", payload)
+	if err := compressed.Encode(context.Background(), msg); err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	msg.Metadata.Set(messaging.ContentEncodingKey, "aead")
+	if _, err := codec.Decode(context.Background(), msg); !errors.Is(err, messaging.ErrPayloadDecryption) {
+		t.Errorf("expected ErrPayloadDecryption for a changed encoding, got %v", err)
+	}
+
+	// plaintext messages are rejected unless allowed
+	for _, plain := range []*message.Message{
+		message.NewMessage("4", payload),
+		compressedMessage(t, "5", payload),
+	} {
+		if _, err := codec.Decode(context.Background(), plain); !errors.Is(err, messaging.ErrPayloadDecryption) {
+			t.Errorf("expected ErrPayloadDecryption for a plaintext message, got %v", err)
+		}
+		codec := messaging.PayloadCodec{Crypto: cu, AllowUnencrypted: true}
+		if decoded, err := codec.Decode(context.Background(), plain); err != nil || !bytes.Equal(decoded.Payload, payload) {
+			t.Errorf("expected the plaintext message to be accepted, got %v", err)
+		}
+	}
+}
+
+func compressedMessage(t *testing.T, uuid string, payload []byte) *message.Message {
+	msg := message.NewMessage(uuid, payload)
+	if err := (messaging.PayloadCodec{CompressAbove: 1}).Encode(context.Background(), msg); err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	return msg
+}
@@ -0,0 +1,166 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/achuala/go-svc-extn/pkg/cache"
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+// Errors returned by DedupStore.Begin.
+var (
+	// ErrDuplicateMessage is returned for a message which was processed already.
+	ErrDuplicateMessage = errors.New("messaging: duplicate message")
+	// ErrMessageInProgress is returned for a message being processed by another
+	// delivery, e.g. a redelivery after the ack wait.
+	ErrMessageInProgress = errors.New("messaging: message in progress")
+)
+
+// DedupStore records the ids of the messages processed by Deduplicate.
+type DedupStore interface {
+	// Begin claims id for processing for ttl, returning the token of the
+	// claim. It fails with ErrDuplicateMessage or ErrMessageInProgress when id
+	// was processed or claimed already.
+	Begin(ctx context.Context, id string, ttl time.Duration) (string, error)
+	// Commit records id as processed for ttl.
+	Commit(ctx context.Context, id string, ttl time.Duration) error
+	// Abort releases the claim of id with token, so that a redelivery is
+	// processed. A claim which expired and was taken over is left alone.
+	Abort(ctx context.Context, id string, token string) error
+}
+
+type dedupOptions struct {
+	ttl           time.Duration
+	processingTTL time.Duration
+	key           func(msg *message.Message) string
+	logger        log.Logger
+}
+
+// DedupOption configures Deduplicate.
+type DedupOption func(*dedupOptions)
+
+// WithDedupTTL sets how long processed ids are remembered, 24 hours by default.
+// Keep it above the longest redelivery delay and replay window.
+func WithDedupTTL(ttl time.Duration) DedupOption {
+	return func(o *dedupOptions) {
+		o.ttl = ttl
+	}
+}
+
+// WithDedupProcessingTTL sets how long a claim lasts while the handler runs, 5
+// minutes by default. A message claimed by a consumer which crashed is processed
+// again once it expired.
+func WithDedupProcessingTTL(ttl time.Duration) DedupOption {
+	return func(o *dedupOptions) {
+		o.processingTTL = ttl
+	}
+}
+
+// WithDedupKey sets the id of a message, its UUID by default, which watermill
+// keeps across redeliveries.
+func WithDedupKey(fn func(msg *message.Message) string) DedupOption {
+	return func(o *dedupOptions) {
+		o.key = fn
+	}
+}
+
+// WithDedupLogger sets the logger of the failures to record a processed id,
+// the global logger by default.
+func WithDedupLogger(logger log.Logger) DedupOption {
+	return func(o *dedupOptions) {
+		o.logger = logger
+	}
+}
+
+// Deduplicate wraps handler to process every message id once across
+// redeliveries and consumer restarts, as recorded by store. A duplicate is acked
+// without calling handler, a message in progress elsewhere is nacked so that it
+// is redelivered later. When handler fails the claim is released.
+func Deduplicate(handler func(msg *message.Message) error, store DedupStore, opts ...DedupOption) func(msg *message.Message) error {
+	o := dedupOptions{
+		ttl:           24 * time.Hour,
+		processingTTL: 5 * time.Minute,
+		key: func(msg *message.Message) string {
+			return msg.UUID
+		},
+		logger: log.GetLogger(),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	log := log.NewHelper(o.logger)
+	return func(msg *message.Message) error {
+		ctx := msg.Context()
+		id := o.key(msg)
+		token, err := store.Begin(ctx, id, o.processingTTL)
+		if err != nil {
+			if errors.Is(err, ErrDuplicateMessage) {
+				return nil
+			}
+			return err
+		}
+		if err := handler(msg); err != nil {
+			// The handler error matters, a failed release expires with the claim.
+			_ = store.Abort(ctx, id, token)
+			return err
+		}
+		// The message was processed, a failed commit only shortens the time
+		// duplicates are detected to the claim's.
+		if err := store.Commit(ctx, id, o.ttl); err != nil {
+			log.WithContext(ctx).Errorf("recording message %s as processed failed: %v", id, err)
+		}
+		return nil
+	}
+}
+
+// DedupCache is a cache which can claim keys, e.g. the valkey cache for
+// deduplication across consumer instances.
+type DedupCache interface {
+	cache.Cache
+	cache.Locker
+}
+
+type cacheDedupStore struct {
+	cache DedupCache
+}
+
+// dedupDone is the value of the processed ids, the claims hold
+// "processing:"+token.
+const dedupDone = "done"
+
+// NewCacheDedupStore returns a DedupStore keeping the ids in c under "dedup:"+id.
+func NewCacheDedupStore(c DedupCache) DedupStore {
+	return &cacheDedupStore{cache: c}
+}
+
+func dedupKey(id string) string {
+	return "dedup:" + id
+}
+
+func (s *cacheDedupStore) Begin(ctx context.Context, id string, ttl time.Duration) (string, error) {
+	token := watermill.NewUUID()
+	claimed, err := s.cache.SetNX(ctx, dedupKey(id), "processing:"+token, ttl)
+	if err != nil {
+		return "", err
+	}
+	if claimed {
+		return token, nil
+	}
+	if state, _ := s.cache.Get(ctx, dedupKey(id)); state == dedupDone {
+		return "", ErrDuplicateMessage
+	}
+	return "", ErrMessageInProgress
+}
+
+func (s *cacheDedupStore) Commit(ctx context.Context, id string, ttl time.Duration) error {
+	return s.cache.SetWithTTL(ctx, dedupKey(id), dedupDone, ttl)
+}
+
+func (s *cacheDedupStore) Abort(ctx context.Context, id string, token string) error {
+	_, err := s.cache.Unlock(ctx, dedupKey(id), "processing:"+token)
+	return err
+}
@@ -0,0 +1,83 @@
+package messaging
+
+import (
+	"context"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ProcessedMessage is a message id recorded by the DB backed DedupStore.
+type ProcessedMessage struct {
+	Id        string    `gorm:"primaryKey;size:255"`
+	Done      bool      `gorm:"not null"`
+	Token     string    `gorm:"size:36;not null"`
+	ExpiresAt time.Time `gorm:"index;not null"`
+}
+
+func (ProcessedMessage) TableName() string {
+	return "processed_messages"
+}
+
+// DbDedupStore is a DedupStore keeping the ids in the processed_messages table,
+// e.g. for services without a shared cache. The ids are recorded in their own
+// statements, after the handler returned and outside of its transaction, so a
+// handler whose writes were committed before a crash runs again once its claim
+// expired. Expired rows are reused, remove them with PurgeExpired.
+type DbDedupStore struct {
+	db *gorm.DB
+}
+
+// NewDbDedupStore .
+func NewDbDedupStore(db *gorm.DB) *DbDedupStore {
+	return &DbDedupStore{db: db}
+}
+
+func (s *DbDedupStore) Begin(ctx context.Context, id string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	token := watermill.NewUUID()
+	db := s.db.WithContext(ctx)
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&ProcessedMessage{Id: id, Token: token, ExpiresAt: now.Add(ttl)})
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if result.RowsAffected == 1 {
+		return token, nil
+	}
+	// Take over an expired claim or record.
+	result = db.Model(&ProcessedMessage{}).
+		Where("id = ? AND expires_at < ?", id, now).
+		Updates(map[string]any{"done": false, "token": token, "expires_at": now.Add(ttl)})
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if result.RowsAffected == 1 {
+		return token, nil
+	}
+	var processed ProcessedMessage
+	if err := db.Take(&processed, "id = ?", id).Error; err != nil {
+		return "", err
+	}
+	if processed.Done {
+		return "", ErrDuplicateMessage
+	}
+	return "", ErrMessageInProgress
+}
+
+func (s *DbDedupStore) Commit(ctx context.Context, id string, ttl time.Duration) error {
+	return s.db.WithContext(ctx).Model(&ProcessedMessage{}).Where("id = ?", id).
+		Updates(map[string]any{"done": true, "expires_at": time.Now().Add(ttl)}).Error
+}
+
+func (s *DbDedupStore) Abort(ctx context.Context, id string, token string) error {
+	return s.db.WithContext(ctx).Delete(&ProcessedMessage{}, "id = ? AND token = ? AND NOT done", id, token).Error
+}
+
+// PurgeExpired deletes the expired ids, returning their number.
+func (s *DbDedupStore) PurgeExpired(ctx context.Context) (int64, error) {
+	result := s.db.WithContext(ctx).Delete(&ProcessedMessage{}, "expires_at < ?", time.Now())
+	return result.RowsAffected, result.Error
+}
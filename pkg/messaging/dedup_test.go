@@ -0,0 +1,151 @@
+package messaging_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/achuala/go-svc-extn/pkg/cache"
+	"github.com/achuala/go-svc-extn/pkg/messaging"
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+// memoryDedupStore is a DedupStore on a map, ignoring the TTLs and the
+// tokens, failing the commits with commitErr.
+type memoryDedupStore struct {
+	mu        sync.Mutex
+	state     map[string]bool
+	commitErr error
+}
+
+func (s *memoryDedupStore) Begin(_ context.Context, id string, _ time.Duration) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	done, ok := s.state[id]
+	switch {
+	case !ok:
+		s.state[id] = false
+		return "", nil
+	case done:
+		return "", messaging.ErrDuplicateMessage
+	default:
+		return "", messaging.ErrMessageInProgress
+	}
+}
+
+func (s *memoryDedupStore) Commit(_ context.Context, id string, _ time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.commitErr != nil {
+		return s.commitErr
+	}
+	s.state[id] = true
+	return nil
+}
+
+func (s *memoryDedupStore) Abort(_ context.Context, id string, _ string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.state, id)
+	return nil
+}
+
+func TestDeduplicate(t *testing.T) {
+	store := &memoryDedupStore{state: map[string]bool{}}
+	calls := 0
+	fail := true
+	handler := messaging.Deduplicate(func(msg *message.Message) error {
+		calls++
+		if fail {
+			return errors.New("transient")
+		}
+		return nil
+	}, store)
+
+	msg := message.NewMessage("msg-1", []byte("payload"))
+	if err := handler(msg); err == nil {
+		t.Fatal("expected the handler error")
+	}
+	fail = false
+	if err := handler(msg); err != nil {
+		t.Fatalf("expected the redelivery to be processed, got %v", err)
+	}
+	if err := handler(msg); err != nil {
+		t.Fatalf("expected the duplicate to be acked, got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 handler calls, got %d", calls)
+	}
+
+	if _, err := store.Begin(context.Background(), "msg-2", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	err := handler(message.NewMessage("msg-2", nil))
+	if !errors.Is(err, messaging.ErrMessageInProgress) {
+		t.Errorf("expected ErrMessageInProgress, got %v", err)
+	}
+}
+
+type dedupLog struct {
+	levels []log.Level
+}
+
+func (l *dedupLog) Log(level log.Level, keyvals ...interface{}) error {
+	l.levels = append(l.levels, level)
+	return nil
+}
+
+func TestDeduplicateCommitFailure(t *testing.T) {
+	store := &memoryDedupStore{state: map[string]bool{}, commitErr: errors.New("unavailable")}
+	logger := &dedupLog{}
+	handler := messaging.Deduplicate(func(msg *message.Message) error {
+		return nil
+	}, store, messaging.WithDedupLogger(logger))
+
+	if err := handler(message.NewMessage("msg-1", nil)); err != nil {
+		t.Fatalf("expected the processed message to be acked, got %v", err)
+	}
+	if len(logger.levels) != 1 || logger.levels[0] != log.LevelError {
+		t.Errorf("expected the failed commit to be logged as an error, got %v", logger.levels)
+	}
+}
+
+func TestCacheDedupStoreAbort(t *testing.T) {
+	ctx := context.Background()
+	c, err, cleanup := cache.NewLocalCacheRistretto(&cache.CacheConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	store := messaging.NewCacheDedupStore(c)
+
+	expired, err := store.Begin(ctx, "msg-1", 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	// a redelivery takes over the expired claim
+	token, err := store.Begin(ctx, "msg-1", time.Minute)
+	if err != nil {
+		t.Fatalf("expected the expired claim to be taken over, got %v", err)
+	}
+	if token == expired {
+		t.Fatal("expected a new token for the new claim")
+	}
+	if err := store.Abort(ctx, "msg-1", expired); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Begin(ctx, "msg-1", time.Minute); !errors.Is(err, messaging.ErrMessageInProgress) {
+		t.Fatalf("expected the claim of the redelivery to be kept, got %v", err)
+	}
+
+	if err := store.Abort(ctx, "msg-1", token); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Begin(ctx, "msg-1", time.Minute); err != nil {
+		t.Errorf("expected the released claim to be claimed again, got %v", err)
+	}
+}
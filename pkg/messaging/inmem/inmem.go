@@ -0,0 +1,175 @@
+// Package inmem provides an in-process broker backed by a watermill GoChannel,
+// so the publish/consume path can run in unit tests and local development
+// without a broker server. Importing the package registers it as "inmem".
+//
+// Publishers and subscribers created with the same BrokerConfig.Address share one
+// GoChannel. Topics are matched exactly, wildcard subjects are not supported.
+package inmem
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
+	"github.com/achuala/go-svc-extn/pkg/messaging"
+	"github.com/achuala/go-svc-extn/pkg/util/idgen"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+func init() {
+	messaging.RegisterBroker(messaging.InMem, newPublisher, newSubscriber)
+}
+
+type channel struct {
+	pubSub *gochannel.GoChannel
+	refs   int
+}
+
+var (
+	channelsMu sync.Mutex
+	channels   = map[string]*channel{}
+)
+
+// acquire returns the GoChannel for address, creating it on first use. Messages
+// are persisted so that subscribers started after a publish still receive them.
+func acquire(address string, logger log.Logger) *gochannel.GoChannel {
+	channelsMu.Lock()
+	defer channelsMu.Unlock()
+	ch, ok := channels[address]
+	if !ok {
+		ch = &channel{pubSub: gochannel.NewGoChannel(gochannel.Config{
+			OutputChannelBuffer: 64,
+			Persistent:          true,
+		}, messaging.NewWatermillLoggerAdapter(logger))}
+		channels[address] = ch
+	}
+	ch.refs++
+	return ch.pubSub
+}
+
+// release closes the GoChannel for address once its last user is gone.
+func release(address string) {
+	channelsMu.Lock()
+	defer channelsMu.Unlock()
+	ch, ok := channels[address]
+	if !ok {
+		return
+	}
+	ch.refs--
+	if ch.refs == 0 {
+		delete(channels, address)
+		ch.pubSub.Close()
+	}
+}
+
+type InMemPublisher struct {
+	publisher message.Publisher
+}
+
+func NewInMemPublisher(cfg *messaging.BrokerConfig, logger log.Logger) (*InMemPublisher, func(), error) {
+	publisher := &InMemPublisher{publisher: messaging.TracingPublisher(acquire(cfg.Address, logger))}
+	return publisher, func() {
+		release(cfg.Address)
+	}, nil
+}
+
+func (p *InMemPublisher) PublishEvent(topic string, event *cloudevents.Event) error {
+	msg, err := messaging.EventMessage(context.Background(), event, messaging.StructuredMode)
+	if err != nil {
+		return err
+	}
+	return p.publisher.Publish(topic, msg)
+}
+
+func (p *InMemPublisher) PublishMessage(topic string, msg *message.Message) error {
+	return p.publisher.Publish(topic, msg)
+}
+
+func (p *InMemPublisher) Publish(topic string, data []byte) error {
+	msg := message.NewMessage(idgen.NewId(), data)
+	return p.publisher.Publish(topic, msg)
+}
+
+type InMemSubscriber struct {
+	router  *message.Router
+	log     *log.Helper
+	address string
+	once    sync.Once
+}
+
+func NewInMemSubscriber(cfg *messaging.BrokerConfig, subCfg *messaging.NatsJsConsumerConfig, logger log.Logger) (*InMemSubscriber, func(), error) {
+	log := log.NewHelper(logger)
+	wmLogger := messaging.NewWatermillLoggerAdapter(logger)
+	router, err := message.NewRouter(message.RouterConfig{CloseTimeout: time.Hour}, wmLogger)
+	if err != nil {
+		return nil, nil, err
+	}
+	pubSub := acquire(cfg.Address, logger)
+	router.AddMiddleware(messaging.Tracing())
+	if subCfg.PayloadCodec != nil {
+		router.AddMiddleware(subCfg.PayloadCodec.Decoding())
+	}
+	if subCfg.Retry != nil {
+		router.AddMiddleware(subCfg.Retry.Middleware(logger))
+	}
+	router.AddMiddleware(subCfg.Middlewares...)
+	router.AddMiddleware(middleware.Recoverer)
+	router.AddNoPublisherHandler(subCfg.HandlerName, subCfg.Subject, pubSub, subCfg.HandlerFunc)
+	subscriber := &InMemSubscriber{router: router, log: log, address: cfg.Address}
+	return subscriber, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		subscriber.Shutdown(ctx)
+	}, nil
+}
+
+func (s *InMemSubscriber) Run(ctx context.Context) error {
+	s.log.Info("starting router and subscriber")
+	return s.router.Run(ctx)
+}
+
+// Shutdown stops receiving new messages and waits for the handlers in flight
+// until ctx is done, returning ctx.Err() when they were still running.
+func (s *InMemSubscriber) Shutdown(ctx context.Context) error {
+	s.log.Info("closing subscriber")
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		s.router.Close()
+	}()
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	s.once.Do(func() {
+		release(s.address)
+	})
+	return err
+}
+
+// Running is closed once the subscriber is ready to receive messages.
+func (s *InMemSubscriber) Running() chan struct{} {
+	return s.router.Running()
+}
+
+func newPublisher(cfg *messaging.BrokerConfig, logger log.Logger) (messaging.Publisher, func(), error) {
+	publisher, cleanup, err := NewInMemPublisher(cfg, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	return publisher, cleanup, nil
+}
+
+func newSubscriber(cfg *messaging.BrokerConfig, subCfg *messaging.NatsJsConsumerConfig, logger log.Logger) (messaging.Subscriber, func(), error) {
+	subscriber, cleanup, err := NewInMemSubscriber(cfg, subCfg, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	return subscriber, cleanup, nil
+}
@@ -0,0 +1,256 @@
+package inmem_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/achuala/go-svc-extn/pkg/extn/middleware"
+	"github.com/achuala/go-svc-extn/pkg/messaging"
+	_ "github.com/achuala/go-svc-extn/pkg/messaging/inmem"
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+func TestInMemPublishConsume(t *testing.T) {
+	logger := log.NewStdLogger(os.Stdout)
+	cfg := messaging.BrokerConfig{Broker: messaging.InMem, Address: t.Name()}
+
+	publisher, closePublisher, err := messaging.NewPublisher(&cfg, logger)
+	if err != nil {
+		t.Fatalf("failed to create publisher: %v", err)
+	}
+	defer closePublisher()
+	if err := publisher.Publish("test.events", []byte("hello")); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+
+	received := make(chan string, 1)
+	subscriber, closeSubscriber, err := messaging.NewSubscriber(&cfg, &messaging.NatsJsConsumerConfig{
+		Subject:     "test.events",
+		HandlerName: "test-handler",
+		HandlerFunc: func(msg *message.Message) error {
+			received <- string(msg.Payload)
+			return nil
+		},
+	}, logger)
+	if err != nil {
+		t.Fatalf("failed to create subscriber: %v", err)
+	}
+	defer closeSubscriber()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go subscriber.Run(ctx)
+
+	select {
+	case payload := <-received:
+		if payload != "hello" {
+			t.Errorf("expected payload hello, got %s", payload)
+		}
+	case <-ctx.Done():
+		t.Fatal("message was not consumed")
+	}
+}
+
+func TestInMemRetry(t *testing.T) {
+	logger := log.NewStdLogger(os.Stdout)
+	cfg := messaging.BrokerConfig{Broker: messaging.InMem, Address: t.Name()}
+
+	attempts := 0
+	done := make(chan struct{})
+	subscriber, closeSubscriber, err := messaging.NewSubscriber(&cfg, &messaging.NatsJsConsumerConfig{
+		Subject:     "test.retry",
+		HandlerName: "retry-handler",
+		Retry:       &messaging.RetryConfig{MaxRetries: 3, InitialInterval: time.Millisecond},
+		HandlerFunc: func(msg *message.Message) error {
+			attempts++
+			if attempts < 3 {
+				return errors.New("transient")
+			}
+			close(done)
+			return nil
+		},
+	}, logger)
+	if err != nil {
+		t.Fatalf("failed to create subscriber: %v", err)
+	}
+	defer closeSubscriber()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go subscriber.Run(ctx)
+
+	publisher, closePublisher, err := messaging.NewPublisher(&cfg, logger)
+	if err != nil {
+		t.Fatalf("failed to create publisher: %v", err)
+	}
+	defer closePublisher()
+	if err := publisher.Publish("test.retry", []byte("retry")); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+
+	select {
+	case <-done:
+		if attempts != 3 {
+			t.Errorf("expected 3 attempts, got %d", attempts)
+		}
+	case <-ctx.Done():
+		t.Fatalf("message was not handled after %d attempts", attempts)
+	}
+}
+
+func TestInMemCorrelationId(t *testing.T) {
+	logger := log.NewStdLogger(os.Stdout)
+	cfg := messaging.BrokerConfig{Broker: messaging.InMem, Address: t.Name()}
+
+	received := make(chan string, 1)
+	subscriber, closeSubscriber, err := messaging.NewSubscriber(&cfg, &messaging.NatsJsConsumerConfig{
+		Subject:     "test.correlation",
+		HandlerName: "correlation-handler",
+		HandlerFunc: func(msg *message.Message) error {
+			correlationId, _ := middleware.CorrelationIdFromContext(msg.Context())
+			received <- correlationId
+			return nil
+		},
+	}, logger)
+	if err != nil {
+		t.Fatalf("failed to create subscriber: %v", err)
+	}
+	defer closeSubscriber()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go subscriber.Run(ctx)
+
+	publisher, closePublisher, err := messaging.NewPublisher(&cfg, logger)
+	if err != nil {
+		t.Fatalf("failed to create publisher: %v", err)
+	}
+	defer closePublisher()
+	msg := message.NewMessage("msg-1", []byte("payload"))
+	msg.SetContext(middleware.NewCorrelationIdContext(ctx, "corr-1"))
+	if err := publisher.PublishMessage("test.correlation", msg); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+
+	select {
+	case correlationId := <-received:
+		if correlationId != "corr-1" {
+			t.Errorf("expected correlation id corr-1, got %q", correlationId)
+		}
+	case <-ctx.Done():
+		t.Fatal("message was not consumed")
+	}
+}
+
+func TestInMemMiddlewares(t *testing.T) {
+	logger := log.NewStdLogger(os.Stdout)
+	cfg := messaging.BrokerConfig{Broker: messaging.InMem, Address: t.Name()}
+
+	received := make(chan string, 1)
+	tenant := func(h message.HandlerFunc) message.HandlerFunc {
+		return func(msg *message.Message) ([]*message.Message, error) {
+			msg.Metadata.Set("tenant", "t-1")
+			return h(msg)
+		}
+	}
+	subscriber, closeSubscriber, err := messaging.NewSubscriber(&cfg, &messaging.NatsJsConsumerConfig{
+		Subject:     "test.middlewares",
+		HandlerName: "middlewares-handler",
+		Middlewares: []message.HandlerMiddleware{tenant},
+		HandlerFunc: func(msg *message.Message) error {
+			received <- msg.Metadata.Get("tenant")
+			return nil
+		},
+	}, logger)
+	if err != nil {
+		t.Fatalf("failed to create subscriber: %v", err)
+	}
+	defer closeSubscriber()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go subscriber.Run(ctx)
+
+	publisher, closePublisher, err := messaging.NewPublisher(&cfg, logger)
+	if err != nil {
+		t.Fatalf("failed to create publisher: %v", err)
+	}
+	defer closePublisher()
+	if err := publisher.Publish("test.middlewares", []byte("payload")); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+
+	select {
+	case got := <-received:
+		if got != "t-1" {
+			t.Errorf("expected the middleware to set tenant t-1, got %q", got)
+		}
+	case <-ctx.Done():
+		t.Fatal("message was not consumed")
+	}
+}
+
+func TestInMemShutdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		release  bool
+		expected error
+	}{
+		{name: "handler completes", release: true},
+		{name: "handler still running", expected: context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := log.NewStdLogger(os.Stdout)
+			cfg := messaging.BrokerConfig{Broker: messaging.InMem, Address: t.Name()}
+
+			publisher, closePublisher, err := messaging.NewPublisher(&cfg, logger)
+			if err != nil {
+				t.Fatalf("failed to create publisher: %v", err)
+			}
+			defer closePublisher()
+			if err := publisher.Publish("test.events", []byte("hello")); err != nil {
+				t.Fatalf("failed to publish: %v", err)
+			}
+
+			started, release := make(chan struct{}), make(chan struct{})
+			completed := false
+			subscriber, _, err := messaging.NewSubscriber(&cfg, &messaging.NatsJsConsumerConfig{
+				Subject:     "test.events",
+				HandlerName: "slow-handler",
+				HandlerFunc: func(msg *message.Message) error {
+					close(started)
+					<-release
+					completed = true
+					return nil
+				},
+			}, logger)
+			if err != nil {
+				t.Fatalf("failed to create subscriber: %v", err)
+			}
+			defer close(release)
+			go subscriber.Run(context.Background())
+			select {
+			case <-started:
+			case <-time.After(5 * time.Second):
+				t.Fatal("message was not consumed")
+			}
+
+			if tt.release {
+				time.AfterFunc(50*time.Millisecond, func() { release <- struct{}{} })
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+			if err := subscriber.Shutdown(ctx); !errors.Is(err, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, err)
+			}
+			if tt.release && !completed {
+				t.Error("expected Shutdown to wait for the handler")
+			}
+		})
+	}
+}
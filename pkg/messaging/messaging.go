@@ -4,12 +4,36 @@ import (
 	"time"
 
 	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/achuala/go-svc-extn/pkg/util/jsonschema"
+	"go.opentelemetry.io/otel/metric"
 )
 
 type BrokerConfig struct {
 	Broker  string
 	Address string
 	Timeout time.Duration
+	// Username and Password authenticate with user and password.
+	Username string
+	Password string
+	// Token authenticates with a token.
+	Token string
+	// NkeySeed authenticates with an nkey, or, along with Jwt, as the user of
+	// a decentralized JWT account.
+	NkeySeed string
+	Jwt      string
+	// CredentialsFile is a .creds file holding the user JWT and nkey seed.
+	CredentialsFile string
+	TLS             *BrokerTLSConfig
+}
+
+// BrokerTLSConfig configures TLS to the broker, set CertFile and KeyFile for
+// mutual TLS.
+type BrokerTLSConfig struct {
+	CaFile             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	InsecureSkipVerify bool
 }
 
 type NatsJsConsumerConfig struct {
@@ -19,4 +43,38 @@ type NatsJsConsumerConfig struct {
 	Subject      string
 	HandlerName  string
 	HandlerFunc  func(msg *message.Message) error
+	// Retry retries a failing handler in-process before the message is nacked.
+	Retry *RetryConfig
+	// MaxDeliveries is the number of times a message is handled before it is
+	// treated as poison, it overrides Retry.MaxRetries when dead-lettering is
+	// enabled. Zero disables dead-lettering.
+	MaxDeliveries int
+	// DeadLetterSubject receives poison messages, with the failure recorded in
+	// the message metadata, after which the original message is acked.
+	DeadLetterSubject string
+	// FetchBatch switches the consumer to pull mode, fetching up to FetchBatch
+	// messages per request and handling them on a pool of Workers goroutines,
+	// each message acked on its own.
+	FetchBatch int
+	// MaxWaiting is the maximum of outstanding pull requests, applied when a
+	// pull consumer is created because it does not exist yet.
+	MaxWaiting int
+	// Workers is the number of messages handled concurrently in pull mode, one
+	// by default.
+	Workers int
+	// Meter enables the handler metrics of Metrics and the consumer gauges.
+	Meter metric.Meter
+	// SchemaValidator and Schemas reject the messages whose payload does not
+	// match the schema of their subject, see SchemaValidation. A rejected
+	// message is dead-lettered at once when DeadLetterSubject is set.
+	SchemaValidator *jsonschema.JsonSchemaValidator
+	Schemas         SubjectSchemas
+	// PayloadCodec decodes the payloads encoded by a publisher with a
+	// PayloadCodec, it needs the CryptoUtil of the publisher for encrypted ones.
+	PayloadCodec *PayloadCodec
+	// Middlewares wrap the handlers after the built-in ones (tracing, metrics,
+	// dead-lettering, payload decoding, schema validation and retries), the
+	// first one being the outermost. The recoverer stays the innermost, so that
+	// they see a panic of the handler as an error.
+	Middlewares []message.HandlerMiddleware
 }
@@ -0,0 +1,64 @@
+package messaging
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// DeliveryAttemptKey is the message metadata key carrying the delivery attempt
+// of the message, set by the backends which know it.
+const DeliveryAttemptKey = "delivery-attempt"
+
+// Metrics returns a handler middleware recording, labeled by handler and topic:
+//
+//   - messaging.messages, the number of handled messages
+//   - messaging.nacks, the number of messages whose handler failed
+//   - messaging.redeliveries, the number of messages delivered more than once
+//   - messaging.duration, the latency of the handler in seconds
+func Metrics(meter metric.Meter) (message.HandlerMiddleware, error) {
+	messages, err := meter.Int64Counter("messaging.messages",
+		metric.WithDescription("Number of handled messages by handler and topic"))
+	if err != nil {
+		return nil, err
+	}
+	nacks, err := meter.Int64Counter("messaging.nacks",
+		metric.WithDescription("Number of messages whose handler failed by handler and topic"))
+	if err != nil {
+		return nil, err
+	}
+	redeliveries, err := meter.Int64Counter("messaging.redeliveries",
+		metric.WithDescription("Number of messages delivered more than once by handler and topic"))
+	if err != nil {
+		return nil, err
+	}
+	duration, err := meter.Float64Histogram("messaging.duration", metric.WithUnit("s"),
+		metric.WithDescription("Latency of the handler by handler and topic"),
+		metric.WithExplicitBucketBoundaries(0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10))
+	if err != nil {
+		return nil, err
+	}
+	return func(h message.HandlerFunc) message.HandlerFunc {
+		return func(msg *message.Message) ([]*message.Message, error) {
+			ctx := msg.Context()
+			attrs := metric.WithAttributes(
+				attribute.String("handler", message.HandlerNameFromCtx(ctx)),
+				attribute.String("topic", message.SubscribeTopicFromCtx(ctx)),
+			)
+			if attempt, _ := strconv.Atoi(msg.Metadata.Get(DeliveryAttemptKey)); attempt > 1 {
+				redeliveries.Add(ctx, 1, attrs)
+			}
+			startTime := time.Now()
+			msgs, err := h(msg)
+			duration.Record(ctx, time.Since(startTime).Seconds(), attrs)
+			messages.Add(ctx, 1, attrs)
+			if err != nil {
+				nacks.Add(ctx, 1, attrs)
+			}
+			return msgs, err
+		}
+	}, nil
+}
@@ -0,0 +1,26 @@
+package nats
+
+import (
+	"github.com/achuala/go-svc-extn/pkg/messaging"
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+func init() {
+	messaging.RegisterBroker(messaging.Nats, newPublisher, newSubscriber)
+}
+
+func newPublisher(cfg *messaging.BrokerConfig, logger log.Logger) (messaging.Publisher, func(), error) {
+	publisher, cleanup, err := NewNatsJsPublisher(cfg, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	return publisher, cleanup, nil
+}
+
+func newSubscriber(cfg *messaging.BrokerConfig, subCfg *messaging.NatsJsConsumerConfig, logger log.Logger) (messaging.Subscriber, func(), error) {
+	consumer, cleanup, err := NewNatsJsConsumer(cfg, subCfg, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	return consumer, cleanup, nil
+}
@@ -3,6 +3,7 @@ package nats
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/ThreeDotsLabs/watermill"
@@ -10,15 +11,35 @@ import (
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
 	"github.com/achuala/go-svc-extn/pkg/messaging"
+	"github.com/achuala/go-svc-extn/pkg/util/idgen"
 	"github.com/go-kratos/kratos/v2/log"
 	nc "github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	// shutdownTimeout bounds the cleanup func of NewNatsJsConsumer.
+	shutdownTimeout = 5 * time.Second
+	// routerCloseTimeout leaves bounding the shutdown to the ctx of Shutdown.
+	routerCloseTimeout = time.Hour
 )
 
 type NatsJsConsumer struct {
 	subscriber *watermill_nats.Subscriber
 	router     *message.Router
 	log        *log.Helper
+	closeDlq   func()
+	routesMu   sync.RWMutex
+	routes     []route
+	subject    string
+	pull       *pullConsumer
+	conn       *nc.Conn
+	js         jetstream.JetStream
+	stream     string
+	consumer   string
+	gauges     metric.Registration
 }
 
 func consumerConfigurator(consumerName, streamName, subject string) watermill_nats.ResourceInitializer {
@@ -39,16 +60,98 @@ func consumerConfigurator(consumerName, streamName, subject string) watermill_na
 func NewNatsJsConsumer(cfg *messaging.BrokerConfig, subCfg *messaging.NatsJsConsumerConfig, logger log.Logger) (*NatsJsConsumer, func(), error) {
 	log := log.NewHelper(logger)
 	wmLogger := messaging.NewWatermillLoggerAdapter(logger)
-	options := []nc.Option{
-		nc.RetryOnFailedConnect(true),
-		nc.Timeout(30 * time.Second),
-		nc.ReconnectWait(1 * time.Second),
+	options, err := connectOptions(cfg)
+	if err != nil {
+		return nil, nil, err
 	}
 	conn, err := nc.Connect(cfg.Address, options...)
 	if err != nil {
 		return nil, nil, err
 	}
 	log.Infof("consumer connected to nats - %v, status - %v", conn.ConnectedUrl(), conn.Status())
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	jsConsumer := &NatsJsConsumer{
+		log:      log,
+		conn:     conn,
+		js:       js,
+		stream:   subCfg.StreamName,
+		consumer: subCfg.ConsumerName,
+		subject:  subCfg.Subject,
+	}
+	if subCfg.HandlerFunc != nil {
+		jsConsumer.AddHandler(subCfg.HandlerName, subCfg.Subject, subCfg.HandlerFunc)
+	}
+	middlewares := []message.HandlerMiddleware{messaging.Tracing()}
+	if subCfg.Meter != nil {
+		metrics, err := messaging.Metrics(subCfg.Meter)
+		if err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+		middlewares = append(middlewares, metrics)
+		if jsConsumer.gauges, err = jsConsumer.registerGauges(subCfg.Meter); err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+	}
+	retry := subCfg.Retry
+	if subCfg.MaxDeliveries > 0 && subCfg.DeadLetterSubject != "" {
+		dlq, closeDlq, err := NewNatsJsPublisher(cfg, logger)
+		if err != nil {
+			jsConsumer.close()
+			return nil, nil, err
+		}
+		poisonQueue, err := middleware.PoisonQueue(dlq.publisher, subCfg.DeadLetterSubject)
+		if err != nil {
+			closeDlq()
+			jsConsumer.close()
+			return nil, nil, err
+		}
+		jsConsumer.closeDlq = closeDlq
+		// The poison queue wraps the retries, so a message reaches the DLQ only
+		// after MaxDeliveries failed attempts and is then acked.
+		middlewares = append(middlewares, poisonQueue)
+		deliveries := messaging.RetryConfig{}
+		if retry != nil {
+			deliveries = *retry
+		}
+		deliveries.MaxRetries = subCfg.MaxDeliveries - 1
+		retry = &deliveries
+	}
+	if subCfg.PayloadCodec != nil {
+		// Inside of the poison queue, so that dead-lettered messages stay encoded.
+		middlewares = append(middlewares, subCfg.PayloadCodec.Decoding())
+	}
+	if subCfg.SchemaValidator != nil {
+		// Outside of the retries, a payload does not get valid by retrying.
+		middlewares = append(middlewares, messaging.SchemaValidation(subCfg.SchemaValidator, subCfg.Schemas))
+	}
+	if retry != nil {
+		middlewares = append(middlewares, retry.Middleware(logger))
+	}
+	middlewares = append(middlewares, subCfg.Middlewares...)
+	middlewares = append(middlewares, middleware.Recoverer)
+	cleanup := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := jsConsumer.Shutdown(ctx); err != nil {
+			log.Warnf("consumer closed before in-flight messages completed: %v", err)
+		}
+	}
+
+	if subCfg.FetchBatch > 0 {
+		jsConsumer.pull, err = newPullConsumer(js, subCfg, jsConsumer.dispatch, middlewares, log)
+		if err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+		return jsConsumer, cleanup, nil
+	}
+
 	// Consumer configuration just uses the durable name, the expectation is that the stream is already created and consumer is already created
 	// with necessary configuration.
 	consumerConfig := func(topic string, group string) jetstream.ConsumerConfig {
@@ -63,30 +166,185 @@ func NewNatsJsConsumer(cfg *messaging.BrokerConfig, subCfg *messaging.NatsJsCons
 		Logger:              wmLogger,
 		ConfigureConsumer:   consumerConfig,
 		ResourceInitializer: consumerConfigurator(subCfg.ConsumerName, subCfg.StreamName, subCfg.Subject),
+		Unmarshaler:         &subjectUnmarshaler{},
 	}
-	subscriber, err := watermill_nats.NewSubscriber(subscriberConfig)
+	jsConsumer.subscriber, err = watermill_nats.NewSubscriber(subscriberConfig)
 	if err != nil {
+		cleanup()
 		return nil, nil, err
 	}
-	router, err := message.NewRouter(message.RouterConfig{CloseTimeout: 5 * time.Second}, wmLogger)
+	jsConsumer.router, err = message.NewRouter(message.RouterConfig{CloseTimeout: routerCloseTimeout}, wmLogger)
 	if err != nil {
+		cleanup()
 		return nil, nil, err
 	}
-	router.AddMiddleware(middleware.Recoverer)
-	router.AddNoPublisherHandler(subCfg.HandlerName, subCfg.Subject, subscriber, subCfg.HandlerFunc)
-	jsConsumer := &NatsJsConsumer{router: router, subscriber: subscriber, log: log}
-	return jsConsumer, func() {
-		log.Info("closing consumer")
-		if jsConsumer.subscriber != nil {
-			jsConsumer.subscriber.Close()
+	jsConsumer.router.AddMiddleware(middlewares...)
+	name := subCfg.HandlerName
+	if name == "" {
+		name = subCfg.Subject
+	}
+	jsConsumer.router.AddNoPublisherHandler(name, subCfg.Subject, jsConsumer.subscriber, jsConsumer.dispatch)
+	return jsConsumer, cleanup, nil
+}
+
+// close releases what the constructor acquired before the cleanup func exists.
+func (c *NatsJsConsumer) close() {
+	if c.gauges != nil {
+		c.gauges.Unregister()
+	}
+	c.conn.Close()
+}
+
+// Shutdown stops receiving new messages, waits for the handlers in flight until
+// ctx is done and then closes the consumer and its connection. The error is
+// ctx.Err() when handlers were still running, their messages are redelivered.
+// The cleanup func returned by NewNatsJsConsumer calls it with a 5s timeout.
+func (c *NatsJsConsumer) Shutdown(ctx context.Context) error {
+	c.log.Info("closing consumer")
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		if c.pull != nil {
+			c.pull.drain()
+			return
+		}
+		if c.router != nil {
+			// Closes the subscriptions first, then waits for the handlers.
+			c.router.Close()
 		}
-		if jsConsumer.router != nil {
-			jsConsumer.router.Close()
+		if c.subscriber != nil {
+			c.subscriber.Close()
 		}
-	}, nil
+	}()
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if c.closeDlq != nil {
+		c.closeDlq()
+	}
+	c.close()
+	return err
+}
+
+// Healthy reports whether the connection is up and the JetStream consumer can be
+// reached, for readiness probes.
+func (c *NatsJsConsumer) Healthy(ctx context.Context) error {
+	if status := c.conn.Status(); status != nc.CONNECTED {
+		return fmt.Errorf("nats connection is %v", status)
+	}
+	_, err := c.info(ctx)
+	return err
+}
+
+func (c *NatsJsConsumer) info(ctx context.Context) (*jetstream.ConsumerInfo, error) {
+	consumer, err := c.js.Consumer(ctx, c.stream, c.consumer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get consumer %s: %w", c.consumer, err)
+	}
+	return consumer.Info(ctx)
+}
+
+// registerGauges registers the messaging.consumer.* gauges read from the
+// consumer info, labeled by stream and consumer.
+func (c *NatsJsConsumer) registerGauges(meter metric.Meter) (metric.Registration, error) {
+	pending, err := meter.Int64ObservableGauge("messaging.consumer.pending",
+		metric.WithDescription("Number of messages not yet delivered by stream and consumer"))
+	if err != nil {
+		return nil, err
+	}
+	ackPending, err := meter.Int64ObservableGauge("messaging.consumer.ack_pending",
+		metric.WithDescription("Number of messages delivered but not yet acked by stream and consumer"))
+	if err != nil {
+		return nil, err
+	}
+	redelivered, err := meter.Int64ObservableGauge("messaging.consumer.redelivered",
+		metric.WithDescription("Number of messages being redelivered by stream and consumer"))
+	if err != nil {
+		return nil, err
+	}
+	attrs := metric.WithAttributes(
+		attribute.String("stream", c.stream),
+		attribute.String("consumer", c.consumer),
+	)
+	return meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		info, err := c.info(ctx)
+		if err != nil {
+			// Reported by Healthy, the gauges are just not observed.
+			return nil
+		}
+		o.ObserveInt64(pending, int64(info.NumPending), attrs)
+		o.ObserveInt64(ackPending, int64(info.NumAckPending), attrs)
+		o.ObserveInt64(redelivered, int64(info.NumRedelivered), attrs)
+		return nil
+	}, pending, ackPending, redelivered)
 }
 
 func (c *NatsJsConsumer) Run(ctx context.Context) error {
+	if c.pull != nil {
+		c.log.Info("starting pull consumer")
+		return c.pull.run(ctx)
+	}
 	log.Info("starting router and consumer")
 	return c.router.Run(ctx)
 }
+
+// AddTypedHandler registers fn for the messages whose subject matches pattern,
+// with the payload decoded into T by messaging.Decode, see AddHandler. The
+// handler is named after the pattern.
+func AddTypedHandler[T any](c *NatsJsConsumer, pattern string, fn messaging.TypedHandlerFunc[T], middlewares ...message.HandlerMiddleware) {
+	c.AddHandler(pattern, pattern, messaging.TypedHandler(fn), middlewares...)
+}
+
+// ReplayDLQ consumes the dead-letter messages described by dlqCfg and publishes
+// each one back to the subject it was poisoned on, until ctx is done, see
+// replayMessage. dlqCfg.HandlerFunc is ignored.
+func ReplayDLQ(ctx context.Context, cfg *messaging.BrokerConfig, dlqCfg *messaging.NatsJsConsumerConfig, logger log.Logger) error {
+	publisher, closePublisher, err := NewNatsJsPublisher(cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer closePublisher()
+	helper := log.NewHelper(logger)
+	replayCfg := *dlqCfg
+	replayCfg.MaxDeliveries = 0
+	replayCfg.HandlerFunc = func(msg *message.Message) error {
+		topic, replay := replayMessage(msg)
+		if replay == nil {
+			// Nothing to replay it to, ack it rather than redelivering forever.
+			helper.Warnf("dropping dead-letter message %s without %s metadata", msg.UUID, middleware.PoisonedTopicKey)
+			return nil
+		}
+		return publisher.PublishMessage(topic, replay)
+	}
+	consumer, closeConsumer, err := NewNatsJsConsumer(cfg, &replayCfg, logger)
+	if err != nil {
+		return err
+	}
+	defer closeConsumer()
+	return consumer.Run(ctx)
+}
+
+// replayMessage returns the subject the dead-letter msg was poisoned on and
+// the message to publish back to it, nil without the subject. The poison
+// metadata is removed. The message gets a new UUID and no Nats-Msg-Id, as
+// JetStream would drop it as a duplicate of the original message within the
+// duplicate window of the stream.
+func replayMessage(msg *message.Message) (string, *message.Message) {
+	topic := msg.Metadata.Get(middleware.PoisonedTopicKey)
+	if topic == "" {
+		return "", nil
+	}
+	replay := message.NewMessage(idgen.NewId(), msg.Payload)
+	for k, v := range msg.Metadata {
+		switch k {
+		case middleware.PoisonedTopicKey, middleware.PoisonedHandlerKey,
+			middleware.PoisonedSubscriberKey, middleware.ReasonForPoisonedKey, nc.MsgIdHdr:
+		default:
+			replay.Metadata.Set(k, v)
+		}
+	}
+	return topic, replay
+}
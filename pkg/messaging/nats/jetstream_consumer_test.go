@@ -2,14 +2,17 @@ package nats_test
 
 import (
 	"context"
+	"errors"
 	"os"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/achuala/go-svc-extn/pkg/messaging"
 	"github.com/achuala/go-svc-extn/pkg/messaging/nats"
-	cloudevents "github.com/cloudevents/sdk-go"
+	"github.com/achuala/go-svc-extn/pkg/util/idgen"
 	"github.com/go-kratos/kratos/v2/log"
 )
 
@@ -22,12 +25,11 @@ func TestNatsJsConsumer(t *testing.T) {
 	}
 	handlerFunc := func(msg *message.Message) error {
 		t.Logf("received message: %v", string(msg.Payload))
-		event := cloudevents.NewEvent()
-		err := event.UnmarshalJSON(msg.Payload)
+		event, err := messaging.ConsumeEvent(msg)
 		if err != nil {
 			t.Fatalf("failed to unmarshal event: %v", err)
 		}
-		t.Logf("received event: %v", event.Data)
+		t.Logf("received event: %s", event.Data())
 
 		return nil
 	}
@@ -51,3 +53,143 @@ func TestNatsJsConsumer(t *testing.T) {
 		t.Fatalf("failed to run consumer: %v", err)
 	}
 }
+
+func publishOrders(t *testing.T, cfg *messaging.BrokerConfig, n int) {
+	publisher, closeFn, err := nats.NewNatsJsPublisher(cfg, log.DefaultLogger)
+	if err != nil {
+		t.Fatalf("failed to create publisher: %v", err)
+	}
+	defer closeFn()
+	msgs := make([]*message.Message, 0, n)
+	for i := 0; i < n; i++ {
+		msgs = append(msgs, message.NewMessage(idgen.NewId(), []byte(strconv.Itoa(i))))
+	}
+	if err := publisher.PublishBatch("orders.created", msgs); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+}
+
+func TestNatsJsPullConsumer(t *testing.T) {
+	tests := []struct {
+		name    string
+		workers int
+	}{
+		{name: "one worker", workers: 1},
+		{name: "worker pool", workers: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := runJetStream(t)
+			publishOrders(t, cfg, 20)
+
+			var mu sync.Mutex
+			handled := map[string]bool{}
+			inFlight, maxInFlight := 0, 0
+			done := make(chan struct{})
+			consumer, closeFn, err := nats.NewNatsJsConsumer(cfg, &messaging.NatsJsConsumerConfig{
+				ConsumerName: "billing",
+				StreamName:   "ORDERS",
+				Subject:      "orders.>",
+				FetchBatch:   5,
+				Workers:      tt.workers,
+				HandlerFunc: func(msg *message.Message) error {
+					mu.Lock()
+					inFlight++
+					maxInFlight = max(maxInFlight, inFlight)
+					mu.Unlock()
+					time.Sleep(5 * time.Millisecond)
+					mu.Lock()
+					defer mu.Unlock()
+					inFlight--
+					if msg.Metadata.Get(messaging.SubjectKey) != "orders.created" {
+						t.Errorf("unexpected subject %s", msg.Metadata.Get(messaging.SubjectKey))
+					}
+					handled[string(msg.Payload)] = true
+					if len(handled) == 20 {
+						close(done)
+					}
+					return nil
+				},
+			}, log.DefaultLogger)
+			if err != nil {
+				t.Fatalf("failed to create consumer: %v", err)
+			}
+			defer closeFn()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := consumer.Healthy(ctx); err != nil {
+				t.Errorf("expected a healthy consumer, got %v", err)
+			}
+			go consumer.Run(ctx)
+			select {
+			case <-done:
+			case <-ctx.Done():
+				t.Fatalf("handled %d of 20 messages", len(handled))
+			}
+			if maxInFlight > tt.workers {
+				t.Errorf("expected at most %d messages in flight, got %d", tt.workers, maxInFlight)
+			}
+			if err := consumer.Shutdown(ctx); err != nil {
+				t.Errorf("failed to shut down: %v", err)
+			}
+			if err := consumer.Healthy(ctx); err == nil {
+				t.Error("expected an unhealthy consumer once shut down")
+			}
+		})
+	}
+}
+
+func TestNatsJsConsumerShutdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		release  bool
+		expected error
+	}{
+		{name: "handler completes", release: true},
+		{name: "handler still running", expected: context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := runJetStream(t)
+			publishOrders(t, cfg, 1)
+
+			started, release := make(chan struct{}), make(chan struct{})
+			completed := false
+			consumer, _, err := nats.NewNatsJsConsumer(cfg, &messaging.NatsJsConsumerConfig{
+				ConsumerName: "billing",
+				StreamName:   "ORDERS",
+				Subject:      "orders.>",
+				FetchBatch:   1,
+				HandlerFunc: func(msg *message.Message) error {
+					close(started)
+					<-release
+					completed = true
+					return nil
+				},
+			}, log.DefaultLogger)
+			if err != nil {
+				t.Fatalf("failed to create consumer: %v", err)
+			}
+			defer close(release)
+			go consumer.Run(context.Background())
+			select {
+			case <-started:
+			case <-time.After(5 * time.Second):
+				t.Fatal("message was not consumed")
+			}
+
+			if tt.release {
+				time.AfterFunc(50*time.Millisecond, func() { release <- struct{}{} })
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+			if err := consumer.Shutdown(ctx); !errors.Is(err, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, err)
+			}
+			if tt.release && !completed {
+				t.Error("expected Shutdown to wait for the handler")
+			}
+		})
+	}
+}
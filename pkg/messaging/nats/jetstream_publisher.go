@@ -1,64 +1,329 @@
 package nats
 
 import (
+	"context"
+	"fmt"
 	"time"
 
 	watermill_nats "github.com/ThreeDotsLabs/watermill-nats/v2/pkg/nats"
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/achuala/go-svc-extn/pkg/messaging"
 	"github.com/achuala/go-svc-extn/pkg/util/idgen"
-	cloudevents "github.com/cloudevents/sdk-go"
+	"github.com/achuala/go-svc-extn/pkg/util/jsonschema"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
 	nc "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
 
 	"github.com/go-kratos/kratos/v2/log"
 )
 
+// maxPendingAcks is the default of WithMaxPendingAcks.
+const maxPendingAcks = 256
+
 type NatsJsPublisher struct {
-	publisher message.Publisher
+	publisher  message.Publisher
+	js         jetstream.JetStream
+	marshaler  watermill_nats.Marshaler
+	timeout    time.Duration
+	msgId      func(msg *message.Message) string
+	maxPending int
+	validator  *jsonschema.JsonSchemaValidator
+	schemas    messaging.SubjectSchemas
+	codec      *messaging.PayloadCodec
+	eventMode  messaging.ContentMode
+}
+
+// PublisherOption configures a NatsJsPublisher.
+type PublisherOption func(*NatsJsPublisher)
+
+// WithMsgID sets the function deriving the Nats-Msg-Id header of a message,
+// the message UUID by default. JetStream drops a message whose id it has seen
+// within the duplicate window of the stream (Duplicates in the stream config,
+// two minutes by default), so a publish retried after a timeout is stored once
+// as long as the retry reuses the id. An empty id disables deduplication for the
+// message.
+func WithMsgID(fn func(msg *message.Message) string) PublisherOption {
+	return func(p *NatsJsPublisher) {
+		p.msgId = fn
+	}
+}
+
+// BatchPublishError is returned by PublishBatch when some messages were not
+// acknowledged, Errors is aligned with the published messages and nil for the
+// ones which were.
+type BatchPublishError struct {
+	Errors []error
+}
+
+func (e *BatchPublishError) Error() string {
+	failed := e.Unwrap()
+	return fmt.Sprintf("%d of %d messages failed to publish, first error: %v", len(failed), len(e.Errors), failed[0])
+}
+
+func (e *BatchPublishError) Unwrap() []error {
+	failed := make([]error, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	return failed
+}
+
+// WithSchemaValidation validates the payloads against the schema registered for
+// their subject before publishing, see messaging.ValidatePayload. A message which
+// does not match is not published and the error wraps messaging.ErrSchemaViolation.
+func WithSchemaValidation(v *jsonschema.JsonSchemaValidator, schemas messaging.SubjectSchemas) PublisherOption {
+	return func(p *NatsJsPublisher) {
+		p.validator = v
+		p.schemas = schemas
+	}
 }
 
-func NewNatsJsPublisher(cfg *messaging.BrokerConfig, logger log.Logger) (*NatsJsPublisher, func(), error) {
+// WithMaxPendingAcks bounds the async publishes of PublishAsync and PublishBatch
+// awaiting their ack, 256 by default. Further publishes block until acks arrive,
+// up to the broker timeout, and then fail with jetstream.ErrTooManyStalledMsgs.
+func WithMaxPendingAcks(n int) PublisherOption {
+	return func(p *NatsJsPublisher) {
+		p.maxPending = n
+	}
+}
+
+// WithPayloadCodec compresses and encrypts the payloads with codec, after they
+// were validated. Consumers decode them with NatsJsConsumerConfig.PayloadCodec.
+func WithPayloadCodec(codec messaging.PayloadCodec) PublisherOption {
+	return func(p *NatsJsPublisher) {
+		p.codec = &codec
+	}
+}
+
+// WithContentMode sets the CloudEvents content mode of PublishEvent, structured
+// by default. In binary mode the attributes are carried as NATS headers, see
+// messaging.BinaryMode, and consumers get the event back with
+// messaging.ConsumeEvent.
+func WithContentMode(mode messaging.ContentMode) PublisherOption {
+	return func(p *NatsJsPublisher) {
+		p.eventMode = mode
+	}
+}
+
+func NewNatsJsPublisher(cfg *messaging.BrokerConfig, logger log.Logger, opts ...PublisherOption) (*NatsJsPublisher, func(), error) {
 	log := log.NewHelper(logger)
-	options := []nc.Option{
-		nc.RetryOnFailedConnect(true),
-		nc.Timeout(30 * time.Second),
-		nc.ReconnectWait(1 * time.Second),
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	jsPublisher := &NatsJsPublisher{
+		timeout:    timeout,
+		maxPending: maxPendingAcks,
+		msgId: func(msg *message.Message) string {
+			return msg.UUID
+		},
+	}
+	for _, opt := range opts {
+		opt(jsPublisher)
+	}
+	options, err := connectOptions(cfg)
+	if err != nil {
+		return nil, nil, err
 	}
 	wmLogger := messaging.NewWatermillLoggerAdapter(logger)
 	log.Infof("publisher connecting  to nats at - %s", cfg.Address)
-	publisher, err := watermill_nats.NewPublisher(
-		watermill_nats.PublisherConfig{
-			URL:         cfg.Address,
-			NatsOptions: options,
-			Marshaler:   &watermill_nats.NATSMarshaler{},
-		},
-		wmLogger,
-	)
-
+	conn, err := nc.Connect(cfg.Address, options...)
+	if err != nil {
+		return nil, nil, err
+	}
+	jsPublisher.js, err = jetstream.New(conn, jetstream.WithPublishAsyncMaxPending(jsPublisher.maxPending))
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	publisherConfig := watermill_nats.PublisherConfig{
+		URL:         cfg.Address,
+		NatsOptions: options,
+		Marshaler:   &watermill_nats.NATSMarshaler{},
+		// NewPublisherWithNatsConn does not apply the defaults of NewPublisher.
+		SubjectCalculator: watermill_nats.DefaultSubjectCalculator,
+	}
+	publisher, err := watermill_nats.NewPublisherWithNatsConn(conn, publisherConfig.GetPublisherPublishConfig(), wmLogger)
 	if err != nil {
+		conn.Close()
 		return nil, nil, err
 	}
-	jsPublisher := &NatsJsPublisher{publisher: publisher}
+	jsPublisher.marshaler = publisherConfig.Marshaler
+	jsPublisher.publisher = messaging.TracingPublisher(subjectPublisher{publisher})
+	if jsPublisher.codec != nil {
+		jsPublisher.publisher = messaging.TracingPublisher(messaging.EncodingPublisher(subjectPublisher{publisher}, *jsPublisher.codec))
+	}
 	return jsPublisher, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := jsPublisher.Flush(ctx); err != nil {
+			log.Warnf("closing publisher with unacknowledged async publishes: %v", err)
+		}
 		publisher.Close()
 	}, nil
 }
 
 func (n *NatsJsPublisher) PublishEvent(topic string, event *cloudevents.Event) error {
-	dataBytes, err := event.MarshalJSON()
+	msg, err := messaging.EventMessage(context.Background(), event, n.eventMode)
 	if err != nil {
 		return err
 	}
-
-	msg := message.NewMessage(event.ID(), dataBytes)
-	return n.publisher.Publish(topic, msg)
+	return n.PublishMessage(topic, msg)
 }
 
 func (n *NatsJsPublisher) PublishMessage(topic string, msg *message.Message) error {
+	if err := n.validate(topic, msg); err != nil {
+		return err
+	}
+	n.setMsgId(msg)
 	return n.publisher.Publish(topic, msg)
 }
 
 func (n *NatsJsPublisher) Publish(topic string, data []byte) error {
 	msg := message.NewMessage(idgen.NewId(), data)
-	return n.publisher.Publish(topic, msg)
+	return n.PublishMessage(topic, msg)
+}
+
+func (n *NatsJsPublisher) validate(topic string, msg *message.Message) error {
+	if n.validator == nil {
+		return nil
+	}
+	return messaging.ValidatePayload(n.validator, n.schemas, topic, msg)
+}
+
+// subjectPublisher records the subject of every published message, including
+// dead-lettered ones, in the messaging.SubjectKey metadata, so that consumers on
+// a wildcard subject can route them, see NatsJsConsumer.AddHandler.
+type subjectPublisher struct {
+	message.Publisher
+}
+
+func (p subjectPublisher) Publish(topic string, messages ...*message.Message) error {
+	for _, msg := range messages {
+		msg.Metadata.Set(messaging.SubjectKey, topic)
+	}
+	return p.Publisher.Publish(topic, messages...)
+}
+
+// setMsgId sets the JetStream deduplication header, keeping one set by the caller.
+func (n *NatsJsPublisher) setMsgId(msg *message.Message) {
+	if msg.Metadata.Get(nc.MsgIdHdr) != "" {
+		return
+	}
+	if id := n.msgId(msg); id != "" {
+		msg.Metadata.Set(nc.MsgIdHdr, id)
+	}
+}
+
+// PublishBatch publishes msgs with JetStream async publish, keeping at most the
+// maximum of pending acks in flight, and waits up to the broker timeout for all
+// acks. The trace context and correlation id of each msg.Context() are
+// propagated. A *BatchPublishError reports the messages which were not
+// acknowledged.
+func (n *NatsJsPublisher) PublishBatch(topic string, msgs []*message.Message) error {
+	errs := make([]error, len(msgs))
+	futures := make([]jetstream.PubAckFuture, len(msgs))
+	for i, msg := range msgs {
+		natsMsg, err := n.prepare(topic, msg)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		// Blocks while maxPending publishes await their ack.
+		futures[i], errs[i] = n.js.PublishMsgAsync(natsMsg, jetstream.WithStallWait(n.timeout))
+	}
+	deadline := time.NewTimer(n.timeout)
+	defer deadline.Stop()
+	expired := false
+	for i, future := range futures {
+		if future == nil {
+			continue
+		}
+		if !expired {
+			select {
+			case <-future.Ok():
+				continue
+			case err := <-future.Err():
+				errs[i] = err
+				continue
+			case <-deadline.C:
+				expired = true
+			}
+		}
+		// Past the deadline only the acks which already arrived count.
+		select {
+		case <-future.Ok():
+		case err := <-future.Err():
+			errs[i] = err
+		default:
+			errs[i] = fmt.Errorf("message %s: %w", msgs[i].UUID, nc.ErrTimeout)
+		}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return &BatchPublishError{Errors: errs}
+		}
+	}
+	return nil
+}
+
+// prepare validates, encodes and marshals msg for an async publish, as
+// PublishMessage does for a sync one.
+func (n *NatsJsPublisher) prepare(topic string, msg *message.Message) (*nc.Msg, error) {
+	if err := n.validate(topic, msg); err != nil {
+		return nil, err
+	}
+	if n.codec != nil {
+		if err := n.codec.Encode(msg.Context(), msg); err != nil {
+			return nil, err
+		}
+	}
+	messaging.InjectMetadata(msg.Context(), msg)
+	n.setMsgId(msg)
+	msg.Metadata.Set(messaging.SubjectKey, topic)
+	return n.marshaler.Marshal(topic, msg)
+}
+
+// PublishAsync publishes msg without waiting for its ack, onAck is called with
+// nil once JetStream acknowledged it, else with the error, from another
+// goroutine. Without an ack within the broker timeout onAck is called with an
+// error wrapping nats.ErrTimeout, the message may still be stored. It blocks
+// while the maximum of pending acks is reached, up to the broker timeout, see
+// WithMaxPendingAcks. Errors preparing the message are returned, onAck is not
+// called then.
+func (n *NatsJsPublisher) PublishAsync(topic string, msg *message.Message, onAck func(err error)) error {
+	natsMsg, err := n.prepare(topic, msg)
+	if err != nil {
+		return err
+	}
+	future, err := n.js.PublishMsgAsync(natsMsg, jetstream.WithStallWait(n.timeout))
+	if err != nil {
+		return err
+	}
+	go func() {
+		deadline := time.NewTimer(n.timeout)
+		defer deadline.Stop()
+		select {
+		case <-future.Ok():
+			onAck(nil)
+		case err := <-future.Err():
+			onAck(err)
+		case <-deadline.C:
+			onAck(fmt.Errorf("message %s: %w", msg.UUID, nc.ErrTimeout))
+		}
+	}()
+	return nil
+}
+
+// Flush waits until all the async publishes were acknowledged or failed, or ctx
+// is done.
+func (n *NatsJsPublisher) Flush(ctx context.Context) error {
+	select {
+	case <-n.js.PublishAsyncComplete():
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%d publishes pending: %w", n.js.PublishAsyncPending(), ctx.Err())
+	}
 }
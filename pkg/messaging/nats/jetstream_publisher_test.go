@@ -1,14 +1,21 @@
 package nats_test
 
 import (
+	"context"
+	"errors"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/achuala/go-svc-extn/pkg/messaging"
 	"github.com/achuala/go-svc-extn/pkg/messaging/nats"
-	cloudevents "github.com/cloudevents/sdk-go"
+	"github.com/achuala/go-svc-extn/pkg/util/idgen"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
 	"github.com/go-kratos/kratos/v2/log"
+	"github.com/nats-io/nats-server/v2/server"
+	nc "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
 )
 
 func TestNatsJsPublisher(t *testing.T) {
@@ -28,11 +35,209 @@ func TestNatsJsPublisher(t *testing.T) {
 	event.SetID("test-id")
 	event.SetSource("test-source")
 	event.SetType("test-type")
-	event.SetData("test-data")
-	event.SetDataContentType(cloudevents.ApplicationJSON)
+	event.SetData(cloudevents.ApplicationJSON, "test-data")
 	event.SetSpecVersion(cloudevents.VersionV1)
 	err = publisher.PublishEvent("test.unit", &event)
 	if err != nil {
 		t.Fatalf("failed to publish event: %v", err)
 	}
 }
+
+func TestNatsJsPublisherBatch(t *testing.T) {
+	cfg := messaging.BrokerConfig{
+		Broker:  "nats",
+		Address: "nats://localhost:4222",
+		Timeout: time.Second * 10,
+	}
+
+	publisher, closeFn, err := nats.NewNatsJsPublisher(&cfg, log.NewStdLogger(os.Stdout))
+	if err != nil {
+		t.Fatalf("failed to create publisher: %v", err)
+	}
+	defer closeFn()
+
+	msgs := make([]*message.Message, 0, 1000)
+	for i := 0; i < cap(msgs); i++ {
+		msgs = append(msgs, message.NewMessage(idgen.NewId(), []byte("test-data")))
+	}
+	if err := publisher.PublishBatch("test.batch", msgs); err != nil {
+		t.Fatalf("failed to publish batch: %v", err)
+	}
+}
+
+// runJetStream starts an embedded JetStream server with an ORDERS stream on
+// orders.> and returns its broker config.
+func runJetStream(t *testing.T) *messaging.BrokerConfig {
+	s, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, JetStream: true, StoreDir: t.TempDir(), NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatalf("failed to create nats server: %v", err)
+	}
+	go s.Start()
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server not ready")
+	}
+	t.Cleanup(s.Shutdown)
+
+	conn, err := nc.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+	js, err := jetstream.New(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := js.CreateStream(context.Background(), jetstream.StreamConfig{Name: "ORDERS", Subjects: []string{"orders.>"}}); err != nil {
+		t.Fatalf("failed to create stream: %v", err)
+	}
+	return &messaging.BrokerConfig{Broker: "nats", Address: s.ClientURL(), Timeout: 5 * time.Second}
+}
+
+func TestNatsJsPublishAsync(t *testing.T) {
+	cfg := runJetStream(t)
+	tests := []struct {
+		name  string
+		topic string
+		acked bool
+	}{
+		{name: "stream subject", topic: "orders.created", acked: true},
+		{name: "subject without stream", topic: "payments.created"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			publisher, closeFn, err := nats.NewNatsJsPublisher(cfg, log.DefaultLogger, nats.WithMaxPendingAcks(2))
+			if err != nil {
+				t.Fatalf("failed to create publisher: %v", err)
+			}
+			defer closeFn()
+
+			acks := make(chan error, 10)
+			for i := 0; i < cap(acks); i++ {
+				if err := publisher.PublishAsync(tt.topic, message.NewMessage(idgen.NewId(), []byte("test-data")), func(err error) {
+					acks <- err
+				}); err != nil {
+					t.Fatalf("failed to publish: %v", err)
+				}
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := publisher.Flush(ctx); err != nil {
+				t.Fatalf("failed to flush: %v", err)
+			}
+			for i := 0; i < cap(acks); i++ {
+				select {
+				case err := <-acks:
+					if acked := err == nil; acked != tt.acked {
+						t.Errorf("expected acked %v, got error %v", tt.acked, err)
+					}
+				case <-ctx.Done():
+					t.Fatalf("got %d of %d acks", i, cap(acks))
+				}
+			}
+		})
+	}
+}
+
+func TestNatsJsPublishAsyncTimeout(t *testing.T) {
+	cfg := runJetStream(t)
+	cfg.Timeout = 200 * time.Millisecond
+	// A subscriber which never replies stands for a stalled stream.
+	conn, err := nc.Connect(cfg.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Subscribe("stalled.>", func(*nc.Msg) {}); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	publisher, closeFn, err := nats.NewNatsJsPublisher(cfg, log.DefaultLogger)
+	if err != nil {
+		t.Fatalf("failed to create publisher: %v", err)
+	}
+	defer closeFn()
+
+	acks := make(chan error, 1)
+	if err := publisher.PublishAsync("stalled.created", message.NewMessage(idgen.NewId(), []byte("test-data")), func(err error) {
+		acks <- err
+	}); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+	select {
+	case err := <-acks:
+		if !errors.Is(err, nc.ErrTimeout) {
+			t.Errorf("expected a timeout, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("onAck was not called")
+	}
+}
+
+func TestNatsJsPublishAsyncDeduplicated(t *testing.T) {
+	cfg := runJetStream(t)
+	publisher, closeFn, err := nats.NewNatsJsPublisher(cfg, log.DefaultLogger)
+	if err != nil {
+		t.Fatalf("failed to create publisher: %v", err)
+	}
+	defer closeFn()
+
+	acks := make(chan error, 2)
+	for i := 0; i < cap(acks); i++ {
+		if err := publisher.PublishAsync("orders.created", message.NewMessage("order-1", []byte("test-data")), func(err error) {
+			acks <- err
+		}); err != nil {
+			t.Fatalf("failed to publish: %v", err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := publisher.Flush(ctx); err != nil {
+		t.Fatalf("failed to flush: %v", err)
+	}
+	for i := 0; i < cap(acks); i++ {
+		if err := <-acks; err != nil {
+			t.Errorf("expected the duplicate to be acked, got %v", err)
+		}
+	}
+
+	conn, err := nc.Connect(cfg.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	js, _ := jetstream.New(conn)
+	stream, err := js.Stream(ctx, "ORDERS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := stream.Info(ctx); err != nil || info.State.Msgs != 1 {
+		t.Errorf("expected one stored message, got %v, %v", info, err)
+	}
+}
+
+func TestNatsJsPublishBatchErrors(t *testing.T) {
+	cfg := runJetStream(t)
+	publisher, closeFn, err := nats.NewNatsJsPublisher(cfg, log.DefaultLogger)
+	if err != nil {
+		t.Fatalf("failed to create publisher: %v", err)
+	}
+	defer closeFn()
+
+	if err := publisher.PublishBatch("orders.created", []*message.Message{
+		message.NewMessage(idgen.NewId(), []byte("1")),
+		message.NewMessage(idgen.NewId(), []byte("2")),
+	}); err != nil {
+		t.Fatalf("failed to publish batch: %v", err)
+	}
+
+	err = publisher.PublishBatch("payments.created", []*message.Message{message.NewMessage(idgen.NewId(), []byte("1"))})
+	var batchErr *nats.BatchPublishError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("expected a BatchPublishError, got %v", err)
+	}
+	if len(batchErr.Errors) != 1 || batchErr.Errors[0] == nil {
+		t.Errorf("expected the errors aligned with the messages, got %v", batchErr.Errors)
+	}
+}
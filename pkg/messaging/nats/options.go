@@ -0,0 +1,55 @@
+package nats
+
+import (
+	"crypto/tls"
+	"time"
+
+	"github.com/achuala/go-svc-extn/pkg/messaging"
+	nc "github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+)
+
+// connectOptions returns the connection options of the publisher and consumer,
+// with the authentication and TLS settings of cfg.
+func connectOptions(cfg *messaging.BrokerConfig) ([]nc.Option, error) {
+	options := []nc.Option{
+		nc.RetryOnFailedConnect(true),
+		nc.Timeout(30 * time.Second),
+		nc.ReconnectWait(1 * time.Second),
+	}
+	switch {
+	case cfg.CredentialsFile != "":
+		options = append(options, nc.UserCredentials(cfg.CredentialsFile))
+	case cfg.Jwt != "" && cfg.NkeySeed != "":
+		options = append(options, nc.UserJWTAndSeed(cfg.Jwt, cfg.NkeySeed))
+	case cfg.NkeySeed != "":
+		keyPair, err := nkeys.FromSeed([]byte(cfg.NkeySeed))
+		if err != nil {
+			return nil, err
+		}
+		publicKey, err := keyPair.PublicKey()
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, nc.Nkey(publicKey, keyPair.Sign))
+	case cfg.Token != "":
+		options = append(options, nc.Token(cfg.Token))
+	case cfg.Username != "":
+		options = append(options, nc.UserInfo(cfg.Username, cfg.Password))
+	}
+	if t := cfg.TLS; t != nil {
+		// Secure goes first, it replaces the TLS config the others amend.
+		options = append(options, nc.Secure(&tls.Config{
+			ServerName:         t.ServerName,
+			InsecureSkipVerify: t.InsecureSkipVerify,
+			MinVersion:         tls.VersionTLS12,
+		}))
+		if t.CaFile != "" {
+			options = append(options, nc.RootCAs(t.CaFile))
+		}
+		if t.CertFile != "" {
+			options = append(options, nc.ClientCert(t.CertFile, t.KeyFile))
+		}
+	}
+	return options, nil
+}
@@ -0,0 +1,77 @@
+package nats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/achuala/go-svc-extn/pkg/messaging"
+	"github.com/nats-io/nats-server/v2/server"
+	nc "github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+)
+
+// runAuthServer starts an embedded server accepting the users of opts.
+func runAuthServer(t *testing.T, opts *server.Options) string {
+	opts.Host, opts.Port, opts.NoLog, opts.NoSigs = "127.0.0.1", -1, true, true
+	s, err := server.NewServer(opts)
+	if err != nil {
+		t.Fatalf("failed to create nats server: %v", err)
+	}
+	go s.Start()
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server not ready")
+	}
+	t.Cleanup(s.Shutdown)
+	return s.ClientURL()
+}
+
+func TestConnectOptions(t *testing.T) {
+	user, err := nkeys.CreateUser()
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed, _ := user.Seed()
+	publicKey, _ := user.PublicKey()
+	other, _ := nkeys.CreateUser()
+	otherSeed, _ := other.Seed()
+
+	tests := []struct {
+		name      string
+		server    *server.Options
+		cfg       messaging.BrokerConfig
+		connected bool
+	}{
+		{name: "user and password", server: &server.Options{Username: "svc", Password: "secret"}, cfg: messaging.BrokerConfig{Username: "svc", Password: "secret"}, connected: true},
+		{name: "wrong password", server: &server.Options{Username: "svc", Password: "secret"}, cfg: messaging.BrokerConfig{Username: "svc", Password: "wrong"}},
+		{name: "missing credentials", server: &server.Options{Username: "svc", Password: "secret"}},
+		{name: "token", server: &server.Options{Authorization: "s3cr3t"}, cfg: messaging.BrokerConfig{Token: "s3cr3t"}, connected: true},
+		{name: "token over user", server: &server.Options{Authorization: "s3cr3t"}, cfg: messaging.BrokerConfig{Token: "s3cr3t", Username: "svc"}, connected: true},
+		{name: "nkey", server: &server.Options{Nkeys: []*server.NkeyUser{{Nkey: publicKey}}}, cfg: messaging.BrokerConfig{NkeySeed: string(seed)}, connected: true},
+		{name: "unknown nkey", server: &server.Options{Nkeys: []*server.NkeyUser{{Nkey: publicKey}}}, cfg: messaging.BrokerConfig{NkeySeed: string(otherSeed)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := runAuthServer(t, tt.server)
+			options, err := connectOptions(&tt.cfg)
+			if err != nil {
+				t.Fatalf("connectOptions: %v", err)
+			}
+			conn, err := nc.Connect(url, options...)
+			if err != nil {
+				t.Fatalf("connect: %v", err)
+			}
+			defer conn.Close()
+			// The connection retries in the background when the server rejects it.
+			err = conn.FlushTimeout(time.Second)
+			if connected := err == nil; connected != tt.connected {
+				t.Errorf("expected connected %v, got %v", tt.connected, err)
+			}
+		})
+	}
+}
+
+func TestConnectOptionsInvalidSeed(t *testing.T) {
+	if _, err := connectOptions(&messaging.BrokerConfig{NkeySeed: "not a seed"}); err == nil {
+		t.Error("expected an error for an invalid nkey seed")
+	}
+}
@@ -0,0 +1,194 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/achuala/go-svc-extn/pkg/messaging"
+	"github.com/achuala/go-svc-extn/pkg/util/idgen"
+	"github.com/go-kratos/kratos/v2/log"
+	nc "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// watermillUUIDHeader is the header the watermill marshaler stores the message UUID in.
+const watermillUUIDHeader = "_watermill_message_uuid"
+
+// fetchMaxWait bounds a single pull request, so that Run notices ctx being done.
+const fetchMaxWait = 5 * time.Second
+
+// pullConsumer fetches batches from a pull consumer and handles them on a bounded
+// goroutine pool, acking or nacking every message on its own.
+type pullConsumer struct {
+	consumer    jetstream.Consumer
+	batch       int
+	workers     int
+	middlewares []message.HandlerMiddleware
+	handler     message.HandlerFunc
+	log         *log.Helper
+
+	mu       sync.Mutex
+	stopped  bool
+	stop     chan struct{}
+	inFlight sync.WaitGroup
+}
+
+func newPullConsumer(js jetstream.JetStream, subCfg *messaging.NatsJsConsumerConfig, handler func(msg *message.Message) error, middlewares []message.HandlerMiddleware, log *log.Helper) (*pullConsumer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	stream, err := js.Stream(ctx, subCfg.StreamName)
+	if err != nil {
+		return nil, err
+	}
+	consumer, err := stream.Consumer(ctx, subCfg.ConsumerName)
+	if errors.Is(err, jetstream.ErrConsumerNotFound) {
+		consumer, err = stream.CreateConsumer(ctx, jetstream.ConsumerConfig{
+			Durable:       subCfg.ConsumerName,
+			AckPolicy:     jetstream.AckExplicitPolicy,
+			FilterSubject: subCfg.Subject,
+			MaxWaiting:    subCfg.MaxWaiting,
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	workers := subCfg.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	p := &pullConsumer{
+		consumer:    consumer,
+		batch:       subCfg.FetchBatch,
+		workers:     workers,
+		middlewares: middlewares,
+		log:         log,
+		stop:        make(chan struct{}),
+	}
+	p.setHandler(handler)
+	return p, nil
+}
+
+// setHandler wraps fn in the middlewares, the first one being the outermost as
+// with the router in push mode.
+func (p *pullConsumer) setHandler(fn func(msg *message.Message) error) {
+	handler := func(msg *message.Message) ([]*message.Message, error) {
+		return nil, fn(msg)
+	}
+	for i := len(p.middlewares) - 1; i >= 0; i-- {
+		handler = p.middlewares[i](handler)
+	}
+	p.handler = handler
+}
+
+func (p *pullConsumer) run(ctx context.Context) error {
+	defer p.inFlight.Wait()
+	slots := make(chan struct{}, p.workers)
+	for ctx.Err() == nil && !p.isStopped() {
+		batch, err := p.consumer.Fetch(p.batch, jetstream.FetchMaxWait(fetchMaxWait))
+		if err != nil {
+			p.log.Errorf("failed to fetch messages: %v", err)
+			select {
+			case <-ctx.Done():
+			case <-p.stop:
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		for msg := range batch.Messages() {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				// Not handled, redelivered after the ack wait.
+				continue
+			case <-p.stop:
+				p.nak(msg)
+				continue
+			}
+			if !p.dispatch() {
+				<-slots
+				p.nak(msg)
+				continue
+			}
+			go func() {
+				defer func() {
+					<-slots
+					p.inFlight.Done()
+				}()
+				p.handle(ctx, msg)
+			}()
+		}
+		if err := batch.Error(); err != nil && !errors.Is(err, nc.ErrTimeout) {
+			p.log.Errorf("failed to fetch messages: %v", err)
+		}
+	}
+	return nil
+}
+
+// dispatch counts a message in flight unless drain has started.
+func (p *pullConsumer) dispatch() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopped {
+		return false
+	}
+	p.inFlight.Add(1)
+	return true
+}
+
+func (p *pullConsumer) isStopped() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stopped
+}
+
+// drain stops fetching and waits for the messages in flight. Messages fetched
+// but not yet handled are nacked for a prompt redelivery.
+func (p *pullConsumer) drain() {
+	p.mu.Lock()
+	if !p.stopped {
+		p.stopped = true
+		close(p.stop)
+	}
+	p.mu.Unlock()
+	p.inFlight.Wait()
+}
+
+func (p *pullConsumer) nak(jsMsg jetstream.Msg) {
+	if err := jsMsg.Nak(); err != nil {
+		p.log.Errorf("failed to nak message: %v", err)
+	}
+}
+
+func (p *pullConsumer) handle(ctx context.Context, jsMsg jetstream.Msg) {
+	headers := jsMsg.Headers()
+	uuid := headers.Get(watermillUUIDHeader)
+	if uuid == "" {
+		uuid = idgen.NewId()
+	}
+	msg := message.NewMessage(uuid, jsMsg.Data())
+	for k := range headers {
+		if k != watermillUUIDHeader {
+			msg.Metadata.Set(k, headers.Get(k))
+		}
+	}
+	msg.Metadata.Set(messaging.SubjectKey, jsMsg.Subject())
+	if metadata, err := jsMsg.Metadata(); err == nil {
+		msg.Metadata.Set(messaging.DeliveryAttemptKey, strconv.FormatUint(metadata.NumDelivered, 10))
+	}
+	// The handler outlives Run's ctx, shutdown waits for in-flight messages.
+	msg.SetContext(context.WithoutCancel(ctx))
+	if _, err := p.handler(msg); err != nil {
+		p.log.Errorf("failed to handle message %s: %v", msg.UUID, err)
+		if err := jsMsg.Nak(); err != nil {
+			p.log.Errorf("failed to nak message %s: %v", msg.UUID, err)
+		}
+		return
+	}
+	if err := jsMsg.Ack(); err != nil {
+		p.log.Errorf("failed to ack message %s: %v", msg.UUID, err)
+	}
+}
@@ -0,0 +1,37 @@
+package nats
+
+import (
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+	nc "github.com/nats-io/nats.go"
+)
+
+func TestReplayMessage(t *testing.T) {
+	msg := message.NewMessage("order-1", []byte("payload"))
+	msg.Metadata.Set("correlation_id", "c-1")
+	msg.Metadata.Set(nc.MsgIdHdr, "order-1")
+	msg.Metadata.Set(middleware.PoisonedTopicKey, "orders.created")
+	msg.Metadata.Set(middleware.PoisonedHandlerKey, "orders")
+	msg.Metadata.Set(middleware.PoisonedSubscriberKey, "subscriber")
+	msg.Metadata.Set(middleware.ReasonForPoisonedKey, "failed")
+
+	topic, replay := replayMessage(msg)
+	if topic != "orders.created" {
+		t.Fatalf("replayed to %q", topic)
+	}
+	if replay.UUID == "" || replay.UUID == msg.UUID {
+		t.Errorf("replay UUID %q, want a new one", replay.UUID)
+	}
+	if string(replay.Payload) != "payload" {
+		t.Errorf("replay payload %q", replay.Payload)
+	}
+	if len(replay.Metadata) != 1 || replay.Metadata.Get("correlation_id") != "c-1" {
+		t.Errorf("replay metadata %v, want the correlation id only", replay.Metadata)
+	}
+
+	if _, replay := replayMessage(message.NewMessage("order-2", nil)); replay != nil {
+		t.Errorf("replayed a message without poisoned topic")
+	}
+}
@@ -0,0 +1,86 @@
+package nats
+
+import (
+	"errors"
+
+	watermill_nats "github.com/ThreeDotsLabs/watermill-nats/v2/pkg/jetstream"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/achuala/go-svc-extn/pkg/messaging"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// ErrNoHandler fails the messages without subject which no handler matches,
+// so that they are nacked, or dead-lettered, instead of being lost.
+var ErrNoHandler = errors.New("messaging: no handler for the message")
+
+// route is a handler of the consumer for the subjects matching pattern.
+type route struct {
+	name    string
+	pattern string
+	handler message.HandlerFunc
+}
+
+// AddHandler registers fn for the messages whose subject matches pattern, e.g.
+// orders.created and orders.cancelled on a consumer of orders.>. The patterns
+// are tried in registration order and middlewares wrap fn only. All handlers
+// share the durable consumer, so the consumer's middlewares, retries and
+// dead-lettering apply to every one of them. Messages no handler matches are
+// acked and dropped. Register the handlers before Run.
+//
+// The subject of a message is read from the messaging.SubjectKey metadata,
+// which both push and pull mode take from the received message, whatever
+// header the publisher set; else the consumer subject is used and a message no
+// handler matches fails with ErrNoHandler, as its actual subject is unknown.
+func (c *NatsJsConsumer) AddHandler(name, pattern string, fn func(msg *message.Message) error, middlewares ...message.HandlerMiddleware) {
+	handler := func(msg *message.Message) ([]*message.Message, error) {
+		return nil, fn(msg)
+	}
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	if name == "" {
+		name = pattern
+	}
+	c.routesMu.Lock()
+	defer c.routesMu.Unlock()
+	c.routes = append(c.routes, route{name: name, pattern: pattern, handler: handler})
+}
+
+// subjectUnmarshaler sets the subject a push consumer received a message on in
+// the messaging.SubjectKey metadata, like pull mode does.
+type subjectUnmarshaler struct {
+	watermill_nats.DefaultMarshaler
+}
+
+func (u *subjectUnmarshaler) Unmarshal(jsMsg jetstream.Msg) (*message.Message, error) {
+	msg, err := u.DefaultMarshaler.Unmarshal(jsMsg)
+	if err != nil {
+		return nil, err
+	}
+	msg.Metadata.Set(messaging.SubjectKey, jsMsg.Subject())
+	return msg, nil
+}
+
+// dispatch is the single handler of the consumer, passing msg to the first
+// handler whose pattern matches its subject.
+func (c *NatsJsConsumer) dispatch(msg *message.Message) error {
+	subject := msg.Metadata.Get(messaging.SubjectKey)
+	known := subject != ""
+	if !known {
+		subject = c.subject
+	}
+	c.routesMu.RLock()
+	defer c.routesMu.RUnlock()
+	for _, r := range c.routes {
+		if messaging.SubjectMatches(r.pattern, subject) {
+			_, err := r.handler(msg)
+			return err
+		}
+	}
+	if !known {
+		c.log.Errorf("no handler for message %s without subject on %s, nacking it", msg.UUID, subject)
+		return ErrNoHandler
+	}
+	c.log.Warnf("no handler for message %s on subject %s, dropping it", msg.UUID, subject)
+	return nil
+}
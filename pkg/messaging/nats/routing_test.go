@@ -0,0 +1,85 @@
+package nats
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/achuala/go-svc-extn/pkg/messaging"
+	"github.com/go-kratos/kratos/v2/log"
+	nc "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func TestConsumerRouting(t *testing.T) {
+	c := &NatsJsConsumer{log: log.NewHelper(log.DefaultLogger), subject: "orders.>"}
+	var handled []string
+	handler := func(name string) func(msg *message.Message) error {
+		return func(msg *message.Message) error {
+			handled = append(handled, name)
+			return nil
+		}
+	}
+	c.AddHandler("created", "orders.created", handler("created"))
+	c.AddHandler("cancelled", "orders.cancelled", handler("cancelled"))
+	c.AddHandler("eu", "orders.eu.>", handler("eu"))
+
+	for _, subject := range []string{"orders.cancelled", "orders.created", "orders.eu.created", "orders.shipped"} {
+		msg := message.NewMessage(subject, nil)
+		msg.Metadata.Set(messaging.SubjectKey, subject)
+		if err := c.dispatch(msg); err != nil {
+			t.Fatalf("dispatch(%s) failed: %v", subject, err)
+		}
+	}
+	want := []string{"cancelled", "created", "eu"}
+	if len(handled) != len(want) {
+		t.Fatalf("expected handlers %v, got %v", want, handled)
+	}
+	for i := range want {
+		if handled[i] != want[i] {
+			t.Errorf("expected handlers %v, got %v", want, handled)
+		}
+	}
+}
+
+func TestConsumerRoutingWithoutSubject(t *testing.T) {
+	c := &NatsJsConsumer{log: log.NewHelper(log.DefaultLogger), subject: "orders.>"}
+	c.AddHandler("created", "orders.created", func(msg *message.Message) error { return nil })
+
+	if err := c.dispatch(message.NewMessage("1", nil)); !errors.Is(err, ErrNoHandler) {
+		t.Errorf("expected ErrNoHandler for a message without subject, got %v", err)
+	}
+	c.AddHandler("all", "orders.>", func(msg *message.Message) error { return nil })
+	if err := c.dispatch(message.NewMessage("2", nil)); err != nil {
+		t.Errorf("expected the consumer subject to be routed, got %v", err)
+	}
+}
+
+type receivedMsg struct {
+	jetstream.Msg
+	subject string
+	headers nc.Header
+}
+
+func (m receivedMsg) Subject() string    { return m.subject }
+func (m receivedMsg) Headers() nc.Header { return m.headers }
+func (m receivedMsg) Data() []byte       { return []byte("payload") }
+func (m receivedMsg) Reply() string      { return "" }
+
+func TestSubjectUnmarshaler(t *testing.T) {
+	headers := nc.Header{}
+	headers.Set(watermillUUIDHeader, "1")
+	// the header of the publisher is not trusted
+	headers.Set(messaging.SubjectKey, "orders.cancelled")
+
+	msg, err := (&subjectUnmarshaler{}).Unmarshal(receivedMsg{subject: "orders.created", headers: headers})
+	if err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	if got := msg.Metadata.Get(messaging.SubjectKey); got != "orders.created" {
+		t.Errorf("expected the subject of the message, got %q", got)
+	}
+	if msg.UUID != "1" || string(msg.Payload) != "payload" {
+		t.Errorf("unexpected message %s %q", msg.UUID, msg.Payload)
+	}
+}
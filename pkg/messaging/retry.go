@@ -0,0 +1,62 @@
+package messaging
+
+import (
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+// RetryConfig retries a failing handler in-process with exponential backoff
+// before the failure is reported to the broker. Keep the total backoff below the
+// consumer's ack wait, otherwise the broker redelivers the message concurrently.
+type RetryConfig struct {
+	// MaxRetries is the number of retries after the first attempt.
+	MaxRetries int
+	// InitialInterval is the wait before the first retry, 100ms by default.
+	InitialInterval time.Duration
+	// MaxInterval caps the wait between retries, 5s by default.
+	MaxInterval time.Duration
+	// Multiplier grows the wait after each retry, 2 by default.
+	Multiplier float64
+	// Retryable classifies handler errors, errors it rejects fail immediately.
+	// All errors are retried when nil.
+	Retryable func(err error) bool
+}
+
+func (c RetryConfig) withDefaults() RetryConfig {
+	if c.InitialInterval <= 0 {
+		c.InitialInterval = 100 * time.Millisecond
+	}
+	if c.MaxInterval <= 0 {
+		c.MaxInterval = 5 * time.Second
+	}
+	if c.Multiplier < 1 {
+		c.Multiplier = 2
+	}
+	return c
+}
+
+// Middleware returns the watermill handler middleware applying c.
+func (c RetryConfig) Middleware(logger log.Logger) message.HandlerMiddleware {
+	c = c.withDefaults()
+	log := log.NewHelper(logger)
+	return func(h message.HandlerFunc) message.HandlerFunc {
+		return func(msg *message.Message) ([]*message.Message, error) {
+			interval := c.InitialInterval
+			for attempt := 0; ; attempt++ {
+				msgs, err := h(msg)
+				if err == nil || attempt >= c.MaxRetries || (c.Retryable != nil && !c.Retryable(err)) {
+					return msgs, err
+				}
+				log.Warnf("handling message %s failed, retry %d/%d in %v: %v", msg.UUID, attempt+1, c.MaxRetries, interval, err)
+				select {
+				case <-msg.Context().Done():
+					return nil, err
+				case <-time.After(interval):
+				}
+				interval = min(time.Duration(float64(interval)*c.Multiplier), c.MaxInterval)
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package messaging
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/achuala/go-svc-extn/pkg/util/jsonschema"
+)
+
+// SubjectKey is the message metadata key carrying the subject a message was
+// received on, set by the backends which know it. Consumers on a wildcard
+// subject need it to pick the schema of the message.
+const SubjectKey = "subject"
+
+// ErrSchemaViolation is wrapped by the errors of messages whose payload does not
+// match the schema of their subject.
+var ErrSchemaViolation = errors.New("messaging: payload does not match the subject schema")
+
+// SubjectSchemas maps subjects to the id of the schema their payloads must match,
+// as loaded by jsonschema.NewJsonSchemaValidator. A subject may use the NATS
+// wildcards, * for one token and > for the remaining ones, the most specific
+// match is used.
+type SubjectSchemas map[string]string
+
+// schemaId returns the schema id of subject, if any.
+func (s SubjectSchemas) schemaId(subject string) (string, bool) {
+	if id, ok := s[subject]; ok {
+		return id, true
+	}
+	var best string
+	found := false
+	for pattern := range s {
+		if SubjectMatches(pattern, subject) && (!found || len(pattern) > len(best)) {
+			best, found = pattern, true
+		}
+	}
+	return s[best], found
+}
+
+// SubjectMatches reports whether subject matches pattern, which may use the NATS
+// wildcards, * for one token and > for the remaining ones.
+func SubjectMatches(pattern, subject string) bool {
+	patternTokens := strings.Split(pattern, ".")
+	subjectTokens := strings.Split(subject, ".")
+	for i, token := range patternTokens {
+		if token == ">" {
+			return len(subjectTokens) > i
+		}
+		if i >= len(subjectTokens) || (token != "*" && token != subjectTokens[i]) {
+			return false
+		}
+	}
+	return len(patternTokens) == len(subjectTokens)
+}
+
+// ValidatePayload validates the JSON payload of msg, or the data of a structured
+// CloudEvent, against the schema registered for subject. Subjects without a
+// schema are not validated.
+func ValidatePayload(v *jsonschema.JsonSchemaValidator, schemas SubjectSchemas, subject string, msg *message.Message) error {
+	schemaId, ok := schemas.schemaId(subject)
+	if !ok {
+		return nil
+	}
+	data, _, err := unwrapCloudEvent(msg)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSchemaViolation, err)
+	}
+	var payload any
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return fmt.Errorf("%w: %v", ErrSchemaViolation, err)
+	}
+	if err := v.ValidateJson(schemaId, payload); err != nil {
+		return fmt.Errorf("%w: schema %s: %w", ErrSchemaViolation, schemaId, err)
+	}
+	return nil
+}
+
+// SchemaValidation returns a handler middleware rejecting the messages which do
+// not match the schema of their subject, the SubjectKey metadata if set, else
+// the subscribed topic. The handler is not called and the error wraps
+// ErrSchemaViolation, configure a dead-letter subject so that the message is not
+// redelivered.
+func SchemaValidation(v *jsonschema.JsonSchemaValidator, schemas SubjectSchemas) message.HandlerMiddleware {
+	return func(h message.HandlerFunc) message.HandlerFunc {
+		return func(msg *message.Message) ([]*message.Message, error) {
+			subject := msg.Metadata.Get(SubjectKey)
+			if subject == "" {
+				subject = message.SubscribeTopicFromCtx(msg.Context())
+			}
+			if err := ValidatePayload(v, schemas, subject, msg); err != nil {
+				return nil, fmt.Errorf("message %s: %w", msg.UUID, err)
+			}
+			return h(msg)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package messaging
+
+import "testing"
+
+func TestSubjectSchemas(t *testing.T) {
+	schemas := SubjectSchemas{
+		"orders.created": "order-created",
+		"orders.*":       "order",
+		"orders.>":       "order-any",
+	}
+	tests := []struct {
+		subject string
+		want    string
+		found   bool
+	}{
+		{"orders.created", "order-created", true},
+		{"orders.cancelled", "order", true},
+		{"orders.eu.cancelled", "order-any", true},
+		{"orders", "", false},
+		{"payments.created", "", false},
+	}
+	for _, tt := range tests {
+		got, found := schemas.schemaId(tt.subject)
+		if got != tt.want || found != tt.found {
+			t.Errorf("schemaId(%q) = %q, %v, want %q, %v", tt.subject, got, found, tt.want, tt.found)
+		}
+	}
+}
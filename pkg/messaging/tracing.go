@@ -0,0 +1,125 @@
+package messaging
+
+import (
+	"context"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/achuala/go-svc-extn/pkg/ctxkeys"
+	"github.com/achuala/go-svc-extn/pkg/util/idgen"
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/achuala/go-svc-extn/pkg/messaging"
+
+// CorrelationIdKey is the message metadata key carrying the correlation id, the
+// same name as the request header.
+const CorrelationIdKey = string(ctxkeys.CorrelationIdKey)
+
+// propagator writes W3C trace context and both B3 encodings, and reads whichever
+// the publisher sent.
+var propagator = propagation.NewCompositeTextMapPropagator(
+	propagation.TraceContext{},
+	b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader|b3.B3SingleHeader)),
+)
+
+// metadataCarrier adapts message metadata to a propagation.TextMapCarrier.
+type metadataCarrier message.Metadata
+
+func (c metadataCarrier) Get(key string) string { return message.Metadata(c).Get(key) }
+
+func (c metadataCarrier) Set(key, value string) { message.Metadata(c).Set(key, value) }
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// InjectMetadata writes the trace context and correlation id of ctx into the
+// message metadata, keeping a correlation id the message already carries.
+func InjectMetadata(ctx context.Context, msg *message.Message) {
+	propagator.Inject(ctx, metadataCarrier(msg.Metadata))
+	if correlationId, ok := ctxkeys.CorrelationIdFromContext(ctx); ok && msg.Metadata.Get(CorrelationIdKey) == "" {
+		msg.Metadata.Set(CorrelationIdKey, correlationId)
+	}
+}
+
+// ExtractMetadata returns ctx with the trace context and correlation id of the
+// message metadata. A correlation id is generated when the message has none.
+func ExtractMetadata(ctx context.Context, msg *message.Message) context.Context {
+	ctx = propagator.Extract(ctx, metadataCarrier(msg.Metadata))
+	correlationId := msg.Metadata.Get(CorrelationIdKey)
+	if correlationId == "" {
+		correlationId = idgen.NewId()
+	}
+	return ctxkeys.NewCorrelationIdContext(ctx, correlationId)
+}
+
+type tracingPublisher struct {
+	message.Publisher
+}
+
+// TracingPublisher decorates pub to start a producer span per message and
+// propagate it, along with the correlation id, in the message metadata. The
+// parent is taken from msg.Context(), so set it with msg.SetContext before
+// publishing.
+func TracingPublisher(pub message.Publisher) message.Publisher {
+	return &tracingPublisher{Publisher: pub}
+}
+
+func (p *tracingPublisher) Publish(topic string, messages ...*message.Message) error {
+	tracer := otel.Tracer(tracerName)
+	spans := make([]trace.Span, 0, len(messages))
+	for _, msg := range messages {
+		ctx, span := tracer.Start(msg.Context(), "publish "+topic,
+			trace.WithSpanKind(trace.SpanKindProducer),
+			trace.WithAttributes(
+				attribute.String("messaging.destination.name", topic),
+				attribute.String("messaging.message.id", msg.UUID),
+			))
+		InjectMetadata(ctx, msg)
+		spans = append(spans, span)
+	}
+	err := p.Publisher.Publish(topic, messages...)
+	for _, span := range spans {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+	return err
+}
+
+// Tracing is a handler middleware which continues the trace of the message in a
+// consumer span and puts the correlation id into the message context, so that
+// handlers logging with msg.Context() line up with the originating request.
+func Tracing() message.HandlerMiddleware {
+	return func(h message.HandlerFunc) message.HandlerFunc {
+		return func(msg *message.Message) ([]*message.Message, error) {
+			ctx := ExtractMetadata(msg.Context(), msg)
+			ctx, span := otel.Tracer(tracerName).Start(ctx, "consume "+message.SubscribeTopicFromCtx(msg.Context()),
+				trace.WithSpanKind(trace.SpanKindConsumer),
+				trace.WithAttributes(
+					attribute.String("messaging.destination.name", message.SubscribeTopicFromCtx(msg.Context())),
+					attribute.String("messaging.consumer.group.name", message.HandlerNameFromCtx(msg.Context())),
+					attribute.String("messaging.message.id", msg.UUID),
+				))
+			defer span.End()
+			msg.SetContext(ctx)
+			msgs, err := h(msg)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			return msgs, err
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package messaging
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// ContentTypeKey is the message metadata key carrying the payload content type.
+const ContentTypeKey = "content-type"
+
+// ErrDecode is wrapped by the errors of Decode, e.g. to exclude undecodable
+// messages in RetryConfig.Retryable.
+var ErrDecode = errors.New("messaging: payload cannot be decoded")
+
+// TypedHandlerFunc handles a message whose payload was decoded into T.
+type TypedHandlerFunc[T any] func(ctx context.Context, payload T, metadata message.Metadata) error
+
+// cloudEvent is the structured mode envelope of a CloudEvent, as written by PublishEvent.
+type cloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data"`
+	DataBase64      string          `json:"data_base64"`
+}
+
+// Decode decodes the message payload into T. A structured CloudEvent is unwrapped
+// to its data first, the payload of a binary one is its data. Proto messages (T a generated message pointer) are read as
+// binary when the content type says protobuf, else as protojson; anything else
+// is read as JSON.
+func Decode[T any](msg *message.Message) (T, error) {
+	var payload T
+	data, contentType, err := unwrapCloudEvent(msg)
+	if err != nil {
+		return payload, err
+	}
+	if m, ok := any(payload).(proto.Message); ok {
+		m = m.ProtoReflect().New().Interface()
+		if strings.Contains(contentType, "protobuf") {
+			err = proto.Unmarshal(data, m)
+		} else {
+			err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, m)
+		}
+		if err != nil {
+			return payload, fmt.Errorf("%w: %v", ErrDecode, err)
+		}
+		return m.(T), nil
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return payload, fmt.Errorf("%w: %v", ErrDecode, err)
+	}
+	return payload, nil
+}
+
+func unwrapCloudEvent(msg *message.Message) ([]byte, string, error) {
+	payload, contentType := msg.Payload, msg.Metadata.Get(ContentTypeKey)
+	if isBinaryEvent(msg) || !bytes.HasPrefix(bytes.TrimSpace(payload), []byte("{")) {
+		return payload, contentType, nil
+	}
+	var event cloudEvent
+	if err := json.Unmarshal(payload, &event); err != nil || event.SpecVersion == "" {
+		return payload, contentType, nil
+	}
+	if event.DataBase64 != "" {
+		data, err := base64.StdEncoding.DecodeString(event.DataBase64)
+		if err != nil {
+			return nil, "", fmt.Errorf("%w: %v", ErrDecode, err)
+		}
+		return data, event.DataContentType, nil
+	}
+	return event.Data, event.DataContentType, nil
+}
+
+// TypedHandler adapts fn to a watermill handler func, e.g. for
+// NatsJsConsumerConfig.HandlerFunc. A payload which cannot be decoded is nacked
+// with an error wrapping ErrDecode without calling fn.
+func TypedHandler[T any](fn TypedHandlerFunc[T]) func(msg *message.Message) error {
+	return func(msg *message.Message) error {
+		payload, err := Decode[T](msg)
+		if err != nil {
+			return fmt.Errorf("message %s: %w", msg.UUID, err)
+		}
+		return fn(msg.Context(), payload, msg.Metadata)
+	}
+}
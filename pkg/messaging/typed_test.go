@@ -0,0 +1,53 @@
+package messaging_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/achuala/go-svc-extn/pkg/messaging"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type order struct {
+	Id     string `json:"id"`
+	Amount int    `json:"amount"`
+}
+
+func TestDecode(t *testing.T) {
+	t.Run("json", func(t *testing.T) {
+		got, err := messaging.Decode[order](message.NewMessage("1", []byte(`{"id":"o-1","amount":5}`)))
+		if err != nil || got.Id != "o-1" || got.Amount != 5 {
+			t.Fatalf("unexpected decode result %+v, %v", got, err)
+		}
+	})
+	t.Run("cloudevent", func(t *testing.T) {
+		payload := `{"specversion":"1.0","id":"e-1","type":"order.created","source":"test","datacontenttype":"application/json","data":{"id":"o-2","amount":7}}`
+		got, err := messaging.Decode[*order](message.NewMessage("2", []byte(payload)))
+		if err != nil || got.Id != "o-2" || got.Amount != 7 {
+			t.Fatalf("unexpected decode result %+v, %v", got, err)
+		}
+	})
+	t.Run("protojson", func(t *testing.T) {
+		got, err := messaging.Decode[*wrapperspb.StringValue](message.NewMessage("3", []byte(`"hello"`)))
+		if err != nil || got.GetValue() != "hello" {
+			t.Fatalf("unexpected decode result %v, %v", got, err)
+		}
+	})
+	t.Run("proto binary", func(t *testing.T) {
+		data, _ := proto.Marshal(wrapperspb.String("binary"))
+		msg := message.NewMessage("4", data)
+		msg.Metadata.Set(messaging.ContentTypeKey, "application/protobuf")
+		got, err := messaging.Decode[*wrapperspb.StringValue](msg)
+		if err != nil || got.GetValue() != "binary" {
+			t.Fatalf("unexpected decode result %v, %v", got, err)
+		}
+	})
+	t.Run("invalid", func(t *testing.T) {
+		_, err := messaging.Decode[order](message.NewMessage("5", []byte(`not json`)))
+		if !errors.Is(err, messaging.ErrDecode) {
+			t.Fatalf("expected ErrDecode, got %v", err)
+		}
+	})
+}
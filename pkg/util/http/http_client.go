@@ -20,15 +20,23 @@ type HttpClient struct {
 type HttpClientConfig struct {
 	Endpoint string
 	Timeout  time.Duration
+	// Retries the failed calls with the policy when set
+	Retry *extnmw.RetryPolicy
 }
 
 func NewHttpClient(ctx context.Context, httpClientCfg HttpClientConfig, logger log.Logger) (*HttpClient, error) {
 	b3Propagator := b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader | b3.B3SingleHeader))
-	httpClient, err := khttp.NewClient(ctx, khttp.WithEndpoint(httpClientCfg.Endpoint), khttp.WithMiddleware(
+	middlewares := []middleware.Middleware{
 		recovery.Recovery(),
 		tracing.Client(tracing.WithPropagator(b3Propagator)),
 		extnmw.ClientCorrelationIdInjector(),
-		extnmw.Client(logger),
+	}
+	if httpClientCfg.Retry != nil {
+		middlewares = append(middlewares, extnmw.ClientRetry(*httpClientCfg.Retry))
+	}
+	middlewares = append(middlewares, extnmw.Client(logger))
+	httpClient, err := khttp.NewClient(ctx, khttp.WithEndpoint(httpClientCfg.Endpoint), khttp.WithMiddleware(
+		middlewares...,
 	), khttp.WithTimeout(httpClientCfg.Timeout))
 
 	if err != nil {
@@ -44,6 +52,9 @@ func NewHttpClientWithMiddleware(ctx context.Context, httpClientCfg HttpClientCo
 		tracing.Client(tracing.WithPropagator(b3Propagator)),
 		extnmw.ClientCorrelationIdInjector(),
 	}
+	if httpClientCfg.Retry != nil {
+		middlewares = append(middlewares, extnmw.ClientRetry(*httpClientCfg.Retry))
+	}
 	// Add the custom middlewares
 	middlewares = append(middlewares, customMiddlewares...)
 	// Finall the logger
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/santhosh-tekuri/jsonschema/v5"
@@ -132,3 +133,57 @@ func convertInterfaceSliceToStringSlice(input []interface{}) ([]string, error) {
 	}
 	return output, nil
 }
+
+// SchemaFieldViolation is a violation of the schema by a field of the
+// validated document.
+type SchemaFieldViolation struct {
+	// Path of the field, e.g. items[0].name, empty for the document itself
+	Field string
+	// Keyword of the schema which is violated, e.g. required or minLength
+	Keyword string
+	// Message describes the violation, e.g. missing properties: "name"
+	Message string
+}
+
+// FieldViolations returns the violations of an error returned by
+// ValidateJson, nil when err is not a schema validation error.
+func FieldViolations(err error) []SchemaFieldViolation {
+	var verr *jsonschema.ValidationError
+	if !errors.As(err, &verr) {
+		return nil
+	}
+	var violations []SchemaFieldViolation
+	var collect func(e *jsonschema.ValidationError)
+	collect = func(e *jsonschema.ValidationError) {
+		if len(e.Causes) == 0 {
+			violations = append(violations, SchemaFieldViolation{
+				Field:   fieldPath(e.InstanceLocation),
+				Keyword: e.KeywordLocation[strings.LastIndex(e.KeywordLocation, "/")+1:],
+				Message: e.Message,
+			})
+			return
+		}
+		for _, cause := range e.Causes {
+			collect(cause)
+		}
+	}
+	collect(verr)
+	return violations
+}
+
+// fieldPath converts a JSON pointer, e.g. /items/0/name, to items[0].name.
+func fieldPath(pointer string) string {
+	var result strings.Builder
+	for _, token := range strings.Split(pointer, "/")[1:] {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		if _, err := strconv.ParseUint(token, 10, 64); err == nil {
+			result.WriteString("[" + token + "]")
+			continue
+		}
+		if result.Len() > 0 {
+			result.WriteByte('.')
+		}
+		result.WriteString(token)
+	}
+	return result.String()
+}
@@ -1,6 +1,7 @@
 package jsonschema_test
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -134,6 +135,35 @@ func TestGetUniqueKeys(t *testing.T) {
 	}
 }
 
+func TestFieldViolations(t *testing.T) {
+	tempDir := t.TempDir()
+	createTestSchemaFiles(tempDir, t)
+
+	validator, err := jsonschema.NewJsonSchemaValidator(tempDir)
+	if err != nil {
+		t.Fatalf("failed to create validator: %v", err)
+	}
+
+	err = validator.ValidateJson("http://example.com/schema1", map[string]interface{}{"age": "thirty"})
+	violations := jsonschema.FieldViolations(err)
+	fields := make(map[string]string)
+	keywords := make(map[string]string)
+	for _, v := range violations {
+		fields[v.Field] = v.Message
+		keywords[v.Field] = v.Keyword
+	}
+	if len(fields) != 2 || fields[""] == "" || fields["age"] == "" {
+		t.Errorf("expected violations of the document and age, got %v", violations)
+	}
+	if keywords[""] != "required" || keywords["age"] != "type" {
+		t.Errorf("expected required and type keywords, got %v", keywords)
+	}
+
+	if violations := jsonschema.FieldViolations(errors.New("other")); violations != nil {
+		t.Errorf("expected no violations for other errors, got %v", violations)
+	}
+}
+
 func equalStringSlices(a, b []string) bool {
 	if len(a) != len(b) {
 		return false
@@ -0,0 +1,64 @@
+package sensitive
+
+import "google.golang.org/protobuf/reflect/protoreflect"
+
+// ReplaceFunc returns the replacement of a scalar value of the given kind,
+// false leaves the value unchanged.
+type ReplaceFunc func(kind protoreflect.Kind, v protoreflect.Value) (protoreflect.Value, bool)
+
+// Replace replaces the scalar values of the field fd of m holding v, as
+// passed to a Func: the value of a singular field, the elements of a list
+// and the keys and values of a map. Message values are left to Walk.
+func Replace(m protoreflect.Message, fd protoreflect.FieldDescriptor, v protoreflect.Value, fn ReplaceFunc) {
+	if fd.IsMap() {
+		replaceMap(fd, v.Map(), fn)
+		return
+	}
+	if isMessage(fd.Kind()) {
+		return
+	}
+	if fd.IsList() {
+		list := v.List()
+		for i := 0; i < list.Len(); i++ {
+			if out, ok := fn(fd.Kind(), list.Get(i)); ok {
+				list.Set(i, out)
+			}
+		}
+		return
+	}
+	if out, ok := fn(fd.Kind(), v); ok {
+		m.Set(fd, out)
+	}
+}
+
+// replaceMap rebuilds the map, keys replaced with the same value collapse
+// into one entry.
+func replaceMap(fd protoreflect.FieldDescriptor, mp protoreflect.Map, fn ReplaceFunc) {
+	var keys []protoreflect.MapKey
+	var values []protoreflect.Value
+	mp.Range(func(key protoreflect.MapKey, value protoreflect.Value) bool {
+		keys = append(keys, key)
+		values = append(values, value)
+		return true
+	})
+	for _, key := range keys {
+		mp.Clear(key)
+	}
+	keyKind, valueKind := fd.MapKey().Kind(), fd.MapValue().Kind()
+	for i, key := range keys {
+		value := values[i]
+		if out, ok := fn(keyKind, key.Value()); ok {
+			key = out.MapKey()
+		}
+		if !isMessage(valueKind) {
+			if out, ok := fn(valueKind, value); ok {
+				value = out
+			}
+		}
+		mp.Set(key, value)
+	}
+}
+
+func isMessage(kind protoreflect.Kind) bool {
+	return kind == protoreflect.MessageKind || kind == protoreflect.GroupKind
+}
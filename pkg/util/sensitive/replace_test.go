@@ -0,0 +1,135 @@
+package sensitive
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/achuala/go-svc-extn/gen/go/options"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// accountDescriptor builds
+//
+//	message Account {
+//		string name = 1 [(options.sensitive).mask = true];
+//		repeated string phones = 2 [(options.sensitive).mask = true];
+//		map<string, string> labels = 3 [(options.sensitive).mask = true];
+//		repeated Account children = 4;
+//		map<string, Account> linked = 5;
+//		string id = 6;
+//	}
+func accountDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	mask := func() *descriptorpb.FieldOptions {
+		opts := &descriptorpb.FieldOptions{}
+		proto.SetExtension(opts, options.E_Sensitive, &options.Sensitive{LogAction: &options.Sensitive_Mask{Mask: true}})
+		return opts
+	}
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, label descriptorpb.FieldDescriptorProto_Label, typeName string, opts *descriptorpb.FieldOptions) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{Name: proto.String(name), Number: proto.Int32(number), Type: typ.Enum(), Label: label.Enum(), Options: opts}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	entry := func(name string, valueType descriptorpb.FieldDescriptorProto_Type, valueTypeName string) *descriptorpb.DescriptorProto {
+		return &descriptorpb.DescriptorProto{
+			Name: proto.String(name),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("key", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, "", nil),
+				field("value", 2, valueType, descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, valueTypeName, nil),
+			},
+			Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+		}
+	}
+	str, msg := descriptorpb.FieldDescriptorProto_TYPE_STRING, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+	optional, repeated := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("test/account.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Account"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("name", 1, str, optional, "", mask()),
+				field("phones", 2, str, repeated, "", mask()),
+				field("labels", 3, msg, repeated, ".test.Account.LabelsEntry", mask()),
+				field("children", 4, msg, repeated, ".test.Account", nil),
+				field("linked", 5, msg, repeated, ".test.Account.LinkedEntry", nil),
+				field("id", 6, str, optional, "", nil),
+			},
+			NestedType: []*descriptorpb.DescriptorProto{
+				entry("LabelsEntry", str, ""),
+				entry("LinkedEntry", msg, ".test.Account"),
+			},
+		}},
+	}, protoregistry.GlobalFiles)
+	require.NoError(t, err)
+	return fd.Messages().Get(0)
+}
+
+func TestReplace(t *testing.T) {
+	md := accountDescriptor(t)
+	fields := md.Fields()
+	newAccount := func(name string) *dynamicpb.Message {
+		m := dynamicpb.NewMessage(md)
+		m.Set(fields.ByName("id"), protoreflect.ValueOfString("id-"+name))
+		m.Set(fields.ByName("name"), protoreflect.ValueOfString(name))
+		m.Mutable(fields.ByName("phones")).List().Append(protoreflect.ValueOfString(name + "-phone"))
+		m.Mutable(fields.ByName("labels")).Map().Set(protoreflect.ValueOfString(name+"-key").MapKey(), protoreflect.ValueOfString(name+"-label"))
+		return m
+	}
+	m := newAccount("root")
+	m.Mutable(fields.ByName("children")).List().Append(protoreflect.ValueOfMessage(newAccount("child")))
+	m.Mutable(fields.ByName("linked")).Map().Set(protoreflect.ValueOfString("link").MapKey(), protoreflect.ValueOfMessage(newAccount("linked")))
+
+	upper := func(kind protoreflect.Kind, v protoreflect.Value) (protoreflect.Value, bool) {
+		if kind != protoreflect.StringKind {
+			return v, false
+		}
+		return protoreflect.ValueOfString(strings.ToUpper(v.String())), true
+	}
+	require.NoError(t, Walk(m, func(m protoreflect.Message, fd protoreflect.FieldDescriptor, v protoreflect.Value, opts *options.Sensitive) error {
+		if opts.GetMask() {
+			Replace(m, fd, v, upper)
+		}
+		return nil
+	}))
+
+	assertReplaced := func(m protoreflect.Message, name string) {
+		upperName := strings.ToUpper(name)
+		assert.Equal(t, "id-"+name, m.Get(fields.ByName("id")).String())
+		assert.Equal(t, upperName, m.Get(fields.ByName("name")).String())
+		phones := m.Get(fields.ByName("phones")).List()
+		require.Equal(t, 1, phones.Len())
+		assert.Equal(t, upperName+"-PHONE", phones.Get(0).String())
+		labels := m.Get(fields.ByName("labels")).Map()
+		require.Equal(t, 1, labels.Len())
+		assert.Equal(t, upperName+"-LABEL", labels.Get(protoreflect.ValueOfString(upperName+"-KEY").MapKey()).String())
+	}
+	assertReplaced(m, "root")
+	assertReplaced(m.Get(fields.ByName("children")).List().Get(0).Message(), "child")
+	linked := m.Get(fields.ByName("linked")).Map()
+	assert.True(t, linked.Has(protoreflect.ValueOfString("link").MapKey()))
+	assertReplaced(linked.Get(protoreflect.ValueOfString("link").MapKey()).Message(), "linked")
+}
+
+func TestReplaceMapKeysCollapse(t *testing.T) {
+	md := accountDescriptor(t)
+	labelsField := md.Fields().ByName("labels")
+	m := dynamicpb.NewMessage(md)
+	labels := m.Mutable(labelsField).Map()
+	for _, k := range []string{"a", "b", "c"} {
+		labels.Set(protoreflect.ValueOfString(k).MapKey(), protoreflect.ValueOfString(k))
+	}
+	Replace(m, labelsField, m.Get(labelsField), func(kind protoreflect.Kind, v protoreflect.Value) (protoreflect.Value, bool) {
+		return protoreflect.ValueOfString("****"), true
+	})
+	assert.Equal(t, 1, m.Get(labelsField).Map().Len())
+}
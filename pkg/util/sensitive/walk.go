@@ -0,0 +1,115 @@
+// Package sensitive walks the fields of proto messages annotated with the
+// options.Sensitive field option.
+package sensitive
+
+import (
+	"github.com/achuala/go-svc-extn/gen/go/options"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Func is called with a populated field of m and its Sensitive option.
+type Func func(m protoreflect.Message, fd protoreflect.FieldDescriptor, v protoreflect.Value, opts *options.Sensitive) error
+
+// Walk calls fn for every populated field of m, and of the messages nested in
+// m, maps and lists included, which has a Sensitive option, see
+// EffectiveOptions. Nested messages are visited before the field holding
+// them. Walk stops at the first error.
+func Walk(m protoreflect.Message, fn Func) error {
+	var err error
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch typed := v.Interface().(type) {
+		case protoreflect.Message:
+			err = Walk(typed, fn)
+		case protoreflect.Map:
+			typed.Range(func(key protoreflect.MapKey, value protoreflect.Value) bool {
+				if msg, ok := value.Interface().(protoreflect.Message); ok {
+					err = Walk(msg, fn)
+				}
+				if msg, ok := key.Interface().(protoreflect.Message); ok && err == nil {
+					err = Walk(msg, fn)
+				}
+				return err == nil
+			})
+		case protoreflect.List:
+			for i := 0; i < typed.Len() && err == nil; i++ {
+				if msg, ok := typed.Get(i).Interface().(protoreflect.Message); ok {
+					err = Walk(msg, fn)
+				}
+			}
+		}
+		if err != nil {
+			return false
+		}
+
+		if opts := EffectiveOptions(fd); opts != nil {
+			err = fn(m, fd, v, opts)
+		}
+		return err == nil
+	})
+	return err
+}
+
+// Options returns the Sensitive option of the field, nil when it has none.
+func Options(fd protoreflect.FieldDescriptor) *options.Sensitive {
+	opts, ok := fd.Options().(*descriptorpb.FieldOptions)
+	if !ok || opts == nil {
+		return nil
+	}
+	ext, ok := proto.GetExtension(opts, options.E_Sensitive).(*options.Sensitive)
+	if !ok {
+		return nil
+	}
+	return ext
+}
+
+// MessageOptions returns the sensitive_message option of the message, nil
+// when it has none.
+func MessageOptions(md protoreflect.MessageDescriptor) *options.Sensitive {
+	opts, ok := md.Options().(*descriptorpb.MessageOptions)
+	if !ok || opts == nil {
+		return nil
+	}
+	ext, ok := proto.GetExtension(opts, options.E_SensitiveMessage).(*options.Sensitive)
+	if !ok {
+		return nil
+	}
+	return ext
+}
+
+// OneofOptions returns the sensitive_oneof option of the oneof, nil when it
+// has none.
+func OneofOptions(od protoreflect.OneofDescriptor) *options.Sensitive {
+	opts, ok := od.Options().(*descriptorpb.OneofOptions)
+	if !ok || opts == nil {
+		return nil
+	}
+	ext, ok := proto.GetExtension(opts, options.E_SensitiveOneof).(*options.Sensitive)
+	if !ok {
+		return nil
+	}
+	return ext
+}
+
+// EffectiveOptions returns the Sensitive option which applies to the field:
+// its own, else the one of its oneof, else the one of the message type it
+// holds, the value type for maps.
+func EffectiveOptions(fd protoreflect.FieldDescriptor) *options.Sensitive {
+	if opts := Options(fd); opts != nil {
+		return opts
+	}
+	if od := fd.ContainingOneof(); od != nil && !od.IsSynthetic() {
+		if opts := OneofOptions(od); opts != nil {
+			return opts
+		}
+	}
+	md := fd.Message()
+	if fd.IsMap() {
+		md = fd.MapValue().Message()
+	}
+	if md != nil {
+		return MessageOptions(md)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package sensitive
+
+import (
+	"testing"
+
+	"github.com/achuala/go-svc-extn/gen/go/options"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// paymentDescriptor builds
+//
+//	message Card {
+//		option (options.sensitive_message).redact = true;
+//		string pan = 1;
+//	}
+//	message Payment {
+//		Card card = 1;
+//		oneof credential {
+//			option (options.sensitive_oneof).redact = true;
+//			string password = 2;
+//			string token = 3 [(options.sensitive).mask = true];
+//		}
+//		string reference = 4;
+//	}
+func paymentDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	redact := &options.Sensitive{LogAction: &options.Sensitive_Redact{Redact: true}}
+	messageOpts := &descriptorpb.MessageOptions{}
+	proto.SetExtension(messageOpts, options.E_SensitiveMessage, redact)
+	oneofOpts := &descriptorpb.OneofOptions{}
+	proto.SetExtension(oneofOpts, options.E_SensitiveOneof, redact)
+	fieldOpts := &descriptorpb.FieldOptions{}
+	proto.SetExtension(fieldOpts, options.E_Sensitive, &options.Sensitive{LogAction: &options.Sensitive_Mask{Mask: true}})
+
+	str, msg := descriptorpb.FieldDescriptorProto_TYPE_STRING, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+	optional := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("test/payment.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name:    proto.String("Card"),
+			Options: messageOpts,
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{Name: proto.String("pan"), Number: proto.Int32(1), Type: str.Enum(), Label: optional.Enum()},
+			},
+		}, {
+			Name: proto.String("Payment"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{Name: proto.String("card"), Number: proto.Int32(1), Type: msg.Enum(), Label: optional.Enum(), TypeName: proto.String(".test.Card")},
+				{Name: proto.String("password"), Number: proto.Int32(2), Type: str.Enum(), Label: optional.Enum(), OneofIndex: proto.Int32(0)},
+				{Name: proto.String("token"), Number: proto.Int32(3), Type: str.Enum(), Label: optional.Enum(), OneofIndex: proto.Int32(0), Options: fieldOpts},
+				{Name: proto.String("reference"), Number: proto.Int32(4), Type: str.Enum(), Label: optional.Enum()},
+			},
+			OneofDecl: []*descriptorpb.OneofDescriptorProto{{Name: proto.String("credential"), Options: oneofOpts}},
+		}},
+	}, protoregistry.GlobalFiles)
+	require.NoError(t, err)
+	return fd.Messages().Get(1)
+}
+
+func TestEffectiveOptions(t *testing.T) {
+	md := paymentDescriptor(t)
+	fields := md.Fields()
+	assert.True(t, MessageOptions(fields.ByName("card").Message()).GetRedact())
+	assert.True(t, EffectiveOptions(fields.ByName("card")).GetRedact())
+	assert.True(t, EffectiveOptions(fields.ByName("password")).GetRedact())
+	assert.True(t, EffectiveOptions(fields.ByName("token")).GetMask())
+	assert.Nil(t, EffectiveOptions(fields.ByName("reference")))
+
+	m := dynamicpb.NewMessage(md)
+	card := dynamicpb.NewMessage(fields.ByName("card").Message())
+	card.Set(card.Descriptor().Fields().ByName("pan"), protoreflect.ValueOfString("4111111111111111"))
+	m.Set(fields.ByName("card"), protoreflect.ValueOfMessage(card))
+	m.Set(fields.ByName("password"), protoreflect.ValueOfString("secret"))
+	m.Set(fields.ByName("reference"), protoreflect.ValueOfString("ref"))
+
+	visited := map[protoreflect.Name]bool{}
+	require.NoError(t, Walk(m, func(m protoreflect.Message, fd protoreflect.FieldDescriptor, v protoreflect.Value, opts *options.Sensitive) error {
+		visited[fd.Name()] = opts.GetRedact()
+		return nil
+	}))
+	assert.Equal(t, map[protoreflect.Name]bool{"card": true, "password": true}, visited)
+}